@@ -18,9 +18,13 @@ package apcore
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework"
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/framework/db"
+	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
 )
@@ -31,6 +35,12 @@ func doCreateTables(configFilePath string, a app.Application, debug bool, scheme
 		return err
 	}
 	defer db.Close()
+	return createTables(db, d, ms, a, cfg, debug)
+}
+
+// createTables creates the tables of the models, followed by those of the
+// application.
+func createTables(db *sql.DB, d models.SqlDialect, ms []models.Model, a app.Application, cfg *config.Config, debug bool) error {
 	tx, err := db.BeginTx(context.Background(), nil)
 	if err != nil {
 		return err
@@ -47,6 +57,15 @@ func doCreateTables(configFilePath string, a app.Application, debug bool, scheme
 	return a.CreateTables(context.Background(), &services.Any{db}, cfg, debug)
 }
 
+func doPingDB(c *config.Config) error {
+	sqldb, _, err := db.NewDB(c)
+	if err != nil {
+		return err
+	}
+	defer sqldb.Close()
+	return db.MustPing(sqldb)
+}
+
 func doInitAdmin(configFilePath string, a app.Application, debug bool, scheme string) error {
 	db, users, c, err := newUserService(configFilePath, a, debug, scheme)
 	if err != nil {
@@ -68,6 +87,7 @@ func doInitAdmin(configFilePath string, a app.Application, debug bool, scheme st
 
 	// Create the user in the database
 	defer db.Close()
+	defer users.WaitForOnboarding()
 	tx, err := db.BeginTx(context.Background(), nil)
 	if err != nil {
 		return err
@@ -89,18 +109,10 @@ func doInitData(configFilePath string, a app.Application, debug bool, scheme str
 		return err
 	}
 
-	// Create the server actor in the database
+	// Create the server actor in the database, unless it already exists
 	defer db.Close()
-	tx, err := db.BeginTx(context.Background(), nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	_, err = users.CreateInstanceActorSingleton(util.Context{context.Background()}, scheme, c.ServerConfig.Host, c.ServerConfig.RSAKeySize)
-	if err != nil {
-		return err
-	}
-	return tx.Commit()
+	_, err = users.EnsureInstanceActor(util.Context{context.Background()}, scheme, c.ServerConfig.Host, c.ServerConfig.RSAKeySize, framework.DefaultServerProfile(c, scheme, c.ServerConfig.Host))
+	return err
 }
 
 func doInitServerProfile(configFilePath string, a app.Application, debug bool, scheme string) error {
@@ -125,3 +137,21 @@ func doInitServerProfile(configFilePath string, a app.Application, debug bool, s
 	}
 	return tx.Commit()
 }
+
+func doRecountCollections(configFilePath string, a app.Application, debug bool, scheme string) ([]models.DriftedCollection, error) {
+	db, d, _, _, err := newModels(configFilePath, a, debug, scheme)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	cd := &models.CollectionDrift{}
+	if err = cd.Prepare(db, d); err != nil {
+		return nil, err
+	}
+	defer cd.Close()
+	drift := &services.CollectionDrift{
+		DB:              db,
+		CollectionDrift: cd,
+	}
+	return drift.Recount(util.Context{context.Background()})
+}
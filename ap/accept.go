@@ -0,0 +1,168 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// onAcceptFollow adds the accepting actors to the user's following collection
+// when they Accept a Follow the user sent.
+//
+// Only Follows stored by this server and sent by the user are trusted, and an
+// accepting actor is only added if the Follow was of that actor.
+func (f *FederatingBehavior) onAcceptFollow(c context.Context, accept vocab.ActivityStreamsAccept) error {
+	ctx := util.Context{c}
+	actorIRI, followingIRI, err := f.followingIRIs(ctx)
+	if err != nil {
+		return err
+	}
+	followed, err := f.sentFollowObjects(ctx, actorIRI, accept.GetActivityStreamsObject(), accept)
+	if err != nil {
+		return err
+	}
+	for _, id := range followed {
+		if has, err := f.fg.ContainsForActor(ctx, actorIRI, id); err != nil {
+			return err
+		} else if has {
+			continue
+		}
+		if err := f.fg.PrependItem(ctx, followingIRI, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onUndoAccept removes the undoing actors from the user's following collection
+// when they Undo their Accept of a Follow the user sent.
+func (f *FederatingBehavior) onUndoAccept(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	objects := undo.GetActivityStreamsObject()
+	if objects == nil {
+		return nil
+	}
+	ctx := util.Context{c}
+	actorIRI, followingIRI, err := f.followingIRIs(ctx)
+	if err != nil {
+		return err
+	}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		var accept vocab.ActivityStreamsAccept
+		if iter.IsActivityStreamsAccept() {
+			accept = iter.GetActivityStreamsAccept()
+		} else if iter.IsIRI() {
+			t, err := f.db.storedActivity(ctx, iter.GetIRI())
+			if err != nil {
+				return err
+			}
+			accept, _ = t.(vocab.ActivityStreamsAccept)
+		}
+		if accept == nil {
+			continue
+		}
+		followed, err := f.sentFollowObjects(ctx, actorIRI, accept.GetActivityStreamsObject(), undo)
+		if err != nil {
+			return err
+		}
+		for _, id := range followed {
+			if has, err := f.fg.ContainsForActor(ctx, actorIRI, id); err != nil {
+				return err
+			} else if !has {
+				continue
+			}
+			if err := f.fg.DeleteItem(ctx, followingIRI, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// followingIRIs are the IRIs of the user in the context and of the user's
+// following collection.
+func (f *FederatingBehavior) followingIRIs(c util.Context) (actorIRI, followingIRI *url.URL, err error) {
+	var uuid paths.UUID
+	if uuid, err = c.UserPathUUID(); err != nil {
+		return
+	}
+	if actorIRI, err = c.ActorIRI(); err != nil {
+		return
+	}
+	followingIRI = paths.UUIDIRIFor(actorIRI.Scheme, actorIRI.Host, paths.FollowingPathKey, uuid)
+	return
+}
+
+// sentFollowObjects determines which actors of the activity were followed by
+// the Follows among the objects that the user sent.
+//
+// The Follows are looked up by their id, so that a peer cannot fabricate one.
+func (f *FederatingBehavior) sentFollowObjects(c util.Context, actorIRI *url.URL, objects vocab.ActivityStreamsObjectProperty, activity actorer) (followed []*url.URL, err error) {
+	if objects == nil {
+		return
+	}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		var id *url.URL
+		if id, err = pub.ToId(iter); err != nil {
+			return
+		}
+		var t vocab.Type
+		if t, err = f.db.storedActivity(c, id); err != nil {
+			return
+		}
+		follow, ok := t.(vocab.ActivityStreamsFollow)
+		if !ok {
+			continue
+		}
+		var sent bool
+		if sent, err = followHasActor(follow, actorIRI); err != nil {
+			return
+		} else if !sent {
+			continue
+		}
+		fo := follow.GetActivityStreamsObject()
+		if fo == nil {
+			continue
+		}
+		for fi := fo.Begin(); fi != fo.End(); fi = fi.Next() {
+			var obj *url.URL
+			if obj, err = pub.ToId(fi); err != nil {
+				return
+			}
+			if hasActor(activity, obj) {
+				followed = append(followed, obj)
+			}
+		}
+	}
+	return
+}
+
+// hasAcceptCallback determines whether the application already handles Accept
+// activities itself.
+func hasAcceptCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsAccept) error); ok {
+			return true
+		}
+	}
+	return false
+}
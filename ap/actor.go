@@ -17,9 +17,12 @@
 package ap
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 
 	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework/config"
 	"github.com/go-fed/apcore/framework/conn"
@@ -36,8 +39,12 @@ func NewActor(c *config.Config,
 	pk *services.PrivateKeys,
 	po *services.Policies,
 	f *services.Followers,
+	fg *services.Following,
 	u *services.Users,
-	tc *conn.Controller) (actor pub.Actor, err error) {
+	dm *services.Domains,
+	bl *services.Blocks,
+	tc *conn.Controller,
+	bg *Background) (actor pub.Actor, err error) {
 
 	common := NewCommonBehavior(a, db, tc, o, pk)
 	ca, isC2S := a.(app.C2SApplication)
@@ -45,28 +52,65 @@ func NewActor(c *config.Config,
 	if !isC2S && !isS2S {
 		err = fmt.Errorf("the Application is neither a C2SApplication nor a S2SApplication")
 	} else if isC2S && isS2S {
-		c2s := NewSocialBehavior(ca, o)
-		s2s := NewFederatingBehavior(c, sa, db, po, pk, f, u, tc)
-		actor = pub.NewActor(
+		c2s := NewSocialBehavior(ca, db, o)
+		s2s := NewFederatingBehavior(c, sa, db, po, pk, f, fg, u, dm, bl, tc, bg)
+		fa := pub.NewActor(
 			common,
 			c2s,
 			s2s,
 			apdb,
 			clock)
+		s2s.setActor(fa)
+		actor = fa
 	} else if isC2S {
-		c2s := NewSocialBehavior(ca, o)
+		c2s := NewSocialBehavior(ca, db, o)
 		actor = pub.NewSocialActor(
 			common,
 			c2s,
 			apdb,
 			clock)
 	} else {
-		s2s := NewFederatingBehavior(c, sa, db, po, pk, f, u, tc)
-		actor = pub.NewFederatingActor(
-			common,
-			s2s,
-			apdb,
-			clock)
+		s2s := NewFederatingBehavior(c, sa, db, po, pk, f, fg, u, dm, bl, tc, bg)
+		// Without the social protocol, no side effects are applied to
+		// sent activities, so the liked collection and reports are
+		// maintained here.
+		fa := &federatingActor{
+			FederatingActor: pub.NewFederatingActor(
+				common,
+				s2s,
+				apdb,
+				clock),
+			db: db,
+		}
+		s2s.setActor(fa)
+		actor = fa
 	}
 	return
 }
+
+// federatingActor applies the side effects to the liked collection, the shares
+// and replies collections and the moderation queue of the activities it sends,
+// for applications that do not support the social protocol.
+type federatingActor struct {
+	pub.FederatingActor
+	db *Database
+}
+
+func (f *federatingActor) Send(c context.Context, outbox *url.URL, t vocab.Type) (pub.Activity, error) {
+	activity, err := f.FederatingActor.Send(c, outbox, t)
+	if err != nil {
+		return activity, err
+	}
+	if like, ok := activity.(vocab.ActivityStreamsLike); ok {
+		err = f.db.onLikeSent(c, like)
+	} else if create, ok := activity.(vocab.ActivityStreamsCreate); ok {
+		err = f.db.onCreate(c, create)
+	} else if announce, ok := activity.(vocab.ActivityStreamsAnnounce); ok {
+		err = f.db.onAnnounce(c, announce)
+	} else if undo, ok := activity.(vocab.ActivityStreamsUndo); ok {
+		err = f.db.onUndoSent(c, undo)
+	} else if flag, ok := activity.(vocab.ActivityStreamsFlag); ok {
+		err = f.db.onFlag(c, flag)
+	}
+	return activity, err
+}
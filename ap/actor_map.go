@@ -30,9 +30,11 @@ func NewActorMap(c *config.Config,
 	apdb *APDB,
 	pk *services.PrivateKeys,
 	f *services.Followers,
-	tc *conn.Controller) (actorMap map[paths.Actor]pub.Actor) {
+	tc *conn.Controller,
+	relays *services.Relays,
+	bg *Background) (actorMap map[paths.Actor]pub.Actor) {
 	actorMap = make(map[paths.Actor]pub.Actor, 1)
-	actorMap[paths.InstanceActor] = newInstanceActor(c, clock, db, apdb, pk, f, tc)
+	actorMap[paths.InstanceActor] = newInstanceActor(c, clock, db, apdb, pk, f, tc, relays, bg)
 	return
 }
 
@@ -42,9 +44,11 @@ func newInstanceActor(c *config.Config,
 	apdb *APDB,
 	pk *services.PrivateKeys,
 	f *services.Followers,
-	tc *conn.Controller) (actor pub.Actor) {
+	tc *conn.Controller,
+	relays *services.Relays,
+	bg *Background) (actor pub.Actor) {
 	common := newInstanceActorCommonBehavior(db, tc, pk)
-	s2s := newInstanceActorFederatingBehavior(c, db, pk, f, tc)
+	s2s := newInstanceActorFederatingBehavior(c, db, pk, f, tc, relays, bg)
 	actor = pub.NewFederatingActor(common, s2s, apdb, clock)
 	return
 }
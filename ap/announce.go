@@ -0,0 +1,179 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// shareser is an ActivityStreams type with a shares collection.
+type shareser interface {
+	GetActivityStreamsShares() vocab.ActivityStreamsSharesProperty
+	SetActivityStreamsShares(vocab.ActivityStreamsSharesProperty)
+}
+
+// onAnnounce adds an Announce to the shares collections of the local objects it
+// shares, in place of the default side effect of embedding the Announce in the
+// object itself.
+func (d *Database) onAnnounce(c context.Context, announce vocab.ActivityStreamsAnnounce) error {
+	objects := announce.GetActivityStreamsObject()
+	if objects == nil || objects.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	id, err := pub.GetId(announce)
+	if err != nil {
+		return err
+	}
+	ctx := util.Context{c}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		objId, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if local, err := d.isLocalObject(ctx, objId); err != nil {
+			return err
+		} else if !local {
+			continue
+		}
+		if err := d.shares.AddItem(ctx, objId, id); err != nil {
+			return err
+		}
+		if err := d.setShares(ctx, objId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onUndoReceived removes the Announces undone by a peer from the shares
+// collections of the local objects they shared.
+//
+// Only the stored copy of an undone Announce is trusted, rather than one
+// embedded in the Undo, and only when every actor of the Undo is an actor of
+// the Announce. Any other undone activities are ignored.
+func (d *Database) onUndoReceived(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	objects := undo.GetActivityStreamsObject()
+	if objects == nil {
+		return nil
+	}
+	ctx := util.Context{c}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			continue
+		}
+		t, err := d.storedActivity(ctx, id)
+		if err != nil {
+			return err
+		}
+		announce, ok := t.(vocab.ActivityStreamsAnnounce)
+		if !ok || !isUndoneByActors(undo, announce) {
+			continue
+		}
+		if err := d.unshare(ctx, announce); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unshare removes an Announce from the shares collections of the local objects
+// it shares.
+func (d *Database) unshare(c util.Context, announce vocab.ActivityStreamsAnnounce) error {
+	objects := announce.GetActivityStreamsObject()
+	if objects == nil {
+		return nil
+	}
+	id, err := pub.GetId(announce)
+	if err != nil {
+		return err
+	}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		objId, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if !d.data.Owns(objId) {
+			continue
+		}
+		if err := d.shares.RemoveItem(c, objId, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLocalObject determines whether the object is local data with shares and
+// replies collections maintained by this server. Actors are not.
+func (d *Database) isLocalObject(c util.Context, id *url.URL) (bool, error) {
+	if !d.data.Owns(id) || paths.IsUserPath(id) || paths.IsInstanceActorPath(id) {
+		return false, nil
+	}
+	return d.data.Exists(c, id)
+}
+
+// setShares sets the shares property of the local object to its shares
+// collection, if the object does not already have one.
+func (d *Database) setShares(c util.Context, id *url.URL) error {
+	t, err := d.data.Get(c, id)
+	if err != nil {
+		return err
+	}
+	s, ok := t.(shareser)
+	if !ok {
+		return nil
+	} else if p := s.GetActivityStreamsShares(); p != nil && (p.IsIRI() || p.IsActivityStreamsCollection()) {
+		return nil
+	}
+	p := streams.NewActivityStreamsSharesProperty()
+	p.SetIRI(paths.SharesIRIFor(id))
+	s.SetActivityStreamsShares(p)
+	return d.data.Update(c, t)
+}
+
+// isUndoneByActors determines whether the Undo has actors, and all of them
+// are actors of the activity it undoes.
+func isUndoneByActors(undo, activity actorer) bool {
+	ap := undo.GetActivityStreamsActor()
+	if ap == nil || ap.Len() == 0 {
+		return false
+	}
+	for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err != nil || !hasActor(activity, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAnnounceCallback determines whether the application already handles
+// Announce activities itself.
+func hasAnnounceCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsAnnounce) error); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// maxBackfillPages bounds the number of pages of a remote outbox fetched when
+// backfilling, in case they contain few public items.
+const maxBackfillPages = 5
+
+// onAccept backfills the recent public items of the actors that accepted a
+// Follow of the user's, once they have been added to the user's following
+// collection.
+//
+// Backfilling is queued in the Background, so that the peer is not kept
+// waiting and so that failing to backfill does not fail the Accept. It is
+// stopped with the server, and limited to the dereferences per activity.
+func (f *FederatingBehavior) onAccept(c context.Context, accept vocab.ActivityStreamsAccept) error {
+	if f.backfillCount <= 0 {
+		return nil
+	}
+	ctx := util.Context{c}
+	uuid, err := ctx.UserPathUUID()
+	if err != nil {
+		return err
+	}
+	actorIRI, err := ctx.ActorIRI()
+	if err != nil {
+		return err
+	}
+	actors := accept.GetActivityStreamsActor()
+	if actors == nil {
+		return nil
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if follows, err := f.fg.ContainsForActor(ctx, actorIRI, id); err != nil {
+			return err
+		} else if follows {
+			id := id
+			if !f.bg.Go(func(c util.Context) {
+				f.backfill(c, uuid, id)
+			}) {
+				util.InfoLogger.Infof("Not backfilling the outbox of %s, as too many fetches are queued", id)
+			}
+		}
+	}
+	return nil
+}
+
+// backfill caches the recent public items in the actor's outbox.
+func (f *FederatingBehavior) backfill(ctx util.Context, uuid paths.UUID, actor *url.URL) {
+	n, err := f.backfillOutbox(ctx, uuid, actor)
+	if err != nil {
+		util.ErrorLogger.Errorf("Error backfilling the outbox of %s after caching %d items: %s", actor, n, err)
+		return
+	}
+	util.InfoLogger.Infof("Backfilled %d items from the outbox of %s", n, actor)
+}
+
+// backfillOutbox fetches the first pages of the actor's outbox on behalf of
+// the user, caching up to backfillCount items that are addressed to the Public
+// collection. Items already cached are skipped, as are items that are only
+// linked to, since each would require another fetch, and items from any other
+// origin than the actor's.
+func (f *FederatingBehavior) backfillOutbox(ctx util.Context, uuid paths.UUID, actor *url.URL) (n int, err error) {
+	tp, err := fetchTransport(ctx, f.pk, f.tc, uuid, f.instanceActorFetches)
+	if err != nil {
+		return
+	}
+	fetch := func(iri *url.URL) (m map[string]interface{}, err error) {
+		var b []byte
+		if b, err = tp.Dereference(ctx, iri); err != nil {
+			return
+		}
+		err = json.Unmarshal(b, &m)
+		return
+	}
+	m, err := fetch(actor)
+	if err != nil {
+		return
+	}
+	outbox := jsonIRI(m["outbox"])
+	if outbox == nil {
+		err = fmt.Errorf("actor has no outbox")
+		return
+	}
+	if m, err = fetch(outbox); err != nil {
+		return
+	}
+	// The outbox either embeds or links to its first page, or lists its
+	// items itself.
+	page := m
+	if first, ok := m["first"].(map[string]interface{}); ok {
+		page = first
+	} else if first := jsonIRI(m["first"]); first != nil {
+		if page, err = fetch(first); err != nil {
+			return
+		}
+	}
+	jsonldContext := m["@context"]
+	for pages := 0; page != nil && pages < maxBackfillPages && n < f.backfillCount; pages++ {
+		items, ok := page["orderedItems"]
+		if !ok {
+			items = page["items"]
+		}
+		list, ok := items.([]interface{})
+		if !ok && items != nil {
+			list = []interface{}{items}
+		}
+		for _, item := range list {
+			if n >= f.backfillCount {
+				break
+			}
+			im, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// Embedded items rely on the page for their context.
+			if _, ok := im["@context"]; !ok {
+				im["@context"] = jsonldContext
+			}
+			t, err := streams.ToType(ctx, im)
+			if err != nil {
+				util.InfoLogger.Infof("Skipping backfill of unrecognized item in the outbox of %s: %s", actor, err)
+				continue
+			}
+			if id, err := pub.GetId(t); err != nil || id.Host != actor.Host {
+				continue
+			} else if !isPublicAddressed(t) {
+				continue
+			}
+			cached, err := f.db.CacheFederated(ctx, t)
+			if err != nil {
+				return n, err
+			} else if cached {
+				n++
+			}
+		}
+		next := jsonIRI(page["next"])
+		if next == nil {
+			break
+		}
+		if page, err = fetch(next); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// jsonIRI obtains the IRI of a JSON-LD value that is either an IRI or an
+// object with an id.
+func jsonIRI(v interface{}) *url.URL {
+	switch x := v.(type) {
+	case string:
+		if u, err := url.Parse(x); err == nil {
+			return u
+		}
+	case map[string]interface{}:
+		return jsonIRI(x["id"])
+	}
+	return nil
+}
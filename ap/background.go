@@ -0,0 +1,102 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/util"
+)
+
+// Defaults for the background fetches.
+const (
+	backgroundWorkers   = 4
+	backgroundQueueSize = 100
+)
+
+// Background makes remote fetches that the request triggering them does not
+// wait on, such as of the objects a relay announces or of the outboxes of newly
+// followed actors, with a bounded number of workers. Each fetch is limited to
+// the configured number of dereferences per activity. Stopping it cancels the
+// fetches in progress and drops those still queued.
+type Background struct {
+	// Immutable
+	maxDereferences int
+	q               chan func(c util.Context)
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	// Mutable
+	closed bool
+	mu     sync.RWMutex
+}
+
+func NewBackground(c *config.Config) *Background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Background{
+		maxDereferences: c.ActivityPubConfig.MaxDereferencesPerActivity,
+		q:               make(chan func(c util.Context), backgroundQueueSize),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+}
+
+func (b *Background) Start() {
+	for i := 0; i < backgroundWorkers; i++ {
+		b.wg.Add(1)
+		go b.work()
+	}
+}
+
+func (b *Background) Stop() {
+	b.mu.Lock()
+	b.closed = true
+	close(b.q)
+	b.mu.Unlock()
+	b.cancel()
+	b.wg.Wait()
+}
+
+// Go queues the fetch, reporting whether it was queued. It is not queued if the
+// queue is full or stopped.
+func (b *Background) Go(fn func(c util.Context)) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return false
+	}
+	select {
+	case b.q <- fn:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *Background) work() {
+	defer b.wg.Done()
+	for fn := range b.q {
+		if b.ctx.Err() != nil {
+			continue
+		}
+		ctx := util.Context{b.ctx}
+		ctx.WithDereferenceBudget(util.NewDereferenceBudget(b.maxDereferences))
+		fn(ctx)
+	}
+}
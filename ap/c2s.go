@@ -33,17 +33,22 @@ var _ pub.SocialProtocol = &SocialBehavior{}
 
 type SocialBehavior struct {
 	app app.C2SApplication
+	db  *Database
 	o   *oauth2.Server
 }
 
-func NewSocialBehavior(app app.C2SApplication, o *oauth2.Server) *SocialBehavior {
+func NewSocialBehavior(app app.C2SApplication, db *Database, o *oauth2.Server) *SocialBehavior {
 	return &SocialBehavior{
 		app: app,
+		db:  db,
 		o:   o,
 	}
 }
 
 func (s *SocialBehavior) PostOutboxRequestBodyHook(c context.Context, r *http.Request, data vocab.Type) (out context.Context, err error) {
+	if sd, ok := s.app.(app.SensitiveDefaulter); ok {
+		applyDefaultSensitive(data, sd.DefaultSensitive())
+	}
 	ctx := util.Context{c}
 	ctx.WithActivityStream(data)
 	out = ctx.Context
@@ -65,6 +70,59 @@ func (s *SocialBehavior) AuthenticatePostOutbox(c context.Context, w http.Respon
 func (s *SocialBehavior) SocialCallbacks(c context.Context) (wrapped pub.SocialWrappedCallbacks, other []interface{}, err error) {
 	wrapped = pub.SocialWrappedCallbacks{}
 	other = s.app.ApplySocialCallbacks(&wrapped)
+	appCreate := wrapped.Create
+	wrapped.Create = func(c context.Context, create vocab.ActivityStreamsCreate) error {
+		if err := s.db.onCreate(c, create); err != nil {
+			return err
+		} else if appCreate != nil {
+			return appCreate(c, create)
+		}
+		return nil
+	}
+	// Maintain the liked collection in place of the default Like side
+	// effect and the shares collections of Announced local objects, and
+	// undo them when the Like or Announce is undone.
+	if !hasLikeCallback(other) {
+		appLike := wrapped.Like
+		other = append(other, func(c context.Context, like vocab.ActivityStreamsLike) error {
+			if err := s.db.onLikeSent(c, like); err != nil {
+				return err
+			} else if appLike != nil {
+				return appLike(c, like)
+			}
+			return nil
+		})
+	}
+	if !hasAnnounceCallback(other) {
+		other = append(other, s.db.onAnnounce)
+	}
+	if !hasUndoCallback(other) {
+		appUndo := wrapped.Undo
+		other = append(other, func(c context.Context, undo vocab.ActivityStreamsUndo) error {
+			if err := s.db.onUndoSent(c, undo); err != nil {
+				return err
+			} else if appUndo != nil {
+				return appUndo(c, undo)
+			}
+			return nil
+		})
+	}
+	if !hasFlagCallback(other) {
+		other = append(other, s.db.onFlag)
+	}
+	// Merge Updates into the stored objects, removing values set to null,
+	// in place of the default Update side effect.
+	if !hasUpdateCallback(other) {
+		appUpdate := wrapped.Update
+		other = append(other, func(c context.Context, update vocab.ActivityStreamsUpdate) error {
+			if err := s.db.onUpdateSent(c, update); err != nil {
+				return err
+			} else if appUpdate != nil {
+				return appUpdate(c, update)
+			}
+			return nil
+		})
+	}
 	return
 }
 
@@ -18,7 +18,6 @@ package ap
 
 import (
 	"context"
-	"crypto/rsa"
 	"net/http"
 	"net/url"
 
@@ -59,11 +58,11 @@ func NewCommonBehavior(
 }
 
 func (a *CommonBehavior) AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (newCtx context.Context, authenticated bool, err error) {
-	return a.authenticateGetRequest(util.Context{c}, w, r)
+	return a.authenticateGetRequest(util.Context{c}, w, r, app.CapabilityPrivateGetInbox)
 }
 
 func (a *CommonBehavior) AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (newCtx context.Context, authenticated bool, err error) {
-	return a.authenticateGetRequest(util.Context{c}, w, r)
+	return a.authenticateGetRequest(util.Context{c}, w, r, app.CapabilityPrivateGetOutbox)
 }
 
 func (a *CommonBehavior) GetOutbox(c context.Context, r *http.Request) (ocp vocab.ActivityStreamsOrderedCollectionPage, err error) {
@@ -89,16 +88,17 @@ func (a *CommonBehavior) NewTransport(c context.Context, actorBoxIRI *url.URL, g
 	if err != nil {
 		return
 	}
-	var privKey *rsa.PrivateKey
-	var pubKeyURL *url.URL
-	privKey, pubKeyURL, err = a.pk.GetUserHTTPSignatureKey(util.Context{c}, userUUID)
+	var keys []services.HTTPSignatureKey
+	keys, err = a.pk.GetUserHTTPSignatureKeys(util.Context{c}, userUUID)
 	if err != nil {
 		return
 	}
-	return a.tc.Get(privKey, pubKeyURL.String())
+	return a.tc.Get(keys)
 }
 
-func (a *CommonBehavior) authenticateGetRequest(c util.Context, w http.ResponseWriter, r *http.Request) (newCtx context.Context, authenticated bool, err error) {
+// authenticateGetRequest permits public access to a collection, and private
+// access when the scope of the OAuth2 token permits the capability.
+func (a *CommonBehavior) authenticateGetRequest(c util.Context, w http.ResponseWriter, r *http.Request, capability app.Capability) (newCtx context.Context, authenticated bool, err error) {
 	newCtx = c
 	var t oa2.TokenInfo
 	var oAuthAuthenticated bool
@@ -115,7 +115,7 @@ func (a *CommonBehavior) authenticateGetRequest(c util.Context, w http.ResponseW
 	}
 	// Determine if private access permitted by the granted scope.
 	var ok bool
-	ok, err = a.app.ScopePermitsPrivateGetInbox(t.GetScope())
+	ok, err = app.ScopePermits(a.app, capability, t.GetScope())
 	if err != nil {
 		return
 	} else {
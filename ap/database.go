@@ -18,7 +18,11 @@ package ap
 
 import (
 	"context"
+	"fmt"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
@@ -31,19 +35,63 @@ import (
 
 var _ app.Database = &Database{}
 
+// ReadReplica is the set of services whose queries run against a single read
+// replica of the database.
+type ReadReplica struct {
+	Inboxes   *services.Inboxes
+	Outboxes  *services.Outboxes
+	Data      *services.Data
+	Followers *services.Followers
+	Following *services.Following
+	Liked     *services.Liked
+}
+
 type Database struct {
-	scheme                string
-	host                  string
-	inboxes               *services.Inboxes
-	outboxes              *services.Outboxes
-	users                 *services.Users
-	data                  *services.Data
-	followers             *services.Followers
-	following             *services.Following
-	liked                 *services.Liked
-	any                   *services.Any
-	defaultCollectionSize int
-	maxCollectionPageSize int
+	scheme          string
+	host            string
+	inboxes         *services.Inboxes
+	outboxes        *services.Outboxes
+	users           *services.Users
+	data            *services.Data
+	followers       *services.Followers
+	following       *services.Following
+	liked           *services.Liked
+	shares          *services.Shares
+	replies         *services.Replies
+	reports         *services.Reports
+	any             *services.Any
+	inboxPageSizes  services.PageSizes
+	outboxPageSizes services.PageSizes
+	verifyPublic    bool
+	primary         *ReadReplica
+	replicas        []*ReadReplica
+	replicaFallback bool
+	nextReplica     uint32
+
+	// Locks are shared by the pub.Database and the side effects of
+	// activities, which update the stored objects in turn.
+	//
+	// Use sync.Map, which is specially optimized:
+	//
+	// "The Map type is optimized [...] when the entry for a given key is
+	// only ever written once but read many times, as in caches that only
+	// grow"
+	//
+	// This means we only ever append to the map during the lifetime of the
+	// running application. This may become a scaling bottleneck in the
+	// future, but unsure how the performance will look in practice.
+	//
+	// This map will only store *sync.Mutex, each is 4 bytes. Assuming that
+	// conservatively the average key is a string of 124 bytes, this means
+	// each entry is 128 bytes of memory.
+	//
+	// If this map holds 2,000,000 entries then it would take 256 MB of
+	// memory. To take up 1 GB, 7,812,500 entries are needed. If one entry
+	// is added per second, then in 90 days it will take up 1 GB of memory.
+	//
+	// TODO: Address this unbounded growth for memory-constrained or very
+	// long running applications.
+	locks *sync.Map
 }
 
 func NewDatabase(scheme string,
@@ -55,47 +103,122 @@ func NewDatabase(scheme string,
 	followers *services.Followers,
 	following *services.Following,
 	liked *services.Liked,
-	any *services.Any) *Database {
+	shares *services.Shares,
+	replies *services.Replies,
+	reports *services.Reports,
+	any *services.Any,
+	replicas []*ReadReplica) *Database {
+	inboxDefault, inboxMax := c.DatabaseConfig.InboxPageSizes()
+	outboxDefault, outboxMax := c.DatabaseConfig.OutboxPageSizes()
 	return &Database{
-		scheme:                scheme,
-		host:                  c.ServerConfig.Host,
-		inboxes:               inboxes,
-		outboxes:              outboxes,
-		users:                 users,
-		data:                  data,
-		followers:             followers,
-		following:             following,
-		liked:                 liked,
-		any:                   any,
-		defaultCollectionSize: c.DatabaseConfig.DefaultCollectionPageSize,
-		maxCollectionPageSize: c.DatabaseConfig.MaxCollectionPageSize,
+		scheme:          scheme,
+		host:            c.ServerConfig.Host,
+		inboxes:         inboxes,
+		outboxes:        outboxes,
+		users:           users,
+		data:            data,
+		followers:       followers,
+		following:       following,
+		liked:           liked,
+		shares:          shares,
+		replies:         replies,
+		reports:         reports,
+		any:             any,
+		inboxPageSizes:  services.PageSizes{Default: inboxDefault, Max: inboxMax},
+		outboxPageSizes: services.PageSizes{Default: outboxDefault, Max: outboxMax},
+		verifyPublic:    c.ActivityPubConfig.VerifyPublicAddressing,
+		primary: &ReadReplica{
+			Inboxes:   inboxes,
+			Outboxes:  outboxes,
+			Data:      data,
+			Followers: followers,
+			Following: following,
+			Liked:     liked,
+		},
+		replicas:        replicas,
+		replicaFallback: c.DatabaseConfig.ReadReplicaFallback,
+		locks:           &sync.Map{},
+	}
+}
+
+func (d *Database) Lock(c context.Context, id *url.URL) error {
+	mui, _ := d.locks.LoadOrStore(id.String(), &sync.Mutex{})
+	if mu, ok := mui.(*sync.Mutex); !ok {
+		return fmt.Errorf("lock for Lock is not a *sync.Mutex")
+	} else {
+		mu.Lock()
+		return nil
+	}
+}
+
+func (d *Database) Unlock(c context.Context, id *url.URL) error {
+	mui, _ := d.locks.Load(id.String())
+	if mu, ok := mui.(*sync.Mutex); !ok {
+		return fmt.Errorf("lock for Unlock is not a *sync.Mutex")
+	} else {
+		mu.Unlock()
+		return nil
 	}
 }
 
+// read runs the read-only fn against the next read replica in turn, falling
+// back to the primary database if the replica fails and fallback is enabled.
+// Without any read replicas, fn runs against the primary database.
+//
+// Only reads of requests permitting replica reads use a replica. All others,
+// such as go-fed checking Exists, Get and Followers while applying the side
+// effects of an activity, use the primary database, as a lagging replica
+// could have them act on stale data.
+func (d *Database) read(c context.Context, fn func(r *ReadReplica) error) error {
+	ctx := util.Context{c}
+	if len(d.replicas) == 0 || !ctx.IsReplicaRead() {
+		return fn(d.primary)
+	}
+	n := atomic.AddUint32(&d.nextReplica, 1)
+	err := fn(d.replicas[n%uint32(len(d.replicas))])
+	if err != nil && d.replicaFallback && c.Err() == nil {
+		util.ErrorLogger.Errorf("Read replica query failed, retrying on the primary database: %s", err)
+		err = fn(d.primary)
+	}
+	return err
+}
+
 func (d *Database) InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error) {
 	return d.inboxes.Contains(util.Context{c}, inbox, id)
 }
 
 func (d *Database) GetInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
-	any := d.inboxes.GetPage
-	last := d.inboxes.GetLastPage
-	return services.DoOrderedCollectionPagination(util.Context{c},
-		inboxIRI,
-		d.defaultCollectionSize,
-		d.maxCollectionPageSize,
-		any,
-		last)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		any := r.Inboxes.GetPage
+		last := r.Inboxes.GetLastPage
+		inbox, err = services.DoOrderedCollectionPagination(util.Context{c},
+			inboxIRI,
+			d.inboxPageSizes.Default,
+			d.inboxPageSizes.Max,
+			any,
+			last)
+		return
+	})
+	return
 }
 
 func (d *Database) GetPublicInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
-	any := d.inboxes.GetPublicPage
-	last := d.inboxes.GetPublicLastPage
-	return services.DoOrderedCollectionPagination(util.Context{c},
-		inboxIRI,
-		d.defaultCollectionSize,
-		d.maxCollectionPageSize,
-		any,
-		last)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		any := r.Inboxes.GetPublicPage
+		last := r.Inboxes.GetPublicLastPage
+		inbox, err = services.DoOrderedCollectionPagination(util.Context{c},
+			inboxIRI,
+			d.inboxPageSizes.Default,
+			d.inboxPageSizes.Max,
+			any,
+			last)
+		if err != nil || !d.verifyPublic {
+			return
+		}
+		err = d.excludeNonPublic(util.Context{c}, r.Data, inbox)
+		return
+	})
+	return
 }
 
 // NOTE: This only prepends the FIRST item in the orderedItems property.
@@ -133,11 +256,28 @@ func (d *Database) OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxI
 }
 
 func (d *Database) Exists(c context.Context, id *url.URL) (exists bool, err error) {
-	return d.data.Exists(util.Context{c}, id)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		exists, err = r.Data.Exists(util.Context{c}, id)
+		return
+	})
+	return
 }
 
 func (d *Database) Get(c context.Context, id *url.URL) (value vocab.Type, err error) {
-	return d.data.Get(util.Context{c}, id)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		value, err = r.Data.Get(util.Context{c}, id)
+		return
+	})
+	return
+}
+
+// Created obtains when local data was created.
+func (d *Database) Created(c context.Context, id *url.URL) (created time.Time, err error) {
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		created, err = r.Data.Created(util.Context{c}, id)
+		return
+	})
+	return
 }
 
 func (d *Database) Create(c context.Context, asType vocab.Type) (err error) {
@@ -152,26 +292,50 @@ func (d *Database) Delete(c context.Context, id *url.URL) (err error) {
 	return d.data.Delete(util.Context{c}, id)
 }
 
+// CacheFederated stores federated data unless it is already stored, reporting
+// whether it was stored.
+func (d *Database) CacheFederated(c context.Context, v vocab.Type) (cached bool, err error) {
+	return d.data.CacheFederated(util.Context{c}, v)
+}
+
+// TombstoneFederated replaces the cached copy of federated data with a
+// Tombstone, if it is cached.
+func (d *Database) TombstoneFederated(c context.Context, id *url.URL) (tombstoned bool, err error) {
+	return d.data.TombstoneFederated(util.Context{c}, id)
+}
+
 func (d *Database) GetOutbox(c context.Context, outboxIRI *url.URL) (outbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
-	any := d.outboxes.GetPage
-	last := d.outboxes.GetLastPage
-	return services.DoOrderedCollectionPagination(util.Context{c},
-		outboxIRI,
-		d.defaultCollectionSize,
-		d.maxCollectionPageSize,
-		any,
-		last)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		any := r.Outboxes.GetPage
+		last := r.Outboxes.GetLastPage
+		outbox, err = services.DoOrderedCollectionPagination(util.Context{c},
+			outboxIRI,
+			d.outboxPageSizes.Default,
+			d.outboxPageSizes.Max,
+			any,
+			last)
+		return
+	})
+	return
 }
 
 func (d *Database) GetPublicOutbox(c context.Context, outboxIRI *url.URL) (outbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
-	any := d.outboxes.GetPublicPage
-	last := d.outboxes.GetPublicLastPage
-	return services.DoOrderedCollectionPagination(util.Context{c},
-		outboxIRI,
-		d.defaultCollectionSize,
-		d.maxCollectionPageSize,
-		any,
-		last)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		any := r.Outboxes.GetPublicPage
+		last := r.Outboxes.GetPublicLastPage
+		outbox, err = services.DoOrderedCollectionPagination(util.Context{c},
+			outboxIRI,
+			d.outboxPageSizes.Default,
+			d.outboxPageSizes.Max,
+			any,
+			last)
+		if err != nil || !d.verifyPublic {
+			return
+		}
+		err = d.excludeNonPublic(util.Context{c}, r.Data, outbox)
+		return
+	})
+	return
 }
 
 // NOTE: This only prepends the FIRST item in the orderedItems property.
@@ -192,17 +356,72 @@ func (d *Database) SetOutbox(c context.Context, outbox vocab.ActivityStreamsOrde
 }
 
 func (d *Database) Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
-	return d.followers.GetAllForActor(util.Context{c}, actorIRI)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		followers, err = r.Followers.GetAllForActor(util.Context{c}, actorIRI)
+		return
+	})
+	return
 }
 
 func (d *Database) Following(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
-	return d.following.GetAllForActor(util.Context{c}, actorIRI)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		followers, err = r.Following.GetAllForActor(util.Context{c}, actorIRI)
+		return
+	})
+	return
 }
 
 func (d *Database) Liked(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
-	return d.liked.GetAllForActor(util.Context{c}, actorIRI)
+	err = d.read(c, func(r *ReadReplica) (err error) {
+		followers, err = r.Liked.GetAllForActor(util.Context{c}, actorIRI)
+		return
+	})
+	return
 }
 
 func (d *Database) Begin() app.TxBuilder {
 	return d.any.Begin()
 }
+
+// excludeNonPublic removes any item in the page that is not addressed to the
+// Public collection, logging each one that is removed.
+//
+// The public inbox and outbox queries already filter on addressing, so this is
+// a defensive second check against private content being served publicly.
+func (d *Database) excludeNonPublic(c util.Context, data *services.Data, page vocab.ActivityStreamsOrderedCollectionPage) error {
+	oi := page.GetActivityStreamsOrderedItems()
+	if oi == nil {
+		return nil
+	}
+	for i := 0; i < oi.Len(); {
+		id, err := pub.ToId(oi.At(i))
+		if err != nil {
+			return err
+		}
+		v, err := data.Get(c, id)
+		if err != nil {
+			util.ErrorLogger.Errorf("Excluding unverifiable item from public collection page: %s: %s", id, err)
+			oi.Remove(i)
+			continue
+		}
+		if isPublicAddressed(v) {
+			i++
+			continue
+		}
+		util.ErrorLogger.Errorf("Excluding non-public item from public collection page: %s", id)
+		oi.Remove(i)
+	}
+	return nil
+}
+
+type toAndCcer interface {
+	GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+	GetActivityStreamsCc() vocab.ActivityStreamsCcProperty
+}
+
+// isPublicAddressed determines whether the value is addressed to the Public
+// collection. A value whose addressing cannot be read is not.
+func isPublicAddressed(v vocab.Type) bool {
+	public, err := services.IsPublic(v)
+	return err == nil && public
+}
@@ -0,0 +1,92 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/util"
+)
+
+// onDelete replaces the cached copies of the objects of a Delete with
+// Tombstones, rather than removing them.
+//
+// Objects are only tombstoned when every actor of the Delete has the same
+// origin as the object, so that a peer cannot delete another peer's content.
+// Other objects, and those that are not cached, are ignored.
+func (f *FederatingBehavior) onDelete(c context.Context, del vocab.ActivityStreamsDelete) error {
+	objects := del.GetActivityStreamsObject()
+	if objects == nil || objects.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	var actors []*url.URL
+	if ap := del.GetActivityStreamsActor(); ap != nil {
+		for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			actors = append(actors, id)
+		}
+	}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if !sameOrigin(id, actors) {
+			util.InfoLogger.Infof("Ignoring Delete of %s: not all actors share its origin", id)
+			continue
+		} else if owns, err := f.db.Owns(c, id); err != nil {
+			return err
+		} else if owns {
+			continue
+		}
+		if _, err := f.db.TombstoneFederated(c, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameOrigin determines whether there is at least one actor and every actor
+// has the same scheme and host as the object.
+func sameOrigin(object *url.URL, actors []*url.URL) bool {
+	if len(actors) == 0 {
+		return false
+	}
+	for _, a := range actors {
+		if a.Scheme != object.Scheme || a.Host != object.Host {
+			return false
+		}
+	}
+	return true
+}
+
+// hasDeleteCallback determines whether the application already handles
+// Delete activities itself.
+func hasDeleteCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsDelete) error); ok {
+			return true
+		}
+	}
+	return false
+}
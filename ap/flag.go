@@ -0,0 +1,80 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/util"
+)
+
+// onFlag queues a report of the objects of a Flag, whether received from a peer
+// or sent by a local user, for administrators to moderate.
+//
+// The objects are only recorded by their IRIs, so a Flag is reported even when
+// its objects are unknown to this server. The reporter is the Flag's actor, or
+// the server it came from if it has none.
+func (d *Database) onFlag(c context.Context, flag vocab.ActivityStreamsFlag) error {
+	id, err := pub.GetId(flag)
+	if err != nil {
+		return err
+	}
+	ops := flag.GetActivityStreamsObject()
+	if ops == nil || ops.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	objects := make([]*url.URL, 0, ops.Len())
+	for iter := ops.Begin(); iter != ops.End(); iter = iter.Next() {
+		o, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, o)
+	}
+	reporter := &url.URL{Scheme: id.Scheme, Host: id.Host}
+	if actors := flag.GetActivityStreamsActor(); actors != nil && actors.Len() > 0 {
+		if reporter, err = pub.ToId(actors.At(0)); err != nil {
+			return err
+		}
+	}
+	var comment string
+	if content := flag.GetActivityStreamsContent(); content != nil {
+		for iter := content.Begin(); iter != content.End(); iter = iter.Next() {
+			if iter.IsXMLSchemaString() {
+				comment = iter.GetXMLSchemaString()
+				break
+			}
+		}
+	}
+	if err := d.reports.Create(util.Context{c}, id, reporter, objects, comment); err != nil {
+		return fmt.Errorf("failed to queue report of Flag %s: %s", id, err)
+	}
+	return nil
+}
+
+func hasFlagCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsFlag) error); ok {
+			return true
+		}
+	}
+	return false
+}
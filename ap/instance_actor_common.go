@@ -18,7 +18,6 @@ package ap
 
 import (
 	"context"
-	"crypto/rsa"
 	"net/http"
 	"net/url"
 
@@ -73,11 +72,10 @@ func (a *instanceActorCommonBehavior) GetOutbox(c context.Context, r *http.Reque
 }
 
 func (a *instanceActorCommonBehavior) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t pub.Transport, err error) {
-	var privKey *rsa.PrivateKey
-	var pubKeyURL *url.URL
-	privKey, pubKeyURL, err = a.pk.GetUserHTTPSignatureKeyForInstanceActor(util.Context{c})
+	var keys []services.HTTPSignatureKey
+	keys, err = a.pk.GetUserHTTPSignatureKeysForInstanceActor(util.Context{c})
 	if err != nil {
 		return
 	}
-	return a.tc.Get(privKey, pubKeyURL.String())
+	return a.tc.Get(keys)
 }
@@ -38,13 +38,17 @@ type instanceActorFederatingBehavior struct {
 	pk                      *services.PrivateKeys
 	f                       *services.Followers
 	tc                      *conn.Controller
+	relays                  *services.Relays
+	bg                      *Background
 }
 
 func newInstanceActorFederatingBehavior(c *config.Config,
 	db *Database,
 	pk *services.PrivateKeys,
 	f *services.Followers,
-	tc *conn.Controller) *instanceActorFederatingBehavior {
+	tc *conn.Controller,
+	relays *services.Relays,
+	bg *Background) *instanceActorFederatingBehavior {
 	return &instanceActorFederatingBehavior{
 		maxInboxForwardingDepth: c.ActivityPubConfig.MaxInboxForwardingRecursionDepth,
 		maxDeliveryDepth:        c.ActivityPubConfig.MaxDeliveryRecursionDepth,
@@ -52,6 +56,8 @@ func newInstanceActorFederatingBehavior(c *config.Config,
 		pk:                      pk,
 		f:                       f,
 		tc:                      tc,
+		relays:                  relays,
+		bg:                      bg,
 	}
 }
 
@@ -63,8 +69,12 @@ func (f *instanceActorFederatingBehavior) PostInboxRequestBodyHook(c context.Con
 }
 
 func (f *instanceActorFederatingBehavior) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
-	authenticated, err = verifyHttpSignatures(c, r, f.db, f.pk, f.tc)
 	out = c
+	if ctx := (util.Context{c}); ctx.IsSignatureVerified() {
+		authenticated = true
+		return
+	}
+	authenticated, err = verifyHttpSignatures(c, r, f.db, f.pk, f.tc, true)
 	return
 }
 
@@ -73,9 +83,17 @@ func (f *instanceActorFederatingBehavior) Blocked(c context.Context, actorIRIs [
 }
 
 func (f *instanceActorFederatingBehavior) FederatingCallbacks(c context.Context) (wrapped pub.FederatingWrappedCallbacks, other []interface{}, err error) {
+	// The instance actor is what subscribes to relays. Their Accepts and
+	// Announces are handled after go-fed's own side effects, such as
+	// adding the relay to the instance actor's following collection.
 	wrapped = pub.FederatingWrappedCallbacks{
 		OnFollow: pub.OnFollowDoNothing,
+		Accept:   f.onRelayAccept,
+		Announce: f.onRelayAnnounce,
 	}
+	// Peers report content to the server itself through the instance
+	// actor.
+	other = []interface{}{f.db.onFlag}
 	return
 }
 
@@ -97,37 +115,7 @@ func (f *instanceActorFederatingBehavior) MaxDeliveryRecursionDepth(c context.Co
 }
 
 func (f *instanceActorFederatingBehavior) FilterForwarding(c context.Context, potentialRecipients []*url.URL, a pub.Activity) (filteredRecipients []*url.URL, err error) {
-	ctx := util.Context{c}
-	var actorIRI *url.URL
-	actorIRI, err = ctx.ActorIRI()
-	if err != nil {
-		return
-	}
-	// Here we limit to only allow forwarding to the target user's
-	// followers.
-	var fc vocab.ActivityStreamsCollection
-	fc, err = f.f.GetAllForActor(ctx, actorIRI)
-	if err != nil {
-		return
-	}
-	allowedRecipients := make(map[*url.URL]bool, 0)
-	items := fc.GetActivityStreamsItems()
-	if items != nil {
-		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
-			var id *url.URL
-			id, err = pub.ToId(iter)
-			if err != nil {
-				return
-			}
-			allowedRecipients[id] = true
-		}
-	}
-	for _, elem := range potentialRecipients {
-		if has, ok := allowedRecipients[elem]; ok && has {
-			filteredRecipients = append(filteredRecipients, elem)
-		}
-	}
-	return
+	return filterForwardingToFollowers(c, potentialRecipients)
 }
 
 func (f *instanceActorFederatingBehavior) GetInbox(c context.Context, r *http.Request) (ocp vocab.ActivityStreamsOrderedCollectionPage, err error) {
@@ -0,0 +1,220 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// onLikeSent adds the objects of a Like sent by a local user to the user's
+// liked collection.
+func (d *Database) onLikeSent(c context.Context, like vocab.ActivityStreamsLike) error {
+	objects := like.GetActivityStreamsObject()
+	if objects == nil || objects.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	ctx := util.Context{c}
+	_, likedIRI, err := d.userIRIs(ctx)
+	if err != nil {
+		return err
+	}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if err := d.liked.AddItem(ctx, likedIRI, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onUndoSent removes the objects of the Likes undone by a local user from the
+// user's liked collection, the objects of the Follows undone by the user from
+// the user's following collection, and the Announces undone by the user from
+// the shares collections of the local objects they shared.
+//
+// Only Likes, Follows, and Announces that are stored and were sent by the user
+// are undone. An Undo of a Like, Follow, or Announce that does not exist is an
+// error, while any other undone activities are ignored.
+func (d *Database) onUndoSent(c context.Context, undo vocab.ActivityStreamsUndo) error {
+	objects := undo.GetActivityStreamsObject()
+	if objects == nil || objects.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	ctx := util.Context{c}
+	actorIRI, likedIRI, err := d.userIRIs(ctx)
+	if err != nil {
+		return err
+	}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		if t := iter.GetType(); t != nil && !streams.IsOrExtendsActivityStreamsLike(t) && !streams.IsOrExtendsActivityStreamsFollow(t) && !streams.IsOrExtendsActivityStreamsAnnounce(t) {
+			continue
+		}
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		t, err := d.storedActivity(ctx, id)
+		if err != nil {
+			return err
+		}
+		like, isLike := t.(vocab.ActivityStreamsLike)
+		follow, isFollow := t.(vocab.ActivityStreamsFollow)
+		announce, isAnnounce := t.(vocab.ActivityStreamsAnnounce)
+		if !isLike && !isFollow && !isAnnounce {
+			if iter.IsActivityStreamsLike() {
+				return fmt.Errorf("cannot Undo Like %s: it does not exist", id)
+			} else if iter.IsActivityStreamsFollow() {
+				return fmt.Errorf("cannot Undo Follow %s: it does not exist", id)
+			} else if iter.IsActivityStreamsAnnounce() {
+				return fmt.Errorf("cannot Undo Announce %s: it does not exist", id)
+			}
+			continue
+		}
+		if !hasActor(t.(actorer), actorIRI) {
+			return fmt.Errorf("cannot Undo %s %s: it was not sent by %s", t.GetTypeName(), id, actorIRI)
+		}
+		if isAnnounce {
+			if err := d.unshare(ctx, announce); err != nil {
+				return err
+			}
+			continue
+		} else if isFollow {
+			if err := d.unfollow(ctx, actorIRI, follow); err != nil {
+				return err
+			}
+			continue
+		}
+		if lo := like.GetActivityStreamsObject(); lo != nil {
+			for lIter := lo.Begin(); lIter != lo.End(); lIter = lIter.Next() {
+				objId, err := pub.ToId(lIter)
+				if err != nil {
+					return err
+				}
+				if err := d.liked.RemoveItem(ctx, likedIRI, objId); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unfollow removes the objects of the Follow sent by the actor from the
+// actor's following collection. Objects that were never added, such as when
+// the Follow is still pending, are left alone.
+func (d *Database) unfollow(c util.Context, actorIRI *url.URL, follow vocab.ActivityStreamsFollow) error {
+	fo := follow.GetActivityStreamsObject()
+	if fo == nil {
+		return nil
+	}
+	uuid, err := c.UserPathUUID()
+	if err != nil {
+		return err
+	}
+	followingIRI := paths.UUIDIRIFor(d.scheme, d.host, paths.FollowingPathKey, uuid)
+	for iter := fo.Begin(); iter != fo.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if has, err := d.following.ContainsForActor(c, actorIRI, id); err != nil {
+			return err
+		} else if !has {
+			continue
+		}
+		if err := d.following.DeleteItem(c, followingIRI, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userIRIs are the IRIs of the user in the context and of the user's liked
+// collection.
+func (d *Database) userIRIs(c util.Context) (actorIRI, likedIRI *url.URL, err error) {
+	var uuid paths.UUID
+	uuid, err = c.UserPathUUID()
+	if err != nil {
+		return
+	}
+	actorIRI = paths.UUIDIRIFor(d.scheme, d.host, paths.UserPathKey, uuid)
+	likedIRI = paths.UUIDIRIFor(d.scheme, d.host, paths.LikedPathKey, uuid)
+	return
+}
+
+// storedActivity fetches the data with the id, which is nil if nothing is
+// stored with that id.
+func (d *Database) storedActivity(c util.Context, id *url.URL) (vocab.Type, error) {
+	if exists, err := d.data.Exists(c, id); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, nil
+	}
+	return d.data.Get(c, id)
+}
+
+// actorer is an activity with actors.
+type actorer interface {
+	GetActivityStreamsActor() vocab.ActivityStreamsActorProperty
+}
+
+// hasActor determines whether the actor is one of the actors of the activity.
+func hasActor(activity actorer, actor *url.URL) bool {
+	ap := activity.GetActivityStreamsActor()
+	if ap == nil {
+		return false
+	}
+	for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil && id.String() == actor.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLikeCallback determines whether the application already handles Like
+// activities itself.
+func hasLikeCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsLike) error); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUndoCallback determines whether the application already handles Undo
+// activities itself.
+func hasUndoCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsUndo) error); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// alsoKnownAsProperty is the Mastodon-originated property an actor uses to
+// list the other accounts it also is, which a Move's target must use to
+// acknowledge its origin.
+const alsoKnownAsProperty = "alsoKnownAs"
+
+// onMove follows the target of a Move on behalf of a user that follows the
+// moving actor, if the user has opted into doing so.
+//
+// The Move is ignored unless its actor is moving itself, and unless the
+// target lists the origin in its alsoKnownAs property, so that a Move cannot
+// be spoofed to make followers follow an arbitrary actor.
+func (f *FederatingBehavior) onMove(c context.Context, move vocab.ActivityStreamsMove) error {
+	ctx := util.Context{c}
+	uuid, err := ctx.UserPathUUID()
+	if err != nil {
+		return err
+	}
+	prefs, err := f.u.Preferences(ctx, uuid, nil)
+	if err != nil {
+		return err
+	} else if !prefs.FollowMovedActors {
+		return nil
+	}
+	origin, target, err := moveOriginAndTarget(move)
+	if err != nil {
+		return err
+	}
+	actorIRI, err := ctx.ActorIRI()
+	if err != nil {
+		return err
+	}
+	if follows, err := f.fg.ContainsForActor(ctx, actorIRI, origin); err != nil {
+		return err
+	} else if !follows {
+		return nil
+	}
+	if follows, err := f.fg.ContainsForActor(ctx, actorIRI, target); err != nil {
+		return err
+	} else if follows {
+		return nil
+	}
+	if aka, err := f.alsoKnownAs(ctx, uuid, target); err != nil {
+		return err
+	} else if !aka[origin.String()] {
+		util.InfoLogger.Infof("Ignoring Move of %s to %s: target is not also known as the origin", origin, target)
+		return nil
+	}
+	if f.actor == nil {
+		return fmt.Errorf("cannot follow Move target: no actor to send with")
+	}
+	outboxIRI := paths.UUIDIRIFor(actorIRI.Scheme, actorIRI.Host, paths.OutboxPathKey, uuid)
+	_, err = f.actor.Send(c, outboxIRI, newFollow(actorIRI, target))
+	return err
+}
+
+// moveOriginAndTarget returns the actor that moved and where it moved to,
+// requiring the Move's actor to be its object.
+func moveOriginAndTarget(move vocab.ActivityStreamsMove) (origin, target *url.URL, err error) {
+	actors := move.GetActivityStreamsActor()
+	if actors == nil || actors.Len() != 1 {
+		err = fmt.Errorf("Move must have exactly one actor")
+		return
+	}
+	if origin, err = pub.ToId(actors.At(0)); err != nil {
+		return
+	}
+	objects := move.GetActivityStreamsObject()
+	if objects == nil || objects.Len() != 1 {
+		err = fmt.Errorf("Move must have exactly one object")
+		return
+	}
+	var object *url.URL
+	if object, err = pub.ToId(objects.At(0)); err != nil {
+		return
+	} else if object.String() != origin.String() {
+		err = fmt.Errorf("Move object %s is not its actor %s", object, origin)
+		return
+	}
+	targets := move.GetActivityStreamsTarget()
+	if targets == nil || targets.Len() != 1 {
+		err = fmt.Errorf("Move must have exactly one target")
+		return
+	}
+	target, err = pub.ToId(targets.At(0))
+	return
+}
+
+// alsoKnownAs dereferences the actor on behalf of the user, and returns the
+// set of IRIs in its alsoKnownAs property.
+func (f *FederatingBehavior) alsoKnownAs(ctx util.Context, uuid paths.UUID, actor *url.URL) (map[string]bool, error) {
+	tp, err := fetchTransport(ctx, f.pk, f.tc, uuid, f.instanceActorFetches)
+	if err != nil {
+		return nil, err
+	}
+	b, err := tp.Dereference(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	aka := make(map[string]bool)
+	addID := func(v interface{}) {
+		switch x := v.(type) {
+		case string:
+			aka[x] = true
+		case map[string]interface{}:
+			if id, ok := x["id"].(string); ok {
+				aka[id] = true
+			}
+		}
+	}
+	if arr, ok := m[alsoKnownAsProperty].([]interface{}); ok {
+		for _, v := range arr {
+			addID(v)
+		}
+	} else {
+		addID(m[alsoKnownAsProperty])
+	}
+	return aka, nil
+}
+
+// newFollow builds a Follow of the object by the actor.
+func newFollow(actor, object *url.URL) vocab.ActivityStreamsFollow {
+	follow := streams.NewActivityStreamsFollow()
+	ap := streams.NewActivityStreamsActorProperty()
+	ap.AppendIRI(actor)
+	follow.SetActivityStreamsActor(ap)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(object)
+	follow.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(object)
+	follow.SetActivityStreamsTo(to)
+	return follow
+}
+
+// hasMoveCallback determines whether the application already handles Move
+// activities itself.
+func hasMoveCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsMove) error); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// onReject removes the rejecting actors from the user's following collection
+// when they Reject a Follow the user sent, including one they had previously
+// accepted.
+func (f *FederatingBehavior) onReject(c context.Context, reject vocab.ActivityStreamsReject) error {
+	ctx := util.Context{c}
+	uuid, err := ctx.UserPathUUID()
+	if err != nil {
+		return err
+	}
+	actorIRI, err := ctx.ActorIRI()
+	if err != nil {
+		return err
+	}
+	rejecting := make(map[string]bool)
+	if actors := reject.GetActivityStreamsActor(); actors != nil {
+		for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			rejecting[id.String()] = true
+		}
+	}
+	objects := reject.GetActivityStreamsObject()
+	if objects == nil {
+		return nil
+	}
+	followingIRI := paths.UUIDIRIFor(actorIRI.Scheme, actorIRI.Host, paths.FollowingPathKey, uuid)
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		var follow vocab.ActivityStreamsFollow
+		if iter.IsActivityStreamsFollow() {
+			follow = iter.GetActivityStreamsFollow()
+		} else if iter.IsIRI() {
+			t, err := f.db.Get(c, iter.GetIRI())
+			if err != nil {
+				util.InfoLogger.Infof("Ignoring Reject of unknown object %s: %s", iter.GetIRI(), err)
+				continue
+			}
+			var ok bool
+			if follow, ok = t.(vocab.ActivityStreamsFollow); !ok {
+				continue
+			}
+		} else {
+			continue
+		}
+		if sent, err := followHasActor(follow, actorIRI); err != nil {
+			return err
+		} else if !sent {
+			continue
+		}
+		fo := follow.GetActivityStreamsObject()
+		if fo == nil {
+			continue
+		}
+		for fi := fo.Begin(); fi != fo.End(); fi = fi.Next() {
+			id, err := pub.ToId(fi)
+			if err != nil {
+				return err
+			} else if !rejecting[id.String()] {
+				continue
+			}
+			if err := f.fg.DeleteItem(ctx, followingIRI, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// followHasActor determines whether the actor is one of the Follow's actors.
+func followHasActor(follow vocab.ActivityStreamsFollow, actor *url.URL) (bool, error) {
+	actors := follow.GetActivityStreamsActor()
+	if actors == nil {
+		return false, nil
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return false, err
+		} else if id.String() == actor.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
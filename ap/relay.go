@@ -0,0 +1,142 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// onRelayAccept marks the subscriptions to relays as accepted when a relay's
+// actor accepts the instance actor's Follow.
+//
+// Relays following the LitePub protocol accept the Follow with either the
+// Follow itself or its id as the object, so only its id is relied upon.
+func (f *instanceActorFederatingBehavior) onRelayAccept(c context.Context, accept vocab.ActivityStreamsAccept) error {
+	actors := accept.GetActivityStreamsActor()
+	ops := accept.GetActivityStreamsObject()
+	if actors == nil || actors.Len() == 0 || ops == nil {
+		return nil
+	}
+	actor, err := pub.ToId(actors.At(0))
+	if err != nil {
+		return err
+	}
+	ctx := util.Context{c}
+	for iter := ops.Begin(); iter != ops.End(); iter = iter.Next() {
+		followID, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if ok, err := f.relays.Accept(ctx, followID, actor); err != nil {
+			return err
+		} else if ok {
+			util.InfoLogger.Infof("Relay %s accepted the subscription %s", actor, followID)
+		}
+	}
+	return nil
+}
+
+// onRelayAnnounce adds the public objects a subscribed relay announces to the
+// federated timeline. Announces from any other actor are ignored.
+//
+// Objects are always fetched from their origin, as relays usually announce them
+// by id only and embedded copies cannot be trusted. Fetching happens in the
+// background, so that the relay is not kept waiting, and is dropped when too
+// many fetches are already queued.
+func (f *instanceActorFederatingBehavior) onRelayAnnounce(c context.Context, announce vocab.ActivityStreamsAnnounce) error {
+	actors := announce.GetActivityStreamsActor()
+	ops := announce.GetActivityStreamsObject()
+	if actors == nil || actors.Len() == 0 || ops == nil {
+		return nil
+	}
+	actor, err := pub.ToId(actors.At(0))
+	if err != nil {
+		return err
+	}
+	ctx := util.Context{c}
+	if subscribed, err := f.relays.IsSubscribed(ctx, actor); err != nil {
+		return err
+	} else if !subscribed {
+		util.InfoLogger.Infof("Ignoring Announce from %s, which is not a subscribed relay", actor)
+		return nil
+	}
+	var ids []*url.URL
+	for iter := ops.Begin(); iter != ops.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 && !f.bg.Go(func(c util.Context) {
+		f.fetchRelayed(c, actor, ids)
+	}) {
+		util.InfoLogger.Infof("Dropping %d objects announced by relay %s, as too many fetches are queued", len(ids), actor)
+	}
+	return nil
+}
+
+// fetchRelayed fetches the objects announced by the relay, caching each that is
+// addressed to the Public collection.
+func (f *instanceActorFederatingBehavior) fetchRelayed(ctx util.Context, relay *url.URL, ids []*url.URL) {
+	tp, err := fetchTransport(ctx, f.pk, f.tc, paths.UUID(""), true)
+	if err != nil {
+		util.ErrorLogger.Errorf("Error fetching objects announced by relay %s: %s", relay, err)
+		return
+	}
+	for _, id := range ids {
+		// Observe shutdown.
+		if ctx.Err() != nil {
+			return
+		}
+		if exists, err := f.db.Exists(ctx.Context, id); err != nil {
+			util.ErrorLogger.Errorf("Error fetching %s announced by relay %s: %s", id, relay, err)
+			continue
+		} else if exists {
+			continue
+		}
+		b, err := tp.Dereference(ctx, id)
+		if err != nil {
+			util.ErrorLogger.Errorf("Error fetching %s announced by relay %s: %s", id, relay, err)
+			continue
+		}
+		var m map[string]interface{}
+		if err = json.Unmarshal(b, &m); err != nil {
+			util.ErrorLogger.Errorf("Error fetching %s announced by relay %s: %s", id, relay, err)
+			continue
+		}
+		t, err := streams.ToType(ctx, m)
+		if err != nil {
+			util.InfoLogger.Infof("Skipping unrecognized object %s announced by relay %s: %s", id, relay, err)
+			continue
+		}
+		if fetched, err := pub.GetId(t); err != nil || fetched.Host != id.Host || !isPublicAddressed(t) {
+			continue
+		}
+		if _, err := f.db.CacheFederated(ctx, t); err != nil {
+			util.ErrorLogger.Errorf("Error caching %s announced by relay %s: %s", id, relay, err)
+		}
+	}
+}
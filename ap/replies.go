@@ -0,0 +1,116 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// inReplyToer is an ActivityStreams type that may be in reply to others.
+type inReplyToer interface {
+	GetActivityStreamsInReplyTo() vocab.ActivityStreamsInReplyToProperty
+}
+
+// replieser is an ActivityStreams type with a replies collection.
+type replieser interface {
+	GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+	SetActivityStreamsReplies(vocab.ActivityStreamsRepliesProperty)
+}
+
+// onCreate adds the objects of a Create to the replies collections of the local
+// objects they are in reply to.
+func (d *Database) onCreate(c context.Context, create vocab.ActivityStreamsCreate) error {
+	objects := create.GetActivityStreamsObject()
+	if objects == nil {
+		return nil
+	}
+	ctx := util.Context{c}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		t := iter.GetType()
+		if t == nil && iter.IsIRI() {
+			var err error
+			if t, err = d.storedActivity(ctx, iter.GetIRI()); err != nil {
+				return err
+			}
+		}
+		if t == nil {
+			continue
+		}
+		if err := d.addReply(ctx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addReply adds the reply to the replies collections of the local objects it is
+// in reply to.
+func (d *Database) addReply(c util.Context, reply vocab.Type) error {
+	r, ok := reply.(inReplyToer)
+	if !ok || r.GetActivityStreamsInReplyTo() == nil {
+		return nil
+	}
+	id, err := pub.GetId(reply)
+	if err != nil {
+		return err
+	}
+	irt := r.GetActivityStreamsInReplyTo()
+	for iter := irt.Begin(); iter != irt.End(); iter = iter.Next() {
+		objId, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		if local, err := d.isLocalObject(c, objId); err != nil {
+			return err
+		} else if !local {
+			continue
+		}
+		if err := d.replies.AddItem(c, objId, id); err != nil {
+			return err
+		}
+		if err := d.setReplies(c, objId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setReplies sets the replies property of the local object to its replies
+// collection, if the object does not already have one.
+func (d *Database) setReplies(c util.Context, id *url.URL) error {
+	t, err := d.data.Get(c, id)
+	if err != nil {
+		return err
+	}
+	r, ok := t.(replieser)
+	if !ok {
+		return nil
+	} else if p := r.GetActivityStreamsReplies(); p != nil && (p.IsIRI() || p.IsActivityStreamsCollection()) {
+		return nil
+	}
+	p := streams.NewActivityStreamsRepliesProperty()
+	p.SetIRI(paths.RepliesIRIFor(id))
+	r.SetActivityStreamsReplies(p)
+	return d.data.Update(c, t)
+}
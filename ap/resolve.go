@@ -0,0 +1,108 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/framework/conn"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+// ResolveActor finds the actor of a remote account by its handle, such as
+// "user@host", "@user@host", or "acct:user@host". The actor's IRI is found
+// with WebFinger on the account's host, unless recently cached, and the actor
+// is then read from the federated data, or fetched on behalf of the instance
+// actor and cached as federated data if it is not there. Refreshing ignores
+// any cached WebFinger result and always fetches the actor.
+func ResolveActor(c context.Context,
+	db *APDB,
+	pk *services.PrivateKeys,
+	tc *conn.Controller,
+	handle string,
+	refresh bool) (actor vocab.Type, err error) {
+	user, host, err := splitHandle(handle)
+	if err != nil {
+		return
+	}
+	actorIRI, err := tc.WebfingerActor(c, user, host, refresh)
+	if err != nil {
+		return
+	}
+	// Concurrent resolutions of the actor wait for the first to cache it.
+	if err = db.Lock(c, actorIRI); err != nil {
+		return
+	}
+	defer db.Unlock(c, actorIRI)
+	var exists bool
+	if exists, err = db.Exists(c, actorIRI); err != nil {
+		return
+	} else if exists && !refresh {
+		actor, err = db.Get(c, actorIRI)
+		return
+	}
+	ctx := util.Context{c}
+	tp, err := fetchTransport(ctx, pk, tc, "", true)
+	if err != nil {
+		return
+	}
+	b, err := tp.Dereference(c, actorIRI)
+	if err != nil {
+		return
+	}
+	m := make(map[string]interface{}, 0)
+	if err = json.Unmarshal(b, &m); err != nil {
+		return
+	}
+	if actor, err = streams.ToType(c, m); err != nil {
+		return
+	}
+	var id *url.URL
+	if id, err = pub.GetId(actor); err != nil {
+		return
+	} else if id.String() != actorIRI.String() {
+		err = fmt.Errorf("actor fetched from %s has a different id: %s", actorIRI, id)
+		return
+	}
+	if exists {
+		err = db.Update(c, actor)
+	} else {
+		err = db.Create(c, actor)
+	}
+	return
+}
+
+// splitHandle obtains the user and host of an account handle.
+func splitHandle(handle string) (user, host string, err error) {
+	h := strings.TrimPrefix(strings.TrimSpace(handle), "acct:")
+	h = strings.TrimPrefix(h, "@")
+	i := strings.LastIndex(h, "@")
+	if i <= 0 || i == len(h)-1 {
+		err = fmt.Errorf("invalid account handle: %q", handle)
+		return
+	}
+	user, host = h[:i], h[i+1:]
+	return
+}
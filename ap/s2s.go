@@ -36,13 +36,21 @@ var _ pub.FederatingProtocol = &FederatingBehavior{}
 type FederatingBehavior struct {
 	maxInboxForwardingDepth int
 	maxDeliveryDepth        int
+	maxDereferences         int
 	app                     app.S2SApplication
 	db                      *Database
 	po                      *services.Policies
 	pk                      *services.PrivateKeys
 	f                       *services.Followers
+	fg                      *services.Following
 	u                       *services.Users
+	dm                      *services.Domains
+	bl                      *services.Blocks
 	tc                      *conn.Controller
+	bg                      *Background
+	actor                   pub.FederatingActor
+	instanceActorFetches    bool
+	backfillCount           int
 }
 
 func NewFederatingBehavior(c *config.Config,
@@ -51,36 +59,76 @@ func NewFederatingBehavior(c *config.Config,
 	po *services.Policies,
 	pk *services.PrivateKeys,
 	f *services.Followers,
+	fg *services.Following,
 	u *services.Users,
-	tc *conn.Controller) *FederatingBehavior {
+	dm *services.Domains,
+	bl *services.Blocks,
+	tc *conn.Controller,
+	bg *Background) *FederatingBehavior {
 	return &FederatingBehavior{
 		maxInboxForwardingDepth: c.ActivityPubConfig.MaxInboxForwardingRecursionDepth,
 		maxDeliveryDepth:        c.ActivityPubConfig.MaxDeliveryRecursionDepth,
+		maxDereferences:         c.ActivityPubConfig.MaxDereferencesPerActivity,
+		instanceActorFetches:    c.ActivityPubConfig.SignFetchesWithInstanceActor,
+		backfillCount:           c.ActivityPubConfig.BackfillCount,
 		app:                     a,
 		db:                      db,
 		po:                      po,
 		pk:                      pk,
 		f:                       f,
+		fg:                      fg,
 		u:                       u,
+		dm:                      dm,
+		bl:                      bl,
 		tc:                      tc,
+		bg:                      bg,
 	}
 }
 
+// setActor provides the actor built with this behavior, so that it can send
+// activities in response to ones it receives.
+func (f *FederatingBehavior) setActor(actor pub.FederatingActor) {
+	f.actor = actor
+}
+
 func (f *FederatingBehavior) PostInboxRequestBodyHook(c context.Context, r *http.Request, activity pub.Activity) (out context.Context, err error) {
 	ctx := &util.Context{c}
 	ctx.WithActivity(activity)
+	ctx.WithDereferenceBudget(util.NewDereferenceBudget(f.maxDereferences))
 	out = ctx.Context
 	return
 }
 
 func (f *FederatingBehavior) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
-	authenticated, err = verifyHttpSignatures(c, r, f.db, f.pk, f.tc)
 	out = c
+	// Deliveries had their signature verified when they were received,
+	// including those to the shared inbox before being dispatched to this
+	// user.
+	if ctx := (util.Context{c}); ctx.IsSignatureVerified() {
+		authenticated = true
+		return
+	}
+	authenticated, err = verifyHttpSignatures(c, r, f.db, f.pk, f.tc, f.instanceActorFetches)
 	return
 }
 
 func (f *FederatingBehavior) Blocked(c context.Context, actorIRIs []*url.URL) (blocked bool, err error) {
 	ctx := util.Context{c}
+	for _, iri := range actorIRIs {
+		if blocked, err = f.dm.IsBlocked(ctx, iri.Hostname()); err != nil || blocked {
+			return
+		}
+	}
+	var uuid paths.UUID
+	if uuid, err = ctx.UserPathUUID(); err != nil {
+		return
+	}
+	userIRI := paths.UUIDIRIFor(f.db.scheme, f.db.host, paths.UserPathKey, uuid)
+	for _, iri := range actorIRIs {
+		if blocked, err = f.bl.IsBlocked(ctx, userIRI, iri); err != nil || blocked {
+			return
+		}
+	}
 	var activity pub.Activity
 	if activity, err = ctx.Activity(); err != nil {
 		return
@@ -105,13 +153,144 @@ func (f *FederatingBehavior) FederatingCallbacks(c context.Context) (wrapped pub
 	if err != nil {
 		return
 	}
+	onFollow := prefs.OnFollow
+	if onFollow == pub.OnFollowDoNothing {
+		var accept bool
+		accept, err = f.autoAcceptFollow(ctx, prefs)
+		if err != nil {
+			return
+		} else if accept {
+			onFollow = pub.OnFollowAutomaticallyAccept
+		}
+	}
 	wrapped = pub.FederatingWrappedCallbacks{
-		OnFollow: prefs.OnFollow,
+		OnFollow: onFollow,
 	}
 	other = f.app.ApplyFederatingCallbacks(&wrapped)
+	// Maintain the following collection in place of the default Accept
+	// side effect, which rewrites the entire collection.
+	if !hasAcceptCallback(other) {
+		appAccept := wrapped.Accept
+		other = append(other, func(c context.Context, accept vocab.ActivityStreamsAccept) error {
+			if err := f.onAcceptFollow(c, accept); err != nil {
+				return err
+			} else if err := f.onAccept(c, accept); err != nil {
+				return err
+			} else if appAccept != nil {
+				return appAccept(c, accept)
+			}
+			return nil
+		})
+	}
+	appReject := wrapped.Reject
+	wrapped.Reject = func(c context.Context, reject vocab.ActivityStreamsReject) error {
+		if err := f.onReject(c, reject); err != nil {
+			return err
+		} else if appReject != nil {
+			return appReject(c, reject)
+		}
+		return nil
+	}
+	appCreate := wrapped.Create
+	wrapped.Create = func(c context.Context, create vocab.ActivityStreamsCreate) error {
+		if err := f.db.onCreate(c, create); err != nil {
+			return err
+		} else if appCreate != nil {
+			return appCreate(c, create)
+		}
+		return nil
+	}
+	appUndo := wrapped.Undo
+	wrapped.Undo = func(c context.Context, undo vocab.ActivityStreamsUndo) error {
+		if err := f.db.onUndoReceived(c, undo); err != nil {
+			return err
+		} else if err := f.onUndoAccept(c, undo); err != nil {
+			return err
+		} else if appUndo != nil {
+			return appUndo(c, undo)
+		}
+		return nil
+	}
+	// Maintain the shares collections in place of the default Announce
+	// side effect.
+	if !hasAnnounceCallback(other) {
+		appAnnounce := wrapped.Announce
+		other = append(other, func(c context.Context, announce vocab.ActivityStreamsAnnounce) error {
+			if err := f.db.onAnnounce(c, announce); err != nil {
+				return err
+			} else if appAnnounce != nil {
+				return appAnnounce(c, announce)
+			}
+			return nil
+		})
+	}
+	if !hasDeleteCallback(other) {
+		appDelete := wrapped.Delete
+		other = append(other, func(c context.Context, del vocab.ActivityStreamsDelete) error {
+			if err := f.onDelete(c, del); err != nil {
+				return err
+			} else if appDelete != nil {
+				return appDelete(c, del)
+			}
+			return nil
+		})
+	}
+	if !hasUpdateCallback(other) {
+		appUpdate := wrapped.Update
+		other = append(other, func(c context.Context, update vocab.ActivityStreamsUpdate) error {
+			if err := f.onUpdate(c, update); err != nil {
+				return err
+			} else if appUpdate != nil {
+				return appUpdate(c, update)
+			}
+			return nil
+		})
+	}
+	if !hasMoveCallback(other) {
+		other = append(other, f.onMove)
+	}
+	if !hasFlagCallback(other) {
+		other = append(other, f.db.onFlag)
+	}
 	return
 }
 
+// autoAcceptFollow determines whether a Follow received by a user that manually
+// approves followers should be accepted anyway. This is the case when the user
+// already follows every actor of the Follow and has opted into accepting
+// mutuals, or when one of the user's auto-accept policies matches the Follow.
+func (f *FederatingBehavior) autoAcceptFollow(ctx util.Context, prefs *services.Preferences) (bool, error) {
+	activity, err := ctx.Activity()
+	if err != nil {
+		return false, err
+	}
+	follow, ok := activity.(vocab.ActivityStreamsFollow)
+	if !ok {
+		return false, nil
+	}
+	actorIRI, err := ctx.ActorIRI()
+	if err != nil {
+		return false, err
+	}
+	if actors := follow.GetActivityStreamsActor(); prefs.AutoAcceptMutualFollows && actors != nil && actors.Len() > 0 {
+		mutual := true
+		for iter := actors.Begin(); iter != actors.End() && mutual; iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return false, err
+			}
+			mutual, err = f.fg.ContainsForActor(ctx, actorIRI, id)
+			if err != nil {
+				return false, err
+			}
+		}
+		if mutual {
+			return true, nil
+		}
+	}
+	return f.po.IsAutoAcceptedFollow(ctx, actorIRI, activity)
+}
+
 func (f *FederatingBehavior) DefaultCallback(c context.Context, activity pub.Activity) error {
 	activityIRI, err := pub.GetId(activity)
 	if err != nil {
@@ -130,37 +309,7 @@ func (f *FederatingBehavior) MaxDeliveryRecursionDepth(c context.Context) int {
 }
 
 func (f *FederatingBehavior) FilterForwarding(c context.Context, potentialRecipients []*url.URL, a pub.Activity) (filteredRecipients []*url.URL, err error) {
-	ctx := util.Context{c}
-	var actorIRI *url.URL
-	actorIRI, err = ctx.ActorIRI()
-	if err != nil {
-		return
-	}
-	// Here we limit to only allow forwarding to the target user's
-	// followers.
-	var fc vocab.ActivityStreamsCollection
-	fc, err = f.f.GetAllForActor(ctx, actorIRI)
-	if err != nil {
-		return
-	}
-	allowedRecipients := make(map[*url.URL]bool, 0)
-	items := fc.GetActivityStreamsItems()
-	if items != nil {
-		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
-			var id *url.URL
-			id, err = pub.ToId(iter)
-			if err != nil {
-				return
-			}
-			allowedRecipients[id] = true
-		}
-	}
-	for _, elem := range potentialRecipients {
-		if has, ok := allowedRecipients[elem]; ok && has {
-			filteredRecipients = append(filteredRecipients, elem)
-		}
-	}
-	return
+	return filterForwardingToFollowers(c, potentialRecipients)
 }
 
 func (f *FederatingBehavior) GetInbox(c context.Context, r *http.Request) (ocp vocab.ActivityStreamsOrderedCollectionPage, err error) {
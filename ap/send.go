@@ -0,0 +1,151 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/framework/conn"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+// SendToRecipients delivers an activity on behalf of the user to exactly the
+// given inboxes, instead of to the inboxes its addressing resolves to. Each
+// delivery is recorded as an attempt, so failed deliveries are retried.
+//
+// When sideEffects is set, the activity is also stored, if not already, and
+// added to the user's outbox, which requires it to already have an id.
+// Otherwise nothing local is changed.
+func SendToRecipients(c context.Context,
+	db *APDB,
+	pk *services.PrivateKeys,
+	tc *conn.Controller,
+	userID paths.UUID,
+	activity vocab.Type,
+	recipients []*url.URL,
+	sideEffects bool) error {
+	ctx := util.Context{c}
+	ctx.WithUserPathUUID(userID)
+	if sideEffects {
+		outboxIRI := paths.UUIDIRIFor(db.scheme, db.host, paths.OutboxPathKey, userID)
+		if err := db.Lock(ctx.Context, outboxIRI); err != nil {
+			return err
+		}
+		err := db.addToOutbox(ctx, outboxIRI, activity)
+		if uErr := db.Unlock(ctx.Context, outboxIRI); err == nil {
+			err = uErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	keys, err := pk.GetUserHTTPSignatureKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	tp, err := tc.Get(keys)
+	if err != nil {
+		return err
+	}
+	return deliverToRecipients(ctx, tc, tp, activity, recipients)
+}
+
+// SendFromInstanceActor delivers an activity on behalf of the instance actor to
+// exactly the given inboxes. The activity is assigned an id if it has none and
+// is stored, so that peers are able to dereference it.
+func SendFromInstanceActor(c context.Context,
+	db *APDB,
+	pk *services.PrivateKeys,
+	tc *conn.Controller,
+	activity vocab.Type,
+	recipients []*url.URL) error {
+	ctx := util.Context{c}
+	id, err := pub.GetId(activity)
+	if err != nil {
+		if id, err = db.NewID(ctx.Context, activity); err != nil {
+			return err
+		}
+		idp := streams.NewJSONLDIdProperty()
+		idp.Set(id)
+		activity.SetJSONLDId(idp)
+	}
+	if exists, err := db.data.Exists(ctx, id); err != nil {
+		return err
+	} else if !exists {
+		if err := db.data.Create(ctx, activity); err != nil {
+			return err
+		}
+	}
+	keys, err := pk.GetUserHTTPSignatureKeysForInstanceActor(ctx)
+	if err != nil {
+		return err
+	}
+	tp, err := tc.Get(keys)
+	if err != nil {
+		return err
+	}
+	return deliverToRecipients(ctx, tc, tp, activity, recipients)
+}
+
+// deliverToRecipients delivers the activity with the transport to each of the
+// inboxes.
+func deliverToRecipients(ctx util.Context, tc *conn.Controller, tp pub.Transport, activity vocab.Type, recipients []*url.URL) error {
+	b, err := models.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	// Deliver to each inbox directly, as BatchDeliver would let the
+	// application resolve different recipients.
+	recipients = tc.DedupeInboxes(recipients)
+	var failed int
+	for _, to := range recipients {
+		if err := tp.Deliver(ctx.Context, b, to); err != nil {
+			util.ErrorLogger.Errorf("Failed to deliver to %s: %s", to, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to deliver to %d of %d recipients", failed, len(recipients))
+	}
+	return nil
+}
+
+// addToOutbox stores the activity, unless it is already stored, and prepends it
+// to the outbox.
+func (d *Database) addToOutbox(c util.Context, outboxIRI *url.URL, activity vocab.Type) error {
+	id, err := pub.GetId(activity)
+	if err != nil {
+		return fmt.Errorf("cannot add an activity without an id to the outbox: %s", err)
+	}
+	exists, err := d.data.Exists(c, id)
+	if err != nil {
+		return err
+	} else if !exists {
+		if err := d.data.Create(c, activity); err != nil {
+			return err
+		}
+	}
+	return d.outboxes.PrependItem(c, outboxIRI, id)
+}
@@ -0,0 +1,54 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// sensitiveProperty is the Mastodon extension property marking the content and
+// attachments of an object as sensitive.
+const sensitiveProperty = "sensitive"
+
+// applyDefaultSensitive sets the 'sensitive' property on the Notes posted by a
+// client that did not set it, whether the Note is posted by itself or as the
+// object of a Create.
+func applyDefaultSensitive(data vocab.Type, sensitive bool) {
+	switch v := data.(type) {
+	case vocab.ActivityStreamsNote:
+		setDefaultSensitive(v, sensitive)
+	case vocab.ActivityStreamsCreate:
+		op := v.GetActivityStreamsObject()
+		if op == nil {
+			return
+		}
+		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+			if note := iter.GetActivityStreamsNote(); note != nil {
+				setDefaultSensitive(note, sensitive)
+			}
+		}
+	}
+}
+
+// setDefaultSensitive sets the 'sensitive' property of the Note, unless it is
+// already set.
+func setDefaultSensitive(note vocab.ActivityStreamsNote, sensitive bool) {
+	unknown := note.GetUnknownProperties()
+	if _, ok := unknown[sensitiveProperty]; !ok {
+		unknown[sensitiveProperty] = sensitive
+	}
+}
@@ -0,0 +1,133 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// SharedInboxRecipients determines the local users to whom an activity
+// delivered to the shared inbox is dispatched.
+//
+// These are the local users addressed in its 'to' or 'cc' properties. When the
+// activity is also addressed to the Public collection or to its actor's
+// followers, the local users following its actor are recipients as well.
+func (d *Database) SharedInboxRecipients(c context.Context, activity vocab.Type) (uuids []paths.UUID, err error) {
+	seen := make(map[paths.UUID]bool)
+	add := func(iri *url.URL) {
+		if iri.Host != d.host || !paths.IsUserPath(iri) {
+			return
+		}
+		uuid, err := paths.UUIDFromUserPath(iri.Path)
+		if err != nil || seen[uuid] {
+			return
+		}
+		seen[uuid] = true
+		uuids = append(uuids, uuid)
+	}
+	actors := activityActors(activity)
+	toFollowers := false
+	for _, iri := range addressees(activity) {
+		toFollowers = toFollowers ||
+			pub.IsPublic(iri.String()) ||
+			isFollowersOfAny(iri, actors)
+		add(iri)
+	}
+	if !toFollowers {
+		return
+	}
+	for _, actor := range actors {
+		var following []*url.URL
+		err = d.read(c, func(r *ReadReplica) (err error) {
+			following, err = r.Following.ActorsFollowing(util.Context{c}, actor)
+			return
+		})
+		if err != nil {
+			return
+		}
+		for _, iri := range following {
+			add(iri)
+		}
+	}
+	return
+}
+
+// addressees returns the IRIs in the 'to' and 'cc' properties of the
+// activity.
+func addressees(v vocab.Type) (iris []*url.URL) {
+	t, ok := v.(toAndCcer)
+	if !ok {
+		return
+	}
+	if to := t.GetActivityStreamsTo(); to != nil {
+		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				iris = append(iris, id)
+			}
+		}
+	}
+	if cc := t.GetActivityStreamsCc(); cc != nil {
+		for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+			if id, err := pub.ToId(iter); err == nil {
+				iris = append(iris, id)
+			}
+		}
+	}
+	return
+}
+
+// activityActors returns the IRIs in the 'actor' property of the activity.
+func activityActors(v vocab.Type) (iris []*url.URL) {
+	a, ok := v.(pub.Activity)
+	if !ok {
+		return
+	}
+	ap := a.GetActivityStreamsActor()
+	if ap == nil {
+		return
+	}
+	for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			iris = append(iris, id)
+		}
+	}
+	return
+}
+
+// isFollowersOfAny determines whether the IRI looks like the followers
+// collection of one of the actors: a 'followers' path on the actor's host.
+//
+// Peers' followers collections are not dereferenced, so this follows the
+// convention used by most software.
+func isFollowersOfAny(iri *url.URL, actors []*url.URL) bool {
+	if !strings.HasSuffix(iri.Path, "/followers") {
+		return false
+	}
+	for _, actor := range actors {
+		if actor.Host == iri.Host {
+			return true
+		}
+	}
+	return false
+}
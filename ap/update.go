@@ -0,0 +1,268 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ap
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+// onUpdate refreshes the cached copies of the objects of an Update, such as
+// the profile of a remote actor.
+//
+// Objects are only refreshed when every actor of the Update has the same
+// origin as the object, and an actor is only refreshed by an Update of its
+// own, so that a peer cannot rewrite another actor's document. Objects that
+// are not cached, not wholly provided, or owned by this server are ignored.
+func (f *FederatingBehavior) onUpdate(c context.Context, update vocab.ActivityStreamsUpdate) error {
+	objects := update.GetActivityStreamsObject()
+	if objects == nil || objects.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	var actors []*url.URL
+	if ap := update.GetActivityStreamsActor(); ap != nil {
+		for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			actors = append(actors, id)
+		}
+	}
+	for iter := objects.Begin(); iter != objects.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		t := iter.GetType()
+		if t == nil {
+			util.InfoLogger.Infof("Ignoring Update of %s: object not wholly provided", id)
+			continue
+		} else if !sameOrigin(id, actors) {
+			util.InfoLogger.Infof("Ignoring Update of %s: not all actors share its origin", id)
+			continue
+		} else if services.IsActorType(t.GetTypeName()) && !isOnlyActor(id, actors) {
+			util.InfoLogger.Infof("Ignoring Update of actor %s: not made by that actor", id)
+			continue
+		} else if owns, err := f.db.Owns(c, id); err != nil {
+			return err
+		} else if owns {
+			continue
+		}
+		if err := f.db.Lock(c, id); err != nil {
+			return err
+		}
+		err = f.updateCached(c, id, t)
+		if uErr := f.db.Unlock(c, id); err == nil {
+			err = uErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateCached replaces the cached copy of the object, which must be locked,
+// if there is one.
+func (f *FederatingBehavior) updateCached(c context.Context, id *url.URL, t vocab.Type) error {
+	if exists, err := f.db.Exists(c, id); err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+	return f.db.Update(c, t)
+}
+
+// immutableProperties are the properties of an object that an Update sent by a
+// local user cannot change, as they establish what the object is and who owns
+// it.
+var immutableProperties = []string{"id", "type", "attributedTo", "publicKey"}
+
+// onUpdateSent applies an Update sent by a local user as a partial update of
+// its objects, which must be owned by this server.
+//
+// The top-level values of each object provided in the Update replace those of
+// the stored object, and the values the client set to null are removed. Values
+// not provided are left as they are. The merged object replaces the one in the
+// Update, so that peers receive the whole object.
+//
+// Each actor of the Update must be the object itself or one it is attributed
+// to, and the immutableProperties of the object cannot change.
+func (d *Database) onUpdateSent(c context.Context, update vocab.ActivityStreamsUpdate) error {
+	objects := update.GetActivityStreamsObject()
+	if objects == nil || objects.Len() == 0 {
+		return pub.ErrObjectRequired
+	}
+	var actors []*url.URL
+	if ap := update.GetActivityStreamsActor(); ap != nil {
+		for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			actors = append(actors, id)
+		}
+	}
+	if len(actors) == 0 {
+		return fmt.Errorf("actor property required on the Update")
+	}
+	raw := rawUpdateObjects(util.Context{c}, objects.Len())
+	for idx, iter := 0, objects.Begin(); iter != objects.End(); idx, iter = idx+1, iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return err
+		}
+		t := iter.GetType()
+		if t == nil {
+			return fmt.Errorf("object at index %d is not a literal type value", idx)
+		} else if owns, err := d.Owns(c, id); err != nil {
+			return err
+		} else if !owns {
+			return fmt.Errorf("cannot update %s: not owned by this server", id)
+		}
+		if err := d.Lock(c, id); err != nil {
+			return err
+		}
+		merged, err := d.mergeUpdate(c, id, actors, t, raw[idx])
+		if uErr := d.Unlock(c, id); err == nil {
+			err = uErr
+		}
+		if err != nil {
+			return err
+		}
+		if err := iter.SetType(merged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeUpdate applies the partial update to the stored object, which must be
+// locked, returning the merged object.
+func (d *Database) mergeUpdate(c context.Context, id *url.URL, actors []*url.URL, t vocab.Type, raw map[string]interface{}) (vocab.Type, error) {
+	stored, err := d.Get(c, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, actor := range actors {
+		if actor.String() != id.String() && !isAttributedTo(stored, actor) {
+			return nil, fmt.Errorf("cannot update %s: %s is neither it nor its author", id, actor)
+		}
+	}
+	m, err := stored.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	newM, err := t.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range immutableProperties {
+		if v, ok := newM[k]; ok && !reflect.DeepEqual(v, m[k]) {
+			return nil, fmt.Errorf("cannot update %s: %s cannot be changed", id, k)
+		} else if v, ok := raw[k]; ok && v == nil {
+			return nil, fmt.Errorf("cannot update %s: %s cannot be removed", id, k)
+		}
+	}
+	for k, v := range newM {
+		m[k] = v
+	}
+	for k, v := range raw {
+		if v == nil {
+			delete(m, k)
+		}
+	}
+	merged, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Update(c, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// rawUpdateObjects obtains the JSON of the n objects of the posted Update, which
+// deserialization does not keep null values of. An object is nil if its JSON is
+// not available.
+func rawUpdateObjects(c util.Context, n int) []map[string]interface{} {
+	objs := make([]map[string]interface{}, n)
+	raw, err := c.RawActivity()
+	if err != nil {
+		return objs
+	}
+	switch v := raw["object"].(type) {
+	case map[string]interface{}:
+		if n == 1 {
+			objs[0] = v
+		}
+	case []interface{}:
+		for i := 0; i < len(v) && i < n; i++ {
+			objs[i], _ = v[i].(map[string]interface{})
+		}
+	}
+	return objs
+}
+
+// attributedToer is an object with authors.
+type attributedToer interface {
+	GetActivityStreamsAttributedTo() vocab.ActivityStreamsAttributedToProperty
+}
+
+// isAttributedTo determines whether the actor is one of the authors of the
+// object.
+func isAttributedTo(t vocab.Type, actor *url.URL) bool {
+	a, ok := t.(attributedToer)
+	if !ok {
+		return false
+	}
+	atp := a.GetActivityStreamsAttributedTo()
+	if atp == nil {
+		return false
+	}
+	for iter := atp.Begin(); iter != atp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil && id.String() == actor.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// isOnlyActor determines whether the actor is the one and only actor.
+func isOnlyActor(actor *url.URL, actors []*url.URL) bool {
+	return len(actors) == 1 && actors[0].String() == actor.String()
+}
+
+// hasUpdateCallback determines whether the application already handles
+// Update activities itself.
+func hasUpdateCallback(others []interface{}) bool {
+	for _, o := range others {
+		if _, ok := o.(func(context.Context, vocab.ActivityStreamsUpdate) error); ok {
+			return true
+		}
+	}
+	return false
+}
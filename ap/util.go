@@ -19,7 +19,6 @@ package ap
 import (
 	"context"
 	"crypto"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -41,7 +40,9 @@ type publicKeyer interface {
 	GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
 }
 
-func getPublicKeyFromResponse(c context.Context, b []byte, keyId *url.URL) (p crypto.PublicKey, err error) {
+// getPublicKeyFromResponse finds the public key in the response, returning it
+// along with the actor it claims to be owned by and the id of the response.
+func getPublicKeyFromResponse(c context.Context, b []byte, keyId *url.URL) (p crypto.PublicKey, owner, id *url.URL, err error) {
 	m := make(map[string]interface{}, 0)
 	err = json.Unmarshal(b, &m)
 	if err != nil {
@@ -52,6 +53,9 @@ func getPublicKeyFromResponse(c context.Context, b []byte, keyId *url.URL) (p cr
 	if err != nil {
 		return
 	}
+	if id, err = pub.GetId(t); err != nil {
+		return
+	}
 	pker, ok := t.(publicKeyer)
 	if !ok {
 		err = fmt.Errorf("ActivityStreams type cannot be converted to one known to have publicKey property: %T", t)
@@ -83,6 +87,11 @@ func getPublicKeyFromResponse(c context.Context, b []byte, keyId *url.URL) (p cr
 		err = fmt.Errorf("cannot find publicKey with id: %s", keyId)
 		return
 	}
+	if op := pkpFound.GetW3IDSecurityV1Owner(); op != nil && op.IsIRI() {
+		owner = op.GetIRI()
+	} else {
+		owner = id
+	}
 	pkPemProp := pkpFound.GetW3IDSecurityV1PublicKeyPem()
 	if pkPemProp == nil || !pkPemProp.IsXMLSchemaString() {
 		err = fmt.Errorf("publicKeyPem property is not provided or it is not embedded as a value")
@@ -99,11 +108,125 @@ func getPublicKeyFromResponse(c context.Context, b []byte, keyId *url.URL) (p cr
 	return
 }
 
+// withoutFragment returns the IRI without its fragment.
+func withoutFragment(iri *url.URL) *url.URL {
+	u := *iri
+	u.Fragment = ""
+	return &u
+}
+
+// fetchPublicKey dereferences the public key with the id, returning it along
+// with the actor that owns it.
+//
+// The owner is verified: it must have the same origin as the key, and unless
+// the key was served as part of the owner itself, the owner is dereferenced in
+// turn and must list the key as its own. Otherwise any actor could claim the
+// key of another.
+func fetchPublicKey(c context.Context, tp pub.Transport, keyId *url.URL) (p crypto.PublicKey, owner *url.URL, err error) {
+	var b []byte
+	b, err = tp.Dereference(c, keyId)
+	if err != nil {
+		return
+	}
+	var id *url.URL
+	p, owner, id, err = getPublicKeyFromResponse(c, b, keyId)
+	if err != nil {
+		return
+	}
+	if !sameOrigin(keyId, []*url.URL{owner}) {
+		err = fmt.Errorf("owner %s of publicKey %s has a different origin", owner, keyId)
+		return
+	} else if withoutFragment(owner).String() == withoutFragment(id).String() {
+		return
+	}
+	b, err = tp.Dereference(c, owner)
+	if err != nil {
+		return
+	}
+	var ownerOwner, ownerId *url.URL
+	_, ownerOwner, ownerId, err = getPublicKeyFromResponse(c, b, keyId)
+	if err != nil {
+		err = fmt.Errorf("owner %s does not list publicKey %s: %s", owner, keyId, err)
+		return
+	} else if ownerId.String() != owner.String() || ownerOwner.String() != owner.String() {
+		err = fmt.Errorf("owner %s does not own publicKey %s", owner, keyId)
+		return
+	}
+	return
+}
+
+// verifySignature verifies the HTTP Signature with the signer's public key,
+// returning the actor owning the key when it verifies.
+//
+// Keys are not fetched from peers that this server does not federate with.
+// Verified keys are cached, and a signature that fails to verify with a cached
+// key is verified again with a freshly fetched key, in case the peer rotated
+// it. The algorithm of a verified signature is remembered, so that
+// requests to the peer are signed with it when this server supports it.
+func verifySignature(c context.Context,
+	v httpsig.Verifier,
+	tp pub.Transport,
+	tc *conn.Controller) (owner *url.URL, verified bool, err error) {
+	var keyId *url.URL
+	keyId, err = url.Parse(v.KeyId())
+	if err != nil {
+		return
+	}
+	var blocked bool
+	if blocked, err = tc.IsBlocked(c, keyId.Hostname()); err != nil {
+		return
+	} else if blocked {
+		err = fmt.Errorf("refusing to verify a signature from a domain not federated with: %s", keyId)
+		return
+	}
+	pKey, owner, cached := tc.CachedPublicKey(keyId)
+	if cached {
+		if v.Verify(pKey, tc.VerifyAlgorithm(pKey)) == nil {
+			tc.LearnPeerAlgorithm(keyId, pKey)
+			verified = true
+			return
+		}
+		tc.InvalidatePublicKey(keyId)
+	}
+	pKey, owner, err = fetchPublicKey(c, tp, keyId)
+	if err != nil {
+		return
+	}
+	tc.CachePublicKey(keyId, pKey, owner)
+	verified = nil == v.Verify(pKey, tc.VerifyAlgorithm(pKey))
+	if verified {
+		tc.LearnPeerAlgorithm(keyId, pKey)
+	}
+	return
+}
+
+// fetchTransport creates a transport for fetching remote actors and their keys
+// on behalf of the user. The fetches are instead signed by the instance actor
+// if instanceActor is set, which peers requiring signed fetches can verify
+// without having to fetch the user's key in turn.
+func fetchTransport(c util.Context,
+	pk *services.PrivateKeys,
+	tc *conn.Controller,
+	userUUID paths.UUID,
+	instanceActor bool) (tp pub.Transport, err error) {
+	var keys []services.HTTPSignatureKey
+	if instanceActor {
+		keys, err = pk.GetUserHTTPSignatureKeysForInstanceActor(c)
+	} else {
+		keys, err = pk.GetUserHTTPSignatureKeys(c, userUUID)
+	}
+	if err != nil {
+		return
+	}
+	return tc.Get(keys)
+}
+
 func verifyHttpSignatures(c context.Context,
 	r *http.Request,
 	db *Database,
 	pk *services.PrivateKeys,
-	tc *conn.Controller) (authenticated bool, err error) {
+	tc *conn.Controller,
+	signWithInstanceActor bool) (authenticated bool, err error) {
 	// 1. Figure out what key we need to verify
 	ctx := util.Context{c}
 	var v httpsig.Verifier
@@ -111,41 +234,74 @@ func verifyHttpSignatures(c context.Context,
 	if err != nil {
 		return
 	}
-	kId := v.KeyId()
-	var kIdIRI *url.URL
-	kIdIRI, err = url.Parse(kId)
-	if err != nil {
-		return
-	}
 	// 2. Get our user's credentials
 	var userUUID paths.UUID
 	userUUID, err = ctx.UserPathUUID()
 	if err != nil {
 		return
 	}
-	var privKey *rsa.PrivateKey
-	var pubKeyURL *url.URL
-	privKey, pubKeyURL, err = pk.GetUserHTTPSignatureKey(ctx, userUUID)
+	// 3. Fetch the public key of the other actor using our credentials
+	tp, err := fetchTransport(ctx, pk, tc, userUUID, signWithInstanceActor)
 	if err != nil {
 		return
 	}
-	pubKeyId := pubKeyURL.String()
-	// 3. Fetch the public key of the other actor using our credentials
-	tp, err := tc.Get(privKey, pubKeyId)
+	// 4. Verify the other actor's key
+	_, authenticated, err = verifySignature(c, v, tp, tc)
+	return
+}
+
+// VerifyRequestSignature verifies the HTTP Signature of an arbitrary request,
+// fetching the signer's public key on behalf of the instance actor.
+//
+// A request that is unsigned or whose signature does not verify results in
+// verified being false without an error. The actor owning the signing key is
+// returned when the signature verifies.
+func VerifyRequestSignature(c context.Context,
+	r *http.Request,
+	pk *services.PrivateKeys,
+	tc *conn.Controller) (actorIRI *url.URL, verified bool, err error) {
+	v, vErr := httpsig.NewVerifier(r)
+	if vErr != nil {
+		return
+	}
+	var keys []services.HTTPSignatureKey
+	keys, err = pk.GetUserHTTPSignatureKeysForInstanceActor(util.Context{c})
 	if err != nil {
 		return
 	}
-	var b []byte
-	b, err = tp.Dereference(c, kIdIRI)
+	tp, err := tc.Get(keys)
 	if err != nil {
 		return
 	}
-	pKey, err := getPublicKeyFromResponse(c, b, kIdIRI)
+	actorIRI, verified, err = verifySignature(c, v, tp, tc)
+	if !verified {
+		actorIRI = nil
+	}
+	return
+}
+
+// filterForwardingToFollowers limits inbox forwarding to the followers
+// collection of the actor whose inbox received the activity.
+//
+// The potential recipients are the collections owned by this server that the
+// activity is addressed to, so they are compared against the followers
+// collection's IRI and not against its items.
+func filterForwardingToFollowers(c context.Context, potentialRecipients []*url.URL) (filteredRecipients []*url.URL, err error) {
+	ctx := util.Context{c}
+	var actorIRI *url.URL
+	actorIRI, err = ctx.ActorIRI()
 	if err != nil {
 		return
 	}
-	// 4. Verify the other actor's key
-	algo := tc.GetFirstAlgorithm()
-	authenticated = nil == v.Verify(pKey, algo)
+	var followersIRI *url.URL
+	followersIRI, err = paths.IRIForActorID(paths.FollowersPathKey, actorIRI)
+	if err != nil {
+		return
+	}
+	for _, elem := range potentialRecipients {
+		if paths.Normalize(elem).String() == paths.Normalize(followersIRI).String() {
+			filteredRecipients = append(filteredRecipients, elem)
+		}
+	}
 	return
 }
@@ -0,0 +1,165 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package apcoretest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/app"
+	"github.com/google/uuid"
+)
+
+var _ app.S2SApplication = &App{}
+
+// App is a minimal federating Application with no web pages, for servers that
+// only need to send and receive activities. Applications under test may embed
+// it and override only what they exercise.
+type App struct{}
+
+func (a *App) CreateTables(c context.Context, db app.Database, apc app.APCoreConfig, debug bool) error {
+	return nil
+}
+
+func (a *App) OnCreateAdminUser(c context.Context, userID string, d app.Database, apc app.APCoreConfig) error {
+	return nil
+}
+
+func (a *App) Start() error { return nil }
+
+func (a *App) Stop() error { return nil }
+
+func (a *App) NewConfiguration() interface{} { return nil }
+
+func (a *App) SetConfiguration(config interface{}, apcc app.APCoreConfig, debug bool) error {
+	return nil
+}
+
+func (a *App) NotFoundHandler(app.Framework) http.Handler {
+	return statusHandler(http.StatusNotFound)
+}
+
+func (a *App) MethodNotAllowedHandler(app.Framework) http.Handler {
+	return statusHandler(http.StatusMethodNotAllowed)
+}
+
+func (a *App) InternalServerErrorHandler(app.Framework) http.Handler {
+	return statusHandler(http.StatusInternalServerError)
+}
+
+func (a *App) BadRequestHandler(app.Framework) http.Handler {
+	return statusHandler(http.StatusBadRequest)
+}
+
+func (a *App) GetLoginWebHandlerFunc(app.Framework) http.HandlerFunc {
+	return statusHandler(http.StatusNotFound)
+}
+
+func (a *App) GetAuthWebHandlerFunc(app.Framework) http.HandlerFunc {
+	return statusHandler(http.StatusNotFound)
+}
+
+func (a *App) GetInboxWebHandlerFunc(app.Framework) func(w http.ResponseWriter, r *http.Request, outbox vocab.ActivityStreamsOrderedCollectionPage) {
+	return func(w http.ResponseWriter, r *http.Request, inbox vocab.ActivityStreamsOrderedCollectionPage) {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *App) GetOutboxWebHandlerFunc(app.Framework) func(w http.ResponseWriter, r *http.Request, outbox vocab.ActivityStreamsOrderedCollectionPage) {
+	return func(w http.ResponseWriter, r *http.Request, outbox vocab.ActivityStreamsOrderedCollectionPage) {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *App) GetFollowersWebHandlerFunc(app.Framework) (app.CollectionPageHandlerFunc, app.AuthorizeFunc) {
+	return nil, nil
+}
+
+func (a *App) GetFollowingWebHandlerFunc(app.Framework) (app.CollectionPageHandlerFunc, app.AuthorizeFunc) {
+	return nil, nil
+}
+
+func (a *App) GetLikedWebHandlerFunc(app.Framework) (app.CollectionPageHandlerFunc, app.AuthorizeFunc) {
+	return nil, nil
+}
+
+func (a *App) GetUserWebHandlerFunc(app.Framework) (app.VocabHandlerFunc, app.AuthorizeFunc) {
+	return nil, nil
+}
+
+// BuildRoutes serves the activities and notes created by the servers, so that
+// peers may dereference them.
+func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error {
+	permit := func(c context.Context, w http.ResponseWriter, r *http.Request, db app.Database) (bool, error) {
+		return true, nil
+	}
+	r.ActivityPubOnlyHandleFunc("/activities/{activity}", permit)
+	r.ActivityPubOnlyHandleFunc("/notes/{note}", permit)
+	return nil
+}
+
+func (a *App) Paths() app.Paths { return app.Paths{} }
+
+func (a *App) StaticServingEnabled() bool { return false }
+
+func (a *App) NewIDPath(c context.Context, t vocab.Type) (path string, err error) {
+	switch t.GetTypeName() {
+	case "Note":
+		path = fmt.Sprintf("/notes/%s", uuid.New().String())
+	case "Create", "Follow", "Accept", "Reject", "Undo", "Like", "Announce", "Block", "Delete", "Update":
+		path = fmt.Sprintf("/activities/%s", uuid.New().String())
+	default:
+		err = fmt.Errorf("NewIDPath unhandled type name: %s", t.GetTypeName())
+	}
+	return
+}
+
+func (a *App) ScopePermitsPrivateGetInbox(scope string) (permitted bool, err error) {
+	return false, nil
+}
+
+func (a *App) ScopePermitsPrivateGetOutbox(scope string) (permitted bool, err error) {
+	return false, nil
+}
+
+func (a *App) DefaultUserPreferences() interface{} { return nil }
+
+func (a *App) DefaultUserPrivileges() interface{} { return nil }
+
+func (a *App) DefaultAdminPrivileges() interface{} { return nil }
+
+func (a *App) ApplyFederatingCallbacks(fwc *pub.FederatingWrappedCallbacks) (others []interface{}) {
+	return nil
+}
+
+func (a *App) Software() app.Software {
+	return app.Software{
+		Name:         "apcoretest",
+		MajorVersion: 0,
+		MinorVersion: 1,
+		PatchVersion: 0,
+	}
+}
+
+func statusHandler(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
@@ -0,0 +1,356 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package apcoretest runs apcore servers within one process so that how they
+// federate with each other can be tested end to end. Each server listens on an
+// unused local port and stores its data in its own schema of a postgres
+// database. Activities between them are delivered over http with HTTP
+// Signatures, exactly as between any two peers.
+package apcoretest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/apcore"
+	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/framework"
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+// PollInterval is how often Eventually checks its condition.
+var PollInterval = 50 * time.Millisecond
+
+// Server is an apcore instance serving over http on a local port.
+type Server struct {
+	// Host is the host and port the server is reached at, which is also
+	// the host in the IRIs of its data.
+	Host string
+	// Framework acts on behalf of the users of the server.
+	Framework app.Framework
+	instance  *apcore.Instance
+	dir       string
+	served    chan error
+}
+
+// NewServer starts the application in debug mode on an unused local port. Its
+// data is stored in the schema of the postgres database, which must already
+// exist and should differ between the servers of a test.
+//
+// If configure is not nil, it modifies the configuration of the server before
+// it is started. Settings applied to the whole process, such as the templates
+// of users' paths, must be the same for every server.
+func NewServer(pg config.PostgresConfig, a app.Application, configure func(c *config.Config)) (s *Server, err error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return
+	}
+	dir, err := ioutil.TempDir("", "apcoretest")
+	if err != nil {
+		l.Close()
+		return
+	}
+	defer func() {
+		if err != nil {
+			l.Close()
+			os.RemoveAll(dir)
+		}
+	}()
+	c, err := newConfig(l.Addr().String(), dir, pg)
+	if err != nil {
+		return
+	}
+	if configure != nil {
+		configure(c)
+	}
+	i, err := apcore.NewInstance(c, a, true)
+	if err != nil {
+		return
+	}
+	s = &Server{
+		Host:      c.ServerConfig.Host,
+		Framework: i.Framework,
+		instance:  i,
+		dir:       dir,
+		served:    make(chan error, 1),
+	}
+	go func() {
+		s.served <- i.Serve(l)
+	}()
+	return
+}
+
+// newConfig is the default configuration for a server at the host, keeping
+// its files in the directory.
+func newConfig(host, dir string, pg config.PostgresConfig) (c *config.Config, err error) {
+	c, err = framework.DefaultConfig("postgres")
+	if err != nil {
+		return
+	}
+	c.ServerConfig.Host = host
+	// Debug mode serves over http, so the certificate is never loaded.
+	c.ServerConfig.CertFile = filepath.Join(dir, "unused.crt")
+	c.ServerConfig.KeyFile = filepath.Join(dir, "unused.key")
+	c.ServerConfig.CookieAuthKeyFile = filepath.Join(dir, "cookie.key")
+	if err = services.CreateKeyFile(c.ServerConfig.CookieAuthKeyFile); err != nil {
+		return
+	}
+	c.ServerConfig.CookieSessionName = "apcoretest"
+	c.ServerConfig.StaticRootDirectory = dir
+	c.ServerConfig.ShutdownGraceSeconds = 1
+	c.DatabaseConfig.PostgresConfig = pg
+	return
+}
+
+// Close stops the server and removes its files. Its data is left in the
+// database.
+func (s *Server) Close() error {
+	s.instance.Stop()
+	err := <-s.served
+	if rErr := os.RemoveAll(s.dir); err == nil {
+		err = rErr
+	}
+	return err
+}
+
+// CreateUser creates a user with a random password.
+func (s *Server) CreateUser(c context.Context, username string) (paths.UUID, error) {
+	userID, err := s.Framework.CreateUser(c, app.CreateUserParams{
+		Username: username,
+		Email:    fmt.Sprintf("%s@%s", username, s.Host),
+	})
+	return paths.UUID(userID), err
+}
+
+// ActorIRI is the IRI of the actor of one of the server's users.
+func (s *Server) ActorIRI(userID paths.UUID) *url.URL {
+	return s.Framework.UserIRI(userID)
+}
+
+// Post sends a public Create of a Note with the content, addressed to the
+// user's followers, returning the id of the Create.
+func (s *Server) Post(c context.Context, userID paths.UUID, content string) (*url.URL, error) {
+	return s.PostTo(c, userID, content)
+}
+
+// PostTo sends a public Create of a Note with the content, addressed to the
+// user's followers as well as to the other recipients, returning the id of the
+// Create.
+func (s *Server) PostTo(c context.Context, userID paths.UUID, content string, to ...*url.URL) (*url.URL, error) {
+	create, _, err := s.post(c, userID, Note{Content: content, To: to})
+	return create, err
+}
+
+// Note is a Note to post.
+type Note struct {
+	Content string
+	// InReplyTo is the note it is a reply to, if any.
+	InReplyTo *url.URL
+	// Private addresses the Note only to To, instead of also to the Public
+	// collection and the user's followers.
+	Private bool
+	To      []*url.URL
+}
+
+// PostNote sends a Create of the Note, returning the id of the Note.
+func (s *Server) PostNote(c context.Context, userID paths.UUID, n Note) (*url.URL, error) {
+	_, note, err := s.post(c, userID, n)
+	return note, err
+}
+
+// PostNoteCreate is like PostNote, except that it returns the id of the
+// Create.
+func (s *Server) PostNoteCreate(c context.Context, userID paths.UUID, n Note) (*url.URL, error) {
+	create, _, err := s.post(c, userID, n)
+	return create, err
+}
+
+// post sends a Create of the Note, returning the ids of the Create and Note.
+func (s *Server) post(c context.Context, userID paths.UUID, n Note) (createIRI, noteIRI *url.URL, err error) {
+	actor := s.ActorIRI(userID)
+	to := n.To
+	if !n.Private {
+		followers, err := paths.IRIForActorID(paths.FollowersPathKey, actor)
+		if err != nil {
+			return nil, nil, err
+		}
+		to = append([]*url.URL{followers, mustParse(pub.PublicActivityPubIRI)}, to...)
+	}
+
+	note := streams.NewActivityStreamsNote()
+	cp := streams.NewActivityStreamsContentProperty()
+	cp.AppendXMLSchemaString(n.Content)
+	note.SetActivityStreamsContent(cp)
+	at := streams.NewActivityStreamsAttributedToProperty()
+	at.AppendIRI(actor)
+	note.SetActivityStreamsAttributedTo(at)
+	if n.InReplyTo != nil {
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(n.InReplyTo)
+		note.SetActivityStreamsInReplyTo(irt)
+	}
+	nto := streams.NewActivityStreamsToProperty()
+	for _, r := range to {
+		nto.AppendIRI(r)
+	}
+	note.SetActivityStreamsTo(nto)
+
+	create := streams.NewActivityStreamsCreate()
+	ap := streams.NewActivityStreamsActorProperty()
+	ap.AppendIRI(actor)
+	create.SetActivityStreamsActor(ap)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendActivityStreamsNote(note)
+	create.SetActivityStreamsObject(op)
+	cto := streams.NewActivityStreamsToProperty()
+	for _, r := range to {
+		cto.AppendIRI(r)
+	}
+	create.SetActivityStreamsTo(cto)
+
+	if err = s.Framework.Send(c, userID, create); err != nil {
+		return
+	}
+	// Sending assigns the ids.
+	if createIRI, err = pub.GetId(create); err != nil {
+		return
+	}
+	noteIRI, err = pub.GetId(note)
+	return
+}
+
+// Update sends a public Update of the object on behalf of the user, as a client
+// posting its JSON to the user's outbox would. Values of the object that are
+// nil are removed from the stored object, which requires the application to
+// be a C2SApplication.
+func (s *Server) Update(c context.Context, userID paths.UUID, object map[string]interface{}) error {
+	raw := map[string]interface{}{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     "Update",
+		"actor":    s.ActorIRI(userID).String(),
+		"to":       pub.PublicActivityPubIRI,
+		"object":   object,
+	}
+	update, err := streams.ToType(c, raw)
+	if err != nil {
+		return err
+	}
+	ctx := util.Context{c}
+	ctx.WithRawActivity(raw)
+	return s.Framework.Send(ctx.Context, userID, update)
+}
+
+// WaitForInbox waits until the user's inbox has the activity.
+func (s *Server) WaitForInbox(c context.Context, userID paths.UUID, id *url.URL) error {
+	return Eventually(c, func() (bool, error) {
+		return s.Framework.InboxContains(c, userID, id)
+	})
+}
+
+// Follow has the follower send a Follow of the followee, which the followee
+// then Accepts, waiting until the follower has received the Accept.
+func Follow(c context.Context, follower *Server, followerID paths.UUID, followee *Server, followeeID paths.UUID) error {
+	followIRI, err := SendFollow(c, follower, followerID, followee, followeeID)
+	if err != nil {
+		return err
+	}
+	if err := followee.Framework.SendAcceptFollow(c, followeeID, followIRI); err != nil {
+		return err
+	}
+	err = Eventually(c, func() (bool, error) {
+		pending, err := follower.Framework.PendingFollows(c, followerID)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range pending {
+			if id, err := pub.GetId(p); err == nil && id.String() == followIRI.String() {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("accept of follow %s was not received: %w", followIRI, err)
+	}
+	return nil
+}
+
+// SendFollow has the follower send a Follow of the followee, waiting until the
+// followee has received it, and returns the id of the Follow. It is neither
+// accepted nor rejected.
+func SendFollow(c context.Context, follower *Server, followerID paths.UUID, followee *Server, followeeID paths.UUID) (*url.URL, error) {
+	followerIRI := follower.ActorIRI(followerID)
+	followeeIRI := followee.ActorIRI(followeeID)
+
+	follow := streams.NewActivityStreamsFollow()
+	ap := streams.NewActivityStreamsActorProperty()
+	ap.AppendIRI(followerIRI)
+	follow.SetActivityStreamsActor(ap)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(followeeIRI)
+	follow.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(followeeIRI)
+	follow.SetActivityStreamsTo(to)
+
+	if err := follower.Framework.Send(c, followerID, follow); err != nil {
+		return nil, err
+	}
+	followIRI, err := pub.GetId(follow)
+	if err != nil {
+		return nil, err
+	}
+	if err := followee.WaitForInbox(c, followeeID, followIRI); err != nil {
+		return nil, fmt.Errorf("follow %s was not received: %w", followIRI, err)
+	}
+	return followIRI, nil
+}
+
+// Eventually checks the condition every PollInterval until it is met, it
+// fails, or the context is done.
+func Eventually(c context.Context, cond func() (bool, error)) error {
+	t := time.NewTicker(PollInterval)
+	defer t.Stop()
+	for {
+		if ok, err := cond(); err != nil || ok {
+			return err
+		}
+		select {
+		case <-c.Done():
+			return c.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
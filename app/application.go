@@ -19,9 +19,11 @@ package app
 import (
 	"context"
 	"net/http"
+	"net/url"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
 )
 
 // Application is an ActivityPub application built on top of apcore's
@@ -360,6 +362,119 @@ type S2SApplication interface {
 	ApplyFederatingCallbacks(fwc *pub.FederatingWrappedCallbacks) (others []interface{})
 }
 
+// RecipientResolver is an Application that customizes how an outgoing
+// activity's addressing is expanded into the inboxes it is delivered to, such
+// as to apply custom group semantics.
+//
+// Implementing this interface is optional. If not implemented, activities are
+// delivered to the inboxes computed by the built-in expansion of actors and
+// followers collections.
+type RecipientResolver interface {
+	// ResolveRecipients is given the activity being delivered and the
+	// inboxes computed for it by the built-in expansion. It returns the
+	// inboxes the activity is actually delivered to.
+	ResolveRecipients(c context.Context, activity vocab.Type, inboxes []*url.URL) ([]*url.URL, error)
+}
+
+// ActorEnhancer is an Application that customizes a user's actor document
+// before it is served, such as to add extension properties, without having to
+// store them on the actor itself.
+//
+// Implementing this interface is optional. If not implemented, the actor is
+// served as it is stored.
+type ActorEnhancer interface {
+	// EnhanceActor is given the stored actor of the user and returns the
+	// actor to serve for both ActivityStreams and web requests. The actor
+	// may be modified in place. If an error is returned, it is logged and
+	// the stored actor is served instead.
+	EnhanceActor(c context.Context, user paths.UUID, actor vocab.Type) (vocab.Type, error)
+}
+
+// ActorTyper is an Application whose users are represented by actors of
+// another ActivityStreams type than Person, such as Groups or Services.
+//
+// Implementing this interface is optional. If not implemented, users are
+// created as Person actors.
+type ActorTyper interface {
+	// ActorType is the ActivityStreams type of the actor created for a new
+	// user. It must be one of "Application", "Group", "Organization",
+	// "Person", or "Service". It is consulted only when users are
+	// created, so existing users keep the type they were created with.
+	ActorType() string
+}
+
+// Onboarder is an Application that onboards its new users, such as to seed
+// their outbox with a welcome Note or to have them follow an actor.
+//
+// Implementing this interface is optional. If not implemented, new users start
+// without any activities.
+type Onboarder interface {
+	// OnUserCreated is called once for each user created, whether by
+	// Framework.CreateUser, registration, or the init-admin command, after
+	// the user is committed to the database. It is called in the background
+	// with its own context, so the request creating the user does not wait
+	// on it. It is not called for the instance actor.
+	//
+	// Activities may be sent on the user's behalf using the Framework
+	// given to the application, which is not available to the init-admin
+	// command. If an error is returned, it is logged and the user remains
+	// created.
+	OnUserCreated(c context.Context, userID paths.UUID) error
+}
+
+// Registrar is an Application that lets visitors register their own accounts
+// at the built-in registration route. While the server's OpenRegistrations
+// preference is not set, registering requires an invite code minted by an
+// administrator.
+//
+// Implementing this interface is optional. If not implemented, users are only
+// created by the application, such as with Framework.CreateUser.
+type Registrar interface {
+	// Web handler for a GET call to the registration page.
+	//
+	// It should render a registration page that POSTs to the "/register"
+	// endpoint with the "username", "email", and "password" form fields.
+	// When RegistrationInviteRequired is true, it should also ask for the
+	// "invite" form field.
+	//
+	// It is also called to render the page again when a registration is
+	// rejected, in which case RegistrationError returns the reason to
+	// convey to the user.
+	GetRegisterWebHandlerFunc(Framework) http.HandlerFunc
+	// ValidateRegistration is called for a POSTed registration before the
+	// user is created, such as to check a captcha or invite code. If an
+	// error is returned, the user is not created and the registration page
+	// is rendered again with the error.
+	ValidateRegistration(c context.Context, r *http.Request) error
+}
+
+// JSONLDContexter is an Application that extends ActivityStreams with its own
+// types or properties, whose JSON-LD contexts must be present in the documents
+// it serializes for peers to understand them.
+//
+// Implementing this interface is optional. If not implemented, only the
+// contexts of the vocabularies known to go-fed are used.
+type JSONLDContexter interface {
+	// JSONLDContexts are added to the "@context" of serialized documents,
+	// after the ActivityStreams context and without duplicating any
+	// context already present. Each is either the URL of a context
+	// document or a map of term definitions.
+	JSONLDContexts() []interface{}
+}
+
+// SensitiveDefaulter is an Application that decides whether Notes posted by its
+// users are marked sensitive when the client does not say, such as for an
+// instance that marks all media sensitive by default.
+//
+// Implementing this interface is optional. If not implemented, Notes are
+// posted as the client sent them.
+type SensitiveDefaulter interface {
+	// DefaultSensitive is the value of the 'sensitive' property set on a
+	// Note posted to an outbox without one. A value the client set is
+	// never changed.
+	DefaultSensitive() bool
+}
+
 // APCoreConfig allows the application to reuse common fields set in apcore's config.
 type APCoreConfig interface {
 	// Hostname of the application set in the config
@@ -368,4 +483,7 @@ type APCoreConfig interface {
 	ClockTimezone() string
 	// Schema name of the database (ex: for Postgres)
 	Schema() string
+	// Whether development mode is set in the config, in which templates
+	// may be reloaded with ReloadableTemplates
+	DevMode() bool
 }
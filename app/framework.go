@@ -18,25 +18,53 @@ package app
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/paths"
+	"github.com/gorilla/mux"
 )
 
 // Framework provides request-time hooks for use in handlers.
 type Framework interface {
 	Context(r *http.Request) context.Context
 
+	// AuthContext is like Context, additionally attaching the user that
+	// authenticated the request, the IRI of their actor, and the scope
+	// granted to their credential. They are obtained with the
+	// IsAuthenticated, AuthenticatedUserUUID, AuthenticatedUserIRI, and
+	// AuthenticatedScope methods of util.Context, so that handlers and
+	// the functions they call do not need to Validate the request again.
+	//
+	// The context of an anonymous request has no authenticated user. If an
+	// error is returned, the context is still usable as that of an
+	// anonymous request.
+	AuthContext(w http.ResponseWriter, r *http.Request) (context.Context, error)
+
+	// RequireScope returns middleware requiring requests to be
+	// authenticated with a credential whose scope permits the capability,
+	// according to the Application's scope predicates. Anonymous requests
+	// are responded to with 401 Unauthorized, and those whose scope is
+	// insufficient with 403 Forbidden. Permitted requests are served with
+	// the same context as from AuthContext.
+	RequireScope(c Capability) mux.MiddlewareFunc
+
 	UserIRI(userUUID paths.UUID) *url.URL
 
-	// CreateUser creates a new unprivileged user with the given username,
-	// email, and password.
+	// CreateUser creates a new user, along with their actor, private key,
+	// and collections, in a single transaction. This is equivalent to the
+	// init-admin command when creating an admin, except that the
+	// application's OnCreateAdminUser is not called. The application's
+	// OnUserCreated is called for either, if it is an Onboarder.
 	//
 	// If an error is returned, it can be checked using IsNotUniqueUsername
 	// and IsNotUniqueEmail to show the error to the user.
-	CreateUser(c context.Context, username, email, password string) (userID string, err error)
+	CreateUser(c context.Context, params CreateUserParams) (userID string, err error)
 
 	// IsNotUniqueUsername returns true if the error returned from
 	// CreateUser is due to the username not being unique.
@@ -64,6 +92,18 @@ type Framework interface {
 	// Calling Send when federation is disabled results in an error.
 	Send(c context.Context, userID paths.UUID, toSend vocab.Type) error
 
+	// SendToRecipients delivers an already-addressed activity on behalf of
+	// the user to exactly the given inboxes, regardless of its addressing
+	// and without delivering to the user's followers. For example, it can
+	// resend an activity to a peer that failed to receive it.
+	//
+	// The activity is only stored and added to the user's outbox when
+	// sideEffects is true, in which case it must already have an id.
+	//
+	// Calling SendToRecipients when federation is disabled results in an
+	// error.
+	SendToRecipients(c context.Context, userID paths.UUID, activity vocab.Type, recipients []*url.URL, sideEffects bool) error
+
 	// SendAcceptFollow accepts the provided Follow on behalf of the user.
 	//
 	// Calling SendAcceptFollow when federation is disabled results in an
@@ -76,6 +116,69 @@ type Framework interface {
 	// error.
 	SendRejectFollow(c context.Context, userID paths.UUID, followIRI *url.URL) error
 
+	// RemoveFollower removes the follower from the user's followers
+	// collection, and sends the follower a Reject of its original Follow.
+	//
+	// Calling RemoveFollower when federation is disabled results in an
+	// error.
+	RemoveFollower(c context.Context, userID paths.UUID, follower *url.URL) error
+
+	// DeleteContent deletes the user's local content, sending a Delete of
+	// it to the user's followers. Unless disabled in the configuration, the
+	// content is replaced with a Tombstone that continues to be served at
+	// its IRI.
+	//
+	// Calling DeleteContent when federation is disabled results in an
+	// error.
+	DeleteContent(c context.Context, userID paths.UUID, id *url.URL) error
+
+	// Announce shares the object on behalf of the user, sending a public
+	// Announce of it to the user's followers and to the object's author
+	// when known. Undoing the Announce later removes it from the object's
+	// shares collection.
+	//
+	// Calling Announce when federation is disabled results in an error.
+	Announce(c context.Context, userID paths.UUID, object *url.URL) error
+
+	// Undo undoes the Follow, Like, Announce, or Block previously sent by
+	// the user, sending an Undo embedding it to the same recipients.
+	// Undoing a Follow removes its object from the user's following
+	// collection, undoing a Like removes its object from the user's liked
+	// collection, undoing an Announce removes it from the object's shares
+	// collection, and undoing a Block unblocks its object. An error
+	// results if the activity was not sent by the user.
+	//
+	// Calling Undo when federation is disabled results in an error.
+	Undo(c context.Context, userID paths.UUID, activityIRI *url.URL) error
+
+	// Block records that the user blocked the actor. Activities from the
+	// actor are no longer accepted into the user's inbox, and the actor is
+	// removed from the user's followers. A Block is sent to the actor only
+	// when configured to federate blocks. Blocking an actor that is already
+	// blocked does nothing.
+	//
+	// Calling Block when federation is disabled results in an error.
+	Block(c context.Context, userID paths.UUID, actor *url.URL) error
+
+	// Unblock removes the user's block of the actor. If a Block was sent to
+	// the actor, and blocks are still configured to be federated, an Undo
+	// of it is sent as well.
+	//
+	// Calling Unblock when federation is disabled results in an error.
+	Unblock(c context.Context, userID paths.UUID, actor *url.URL) error
+
+	// AddFollowPolicy adds a policy to the user, so that Follows it matches
+	// are accepted automatically while the user otherwise approves
+	// followers manually. Follows that no policy matches remain open for
+	// the user to Accept or Reject. Each policy evaluated for a Follow
+	// records its resolution. The id of the new policy is returned.
+	AddFollowPolicy(c context.Context, userID paths.UUID, p FollowPolicy) (id string, err error)
+	// FollowPolicies obtains the user's policies for accepting Follows.
+	FollowPolicies(c context.Context, userID paths.UUID) ([]FollowPolicy, error)
+	// RemoveFollowPolicy removes one of the user's policies for accepting
+	// Follows.
+	RemoveFollowPolicy(c context.Context, userID paths.UUID, id string) error
+
 	Session(r *http.Request) (Session, error)
 
 	// TODO: Determine if we need this.
@@ -85,6 +188,173 @@ type Framework interface {
 	// Accepted nor Rejected.
 	OpenFollowRequests(c context.Context, userID paths.UUID) ([]vocab.ActivityStreamsFollow, error)
 
+	// VerifyRequestSignature verifies the HTTP Signature of a federated
+	// request received by one of the application's own routes, returning
+	// the IRI of the actor that signed it.
+	//
+	// The signer's public key is fetched on behalf of the instance actor.
+	// A request that is unsigned or does not verify results in verified
+	// being false without an error. Requires federation to be enabled.
+	VerifyRequestSignature(c context.Context, r *http.Request) (actorIRI *url.URL, verified bool, err error)
+
+	// ResolveActor finds the actor of a remote account by its handle, such
+	// as "user@host" or "acct:user@host". The actor's IRI is discovered
+	// with WebFinger on the account's host, and the actor is fetched on
+	// behalf of the instance actor and cached. An actor already cached is
+	// not fetched again.
+	//
+	// Calling ResolveActor when federation is disabled results in an
+	// error.
+	ResolveActor(c context.Context, handle string) (vocab.Type, error)
+
+	// RefreshActor is like ResolveActor, but always discovers the actor's
+	// IRI with WebFinger instead of using the result of a recent lookup,
+	// and fetches the actor instead of using the cached one, such as after
+	// an account has moved.
+	//
+	// Calling RefreshActor when federation is disabled results in an
+	// error.
+	RefreshActor(c context.Context, handle string) (vocab.Type, error)
+
+	// Given a user ID, retrieves all Follows the user has sent that have not
+	// yet been Accepted nor Rejected. A followed actor is only added to the
+	// user's following collection once its Accept is received.
+	PendingFollows(c context.Context, userID paths.UUID) ([]vocab.ActivityStreamsFollow, error)
+
+	// GetFollowersPage fetches a page of at most n of the user's accepted
+	// followers, starting at the given offset. A non-positive n results in
+	// the server's default page size, and n is capped at the server's
+	// maximum page size.
+	GetFollowersPage(c context.Context, userID paths.UUID, n, offset int) (vocab.ActivityStreamsCollectionPage, error)
+
+	// GetOutboxByType fetches a page of at most n of the items in the
+	// user's outbox whose type is one of typeNames, such as "Create" and
+	// "Announce", starting at the given offset into only those items. The
+	// page has a next property only if more such items exist, and its
+	// totalItems counts all such items. A non-positive n results in the
+	// server's default page size, and n is capped at the server's maximum
+	// page size.
+	GetOutboxByType(c context.Context, userID paths.UUID, typeNames []string, n, offset int) (vocab.ActivityStreamsOrderedCollectionPage, error)
+
+	// PublicTimeline fetches at most n of the items addressed to the
+	// public, newest first. Only items older than the one with the maxID
+	// are fetched, unless maxID is nil, so the id of the last item fetched
+	// is the maxID of the next page. The LocalTimeline only has items
+	// created on this server, while the FederatedTimeline also has those
+	// received from peers. Only items whose type is one of typeNames, such
+	// as "Note", are fetched, unless typeNames is empty. The returned more reports whether there are
+	// further items after these. A non-positive n results in the server's
+	// default page size, and n is capped at the server's maximum page
+	// size.
+	PublicTimeline(c context.Context, scope TimelineScope, typeNames []string, n int, maxID *url.URL) (items []vocab.Type, more bool, err error)
+
+	// InboxContains determines whether the user's inbox has the activity,
+	// such as to confirm that one sent by a peer has been received.
+	InboxContains(c context.Context, userID paths.UUID, id *url.URL) (bool, error)
+	// FollowingContains determines whether the user's following collection
+	// has the actor, which is the case once the actor has accepted the
+	// user's Follow.
+	FollowingContains(c context.Context, userID paths.UUID, actor *url.URL) (bool, error)
+
+	// Thread fetches the conversation that the note is part of, for
+	// viewing it as a thread. The ancestors are the notes it is in reply
+	// to, from the start of the conversation. The descendants are the
+	// replies to it and to those replies in turn, each followed by its own
+	// replies, oldest first. Only notes known to this server are included,
+	// and only those the viewer may see, along with their replies. A nil
+	// viewerIRI sees only public notes. Cycles are broken, and how far the
+	// thread is walked is limited.
+	Thread(c context.Context, noteIRI, viewerIRI *url.URL) (ancestors, descendants []vocab.Type, err error)
+
+	// DeliveryStatus fetches the state of federating the activity to each
+	// of its recipients. The activity must have been sent from this server.
+	DeliveryStatus(c context.Context, activityIRI *url.URL) ([]DeliveryRecord, error)
+
+	// PutMedia stores media uploaded by the user, such as an image to attach
+	// to a note, and returns the IRI it is served at. The content type is
+	// determined from the contents, which must be of one of the allowed
+	// content types. If contentType is not empty, it must agree with the
+	// contents or the upload is rejected.
+	//
+	// Calling PutMedia when media uploads are not enabled in the
+	// configuration results in an error.
+	PutMedia(c context.Context, userID paths.UUID, r io.Reader, contentType string) (*url.URL, error)
+
+	// PinFeaturedTag adds the hashtag IRI to the user's featuredTags
+	// collection, which is advertised on the user's actor.
+	PinFeaturedTag(c context.Context, userID paths.UUID, tag *url.URL) error
+	// UnpinFeaturedTag removes the hashtag IRI from the user's featuredTags
+	// collection.
+	UnpinFeaturedTag(c context.Context, userID paths.UUID, tag *url.URL) error
+
+	// Pin adds the IRI of an object of this server attributed to the user,
+	// such as one of the user's posts, to the front of the user's featured
+	// collection, which is advertised on the user's actor. Pinning more
+	// objects than the configured maximum results in an error.
+	Pin(c context.Context, userID paths.UUID, object *url.URL) error
+	// Unpin removes the object IRI from the user's featured collection.
+	Unpin(c context.Context, userID paths.UUID, object *url.URL) error
+
+	// SetProfileFields replaces the user's profile metadata fields, which
+	// are shown as name and value pairs on the user's profile. They are
+	// advertised as PropertyValue attachments of the user's actor, and
+	// its other attachments are kept. An error results if there are more
+	// fields, or longer names or values, than the configuration allows.
+	SetProfileFields(c context.Context, userID paths.UUID, fields []ProfileField) error
+
+	// PutEmoji defines a custom emoji of this server, which notes refer to
+	// in their content as ":shortcode:". The image at the IRI, such as one
+	// uploaded with PutMedia, is displayed in its place. An existing emoji
+	// with the same shortcode is replaced. Shortcodes may only contain
+	// letters, digits, and underscores.
+	PutEmoji(c context.Context, shortcode string, image *url.URL, mediaType string) error
+	// DeleteEmoji removes the custom emoji.
+	DeleteEmoji(c context.Context, shortcode string) error
+	// GetEmoji fetches the custom emoji, to be added to the tags of a note
+	// that uses it. It is nil if there is no such emoji.
+	GetEmoji(c context.Context, shortcode string) (vocab.TootEmoji, error)
+
+	// ListAuthorizations fetches the third-party applications the user has
+	// granted OAuth2 tokens to, such as to show in their settings. The
+	// user's own logged-in sessions are not included.
+	ListAuthorizations(c context.Context, userID paths.UUID) ([]ClientAuthorization, error)
+	// RevokeAuthorization deletes every OAuth2 token the user has granted
+	// to the third-party application, which then no longer validate.
+	// Revoking an application without any tokens is not an error.
+	RevokeAuthorization(c context.Context, userID paths.UUID, clientID string) error
+	// RequestedScopes describes the scopes requested by the client in an
+	// OAuth2 authorization request, such as for GetAuthWebHandlerFunc to
+	// show the user what they are being asked to grant. A scope that the
+	// ScopedApplication did not register is an error.
+	RequestedScopes(r *http.Request) ([]Scope, error)
+
+	// DatabaseStats returns statistics about the connection pool to the
+	// primary database, such as for reporting metrics.
+	DatabaseStats() sql.DBStats
+
+	// AllowDomain adds the host to the domains federated with when the
+	// federation mode is "allowlist".
+	AllowDomain(c context.Context, host string) error
+	// DisallowDomain removes the host from the domains federated with when
+	// the federation mode is "allowlist".
+	DisallowDomain(c context.Context, host string) error
+	// BlockDomain adds the host to the domains not federated with when the
+	// federation mode is "blocklist".
+	BlockDomain(c context.Context, host string) error
+	// UnblockDomain removes the host from the domains not federated with
+	// when the federation mode is "blocklist".
+	UnblockDomain(c context.Context, host string) error
+
+	// SubscribeRelay subscribes the server to the relay with the inbox,
+	// by having the instance actor Follow it. Once the relay accepts, the
+	// public activities it announces are added to the federated timeline.
+	SubscribeRelay(c context.Context, inbox *url.URL) error
+	// UnsubscribeRelay undoes the subscription to the relay with the
+	// inbox.
+	UnsubscribeRelay(c context.Context, inbox *url.URL) error
+	// Relays lists the server's subscriptions to relays.
+	Relays(c context.Context) ([]Relay, error)
+
 	// GetPrivileges accepts a pointer to an appPrivileges struct to read
 	// from the database for the given user, and also returns whether that
 	// user is an admin.
@@ -92,6 +362,143 @@ type Framework interface {
 	// SetPrivileges sets the given application privileges and admin status
 	// for the given user.
 	SetPrivileges(c context.Context, userID paths.UUID, admin bool, appPrivileges interface{}) error
+	// SetPostRateLimit overrides the number of posts the user may make to
+	// their outbox per minute and per hour, which otherwise are limited by
+	// the server's configuration. Zero uses the server's limit, and a
+	// negative value means no limit.
+	SetPostRateLimit(c context.Context, userID paths.UUID, perMinute, perHour int) error
+
+	// Announcement returns the sitewide announcement that is currently
+	// shown, or nil if there is none, for rendering in web pages. It is
+	// also served at /api/v1/instance, if ni_enable_instance_api is set.
+	Announcement(c context.Context) (*Announcement, error)
+	// SetAnnouncement replaces the sitewide announcement, which is shown
+	// between its start and end times. A nil announcement removes it.
+	SetAnnouncement(c context.Context, a *Announcement) error
+}
+
+// CreateUserParams describes a user to create.
+type CreateUserParams struct {
+	// Username is the preferredUsername of the user's actor, which must be
+	// unique.
+	Username string
+	// Email is the user's email address, which must be unique.
+	Email string
+	// Password is the user's password. If empty, the user is given a
+	// random password, such as for users authenticated by an external
+	// identity system.
+	Password string
+	// Summary is the initial summary of the user's actor.
+	Summary string
+	// Admin creates the user with admin privileges and the application's
+	// default admin privileges, instead of its default user privileges.
+	Admin bool
+}
+
+// DeliveryState is the state of delivering an activity to a recipient.
+type DeliveryState string
+
+const (
+	// DeliveryNew has not yet been attempted.
+	DeliveryNew DeliveryState = "new"
+	// DeliverySucceeded was accepted by the recipient's server.
+	DeliverySucceeded DeliveryState = "success"
+	// DeliveryFailed failed and will be retried.
+	DeliveryFailed DeliveryState = "failed"
+	// DeliveryAbandoned failed too many times and will not be retried.
+	DeliveryAbandoned DeliveryState = "abandoned"
+)
+
+// ProfileField is a profile metadata field of a user, such as a link to their
+// website. The value may contain HTML.
+type ProfileField struct {
+	Name  string
+	Value string
+}
+
+// DeliveryRecord is the state of delivering an activity to one of its
+// recipients.
+type DeliveryRecord struct {
+	Recipient   *url.URL      `json:"-"`
+	State       DeliveryState `json:"state"`
+	Attempts    int           `json:"attempts"`
+	LastAttempt time.Time     `json:"lastAttempt"`
+}
+
+// MarshalJSON serializes the recipient as a string alongside the other
+// fields.
+func (d DeliveryRecord) MarshalJSON() ([]byte, error) {
+	type record DeliveryRecord
+	var recipient string
+	if d.Recipient != nil {
+		recipient = d.Recipient.String()
+	}
+	return json.Marshal(struct {
+		record
+		Recipient string `json:"recipient"`
+	}{
+		record:    record(d),
+		Recipient: recipient,
+	})
+}
+
+// Announcement is a sitewide message, such as a maintenance notice or an update
+// to the rules, shown to visitors between its start and end times.
+type Announcement struct {
+	Text string `json:"text"`
+	// Start is when the announcement is first shown. If zero, it is shown
+	// immediately.
+	Start time.Time `json:"start"`
+	// End is when the announcement is no longer shown. If zero, it is
+	// shown until it is removed.
+	End time.Time `json:"end"`
+}
+
+// Relay is a subscription to a relay, which forwards the public activities of
+// all of its subscribers.
+type Relay struct {
+	Inbox string `json:"inbox"`
+	// Actor is the relay's actor, which is empty until the relay accepts
+	// the subscription.
+	Actor string `json:"actor,omitempty"`
+	// State is "pending" until the relay accepts, then "accepted".
+	State   string    `json:"state"`
+	Created time.Time `json:"created"`
+}
+
+// TimelineScope determines which public items a timeline has.
+type TimelineScope int
+
+const (
+	// LocalTimeline has the public items created on this server.
+	LocalTimeline TimelineScope = iota
+	// FederatedTimeline has the public items created on this server and
+	// those received from peers.
+	FederatedTimeline
+)
+
+// ClientAuthorization is a third-party application a user has granted OAuth2
+// tokens to.
+type ClientAuthorization struct {
+	ClientID string    `json:"clientId"`
+	Domain   string    `json:"domain"`
+	Scopes   []string  `json:"scopes"`
+	Created  time.Time `json:"created"`
+	Tokens   int       `json:"tokens"`
+}
+
+// FollowPolicy determines which Follows are accepted automatically, based on
+// the domains of the actors that sent them.
+type FollowPolicy struct {
+	// ID is set by the Framework for existing policies.
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Domains limits the policy to Follows from actors on these domains.
+	// When empty, Follows from actors on any domain match.
+	Domains []string `json:"domains,omitempty"`
+	// ExceptDomains excludes Follows from actors on these domains.
+	ExceptDomains []string `json:"exceptDomains,omitempty"`
 }
 
 type Session interface {
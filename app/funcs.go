@@ -28,3 +28,39 @@ type AuthorizeFunc func(c context.Context, w http.ResponseWriter, r *http.Reques
 type CollectionPageHandlerFunc func(http.ResponseWriter, *http.Request, vocab.ActivityStreamsCollectionPage)
 
 type VocabHandlerFunc func(http.ResponseWriter, *http.Request, vocab.Type)
+
+const (
+	// registrationErrorContextKey is the context key of the reason a
+	// registration was rejected.
+	registrationErrorContextKey = "registrationError"
+	// registrationInviteContextKey is the context key of whether
+	// registering requires an invite code.
+	registrationInviteContextKey = "registrationInvite"
+)
+
+// WithRegistrationError returns a copy of the request carrying the reason a
+// registration was rejected, for rendering the registration page again.
+func WithRegistrationError(r *http.Request, err error) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), registrationErrorContextKey, err))
+}
+
+// RegistrationError returns the reason a registration was rejected when the
+// registration page is rendered again, or nil otherwise.
+func RegistrationError(r *http.Request) error {
+	err, _ := r.Context().Value(registrationErrorContextKey).(error)
+	return err
+}
+
+// WithRegistrationInviteRequired returns a copy of the request carrying whether
+// registering requires an invite code, for rendering the registration page.
+func WithRegistrationInviteRequired(r *http.Request, required bool) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), registrationInviteContextKey, required))
+}
+
+// RegistrationInviteRequired determines whether the registration page being
+// rendered must ask for an invite code, because the server does not have open
+// registrations.
+func RegistrationInviteRequired(r *http.Request) bool {
+	b, _ := r.Context().Value(registrationInviteContextKey).(bool)
+	return b
+}
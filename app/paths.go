@@ -30,6 +30,8 @@ type Paths struct {
 	GetLogin            string
 	PostLogin           string
 	GetLogout           string
+	GetRegister         string
+	PostRegister        string
 	GetOAuth2Authorize  string
 	PostOAuth2Authorize string
 	RedirectToHomepage  func(string) string
@@ -55,6 +57,14 @@ func (p Paths) GetLogoutPath() string {
 	return p.getOrDefault(p.GetLogout, "/logout")
 }
 
+func (p Paths) GetRegisterPath() string {
+	return p.getOrDefault(p.GetRegister, "/register")
+}
+
+func (p Paths) PostRegisterPath() string {
+	return p.getOrDefault(p.PostRegister, "/register")
+}
+
 func (p Paths) GetOAuth2AuthorizePath() string {
 	return p.getOrDefault(p.GetOAuth2Authorize, "/oauth2/authorize")
 }
@@ -0,0 +1,92 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability is an action that the scope of an OAuth2 token may permit its
+// bearer to take, as determined by the scope predicates of the Application.
+type Capability int
+
+const (
+	// CapabilityPostOutbox is posting to an actor's outbox, determined by
+	// the C2SApplication's ScopePermitsPostOutbox.
+	CapabilityPostOutbox Capability = iota
+	// CapabilityPrivateGetInbox is viewing the private messages in an
+	// actor's inbox, determined by ScopePermitsPrivateGetInbox.
+	CapabilityPrivateGetInbox
+	// CapabilityPrivateGetOutbox is viewing the private messages in an
+	// actor's outbox, determined by ScopePermitsPrivateGetOutbox.
+	CapabilityPrivateGetOutbox
+)
+
+// ScopePermits determines whether the scope permits the capability, according
+// to the Application's scope predicates. Only a C2SApplication permits posting
+// to an outbox.
+func ScopePermits(a Application, c Capability, scope string) (bool, error) {
+	switch c {
+	case CapabilityPostOutbox:
+		c2s, ok := a.(C2SApplication)
+		if !ok {
+			return false, nil
+		}
+		return c2s.ScopePermitsPostOutbox(scope)
+	case CapabilityPrivateGetInbox:
+		return a.ScopePermitsPrivateGetInbox(scope)
+	case CapabilityPrivateGetOutbox:
+		return a.ScopePermitsPrivateGetOutbox(scope)
+	default:
+		return false, fmt.Errorf("unknown capability: %d", c)
+	}
+}
+
+// Scope is an OAuth2 scope that third-party clients may request, along with a
+// description of what it grants that is shown to users on the authorization
+// page.
+//
+// Scopes are hierarchical, with their parts separated by colons: a token
+// granted the scope "read" also satisfies a requirement for "read:notes".
+type Scope struct {
+	Name        string
+	Description string
+}
+
+// ScopedApplication is an Application that registers the OAuth2 scopes that
+// clients may request. Authorization requests for any other scope are then
+// rejected. Applications that do not register their scopes accept any scope.
+type ScopedApplication interface {
+	Application
+	// Scopes returns the scopes that clients may request. Their names must
+	// be unique and may not contain whitespace.
+	Scopes() []Scope
+}
+
+// ScopeIncludes determines whether the granted scope, a space-separated list as
+// in an OAuth2 token, includes the required scope. A granted scope includes
+// itself and every scope beneath it in the hierarchy, so "read" includes
+// "read:notes" but "read:notes" does not include "read".
+func ScopeIncludes(granted, required string) bool {
+	for _, g := range strings.Fields(granted) {
+		if g == required || strings.HasPrefix(required, g+":") {
+			return true
+		}
+	}
+	return false
+}
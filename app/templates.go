@@ -0,0 +1,91 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"html/template"
+	"io"
+	"sync"
+)
+
+// TemplateProvider provides the templates of an application, which may be
+// re-parsed whenever they are used so that changes to them are reflected
+// without restarting, such as in development mode.
+type TemplateProvider struct {
+	glob   string
+	funcs  template.FuncMap
+	mu     sync.RWMutex
+	t      *template.Template
+	reload bool
+}
+
+// ReloadableTemplates parses the templates matching the glob, with the
+// functions, and returns a TemplateProvider of them. The templates are not
+// reloaded until SetReload enables it, typically when the APCoreConfig is in
+// DevMode.
+func ReloadableTemplates(glob string, funcs template.FuncMap) (*TemplateProvider, error) {
+	p := &TemplateProvider{
+		glob:  glob,
+		funcs: funcs,
+	}
+	t, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	p.t = t
+	return p, nil
+}
+
+// SetReload sets whether the templates are re-parsed each time they are used.
+func (p *TemplateProvider) SetReload(reload bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reload = reload
+}
+
+// Templates returns the templates, re-parsing them first when reloading is
+// enabled.
+func (p *TemplateProvider) Templates() (*template.Template, error) {
+	p.mu.RLock()
+	t, reload := p.t, p.reload
+	p.mu.RUnlock()
+	if !reload {
+		return t, nil
+	}
+	t, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.t = t
+	p.mu.Unlock()
+	return t, nil
+}
+
+// ExecuteTemplate applies the named template to the data, writing the output
+// to w.
+func (p *TemplateProvider) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	t, err := p.Templates()
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+func (p *TemplateProvider) parse() (*template.Template, error) {
+	return template.New("").Funcs(p.funcs).ParseGlob(p.glob)
+}
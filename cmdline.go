@@ -37,6 +37,7 @@ var (
 	infoLogFileFlag  = flag.String("info_log_file", "", "Log file for info, defaults to stdout")
 	errorLogFileFlag = flag.String("error_log_file", "", "Log file for errors, defaults to stderr")
 	configFlag       = flag.String("config", "config.ini", "Path to the configuration file")
+	pingDBFlag       = flag.Bool("ping_db", false, "Also connect to and ping the database when running the check-config action")
 )
 
 // Usage is overridable so client applications can add custom additional
@@ -127,6 +128,16 @@ var (
 		Description: "Create or overwrite the server configuration in a guided flow.",
 		Action:      configureFn,
 	}
+	checkConfig cmdAction = cmdAction{
+		Name:        "check-config",
+		Description: "Loads and validates the configuration without launching the server, reporting all problems found. Use -ping_db to also ping the database.",
+		Action:      checkConfigFn,
+	}
+	recountCollections cmdAction = cmdAction{
+		Name:        "recount-collections",
+		Description: "Recomputes the totalItems of every inbox, outbox, and collection from the items they actually contain, such as after manual changes to the database. Requires a database.",
+		Action:      recountCollectionsFn,
+	}
 	version cmdAction = cmdAction{
 		Name:        "version",
 		Description: "List the current software and version.",
@@ -147,6 +158,8 @@ func init() {
 		initDb,
 		initAdmin,
 		configure,
+		checkConfig,
+		recountCollections,
 		version,
 		help,
 	}
@@ -308,6 +321,38 @@ func versionFn(a app.Application) error {
 	return nil
 }
 
+// The 'check-config' command line action.
+func checkConfigFn(a app.Application) error {
+	c, problems := framework.CheckConfigFile(*configFlag, a, *devFlag)
+	if c != nil && *pingDBFlag && c.DatabaseConfig.Verify() == nil {
+		if err := doPingDB(c); err != nil {
+			problems = append(problems, fmt.Errorf("database: %s", err))
+		}
+	}
+	if len(problems) == 0 {
+		fmt.Fprintf(os.Stdout, "%s: OK\n", *configFlag)
+		return nil
+	}
+	fmt.Fprintf(os.Stdout, "%s: %d problem(s) found:\n", *configFlag, len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(os.Stdout, "  - %s\n", p)
+	}
+	return fmt.Errorf("%d problem(s) found in %s", len(problems), *configFlag)
+}
+
+// The 'recount-collections' command line action.
+func recountCollectionsFn(a app.Application) error {
+	recounted, err := doRecountCollections(*configFlag, a, *devFlag, schemeFromFlags())
+	if err != nil {
+		return err
+	}
+	for _, dc := range recounted {
+		fmt.Fprintf(os.Stdout, "%s: totalItems %d -> %d\n", dc.ID, dc.Stored, dc.Actual)
+	}
+	fmt.Fprintf(os.Stdout, "%d collection(s) recounted\n", len(recounted))
+	return nil
+}
+
 // The 'help' command line action.
 func helpFn(a app.Application) error {
 	flag.Usage()
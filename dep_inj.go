@@ -17,11 +17,18 @@
 package apcore
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/ap"
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework"
@@ -31,7 +38,9 @@ import (
 	"github.com/go-fed/apcore/framework/oauth2"
 	"github.com/go-fed/apcore/framework/web"
 	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
 	"github.com/gorilla/mux"
 )
 
@@ -41,9 +50,21 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 	if err != nil {
 		return
 	}
+	s, _, err = newServerFromConfig(c, appl, debug, schemeFromFlags())
+	return
+}
 
+// newServerFromConfig builds the server and the Framework given to the
+// application from an already loaded configuration.
+func newServerFromConfig(c *config.Config, appl app.Application, debug bool, scheme string) (s *framework.Server, fw *framework.Framework, err error) {
 	host := c.ServerConfig.Host
-	scheme := schemeFromFlags()
+	if err = setPathTemplates(c, appl); err != nil {
+		return
+	}
+	if at, ok := appl.(app.ActorTyper); ok && !services.IsActorType(at.ActorType()) {
+		err = fmt.Errorf("application actor type %q: %w", at.ActorType(), services.InvalidActorType)
+		return
+	}
 
 	// Create a server clock, a pub.Clock
 	clock, err := ap.NewClock(c.ActivityPubConfig.ClockTimezone)
@@ -60,7 +81,7 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 	}
 
 	// Create the models & services for higher-level transformations
-	cryp, data, dAttempts, followers, following, inboxes, liked, oauthSrv, outboxes, policies, pkeys, users, nodeinfo, any, models := createModelsAndServices(c, sqldb, dialect, appl, host, scheme, clock)
+	cryp, data, dAttempts, followers, following, inboxes, liked, featuredTags, featured, shares, replies, oauthSrv, outboxes, policies, pkeys, users, nodeinfo, idempotency, drift, media, domains, blocks, emoji, invites, reports, relays, sharedInboxes, any, models := createModelsAndServices(c, sqldb, dialect, appl, host, scheme, clock)
 
 	// Ensure the SQL statements are prepared
 	err = prepare(models, sqldb, dialect)
@@ -68,13 +89,55 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 		return
 	}
 
+	// Refuse to serve users' boxes at paths other than those peers know
+	if err = users.CheckBoxPathTemplates(util.Context{context.Background()}, scheme, host); err != nil {
+		return
+	}
+
+	// Repair users that are missing any of their collections
+	if c.DatabaseConfig.EnsureCollectionsOnStart {
+		var n int
+		n, err = drift.EnsureCollections(util.Context{context.Background()})
+		if err != nil {
+			return
+		}
+		util.InfoLogger.Infof("Created %d missing collections", n)
+	}
+
+	// Create the instance actor on first boot
+	if c.DatabaseConfig.EnsureInstanceActorOnStart {
+		var created bool
+		created, err = users.EnsureInstanceActor(util.Context{context.Background()}, scheme, host, c.ServerConfig.RSAKeySize, framework.DefaultServerProfile(c, scheme, host))
+		if err != nil {
+			return
+		} else if created {
+			util.InfoLogger.Info("Created the instance actor")
+		}
+	}
+
+	// Connect uploaded media to where its contents are stored
+	if c.MediaConfig.EnableMedia {
+		media.Storage, err = newMediaStorage(c)
+		if err != nil {
+			return
+		}
+	} else {
+		media = nil
+	}
+
+	// Create the read replicas, which need their own prepared statements
+	replicaDBs, replicas, replicaModels, err := newReadReplicas(c, dialect, appl, host, scheme, clock)
+	if err != nil {
+		return
+	}
+
 	// ** Create Misc Helpers **
 
 	// Create placeholder framework.
 	//
 	// Creating a placeholder early allows us to inject it into the needed
 	// dependencies, even if *Framework is not yet ready for use.
-	fw := &framework.Framework{}
+	fw = &framework.Framework{}
 	internalErrorHandler := appl.InternalServerErrorHandler(fw)
 
 	// Prepare web sessions behavior
@@ -83,8 +146,16 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 		return
 	}
 
-	// Prepare OAuth2 server
-	oauth, err := oauth2.NewServer(c, scheme, internalErrorHandler, oauthSrv, cryp, sess)
+	// Prepare OAuth2 server, with the scopes the application registers
+	var appScopes []app.Scope
+	if sa, ok := appl.(app.ScopedApplication); ok {
+		appScopes = sa.Scopes()
+	}
+	scopes, err := oauth2.NewScopeRegistry(appScopes)
+	if err != nil {
+		return
+	}
+	oauth, err := oauth2.NewServer(c, scheme, internalErrorHandler, oauthSrv, cryp, sess, scopes)
 	if err != nil {
 		return
 	}
@@ -104,17 +175,24 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 		followers,
 		following,
 		liked,
-		any)
+		shares,
+		replies,
+		reports,
+		any,
+		replicas)
 
 	// Create a pub.Database
 	apdb := ap.NewAPDB(db, appl)
 
 	// Create a controller for outbound messaging.
-	tc, err := conn.NewController(c, appl, clock, httpClient, dAttempts, pkeys)
+	tc, err := conn.NewController(c, appl, clock, httpClient, dAttempts, pkeys, domains, sharedInboxes)
 	if err != nil {
 		return
 	}
 
+	// Make remote fetches that requests do not wait on in the background.
+	bg := ap.NewBackground(c)
+
 	// Hook up ActivityPub Actor behavior for users.
 	actor, err := ap.NewActor(c,
 		appl,
@@ -125,8 +203,12 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 		pkeys,
 		policies,
 		followers,
+		following,
 		users,
-		tc)
+		domains,
+		blocks,
+		tc,
+		bg)
 	if err != nil {
 		return
 	}
@@ -137,23 +219,57 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 		apdb,
 		pkeys,
 		followers,
-		tc)
+		tc,
+		relays,
+		bg)
 
 	// ** Initialize the Web Server **
 
 	// Build framework for auxiliary behaviors
+	verifySignature := func(c context.Context, r *http.Request) (*url.URL, bool, error) {
+		return ap.VerifyRequestSignature(c, r, pkeys, tc)
+	}
+	sendToRecipients := func(c context.Context, userID paths.UUID, activity vocab.Type, recipients []*url.URL, sideEffects bool) error {
+		return ap.SendToRecipients(c, apdb, pkeys, tc, userID, activity, recipients, sideEffects)
+	}
+	resolveActor := func(c context.Context, handle string, refresh bool) (vocab.Type, error) {
+		return ap.ResolveActor(c, apdb, pkeys, tc, handle, refresh)
+	}
+	sendAsInstance := func(c context.Context, activity vocab.Type, recipients []*url.URL) error {
+		return ap.SendFromInstanceActor(c, apdb, pkeys, tc, activity, recipients)
+	}
 	fw = framework.BuildFramework(scheme,
 		host,
 		c.ServerConfig.RSAKeySize,
 		c.ServerConfig.SaltSize,
 		c.ServerConfig.BCryptStrength,
+		c.ActivityPubConfig.FederateBlocks,
 		fw,
 		oauth,
 		sess,
 		data,
 		followers,
+		inboxes,
+		outboxes,
+		following,
+		featuredTags,
+		featured,
+		replies,
 		users,
+		dAttempts,
+		media,
+		domains,
+		blocks,
+		policies,
+		emoji,
+		relays,
+		sqldb,
+		clock,
 		actor,
+		verifySignature,
+		sendToRecipients,
+		resolveActor,
+		sendAsInstance,
 		appl)
 
 	// Obtain a normal router and fallback web handlers.
@@ -164,6 +280,28 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 	getAuthWebHandler := appl.GetAuthWebHandlerFunc(fw)
 	getLoginWebHandler := appl.GetLoginWebHandlerFunc(fw)
 
+	// Require signatures on fetches only in authorized fetch mode.
+	var verifyFetch framework.SignatureVerifierFunc
+	if c.ActivityPubConfig.AuthorizedFetch {
+		verifyFetch = verifySignature
+	}
+
+	// Reject stale and replayed HTTP Signatures, and deliveries whose
+	// signatures do not cover their bodies.
+	signatures := framework.NewSignatureWindow(clock,
+		time.Second*time.Duration(c.ActivityPubConfig.HttpSignaturesConfig.MaxClockSkewSeconds),
+		c.ActivityPubConfig.HttpSignaturesConfig.RejectReplays,
+		c.ActivityPubConfig.HttpSignaturesConfig.InboundPostHeaders)
+
+	// Limit how often each user may post to their outbox.
+	posts := framework.NewPostLimiter(clock,
+		users,
+		outboxes,
+		scheme,
+		host,
+		c.ActivityPubConfig.PostRateLimitPerMinute,
+		c.ActivityPubConfig.PostRateLimitPerHour)
+
 	// Build a specialized AP-aware router for managing and routing HTTP requests.
 	r := framework.NewRouter(
 		mr,
@@ -172,12 +310,33 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 		actorMap,
 		clock,
 		apdb,
+		idempotency,
+		domains,
+		signatures,
+		posts,
+		fw.RequireScope,
 		host,
 		scheme,
 		internalErrorHandler,
-		badRequestHandler)
+		badRequestHandler,
+		verifyFetch,
+		verifySignature,
+		c.ActivityPubConfig.ObjectMaxAgeSeconds,
+		int64(c.ActivityPubConfig.MaxRequestBodyBytes))
+
+	// Answer liveness and readiness probes
+	health := framework.NewHealth(sqldb.PingContext)
 
 	// Build application routes for default web support
+	// Read-only mode, which administrators can toggle at runtime. Logging
+	// in remains possible so that they can turn it off.
+	pt := appl.Paths()
+	ro := framework.NewReadOnly(c.ServerConfig.ReadOnly,
+		paths.AdminReadOnlyRoute,
+		pt.PostLoginPath(),
+		pt.PostOAuth2AuthorizePath(),
+		paths.OAuth2TokenRoute)
+
 	h, err := framework.BuildHandler(r,
 		internalErrorHandler,
 		badRequestHandler,
@@ -195,7 +354,16 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 		following,
 		followers,
 		liked,
+		featuredTags,
+		featured,
+		replies,
+		media,
+		emoji,
+		invites,
+		reports,
 		sqldb,
+		health,
+		ro,
 		oauth,
 		sess,
 		fw,
@@ -207,13 +375,14 @@ func newServer(configFileName string, appl app.Application, debug bool) (s *fram
 	}
 
 	// Build list of StartStoppers
-	ss := []framework.StartStopper{tc, oauth}
+	ss := []framework.StartStopper{onboarding{users}, bg, tc, oauth, framework.NewDriftChecker(c, drift), framework.NewOutboxRetention(c, clock, outboxes, fw), framework.NewInboxProcessedPruner(c, clock, idempotency)}
+	ro.Pause(ss...)
 
 	// Build web server to control server behavior
 	if debug {
-		s, err = framework.NewInsecureServer(c, h, appl, sqldb, dialect, models, ss)
+		s, err = framework.NewInsecureServer(c, h, appl, sqldb, replicaDBs, dialect, append(models, replicaModels...), ss, health)
 	} else {
-		s, err = framework.NewHTTPSServer(c, h, appl, sqldb, dialect, models, ss)
+		s, err = framework.NewHTTPSServer(c, h, appl, sqldb, replicaDBs, dialect, append(models, replicaModels...), ss, health)
 	}
 	return
 }
@@ -224,7 +393,35 @@ func newModels(configFileName string, appl app.Application, debug bool, scheme s
 	if err != nil {
 		return
 	}
+	sqldb, dialect, m, err = newModelsFromConfig(c, appl, scheme)
+	return
+}
+
+// setPathTemplates configures the paths package with the templates of users'
+// paths, which is needed both to serve and to create users. The templates
+// must not collide with the configured health check paths or the
+// application's login, registration, and authorization paths.
+func setPathTemplates(c *config.Config, appl app.Application) error {
+	pt := appl.Paths()
+	return paths.SetBoxPathTemplates(c.ActivityPubConfig.InboxPathTemplate, c.ActivityPubConfig.OutboxPathTemplate,
+		c.ServerConfig.LivenessPath,
+		c.ServerConfig.ReadinessPath,
+		pt.GetLoginPath(),
+		pt.PostLoginPath(),
+		pt.GetLogoutPath(),
+		pt.GetRegisterPath(),
+		pt.PostRegisterPath(),
+		pt.GetOAuth2AuthorizePath(),
+		pt.PostOAuth2AuthorizePath())
+}
+
+// newModelsFromConfig creates the models, without preparing their statements,
+// from an already loaded configuration.
+func newModelsFromConfig(c *config.Config, appl app.Application, scheme string) (sqldb *sql.DB, dialect models.SqlDialect, m []models.Model, err error) {
 	host := c.ServerConfig.Host
+	if err = setPathTemplates(c, appl); err != nil {
+		return
+	}
 
 	// Create a server clock, a pub.Clock
 	var clock pub.Clock
@@ -239,7 +436,7 @@ func newModels(configFileName string, appl app.Application, debug bool, scheme s
 		return
 	}
 
-	_, _, _, _, _, _, _, _, _, _, _, _, _, _, m = createModelsAndServices(c, sqldb, dialect, appl, host, scheme, clock)
+	_, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, m = createModelsAndServices(c, sqldb, dialect, appl, host, scheme, clock)
 	return
 }
 
@@ -250,6 +447,9 @@ func newUserService(configFileName string, appl app.Application, debug bool, sch
 		return
 	}
 	host := c.ServerConfig.Host
+	if err = setPathTemplates(c, appl); err != nil {
+		return
+	}
 
 	// Create a server clock, a pub.Clock
 	var clock pub.Clock
@@ -266,7 +466,7 @@ func newUserService(configFileName string, appl app.Application, debug bool, sch
 	}
 
 	var ml []models.Model
-	_, _, _, _, _, _, _, _, _, _, _, users, _, _, ml = createModelsAndServices(c, sqldb, dialect, appl, host, scheme, clock)
+	_, _, _, _, _, _, _, _, _, _, _, _, _, _, _, users, _, _, _, _, _, _, _, _, _, _, _, _, ml = createModelsAndServices(c, sqldb, dialect, appl, host, scheme, clock)
 	err = prepare(ml, sqldb, dialect)
 	return
 }
@@ -278,12 +478,26 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 	following *services.Following,
 	inboxes *services.Inboxes,
 	liked *services.Liked,
+	featuredTags *services.FeaturedTags,
+	featured *services.Featured,
+	shares *services.Shares,
+	replies *services.Replies,
 	oauth *services.OAuth2,
 	outboxes *services.Outboxes,
 	policies *services.Policies,
 	pkeys *services.PrivateKeys,
 	users *services.Users,
 	nodeinfo *services.NodeInfo,
+	idempotency *services.IdempotencyKeys,
+	drift *services.CollectionDrift,
+	media *services.Media,
+	domains *services.Domains,
+	blocks *services.Blocks,
+	emoji *services.Emoji,
+	invites *services.Invites,
+	reports *services.Reports,
+	relays *services.Relays,
+	sharedInboxes *services.SharedInboxes,
 	any *services.Any,
 	m []models.Model) {
 	us := &models.Users{}
@@ -299,8 +513,23 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 	fn := &models.Following{}
 	fr := &models.Followers{}
 	li := &models.Liked{}
+	ft := &models.FeaturedTags{}
+	fe := &models.Featured{}
 	po := &models.Policies{}
 	rs := &models.Resolutions{}
+	ik := &models.IdempotencyKeys{}
+	dr := &models.CollectionDrift{}
+	md := &models.Media{}
+	dm := &models.Domains{}
+	em := &models.Emoji{}
+	iv := &models.Invites{}
+	rp := &models.Reports{}
+	sh := &models.Shares{}
+	rl := &models.Replies{}
+	ip := &models.InboxProcessed{}
+	bl := &models.Blocks{}
+	ry := &models.Relays{}
+	si := &models.SharedInboxes{}
 	m = []models.Model{
 		us,
 		fd,
@@ -315,8 +544,23 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 		fn,
 		fr,
 		li,
+		ft,
+		fe,
 		po,
 		rs,
+		ik,
+		dr,
+		md,
+		dm,
+		em,
+		iv,
+		rp,
+		ip,
+		sh,
+		rl,
+		bl,
+		ry,
+		si,
 	}
 	cryp = &services.Crypto{
 		DB:    sqldb,
@@ -325,6 +569,7 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 	dAttempts = &services.DeliveryAttempts{
 		DB:               sqldb,
 		DeliveryAttempts: da,
+		Compress:         c.ActivityPubConfig.CompressDeliveryPayloads,
 	}
 	followers = &services.Followers{
 		DB:        sqldb,
@@ -338,10 +583,31 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 		DB:      sqldb,
 		Inboxes: in,
 	}
+	if c.DatabaseConfig.DeleteUnreferencedFedData {
+		inboxes.FedData = fd
+	}
 	liked = &services.Liked{
 		DB:    sqldb,
 		Liked: li,
 	}
+	featuredTags = &services.FeaturedTags{
+		DB:           sqldb,
+		FeaturedTags: ft,
+		Users:        us,
+	}
+	featured = &services.Featured{
+		DB:       sqldb,
+		Featured: fe,
+		MaxPins:  c.ActivityPubConfig.MaxPinnedObjects,
+	}
+	shares = &services.Shares{
+		DB:     sqldb,
+		Shares: sh,
+	}
+	replies = &services.Replies{
+		DB:      sqldb,
+		Replies: rl,
+	}
 	data = &services.Data{
 		DB:                    sqldb,
 		Hostname:              host,
@@ -351,8 +617,18 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 		Following:             following,
 		Followers:             followers,
 		Liked:                 liked,
+		FeaturedTags:          featuredTags,
+		Featured:              featured,
+		Shares:                shares,
+		Replies:               replies,
 		DefaultCollectionSize: c.DatabaseConfig.DefaultCollectionPageSize,
 		MaxCollectionPageSize: c.DatabaseConfig.MaxCollectionPageSize,
+		FollowersPageSizes:    pageSizes(c.DatabaseConfig.FollowersPageSizes()),
+		FollowingPageSizes:    pageSizes(c.DatabaseConfig.FollowingPageSizes()),
+		LikedPageSizes:        pageSizes(c.DatabaseConfig.LikedPageSizes()),
+		TombstoneLocal:        c.ActivityPubConfig.TombstoneDeletedLocalData,
+		HostAliases:           c.ServerConfig.HostAliases,
+		HostAliasWWW:          c.ServerConfig.HostAliasWWW,
 	}
 	oauth = &services.OAuth2{
 		DB:     sqldb,
@@ -361,8 +637,10 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 		Creds:  cd,
 	}
 	outboxes = &services.Outboxes{
-		DB:       sqldb,
-		Outboxes: ou,
+		DB:        sqldb,
+		Outboxes:  ou,
+		LocalData: ld,
+		PageSizes: pageSizes(c.DatabaseConfig.OutboxPageSizes()),
 	}
 	policies = &services.Policies{
 		Clock:       clock,
@@ -377,15 +655,20 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 		PrivateKeys: pk,
 	}
 	users = &services.Users{
-		App:         appl,
-		DB:          sqldb,
-		Users:       us,
-		PrivateKeys: pk,
-		Inboxes:     in,
-		Outboxes:    ou,
-		Followers:   fr,
-		Following:   fn,
-		Liked:       li,
+		App:                   appl,
+		DB:                    sqldb,
+		Users:                 us,
+		PrivateKeys:           pk,
+		Inboxes:               in,
+		Outboxes:              ou,
+		Followers:             fr,
+		Following:             fn,
+		Liked:                 li,
+		FeaturedTags:          ft,
+		Featured:              fe,
+		KeyType:               c.ActivityPubConfig.HttpSignaturesConfig.KeyType,
+		MaxProfileFields:      c.ActivityPubConfig.MaxProfileFields,
+		MaxProfileFieldLength: c.ActivityPubConfig.MaxProfileFieldLength,
 	}
 	nodeinfo = &services.NodeInfo{
 		DB:               sqldb,
@@ -394,17 +677,149 @@ func createModelsAndServices(c *config.Config, sqldb *sql.DB, d models.SqlDialec
 		Rand:             rand.New(rand.NewSource(time.Now().UnixNano())),
 		CacheInvalidated: time.Second * time.Duration(c.NodeInfoConfig.AnonymizedStatsCacheInvalidatedSeconds),
 	}
+	idempotency = &services.IdempotencyKeys{
+		DB:              sqldb,
+		IdempotencyKeys: ik,
+		InboxProcessed:  ip,
+	}
+	drift = &services.CollectionDrift{
+		DB:              sqldb,
+		CollectionDrift: dr,
+		Inboxes:         in,
+		Outboxes:        ou,
+		Followers:       fr,
+		Following:       fn,
+		Liked:           li,
+		FeaturedTags:    ft,
+		Featured:        fe,
+		Users:           us,
+	}
+	media = &services.Media{
+		Scheme:              scheme,
+		Host:                host,
+		DB:                  sqldb,
+		Media:               md,
+		MaxSize:             c.MediaConfig.MaxSizeBytes,
+		AllowedContentTypes: c.MediaConfig.AllowedContentTypes,
+		DefaultThumbnailDim: c.MediaConfig.DefaultThumbnailDim,
+		MaxThumbnailDim:     c.MediaConfig.MaxThumbnailDim,
+	}
+	domains = &services.Domains{
+		DB:        sqldb,
+		Domains:   dm,
+		Allowlist: c.ActivityPubConfig.FederationMode == config.FederationModeAllowlist,
+		Blocklist: c.ActivityPubConfig.FederationMode == config.FederationModeBlocklist,
+	}
+	blocks = &services.Blocks{
+		DB:        sqldb,
+		Blocks:    bl,
+		Followers: fr,
+	}
+	emoji = &services.Emoji{
+		Scheme: scheme,
+		Host:   host,
+		DB:     sqldb,
+		Emoji:  em,
+	}
+	invites = &services.Invites{
+		DB:      sqldb,
+		Invites: iv,
+	}
+	reports = &services.Reports{
+		DB:      sqldb,
+		Reports: rp,
+	}
+	relays = &services.Relays{
+		DB:     sqldb,
+		Relays: ry,
+	}
+	sharedInboxes = &services.SharedInboxes{
+		DB:            sqldb,
+		SharedInboxes: si,
+	}
 	any = &services.Any{
 		DB: sqldb,
 	}
 	return
 }
 
+// newReadReplicas opens each configured read replica, preparing a separate set
+// of models and services against each one.
+func newReadReplicas(c *config.Config, d models.SqlDialect, appl app.Application, host, scheme string, clock pub.Clock) (dbs []*sql.DB, rs []*ap.ReadReplica, ml []models.Model, err error) {
+	for _, u := range c.DatabaseConfig.ReadReplicaURLs {
+		if len(u) == 0 {
+			continue
+		}
+		var rdb *sql.DB
+		rdb, err = db.NewReadReplicaDB(c, u)
+		if err != nil {
+			return
+		}
+		dbs = append(dbs, rdb)
+		_, data, _, followers, following, inboxes, liked, _, _, _, _, _, outboxes, _, _, _, _, _, _, _, _, _, _, _, _, _, _, _, m := createModelsAndServices(c, rdb, d, appl, host, scheme, clock)
+		err = prepare(m, rdb, d)
+		if err != nil {
+			return
+		}
+		ml = append(ml, m...)
+		rs = append(rs, &ap.ReadReplica{
+			Inboxes:   inboxes,
+			Outboxes:  outboxes,
+			Data:      data,
+			Followers: followers,
+			Following: following,
+			Liked:     liked,
+		})
+	}
+	return
+}
+
+func pageSizes(def, max int) services.PageSizes {
+	return services.PageSizes{Default: def, Max: max}
+}
+
 func prepare(ml []models.Model, db *sql.DB, d models.SqlDialect) error {
-	for _, m := range ml {
-		if err := m.Prepare(db, d); err != nil {
-			return err
+	services.RegisterSqlDialect(db, d)
+	return models.PrepareAll(db, d, ml)
+}
+
+// onboarding waits for the users being onboarded when the server stops, before
+// the systems they may use are stopped.
+type onboarding struct {
+	u *services.Users
+}
+
+func (o onboarding) Start() {}
+
+func (o onboarding) Stop() {
+	o.u.WaitForOnboarding()
+}
+
+// newMediaStorage creates the configured storage for the contents of uploaded
+// media.
+func newMediaStorage(c *config.Config) (services.Storage, error) {
+	mc := c.MediaConfig
+	switch mc.StorageKind {
+	case config.MediaStorageFilesystem:
+		return &services.FilesystemStorage{Root: mc.FilesystemRoot}, nil
+	case config.MediaStorageS3:
+		endpoint, err := url.Parse(mc.S3Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := ioutil.ReadFile(mc.S3SecretAccessKeyFile)
+		if err != nil {
+			return nil, err
 		}
+		return &services.S3Storage{
+			Client:          framework.NewHTTPClient(c),
+			Endpoint:        endpoint,
+			Bucket:          mc.S3Bucket,
+			Region:          mc.S3Region,
+			AccessKeyID:     mc.S3AccessKeyID,
+			SecretAccessKey: strings.TrimSpace(string(secret)),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown media storage kind: %s", mc.StorageKind)
 	}
-	return nil
 }
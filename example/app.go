@@ -58,6 +58,7 @@ const (
 var _ app.Application = &App{}
 var _ app.S2SApplication = &App{}
 var _ app.C2SApplication = &App{}
+var _ app.ScopedApplication = &App{}
 
 var fm template.FuncMap = map[string]interface{}{
 	"seq": func(n int) []int {
@@ -78,12 +79,16 @@ var fm template.FuncMap = map[string]interface{}{
 type App struct {
 	// startTime is set when Start is called
 	startTime time.Time
-	templates *template.Template
+	templates *app.TemplateProvider
 }
 
 // newApplication creates a new App for the framework to use.
 func newApplication(glob string) (*App, error) {
-	t, err := template.New("").Funcs(fm).ParseGlob(glob)
+	p, err := app.ReloadableTemplates(glob, fm)
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.Templates()
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +97,7 @@ func newApplication(glob string) (*App, error) {
 		util.InfoLogger.Infof("%s", tp.Name())
 	}
 	return &App{
-		templates: t,
+		templates: p,
 	}, nil
 }
 
@@ -129,9 +134,11 @@ func (a *App) NewConfiguration() interface{} {
 // NewConfiguration, and allows us to save a copy of the values that an
 // administrator has configured for our software.
 //
-// Note we don't do anything with the configuration values in this example
-// application. But don't let that stop your imagination from taking off!
+// Note we don't do anything with our own configuration values in this example
+// application. But don't let that stop your imagination from taking off! We do
+// reload our templates when they change while in development mode.
 func (a *App) SetConfiguration(i interface{}, c app.APCoreConfig, debug bool) error {
+	a.templates.SetReload(c.DevMode())
 	return nil
 }
 
@@ -174,7 +181,7 @@ func (a *App) InternalServerErrorHandler(f app.Framework) http.Handler {
 			util.ErrorLogger.Errorf("Error getting session: %v", err)
 		}
 		w.WriteHeader(http.StatusInternalServerError)
-		err = a.templates.ExecuteTemplate(w, internalErrorTemplate, a.getTemplateData(s, nil))
+		err = a.templates.ExecuteTemplate(w, internalErrorTemplate, a.getTemplateData(r, f, s, nil))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving InternalServerErrorHandler: %v", err)
 		}
@@ -207,7 +214,12 @@ func (a *App) GetLoginWebHandlerFunc(f app.Framework) http.HandlerFunc {
 // for the user to approve in the OAuth2 flow.
 func (a *App) GetAuthWebHandlerFunc(f app.Framework) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		a.getSessionWriteTemplateHelper(w, r, f, http.StatusOK, authTemplate, nil, "GetAuthWebHandlerFunc")
+		scopes, err := f.RequestedScopes(r)
+		if err != nil {
+			a.BadRequestHandler(f).ServeHTTP(w, r)
+			return
+		}
+		a.getSessionWriteTemplateHelper(w, r, f, http.StatusOK, authTemplate, scopes, "GetAuthWebHandlerFunc")
 	}
 }
 
@@ -308,13 +320,13 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			a.InternalServerErrorHandler(f).ServeHTTP(w, r)
 			return
 		}
-		notes, err := getLatestPublicNotes(r.Context(), db)
+		notes, _, err := f.PublicTimeline(r.Context(), app.FederatedTimeline, []string{"Note"}, 10, nil)
 		if err != nil {
 			util.ErrorLogger.Errorf("Error getting latest notes: %v", err)
 			a.InternalServerErrorHandler(f).ServeHTTP(w, r)
 			return
 		}
-		err = a.templates.ExecuteTemplate(w, homeTemplate, a.getTemplateData(s, notes))
+		err = a.templates.ExecuteTemplate(w, homeTemplate, a.getTemplateData(r, f, s, notes))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving home template: %v", err)
 		}
@@ -332,7 +344,7 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			a.InternalServerErrorHandler(f).ServeHTTP(w, r)
 			return
 		}
-		err = a.templates.ExecuteTemplate(w, listUsersTemplate, a.getTemplateData(s, users))
+		err = a.templates.ExecuteTemplate(w, listUsersTemplate, a.getTemplateData(r, f, s, users))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving list users template: %v", err)
 		}
@@ -367,7 +379,7 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 		}
 		var notes []vocab.Type
 		if err != nil || !authd {
-			notes, err = getLatestPublicNotes(r.Context(), db)
+			notes, _, err = f.PublicTimeline(r.Context(), app.FederatedTimeline, []string{"Note"}, 10, nil)
 		} else {
 			userIRI := f.UserIRI(userID)
 			notes, err = getLatestNotesAndMyPrivateNotes(r.Context(), db, userIRI.String())
@@ -377,7 +389,7 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			internalErrorHandler.ServeHTTP(w, r)
 			return
 		}
-		err = a.templates.ExecuteTemplate(w, listNotesTemplate, a.getTemplateData(s, notes))
+		err = a.templates.ExecuteTemplate(w, listNotesTemplate, a.getTemplateData(r, f, s, notes))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving list notes template: %v", err)
 		}
@@ -403,7 +415,7 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			return
 		}
 		// Render the webpage.
-		err = a.templates.ExecuteTemplate(w, createNoteTemplate, a.getTemplateData(s, nil))
+		err = a.templates.ExecuteTemplate(w, createNoteTemplate, a.getTemplateData(r, f, s, nil))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving create note template: %v", err)
 		}
@@ -539,7 +551,7 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			internalErrorHandler.ServeHTTP(w, r)
 			return
 		}
-		err = a.templates.ExecuteTemplate(w, noteTemplate, a.getTemplateData(s, vt))
+		err = a.templates.ExecuteTemplate(w, noteTemplate, a.getTemplateData(r, f, s, vt))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving note template: %v", err)
 		}
@@ -604,7 +616,7 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			d = append(d, t)
 		}
 
-		err = a.templates.ExecuteTemplate(w, followersRequestTemplate, a.getTemplateData(s, d))
+		err = a.templates.ExecuteTemplate(w, followersRequestTemplate, a.getTemplateData(r, f, s, d))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving follower request template: %v", err)
 		}
@@ -680,7 +692,7 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			internalErrorHandler.ServeHTTP(w, r)
 			return
 		}
-		err = a.templates.ExecuteTemplate(w, followingCreateTemplate, a.getTemplateData(s, nil))
+		err = a.templates.ExecuteTemplate(w, followingCreateTemplate, a.getTemplateData(r, f, s, nil))
 		if err != nil {
 			util.ErrorLogger.Errorf("Error serving follower request template: %v", err)
 		}
@@ -739,7 +751,9 @@ func (a *App) BuildRoutes(r app.Router, db app.Database, f app.Framework) error
 			return
 		}
 
-		// TODO: Add to following collection
+		// The followed actor is not added to the following collection
+		// until it sends an Accept, so until then the Follow is listed
+		// in the user's PendingFollows.
 
 		iri := follow.GetJSONLDId().GetIRI()
 		http.Redirect(w, r, iri.String(), http.StatusFound)
@@ -827,25 +841,35 @@ func (a *App) ApplySocialCallbacks(swc *pub.SocialWrappedCallbacks) (others []in
 	return
 }
 
-// ScopePermitsPostOutbox ensures the OAuth2 token scope is "loggedin", which
-// is the only permission. Other applications can have more granular
-// authorization systems.
+// Scopes registers the OAuth2 scopes that third-party clients may request.
+// The "all" scope is also granted to users when they log in.
+func (a *App) Scopes() []app.Scope {
+	return []app.Scope{
+		{Name: "all", Description: "Full access to your account"},
+		{Name: "postOutbox", Description: "Post activities on your behalf"},
+		{Name: "getInbox", Description: "Read your private inbox"},
+		{Name: "getOutbox", Description: "Read your private outbox"},
+	}
+}
+
+// ScopePermitsPostOutbox ensures the OAuth2 token scope includes "postOutbox"
+// or "all". Other applications can have more granular authorization systems.
 func (a *App) ScopePermitsPostOutbox(scope string) (permitted bool, err error) {
-	return scope == "postOutbox" || scope == "all", nil
+	return app.ScopeIncludes(scope, "postOutbox") || app.ScopeIncludes(scope, "all"), nil
 }
 
-// ScopePermitsPrivateGetInbox ensures the OAuth2 token scope is "loggedin",
-// which is the only permission. Other applications can have more granular
-// authorization systems.
+// ScopePermitsPrivateGetInbox ensures the OAuth2 token scope includes
+// "getInbox" or "all". Other applications can have more granular authorization
+// systems.
 func (a *App) ScopePermitsPrivateGetInbox(scope string) (permitted bool, err error) {
-	return scope == "getInbox" || scope == "all", nil
+	return app.ScopeIncludes(scope, "getInbox") || app.ScopeIncludes(scope, "all"), nil
 }
 
-// ScopePermitsPrivateGetOutbox ensures the OAuth2 token scope is "loggedin",
-// which is the only permission. Other applications can have more granular
+// ScopePermitsPrivateGetOutbox ensures the OAuth2 token scope includes
+// "getOutbox" or "all". Other applications can have more granular
 // authorization systems.
 func (a *App) ScopePermitsPrivateGetOutbox(scope string) (permitted bool, err error) {
-	return scope == "getOutbox" || scope == "all", nil
+	return app.ScopeIncludes(scope, "getOutbox") || app.ScopeIncludes(scope, "all"), nil
 }
 
 // Software describes the current running software, based on the code. This
@@ -875,8 +899,8 @@ func (a *App) DefaultAdminPrivileges() interface{} {
 }
 
 // This is a helper function to generate common data needed in the web
-// templates.
-func (a *App) getTemplateData(s app.Session, other interface{}) map[string]interface{} {
+// templates, including the sitewide announcement while it is shown.
+func (a *App) getTemplateData(r *http.Request, f app.Framework, s app.Session, other interface{}) map[string]interface{} {
 	if vt, ok := other.(vocab.Type); ok {
 		svt, err := streams.Serialize(vt)
 		if err == nil {
@@ -924,6 +948,11 @@ func (a *App) getTemplateData(s app.Session, other interface{}) map[string]inter
 			m["User"] = user
 		}
 	}
+	if an, err := f.Announcement(r.Context()); err != nil {
+		util.ErrorLogger.Errorf("error fetching announcement for rendering: %s", err)
+	} else if an != nil {
+		m["Announcement"] = an.Text
+	}
 	return m
 }
 
@@ -935,7 +964,7 @@ func (a *App) getSessionWriteTemplateHelper(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	w.WriteHeader(code)
-	err = a.templates.ExecuteTemplate(w, tmpl, a.getTemplateData(s, data))
+	err = a.templates.ExecuteTemplate(w, tmpl, a.getTemplateData(r, f, s, data))
 	if err != nil {
 		util.ErrorLogger.Errorf("Error serving %s: %v", debug, err)
 	}
@@ -27,33 +27,6 @@ import (
 	"github.com/go-fed/apcore/util"
 )
 
-func getLatestPublicNotes(ctx context.Context, db app.Database) (notes []vocab.Type, err error) {
-	return getNotes(ctx, db, `WITH local_notes AS(
-  SELECT payload, create_time FROM %[1]slocal_data
-  WHERE payload->>'type' = 'Note' AND (
-    payload->'to' ? 'https://www.w3.org/ns/activitystreams#Public'
-    OR payload->'cc' ? 'https://www.w3.org/ns/activitystreams#Public')
-), fed_notes AS (
-  SELECT payload, create_time FROM %[1]sfed_data
-  WHERE payload->>'type' = 'Note' AND (
-    payload->'to' ? 'https://www.w3.org/ns/activitystreams#Public'
-    OR payload->'cc' ? 'https://www.w3.org/ns/activitystreams#Public')
-), unioned AS (
-SELECT payload, create_time FROM local_notes
-UNION
-SELECT payload, create_time FROM fed_notes
-), deduped AS (
-  SELECT
-    DISTINCT ON (payload->'id') payload,
-    create_time
-  FROM unioned
-  ORDER BY payload->'id'
-)
-SELECT payload FROM deduped
-ORDER BY create_time DESC
-LIMIT 10`)
-}
-
 func getLatestNotesAndMyPrivateNotes(ctx context.Context, db app.Database, userIRI string) (notes []vocab.Type, err error) {
 	return getNotes(ctx, db, `WITH local_notes AS(
   SELECT payload, create_time FROM %[1]slocal_data
@@ -18,6 +18,7 @@ package framework
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework/config"
@@ -30,6 +31,13 @@ const (
 	postgresDB = "postgres"
 )
 
+// DefaultConfig is the configuration with every default applied, for building
+// one in code instead of loading a file. At least the server host, its key and
+// static files, and the database connection remain to be set.
+func DefaultConfig(dbkind string) (*config.Config, error) {
+	return defaultConfig(dbkind)
+}
+
 func defaultConfig(dbkind string) (c *config.Config, err error) {
 	var dbc config.DatabaseConfig
 	dbc, err = defaultDatabaseConfig(dbkind)
@@ -42,17 +50,23 @@ func defaultConfig(dbkind string) (c *config.Config, err error) {
 		DatabaseConfig:    dbc,
 		ActivityPubConfig: defaultActivityPubConfig(),
 		NodeInfoConfig:    defaultNodeInfoConfig(),
+		MediaConfig:       defaultMediaConfig(),
+		DeliveryConfig:    defaultDeliveryConfig(),
+		SessionConfig:     defaultSessionConfig(),
 	}
 	return
 }
 
 func defaultServerConfig() config.ServerConfig {
 	return config.ServerConfig{
-		HttpsPort:      443,
-		CookieMaxAge:   86400,
-		SaltSize:       32,
-		BCryptStrength: bcrypt.DefaultCost,
-		RSAKeySize:     1024,
+		HttpsPort:            443,
+		CookieMaxAge:         86400,
+		SaltSize:             32,
+		BCryptStrength:       bcrypt.DefaultCost,
+		RSAKeySize:           1024,
+		ShutdownGraceSeconds: 30,
+		LivenessPath:         "/healthz",
+		ReadinessPath:        "/readyz",
 	}
 }
 
@@ -73,6 +87,17 @@ func defaultDatabaseConfig(dbkind string) (d config.DatabaseConfig, err error) {
 		DefaultCollectionPageSize: 10,
 		// This default is arbitrarily chosen
 		MaxCollectionPageSize: 200,
+		// This default is arbitrarily chosen
+		DriftCheckPeriodSeconds: 3600,
+		// This default is arbitrarily chosen
+		DriftCheckSampleSize: 50,
+		// This default is arbitrarily chosen
+		OutboxRetentionPeriodSeconds: 86400,
+		// This default is arbitrarily chosen
+		OutboxRetentionBatchSize:   500,
+		ReadReplicaFallback:        true,
+		EnsureCollectionsOnStart:   true,
+		EnsureInstanceActorOnStart: true,
 	}
 	if dbkind != postgresDB {
 		err = fmt.Errorf("unsupported database kind: %s", dbkind)
@@ -95,15 +120,39 @@ func defaultActivityPubConfig() config.ActivityPubConfig {
 		RetrySleepPeriod:                    300,
 		OutboundRateLimitPrunePeriodSeconds: 60,
 		OutboundRateLimitPruneAgeSeconds:    30,
+		VerifyPublicAddressing:              true,
+		ServeCollectionRoots:                true,
+		SignFetchesWithInstanceActor:        true,
+		BackfillCount:                       20,
+		TombstoneDeletedLocalData:           true,
+		FederationMode:                      config.FederationModeOpen,
+		MaxProfileFields:                    4,
+		MaxProfileFieldLength:               255,
+		MaxPinnedObjects:                    5,
+		PostRateLimitPerMinute:              30,
+		PostRateLimitPerHour:                300,
+		FetchTimeoutSeconds:                 30,
+		WebfingerCacheTTLSeconds:            3600,
+		WebfingerNegativeCacheTTLSeconds:    60,
+		WebfingerMaxAgeSeconds:              3600,
+		ObjectMaxAgeSeconds:                 300,
+		MaxDereferencesPerActivity:          100,
+		MaxRequestBodyBytes:                 1 << 20,
+		InboxProcessedRetentionHours:        168,
 	}
 }
 
 func defaultHttpSignaturesConfig() config.HttpSignaturesConfig {
 	return config.HttpSignaturesConfig{
-		Algorithms:      []string{"rsa-sha256", "rsa-sha512"},
-		DigestAlgorithm: "SHA-256",
-		GetHeaders:      []string{"(request-target)", "Date"},
-		PostHeaders:     []string{"(request-target)", "Date", "Digest"},
+		Algorithms:          []string{"rsa-sha256", "rsa-sha512"},
+		DigestAlgorithm:     "SHA-256",
+		GetHeaders:          []string{"(request-target)", "Date"},
+		PostHeaders:         []string{"(request-target)", "Date", "Digest"},
+		KeyType:             config.KeyTypeRSA,
+		MaxClockSkewSeconds: 300,
+		RejectReplays:       true,
+		KeyCacheTTLSeconds:  3600,
+		InboundPostHeaders:  []string{"(request-target)", "Digest"},
 	}
 }
 
@@ -117,7 +166,51 @@ func defaultNodeInfoConfig() config.NodeInfoConfig {
 		EnableNodeInfo2:                        true,
 		EnableAnonymousStatsSharing:            true,
 		AnonymizedStatsCacheInvalidatedSeconds: 86400,
+		EnableInstanceAPI:                      true,
+		MaxAgeSeconds:                          1800,
+	}
+}
+
+func defaultMediaConfig() config.MediaConfig {
+	return config.MediaConfig{
+		// This default is arbitrarily chosen
+		MaxSizeBytes:        10 * 1024 * 1024,
+		AllowedContentTypes: []string{"image/", "video/", "audio/"},
+		StorageKind:         config.MediaStorageFilesystem,
+		S3Region:            "us-east-1",
+		// These defaults are arbitrarily chosen
+		DefaultThumbnailDim: 400,
+		MaxThumbnailDim:     1280,
+	}
+}
+
+func defaultDeliveryConfig() config.DeliveryConfig {
+	return config.DeliveryConfig{
+		// These defaults are arbitrarily chosen
+		Workers:           8,
+		MaxPerHost:        2,
+		QueueSize:         1000,
+		StaleAfterSeconds: 600,
+	}
+}
+
+func defaultSessionConfig() config.SessionConfig {
+	return config.SessionConfig{
+		SameSite: config.SameSiteLax,
+	}
+}
+
+// fileDefaults is the configuration that a configuration file is mapped onto,
+// so that the settings it omits, such as those added since the file was
+// written, take their defaults instead of their zero values. It is empty when
+// the file's database kind is unsupported, which verifying then reports.
+func fileDefaults(cfg *ini.File) *config.Config {
+	kind := cfg.Section("database").Key("db_database_kind").String()
+	c, err := defaultConfig(kind)
+	if err != nil {
+		return &config.Config{}
 	}
+	return c
 }
 
 func LoadConfigFile(filename string, a app.Application, debug bool) (c *config.Config, err error) {
@@ -127,7 +220,7 @@ func LoadConfigFile(filename string, a app.Application, debug bool) (c *config.C
 	if err != nil {
 		return
 	}
-	c = &config.Config{}
+	c = fileDefaults(cfg)
 	err = cfg.MapTo(c)
 	if err != nil {
 		return
@@ -171,3 +264,56 @@ func SaveConfigFile(filename string, c *config.Config, others ...interface{}) er
 	}
 	return cfg.SaveTo(filename)
 }
+
+// CheckConfigFile loads the configuration file and reports every problem
+// found with it, without starting the server. The configuration is returned
+// if it could be loaded, even if it has problems.
+func CheckConfigFile(filename string, a app.Application, debug bool) (c *config.Config, problems []error) {
+	cfg, err := ini.Load(filename)
+	if err != nil {
+		problems = append(problems, err)
+		return
+	}
+	c = fileDefaults(cfg)
+	if err = cfg.MapTo(c); err != nil {
+		problems = append(problems, err)
+		return
+	}
+	for _, v := range []interface{ Verify() error }{
+		&c.ServerConfig,
+		&c.OAuthConfig,
+		&c.DatabaseConfig,
+		&c.ActivityPubConfig,
+		&c.NodeInfoConfig,
+		&c.MediaConfig,
+		&c.DeliveryConfig,
+		&c.SessionConfig,
+	} {
+		if err := v.Verify(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if err := c.VerifyPathTemplates(); err != nil {
+		problems = append(problems, err)
+	}
+	if len(c.ServerConfig.StaticRootDirectory) > 0 {
+		if fi, err := os.Stat(c.ServerConfig.StaticRootDirectory); err != nil {
+			problems = append(problems, fmt.Errorf("sr_static_root_directory cannot be accessed: %s", err))
+		} else if !fi.IsDir() {
+			problems = append(problems, fmt.Errorf("sr_static_root_directory is not a directory: %s", c.ServerConfig.StaticRootDirectory))
+		}
+	}
+	// The application parses its own configuration, which is where it
+	// typically loads and parses its templates.
+	appCfg := a.NewConfiguration()
+	if appCfg != nil {
+		if err = cfg.MapTo(appCfg); err != nil {
+			problems = append(problems, fmt.Errorf("application configuration: %s", err))
+			return
+		}
+	}
+	if err = a.SetConfiguration(appCfg, c, debug); err != nil {
+		problems = append(problems, fmt.Errorf("application configuration: %s", err))
+	}
+	return
+}
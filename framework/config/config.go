@@ -23,27 +23,43 @@ type Config struct {
 	DatabaseConfig    DatabaseConfig    `ini:"database" comment:"Database configuration"`
 	ActivityPubConfig ActivityPubConfig `ini:"activitypub" comment:"ActivityPub configuration"`
 	NodeInfoConfig    NodeInfoConfig    `ini:"nodeinfo" comment:"NodeInfo configuration"`
+	MediaConfig       MediaConfig       `ini:"media" comment:"Media upload configuration"`
+	DeliveryConfig    DeliveryConfig    `ini:"delivery" comment:"Outbound delivery configuration"`
+	SessionConfig     SessionConfig     `ini:"session" comment:"Session cookie configuration"`
 }
 
 // Configuration section specifically for the HTTP server.
 type ServerConfig struct {
-	Host                        string `ini:"sr_host" comment:"(required) Host with TLD for this instance (basically, the fully qualified domain or subdomain); ignored in debug mode"`
-	HttpsPort                   int    `ini:"sr_https_port" comment:"(default: 443) Port to serve HTTPS requests on"`
-	CertFile                    string `ini:"sr_cert_file" comment:"(required) Path to the certificate file used to establish TLS connections for HTTPS"`
-	KeyFile                     string `ini:"sr_key_file" comment:"(required) Path to the private key file used to establish TLS connections for HTTPS"`
-	CookieAuthKeyFile           string `ini:"sr_cookie_auth_key_file" comment:"(required) Path to private key file used for cookie authentication"`
-	CookieEncryptionKeyFile     string `ini:"sr_cookie_encryption_key_file" comment:"Path to private key file used for cookie encryption"`
-	CookieMaxAge                int    `ini:"sr_cookie_max_age" comment:"(default: 86400 seconds) Number of seconds a cookie is valid; 0 indicates no Max-Age (browser-dependent, usually session-only); negative value is invalid"`
-	CookieSessionName           string `ini:"sr_cookie_session_name" comment:"(required) Cookie session name to use for the application"`
-	HttpsReadTimeoutSeconds     int    `ini:"sr_https_read_timeout_seconds" comment:"Timeout in seconds for incoming HTTPS requests; a zero or unset value does not timeout"`
-	HttpsWriteTimeoutSeconds    int    `ini:"sr_https_write_timeout_seconds" comment:"Timeout in seconds for outgoing HTTPS responses; a zero or unset value does not timeout"`
-	HttpClientTimeoutSeconds    int    `ini:"sr_http_client_timeout_seconds" comment:"Timeout in seconds for outgoing HTTP requests; a zero or unset value does not timeout"`
-	RedirectReadTimeoutSeconds  int    `ini:"sr_redirect_read_timeout_seconds" comment:"Timeout in seconds for incoming HTTP requests, which will be redirected to HTTPS; a zero or unset value does not timeout"`
-	RedirectWriteTimeoutSeconds int    `ini:"sr_redirect_write_timeout_seconds" comment:"Timeout in seconds for outgoing HTTP redirect-to-HTTPS responses; a zero or unset value does not timeout"`
-	StaticRootDirectory         string `ini:"sr_static_root_directory" comment:"(required) Root directory for serving static content, such as ECMAScript, CSS, favicon; !!!Warning: Everything in this directory will be served and accessible!!!"`
-	SaltSize                    int    `ini:"sr_salt_size" comment:"(default: 32) The size of salts to use with passwords when hashing, anything smaller than 16 will be treated as 16"`
-	BCryptStrength              int    `ini:"sr_bcrypt_strength" comment:"(default: 10) The hashing cost to use with the bcrypt hashing algorithm, between 4 and 31; the higher the cost, the slower the hash comparisons for passwords will take for attackers and regular users alike"`
-	RSAKeySize                  int    `ini:"sr_rsa_private_key_size" comment:"(default: 1024) The size of the RSA private key for a user; values less than 1024 are forbidden"`
+	Host                        string   `ini:"sr_host" comment:"(required) Host with TLD for this instance (basically, the fully qualified domain or subdomain); ignored in debug mode"`
+	HttpsPort                   int      `ini:"sr_https_port" comment:"(default: 443) Port to serve HTTPS requests on"`
+	CertFile                    string   `ini:"sr_cert_file" comment:"(required) Path to the certificate file used to establish TLS connections for HTTPS"`
+	KeyFile                     string   `ini:"sr_key_file" comment:"(required) Path to the private key file used to establish TLS connections for HTTPS"`
+	CookieAuthKeyFile           string   `ini:"sr_cookie_auth_key_file" comment:"(required) Path to private key file used for cookie authentication"`
+	CookieEncryptionKeyFile     string   `ini:"sr_cookie_encryption_key_file" comment:"Path to private key file used for cookie encryption"`
+	CookieMaxAge                int      `ini:"sr_cookie_max_age" comment:"(default: 86400 seconds) Number of seconds a cookie is valid; 0 indicates no Max-Age (browser-dependent, usually session-only); negative value is invalid"`
+	CookieSessionName           string   `ini:"sr_cookie_session_name" comment:"(required) Cookie session name to use for the application"`
+	HttpsReadTimeoutSeconds     int      `ini:"sr_https_read_timeout_seconds" comment:"Timeout in seconds for incoming HTTPS requests; a zero or unset value does not timeout"`
+	HttpsWriteTimeoutSeconds    int      `ini:"sr_https_write_timeout_seconds" comment:"Timeout in seconds for outgoing HTTPS responses; a zero or unset value does not timeout"`
+	HttpClientTimeoutSeconds    int      `ini:"sr_http_client_timeout_seconds" comment:"Timeout in seconds for outgoing HTTP requests; a zero or unset value does not timeout"`
+	RedirectReadTimeoutSeconds  int      `ini:"sr_redirect_read_timeout_seconds" comment:"Timeout in seconds for incoming HTTP requests, which will be redirected to HTTPS; a zero or unset value does not timeout"`
+	RedirectWriteTimeoutSeconds int      `ini:"sr_redirect_write_timeout_seconds" comment:"Timeout in seconds for outgoing HTTP redirect-to-HTTPS responses; a zero or unset value does not timeout"`
+	StaticRootDirectory         string   `ini:"sr_static_root_directory" comment:"(required) Root directory for serving static content, such as ECMAScript, CSS, favicon; !!!Warning: Everything in this directory will be served and accessible!!!"`
+	SaltSize                    int      `ini:"sr_salt_size" comment:"(default: 32) The size of salts to use with passwords when hashing, anything smaller than 16 will be treated as 16"`
+	BCryptStrength              int      `ini:"sr_bcrypt_strength" comment:"(default: 10) The hashing cost to use with the bcrypt hashing algorithm, between 4 and 31; the higher the cost, the slower the hash comparisons for passwords will take for attackers and regular users alike"`
+	RSAKeySize                  int      `ini:"sr_rsa_private_key_size" comment:"(default: 1024) The size of the RSA private key for a user; values less than 1024 are forbidden"`
+	ShutdownGraceSeconds        int      `ini:"sr_shutdown_grace_seconds" comment:"(default: 30) Time in seconds to let in-flight requests finish and pending deliveries flush when shutting down, after which remaining connections are forcibly closed; a zero value also waits 30 seconds; a negative value is invalid"`
+	LivenessPath                string   `ini:"sr_liveness_path" comment:"(default: /healthz) Path of the liveness endpoint, which responds 200 OK whenever the process is able to respond at all; an empty value disables it"`
+	ReadinessPath               string   `ini:"sr_readiness_path" comment:"(default: /readyz) Path of the readiness endpoint, which responds 200 OK once the server has started and while the database responds, and 503 Service Unavailable otherwise, including once the server is shutting down; an empty value disables it"`
+	TrustedProxies              []string `ini:"sr_trusted_proxies" comment:"Comma-separated list of CIDR ranges of reverse proxies whose X-Forwarded-Proto and X-Forwarded-Host headers are honored when determining the scheme and host of a request; headers from any other address are ignored; unset trusts no proxies"`
+	ReadOnly                    bool     `ini:"sr_read_only" comment:"(default: false) Whether to start in read-only mode, such as during a migration, in which requests that would write, such as inbox and outbox POSTs and registrations, are refused with 503 Service Unavailable while reads continue to be served, and periodic background work that writes, such as delivery retries and outbox retention, is paused; logging in and obtaining OAuth2 tokens remain possible, and administrators can toggle it at runtime"`
+	HostAliases                 []string `ini:"sr_host_aliases" comment:"Comma-separated list of other hosts this instance is reachable at, such as the apex domain or a previous domain after a migration, whose ActivityStreams data is treated as this instance's own; hosts are compared case-insensitively"`
+	HostAliasWWW                bool     `ini:"sr_host_alias_www" comment:"(default: false) Whether the \"www.\" subdomain of sr_host and of each of sr_host_aliases are also treated as this instance's own hosts"`
+	DevMode                     bool     `ini:"sr_dev_mode" comment:"(default: false) Whether to run in development mode, in which applications may opt into conveniences such as re-parsing their templates on each request so that changes to them are reflected without restarting; do not enable in production"`
+	Robots                      []string `ini:"sr_robots" comment:"Comma-separated list of path prefixes that crawlers are asked not to crawl by the built-in /robots.txt, such as /users/; unset disallows nothing; the built-in /robots.txt is not served when the application serves its own"`
+	RootRedirect                string   `ini:"sr_root_redirect" comment:"Path or URL to redirect requests for \"/\" to when the application does not serve \"/\" itself, such as a user's profile on a single-user instance; unset does not redirect"`
+	ServerName                  string   `ini:"sr_server_name" comment:"(default: sr_host) Name of this server recorded in the server profile when the instance actor is created; the init-db action prompts for the server profile instead"`
+	OpenRegistrations           bool     `ini:"sr_open_registrations" comment:"(default: false) Whether registrations are open to the public, recorded in the server profile when the instance actor is created; the init-db action prompts for the server profile instead"`
+	AllowFormatJSON             bool     `ini:"sr_allow_format_json" comment:"(default: false) Whether a GET request with the format=json query parameter but without an ActivityStreams Accept header is served ActivityStreams content as application/json, such as for viewing in a browser"`
 }
 
 type OAuth2Config struct {
@@ -53,13 +69,81 @@ type OAuth2Config struct {
 
 // Configuration section specifically for the database.
 type DatabaseConfig struct {
-	DatabaseKind              string         `ini:"db_database_kind" comment:"(required) Only \"postgres\" supported"`
-	ConnMaxLifetimeSeconds    int            `ini:"db_conn_max_lifetime_seconds" comment:"(default: indefinite) Maximum lifetime of a connection in seconds; a value of zero or unset value means indefinite"`
-	MaxOpenConns              int            `ini:"db_max_open_conns" comment:"(default: infinite) Maximum number of open connections to the database; a value of zero or unset value means infinite"`
-	MaxIdleConns              int            `ini:"db_max_idle_conns" comment:"(default: 2) Maximum number of idle connections in the connection pool to the database; a value of zero maintains no idle connections; a value greater than max_open_conns is reduced to be equal to max_open_conns"`
-	DefaultCollectionPageSize int            `ini:"db_default_collection_page_size" comment:"(default: 10) The default collection page size when fetching a page of an ActivityStreams collection"`
-	MaxCollectionPageSize     int            `ini:"db_max_collection_page_size" comment:"(default: 200) The maximum collection page size allowed when fetching a page of an ActivityStreams collection"`
-	PostgresConfig            PostgresConfig `ini:"db_postgres,omitempty" comment:"Only needed if database_kind is postgres, and values are based on the github.com/jackc/pgx driver"`
+	DatabaseKind                 string         `ini:"db_database_kind" comment:"(required) Only \"postgres\" supported"`
+	ConnMaxLifetimeSeconds       int            `ini:"db_conn_max_lifetime_seconds" comment:"(default: indefinite) Maximum lifetime of a connection in seconds; a value of zero or unset value means indefinite"`
+	MaxOpenConns                 int            `ini:"db_max_open_conns" comment:"(default: infinite) Maximum number of open connections to the database; a value of zero or unset value means infinite"`
+	MaxIdleConns                 int            `ini:"db_max_idle_conns" comment:"(default: 2) Maximum number of idle connections in the connection pool to the database; a value of zero maintains no idle connections; a value greater than max_open_conns is reduced to be equal to max_open_conns"`
+	DefaultCollectionPageSize    int            `ini:"db_default_collection_page_size" comment:"(default: 10) The default collection page size when fetching a page of an ActivityStreams collection"`
+	MaxCollectionPageSize        int            `ini:"db_max_collection_page_size" comment:"(default: 200) The maximum collection page size allowed when fetching a page of an ActivityStreams collection"`
+	InboxDefaultPageSize         int            `ini:"db_inbox_default_page_size" comment:"(default: db_default_collection_page_size) The default page size when fetching a page of an actor's inbox; zero or unset uses db_default_collection_page_size"`
+	InboxMaxPageSize             int            `ini:"db_inbox_max_page_size" comment:"(default: db_max_collection_page_size) The maximum page size allowed when fetching a page of an actor's inbox; zero or unset uses db_max_collection_page_size"`
+	OutboxDefaultPageSize        int            `ini:"db_outbox_default_page_size" comment:"(default: db_default_collection_page_size) The default page size when fetching a page of an actor's outbox; zero or unset uses db_default_collection_page_size"`
+	OutboxMaxPageSize            int            `ini:"db_outbox_max_page_size" comment:"(default: db_max_collection_page_size) The maximum page size allowed when fetching a page of an actor's outbox; zero or unset uses db_max_collection_page_size"`
+	FollowersDefaultPageSize     int            `ini:"db_followers_default_page_size" comment:"(default: db_default_collection_page_size) The default page size when fetching a page of an actor's followers; zero or unset uses db_default_collection_page_size"`
+	FollowersMaxPageSize         int            `ini:"db_followers_max_page_size" comment:"(default: db_max_collection_page_size) The maximum page size allowed when fetching a page of an actor's followers; zero or unset uses db_max_collection_page_size"`
+	FollowingDefaultPageSize     int            `ini:"db_following_default_page_size" comment:"(default: db_default_collection_page_size) The default page size when fetching a page of an actor's following; zero or unset uses db_default_collection_page_size"`
+	FollowingMaxPageSize         int            `ini:"db_following_max_page_size" comment:"(default: db_max_collection_page_size) The maximum page size allowed when fetching a page of an actor's following; zero or unset uses db_max_collection_page_size"`
+	LikedDefaultPageSize         int            `ini:"db_liked_default_page_size" comment:"(default: db_default_collection_page_size) The default page size when fetching a page of an actor's liked; zero or unset uses db_default_collection_page_size"`
+	LikedMaxPageSize             int            `ini:"db_liked_max_page_size" comment:"(default: db_max_collection_page_size) The maximum page size allowed when fetching a page of an actor's liked; zero or unset uses db_max_collection_page_size"`
+	DriftCheckPeriodSeconds      int            `ini:"db_drift_check_period_seconds" comment:"(default: 3600) The time period to await between periodically sampling collections to detect whether their totalItems has drifted from the number of items they contain, such as after a crash; a value of zero disables the check; a negative value is invalid"`
+	DriftCheckSampleSize         int            `ini:"db_drift_check_sample_size" comment:"(default: 50) The number of collections of each kind to sample each time the drift check runs; a negative value or zero value is invalid"`
+	DriftCheckRepair             bool           `ini:"db_drift_check_repair" comment:"(default: false) Whether to repair drifted collections found by the drift check, instead of only reporting them"`
+	OutboxRetentionDays          int            `ini:"db_outbox_retention_days" comment:"(default: 0) The age in days past which local activities are removed from their outbox and tombstoned, along with the objects they created, of which a Delete is delivered to followers; a value of zero disables outbox retention; a negative value is invalid"`
+	OutboxRetentionTombstone     bool           `ini:"db_outbox_retention_tombstone" comment:"(default: false) Whether to only replace expired outbox items and the objects they created with a Tombstone, instead of also copying them to the local_data_archive table"`
+	OutboxRetentionPeriodSeconds int            `ini:"db_outbox_retention_period_seconds" comment:"(default: 86400) The time period to await between periodically expiring outbox items; a negative value or zero value is invalid when outbox retention is enabled"`
+	OutboxRetentionBatchSize     int            `ini:"db_outbox_retention_batch_size" comment:"(default: 500) The maximum number of outbox items to expire each time outbox retention runs; a negative value or zero value is invalid when outbox retention is enabled"`
+	OutboxRetentionDryRun        bool           `ini:"db_outbox_retention_dry_run" comment:"(default: false) Whether to only log the outbox items that would expire, without changing them"`
+	EnsureCollectionsOnStart     bool           `ini:"db_ensure_collections_on_start" comment:"(default: true) Whether to create, when starting, an empty collection for every user missing any of its inbox, outbox, followers, following, liked, featured tags, or featured collections, such as after a partial migration, and to link the featured tags and featured collections from older actors"`
+	EnsureInstanceActorOnStart   bool           `ini:"db_ensure_instance_actor_on_start" comment:"(default: true) Whether to create, when starting, the instance actor that signs fetches and represents the server if it does not yet exist, with a server profile from sr_server_name and sr_open_registrations"`
+	DeleteUnreferencedFedData    bool           `ini:"db_delete_unreferenced_fed_data" comment:"(default: false) Whether to immediately delete federated data removed from an inbox when no inbox, outbox, or other collection still refers to it"`
+	ReadReplicaURLs              []string       `ini:"db_read_replica_urls" comment:"Comma-separated list of connection URLs of read replicas of the database; when set, queries fetching ActivityStreams collections and data to serve GET requests are spread across the replicas in turn, while writes and the reads made when processing activities go to the primary database"`
+	ReadReplicaFallback          bool           `ini:"db_read_replica_fallback" comment:"(default: true) Whether to retry a read against the primary database when it fails on a read replica, such as when the replica is unavailable or has not yet caught up"`
+	SlowQueryThresholdMs         int            `ini:"db_slow_query_threshold_ms" comment:"(default: 0) Queries taking longer than this many milliseconds to execute are logged along with their duration; zero or unset disables slow query logging; a negative value is invalid"`
+	StatementTimeoutMs           int            `ini:"db_statement_timeout_ms" comment:"(default: 0) Each database statement taking longer than this many milliseconds is cancelled and fails, so that a runaway query does not tie up a connection; operations known to take long, such as ensuring collections on start, are exempt; zero or unset disables the timeout; a negative value is invalid"`
+	PostgresConfig               PostgresConfig `ini:"db_postgres,omitempty" comment:"Only needed if database_kind is postgres, and values are based on the github.com/jackc/pgx driver"`
+}
+
+// pageSizes applies the global collection page sizes to any that are not
+// overridden for a particular kind of collection.
+func (c *DatabaseConfig) pageSizes(def, max int) (int, int) {
+	if max <= 0 {
+		max = c.MaxCollectionPageSize
+	}
+	if def <= 0 {
+		def = c.DefaultCollectionPageSize
+	}
+	if def > max {
+		def = max
+	}
+	return def, max
+}
+
+// InboxPageSizes returns the default and maximum page sizes of inboxes.
+func (c *DatabaseConfig) InboxPageSizes() (def, max int) {
+	return c.pageSizes(c.InboxDefaultPageSize, c.InboxMaxPageSize)
+}
+
+// OutboxPageSizes returns the default and maximum page sizes of outboxes.
+func (c *DatabaseConfig) OutboxPageSizes() (def, max int) {
+	return c.pageSizes(c.OutboxDefaultPageSize, c.OutboxMaxPageSize)
+}
+
+// FollowersPageSizes returns the default and maximum page sizes of followers
+// collections.
+func (c *DatabaseConfig) FollowersPageSizes() (def, max int) {
+	return c.pageSizes(c.FollowersDefaultPageSize, c.FollowersMaxPageSize)
+}
+
+// FollowingPageSizes returns the default and maximum page sizes of following
+// collections.
+func (c *DatabaseConfig) FollowingPageSizes() (def, max int) {
+	return c.pageSizes(c.FollowingDefaultPageSize, c.FollowingMaxPageSize)
+}
+
+// LikedPageSizes returns the default and maximum page sizes of liked
+// collections.
+func (c *DatabaseConfig) LikedPageSizes() (def, max int) {
+	return c.pageSizes(c.LikedDefaultPageSize, c.LikedMaxPageSize)
 }
 
 // Configuration section specifically for ActivityPub.
@@ -75,20 +159,63 @@ type ActivityPubConfig struct {
 	RetryPageSize                       int                  `ini:"ap_retry_page_size" comment:"(default: 25) The number of retryable deliveries to request from the database at a time; a negative value or zero value is invalid"`
 	RetryAbandonLimit                   int                  `ini:"ap_retry_abandon_limit" comment:"(default: 10) The maximum number of times the app will attempt to deliver an Activity to a federated peer and fail before permanently giving up and abandoning any further attempts to deliver it; a negative value or zero value is invalid"`
 	RetrySleepPeriod                    int                  `ini:"ap_retry_sleep_period_seconds" comment:"(default: 300) The time period to await between making periodic attempts to re-deliver Activities to federated peers that have never been successfully delivered; a 300-second retry sleep period with an abandon limit of 10 results in an exponential backoff of 10 delivery attempts across roughly 3 days; a negative value or zero value is invalid"`
+	CompressDeliveryPayloads            bool                 `ini:"ap_compress_delivery_payloads" comment:"(default: false) Whether to gzip-compress the payloads of delivery attempts stored for retrying, which reduces storage for large activities and long retention; existing payloads are read regardless of this setting"`
+	VerifyPublicAddressing              bool                 `ini:"ap_verify_public_addressing" comment:"(default: true) Whether to re-check that every item served in a public inbox or outbox is addressed to the Public collection, excluding and logging any that are not; guards against leaking private posts should the database query misbehave"`
+	ServeCollectionRoots                bool                 `ini:"ap_serve_collection_roots" comment:"(default: true) Whether the followers, following, liked, and featured tags collections are served as their root, with totalItems and links to their first and last pages, when requested without a page query; otherwise the first page is served"`
+	BackfillCount                       int                  `ini:"ap_backfill_count" comment:"(default: 20) Number of recent public items fetched from the outbox of an actor when it accepts a user's Follow, so the user does not start with an empty timeline; zero disables backfilling"`
+	AuthorizedFetch                     bool                 `ini:"ap_authorized_fetch" comment:"(default: false) Whether ActivityPub GET requests must have a valid HTTP Signature, or be made by a logged-in client, to be served; unauthorized requests receive 401 Unauthorized. The instance actor is always served so peers can verify this server's own signed fetches. Also known as secure mode"`
+	SignFetchesWithInstanceActor        bool                 `ini:"ap_sign_fetches_with_instance_actor" comment:"(default: true) Whether fetches of remote actors and their keys are signed with the instance actor's key instead of the user's, so that peers requiring signed fetches can verify them without fetching the user's key in turn"`
+	TombstoneDeletedLocalData           bool                 `ini:"ap_tombstone_deleted_local_data" comment:"(default: true) Whether deleted local content is replaced with a Tombstone, which continues to be served at its IRI, instead of being removed so that fetching it results in Not Found"`
+	FederationMode                      string               `ini:"ap_federation_mode" comment:"(default: open) Which peers this server federates with: \"open\" federates with every domain, \"allowlist\" only with domains that have been allowed, and \"blocklist\" with every domain except those that have been blocked; refused domains are neither delivered to nor accepted in inboxes"`
+	MaxProfileFields                    int                  `ini:"ap_max_profile_fields" comment:"(default: 4) The maximum number of profile metadata fields, shown as name and value pairs on a user's profile, that a user may have; zero or unset uses the default; a negative value is invalid"`
+	MaxProfileFieldLength               int                  `ini:"ap_max_profile_field_length" comment:"(default: 255) The maximum length in characters of the name and of the value of a profile metadata field; zero or unset uses the default; a negative value is invalid"`
+	UserAgent                           string               `ini:"ap_user_agent" comment:"(default: the application's software name and version) The User-Agent header identifying this server in outbound federation requests, such as deliveries, fetches of actors and their keys, and webfinger lookups"`
+	FetchTimeoutSeconds                 int                  `ini:"ap_fetch_timeout_seconds" comment:"(default: 30) Timeout in seconds for outbound federation requests, such as deliveries, fetches of actors and their keys, and webfinger lookups, after which a slow peer is cut off; zero uses sr_http_client_timeout_seconds; a negative value is invalid"`
+	WebfingerCacheTTLSeconds            int                  `ini:"ap_webfinger_cache_ttl_seconds" comment:"(default: 3600) Number of seconds the actor IRI that a remote account handle resolves to with WebFinger is cached, so that resolving the same handle again does not repeat the lookup; zero disables caching; a negative value is invalid"`
+	WebfingerNegativeCacheTTLSeconds    int                  `ini:"ap_webfinger_negative_cache_ttl_seconds" comment:"(default: 60) Number of seconds a remote account handle that failed to resolve with WebFinger is remembered as failing, so that unresponsive hosts are not repeatedly asked; zero disables caching failures; a negative value is invalid"`
+	WebfingerMaxAgeSeconds              int                  `ini:"ap_webfinger_max_age_seconds" comment:"(default: 3600) The number of seconds that this server's webfinger responses may be cached by their requesters, as advertised with Cache-Control; responses also have an ETag so that repeated requests are answered with 304 Not Modified; zero omits Cache-Control; a negative value is invalid"`
+	ObjectMaxAgeSeconds                 int                  `ini:"ap_object_max_age_seconds" comment:"(default: 300) The number of seconds that public ActivityStreams objects served by this server may be cached by their requesters and CDNs, as advertised with Cache-Control; responses also have an ETag and Last-Modified so that conditional requests are answered with 304 Not Modified; non-public objects are never cached, and public ones only privately when authorized fetch is enabled; zero omits the max-age; a negative value is invalid"`
+	MaxDereferencesPerActivity          int                  `ini:"ap_max_dereferences_per_activity" comment:"(default: 100) The maximum number of remote fetches made while processing a single activity received in an inbox, such as when following a chain of replies, so that a maliciously deep or circular chain cannot cause a storm of fetches; an IRI is fetched at most once per activity regardless; zero means no limit; a negative value is invalid"`
+	FederateBlocks                      bool                 `ini:"ap_federate_blocks" comment:"(default: false) Whether a Block activity is sent to an actor that a user blocks, instead of the block only being kept on this server; either way, the blocked actor's activities are dropped from the user's inbox and it is removed from the user's followers. Applications supporting the social protocol never deliver Blocks, as that protocol forbids it"`
+	PostRateLimitPerMinute              int                  `ini:"ap_post_rate_limit_per_minute" comment:"(default: 30) The number of posts a user may make to their outbox in any minute, after which further posts are refused with 429 Too Many Requests until the minute rolls over, so that a compromised account cannot spam the fediverse; it can be overridden for each user; zero means no limit; a negative value is invalid"`
+	PostRateLimitPerHour                int                  `ini:"ap_post_rate_limit_per_hour" comment:"(default: 300) The number of posts a user may make to their outbox in any hour, after which further posts are refused with 429 Too Many Requests until the hour rolls over; it can be overridden for each user; zero means no limit; a negative value is invalid"`
+	MaxPinnedObjects                    int                  `ini:"ap_max_pinned_objects" comment:"(default: 5) The maximum number of objects, such as posts, that a user may pin to their profile in their featured collection; zero or unset uses the default; a negative value is invalid"`
+	InboxPathTemplate                   string               `ini:"ap_inbox_path_template" comment:"(default: /users/{user}/inbox) Path of each user's inbox, where {user} is replaced by the user's ID and must be exactly one segment of the path, such as /u/{user}/inbox; useful to keep the URL layout of a system being migrated from. It cannot be changed once users exist, since their inbox IRIs are stored and known to peers, and the server refuses to start if it was"`
+	OutboxPathTemplate                  string               `ini:"ap_outbox_path_template" comment:"(default: /users/{user}/outbox) Path of each user's outbox, where {user} is replaced by the user's ID and must be exactly one segment of the path, such as /u/{user}/outbox; useful to keep the URL layout of a system being migrated from. It cannot be changed once users exist, since their outbox IRIs are stored and known to peers, and the server refuses to start if it was"`
+	MaxRequestBodyBytes                 int                  `ini:"ap_max_request_body_bytes" comment:"(default: 1048576) The maximum size in bytes of the body of a request delivered to an inbox or posted to an outbox; larger requests are refused"`
+	InboxProcessedRetentionHours        int                  `ini:"ap_inbox_processed_retention_hours" comment:"(default: 168) Number of hours the ids of activities delivered to each inbox are remembered, so that a peer redelivering an activity within it does not have it processed twice; older ids are pruned hourly; zero remembers them forever; a negative value is invalid"`
 }
 
+// Modes restricting which domains are federated with.
+const (
+	FederationModeOpen      = "open"
+	FederationModeAllowlist = "allowlist"
+	FederationModeBlocklist = "blocklist"
+)
+
 // Configuration for HTTP Signatures.
 type HttpSignaturesConfig struct {
-	Algorithms      []string `ini:"http_sig_algorithms" comment:"(default: \"rsa-sha256,rsa-sha512\") Comma-separated list of algorithms used by the go-fed/httpsig library to sign outgoing HTTP signatures; the first algorithm in this list will be the one used to verify other peers' HTTP signatures"`
-	DigestAlgorithm string   `ini:"http_sig_digest_algorithm" comment:"(default: \"SHA-256\") RFC 3230 algorithm for use in signing header Digests"`
-	GetHeaders      []string `ini:"http_sig_get_headers" comment:"(default: \"(request-target),Date\") Comma-separated list of HTTP headers to sign in GET requests; must contain \"(request-target)\" and \"Date\""`
-	PostHeaders     []string `ini:"http_sig_post_headers" comment:"(default: \"(request-target),Date,Digest\") Comma-separated list of HTTP headers to sign in POST requests; must contain \"(request-target)\", \"Date\", and \"Digest\""`
+	Algorithms          []string `ini:"http_sig_algorithms" comment:"(default: \"rsa-sha256,rsa-sha512\") Comma-separated list of algorithms used by the go-fed/httpsig library to sign outgoing HTTP signatures; the first algorithm in this list will be the one used to verify other peers' HTTP signatures"`
+	DigestAlgorithm     string   `ini:"http_sig_digest_algorithm" comment:"(default: \"SHA-256\") RFC 3230 algorithm for use in signing header Digests"`
+	GetHeaders          []string `ini:"http_sig_get_headers" comment:"(default: \"(request-target),Date\") Comma-separated list of HTTP headers to sign in GET requests; must contain \"(request-target)\" and \"Date\""`
+	PostHeaders         []string `ini:"http_sig_post_headers" comment:"(default: \"(request-target),Date,Digest\") Comma-separated list of HTTP headers to sign in POST requests; must contain \"(request-target)\", \"Date\", and \"Digest\""`
+	KeyType             string   `ini:"http_sig_key_type" comment:"(default: rsa) Type of private key created for new users and the instance actor, either \"rsa\" or \"ed25519\"; every actor has an RSA key, which signs with the algorithms in http_sig_algorithms, while \"ed25519\" also creates an Ed25519 key that signs requests to peers once they have been seen signing with Ed25519, and existing keys are unaffected when this changes"`
+	MaxClockSkewSeconds int      `ini:"http_sig_max_clock_skew_seconds" comment:"(default: 300) Number of seconds that the creation time of an incoming HTTP Signature may differ from this server's time before the request is rejected"`
+	RejectReplays       bool     `ini:"http_sig_reject_replays" comment:"(default: true) Whether to remember the incoming HTTP Signatures that were accepted and reject requests reusing one of them while it is within the allowed clock skew"`
+	KeyCacheTTLSeconds  int      `ini:"http_sig_key_cache_ttl_seconds" comment:"(default: 3600) Number of seconds that a peer's public key, once its owner has been verified, is cached for verifying HTTP Signatures; a signature that fails to verify with a cached key is checked against a freshly fetched key, and zero disables caching"`
+	InboundPostHeaders  []string `ini:"http_sig_inbound_post_headers" comment:"(default: \"(request-target),Digest\") Comma-separated list of HTTP headers that the HTTP Signatures of incoming POST requests must sign; a signed \"Content-Digest\" satisfies \"Digest\", a digest must be signed even when this is empty, and a Digest or Content-Digest of a request must always match its body"`
 }
 
+// Types of private keys used to create HTTP Signatures.
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
 // Configuration section specifically for Postgres databases.
 type PostgresConfig struct {
-	DatabaseName            string `ini:"pg_db_name" comment:"(required) Database name"`
-	UserName                string `ini:"pg_user" comment:"(required) User to connect as (any password will be prompted)"`
+	DatabaseName            string `ini:"pg_db_name" comment:"(default: \"\") Database name; if empty, the PGDATABASE environment variable or the driver's default is used"`
+	UserName                string `ini:"pg_user" comment:"(default: \"\") User to connect as (any password will be prompted); if empty, the PGUSER environment variable or the operating system user is used, as peer authentication needs"`
 	Host                    string `ini:"pg_host" comment:"(default: localhost) The Postgres host to connect to"`
 	Port                    int    `ini:"pg_port" comment:"(default: 5432) The port to connect to"`
 	Password                string `ini:"password" comment:"The database password to use to connect"`
@@ -103,8 +230,59 @@ type PostgresConfig struct {
 
 // Configuration section specifically for NodeInfo.
 type NodeInfoConfig struct {
-	EnableNodeInfo                         bool `ini:"ni_enable_nodeinfo" comment:"(default: true) Whether to share basic server and software information at a somewhat-Fediverse-understood endpoint for public use; NodeInfo is upstream of the NodeInfo2 fork and in general admins will either wish to enable or disable both"`
-	EnableNodeInfo2                        bool `ini:"ni_enable_nodeinfo2" comment:"(default: true) Whether to share basic server, organization, and software information at a somewhat-Fediverse-understood endpoint for public use; NodeInfo2 is a fork of NodeInfo and in general admins will either wish to enable or disable both"`
-	EnableAnonymousStatsSharing            bool `ini:"ni_enable_anon_stats_sharing" comment:"(default: true) Whether to share anonymized statistics about user counts, counts of user activity over various periods of time, local post counts, and local comment counts to the public; for sufficiently small instances the statistics are always shared with noise introduced; if none of the NodeInfos are enabled then this option does nothing"`
-	AnonymizedStatsCacheInvalidatedSeconds int  `ini:"ni_anon_stats_cache_invalidated_seconds" comment:"(default: 86400) The number of seconds before the anonymized node statistics are refreshed and updated; in the meantime the existing values will be cached and served for this period of time"`
+	EnableNodeInfo                         bool   `ini:"ni_enable_nodeinfo" comment:"(default: true) Whether to share basic server and software information at a somewhat-Fediverse-understood endpoint for public use; NodeInfo is upstream of the NodeInfo2 fork and in general admins will either wish to enable or disable both"`
+	EnableNodeInfo2                        bool   `ini:"ni_enable_nodeinfo2" comment:"(default: true) Whether to share basic server, organization, and software information at a somewhat-Fediverse-understood endpoint for public use; NodeInfo2 is a fork of NodeInfo and in general admins will either wish to enable or disable both"`
+	EnableAnonymousStatsSharing            bool   `ini:"ni_enable_anon_stats_sharing" comment:"(default: true) Whether to share anonymized statistics about user counts, counts of user activity over various periods of time, local post counts, and local comment counts to the public; for sufficiently small instances the statistics are always shared with noise introduced; if none of the NodeInfos are enabled then this option does nothing"`
+	AnonymizedStatsCacheInvalidatedSeconds int    `ini:"ni_anon_stats_cache_invalidated_seconds" comment:"(default: 86400) The number of seconds before the anonymized node statistics are refreshed and updated; in the meantime the existing values will be cached and served for this period of time"`
+	EnableInstanceAPI                      bool   `ini:"ni_enable_instance_api" comment:"(default: true) Whether to share basic server information, software version, registration status, and the sitewide announcement as JSON at /api/v1/instance, which many clients and relays read instead of NodeInfo; anonymized statistics are included only if ni_enable_anon_stats_sharing is enabled"`
+	InstanceDescription                    string `ini:"ni_instance_description" comment:"(default: \"\") The description of this server shared at /api/v1/instance"`
+	InstanceContactEmail                   string `ini:"ni_instance_contact_email" comment:"(default: \"\") The contact email address shared at /api/v1/instance; if empty, the organization contact of the server profile is shared instead"`
+	MaxAgeSeconds                          int    `ini:"ni_max_age_seconds" comment:"(default: 1800) The number of seconds that NodeInfo responses may be cached by their requesters, as advertised with Cache-Control, so that aggressive scrapers can be served from caches; responses also have an ETag so that repeated requests are answered with 304 Not Modified; zero omits Cache-Control; a negative value is invalid"`
+}
+
+// Kinds of storage for uploaded media.
+const (
+	MediaStorageFilesystem = "filesystem"
+	MediaStorageS3         = "s3"
+)
+
+// Configuration section specifically for uploaded media.
+type MediaConfig struct {
+	EnableMedia           bool     `ini:"md_enable_media" comment:"(default: false) Whether users may upload media, such as images to attach to their notes, which are then served at /media/{id}"`
+	MaxSizeBytes          int64    `ini:"md_max_size_bytes" comment:"(default: 10485760) The largest size in bytes of an uploaded media file; zero or negative values are invalid"`
+	AllowedContentTypes   []string `ini:"md_allowed_content_types" comment:"(default: image/,video/,audio/) Comma-separated list of prefixes of the content types that may be uploaded, as determined from the uploaded contents; unset allows all content types"`
+	StorageKind           string   `ini:"md_storage_kind" comment:"(default: filesystem) Where uploaded media is stored: either \"filesystem\" or \"s3\" for an S3-compatible object store"`
+	FilesystemRoot        string   `ini:"md_filesystem_root" comment:"(required for filesystem storage) Directory in which uploaded media is stored; it must not be the static root directory"`
+	S3Endpoint            string   `ini:"md_s3_endpoint" comment:"(required for s3 storage) URL of the S3-compatible object store, such as https://s3.us-east-1.amazonaws.com"`
+	S3Bucket              string   `ini:"md_s3_bucket" comment:"(required for s3 storage) Name of the bucket in which uploaded media is stored"`
+	S3Region              string   `ini:"md_s3_region" comment:"(default: us-east-1) Region of the bucket, used when signing requests"`
+	S3AccessKeyID         string   `ini:"md_s3_access_key_id" comment:"(required for s3 storage) Access key ID used to sign requests to the object store"`
+	S3SecretAccessKeyFile string   `ini:"md_s3_secret_access_key_file" comment:"(required for s3 storage) Path to the file containing the secret access key used to sign requests to the object store"`
+	DefaultThumbnailDim   int      `ini:"md_default_thumbnail_dimension" comment:"(default: 400) Largest width and height in pixels of image thumbnails served at /media/{id}/thumb when no size is requested"`
+	MaxThumbnailDim       int      `ini:"md_max_thumbnail_dimension" comment:"(default: 1280) Largest width and height in pixels that image thumbnails may be requested with; larger requested sizes are reduced to this"`
 }
+
+// Configuration section specifically for delivering activities to peers.
+type DeliveryConfig struct {
+	Workers           int `ini:"dl_workers" comment:"(default: 8) Number of workers delivering activities to peers' inboxes concurrently, so that posting an activity does not wait on its delivery; zero or unset uses the default; a negative value is invalid"`
+	MaxPerHost        int `ini:"dl_max_per_host" comment:"(default: 2) Maximum number of deliveries made to a single host at the same time, so that delivering to many recipients does not overwhelm one peer; zero or unset uses the default; a negative value is invalid"`
+	QueueSize         int `ini:"dl_queue_size" comment:"(default: 1000) Number of deliveries that may await a worker; deliveries beyond it are recorded as failed for the retrier to attempt later; zero or unset uses the default; a negative value is invalid"`
+	StaleAfterSeconds int `ini:"dl_stale_after_seconds" comment:"(default: 600) Seconds after which a delivery still awaiting its first attempt is considered lost, such as by a restart, and is attempted by the retrier instead; it should exceed the time a delivery may wait in the queue; zero or unset uses the default; a negative value is invalid"`
+}
+
+// Configuration section specifically for the session cookies of logged-in
+// users, in addition to the sr_cookie_* settings of the server.
+type SessionConfig struct {
+	SameSite                   string   `ini:"ss_same_site" comment:"(default: lax) The SameSite attribute of session cookies: \"lax\", \"strict\", or \"none\", which requires secure cookies"`
+	Domain                     string   `ini:"ss_domain" comment:"(default: sr_host) The Domain attribute of session cookies, such as a parent domain to share the session with its subdomains"`
+	InsecureCookies            bool     `ini:"ss_insecure_cookies" comment:"(default: false) Whether to omit the Secure attribute of session cookies, letting browsers send them over plain HTTP; cookies are always insecure in debug mode, which serves HTTP"`
+	PreviousAuthKeyFiles       []string `ini:"ss_previous_auth_key_files" comment:"Comma-separated list of paths to cookie authentication key files previously used as sr_cookie_auth_key_file, most recent first; sessions signed with them remain valid and are re-signed with the current key when next saved, so that keys can be rotated without logging out every user"`
+	PreviousEncryptionKeyFiles []string `ini:"ss_previous_encryption_key_files" comment:"Comma-separated list of paths to cookie encryption key files previously used as sr_cookie_encryption_key_file, each paired with the authentication key file at the same position in ss_previous_auth_key_files; leave unset if previous sessions were not encrypted"`
+}
+
+// Values of the SameSite attribute of session cookies.
+const (
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none"
+)
@@ -27,3 +27,7 @@ func (c *Config) ClockTimezone() string {
 func (c *Config) Schema() string {
 	return c.DatabaseConfig.PostgresConfig.Schema
 }
+
+func (c *Config) DevMode() bool {
+	return c.ServerConfig.DevMode
+}
@@ -19,6 +19,11 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/apcore/paths"
 )
 
 func (c *Config) Verify() error {
@@ -34,9 +39,30 @@ func (c *Config) Verify() error {
 	if err := c.ActivityPubConfig.Verify(); err != nil {
 		return err
 	}
+	if err := c.VerifyPathTemplates(); err != nil {
+		return err
+	}
 	if err := c.NodeInfoConfig.Verify(); err != nil {
 		return err
 	}
+	if err := c.MediaConfig.Verify(); err != nil {
+		return err
+	}
+	if err := c.DeliveryConfig.Verify(); err != nil {
+		return err
+	}
+	if err := c.SessionConfig.Verify(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// VerifyPathTemplates checks that the templates of users' inbox and outbox
+// paths are usable, and do not collide with the configured health check paths.
+func (c *Config) VerifyPathTemplates() error {
+	if err := paths.ValidateBoxPathTemplates(c.ActivityPubConfig.InboxPathTemplate, c.ActivityPubConfig.OutboxPathTemplate, c.ServerConfig.LivenessPath, c.ServerConfig.ReadinessPath); err != nil {
+		return fmt.Errorf("ap_inbox_path_template or ap_outbox_path_template is invalid: %s", err)
+	}
 	return nil
 }
 
@@ -62,6 +88,35 @@ func (c *ServerConfig) Verify() error {
 	if len(c.StaticRootDirectory) == 0 {
 		return errors.New("sr_static_root_directory is empty, but it is required")
 	}
+	if c.ShutdownGraceSeconds < 0 {
+		return fmt.Errorf("sr_shutdown_grace_seconds is negative, which is forbidden: %d", c.ShutdownGraceSeconds)
+	}
+	for _, h := range c.HostAliases {
+		if len(h) == 0 {
+			return errors.New("sr_host_aliases contains an empty host")
+		}
+	}
+	if len(c.LivenessPath) > 0 && !strings.HasPrefix(c.LivenessPath, "/") {
+		return fmt.Errorf("sr_liveness_path must begin with \"/\": %q", c.LivenessPath)
+	}
+	if len(c.ReadinessPath) > 0 && !strings.HasPrefix(c.ReadinessPath, "/") {
+		return fmt.Errorf("sr_readiness_path must begin with \"/\": %q", c.ReadinessPath)
+	}
+	for _, p := range c.Robots {
+		if p = strings.TrimSpace(p); len(p) > 0 && !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("sr_robots contains a path not beginning with \"/\": %q", p)
+		}
+	}
+	if c.RootRedirect == "/" {
+		return errors.New("sr_root_redirect is \"/\", which would redirect to itself")
+	}
+	for _, cidr := range c.TrustedProxies {
+		if cidr = strings.TrimSpace(cidr); len(cidr) == 0 {
+			continue
+		} else if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("sr_trusted_proxies contains an invalid CIDR range %q: %s", cidr, err)
+		}
+	}
 	const minKeySize = 1024
 	if c.RSAKeySize < minKeySize {
 		return fmt.Errorf("sr_rsa_private_key_size is configured to be < %d, which is forbidden: %d", minKeySize, c.RSAKeySize)
@@ -83,11 +138,45 @@ func (c *DatabaseConfig) Verify() error {
 	if len(c.DatabaseKind) == 0 {
 		return errors.New("db_database_kind is empty, but it is required")
 	}
-	if c.DatabaseKind == "postgres" {
-		if err := c.PostgresConfig.Verify(); err != nil {
-			return err
+	if c.DriftCheckPeriodSeconds < 0 {
+		return fmt.Errorf("db_drift_check_period_seconds is negative, which is forbidden: %d", c.DriftCheckPeriodSeconds)
+	}
+	if c.DriftCheckPeriodSeconds > 0 && c.DriftCheckSampleSize <= 0 {
+		return fmt.Errorf("db_drift_check_sample_size is zero or negative while db_drift_check_period_seconds is enabled, which is forbidden: %d", c.DriftCheckSampleSize)
+	}
+	if c.OutboxRetentionDays < 0 {
+		return fmt.Errorf("db_outbox_retention_days is negative, which is forbidden: %d", c.OutboxRetentionDays)
+	}
+	if c.OutboxRetentionDays > 0 && c.OutboxRetentionPeriodSeconds <= 0 {
+		return fmt.Errorf("db_outbox_retention_period_seconds is zero or negative while db_outbox_retention_days is enabled, which is forbidden: %d", c.OutboxRetentionPeriodSeconds)
+	}
+	if c.OutboxRetentionDays > 0 && c.OutboxRetentionBatchSize <= 0 {
+		return fmt.Errorf("db_outbox_retention_batch_size is zero or negative while db_outbox_retention_days is enabled, which is forbidden: %d", c.OutboxRetentionBatchSize)
+	}
+	for name, n := range map[string]int{
+		"db_inbox_default_page_size":     c.InboxDefaultPageSize,
+		"db_inbox_max_page_size":         c.InboxMaxPageSize,
+		"db_outbox_default_page_size":    c.OutboxDefaultPageSize,
+		"db_outbox_max_page_size":        c.OutboxMaxPageSize,
+		"db_followers_default_page_size": c.FollowersDefaultPageSize,
+		"db_followers_max_page_size":     c.FollowersMaxPageSize,
+		"db_following_default_page_size": c.FollowingDefaultPageSize,
+		"db_following_max_page_size":     c.FollowingMaxPageSize,
+		"db_liked_default_page_size":     c.LikedDefaultPageSize,
+		"db_liked_max_page_size":         c.LikedMaxPageSize,
+		"db_slow_query_threshold_ms":     c.SlowQueryThresholdMs,
+		"db_statement_timeout_ms":        c.StatementTimeoutMs,
+	} {
+		if n < 0 {
+			return fmt.Errorf("%s is negative, which is forbidden: %d", name, n)
 		}
 	}
+	if c.DatabaseKind != "postgres" {
+		return fmt.Errorf("db_database_kind is unsupported: %s", c.DatabaseKind)
+	}
+	if err := c.PostgresConfig.Verify(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -110,6 +199,53 @@ func (c *ActivityPubConfig) Verify() error {
 	if c.MaxDeliveryRecursionDepth < 0 {
 		return fmt.Errorf("ap_max_delivery_recursion_depth is negative, which is forbidden: %d", c.MaxDeliveryRecursionDepth)
 	}
+	if c.BackfillCount < 0 {
+		return fmt.Errorf("ap_backfill_count is negative, which is forbidden: %d", c.BackfillCount)
+	}
+	if c.MaxProfileFields < 0 {
+		return fmt.Errorf("ap_max_profile_fields is negative, which is forbidden: %d", c.MaxProfileFields)
+	}
+	if c.MaxProfileFieldLength < 0 {
+		return fmt.Errorf("ap_max_profile_field_length is negative, which is forbidden: %d", c.MaxProfileFieldLength)
+	}
+	if c.MaxPinnedObjects < 0 {
+		return fmt.Errorf("ap_max_pinned_objects is negative, which is forbidden: %d", c.MaxPinnedObjects)
+	}
+	if c.FetchTimeoutSeconds < 0 {
+		return fmt.Errorf("ap_fetch_timeout_seconds is negative, which is forbidden: %d", c.FetchTimeoutSeconds)
+	}
+	if c.MaxDereferencesPerActivity < 0 {
+		return fmt.Errorf("ap_max_dereferences_per_activity is negative, which is forbidden: %d", c.MaxDereferencesPerActivity)
+	}
+	if c.MaxRequestBodyBytes < 0 {
+		return fmt.Errorf("ap_max_request_body_bytes is negative, which is forbidden: %d", c.MaxRequestBodyBytes)
+	}
+	if c.InboxProcessedRetentionHours < 0 {
+		return fmt.Errorf("ap_inbox_processed_retention_hours is negative, which is forbidden: %d", c.InboxProcessedRetentionHours)
+	}
+	if c.WebfingerCacheTTLSeconds < 0 {
+		return fmt.Errorf("ap_webfinger_cache_ttl_seconds is negative, which is forbidden: %d", c.WebfingerCacheTTLSeconds)
+	}
+	if c.WebfingerNegativeCacheTTLSeconds < 0 {
+		return fmt.Errorf("ap_webfinger_negative_cache_ttl_seconds is negative, which is forbidden: %d", c.WebfingerNegativeCacheTTLSeconds)
+	}
+	if c.PostRateLimitPerMinute < 0 {
+		return fmt.Errorf("ap_post_rate_limit_per_minute is negative, which is forbidden: %d", c.PostRateLimitPerMinute)
+	}
+	if c.PostRateLimitPerHour < 0 {
+		return fmt.Errorf("ap_post_rate_limit_per_hour is negative, which is forbidden: %d", c.PostRateLimitPerHour)
+	}
+	if c.WebfingerMaxAgeSeconds < 0 {
+		return fmt.Errorf("ap_webfinger_max_age_seconds is negative, which is forbidden: %d", c.WebfingerMaxAgeSeconds)
+	}
+	if c.ObjectMaxAgeSeconds < 0 {
+		return fmt.Errorf("ap_object_max_age_seconds is negative, which is forbidden: %d", c.ObjectMaxAgeSeconds)
+	}
+	switch c.FederationMode {
+	case "", FederationModeOpen, FederationModeAllowlist, FederationModeBlocklist:
+	default:
+		return fmt.Errorf("ap_federation_mode must be %q, %q, or %q: %q", FederationModeOpen, FederationModeAllowlist, FederationModeBlocklist, c.FederationMode)
+	}
 	if c.RetryPageSize <= 0 {
 		return fmt.Errorf("ap_retry_page_size is zero or negative, which is forbidden: %d", c.RetryPageSize)
 	}
@@ -126,6 +262,17 @@ func (c *ActivityPubConfig) Verify() error {
 }
 
 func (c *HttpSignaturesConfig) Verify() error {
+	switch c.KeyType {
+	case "", KeyTypeRSA, KeyTypeEd25519:
+	default:
+		return fmt.Errorf("http_sig_key_type must be %q or %q: %q", KeyTypeRSA, KeyTypeEd25519, c.KeyType)
+	}
+	if c.MaxClockSkewSeconds < 0 {
+		return fmt.Errorf("http_sig_max_clock_skew_seconds is negative, which is forbidden: %d", c.MaxClockSkewSeconds)
+	}
+	if c.KeyCacheTTLSeconds < 0 {
+		return fmt.Errorf("http_sig_key_cache_ttl_seconds is negative, which is forbidden: %d", c.KeyCacheTTLSeconds)
+	}
 	return nil
 }
 
@@ -134,5 +281,82 @@ func (c *PostgresConfig) Verify() error {
 }
 
 func (c *NodeInfoConfig) Verify() error {
+	if c.MaxAgeSeconds < 0 {
+		return fmt.Errorf("ni_max_age_seconds is negative, which is forbidden: %d", c.MaxAgeSeconds)
+	}
+	return nil
+}
+
+func (c *MediaConfig) Verify() error {
+	if !c.EnableMedia {
+		return nil
+	}
+	if c.MaxSizeBytes <= 0 {
+		return fmt.Errorf("md_max_size_bytes must be positive: %d", c.MaxSizeBytes)
+	}
+	if c.MaxThumbnailDim <= 0 {
+		return fmt.Errorf("md_max_thumbnail_dimension must be positive: %d", c.MaxThumbnailDim)
+	} else if c.DefaultThumbnailDim <= 0 || c.DefaultThumbnailDim > c.MaxThumbnailDim {
+		return fmt.Errorf("md_default_thumbnail_dimension must be positive and at most md_max_thumbnail_dimension: %d", c.DefaultThumbnailDim)
+	}
+	switch c.StorageKind {
+	case MediaStorageFilesystem:
+		if len(c.FilesystemRoot) == 0 {
+			return errors.New("md_filesystem_root is empty, but it is required for filesystem storage")
+		}
+	case MediaStorageS3:
+		if len(c.S3Endpoint) == 0 {
+			return errors.New("md_s3_endpoint is empty, but it is required for s3 storage")
+		} else if u, err := url.Parse(c.S3Endpoint); err != nil {
+			return fmt.Errorf("md_s3_endpoint is not a valid URL: %s", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("md_s3_endpoint must be an http or https URL: %s", c.S3Endpoint)
+		}
+		if len(c.S3Bucket) == 0 {
+			return errors.New("md_s3_bucket is empty, but it is required for s3 storage")
+		}
+		if len(c.S3AccessKeyID) == 0 {
+			return errors.New("md_s3_access_key_id is empty, but it is required for s3 storage")
+		}
+		if len(c.S3SecretAccessKeyFile) == 0 {
+			return errors.New("md_s3_secret_access_key_file is empty, but it is required for s3 storage")
+		}
+	default:
+		return fmt.Errorf("md_storage_kind must be %q or %q: %q", MediaStorageFilesystem, MediaStorageS3, c.StorageKind)
+	}
+	return nil
+}
+
+func (c *DeliveryConfig) Verify() error {
+	if c.Workers < 0 {
+		return fmt.Errorf("dl_workers is negative, which is forbidden: %d", c.Workers)
+	} else if c.MaxPerHost < 0 {
+		return fmt.Errorf("dl_max_per_host is negative, which is forbidden: %d", c.MaxPerHost)
+	} else if c.QueueSize < 0 {
+		return fmt.Errorf("dl_queue_size is negative, which is forbidden: %d", c.QueueSize)
+	} else if c.StaleAfterSeconds < 0 {
+		return fmt.Errorf("dl_stale_after_seconds is negative, which is forbidden: %d", c.StaleAfterSeconds)
+	}
+	return nil
+}
+
+func (c *SessionConfig) Verify() error {
+	switch c.SameSite {
+	case "", SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		if c.InsecureCookies {
+			return errors.New("ss_same_site is \"none\", which requires ss_insecure_cookies to be false")
+		}
+	default:
+		return fmt.Errorf("ss_same_site is not \"lax\", \"strict\", or \"none\": %q", c.SameSite)
+	}
+	if len(c.PreviousEncryptionKeyFiles) > len(c.PreviousAuthKeyFiles) {
+		return fmt.Errorf("ss_previous_encryption_key_files has more files than ss_previous_auth_key_files: %d > %d", len(c.PreviousEncryptionKeyFiles), len(c.PreviousAuthKeyFiles))
+	}
+	for _, f := range c.PreviousAuthKeyFiles {
+		if len(strings.TrimSpace(f)) == 0 {
+			return errors.New("ss_previous_auth_key_files contains an empty path")
+		}
+	}
 	return nil
 }
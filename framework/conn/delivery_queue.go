@@ -0,0 +1,211 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package conn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/util"
+)
+
+// Defaults for the delivery queue when not configured.
+const (
+	defaultDeliveryWorkers    = 8
+	defaultDeliveryMaxPerHost = 2
+	defaultDeliveryQueueSize  = 1000
+	defaultDeliveryStaleAfter = 10 * time.Minute
+)
+
+// errDeliveryQueueFull is the failure recorded for a delivery that could not be
+// queued, which is left for the retrier to attempt later.
+var errDeliveryQueueFull = errors.New("delivery queue is full")
+
+// delivery is a single queued delivery to a host.
+type delivery struct {
+	host    string
+	deliver func(c context.Context)
+	fail    func(err error)
+}
+
+// hostSlots tracks the deliveries made to a host at the same time, and those
+// waiting for one of them to finish.
+type hostSlots struct {
+	active  int
+	waiting []delivery
+}
+
+// deliveryQueue is a bounded pool of workers making queued deliveries
+// concurrently, with at most maxPerHost deliveries to any one host at a time.
+//
+// A worker never waits on a busy host. The delivery is instead set aside until
+// a delivery to that host finishes, whose worker then makes it. Deliveries set
+// aside count against the queue size. Those lost before their outcome is
+// recorded, such as by a restart, are found by the retrier once stale.
+type deliveryQueue struct {
+	// Immutable
+	workers    int
+	maxPerHost int
+	maxWaiting int
+	flushGrace time.Duration
+	q          chan delivery
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	// Mutable
+	closed   bool
+	mu       sync.RWMutex
+	hosts    map[string]*hostSlots
+	nWaiting int
+	hMu      sync.Mutex
+}
+
+func newDeliveryQueue(c *config.Config) *deliveryQueue {
+	workers := c.DeliveryConfig.Workers
+	if workers <= 0 {
+		workers = defaultDeliveryWorkers
+	}
+	maxPerHost := c.DeliveryConfig.MaxPerHost
+	if maxPerHost <= 0 {
+		maxPerHost = defaultDeliveryMaxPerHost
+	}
+	size := c.DeliveryConfig.QueueSize
+	if size <= 0 {
+		size = defaultDeliveryQueueSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &deliveryQueue{
+		workers:    workers,
+		maxPerHost: maxPerHost,
+		maxWaiting: size,
+		flushGrace: time.Duration(c.ServerConfig.ShutdownGraceSeconds) * time.Second,
+		q:          make(chan delivery, size),
+		ctx:        ctx,
+		cancel:     cancel,
+		hosts:      make(map[string]*hostSlots),
+	}
+}
+
+func (d *deliveryQueue) Start() {
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+}
+
+// Stop refuses further deliveries, then lets the workers finish the queued
+// ones within the shutdown grace period. Deliveries still in progress after it
+// are cancelled.
+func (d *deliveryQueue) Stop() {
+	d.mu.Lock()
+	d.closed = true
+	close(d.q)
+	d.mu.Unlock()
+	util.InfoLogger.Infof("delivery queue flushing queued deliveries before shutdown")
+	ctx, cancel := util.GraceContext(d.flushGrace)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+}
+
+// Enqueue queues the delivery to the host, reporting whether it was queued. It
+// is not queued if the queue is full or stopped. A queued delivery that cannot
+// be made is instead reported to fail.
+func (d *deliveryQueue) Enqueue(host string, deliver func(c context.Context), fail func(err error)) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return false
+	}
+	select {
+	case d.q <- delivery{host: host, deliver: deliver, fail: fail}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *deliveryQueue) work() {
+	defer d.wg.Done()
+	for dl := range d.q {
+		ok := d.acquire(dl)
+		for ok {
+			dl.deliver(d.ctx)
+			dl, ok = d.release(dl.host)
+		}
+	}
+}
+
+// acquire takes a slot to deliver to the host, reporting false if there is
+// none free. The delivery is then set aside for the worker releasing the next
+// slot of the host, or failed if too many are already set aside.
+func (d *deliveryQueue) acquire(dl delivery) bool {
+	d.hMu.Lock()
+	h, ok := d.hosts[dl.host]
+	if !ok {
+		h = &hostSlots{}
+		d.hosts[dl.host] = h
+	}
+	if h.active < d.maxPerHost {
+		h.active++
+		d.hMu.Unlock()
+		return true
+	}
+	if d.nWaiting >= d.maxWaiting {
+		d.hMu.Unlock()
+		dl.fail(errDeliveryQueueFull)
+		return false
+	}
+	h.waiting = append(h.waiting, dl)
+	d.nWaiting++
+	d.hMu.Unlock()
+	return false
+}
+
+// release frees the slot acquired to deliver to the host. If a delivery to the
+// host is waiting, the slot is handed to it and it is returned to be made by
+// the caller.
+func (d *deliveryQueue) release(host string) (next delivery, ok bool) {
+	d.hMu.Lock()
+	defer d.hMu.Unlock()
+	h := d.hosts[host]
+	if len(h.waiting) > 0 {
+		next = h.waiting[0]
+		h.waiting[0] = delivery{}
+		h.waiting = h.waiting[1:]
+		d.nWaiting--
+		return next, true
+	}
+	h.active--
+	if h.active == 0 {
+		delete(d.hosts, host)
+	}
+	return
+}
@@ -0,0 +1,99 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package conn
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/httpsig"
+)
+
+const (
+	// peerAlgorithmsSize is the maximum number of peers whose algorithms
+	// are remembered.
+	peerAlgorithmsSize = 4096
+	// peerAlgorithmTTL is how long a peer is remembered to support an
+	// algorithm after it was last seen signing with it.
+	peerAlgorithmTTL = 7 * 24 * time.Hour
+)
+
+// peerAlgorithms remembers the hosts of peers that verify HTTP Signatures made
+// with algorithms that not every peer supports, having seen them sign with
+// those algorithms.
+type peerAlgorithms struct {
+	// Immutable
+	clock pub.Clock
+	// Mutable
+	m  map[peerAlgorithm]time.Time
+	mu sync.Mutex
+}
+
+type peerAlgorithm struct {
+	host string
+	alg  httpsig.Algorithm
+}
+
+func newPeerAlgorithms(clock pub.Clock) *peerAlgorithms {
+	return &peerAlgorithms{
+		clock: clock,
+		m:     make(map[peerAlgorithm]time.Time),
+	}
+}
+
+// Supports determines whether the host has been seen signing with the
+// algorithm recently enough.
+func (p *peerAlgorithms) Supports(host string, alg httpsig.Algorithm) bool {
+	k := peerAlgorithm{host: strings.ToLower(host), alg: alg}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	expires, ok := p.m[k]
+	if !ok {
+		return false
+	} else if !p.clock.Now().Before(expires) {
+		delete(p.m, k)
+		return false
+	}
+	return true
+}
+
+// Learn remembers that the host signs with the algorithm. When full, expired
+// entries are removed, followed by the entry closest to expiring.
+func (p *peerAlgorithms) Learn(host string, alg httpsig.Algorithm) {
+	k := peerAlgorithm{host: strings.ToLower(host), alg: alg}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	if _, ok := p.m[k]; !ok && len(p.m) >= peerAlgorithmsSize {
+		var oldest peerAlgorithm
+		var oldestExpires time.Time
+		for pa, expires := range p.m {
+			if !now.Before(expires) {
+				delete(p.m, pa)
+			} else if oldestExpires.IsZero() || expires.Before(oldestExpires) {
+				oldest = pa
+				oldestExpires = expires
+			}
+		}
+		if len(p.m) >= peerAlgorithmsSize {
+			delete(p.m, oldest)
+		}
+	}
+	p.m[k] = now.Add(peerAlgorithmTTL)
+}
@@ -0,0 +1,109 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package conn
+
+import (
+	"crypto"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/framework/config"
+)
+
+// publicKeyCacheSize is the maximum number of public keys that are cached.
+const publicKeyCacheSize = 4096
+
+// publicKeyCache caches the public keys of peers whose ownership has been
+// verified, so that every signed request from a peer does not require fetching
+// its key and owner again.
+type publicKeyCache struct {
+	// Immutable
+	clock pub.Clock
+	ttl   time.Duration
+	// Mutable
+	m  map[string]publicKeyEntry
+	mu sync.Mutex
+}
+
+type publicKeyEntry struct {
+	key     crypto.PublicKey
+	owner   *url.URL
+	expires time.Time
+}
+
+func newPublicKeyCache(c *config.Config, clock pub.Clock) *publicKeyCache {
+	return &publicKeyCache{
+		clock: clock,
+		ttl:   time.Duration(c.ActivityPubConfig.HttpSignaturesConfig.KeyCacheTTLSeconds) * time.Second,
+		m:     make(map[string]publicKeyEntry),
+	}
+}
+
+// Get obtains the cached public key and its owner, if it has not expired.
+func (p *publicKeyCache) Get(keyId *url.URL) (key crypto.PublicKey, owner *url.URL, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.m[keyId.String()]
+	if !ok {
+		return
+	} else if !p.clock.Now().Before(e.expires) {
+		delete(p.m, keyId.String())
+		return nil, nil, false
+	}
+	return e.key, e.owner, true
+}
+
+// Put caches the public key and its owner. When the cache is full, expired
+// keys are removed, followed by the key closest to expiring.
+func (p *publicKeyCache) Put(keyId *url.URL, key crypto.PublicKey, owner *url.URL) {
+	if p.ttl <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	if _, ok := p.m[keyId.String()]; !ok && len(p.m) >= publicKeyCacheSize {
+		var oldest string
+		var oldestExpires time.Time
+		for k, e := range p.m {
+			if !now.Before(e.expires) {
+				delete(p.m, k)
+			} else if len(oldest) == 0 || e.expires.Before(oldestExpires) {
+				oldest = k
+				oldestExpires = e.expires
+			}
+		}
+		if len(p.m) >= publicKeyCacheSize {
+			delete(p.m, oldest)
+		}
+	}
+	p.m[keyId.String()] = publicKeyEntry{
+		key:     key,
+		owner:   owner,
+		expires: now.Add(p.ttl),
+	}
+}
+
+// Invalidate removes the public key from the cache, such as when a peer may
+// have rotated it.
+func (p *publicKeyCache) Invalidate(keyId *url.URL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.m, keyId.String())
+}
@@ -18,6 +18,7 @@ package conn
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-fed/apcore/framework/config"
@@ -34,7 +35,11 @@ type retrier struct {
 	pageSize         int
 	abandonLimit     int
 	reattemptBackoff func(n int) time.Duration
+	staleAfter       time.Duration
+	flushGrace       time.Duration
 	retrierFn        *util.SafeStartStop
+	// paused, if set before starting, reports whether retrying is paused.
+	paused func() bool
 }
 
 func newRetrier(da *services.DeliveryAttempts, pk *services.PrivateKeys, tc *Controller, c *config.Config) *retrier {
@@ -44,6 +49,8 @@ func newRetrier(da *services.DeliveryAttempts, pk *services.PrivateKeys, tc *Con
 		tc:           tc,
 		pageSize:     c.ActivityPubConfig.RetryPageSize,
 		abandonLimit: c.ActivityPubConfig.RetryAbandonLimit,
+		staleAfter:   time.Duration(c.DeliveryConfig.StaleAfterSeconds) * time.Second,
+		flushGrace:   time.Duration(c.ServerConfig.ShutdownGraceSeconds) * time.Second,
 		reattemptBackoff: func(n int) time.Duration {
 			z := time.Duration(c.ActivityPubConfig.RetrySleepPeriod) * time.Second
 			// Exponential backoff
@@ -65,59 +72,79 @@ func (r *retrier) Start() {
 	r.retrierFn.Start()
 }
 
+// PauseWhile skips retrying, including when stopping, while paused reports
+// true.
+func (r *retrier) PauseWhile(paused func() bool) {
+	r.paused = paused
+	r.retrierFn.PauseWhile(paused)
+}
+
+// Stop halts the periodic retries, then makes a final attempt to deliver any
+// pending failures within the shutdown grace period.
 func (r *retrier) Stop() {
 	r.retrierFn.Stop()
+	if r.paused != nil && r.paused() {
+		return
+	}
+	ctx, cancel := util.GraceContext(r.flushGrace)
+	defer cancel()
+	util.InfoLogger.Infof("retrier flushing pending deliveries before shutdown")
+	r.retry(ctx)
 }
 
 func (r *retrier) retry(ctx context.Context) {
 	c := util.Context{ctx}
 	now := time.Now()
-	failures, err := r.da.FirstPageRetryableFailures(c, r.pageSize)
+	staleAfter := r.staleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultDeliveryStaleAfter
+	}
+	failures, err := r.da.FirstPageRetryableFailures(c, now.Add(-staleAfter), r.pageSize)
 	if err != nil {
 		util.ErrorLogger.Errorf("retrier failed to obtain first page: %s", err)
 		return
 	}
 	for len(failures) > 0 {
 		for _, failure := range failures {
+			// Observe shutdown.
+			if ctx.Err() != nil {
+				return
+			}
 			// Skip this if the retry attempt would be too soon;
 			// this applies a backoff function.
-			if failure.LastAttempt.Sub(now) < r.reattemptBackoff(failure.NAttempts) {
+			if now.Sub(failure.LastAttempt) < r.reattemptBackoff(failure.NAttempts) {
+				continue
+			}
+			// Abandon deliveries to domains that have since been
+			// refused.
+			if blocked, err := r.tc.isBlocked(ctx, failure.DeliverTo.Hostname()); err != nil {
+				util.ErrorLogger.Errorf("retrier failed to determine whether the recipient's domain is federated with: %s", err)
+				continue
+			} else if blocked {
+				err = r.tc.record(c, failure.ID, nil, fmt.Errorf("not delivering to a domain not federated with: %s", failure.DeliverTo), true)
+				util.InfoLogger.Infof("retrier abandoned delivery: %s", err)
 				continue
 			}
-			privKey, pubKeyID, err := r.pk.GetUserHTTPSignatureKey(c, paths.UUID(failure.UserID))
+			keys, err := r.pk.GetUserHTTPSignatureKeys(c, paths.UUID(failure.UserID))
 			if err != nil {
-				util.ErrorLogger.Errorf("retrier failed to obtain user's HTTP Signature key: %s", err)
+				util.ErrorLogger.Errorf("retrier failed to obtain user's HTTP Signature keys: %s", err)
 				continue
 			}
-			tp, err := r.tc.Get(privKey, pubKeyID.String())
+			tp, err := r.tc.get(keys)
 			if err != nil {
 				util.ErrorLogger.Errorf("retrier failed to obtain a transport for delivery: %s", err)
 				continue
 			}
-			// Attempt delivery and update its associated record.
-			err = tp.Deliver(ctx, failure.Payload, failure.DeliverTo)
+			// Attempt delivery and update its associated record,
+			// without creating another attempt.
+			signed, err := tp.post(ctx, failure.Payload, failure.DeliverTo)
+			err = r.tc.record(c, failure.ID, signed, err, failure.NAttempts >= r.abandonLimit)
 			if err != nil {
 				util.ErrorLogger.Errorf("retrier failed in an attempt to retry delivery: %s", err)
-				if failure.NAttempts >= r.abandonLimit {
-					err = r.da.MarkAbandonedAttempt(c, failure.ID)
-					if err != nil {
-						util.ErrorLogger.Errorf("retrier failed to mark attempt as abandoned: %s", err)
-					}
-				} else {
-					err = r.da.MarkRetryFailureAttempt(c, failure.ID)
-					if err != nil {
-						util.ErrorLogger.Errorf("retrier failed to mark attempt as failed: %s", err)
-					}
-				}
-			} else {
-				err = r.da.MarkSuccessfulAttempt(c, failure.ID)
-				if err != nil {
-					util.ErrorLogger.Errorf("retrier failed to mark attempt as successful: %s", err)
-				}
 			}
 		}
 		last := failures[len(failures)-1]
-		failures, err = r.da.NextPageRetryableFailures(c, last.ID, last.FetchTime, r.pageSize)
+		failures, err = r.da.NextPageRetryableFailures(c, last.ID, last.FetchTime, last.StaleTime, r.pageSize)
 		if err != nil {
 			util.ErrorLogger.Errorf("retrier failed to obtain the next page of retriable failures: %s", err)
 			return
@@ -20,24 +20,32 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework/config"
 	"github.com/go-fed/apcore/framework/web"
+	"github.com/go-fed/apcore/framework/webfinger"
+	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
 	"github.com/go-fed/httpsig"
+	"golang.org/x/crypto/ed25519"
 )
 
 const (
 	activityStreamsContentType = "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\""
+	webfingerContentType       = "application/jrd+json"
 )
 
 func containsRequiredHttpHeaders(method string, headers []string) error {
@@ -67,7 +75,18 @@ type Controller struct {
 	postHeaders []string
 	hl          *hostLimiter
 	rt          *retrier
+	dq          *deliveryQueue
 	da          *services.DeliveryAttempts
+	dm          *services.Domains
+	userAgent   string
+	wf          *WebfingerCache
+	keys        *publicKeyCache
+	peers       *peerAlgorithms
+	// contexts are the application's JSON-LD contexts, added to the
+	// payloads delivered.
+	contexts models.JSONLDContexts
+	// si remembers the shared inboxes advertised by peer actors.
+	si *services.SharedInboxes
 }
 
 func NewController(
@@ -76,7 +95,9 @@ func NewController(
 	clock pub.Clock,
 	client *http.Client,
 	da *services.DeliveryAttempts,
-	pk *services.PrivateKeys) (tc *Controller, err error) {
+	pk *services.PrivateKeys,
+	dm *services.Domains,
+	si *services.SharedInboxes) (tc *Controller, err error) {
 	if c.ActivityPubConfig.OutboundRateLimitQPS <= 0 {
 		err = fmt.Errorf("outbound rate limit qps is <= 0")
 		return
@@ -99,6 +120,18 @@ func NewController(
 		algos[i] = httpsig.Algorithm(algo)
 	}
 
+	// Outbound federation requests identify this server and are cut off
+	// when a peer is too slow.
+	userAgent := c.ActivityPubConfig.UserAgent
+	if len(userAgent) == 0 {
+		userAgent = web.UserAgent(a.Software())
+	}
+	if t := c.ActivityPubConfig.FetchTimeoutSeconds; t > 0 {
+		fc := *client
+		fc.Timeout = time.Duration(t) * time.Second
+		client = &fc
+	}
+
 	ct := &Controller{
 		a:           a,
 		clock:       clock,
@@ -109,42 +142,79 @@ func NewController(
 		postHeaders: c.ActivityPubConfig.HttpSignaturesConfig.PostHeaders,
 		hl:          newHostLimiter(c),
 		da:          da,
+		dm:          dm,
+		si:          si,
+		dq:          newDeliveryQueue(c),
+		userAgent:   userAgent,
+		wf:          NewWebfingerCache(c, clock),
+		keys:        newPublicKeyCache(c, clock),
+		peers:       newPeerAlgorithms(clock),
+	}
+	if jc, ok := a.(app.JSONLDContexter); ok {
+		ct.contexts = jc.JSONLDContexts()
 	}
 	ct.rt = newRetrier(da, pk, ct, c)
 	return ct, err
 }
 
+// applyContexts adds the application's JSON-LD contexts to the payload of a
+// delivery, as go-fed serializes activities without them.
+func (tc *Controller) applyContexts(b []byte) ([]byte, error) {
+	if len(tc.contexts) == 0 {
+		return b, nil
+	}
+	return tc.contexts.Apply(b)
+}
+
 func (tc *Controller) Start() {
 	tc.hl.Start()
+	tc.dq.Start()
 	tc.rt.Start()
 }
 
 func (tc *Controller) Stop() {
+	tc.dq.Stop()
 	tc.rt.Stop()
 	tc.hl.Stop()
 }
 
-func (tc *Controller) Get(
-	privKey crypto.PrivateKey,
-	pubKeyId string) (t pub.Transport, err error) {
-	var getSigner, postSigner httpsig.Signer
-	// TODO: Use config for expiration in seconds
-	getSigner, _, err = httpsig.NewSigner(tc.algs, tc.digestAlg, tc.getHeaders, httpsig.Signature, 60)
-	if err != nil {
-		return
-	}
-	postSigner, _, err = httpsig.NewSigner(tc.algs, tc.digestAlg, tc.postHeaders, httpsig.Signature, 60)
-	if err != nil {
-		return
+// PauseWhile pauses retrying failed deliveries while paused reports true, such
+// as in read-only mode. It must be called before Start.
+func (tc *Controller) PauseWhile(paused func() bool) {
+	tc.rt.PauseWhile(paused)
+}
+
+// Get creates a transport signing with the keys of a user, the first of which
+// is the RSA key that every peer can verify.
+func (tc *Controller) Get(keys []services.HTTPSignatureKey) (t pub.Transport, err error) {
+	return tc.get(keys)
+}
+
+func (tc *Controller) get(keys []services.HTTPSignatureKey) (t *transport, err error) {
+	signers := make([]*signer, len(keys))
+	for i, k := range keys {
+		algs := tc.signingAlgorithms(k.Key)
+		s := &signer{
+			alg:      algs[0],
+			privKey:  k.Key,
+			pubKeyId: k.IRI.String(),
+		}
+		// TODO: Use config for expiration in seconds
+		s.get, _, err = httpsig.NewSigner(algs, tc.digestAlg, tc.getHeaders, httpsig.Signature, 60)
+		if err != nil {
+			return
+		}
+		s.post, _, err = httpsig.NewSigner(algs, tc.digestAlg, tc.postHeaders, httpsig.Signature, 60)
+		if err != nil {
+			return
+		}
+		signers[i] = s
 	}
 	return newTransport(
 		tc.a,
 		tc.clock,
 		tc.client,
-		getSigner,
-		postSigner,
-		privKey,
-		pubKeyId,
+		signers,
 		tc)
 }
 
@@ -152,10 +222,266 @@ func (tc *Controller) GetFirstAlgorithm() httpsig.Algorithm {
 	return tc.algs[0]
 }
 
+// VerifyAlgorithm determines the algorithm to use to verify an HTTP Signature
+// made with the private key of the given public key.
+//
+// Ed25519 keys are only verified with the ed25519 algorithm. Otherwise, the
+// first configured algorithm is used.
+func (tc *Controller) VerifyAlgorithm(pubKey crypto.PublicKey) httpsig.Algorithm {
+	if _, ok := pubKey.(ed25519.PublicKey); ok {
+		return httpsig.ED25519
+	}
+	return tc.GetFirstAlgorithm()
+}
+
+// signingAlgorithms determines the algorithms, in order of preference, that
+// can sign with the given private key.
+//
+// Ed25519 keys only sign with the ed25519 algorithm, while RSA keys sign with
+// the configured algorithms.
+func (tc *Controller) signingAlgorithms(privKey crypto.PrivateKey) []httpsig.Algorithm {
+	if _, ok := privKey.(ed25519.PrivateKey); ok {
+		return []httpsig.Algorithm{httpsig.ED25519}
+	}
+	return tc.algs
+}
+
+// LearnPeerAlgorithm remembers the algorithm that a peer's HTTP Signature was
+// verified with, when not every peer supports it, so that requests to the
+// host of the peer's key are signed with it too.
+func (tc *Controller) LearnPeerAlgorithm(keyId *url.URL, pubKey crypto.PublicKey) {
+	if alg := tc.VerifyAlgorithm(pubKey); alg == httpsig.ED25519 {
+		tc.peers.Learn(keyId.Host, alg)
+	}
+}
+
+// negotiate chooses the signer for a request to the host: the strongest
+// algorithm that both this server and the host support. Ed25519 is used once
+// the host has been seen signing with it, and otherwise the first signer, whose
+// RSA key every peer supports.
+func (tc *Controller) negotiate(host string, signers []*signer) *signer {
+	for _, s := range signers[1:] {
+		if tc.peers.Supports(host, s.alg) {
+			return s
+		}
+	}
+	return signers[0]
+}
+
 func (tc *Controller) wait(c context.Context, host string) error {
 	return tc.hl.Get(host).Wait(c)
 }
 
+// learnSharedInbox remembers the shared inbox advertised by a dereferenced
+// actor, if any. Only shared inboxes on the same host as the actor's inbox are
+// used.
+func (tc *Controller) learnSharedInbox(c context.Context, b []byte) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return
+	}
+	inbox, ok := m["inbox"].(string)
+	if !ok {
+		return
+	}
+	endpoints, ok := m["endpoints"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	shared, ok := endpoints["sharedInbox"].(string)
+	if !ok {
+		return
+	}
+	inboxIRI, err := url.Parse(inbox)
+	if err != nil {
+		return
+	}
+	sharedIRI, err := url.Parse(shared)
+	if err != nil {
+		return
+	}
+	if err := tc.si.Learn(util.Context{c}, inboxIRI, sharedIRI); err != nil {
+		util.ErrorLogger.Errorf("Error remembering shared inbox of %s: %s", inboxIRI, err)
+	}
+}
+
+// DedupeInboxes removes the recipients whose inbox is the same as that of an
+// earlier recipient once normalized, so that each inbox receives a single copy
+// of an activity.
+func (tc *Controller) DedupeInboxes(recipients []*url.URL) []*url.URL {
+	seen := make(map[string]bool, len(recipients))
+	deduped := make([]*url.URL, 0, len(recipients))
+	for _, r := range recipients {
+		k := normalizeInbox(r)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		deduped = append(deduped, r)
+	}
+	return deduped
+}
+
+// normalizeInbox is the form of an inbox IRI that is the same for every IRI
+// referring to the inbox: the scheme and host are lower case, a port that is
+// the default for the scheme is omitted, and any fragment is dropped.
+func normalizeInbox(iri *url.URL) string {
+	u := *iri
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if len(port) > 0 {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	if len(u.Path) == 0 {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// collapseSharedInboxes replaces the inboxes on a host that advertises a shared
+// inbox with a single delivery to it. A recipient whose shared inbox is not
+// known keeps its own delivery, as does one that is the only recipient using
+// its shared inbox. Recipients are left as they are if the shared inboxes
+// cannot be determined.
+func (tc *Controller) collapseSharedInboxes(c context.Context, recipients []*url.URL) []*url.URL {
+	shared, err := tc.si.Get(util.Context{c}, recipients)
+	if err != nil {
+		util.ErrorLogger.Errorf("Error determining shared inboxes: %s", err)
+		return recipients
+	}
+	nShared := make(map[string]int)
+	for _, si := range shared {
+		nShared[si.String()]++
+	}
+	seen := make(map[string]bool)
+	collapsed := make([]*url.URL, 0, len(recipients))
+	for _, r := range recipients {
+		to := r
+		if si, ok := shared[r.String()]; ok && nShared[si.String()] > 1 {
+			to = si
+		}
+		if seen[to.String()] {
+			continue
+		}
+		seen[to.String()] = true
+		collapsed = append(collapsed, to)
+	}
+	return collapsed
+}
+
+// Webfinger fetches the WebFinger description of the resource from the host,
+// such as the "acct:user@host" resource of an account on the host.
+func (tc *Controller) Webfinger(c context.Context, host, resource string) (wf webfinger.Webfinger, err error) {
+	var blocked bool
+	if blocked, err = tc.isBlocked(c, host); err != nil {
+		return
+	} else if blocked {
+		err = fmt.Errorf("refusing to webfinger a domain not federated with: %s", host)
+		return
+	}
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     "/.well-known/webfinger",
+		RawQuery: url.Values{"resource": []string{resource}}.Encode(),
+	}
+	var req *http.Request
+	req, err = http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return
+	}
+	req = req.WithContext(c)
+	req.Header.Add("Accept", webfingerContentType)
+	req.Header.Add("User-Agent", tc.userAgent)
+	if err = tc.wait(c, host); err != nil {
+		return
+	}
+	var resp *http.Response
+	resp, err = tc.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("webfinger [%s] failed with status (%d): %s", u, resp.StatusCode, resp.Status)
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(&wf)
+	return
+}
+
+// WebfingerActor finds the IRI of the actor of the "user@host" account with
+// WebFinger on its host. Results are cached, and failures are cached for a
+// shorter time; refresh ignores and replaces any cached result.
+func (tc *Controller) WebfingerActor(c context.Context, user, host string, refresh bool) (self *url.URL, err error) {
+	handle := user + "@" + host
+	if refresh {
+		tc.wf.Invalidate(handle)
+	} else if cached, cachedErr, ok := tc.wf.Get(handle); ok {
+		return cached, cachedErr
+	}
+	self, err = tc.webfingerActor(c, handle, host)
+	if c.Err() == nil {
+		tc.wf.Put(handle, self, err)
+	}
+	return
+}
+
+func (tc *Controller) webfingerActor(c context.Context, handle, host string) (*url.URL, error) {
+	wf, err := tc.Webfinger(c, host, "acct:"+handle)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range wf.Links {
+		if l.Rel != "self" || !isActivityStreamsMediaType(l.Type) {
+			continue
+		}
+		return url.Parse(l.Href)
+	}
+	return nil, fmt.Errorf("webfinger for %s has no ActivityStreams self link", handle)
+}
+
+// isActivityStreamsMediaType determines whether a WebFinger link's media type
+// is one an ActivityPub actor is served as.
+func isActivityStreamsMediaType(t string) bool {
+	t = strings.TrimSpace(strings.SplitN(t, ";", 2)[0])
+	return t == "application/activity+json" || t == "application/ld+json"
+}
+
+func (tc *Controller) isBlocked(c context.Context, host string) (bool, error) {
+	return tc.dm.IsBlocked(util.Context{c}, host)
+}
+
+// IsBlocked determines whether this server refuses to federate with the host.
+func (tc *Controller) IsBlocked(c context.Context, host string) (bool, error) {
+	return tc.isBlocked(c, host)
+}
+
+// CachedPublicKey obtains a peer's public key and the actor owning it, if they
+// were cached with CachePublicKey and have not expired.
+func (tc *Controller) CachedPublicKey(keyId *url.URL) (key crypto.PublicKey, owner *url.URL, ok bool) {
+	return tc.keys.Get(keyId)
+}
+
+// CachePublicKey caches a peer's public key once the actor owning it has been
+// verified.
+func (tc *Controller) CachePublicKey(keyId *url.URL, key crypto.PublicKey, owner *url.URL) {
+	tc.keys.Put(keyId, key, owner)
+}
+
+// InvalidatePublicKey removes a peer's public key from the cache.
+func (tc *Controller) InvalidatePublicKey(keyId *url.URL) {
+	tc.keys.Invalidate(keyId)
+}
+
 func (tc *Controller) insertAttempt(c util.Context, payload []byte, to *url.URL, fromUUID paths.UUID) (id string, err error) {
 	id, err = tc.da.InsertAttempt(c, fromUUID, to, payload)
 	return
@@ -171,54 +497,109 @@ func (tc *Controller) markFailure(c util.Context, id string) (err error) {
 	return
 }
 
+func (tc *Controller) markAbandoned(c util.Context, id string) (err error) {
+	err = tc.da.MarkAbandonedAttempt(c, id)
+	return
+}
+
+// record updates the delivery attempt with the result of making it, so that
+// first deliveries and their retries are accounted for alike. The signed
+// headers of the request made, if one was, are kept for operators to inspect.
+// Failures are retried unless exhausted, or unless the recipient's server
+// refused the delivery in a way that will never succeed. The delivery's error
+// is returned.
+func (tc *Controller) record(c util.Context, id string, signed http.Header, deliverErr error, exhausted bool) error {
+	var err error
+	if signed != nil {
+		if err = tc.da.SetSignedHeaders(c, id, signed); err != nil {
+			util.ErrorLogger.Errorf("failed to record the signed headers of delivery attempt %s: %s", id, err)
+		}
+	}
+	if deliverErr == nil {
+		err = tc.markSuccess(c, id)
+	} else if exhausted || isPermanent(deliverErr) {
+		err = tc.markAbandoned(c, id)
+	} else {
+		err = tc.markFailure(c, id)
+	}
+	if err != nil && deliverErr != nil {
+		return fmt.Errorf("failed delivery and failed to record the attempt (%s): [%s, %s]", id, deliverErr, err)
+	} else if err != nil {
+		return fmt.Errorf("failed to mark delivery as successful (%s): %s", id, err)
+	}
+	return deliverErr
+}
+
 var _ pub.Transport = &transport{}
 
 type transport struct {
-	a                         app.Application
-	clock                     pub.Clock
-	client                    *http.Client
-	getSigner, postSigner     httpsig.Signer
-	getSignerMu, postSignerMu *sync.Mutex
-	privKey                   crypto.PrivateKey
-	pubKeyId                  string
-	tc                        *Controller
+	a       app.Application
+	clock   pub.Clock
+	client  *http.Client
+	signers []*signer
+	tc      *Controller
+}
+
+// signer signs requests with one of a user's private keys.
+type signer struct {
+	alg           httpsig.Algorithm
+	privKey       crypto.PrivateKey
+	pubKeyId      string
+	get, post     httpsig.Signer
+	getMu, postMu sync.Mutex
 }
 
 func newTransport(a app.Application,
 	clock pub.Clock,
 	client *http.Client,
-	getSigner, postSigner httpsig.Signer,
-	privKey crypto.PrivateKey,
-	pubKeyId string,
+	signers []*signer,
 	tc *Controller) (t *transport, err error) {
+	if len(signers) == 0 {
+		err = fmt.Errorf("no keys to sign requests with")
+		return
+	}
 	return &transport{
-		a:            a,
-		clock:        clock,
-		client:       client,
-		getSigner:    getSigner,
-		postSigner:   postSigner,
-		getSignerMu:  &sync.Mutex{},
-		postSignerMu: &sync.Mutex{},
-		privKey:      privKey,
-		pubKeyId:     pubKeyId,
-		tc:           tc,
+		a:       a,
+		clock:   clock,
+		client:  client,
+		signers: signers,
+		tc:      tc,
 	}, nil
 }
 
-func (t *transport) Dereference(c context.Context, iri *url.URL) (b []byte, err error) {
+// Dereference fetches the IRI, within the limit on remote fetches while
+// processing an activity, if any.
+func (t *transport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	if budget, ok := (util.Context{c}).DereferenceBudget(); ok {
+		return budget.Fetch(iri, func() ([]byte, error) {
+			return t.dereference(c, iri)
+		})
+	}
+	return t.dereference(c, iri)
+}
+
+func (t *transport) dereference(c context.Context, iri *url.URL) (b []byte, err error) {
+	var blocked bool
+	if blocked, err = t.tc.isBlocked(c, iri.Hostname()); err != nil {
+		return
+	} else if blocked {
+		err = fmt.Errorf("refusing to dereference from a domain not federated with: %s", iri)
+		return
+	}
 	var req *http.Request
 	req, err = http.NewRequest(http.MethodGet, iri.String(), nil)
 	if err != nil {
 		return
 	}
-	req.WithContext(c)
+	req = req.WithContext(c)
 	req.Header.Add("Accept", activityStreamsContentType)
 	req.Header.Add("Accept-Charset", "utf-8")
 	req.Header.Add("Date", t.date())
 	req.Header.Add("User-Agent", t.userAgent())
-	t.getSignerMu.Lock()
-	err = t.getSigner.SignRequest(t.privKey, t.pubKeyId, req, nil)
-	t.getSignerMu.Unlock()
+	s := t.tc.negotiate(req.URL.Host, t.signers)
+	s.getMu.Lock()
+	err = s.get.SignRequest(s.privKey, s.pubKeyId, req, nil)
+	s.getMu.Unlock()
 	if err != nil {
 		return
 	}
@@ -236,10 +617,30 @@ func (t *transport) Dereference(c context.Context, iri *url.URL) (b []byte, err
 		return
 	}
 	b, err = ioutil.ReadAll(resp.Body)
+	if err == nil {
+		t.tc.learnSharedInbox(c, b)
+	}
 	return
 }
 
 func (t *transport) Deliver(c context.Context, b []byte, to *url.URL) (err error) {
+	uc := util.Context{c}
+	if b, err = t.tc.applyContexts(b); err != nil {
+		return
+	}
+	var attemptId string
+	if attemptId, err = t.attempt(c, b, to); err != nil || len(attemptId) == 0 {
+		return
+	}
+	signed, postErr := t.post(c, b, to)
+	err = t.tc.record(uc, attemptId, signed, postErr, false)
+	return
+}
+
+// attempt records a delivery attempt of the payload to the inbox on behalf of
+// the user whose request this is, returning its id. No attempt is made, and
+// its id is empty, if the recipient's domain is not federated with.
+func (t *transport) attempt(c context.Context, b []byte, to *url.URL) (attemptId string, err error) {
 	uc := util.Context{c}
 	var fromUUID paths.UUID
 	fromUUID, err = uc.UserPathUUID()
@@ -247,12 +648,23 @@ func (t *transport) Deliver(c context.Context, b []byte, to *url.URL) (err error
 		err = fmt.Errorf("failed to determine user to deliver on behalf of: %s", err)
 		return
 	}
-	var attemptId string
+	var blocked bool
+	if blocked, err = t.tc.isBlocked(c, to.Hostname()); err != nil {
+		return
+	} else if blocked {
+		util.InfoLogger.Infof("Not delivering to a domain not federated with: %s", to)
+		return
+	}
 	if attemptId, err = t.tc.insertAttempt(uc, b, to, fromUUID); err != nil {
 		err = fmt.Errorf("failed to create delivery attempt: %s", err)
-		return
 	}
+	return
+}
 
+// post makes a single signed delivery of the payload to the inbox, without
+// recording the attempt. The headers of the request are returned once it has
+// been signed.
+func (t *transport) post(c context.Context, b []byte, to *url.URL) (signed http.Header, err error) {
 	byteCopy := make([]byte, len(b))
 	copy(byteCopy, b)
 	buf := bytes.NewBuffer(byteCopy)
@@ -261,17 +673,19 @@ func (t *transport) Deliver(c context.Context, b []byte, to *url.URL) (err error
 	if err != nil {
 		return
 	}
-	req.WithContext(c)
+	req = req.WithContext(c)
 	req.Header.Add("Content-Type", activityStreamsContentType)
 	req.Header.Add("Accept-Charset", "utf-8")
 	req.Header.Add("Date", t.date())
 	req.Header.Add("User-Agent", t.userAgent())
-	t.postSignerMu.Lock()
-	err = t.postSigner.SignRequest(t.privKey, t.pubKeyId, req, b)
-	t.postSignerMu.Unlock()
+	s := t.tc.negotiate(req.URL.Host, t.signers)
+	s.postMu.Lock()
+	err = s.post.SignRequest(s.privKey, s.pubKeyId, req, b)
+	s.postMu.Unlock()
 	if err != nil {
 		return
 	}
+	signed = signedHeaders(req)
 	if err = t.tc.wait(c, req.URL.Host); err != nil {
 		return
 	}
@@ -282,36 +696,77 @@ func (t *transport) Deliver(c context.Context, b []byte, to *url.URL) (err error
 	}
 	defer resp.Body.Close()
 
-	if err = t.handleDeliverResponse(resp, to); err != nil {
-		err2 := t.tc.markFailure(uc, attemptId)
-		if err2 != nil {
-			err = fmt.Errorf("failed delivery and failed to mark as failure (%s): [%s, %s]", attemptId, err, err2)
-		}
-		return
-	}
-	if err = t.tc.markSuccess(uc, attemptId); err != nil {
-		err = fmt.Errorf("failed to mark delivery as successful (%s): %s", attemptId, err)
-		return
-	}
+	err = t.handleDeliverResponse(resp, to)
 	return
 }
 
+// signedHeaders copies the headers of the signed request, including its Host
+// header, which the signature covers.
+func signedHeaders(req *http.Request) http.Header {
+	h := make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Host", req.URL.Host)
+	return h
+}
+
 func (t *transport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) (err error) {
-	var wg sync.WaitGroup
+	if b, err = t.tc.applyContexts(b); err != nil {
+		return
+	}
+	if rr, ok := t.a.(app.RecipientResolver); ok {
+		recipients, err = t.resolveRecipients(c, rr, b, recipients)
+		if err != nil {
+			return
+		}
+	}
+	recipients = t.tc.DedupeInboxes(recipients)
+	recipients = t.tc.collapseSharedInboxes(c, recipients)
+	// Each delivery is recorded as an attempt and then queued, so that the
+	// request does not wait on the recipients' servers. A delivery that
+	// cannot be queued is recorded as failed for the retrier to make.
 	for i, r := range recipients {
-		wg.Add(1)
-		go func(i int, r *url.URL) {
-			defer wg.Done()
-			err := t.Deliver(c, b, r)
+		r := r
+		attemptId, err := t.attempt(c, b, r)
+		if err != nil {
+			util.ErrorLogger.Errorf("BatchDeliver (%d of %d): %s", i, len(recipients), err)
+			continue
+		} else if len(attemptId) == 0 {
+			continue
+		}
+		queued := t.tc.dq.Enqueue(r.Host, func(c context.Context) {
+			signed, err := t.post(c, b, r)
+			err = t.tc.record(util.Context{context.Background()}, attemptId, signed, err, false)
 			if err != nil {
-				util.ErrorLogger.Errorf("BatchDeliver (%d of %d): %s", i, len(recipients), err)
+				util.ErrorLogger.Errorf("BatchDeliver to %s: %s", r, err)
 			}
-		}(i, r)
+		}, func(err error) {
+			err = t.tc.record(util.Context{context.Background()}, attemptId, nil, err, false)
+			util.ErrorLogger.Errorf("BatchDeliver to %s: %s", r, err)
+		})
+		if !queued {
+			err = t.tc.record(util.Context{c}, attemptId, nil, errDeliveryQueueFull, false)
+			util.ErrorLogger.Errorf("BatchDeliver (%d of %d): %s", i, len(recipients), err)
+		}
 	}
-	wg.Wait()
 	return
 }
 
+// resolveRecipients lets the application override the inboxes computed for the
+// serialized activity.
+func (t *transport) resolveRecipients(c context.Context, rr app.RecipientResolver, b []byte, recipients []*url.URL) ([]*url.URL, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	activity, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	return rr.ResolveRecipients(c, activity, recipients)
+}
+
 func (t *transport) handleDereferenceResponse(r *http.Response, iri *url.URL) (err error) {
 	ok := r.StatusCode == http.StatusOK
 	if !ok {
@@ -325,13 +780,37 @@ func (t *transport) handleDeliverResponse(r *http.Response, iri *url.URL) (err e
 		r.StatusCode == http.StatusCreated ||
 		r.StatusCode == http.StatusAccepted
 	if !ok {
-		err = fmt.Errorf("delivery [%s] failed with status (%d): %s", iri, r.StatusCode, r.Status)
+		err = &deliveryError{iri: iri, statusCode: r.StatusCode, status: r.Status}
 	}
 	return
 }
 
+// deliveryError is a delivery the recipient's server responded to with an
+// unsuccessful status.
+type deliveryError struct {
+	iri        *url.URL
+	statusCode int
+	status     string
+}
+
+func (d *deliveryError) Error() string {
+	return fmt.Sprintf("delivery [%s] failed with status (%d): %s", d.iri, d.statusCode, d.status)
+}
+
+// isPermanent determines whether a failed delivery will not succeed if retried,
+// which is the case when the recipient's server responds with a client error
+// other than 429 Too Many Requests. Server errors and network failures are
+// transient.
+func isPermanent(err error) bool {
+	d, ok := err.(*deliveryError)
+	return ok &&
+		d.statusCode >= 400 &&
+		d.statusCode < 500 &&
+		d.statusCode != http.StatusTooManyRequests
+}
+
 func (t *transport) userAgent() string {
-	return web.UserAgent(t.a.Software())
+	return t.tc.userAgent
 }
 
 func (t *transport) date() string {
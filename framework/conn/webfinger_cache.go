@@ -0,0 +1,124 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package conn
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/framework/config"
+)
+
+// WebfingerCacheMaxSize is the number of handles the cache holds, beyond which
+// expired entries are removed when another is cached, and then the one that
+// expires soonest.
+const WebfingerCacheMaxSize = 4096
+
+// WebfingerCache caches the actor IRIs that account handles resolved to with
+// WebFinger, and for a shorter time the errors of handles that failed to
+// resolve, so that dead hosts are not repeatedly asked. Handles are compared
+// case-insensitively.
+type WebfingerCache struct {
+	// Immutable
+	clock       pub.Clock
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// Mutable
+	m  map[string]webfingerEntry
+	mu sync.Mutex
+}
+
+type webfingerEntry struct {
+	self    *url.URL
+	err     error
+	expires time.Time
+}
+
+func NewWebfingerCache(c *config.Config, clock pub.Clock) *WebfingerCache {
+	return &WebfingerCache{
+		clock:       clock,
+		ttl:         time.Duration(c.ActivityPubConfig.WebfingerCacheTTLSeconds) * time.Second,
+		negativeTTL: time.Duration(c.ActivityPubConfig.WebfingerNegativeCacheTTLSeconds) * time.Second,
+		m:           make(map[string]webfingerEntry),
+	}
+}
+
+// Get obtains the cached result of resolving the handle, if it has not
+// expired.
+func (w *WebfingerCache) Get(handle string) (self *url.URL, err error, ok bool) {
+	handle = strings.ToLower(handle)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.m[handle]
+	if !ok {
+		return
+	} else if !w.clock.Now().Before(e.expires) {
+		delete(w.m, handle)
+		return nil, nil, false
+	}
+	return e.self, e.err, true
+}
+
+// Put caches the actor IRI the handle resolved to, or the error resolving it.
+func (w *WebfingerCache) Put(handle string, self *url.URL, err error) {
+	ttl := w.ttl
+	if err != nil {
+		ttl = w.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	handle = strings.ToLower(handle)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.clock.Now()
+	if _, ok := w.m[handle]; !ok && len(w.m) >= WebfingerCacheMaxSize {
+		w.evict(now)
+	}
+	w.m[handle] = webfingerEntry{
+		self:    self,
+		err:     err,
+		expires: now.Add(ttl),
+	}
+}
+
+// evict removes the expired entries, or if there are none, the entry that
+// expires soonest.
+func (w *WebfingerCache) evict(now time.Time) {
+	var soonest string
+	for k, e := range w.m {
+		if !now.Before(e.expires) {
+			delete(w.m, k)
+		} else if len(soonest) == 0 || e.expires.Before(w.m[soonest].expires) {
+			soonest = k
+		}
+	}
+	if len(w.m) >= WebfingerCacheMaxSize {
+		delete(w.m, soonest)
+	}
+}
+
+// Invalidate removes any cached result of resolving the handle.
+func (w *WebfingerCache) Invalidate(handle string) {
+	handle = strings.ToLower(handle)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.m, handle)
+}
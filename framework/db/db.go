@@ -19,6 +19,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-fed/apcore/framework/config"
@@ -44,13 +45,66 @@ func NewDB(c *config.Config) (sqldb *sql.DB, d models.SqlDialect, err error) {
 	}
 
 	util.InfoLogger.Infof("Calling sql.Open...")
-	sqldb, err = sql.Open(driver, conn)
+	sqldb, err = open(c, driver, conn, d)
 	if err != nil {
 		return
 	}
 	util.InfoLogger.Infof("Calling sql.Open complete")
+	configurePool(c, sqldb)
+	util.InfoLogger.Infof("Database connections configured successfully")
+	util.InfoLogger.Infof("NOTE: No underlying database connections may have happened yet!")
+	return
+}
+
+// NewReadReplicaDB opens a connection pool to a read replica of the database,
+// given its connection URL. It is configured the same way as the primary.
+func NewReadReplicaDB(c *config.Config, url string) (sqldb *sql.DB, err error) {
+	var driver string
+	var d models.SqlDialect
+	switch kind := c.DatabaseConfig.DatabaseKind; kind {
+	case "postgres":
+		driver = "pgx"
+		d = NewPgV0(c.DatabaseConfig.PostgresConfig.Schema)
+	default:
+		err = fmt.Errorf("unhandled database_kind in config: %s", kind)
+		return
+	}
+	util.InfoLogger.Infof("Calling sql.Open for read replica...")
+	sqldb, err = open(c, driver, url, d)
+	if err != nil {
+		return
+	}
+	configurePool(c, sqldb)
+	util.InfoLogger.Infof("Read replica connections configured successfully")
+	return
+}
+
+// open opens the connection pool, logging slow queries and bounding how long
+// each statement may take if configured to.
+func open(c *config.Config, driverName, dsn string, sd models.SqlDialect) (*sql.DB, error) {
+	if c.DatabaseConfig.SlowQueryThresholdMs <= 0 && c.DatabaseConfig.StatementTimeoutMs <= 0 {
+		return sql.Open(driverName, dsn)
+	}
+	// Obtain the registered driver by opening a pool that is never used.
+	unused, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := unused.Driver()
+	if err = unused.Close(); err != nil {
+		return nil, err
+	}
+	threshold := time.Duration(c.DatabaseConfig.SlowQueryThresholdMs) * time.Millisecond
+	timeout := time.Duration(c.DatabaseConfig.StatementTimeoutMs) * time.Millisecond
+	connector, err := newInstrumentedConnector(d, dsn, threshold, timeout, sd.SetStatementTimeout())
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
 
-	// Apply general database configurations
+// configurePool applies the general database configurations.
+func configurePool(c *config.Config, sqldb *sql.DB) {
 	if c.DatabaseConfig.ConnMaxLifetimeSeconds > 0 {
 		sqldb.SetConnMaxLifetime(
 			time.Duration(c.DatabaseConfig.ConnMaxLifetimeSeconds) *
@@ -62,9 +116,6 @@ func NewDB(c *config.Config) (sqldb *sql.DB, d models.SqlDialect, err error) {
 	if c.DatabaseConfig.MaxIdleConns >= 0 {
 		sqldb.SetMaxIdleConns(c.DatabaseConfig.MaxIdleConns)
 	}
-	util.InfoLogger.Infof("Database connections configured successfully")
-	util.InfoLogger.Infof("NOTE: No underlying database connections may have happened yet!")
-	return
 }
 
 func MustPing(db *sql.DB) (err error) {
@@ -82,40 +133,30 @@ func MustPing(db *sql.DB) (err error) {
 
 func postgresConn(pg config.PostgresConfig) (s string, err error) {
 	util.InfoLogger.Info("Postgres database configuration")
-	if len(pg.DatabaseName) == 0 {
-		err = fmt.Errorf("postgres config missing db_name")
-		return
-	} else if len(pg.UserName) == 0 {
-		err = fmt.Errorf("postgres config missing user")
-		return
-	}
-	s = fmt.Sprintf("dbname=%s user=%s", pg.DatabaseName, pg.UserName)
-	if len(pg.Password) > 0 {
-		s = fmt.Sprintf("%s password=%s", s, pg.Password)
-	}
-	if len(pg.Host) > 0 {
-		s = fmt.Sprintf("%s host=%s", s, pg.Host)
-	}
+	// Unset parameters are left to the driver's defaults and to the
+	// environment variables such as PGDATABASE and PGUSER, so that peer
+	// and environment-variable authentication work.
+	var params []string
+	add := func(k, v string) {
+		if len(v) > 0 {
+			params = append(params, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	add("dbname", pg.DatabaseName)
+	add("user", pg.UserName)
+	add("password", pg.Password)
+	add("host", pg.Host)
 	if pg.Port > 0 {
-		s = fmt.Sprintf("%s port=%d", s, pg.Port)
-	}
-	if len(pg.SSLMode) > 0 {
-		s = fmt.Sprintf("%s sslmode=%s", s, pg.SSLMode)
-	}
-	if len(pg.FallbackApplicationName) > 0 {
-		s = fmt.Sprintf("%s fallback_application_name=%s", s, pg.FallbackApplicationName)
+		add("port", fmt.Sprintf("%d", pg.Port))
 	}
+	add("sslmode", pg.SSLMode)
+	add("fallback_application_name", pg.FallbackApplicationName)
 	if pg.ConnectTimeout > 0 {
-		s = fmt.Sprintf("%s connect_timeout=%d", s, pg.ConnectTimeout)
-	}
-	if len(pg.SSLCert) > 0 {
-		s = fmt.Sprintf("%s sslcert=%s", s, pg.SSLCert)
-	}
-	if len(pg.SSLKey) > 0 {
-		s = fmt.Sprintf("%s sslkey=%s", s, pg.SSLKey)
-	}
-	if len(pg.SSLRootCert) > 0 {
-		s = fmt.Sprintf("%s sslrootcert=%s", s, pg.SSLRootCert)
+		add("connect_timeout", fmt.Sprintf("%d", pg.ConnectTimeout))
 	}
+	add("sslcert", pg.SSLCert)
+	add("sslkey", pg.SSLKey)
+	add("sslrootcert", pg.SSLRootCert)
+	s = strings.Join(params, " ")
 	return
 }
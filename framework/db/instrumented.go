@@ -0,0 +1,265 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-fed/apcore/util"
+)
+
+// instrumentedConnector opens connections whose queries are logged when they
+// take longer than the threshold to execute, and whose statements are
+// cancelled by the database when they take longer than the statement timeout.
+// A zero threshold or timeout disables it.
+//
+// It is only used when slow query logging or statement timeouts are enabled, so
+// that connections are not wrapped otherwise.
+type instrumentedConnector struct {
+	driver.Connector
+	threshold time.Duration
+	timeout   time.Duration
+	// setTimeout is the statement setting the statement timeout of the
+	// session or transaction.
+	setTimeout string
+}
+
+func newInstrumentedConnector(d driver.Driver, dsn string, threshold, timeout time.Duration, setTimeout string) (driver.Connector, error) {
+	var connector driver.Connector = dsnConnector{d: d, dsn: dsn}
+	if dc, ok := d.(driver.DriverContext); ok {
+		var err error
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return &instrumentedConnector{
+		Connector:  connector,
+		threshold:  threshold,
+		timeout:    timeout,
+		setTimeout: setTimeout,
+	}, nil
+}
+
+// Connect opens a connection whose session has the statement timeout, which
+// the database enforces so that a statement timing out fails without the
+// connection being closed.
+func (s *instrumentedConnector) Connect(c context.Context) (driver.Conn, error) {
+	conn, err := s.Connector.Connect(c)
+	if err != nil {
+		return nil, err
+	}
+	ic := &instrumentedConn{Conn: conn, threshold: s.threshold, setTimeout: s.setTimeout}
+	if s.timeout > 0 {
+		if err := ic.setStatementTimeout(c, s.timeout, false); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return ic, nil
+}
+
+// dsnConnector opens connections for drivers that do not provide their own
+// driver.Connector.
+type dsnConnector struct {
+	d   driver.Driver
+	dsn string
+}
+
+func (d dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return d.d.Open(d.dsn)
+}
+
+func (d dsnConnector) Driver() driver.Driver {
+	return d.d
+}
+
+var (
+	_ driver.ConnBeginTx        = &instrumentedConn{}
+	_ driver.ConnPrepareContext = &instrumentedConn{}
+	_ driver.ExecerContext      = &instrumentedConn{}
+	_ driver.QueryerContext     = &instrumentedConn{}
+	_ driver.Pinger             = &instrumentedConn{}
+	_ driver.NamedValueChecker  = &instrumentedConn{}
+	_ driver.SessionResetter    = &instrumentedConn{}
+	_ driver.Validator          = &instrumentedConn{}
+)
+
+// instrumentedConn times the queries made on the underlying connection, passing
+// through the optional driver interfaces it implements.
+type instrumentedConn struct {
+	driver.Conn
+	threshold  time.Duration
+	setTimeout string
+}
+
+func (s *instrumentedConn) PrepareContext(c context.Context, query string) (stmt driver.Stmt, err error) {
+	if p, ok := s.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(c, query)
+	} else {
+		stmt, err = s.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query, threshold: s.threshold}, nil
+}
+
+func (s *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return s.PrepareContext(context.Background(), query)
+}
+
+// BeginTx begins a transaction, overriding the statement timeout within it
+// when the context does.
+func (s *instrumentedConn) BeginTx(c context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	if b, ok := s.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(c, opts)
+	} else {
+		tx, err = s.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := (util.Context{c}).StatementTimeout(); ok {
+		if err := s.setStatementTimeout(c, d, true); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// setStatementTimeout sets the statement timeout of the session, or only of the
+// ongoing transaction if local. A zero or negative timeout disables it.
+func (s *instrumentedConn) setStatementTimeout(c context.Context, d time.Duration, local bool) error {
+	if d < 0 {
+		d = 0
+	}
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: fmt.Sprintf("%dms", d.Milliseconds())},
+		{Ordinal: 2, Value: local},
+	}
+	if e, ok := s.Conn.(driver.ExecerContext); ok {
+		_, err := e.ExecContext(c, s.setTimeout, args)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := s.Conn.Prepare(s.setTimeout)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(namedValuesToValues(args))
+	return err
+}
+
+func (s *instrumentedConn) ExecContext(c context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := s.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer logIfSlow(time.Now(), s.threshold, query)
+	return e.ExecContext(c, query, args)
+}
+
+func (s *instrumentedConn) QueryContext(c context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := s.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer logIfSlow(time.Now(), s.threshold, query)
+	return q.QueryContext(c, query, args)
+}
+
+func (s *instrumentedConn) Ping(c context.Context) error {
+	if p, ok := s.Conn.(driver.Pinger); ok {
+		return p.Ping(c)
+	}
+	return nil
+}
+
+func (s *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (s *instrumentedConn) ResetSession(c context.Context) error {
+	if r, ok := s.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(c)
+	}
+	return nil
+}
+
+func (s *instrumentedConn) IsValid() bool {
+	if v, ok := s.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+var (
+	_ driver.StmtExecContext  = &instrumentedStmt{}
+	_ driver.StmtQueryContext = &instrumentedStmt{}
+)
+
+// instrumentedStmt times executions of a prepared statement.
+type instrumentedStmt struct {
+	driver.Stmt
+	query     string
+	threshold time.Duration
+}
+
+func (s *instrumentedStmt) ExecContext(c context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer logIfSlow(time.Now(), s.threshold, s.query)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(c, args)
+	}
+	return s.Stmt.Exec(namedValuesToValues(args))
+}
+
+func (s *instrumentedStmt) QueryContext(c context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer logIfSlow(time.Now(), s.threshold, s.query)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(c, args)
+	}
+	return s.Stmt.Query(namedValuesToValues(args))
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	v := make([]driver.Value, len(args))
+	for i, a := range args {
+		v[i] = a.Value
+	}
+	return v
+}
+
+// logIfSlow logs the query if it has taken longer than the threshold since it
+// started.
+func logIfSlow(start time.Time, threshold time.Duration, query string) {
+	if threshold <= 0 {
+		return
+	}
+	if d := time.Since(start); d > threshold {
+		util.InfoLogger.Infof("Slow query took %s: %s", d, strings.Join(strings.Fields(query), " "))
+	}
+}
@@ -78,6 +78,10 @@ func (p *pgV0) UpdateUserActor() string {
 	return `UPDATE ` + p.schema + `users SET actor = $2 WHERE id = $1`
 }
 
+func (p *pgV0) UsersMissingActorProperty() string {
+	return `SELECT id, actor FROM ` + p.schema + `users WHERE NOT actor ? $1`
+}
+
 func (p *pgV0) SensitiveUserByEmail() string {
 	return "SELECT id, hashpass, salt FROM " + p.schema + "users WHERE email = $1"
 }
@@ -112,6 +116,12 @@ func (p *pgV0) InstanceUser() string {
 	return "SELECT id, email, actor, privileges, preferences FROM " + p.schema + "users WHERE privileges->>'InstanceActor' = 'true'"
 }
 
+func (p *pgV0) AnyUser() string {
+	return `SELECT id, email, actor, privileges, preferences FROM ` + p.schema + `users
+WHERE privileges->>'InstanceActor' IS DISTINCT FROM 'true'
+LIMIT 1`
+}
+
 func (p *pgV0) GetInstanceActorPreferences() string {
 	return `SELECT preferences
 FROM ` + p.schema + `users
@@ -124,6 +134,10 @@ SET preferences = $1
 WHERE privileges->>'InstanceActor' = 'true'`
 }
 
+func (p *pgV0) LockInstanceActor() string {
+	return `SELECT pg_advisory_xact_lock(hashtext('` + p.schema + `users.instance_actor'))`
+}
+
 func (p *pgV0) GetUserActivityStats() string {
 	return `SELECT
   COUNT(*),
@@ -133,6 +147,47 @@ func (p *pgV0) GetUserActivityStats() string {
 FROM ` + p.schema + `users`
 }
 
+func (p *pgV0) GetUserActivityStatsRange() string {
+	return `WITH buckets AS (
+  SELECT b AS start
+  FROM generate_series(
+    date_trunc($3, $1::timestamp with time zone),
+    $2::timestamp with time zone,
+    ('1 ' || $3)::interval) AS b
+  WHERE b < $2
+),
+new_users AS (
+  SELECT date_trunc($3, create_time) AS start, COUNT(*) AS n
+  FROM ` + p.schema + `users
+  WHERE create_time >= $1 AND create_time < $2
+  GROUP BY 1
+),
+last_seen_users AS (
+  SELECT date_trunc($3, last_seen) AS start, COUNT(*) AS n
+  FROM ` + p.schema + `users
+  WHERE last_seen >= $1 AND last_seen < $2
+  GROUP BY 1
+),
+new_posts AS (
+  SELECT date_trunc($3, create_time) AS start, COUNT(*) AS n
+  FROM ` + p.schema + `local_data
+  WHERE create_time >= $1 AND create_time < $2
+    AND payload->>'type' IN ('Article', 'Audio', 'Document', 'Event', 'Image', 'Note', 'Page', 'Question', 'Video')
+    AND (payload->'inReplyTo') IS NULL
+  GROUP BY 1
+)
+SELECT
+  b.start,
+  COALESCE(nu.n, 0),
+  COALESCE(lsu.n, 0),
+  COALESCE(np.n, 0)
+FROM buckets AS b
+LEFT JOIN new_users AS nu ON nu.start = b.start
+LEFT JOIN last_seen_users AS lsu ON lsu.start = b.start
+LEFT JOIN new_posts AS np ON np.start = b.start
+ORDER BY b.start`
+}
+
 func (p *pgV0) CreateFedDataTable() string {
 	return `
 CREATE TABLE IF NOT EXISTS ` + p.schema + `fed_data
@@ -147,6 +202,10 @@ func (p *pgV0) CreateIndexIDFedDataTable() string {
 	return `CREATE INDEX IF NOT EXISTS fed_data_id_index ON ` + p.schema + `fed_data USING GIN ((payload->'id'));`
 }
 
+func (p *pgV0) CreateIndexInboxFedDataTable() string {
+	return `CREATE INDEX IF NOT EXISTS fed_data_inbox_index ON ` + p.schema + `fed_data ((payload->>'inbox'));`
+}
+
 func (p *pgV0) FedExists() string {
 	return `SELECT EXISTS (
   SELECT 1
@@ -174,6 +233,92 @@ func (p *pgV0) FedDelete() string {
 	return `DELETE FROM ` + p.schema + `fed_data WHERE payload->>'id' = $1`
 }
 
+func (p *pgV0) CreateIndexCreateTimeFedDataTable() string {
+	return `CREATE INDEX IF NOT EXISTS fed_data_create_time_index ON ` + p.schema + `fed_data (create_time);`
+}
+
+func (p *pgV0) CreateIndexToFedDataTable() string {
+	return `CREATE INDEX IF NOT EXISTS fed_data_to_index ON ` + p.schema + `fed_data USING GIN ((payload->'to'));`
+}
+
+func (p *pgV0) CreateIndexCcFedDataTable() string {
+	return `CREATE INDEX IF NOT EXISTS fed_data_cc_index ON ` + p.schema + `fed_data USING GIN ((payload->'cc'));`
+}
+
+func (p *pgV0) FedPublicTimeline() string {
+	return `WITH max_item AS (
+  SELECT create_time, payload->>'id' AS id FROM ` + p.schema + `local_data
+  WHERE payload->'id' ? $2
+  UNION ALL
+  SELECT create_time, payload->>'id' AS id FROM ` + p.schema + `fed_data
+  WHERE payload->'id' ? $2
+  LIMIT 1
+)
+SELECT payload
+FROM (
+  (SELECT payload, create_time
+  FROM ` + p.schema + `local_data
+  WHERE ` + p.publicTimelineFilter() + `
+  ORDER BY create_time DESC, payload->>'id' DESC
+  LIMIT $3)
+  UNION ALL
+  (SELECT f.payload, f.create_time
+  FROM ` + p.schema + `fed_data AS f
+  WHERE ` + p.publicTimelineFilter() + `
+    AND NOT EXISTS (
+      SELECT 1 FROM ` + p.schema + `local_data AS l
+      WHERE l.payload->'id' ? (f.payload->>'id')
+    )
+  ORDER BY f.create_time DESC, f.payload->>'id' DESC
+  LIMIT $3)
+) AS t
+ORDER BY create_time DESC, payload->>'id' DESC
+LIMIT $3`
+}
+
+// publicTimelineFilter matches the payloads of the public timelines: those
+// whose to or cc has the Public collection in any of the forms of its IRI, as
+// services.IsPublic does, whose type is one of $1 unless it is empty, and
+// which are older than the max_item unless $2 is NULL.
+func (p *pgV0) publicTimelineFilter() string {
+	const public = `ARRAY['https://www.w3.org/ns/activitystreams#Public', 'as:Public', 'Public']`
+	return `(payload->'to' ?| ` + public + ` OR payload->'cc' ?| ` + public + `)
+    AND (jsonb_array_length($1::jsonb) = 0 OR $1::jsonb ? (payload->>'type'))
+    AND ($2::text IS NULL OR (create_time, payload->>'id') < (SELECT create_time, id FROM max_item))`
+}
+
+func (p *pgV0) FedTombstone() string {
+	return `UPDATE ` + p.schema + `fed_data
+SET payload = jsonb_strip_nulls(jsonb_build_object(
+  '@context', 'https://www.w3.org/ns/activitystreams',
+  'id', payload->'id',
+  'type', 'Tombstone',
+  'formerType', CASE WHEN payload->>'type' = 'Tombstone' THEN payload->'formerType' ELSE payload->'type' END,
+  'published', payload->'published',
+  'updated', payload->'updated',
+  'deleted', CASE WHEN payload->>'type' = 'Tombstone' THEN payload->'deleted' ELSE to_jsonb($2::text) END
+))
+WHERE payload->>'id' = $1`
+}
+
+func (p *pgV0) FedDeleteIfUnreferenced() string {
+	notIn := func(table, col, items string) string {
+		return `
+  AND NOT EXISTS (
+    SELECT 1 FROM ` + p.schema + table + `
+    WHERE ` + col + `->'` + items + `' ? $1
+  )`
+	}
+	return `DELETE FROM ` + p.schema + `fed_data
+WHERE payload->>'id' = $1` +
+		notIn("inboxes", "inbox", "orderedItems") +
+		notIn("outboxes", "outbox", "orderedItems") +
+		notIn(v0Followers, v0Followers, "items") +
+		notIn(v0Following, v0Following, "items") +
+		notIn(v0Liked, v0Liked, "items") +
+		notIn(v0Featured, v0Featured, "items")
+}
+
 func (p *pgV0) CreateLocalDataTable() string {
 	return `
 CREATE TABLE IF NOT EXISTS ` + p.schema + `local_data
@@ -184,10 +329,33 @@ CREATE TABLE IF NOT EXISTS ` + p.schema + `local_data
 );`
 }
 
+func (p *pgV0) CreateLocalDataArchiveTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `local_data_archive
+(
+  id uuid PRIMARY KEY,
+  create_time timestamp with time zone NOT NULL,
+  archive_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  payload jsonb NOT NULL
+);`
+}
+
 func (p *pgV0) CreateIndexIDLocalDataTable() string {
 	return `CREATE INDEX IF NOT EXISTS local_data_id_index ON ` + p.schema + `local_data USING GIN ((payload->'id'));`
 }
 
+func (p *pgV0) CreateIndexCreateTimeLocalDataTable() string {
+	return `CREATE INDEX IF NOT EXISTS local_data_create_time_index ON ` + p.schema + `local_data (create_time);`
+}
+
+func (p *pgV0) CreateIndexToLocalDataTable() string {
+	return `CREATE INDEX IF NOT EXISTS local_data_to_index ON ` + p.schema + `local_data USING GIN ((payload->'to'));`
+}
+
+func (p *pgV0) CreateIndexCcLocalDataTable() string {
+	return `CREATE INDEX IF NOT EXISTS local_data_cc_index ON ` + p.schema + `local_data USING GIN ((payload->'cc'));`
+}
+
 func (p *pgV0) LocalExists() string {
 	return `SELECT EXISTS (
   SELECT 1
@@ -203,6 +371,12 @@ FROM ` + p.schema + `local_data
 WHERE payload->'id' ? $1`
 }
 
+func (p *pgV0) LocalCreateTime() string {
+	return `SELECT create_time
+FROM ` + p.schema + `local_data
+WHERE payload->'id' ? $1`
+}
+
 func (p *pgV0) LocalCreate() string {
 	return `INSERT INTO ` + p.schema + `local_data (payload) VALUES ($1)`
 }
@@ -215,6 +389,28 @@ func (p *pgV0) LocalDelete() string {
 	return `DELETE FROM ` + p.schema + `local_data WHERE payload->>'id' = $1`
 }
 
+func (p *pgV0) LocalTombstone() string {
+	return `UPDATE ` + p.schema + `local_data
+SET payload = jsonb_strip_nulls(jsonb_build_object(
+  '@context', 'https://www.w3.org/ns/activitystreams',
+  'id', payload->'id',
+  'type', 'Tombstone',
+  'formerType', CASE WHEN payload->>'type' = 'Tombstone' THEN payload->'formerType' ELSE payload->'type' END,
+  'published', payload->'published',
+  'updated', payload->'updated',
+  'deleted', CASE WHEN payload->>'type' = 'Tombstone' THEN payload->'deleted' ELSE to_jsonb($2::text) END
+))
+WHERE payload->>'id' = $1`
+}
+
+func (p *pgV0) LocalArchive() string {
+	return `INSERT INTO ` + p.schema + `local_data_archive (id, create_time, payload)
+SELECT id, create_time, payload
+FROM ` + p.schema + `local_data
+WHERE payload->'id' ? $1 AND payload->>'type' <> 'Tombstone'
+ON CONFLICT (id) DO NOTHING`
+}
+
 func (p *pgV0) LocalStats() string {
 	return `SELECT
   COUNT(*) FILTER (WHERE (payload->'inReplyTo') IS NULL),
@@ -222,6 +418,27 @@ func (p *pgV0) LocalStats() string {
 FROM ` + p.schema + `local_data`
 }
 
+func (p *pgV0) LocalPublicTimeline() string {
+	return `WITH max_item AS (
+  SELECT create_time, payload->>'id' AS id FROM ` + p.schema + `local_data
+  WHERE payload->'id' ? $2
+  LIMIT 1
+)
+SELECT payload
+FROM ` + p.schema + `local_data
+WHERE ` + p.publicTimelineFilter() + `
+ORDER BY create_time DESC, payload->>'id' DESC
+LIMIT $3`
+}
+
+func (p *pgV0) LocalActorActivityTimes() string {
+	return `SELECT create_time
+FROM ` + p.schema + `local_data
+WHERE create_time > $2 AND payload->'actor' ? $1
+ORDER BY create_time DESC
+LIMIT $3`
+}
+
 func (p *pgV0) CreateInboxesTable() string {
 	return `
 CREATE TABLE IF NOT EXISTS ` + p.schema + `inboxes
@@ -250,6 +467,10 @@ func (p *pgV0) CreateIndexIDOutboxesTable() string {
 	return `CREATE INDEX IF NOT EXISTS outboxes_id_index ON ` + p.schema + `outboxes USING GIN ((outbox->'id'));`
 }
 
+func (p *pgV0) CreateIndexItemsOutboxesTable() string {
+	return `CREATE INDEX IF NOT EXISTS outboxes_items_index ON ` + p.schema + `outboxes USING GIN ((outbox->'orderedItems'));`
+}
+
 func (p *pgV0) InsertInbox() string {
 	return `INSERT INTO ` + p.schema + `inboxes (actor_id, inbox) VALUES ($1, $2)`
 }
@@ -502,6 +723,57 @@ SELECT
   FROM outbox AS i, single_public AS op`
 }
 
+func (p *pgV0) GetOutboxByType() string {
+	return `WITH outbox AS (
+  SELECT outbox
+  FROM ` + p.schema + `outboxes
+  WHERE outbox->'id' ? $1
+),
+page_elements AS (
+  SELECT
+    pe.page AS page,
+    pe.idx AS idx
+  FROM outbox,
+    jsonb_array_elements(outbox->'orderedItems') WITH ORDINALITY AS pe(page, idx)
+),
+of_type AS (
+  SELECT
+    pd.page AS page,
+    pd.idx AS idx
+  FROM page_elements AS pd
+  INNER JOIN ` + p.schema + `local_data AS ld
+  ON pd.page = ld.payload->'id'
+  WHERE $4::jsonb ? (ld.payload->>'type')
+),
+filtered AS (
+  SELECT
+    COALESCE(
+      jsonb_path_query_array(
+        jsonb_agg(t.page ORDER BY t.idx),
+        '$[$min to $max]',
+        jsonb_build_object(
+          'min',
+	  $2::jsonb,
+          'max',
+	  $3::jsonb)),
+      '[]'::jsonb) AS page,
+    $3::integer + 1 >= count(t.page) AS isEnd,
+    count(t.page) AS total
+  FROM of_type AS t
+)
+SELECT
+  i.outbox ||
+    jsonb_build_object(
+      'orderedItems',
+      f.page,
+      'totalItems',
+      f.total,
+      'type',
+      'OrderedCollectionPage') AS page,
+  f.isEnd
+  FROM outbox AS i, filtered AS f`
+}
+
 func (p *pgV0) GetInboxLastPage() string {
 	return `WITH stats AS (
   SELECT
@@ -777,6 +1049,20 @@ func (p *pgV0) OutboxForInbox() string {
 WHERE actor->'inbox' ? $1`
 }
 
+func (p *pgV0) ExpiredOutboxItems() string {
+	return `SELECT o.outbox->>'id', o.actor_id, ld.payload->>'id', obj.payload->>'id', ld.create_time
+FROM ` + p.schema + `local_data AS ld
+INNER JOIN ` + p.schema + `outboxes AS o
+  ON o.outbox->'orderedItems' ? (ld.payload->>'id')
+LEFT JOIN ` + p.schema + `local_data AS obj
+  ON ld.payload->>'type' = 'Create'
+  AND obj.payload->'id' ? COALESCE(ld.payload->'object'->>'id', ld.payload->>'object')
+  AND obj.payload->>'type' <> 'Tombstone'
+WHERE ld.create_time < $1
+ORDER BY ld.create_time
+LIMIT $2`
+}
+
 func (p *pgV0) CreateDeliveryAttemptsTable() string {
 	return `CREATE TABLE IF NOT EXISTS ` + p.schema + `delivery_attempts
 (
@@ -785,14 +1071,33 @@ func (p *pgV0) CreateDeliveryAttemptsTable() string {
   from_id uuid REFERENCES ` + p.schema + `users (id) ON DELETE CASCADE NOT NULL,
   deliver_to text NOT NULL,
   payload bytea NOT NULL,
+  payload_compressed boolean NOT NULL DEFAULT false,
+  activity_id text,
+  signed_headers jsonb,
   state text NOT NULL,
   n_attempts bigint NOT NULL,
   last_attempt timestamp with time zone DEFAULT current_timestamp
 );`
 }
 
+func (p *pgV0) AddDeliveryAttemptsPayloadCompressedColumn() string {
+	return `ALTER TABLE ` + p.schema + `delivery_attempts ADD COLUMN IF NOT EXISTS payload_compressed boolean NOT NULL DEFAULT false`
+}
+
+func (p *pgV0) AddDeliveryAttemptsActivityIDColumn() string {
+	return `ALTER TABLE ` + p.schema + `delivery_attempts ADD COLUMN IF NOT EXISTS activity_id text`
+}
+
+func (p *pgV0) AddDeliveryAttemptsSignedHeadersColumn() string {
+	return `ALTER TABLE ` + p.schema + `delivery_attempts ADD COLUMN IF NOT EXISTS signed_headers jsonb`
+}
+
+func (p *pgV0) CreateIndexActivityIDDeliveryAttemptsTable() string {
+	return `CREATE INDEX IF NOT EXISTS delivery_attempts_activity_id_index ON ` + p.schema + `delivery_attempts (activity_id);`
+}
+
 func (p *pgV0) InsertAttempt() string {
-	return `INSERT INTO ` + p.schema + `delivery_attempts (from_id, deliver_to, payload, state, n_attempts) VALUES ($1, $2, $3, $4, 0) RETURNING id`
+	return `INSERT INTO ` + p.schema + `delivery_attempts (from_id, deliver_to, payload, payload_compressed, state, n_attempts, activity_id) VALUES ($1, $2, $3, $4, $5, 0, NULLIF($6, '')) RETURNING id`
 }
 
 func (p *pgV0) MarkSuccessfulAttempt() string {
@@ -822,22 +1127,41 @@ SET
 WHERE id = $1`
 }
 
+func (p *pgV0) SetAttemptSignedHeaders() string {
+	return `UPDATE ` + p.schema + `delivery_attempts
+SET signed_headers = $2
+WHERE id = $1`
+}
+
 func (p *pgV0) FirstPageRetryableFailures() string {
-	return `SELECT id, from_id, deliver_to, payload, n_attempts, last_attempt
+	return `SELECT id, from_id, deliver_to, payload, payload_compressed, n_attempts, last_attempt
 FROM ` + p.schema + `delivery_attempts
-WHERE state = $1 AND create_time < $2
+WHERE (state = $1 OR (state = $4 AND last_attempt < $5)) AND create_time < $2
 ORDER BY id DESC
 LIMIT $3`
 }
 
 func (p *pgV0) NextPageRetryableFailures() string {
-	return `SELECT id, from_id, deliver_to, payload, n_attempts, last_attempt
+	return `SELECT id, from_id, deliver_to, payload, payload_compressed, n_attempts, last_attempt
 FROM ` + p.schema + `delivery_attempts
-WHERE state = $1 AND create_time < $2 AND id < $4
+WHERE (state = $1 OR (state = $5 AND last_attempt < $6)) AND create_time < $2 AND id < $4
 ORDER BY id DESC
 LIMIT $3`
 }
 
+func (p *pgV0) GetAttemptsForActivity() string {
+	return `SELECT from_id, deliver_to, state, n_attempts, last_attempt
+FROM ` + p.schema + `delivery_attempts
+WHERE activity_id = $1
+ORDER BY deliver_to`
+}
+
+func (p *pgV0) GetAttemptByID() string {
+	return `SELECT id, create_time, from_id, deliver_to, payload, payload_compressed, activity_id, state, n_attempts, last_attempt, signed_headers
+FROM ` + p.schema + `delivery_attempts
+WHERE id = $1`
+}
+
 func (p *pgV0) CreatePrivateKeysTable() string {
 	return `
 CREATE TABLE IF NOT EXISTS ` + p.schema + `private_keys
@@ -845,21 +1169,27 @@ CREATE TABLE IF NOT EXISTS ` + p.schema + `private_keys
   id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
   user_id uuid REFERENCES ` + p.schema + `users(id) ON DELETE CASCADE NOT NULL,
   purpose text NOT NULL,
-  priv_key bytea NOT NULL
+  priv_key bytea NOT NULL,
+  key_type text NOT NULL DEFAULT 'rsa'
 );`
 }
 
+func (p *pgV0) AddPrivateKeysKeyTypeColumn() string {
+	return `ALTER TABLE ` + p.schema + `private_keys ADD COLUMN IF NOT EXISTS key_type text NOT NULL DEFAULT 'rsa'`
+}
+
 func (p *pgV0) CreatePrivateKey() string {
-	return `INSERT INTO ` + p.schema + `private_keys (user_id, purpose, priv_key) VALUES ($1, $2, $3)`
+	return `INSERT INTO ` + p.schema + `private_keys (user_id, purpose, priv_key, key_type) VALUES ($1, $2, $3, $4)`
 }
 
 func (p *pgV0) GetPrivateKeyByUserID() string {
-	return `SELECT priv_key FROM ` + p.schema + `private_keys WHERE user_id = $1 AND purpose = $2`
+	return `SELECT priv_key, key_type FROM ` + p.schema + `private_keys WHERE user_id = $1 AND purpose = $2`
 }
 
 func (p *pgV0) GetPrivateKeyForInstanceActor() string {
 	return `SELECT
-  pk.priv_key
+  pk.priv_key,
+  pk.key_type
 FROM ` + p.schema + `private_keys AS pk
 LEFT JOIN ` + p.schema + `users AS u
 ON u.id = pk.user_id
@@ -1018,6 +1348,35 @@ func (p *pgV0) GetTokenInfoByRefresh() string {
 FROM ` + p.schema + "oauth_tokens WHERE refresh = $1"
 }
 
+func (p *pgV0) GetAuthorizationsForUser() string {
+	return `SELECT
+  oc.id,
+  oc.domain,
+  string_agg(DISTINCT ot.scope, ' '),
+  min(COALESCE(ot.access_create_at, ot.code_create_at)),
+  count(*)
+FROM ` + p.schema + `oauth_tokens AS ot
+INNER JOIN ` + p.schema + `oauth_clients AS oc
+ON ot.client_id = oc.id
+WHERE ot.user_id = $1
+  AND NOT EXISTS (
+    SELECT 1 FROM ` + p.schema + `first_party_creds AS fpc
+    WHERE fpc.token_id = ot.id
+  )
+GROUP BY oc.id, oc.domain
+ORDER BY oc.domain, oc.id`
+}
+
+func (p *pgV0) RemoveTokenInfosForUserClient() string {
+	return `DELETE FROM ` + p.schema + `oauth_tokens AS ot
+WHERE ot.user_id = $1
+  AND ot.client_id = $2
+  AND NOT EXISTS (
+    SELECT 1 FROM ` + p.schema + `first_party_creds AS fpc
+    WHERE fpc.token_id = ot.id
+  )`
+}
+
 /* Collection prototype queries */
 
 func (p *pgV0) createCollectionTable(name string) string {
@@ -1139,6 +1498,102 @@ SELECT
 FROM page, single_page AS sp`
 }
 
+// publicCollectionItems selects the items of a collection, with their
+// position, that are local or federated data addressed to the public.
+func (p *pgV0) publicCollectionItems(name string) string {
+	return `WITH col AS (
+  SELECT ` + name + `
+  FROM ` + p.schema + name + `
+  WHERE ` + name + `->'id' ? $1
+),
+page_elements AS (
+  SELECT
+    pe.page AS page,
+    pe.idx AS idx
+  FROM col,
+    jsonb_array_elements(col.` + name + `->'items') WITH ORDINALITY AS pe(page, idx)
+),
+public_items AS (
+  SELECT
+    pd.page AS page,
+    pd.idx AS idx
+  FROM page_elements AS pd
+  LEFT JOIN ` + p.schema + `fed_data AS fd
+  ON pd.page = fd.payload->'id'
+  LEFT JOIN ` + p.schema + `local_data AS ld
+  ON pd.page = ld.payload->'id'
+  WHERE
+    fd.payload->'to' ? 'https://www.w3.org/ns/activitystreams#Public'
+    OR fd.payload->'cc' ? 'https://www.w3.org/ns/activitystreams#Public'
+    OR ld.payload->'to' ? 'https://www.w3.org/ns/activitystreams#Public'
+    OR ld.payload->'cc' ? 'https://www.w3.org/ns/activitystreams#Public'
+)`
+}
+
+func (p *pgV0) getPublicCollection(name string) string {
+	return p.publicCollectionItems(name) + `,
+filtered AS (
+  SELECT
+    COALESCE(
+      jsonb_path_query_array(
+        jsonb_agg(t.page ORDER BY t.idx),
+        '$[$min to $max]',
+        jsonb_build_object(
+          'min',
+	  $2::jsonb,
+          'max',
+	  $3::jsonb)),
+      '[]'::jsonb) AS page,
+    $3::integer + 1 >= count(t.page) AS isEnd
+  FROM public_items AS t
+)
+SELECT
+  c.` + name + ` ||
+    jsonb_build_object(
+      'items',
+      f.page,
+      'totalItems',
+      jsonb_array_length(f.page),
+      'type',
+      'CollectionPage') AS page,
+  f.isEnd
+  FROM col AS c, filtered AS f`
+}
+
+func (p *pgV0) getPublicCollectionLastPage(name string) string {
+	return p.publicCollectionItems(name) + `,
+merged AS (
+  SELECT
+    jsonb_agg(t.page ORDER BY t.idx) AS page,
+    count(t.page) AS n
+  FROM public_items AS t
+),
+only_public AS (
+  SELECT
+    COALESCE(
+      jsonb_path_query_array(
+        page,
+        '$[$min to last]',
+        jsonb_build_object(
+          'min',
+          GREATEST(0, n - $2))),
+      '[]'::jsonb) AS page,
+    GREATEST(0, n - $2) AS startIndex
+  FROM merged
+)
+SELECT
+  c.` + name + ` ||
+    jsonb_build_object(
+      'items',
+      op.page,
+      'totalItems',
+      jsonb_array_length(op.page),
+      'type',
+      'CollectionPage') AS page,
+  op.startIndex
+  FROM col AS c, only_public AS op`
+}
+
 func (p *pgV0) prependCollectionItem(name string) string {
 	return `UPDATE ` + p.schema + name + `
 SET ` + name + ` = ` + name + ` || jsonb_build_object(
@@ -1167,12 +1622,53 @@ FROM ` + p.schema + name + `
 WHERE actor_id = $1`
 }
 
+func (p *pgV0) countCollection(name string) string {
+	return `SELECT COALESCE(jsonb_array_length(` + name + `->'items'), 0)
+FROM ` + p.schema + name + `
+WHERE ` + name + `->'id' ? $1`
+}
+
+func (p *pgV0) sampleDrift(table, col, items string) string {
+	return `WITH sample AS (
+  SELECT
+    ` + col + `->>'id' AS id,
+    COALESCE(` + col + `->>'totalItems', '0')::int AS stored,
+    COALESCE(jsonb_array_length(` + col + `->'` + items + `'), 0) AS actual
+  FROM ` + p.schema + table + `
+  ORDER BY random()
+  LIMIT $1
+)
+SELECT id, stored, actual FROM sample WHERE stored <> actual`
+}
+
+func (p *pgV0) repairTotalItems(table, col, items string) string {
+	return `UPDATE ` + p.schema + table + `
+SET ` + col + ` = ` + col + ` || jsonb_build_object(
+  'totalItems',
+  COALESCE(jsonb_array_length(` + col + `->'` + items + `'), 0))
+WHERE ` + col + `->'id' ? $1`
+}
+
+func (p *pgV0) actorsMissing(table string) string {
+	return `SELECT u.actor->>'id'
+FROM ` + p.schema + `users AS u
+WHERE NOT EXISTS (
+  SELECT 1
+  FROM ` + p.schema + table + ` AS t
+  WHERE t.actor_id = u.actor->>'id'
+)`
+}
+
 /* Collections */
 
 const (
 	v0Followers = "followers"
 	v0Following = "following"
 	v0Liked     = "liked"
+	v0Featured  = "featured_tags"
+	v0Pinned    = "featured"
+	v0Shares    = "shares"
+	v0Replies   = "replies"
 )
 
 func (p *pgV0) CreateFollowersTable() string {
@@ -1215,6 +1711,10 @@ func (p *pgV0) GetAllFollowersForActor() string {
 	return p.getAllCollectionForActor(v0Followers)
 }
 
+func (p *pgV0) CountFollowers() string {
+	return p.countCollection(v0Followers)
+}
+
 func (p *pgV0) CreateFollowingTable() string {
 	return p.createCollectionTable(v0Following)
 }
@@ -1255,6 +1755,16 @@ func (p *pgV0) GetAllFollowingForActor() string {
 	return p.getAllCollectionForActor(v0Following)
 }
 
+func (p *pgV0) CountFollowing() string {
+	return p.countCollection(v0Following)
+}
+
+func (p *pgV0) GetActorsFollowing() string {
+	return `SELECT actor_id
+FROM ` + p.schema + v0Following + `
+WHERE ` + v0Following + `->'items' ? $1`
+}
+
 func (p *pgV0) CreateLikedTable() string {
 	return p.createCollectionTable(v0Liked)
 }
@@ -1295,89 +1805,312 @@ func (p *pgV0) GetAllLikedForActor() string {
 	return p.getAllCollectionForActor(v0Liked)
 }
 
-func (p *pgV0) CreatePoliciesTable() string {
-	return `CREATE TABLE IF NOT EXISTS ` + p.schema + `policies
-(
-  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
-  actor_id text NOT NULL,
-  purpose text NOT NULL,
-  policy jsonb NOT NULL
-)`
+func (p *pgV0) CountLiked() string {
+	return p.countCollection(v0Liked)
 }
 
-func (p *pgV0) CreatePolicy() string {
-	return `INSERT INTO ` + p.schema + `policies (actor_id, purpose, policy) VALUES ($1, $2, $3) RETURNING id`
+func (p *pgV0) CreateFeaturedTagsTable() string {
+	return p.createCollectionTable(v0Featured)
 }
 
-func (p *pgV0) GetPoliciesForActor() string {
-	return `SELECT id, purpose, policy FROM ` + p.schema + `policies WHERE actor_id = $1`
+func (p *pgV0) CreateIndexIDFeaturedTagsTable() string {
+	return p.createCollectionIDIndex(v0Featured)
 }
 
-func (p *pgV0) GetPoliciesForActorAndPurpose() string {
-	return `SELECT id, policy FROM ` + p.schema + `policies WHERE actor_id = $1 AND purpose = $2`
+func (p *pgV0) InsertFeaturedTags() string {
+	return p.insertCollection(v0Featured)
 }
 
-func (p *pgV0) CreateResolutionsTable() string {
-	return `CREATE TABLE IF NOT EXISTS ` + p.schema + `resolutions
-(
-  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
-  policy_id uuid REFERENCES ` + p.schema + `policies(id) ON DELETE CASCADE NOT NULL,
-  data_iri text NOT NULL,
-  resolution jsonb NOT NULL
+func (p *pgV0) FeaturedTagsExists() string {
+	return `SELECT EXISTS (
+  SELECT 1
+  FROM ` + p.schema + v0Featured + `
+  WHERE ` + v0Featured + `->'id' ? $1
 )`
 }
 
-func (p *pgV0) CreateResolution() string {
-	return `INSERT INTO ` + p.schema + `resolutions (policy_id, data_iri, resolution) VALUES ($1, $2, $3)`
+// Featured tags are stored as Hashtag objects, which are matched by their href.
+func (p *pgV0) FeaturedTagsContains() string {
+	return `SELECT EXISTS (
+  SELECT 1
+  FROM ` + p.schema + v0Featured + `
+  WHERE ` + v0Featured + `->'id' ? $1 AND ` + v0Featured + `->'items' @> jsonb_build_array(jsonb_build_object('href', $2::text))
+  LIMIT 1
+)`
 }
 
-func (p *pgV0) CreateFirstPartyCredentialsTable() string {
-	return `CREATE TABLE IF NOT EXISTS ` + p.schema + `first_party_creds
-(
-  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
-  user_id uuid REFERENCES ` + p.schema + `users(id) ON DELETE CASCADE NOT NULL,
-  token_id uuid REFERENCES ` + p.schema + `oauth_tokens(id) ON DELETE CASCADE NOT NULL,
-  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
-  expiration_time timestamp with time zone NOT NULL
-)`
+func (p *pgV0) GetFeaturedTags() string {
+	return p.getCollection(v0Featured)
 }
 
-func (p *pgV0) CreateFirstPartyCredential() string {
-	return `INSERT INTO ` + p.schema + `first_party_creds (user_id, token_id, expiration_time) VALUES ($1, $2, $3) RETURNING id`
+func (p *pgV0) GetFeaturedTagsLastPage() string {
+	return p.getCollectionLastPage(v0Featured)
 }
 
-func (p *pgV0) UpdateFirstPartyCredential() string {
-	return `WITH update_cred AS (
-  SELECT token_id
-  FROM ` + p.schema + `first_party_creds
-  WHERE id = $1
-)
-UPDATE ` + p.schema + `oauth_tokens AS ot
-SET
-  client_id = $2,
-  user_id = $3,
-  redirect_uri = $4,
-  scope = $5,
-  code = $6,
-  code_create_at = $7,
-  code_expires_in = $8,
-  code_challenge = $9,
-  code_challenge_method = $10,
-  access = $11,
-  access_create_at = $12,
-  access_expires_in = $13,
-  refresh = $14,
-  refresh_create_at = $15,
-  refresh_expires_in = $16
-FROM update_cred
-WHERE ot.id = update_cred.token_id`
+func (p *pgV0) PrependFeaturedTagsItem() string {
+	return `UPDATE ` + p.schema + v0Featured + `
+SET ` + v0Featured + ` = ` + v0Featured + ` || jsonb_build_object(
+  'items',
+  jsonb_build_array(jsonb_build_object('type', 'Hashtag', 'href', $2::text, 'name', $3::text)) || COALESCE(` + v0Featured + `->'items', '[]'::jsonb),
+  'totalItems',
+  (COALESCE(` + v0Featured + `->>'totalItems','0')::int + 1)::text::jsonb)
+WHERE ` + v0Featured + `->'id' ? $1`
 }
 
-func (p *pgV0) UpdateFirstPartyCredentialExpires() string {
-	return `UPDATE ` + p.schema + `first_party_creds SET expiration_time = $2 WHERE id = $1`
+func (p *pgV0) DeleteFeaturedTagsItem() string {
+	return `UPDATE ` + p.schema + v0Featured + `
+SET ` + v0Featured + ` = ` + v0Featured + ` || jsonb_build_object(
+  'items',
+  COALESCE((
+    SELECT jsonb_agg(item ORDER BY idx)
+    FROM jsonb_array_elements(` + v0Featured + `->'items') WITH ORDINALITY AS e(item, idx)
+    WHERE NOT item @> jsonb_build_object('href', $2::text)), '[]'::jsonb),
+  'totalItems',
+  (COALESCE(` + v0Featured + `->>'totalItems','0')::int - 1)::text::jsonb)
+WHERE ` + v0Featured + `->'id' ? $1`
 }
 
-func (p *pgV0) RemoveFirstPartyCredential() string {
+func (p *pgV0) CountFeaturedTags() string {
+	return p.countCollection(v0Featured)
+}
+
+func (p *pgV0) CreateFeaturedTable() string {
+	return p.createCollectionTable(v0Pinned)
+}
+
+func (p *pgV0) CreateIndexIDFeaturedTable() string {
+	return p.createCollectionIDIndex(v0Pinned)
+}
+
+func (p *pgV0) InsertFeatured() string {
+	return p.insertCollection(v0Pinned)
+}
+
+func (p *pgV0) FeaturedContains() string {
+	return p.collectionContains(v0Pinned)
+}
+
+func (p *pgV0) GetFeatured() string {
+	return p.getCollection(v0Pinned)
+}
+
+func (p *pgV0) GetFeaturedLastPage() string {
+	return p.getCollectionLastPage(v0Pinned)
+}
+
+func (p *pgV0) PrependFeaturedItem() string {
+	return p.prependCollectionItem(v0Pinned) + `
+  AND NOT COALESCE(` + v0Pinned + `->'items', '[]'::jsonb) ? $2
+  AND COALESCE(jsonb_array_length(` + v0Pinned + `->'items'), 0) < $3`
+}
+
+func (p *pgV0) DeleteFeaturedItem() string {
+	return p.deleteCollectionItem(v0Pinned)
+}
+
+func (p *pgV0) CountFeatured() string {
+	return p.countCollection(v0Pinned)
+}
+
+// The shares collection of an object is stored with the id of the object in
+// place of that of an actor.
+
+func (p *pgV0) CreateSharesTable() string {
+	return p.createCollectionTable(v0Shares)
+}
+
+func (p *pgV0) CreateIndexIDSharesTable() string {
+	return p.createCollectionIDIndex(v0Shares)
+}
+
+func (p *pgV0) InsertShares() string {
+	return p.insertCollection(v0Shares)
+}
+
+func (p *pgV0) SharesExists() string {
+	return `SELECT EXISTS (
+  SELECT 1
+  FROM ` + p.schema + v0Shares + `
+  WHERE ` + v0Shares + `->'id' ? $1
+  LIMIT 1
+)`
+}
+
+func (p *pgV0) SharesContains() string {
+	return p.collectionContains(v0Shares)
+}
+
+func (p *pgV0) GetShares() string {
+	return p.getCollection(v0Shares)
+}
+
+func (p *pgV0) GetSharesLastPage() string {
+	return p.getCollectionLastPage(v0Shares)
+}
+
+func (p *pgV0) PrependSharesItem() string {
+	return p.prependCollectionItem(v0Shares)
+}
+
+func (p *pgV0) DeleteSharesItem() string {
+	return p.deleteCollectionItem(v0Shares)
+}
+
+func (p *pgV0) CountShares() string {
+	return p.countCollection(v0Shares)
+}
+
+// The replies collection of an object is stored with the id of the object in
+// place of that of an actor.
+
+func (p *pgV0) CreateRepliesTable() string {
+	return p.createCollectionTable(v0Replies)
+}
+
+func (p *pgV0) CreateIndexIDRepliesTable() string {
+	return p.createCollectionIDIndex(v0Replies)
+}
+
+func (p *pgV0) Savepoint() string {
+	return `SAVEPOINT apcore_savepoint`
+}
+
+func (p *pgV0) RollbackToSavepoint() string {
+	return `ROLLBACK TO SAVEPOINT apcore_savepoint`
+}
+
+func (p *pgV0) ReleaseSavepoint() string {
+	return `RELEASE SAVEPOINT apcore_savepoint`
+}
+
+func (p *pgV0) SetStatementTimeout() string {
+	return `SELECT set_config('statement_timeout', $1, $2)`
+}
+
+func (p *pgV0) InsertReplies() string {
+	return p.insertCollection(v0Replies)
+}
+
+func (p *pgV0) RepliesExists() string {
+	return `SELECT EXISTS (
+  SELECT 1
+  FROM ` + p.schema + v0Replies + `
+  WHERE ` + v0Replies + `->'id' ? $1
+  LIMIT 1
+)`
+}
+
+func (p *pgV0) RepliesContains() string {
+	return p.collectionContains(v0Replies)
+}
+
+func (p *pgV0) GetReplies() string {
+	return p.getCollection(v0Replies)
+}
+
+func (p *pgV0) GetPublicReplies() string {
+	return p.getPublicCollection(v0Replies)
+}
+
+func (p *pgV0) GetRepliesLastPage() string {
+	return p.getCollectionLastPage(v0Replies)
+}
+
+func (p *pgV0) GetPublicRepliesLastPage() string {
+	return p.getPublicCollectionLastPage(v0Replies)
+}
+
+func (p *pgV0) PrependRepliesItem() string {
+	return p.prependCollectionItem(v0Replies)
+}
+
+func (p *pgV0) CreatePoliciesTable() string {
+	return `CREATE TABLE IF NOT EXISTS ` + p.schema + `policies
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  actor_id text NOT NULL,
+  purpose text NOT NULL,
+  policy jsonb NOT NULL
+)`
+}
+
+func (p *pgV0) CreatePolicy() string {
+	return `INSERT INTO ` + p.schema + `policies (actor_id, purpose, policy) VALUES ($1, $2, $3) RETURNING id`
+}
+
+func (p *pgV0) GetPoliciesForActor() string {
+	return `SELECT id, purpose, policy FROM ` + p.schema + `policies WHERE actor_id = $1`
+}
+
+func (p *pgV0) GetPoliciesForActorAndPurpose() string {
+	return `SELECT id, policy FROM ` + p.schema + `policies WHERE actor_id = $1 AND purpose = $2`
+}
+
+func (p *pgV0) DeletePolicy() string {
+	return `DELETE FROM ` + p.schema + `policies WHERE id = $1 AND actor_id = $2`
+}
+
+func (p *pgV0) CreateResolutionsTable() string {
+	return `CREATE TABLE IF NOT EXISTS ` + p.schema + `resolutions
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  policy_id uuid REFERENCES ` + p.schema + `policies(id) ON DELETE CASCADE NOT NULL,
+  data_iri text NOT NULL,
+  resolution jsonb NOT NULL
+)`
+}
+
+func (p *pgV0) CreateResolution() string {
+	return `INSERT INTO ` + p.schema + `resolutions (policy_id, data_iri, resolution) VALUES ($1, $2, $3)`
+}
+
+func (p *pgV0) CreateFirstPartyCredentialsTable() string {
+	return `CREATE TABLE IF NOT EXISTS ` + p.schema + `first_party_creds
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id uuid REFERENCES ` + p.schema + `users(id) ON DELETE CASCADE NOT NULL,
+  token_id uuid REFERENCES ` + p.schema + `oauth_tokens(id) ON DELETE CASCADE NOT NULL,
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  expiration_time timestamp with time zone NOT NULL
+)`
+}
+
+func (p *pgV0) CreateFirstPartyCredential() string {
+	return `INSERT INTO ` + p.schema + `first_party_creds (user_id, token_id, expiration_time) VALUES ($1, $2, $3) RETURNING id`
+}
+
+func (p *pgV0) UpdateFirstPartyCredential() string {
+	return `WITH update_cred AS (
+  SELECT token_id
+  FROM ` + p.schema + `first_party_creds
+  WHERE id = $1
+)
+UPDATE ` + p.schema + `oauth_tokens AS ot
+SET
+  client_id = $2,
+  user_id = $3,
+  redirect_uri = $4,
+  scope = $5,
+  code = $6,
+  code_create_at = $7,
+  code_expires_in = $8,
+  code_challenge = $9,
+  code_challenge_method = $10,
+  access = $11,
+  access_create_at = $12,
+  access_expires_in = $13,
+  refresh = $14,
+  refresh_create_at = $15,
+  refresh_expires_in = $16
+FROM update_cred
+WHERE ot.id = update_cred.token_id`
+}
+
+func (p *pgV0) UpdateFirstPartyCredentialExpires() string {
+	return `UPDATE ` + p.schema + `first_party_creds SET expiration_time = $2 WHERE id = $1`
+}
+
+func (p *pgV0) RemoveFirstPartyCredential() string {
 	return `WITH cred AS (SELECT token_id FROM ` + p.schema + `first_party_creds WHERE id = $1)
 DELETE FROM ` + p.schema + `oauth_tokens AS ti
 USING cred AS fpc
@@ -1447,3 +2180,558 @@ LEFT JOIN accept_reject_follows AS arf
 ON arf.ap_id = fr.payload->>'id'
 WHERE arf IS NULL`
 }
+
+func (p *pgV0) GetFollowReceivedFrom() string {
+	return `SELECT payload FROM (
+  SELECT create_time, payload
+  FROM ` + p.schema + `local_data
+  WHERE payload->'type' ? 'Follow'
+    AND payload->'object' ? $1
+    AND payload->'actor' ? $2
+  UNION ALL
+  SELECT create_time, payload
+  FROM ` + p.schema + `fed_data
+  WHERE payload->'type' ? 'Follow'
+    AND payload->'object' ? $1
+    AND payload->'actor' ? $2
+) AS follows
+ORDER BY create_time DESC
+LIMIT 1`
+}
+
+func (p *pgV0) GetPendingFollows() string {
+	return `WITH follows_sent AS (
+  SELECT payload
+  FROM ` + p.schema + `local_data
+  WHERE payload->'type' ? 'Follow'
+    AND payload->'actor' ? $1
+),
+resolved_follows AS (
+  SELECT
+    COALESCE(payload->'object'->>'id', payload->>'object') AS ap_id,
+    COALESCE(payload->'actor'->>'id', payload->'actor'->>0, payload->>'actor') AS actor
+  FROM ` + p.schema + `fed_data
+  WHERE payload->'type' ?| array['Accept', 'Reject']
+  UNION
+  SELECT
+    COALESCE(payload->'object'->>'id', payload->>'object') AS ap_id,
+    NULL::text AS actor
+  FROM ` + p.schema + `local_data
+  WHERE payload->'type' ? 'Undo'
+    AND payload->'actor' ? $1
+)
+SELECT fs.payload
+FROM follows_sent AS fs
+WHERE NOT EXISTS (
+  SELECT 1
+  FROM resolved_follows AS rf
+  WHERE rf.ap_id = fs.payload->>'id'
+    AND (rf.actor IS NULL
+      OR fs.payload->'object' ? rf.actor
+      OR fs.payload->'object'->'id' ? rf.actor)
+)`
+}
+
+func (p *pgV0) CreateIdempotencyKeysTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `idempotency_keys
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  outbox_id text NOT NULL,
+  idempotency_key text NOT NULL,
+  activity_id text,
+  UNIQUE (outbox_id, idempotency_key)
+);`
+}
+
+func (p *pgV0) DropIdempotencyKeysActivityIDNotNull() string {
+	return `ALTER TABLE ` + p.schema + `idempotency_keys ALTER COLUMN activity_id DROP NOT NULL`
+}
+
+func (p *pgV0) InsertIdempotencyKey() string {
+	return `INSERT INTO ` + p.schema + `idempotency_keys (outbox_id, idempotency_key)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING`
+}
+
+func (p *pgV0) SetIdempotencyKeyActivity() string {
+	return `UPDATE ` + p.schema + `idempotency_keys SET activity_id = $3
+WHERE outbox_id = $1 AND idempotency_key = $2 AND activity_id IS NULL`
+}
+
+func (p *pgV0) DeleteIdempotencyKey() string {
+	return `DELETE FROM ` + p.schema + `idempotency_keys
+WHERE outbox_id = $1 AND idempotency_key = $2 AND activity_id IS NULL`
+}
+
+func (p *pgV0) GetIdempotencyKeyActivity() string {
+	return `SELECT activity_id FROM ` + p.schema + `idempotency_keys WHERE outbox_id = $1 AND idempotency_key = $2`
+}
+
+/* Collection drift */
+
+func (p *pgV0) SampleInboxesDrift() string {
+	return p.sampleDrift("inboxes", "inbox", "orderedItems")
+}
+
+func (p *pgV0) RepairInboxesTotalItems() string {
+	return p.repairTotalItems("inboxes", "inbox", "orderedItems")
+}
+
+func (p *pgV0) SampleOutboxesDrift() string {
+	return p.sampleDrift("outboxes", "outbox", "orderedItems")
+}
+
+func (p *pgV0) RepairOutboxesTotalItems() string {
+	return p.repairTotalItems("outboxes", "outbox", "orderedItems")
+}
+
+func (p *pgV0) SampleFollowersDrift() string {
+	return p.sampleDrift(v0Followers, v0Followers, "items")
+}
+
+func (p *pgV0) RepairFollowersTotalItems() string {
+	return p.repairTotalItems(v0Followers, v0Followers, "items")
+}
+
+func (p *pgV0) SampleFollowingDrift() string {
+	return p.sampleDrift(v0Following, v0Following, "items")
+}
+
+func (p *pgV0) RepairFollowingTotalItems() string {
+	return p.repairTotalItems(v0Following, v0Following, "items")
+}
+
+func (p *pgV0) SampleLikedDrift() string {
+	return p.sampleDrift(v0Liked, v0Liked, "items")
+}
+
+func (p *pgV0) RepairLikedTotalItems() string {
+	return p.repairTotalItems(v0Liked, v0Liked, "items")
+}
+
+func (p *pgV0) SampleFeaturedTagsDrift() string {
+	return p.sampleDrift(v0Featured, v0Featured, "items")
+}
+
+func (p *pgV0) RepairFeaturedTagsTotalItems() string {
+	return p.repairTotalItems(v0Featured, v0Featured, "items")
+}
+
+func (p *pgV0) SampleFeaturedDrift() string {
+	return p.sampleDrift(v0Pinned, v0Pinned, "items")
+}
+
+func (p *pgV0) RepairFeaturedTotalItems() string {
+	return p.repairTotalItems(v0Pinned, v0Pinned, "items")
+}
+
+func (p *pgV0) SampleSharesDrift() string {
+	return p.sampleDrift(v0Shares, v0Shares, "items")
+}
+
+func (p *pgV0) RepairSharesTotalItems() string {
+	return p.repairTotalItems(v0Shares, v0Shares, "items")
+}
+
+func (p *pgV0) SampleRepliesDrift() string {
+	return p.sampleDrift(v0Replies, v0Replies, "items")
+}
+
+func (p *pgV0) RepairRepliesTotalItems() string {
+	return p.repairTotalItems(v0Replies, v0Replies, "items")
+}
+
+func (p *pgV0) ActorsMissingInboxes() string {
+	return p.actorsMissing("inboxes")
+}
+
+func (p *pgV0) ActorsMissingOutboxes() string {
+	return p.actorsMissing("outboxes")
+}
+
+func (p *pgV0) ActorsMissingFollowers() string {
+	return p.actorsMissing(v0Followers)
+}
+
+func (p *pgV0) ActorsMissingFollowing() string {
+	return p.actorsMissing(v0Following)
+}
+
+func (p *pgV0) ActorsMissingLiked() string {
+	return p.actorsMissing(v0Liked)
+}
+
+func (p *pgV0) ActorsMissingFeaturedTags() string {
+	return p.actorsMissing(v0Featured)
+}
+
+func (p *pgV0) ActorsMissingFeatured() string {
+	return p.actorsMissing(v0Pinned)
+}
+
+func (p *pgV0) CreateMediaTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `media
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  user_id uuid REFERENCES ` + p.schema + `users (id) ON DELETE CASCADE NOT NULL,
+  content_type text NOT NULL,
+  size bigint NOT NULL,
+  path text NOT NULL
+);`
+}
+
+func (p *pgV0) InsertMedia() string {
+	return `INSERT INTO ` + p.schema + `media (user_id, content_type, size, path) VALUES ($1, $2, $3, $4) RETURNING id`
+}
+
+func (p *pgV0) GetMedia() string {
+	return `SELECT user_id, content_type, size, path FROM ` + p.schema + `media WHERE id = $1`
+}
+
+func (p *pgV0) CreateMediaThumbnailsTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `media_thumbnails
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  media_id uuid REFERENCES ` + p.schema + `media (id) ON DELETE CASCADE NOT NULL,
+  max_dim integer NOT NULL,
+  content_type text NOT NULL,
+  size bigint NOT NULL,
+  path text NOT NULL,
+  UNIQUE (media_id, max_dim)
+);`
+}
+
+func (p *pgV0) InsertMediaThumbnail() string {
+	return `INSERT INTO ` + p.schema + `media_thumbnails (media_id, max_dim, content_type, size, path) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (media_id, max_dim) DO NOTHING`
+}
+
+func (p *pgV0) GetMediaThumbnail() string {
+	return `SELECT content_type, size, path FROM ` + p.schema + `media_thumbnails WHERE media_id = $1 AND max_dim = $2`
+}
+
+/* Federated domains */
+
+func (p *pgV0) CreateAllowedDomainsTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `allowed_domains
+(
+  domain text PRIMARY KEY,
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp
+);`
+}
+
+func (p *pgV0) CreateBlockedDomainsTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `blocked_domains
+(
+  domain text PRIMARY KEY,
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp
+);`
+}
+
+func (p *pgV0) InsertAllowedDomain() string {
+	return `INSERT INTO ` + p.schema + `allowed_domains (domain) VALUES ($1) ON CONFLICT DO NOTHING`
+}
+
+func (p *pgV0) DeleteAllowedDomain() string {
+	return `DELETE FROM ` + p.schema + `allowed_domains WHERE domain = $1`
+}
+
+func (p *pgV0) ContainsAllowedDomain() string {
+	return `SELECT EXISTS (
+  SELECT 1
+  FROM ` + p.schema + `allowed_domains
+  WHERE domain = $1
+)`
+}
+
+func (p *pgV0) InsertBlockedDomain() string {
+	return `INSERT INTO ` + p.schema + `blocked_domains (domain) VALUES ($1) ON CONFLICT DO NOTHING`
+}
+
+func (p *pgV0) DeleteBlockedDomain() string {
+	return `DELETE FROM ` + p.schema + `blocked_domains WHERE domain = $1`
+}
+
+func (p *pgV0) ContainsBlockedDomain() string {
+	return `SELECT EXISTS (
+  SELECT 1
+  FROM ` + p.schema + `blocked_domains
+  WHERE domain = $1
+)`
+}
+
+/* Custom emoji */
+
+func (p *pgV0) CreateEmojiTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `emoji
+(
+  shortcode text PRIMARY KEY,
+  image_iri text NOT NULL,
+  media_type text NOT NULL,
+  update_time timestamp with time zone NOT NULL DEFAULT current_timestamp
+);`
+}
+
+func (p *pgV0) UpsertEmoji() string {
+	return `INSERT INTO ` + p.schema + `emoji (shortcode, image_iri, media_type)
+VALUES ($1, $2, $3)
+ON CONFLICT (shortcode) DO UPDATE SET
+  image_iri = EXCLUDED.image_iri,
+  media_type = EXCLUDED.media_type,
+  update_time = current_timestamp`
+}
+
+func (p *pgV0) DeleteEmoji() string {
+	return `DELETE FROM ` + p.schema + `emoji WHERE shortcode = $1`
+}
+
+func (p *pgV0) GetEmoji() string {
+	return `SELECT image_iri, media_type, update_time FROM ` + p.schema + `emoji WHERE shortcode = $1`
+}
+
+func (p *pgV0) GetAllEmoji() string {
+	return `SELECT shortcode, image_iri, media_type, update_time FROM ` + p.schema + `emoji ORDER BY shortcode`
+}
+
+/* Invites */
+
+func (p *pgV0) CreateInvitesTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `invites
+(
+  code text PRIMARY KEY,
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  created_by uuid REFERENCES ` + p.schema + `users (id) ON DELETE CASCADE NOT NULL,
+  max_uses integer NOT NULL,
+  remaining integer NOT NULL,
+  expires timestamp with time zone
+);`
+}
+
+func (p *pgV0) InsertInvite() string {
+	return `INSERT INTO ` + p.schema + `invites (code, created_by, max_uses, remaining, expires) VALUES ($1, $2, $3, $3, $4)`
+}
+
+func (p *pgV0) ConsumeInvite() string {
+	return `UPDATE ` + p.schema + `invites
+SET remaining = remaining - 1
+WHERE code = $1
+  AND remaining > 0
+  AND (expires IS NULL OR expires > current_timestamp)`
+}
+
+func (p *pgV0) ReleaseInvite() string {
+	return `UPDATE ` + p.schema + `invites
+SET remaining = remaining + 1
+WHERE code = $1 AND remaining < max_uses`
+}
+
+func (p *pgV0) GetAllInvites() string {
+	return `SELECT code, created_by, create_time, max_uses, remaining, expires
+FROM ` + p.schema + `invites
+ORDER BY create_time DESC`
+}
+
+/* Reports */
+
+func (p *pgV0) CreateReportsTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `reports
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  activity_id text UNIQUE NOT NULL,
+  reporter text NOT NULL,
+  objects jsonb NOT NULL,
+  comment text NOT NULL,
+  status text NOT NULL DEFAULT 'open',
+  resolved_by uuid REFERENCES ` + p.schema + `users (id) ON DELETE SET NULL,
+  resolve_time timestamp with time zone
+);`
+}
+
+func (p *pgV0) InsertReport() string {
+	return `INSERT INTO ` + p.schema + `reports (activity_id, reporter, objects, comment)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (activity_id) DO NOTHING`
+}
+
+func (p *pgV0) GetReportsByStatus() string {
+	return `SELECT id, create_time, activity_id, reporter, objects, comment, status, resolved_by, resolve_time
+FROM ` + p.schema + `reports
+WHERE status = $1
+ORDER BY create_time`
+}
+
+func (p *pgV0) ResolveReport() string {
+	return `UPDATE ` + p.schema + `reports
+SET status = 'resolved', resolved_by = $2, resolve_time = current_timestamp
+WHERE id = $1 AND status = 'open'`
+}
+
+/* Relays */
+
+func (p *pgV0) CreateRelaysTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `relays
+(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  inbox text UNIQUE NOT NULL,
+  follow_id text NOT NULL,
+  actor text,
+  state text NOT NULL
+);`
+}
+
+func (p *pgV0) InsertRelay() string {
+	return `INSERT INTO ` + p.schema + `relays (inbox, follow_id, state)
+VALUES ($1, $2, $3)
+ON CONFLICT (inbox) DO UPDATE SET follow_id = $2, actor = NULL, state = $3`
+}
+
+func (p *pgV0) AcceptRelay() string {
+	return `UPDATE ` + p.schema + `relays
+SET actor = $2, state = $3
+WHERE follow_id = $1`
+}
+
+func (p *pgV0) ContainsAcceptedRelay() string {
+	return `SELECT EXISTS (
+  SELECT 1 FROM ` + p.schema + `relays
+  WHERE actor = $1 AND state = $2
+)`
+}
+
+func (p *pgV0) GetRelay() string {
+	return `SELECT id, create_time, inbox, follow_id, actor, state
+FROM ` + p.schema + `relays
+WHERE inbox = $1`
+}
+
+func (p *pgV0) GetRelayByFollow() string {
+	return `SELECT id, create_time, inbox, follow_id, actor, state
+FROM ` + p.schema + `relays
+WHERE follow_id = $1`
+}
+
+func (p *pgV0) GetAllRelays() string {
+	return `SELECT id, create_time, inbox, follow_id, actor, state
+FROM ` + p.schema + `relays
+ORDER BY create_time`
+}
+
+func (p *pgV0) DeleteRelay() string {
+	return `DELETE FROM ` + p.schema + `relays WHERE inbox = $1`
+}
+
+/* InboxProcessed */
+
+func (p *pgV0) CreateInboxProcessedTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `inbox_processed
+(
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  inbox_id text NOT NULL,
+  activity_id text NOT NULL,
+  PRIMARY KEY (inbox_id, activity_id)
+);`
+}
+
+func (p *pgV0) CreateIndexCreateTimeInboxProcessedTable() string {
+	return `CREATE INDEX IF NOT EXISTS inbox_processed_create_time_index ON ` + p.schema + `inbox_processed (create_time);`
+}
+
+func (p *pgV0) InsertInboxProcessed() string {
+	return `INSERT INTO ` + p.schema + `inbox_processed (inbox_id, activity_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING`
+}
+
+func (p *pgV0) DeleteInboxProcessed() string {
+	return `DELETE FROM ` + p.schema + `inbox_processed
+WHERE inbox_id = $1 AND activity_id = $2`
+}
+
+func (p *pgV0) PruneInboxProcessed() string {
+	return `DELETE FROM ` + p.schema + `inbox_processed
+WHERE create_time < $1`
+}
+
+/* Blocks */
+
+func (p *pgV0) CreateBlocksTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `blocks
+(
+  create_time timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  actor_id text NOT NULL,
+  blocked_id text NOT NULL,
+  activity_id text,
+  PRIMARY KEY (actor_id, blocked_id)
+);`
+}
+
+func (p *pgV0) InsertBlock() string {
+	return `INSERT INTO ` + p.schema + `blocks (actor_id, blocked_id, activity_id)
+VALUES ($1, $2, $3)
+ON CONFLICT (actor_id, blocked_id) DO UPDATE SET activity_id = COALESCE(EXCLUDED.activity_id, ` + p.schema + `blocks.activity_id)`
+}
+
+func (p *pgV0) DeleteBlock() string {
+	return `DELETE FROM ` + p.schema + `blocks WHERE actor_id = $1 AND blocked_id = $2`
+}
+
+func (p *pgV0) ContainsBlock() string {
+	return `SELECT EXISTS (
+  SELECT 1 FROM ` + p.schema + `blocks WHERE actor_id = $1 AND blocked_id = $2
+)`
+}
+
+func (p *pgV0) GetBlockActivity() string {
+	return `SELECT activity_id FROM ` + p.schema + `blocks WHERE actor_id = $1 AND blocked_id = $2`
+}
+
+/* SharedInboxes */
+
+func (p *pgV0) CreateSharedInboxesTable() string {
+	return `
+CREATE TABLE IF NOT EXISTS ` + p.schema + `shared_inboxes
+(
+  inbox text PRIMARY KEY,
+  shared_inbox text NOT NULL
+);`
+}
+
+func (p *pgV0) UpsertSharedInbox() string {
+	return `INSERT INTO ` + p.schema + `shared_inboxes (inbox, shared_inbox)
+VALUES ($1, $2)
+ON CONFLICT (inbox) DO UPDATE SET shared_inbox = EXCLUDED.shared_inbox
+WHERE ` + p.schema + `shared_inboxes.shared_inbox <> EXCLUDED.shared_inbox`
+}
+
+func (p *pgV0) GetSharedInboxes() string {
+	return `WITH inboxes AS (
+  SELECT jsonb_array_elements_text($1::jsonb) AS inbox
+)
+SELECT inbox, shared_inbox
+FROM ` + p.schema + `shared_inboxes
+WHERE inbox IN (SELECT inbox FROM inboxes)
+UNION
+SELECT payload->>'inbox', payload->'endpoints'->>'sharedInbox'
+FROM ` + p.schema + `fed_data
+WHERE payload->>'inbox' IN (SELECT inbox FROM inboxes)
+  AND payload->'endpoints'->>'sharedInbox' IS NOT NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM ` + p.schema + `shared_inboxes AS s
+    WHERE s.inbox = payload->>'inbox'
+  )`
+}
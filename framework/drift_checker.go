@@ -0,0 +1,104 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Pausable = &DriftChecker{}
+
+// DriftChecker periodically samples collections to find any whose totalItems
+// has drifted from the number of items they hold, reporting and optionally
+// repairing them.
+type DriftChecker struct {
+	// Immutable
+	cd         *services.CollectionDrift
+	sampleSize int
+	repair     bool
+	checkFn    *util.SafeStartStop
+	// Mutable, atomically accessed
+	nFound    uint64
+	nRepaired uint64
+}
+
+func NewDriftChecker(c *config.Config, cd *services.CollectionDrift) *DriftChecker {
+	d := &DriftChecker{
+		cd:         cd,
+		sampleSize: c.DatabaseConfig.DriftCheckSampleSize,
+		repair:     c.DatabaseConfig.DriftCheckRepair,
+	}
+	if c.DatabaseConfig.DriftCheckPeriodSeconds > 0 {
+		d.checkFn = util.NewSafeStartStop(d.check, time.Duration(c.DatabaseConfig.DriftCheckPeriodSeconds)*time.Second)
+	}
+	return d
+}
+
+func (d *DriftChecker) Start() {
+	if d.checkFn != nil {
+		d.checkFn.Start()
+	}
+}
+
+func (d *DriftChecker) Stop() {
+	if d.checkFn != nil {
+		d.checkFn.Stop()
+	}
+}
+
+func (d *DriftChecker) PauseWhile(paused func() bool) {
+	if d.checkFn != nil {
+		d.checkFn.PauseWhile(paused)
+	}
+}
+
+// Found returns the total number of drifted collections found so far.
+func (d *DriftChecker) Found() uint64 {
+	return atomic.LoadUint64(&d.nFound)
+}
+
+// Repaired returns the total number of drifted collections repaired so far.
+func (d *DriftChecker) Repaired() uint64 {
+	return atomic.LoadUint64(&d.nRepaired)
+}
+
+func (d *DriftChecker) check(ctx context.Context) {
+	drifted, err := d.cd.Check(util.Context{ctx}, d.sampleSize, d.repair)
+	if err != nil {
+		util.ErrorLogger.Errorf("drift checker failed to check collections: %s", err)
+		return
+	}
+	found := atomic.AddUint64(&d.nFound, uint64(len(drifted)))
+	repaired := atomic.LoadUint64(&d.nRepaired)
+	if d.repair {
+		repaired = atomic.AddUint64(&d.nRepaired, uint64(len(drifted)))
+	}
+	for _, x := range drifted {
+		if d.repair {
+			util.InfoLogger.Infof("drift checker repaired totalItems of %s from %d to %d", x.ID.URL, x.Stored, x.Actual)
+		} else {
+			util.ErrorLogger.Errorf("drift checker found totalItems of %s is %d but has %d items", x.ID.URL, x.Stored, x.Actual)
+		}
+	}
+	util.InfoLogger.Infof("drift checker found %d drifted collections (total found: %d, total repaired: %d)", len(drifted), found, repaired)
+}
@@ -0,0 +1,126 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// followPolicyKey is the property of a Follow examined by follow policies.
+const followPolicyKey = "actor"
+
+func (f *Framework) AddFollowPolicy(c context.Context, userID paths.UUID, p app.FollowPolicy) (id string, err error) {
+	return f.policies.Create(util.Context{c}, f.UserIRI(userID), models.AutoAcceptFollowPurpose, toPolicy(p))
+}
+
+func (f *Framework) FollowPolicies(c context.Context, userID paths.UUID) ([]app.FollowPolicy, error) {
+	po, err := f.policies.GetForActorAndPurpose(util.Context{c}, f.UserIRI(userID), models.AutoAcceptFollowPurpose)
+	if err != nil {
+		return nil, err
+	}
+	fp := make([]app.FollowPolicy, 0, len(po))
+	for _, p := range po {
+		fp = append(fp, toFollowPolicy(p))
+	}
+	return fp, nil
+}
+
+func (f *Framework) RemoveFollowPolicy(c context.Context, userID paths.UUID, id string) error {
+	if err := f.policies.Delete(util.Context{c}, f.UserIRI(userID), id); err != nil {
+		return fmt.Errorf("cannot RemoveFollowPolicy %s: %w", id, err)
+	}
+	return nil
+}
+
+// toPolicy builds a Policy matching the actors of a Follow that are on one of
+// the domains, and on none of the excepted domains.
+func toPolicy(p app.FollowPolicy) models.Policy {
+	var except *models.UnaryMatcher
+	if len(p.ExceptDomains) > 0 {
+		except = &models.UnaryMatcher{
+			Not: &models.UnaryMatcher{
+				Value: &models.Value{HostIn: p.ExceptDomains},
+			},
+		}
+	}
+	var m *models.UnaryMatcher
+	switch {
+	case len(p.Domains) > 0 && except != nil:
+		m = &models.UnaryMatcher{
+			And: &models.BinaryMatcher{
+				L: &models.UnaryMatcher{Value: &models.Value{HostIn: p.Domains}},
+				R: except,
+			},
+		}
+	case len(p.Domains) > 0:
+		m = &models.UnaryMatcher{Value: &models.Value{HostIn: p.Domains}}
+	case except != nil:
+		m = except
+	default:
+		// Every Follow has an actor.
+		m = &models.UnaryMatcher{Not: &models.UnaryMatcher{Empty: true}}
+	}
+	return models.Policy{
+		Name:        p.Name,
+		Description: p.Description,
+		Matchers: []*models.KVMatcher{
+			{
+				KeyPathQuery: followPolicyKey,
+				ValueMatcher: m,
+			},
+		},
+	}
+}
+
+// toFollowPolicy recovers the domains of a Policy built by toPolicy. Policies
+// of any other shape only have their id, name, and description.
+func toFollowPolicy(p models.PolicyAndID) app.FollowPolicy {
+	fp := app.FollowPolicy{
+		ID:          p.ID,
+		Name:        p.Policy.Name,
+		Description: p.Policy.Description,
+	}
+	if len(p.Policy.Matchers) != 1 || p.Policy.Matchers[0].KeyPathQuery != followPolicyKey {
+		return fp
+	}
+	m := p.Policy.Matchers[0].ValueMatcher
+	if m != nil && m.And != nil {
+		if hosts := hostIn(m.And.L); hosts != nil {
+			fp.Domains = hosts
+		}
+		m = m.And.R
+	}
+	if hosts := hostIn(m); hosts != nil {
+		fp.Domains = hosts
+	} else if m != nil && m.Not != nil {
+		fp.ExceptDomains = hostIn(m.Not)
+	}
+	return fp
+}
+
+func hostIn(m *models.UnaryMatcher) []string {
+	if m == nil || m.Value == nil {
+		return nil
+	}
+	return m.Value.HostIn
+}
@@ -18,9 +18,12 @@ package framework
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams"
@@ -28,26 +31,65 @@ import (
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework/oauth2"
 	"github.com/go-fed/apcore/framework/web"
+	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
+	"github.com/gorilla/mux"
 )
 
 var _ app.Framework = &Framework{}
 
+// SignatureVerifierFunc verifies the HTTP Signature on a request, returning the
+// actor that signed it.
+type SignatureVerifierFunc func(c context.Context, r *http.Request) (actorIRI *url.URL, verified bool, err error)
+
+// RecipientSenderFunc delivers an activity on behalf of the user to exactly the
+// given inboxes, optionally applying its local side effects.
+type RecipientSenderFunc func(c context.Context, userID paths.UUID, activity vocab.Type, recipients []*url.URL, sideEffects bool) error
+
+// InstanceActorSenderFunc delivers an activity on behalf of the instance actor to
+// exactly the given inboxes.
+type InstanceActorSenderFunc func(c context.Context, activity vocab.Type, recipients []*url.URL) error
+
+// ActorResolverFunc finds the actor of a remote account by its handle,
+// refreshing any cached WebFinger result if requested.
+type ActorResolverFunc func(c context.Context, handle string, refresh bool) (vocab.Type, error)
+
 type Framework struct {
 	scheme            string
 	host              string
 	rsaKeySize        int
 	saltSize          int
 	bCryptStrength    int
+	federateBlocks    bool
 	o                 *oauth2.Server
 	s                 *web.Sessions
 	data              *services.Data
 	followers         *services.Followers
+	inboxes           *services.Inboxes
+	outboxes          *services.Outboxes
+	following         *services.Following
+	featuredTags      *services.FeaturedTags
+	featured          *services.Featured
+	replies           *services.Replies
 	users             *services.Users
+	deliveryAttempts  *services.DeliveryAttempts
+	media             *services.Media
+	domains           *services.Domains
+	blocks            *services.Blocks
+	policies          *services.Policies
+	emoji             *services.Emoji
+	relays            *services.Relays
+	sqldb             *sql.DB
+	clock             pub.Clock
 	actor             pub.Actor
 	federationEnabled bool
+	verifySignature   SignatureVerifierFunc
+	sendToRecipients  RecipientSenderFunc
+	resolveActor      ActorResolverFunc
+	sendAsInstance    InstanceActorSenderFunc
+	app               app.Application
 }
 
 func BuildFramework(scheme string,
@@ -55,13 +97,33 @@ func BuildFramework(scheme string,
 	rsaKeySize int,
 	saltSize int,
 	bCryptStrength int,
+	federateBlocks bool,
 	fw *Framework,
 	o *oauth2.Server,
 	s *web.Sessions,
 	data *services.Data,
 	followers *services.Followers,
+	inboxes *services.Inboxes,
+	outboxes *services.Outboxes,
+	following *services.Following,
+	featuredTags *services.FeaturedTags,
+	featured *services.Featured,
+	replies *services.Replies,
 	users *services.Users,
+	deliveryAttempts *services.DeliveryAttempts,
+	media *services.Media,
+	domains *services.Domains,
+	blocks *services.Blocks,
+	policies *services.Policies,
+	emoji *services.Emoji,
+	relays *services.Relays,
+	sqldb *sql.DB,
+	clock pub.Clock,
 	actor pub.Actor,
+	verifySignature SignatureVerifierFunc,
+	sendToRecipients RecipientSenderFunc,
+	resolveActor ActorResolverFunc,
+	sendAsInstance InstanceActorSenderFunc,
 	a app.Application) *Framework {
 	_, isS2S := a.(app.S2SApplication)
 	fw.scheme = scheme
@@ -69,13 +131,34 @@ func BuildFramework(scheme string,
 	fw.rsaKeySize = rsaKeySize
 	fw.saltSize = saltSize
 	fw.bCryptStrength = bCryptStrength
+	fw.federateBlocks = federateBlocks
 	fw.o = o
 	fw.s = s
 	fw.data = data
 	fw.actor = actor
 	fw.federationEnabled = isS2S
 	fw.followers = followers
+	fw.inboxes = inboxes
+	fw.outboxes = outboxes
+	fw.following = following
+	fw.featuredTags = featuredTags
+	fw.featured = featured
+	fw.replies = replies
 	fw.users = users
+	fw.deliveryAttempts = deliveryAttempts
+	fw.media = media
+	fw.domains = domains
+	fw.blocks = blocks
+	fw.policies = policies
+	fw.emoji = emoji
+	fw.relays = relays
+	fw.sqldb = sqldb
+	fw.clock = clock
+	fw.verifySignature = verifySignature
+	fw.sendToRecipients = sendToRecipients
+	fw.resolveActor = resolveActor
+	fw.sendAsInstance = sendAsInstance
+	fw.app = a
 	return fw
 }
 
@@ -83,7 +166,23 @@ func (f *Framework) Context(r *http.Request) context.Context {
 	return util.WithAPHTTPContext(f.scheme, f.host, r)
 }
 
-func (f *Framework) CreateUser(c context.Context, username, email, password string) (userID string, err error) {
+func (f *Framework) AuthContext(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	c := util.WithAPHTTPContext(f.scheme, f.host, r)
+	userID, scope, authenticated, err := f.o.ValidateWithScope(w, r)
+	if err != nil {
+		return c.Context, err
+	} else if authenticated {
+		uuid := paths.UUID(userID)
+		c.WithAuthenticatedUser(uuid, f.UserIRI(uuid), scope)
+	}
+	return c.Context, nil
+}
+
+func (f *Framework) RequireScope(c app.Capability) mux.MiddlewareFunc {
+	return requireScope(f.o, f.app, f.scheme, f.host, c)
+}
+
+func (f *Framework) CreateUser(c context.Context, params app.CreateUserParams) (userID string, err error) {
 	p := services.CreateUserParameters{
 		Scheme:     f.scheme,
 		Host:       f.host,
@@ -92,11 +191,15 @@ func (f *Framework) CreateUser(c context.Context, username, email, password stri
 			SaltSize:       f.saltSize,
 			BCryptStrength: f.bCryptStrength,
 		},
-		Username: username,
-		Email:    email,
+		Username: params.Username,
+		Email:    params.Email,
+		Summary:  params.Summary,
 	}
 	ctx := util.Context{c}
-	return f.users.CreateUser(ctx, p, password)
+	if params.Admin {
+		return f.users.CreateAdminUser(ctx, p, params.Password)
+	}
+	return f.users.CreateUser(ctx, p, params.Password)
 }
 
 func (f *Framework) IsNotUniqueUsername(err error) bool {
@@ -132,6 +235,35 @@ func (f *Framework) Send(c context.Context, userID paths.UUID, t vocab.Type) err
 	}
 }
 
+func (f *Framework) SendToRecipients(c context.Context, userID paths.UUID, activity vocab.Type, recipients []*url.URL, sideEffects bool) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot SendToRecipients: Framework.SendToRecipients called when federation is not enabled")
+	}
+	return f.sendToRecipients(c, userID, activity, recipients, sideEffects)
+}
+
+func (f *Framework) VerifyRequestSignature(c context.Context, r *http.Request) (actorIRI *url.URL, verified bool, err error) {
+	if !f.federationEnabled {
+		err = fmt.Errorf("cannot VerifyRequestSignature: called when federation is not enabled")
+		return
+	}
+	return f.verifySignature(c, r)
+}
+
+func (f *Framework) ResolveActor(c context.Context, handle string) (vocab.Type, error) {
+	if !f.federationEnabled {
+		return nil, fmt.Errorf("cannot ResolveActor: called when federation is not enabled")
+	}
+	return f.resolveActor(c, handle, false)
+}
+
+func (f *Framework) RefreshActor(c context.Context, handle string) (vocab.Type, error) {
+	if !f.federationEnabled {
+		return nil, fmt.Errorf("cannot RefreshActor: called when federation is not enabled")
+	}
+	return f.resolveActor(c, handle, true)
+}
+
 func (f *Framework) GetPrivileges(c context.Context, userID paths.UUID, appPrivileges interface{}) (admin bool, err error) {
 	var p *services.Privileges
 	p, err = f.users.Privileges(util.Context{c}, string(userID), appPrivileges)
@@ -151,6 +283,18 @@ func (f *Framework) SetPrivileges(c context.Context, userID paths.UUID, admin bo
 	return f.users.UpdatePrivileges(util.Context{c}, string(userID), p)
 }
 
+func (f *Framework) SetPostRateLimit(c context.Context, userID paths.UUID, perMinute, perHour int) error {
+	return f.users.SetPostRateLimit(util.Context{c}, string(userID), perMinute, perHour)
+}
+
+func (f *Framework) Announcement(c context.Context) (*app.Announcement, error) {
+	return f.users.ActiveAnnouncement(util.Context{c}, f.clock.Now())
+}
+
+func (f *Framework) SetAnnouncement(c context.Context, a *app.Announcement) error {
+	return f.users.SetAnnouncement(util.Context{c}, a)
+}
+
 func (f *Framework) Session(r *http.Request) (app.Session, error) {
 	return f.s.Get(r)
 }
@@ -163,6 +307,343 @@ func (f *Framework) OpenFollowRequests(c context.Context, userID paths.UUID) ([]
 	return f.followers.OpenFollowRequests(util.Context{c}, f.UserIRI(userID))
 }
 
+func (f *Framework) PendingFollows(c context.Context, userID paths.UUID) ([]vocab.ActivityStreamsFollow, error) {
+	return f.following.PendingFollows(util.Context{c}, f.UserIRI(userID))
+}
+
+func (f *Framework) GetFollowersPage(c context.Context, userID paths.UUID, n, offset int) (vocab.ActivityStreamsCollectionPage, error) {
+	if n <= 0 {
+		n = f.data.FollowersPageSizes.Default
+	} else if n > f.data.FollowersPageSizes.Max {
+		n = f.data.FollowersPageSizes.Max
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	followersIRI := paths.UUIDIRIFor(f.scheme, f.host, paths.FollowersPathKey, userID)
+	return f.followers.GetPage(util.Context{c}, followersIRI, offset, n)
+}
+
+func (f *Framework) InboxContains(c context.Context, userID paths.UUID, id *url.URL) (bool, error) {
+	return f.inboxes.ContainsForActor(util.Context{c}, f.UserIRI(userID), id)
+}
+
+func (f *Framework) FollowingContains(c context.Context, userID paths.UUID, actor *url.URL) (bool, error) {
+	return f.following.ContainsForActor(util.Context{c}, f.UserIRI(userID), actor)
+}
+
+func (f *Framework) GetOutboxByType(c context.Context, userID paths.UUID, typeNames []string, n, offset int) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	if n <= 0 {
+		n = f.outboxes.PageSizes.Default
+	} else if n > f.outboxes.PageSizes.Max {
+		n = f.outboxes.PageSizes.Max
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	outboxIRI := paths.UUIDIRIFor(f.scheme, f.host, paths.OutboxPathKey, userID)
+	return f.outboxes.GetPageByType(util.Context{c}, outboxIRI, typeNames, offset, n)
+}
+
+func (f *Framework) PublicTimeline(c context.Context, scope app.TimelineScope, typeNames []string, n int, maxID *url.URL) (items []vocab.Type, more bool, err error) {
+	if n <= 0 {
+		n = f.data.DefaultCollectionSize
+	} else if n > f.data.MaxCollectionPageSize {
+		n = f.data.MaxCollectionPageSize
+	}
+	switch scope {
+	case app.LocalTimeline:
+		return f.data.PublicTimeline(util.Context{c}, false, typeNames, maxID, n)
+	case app.FederatedTimeline:
+		return f.data.PublicTimeline(util.Context{c}, true, typeNames, maxID, n)
+	default:
+		err = fmt.Errorf("cannot PublicTimeline: unknown timeline scope: %d", scope)
+		return
+	}
+}
+
+func (f *Framework) DeliveryStatus(c context.Context, activityIRI *url.URL) ([]app.DeliveryRecord, error) {
+	dr, err := f.deliveryAttempts.DeliveryStatus(util.Context{c}, activityIRI)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]app.DeliveryRecord, 0, len(dr))
+	for _, r := range dr {
+		records = append(records, app.DeliveryRecord{
+			Recipient:   r.Recipient,
+			State:       app.DeliveryState(r.State),
+			Attempts:    r.NAttempts,
+			LastAttempt: r.LastAttempt,
+		})
+	}
+	return records, nil
+}
+
+func (f *Framework) PutMedia(c context.Context, userID paths.UUID, r io.Reader, contentType string) (*url.URL, error) {
+	if f.media == nil {
+		return nil, fmt.Errorf("cannot PutMedia: media uploads are not enabled")
+	}
+	return f.media.Put(util.Context{c}, userID, r, contentType)
+}
+
+func (f *Framework) PinFeaturedTag(c context.Context, userID paths.UUID, tag *url.URL) error {
+	return f.featuredTags.Pin(util.Context{c}, f.UserIRI(userID), tag)
+}
+
+func (f *Framework) UnpinFeaturedTag(c context.Context, userID paths.UUID, tag *url.URL) error {
+	return f.featuredTags.Unpin(util.Context{c}, f.UserIRI(userID), tag)
+}
+
+func (f *Framework) Pin(c context.Context, userID paths.UUID, object *url.URL) error {
+	if !f.data.Owns(object) {
+		return fmt.Errorf("cannot Pin: %s is not an object of this server", object)
+	}
+	actor := f.UserIRI(userID)
+	t, err := f.data.Get(util.Context{c}, object)
+	if err != nil {
+		return err
+	}
+	if ok, err := isAttributedTo(t, actor); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("cannot Pin: %s is not attributed to %s", object, actor)
+	}
+	return f.featured.Pin(util.Context{c}, actor, object)
+}
+
+func (f *Framework) Unpin(c context.Context, userID paths.UUID, object *url.URL) error {
+	return f.featured.Unpin(util.Context{c}, f.UserIRI(userID), object)
+}
+
+func (f *Framework) SetProfileFields(c context.Context, userID paths.UUID, fields []app.ProfileField) error {
+	return f.users.SetProfileFields(util.Context{c}, userID, fields)
+}
+
+func (f *Framework) PutEmoji(c context.Context, shortcode string, image *url.URL, mediaType string) error {
+	return f.emoji.Put(util.Context{c}, shortcode, image, mediaType)
+}
+
+func (f *Framework) DeleteEmoji(c context.Context, shortcode string) error {
+	return f.emoji.Delete(util.Context{c}, shortcode)
+}
+
+func (f *Framework) GetEmoji(c context.Context, shortcode string) (vocab.TootEmoji, error) {
+	return f.emoji.Get(util.Context{c}, shortcode)
+}
+
+func (f *Framework) ListAuthorizations(c context.Context, userID paths.UUID) ([]app.ClientAuthorization, error) {
+	ca, err := f.o.Authorizations(util.Context{c}, string(userID))
+	if err != nil {
+		return nil, err
+	}
+	return toClientAuthorizations(ca), nil
+}
+
+func (f *Framework) RevokeAuthorization(c context.Context, userID paths.UUID, clientID string) error {
+	_, err := f.o.RevokeAuthorization(util.Context{c}, string(userID), clientID)
+	return err
+}
+
+func (f *Framework) RequestedScopes(r *http.Request) ([]app.Scope, error) {
+	return f.o.RequestedScopes(r)
+}
+
+// toClientAuthorizations converts the summaries of the tokens granted to
+// clients, splitting their scopes.
+func toClientAuthorizations(ca []models.ClientAuthorization) []app.ClientAuthorization {
+	as := make([]app.ClientAuthorization, 0, len(ca))
+	for _, a := range ca {
+		var scopes []string
+		seen := make(map[string]bool)
+		for _, s := range strings.Fields(a.Scope) {
+			if !seen[s] {
+				seen[s] = true
+				scopes = append(scopes, s)
+			}
+		}
+		as = append(as, app.ClientAuthorization{
+			ClientID: a.ClientID,
+			Domain:   a.Domain,
+			Scopes:   scopes,
+			Created:  a.Created.Time,
+			Tokens:   a.Tokens,
+		})
+	}
+	return as
+}
+
+func (f *Framework) DatabaseStats() sql.DBStats {
+	return f.sqldb.Stats()
+}
+
+func (f *Framework) AllowDomain(c context.Context, host string) error {
+	return f.domains.Allow(util.Context{c}, host)
+}
+
+func (f *Framework) DisallowDomain(c context.Context, host string) error {
+	return f.domains.Disallow(util.Context{c}, host)
+}
+
+func (f *Framework) BlockDomain(c context.Context, host string) error {
+	return f.domains.Block(util.Context{c}, host)
+}
+
+func (f *Framework) UnblockDomain(c context.Context, host string) error {
+	return f.domains.Unblock(util.Context{c}, host)
+}
+
+func (f *Framework) SubscribeRelay(ctx context.Context, inbox *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot SubscribeRelay: called when federation is not enabled")
+	}
+	// Relays following the LitePub protocol expect the instance actor to
+	// Follow the Public collection.
+	follow := streams.NewActivityStreamsFollow()
+
+	me := streams.NewActivityStreamsActorProperty()
+	me.AppendIRI(paths.ActorIRIFor(f.scheme, f.host, paths.UserPathKey, paths.InstanceActor))
+	follow.SetActivityStreamsActor(me)
+
+	public, err := url.Parse(pub.PublicActivityPubIRI)
+	if err != nil {
+		return err
+	}
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(public)
+	follow.SetActivityStreamsObject(op)
+
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(public)
+	follow.SetActivityStreamsTo(to)
+
+	// The Follow is assigned its id up front, so that the subscription is
+	// recorded before the relay can accept it. The id is kept so that
+	// unsubscribing can Undo it.
+	path, err := f.app.NewIDPath(ctx, follow)
+	if err != nil {
+		return err
+	}
+	followID := &url.URL{Scheme: f.scheme, Host: f.host, Path: path}
+	idp := streams.NewJSONLDIdProperty()
+	idp.Set(followID)
+	follow.SetJSONLDId(idp)
+
+	c := util.Context{ctx}
+	if err := f.relays.Subscribe(c, inbox, followID); err != nil {
+		return err
+	}
+	if err := f.sendAsInstance(ctx, follow, []*url.URL{inbox}); err != nil {
+		if uerr := f.relays.Unsubscribe(c, inbox); uerr != nil {
+			return fmt.Errorf("failed to Follow relay %s and to remove its subscription: [%s, %s]", inbox, err, uerr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *Framework) UnsubscribeRelay(ctx context.Context, inbox *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot UnsubscribeRelay: called when federation is not enabled")
+	}
+	c := util.Context{ctx}
+	rl, err := f.relays.Get(c, inbox)
+	if err != nil {
+		return err
+	}
+	follow, err := f.data.Get(c, rl.FollowID)
+	if err != nil {
+		return err
+	}
+	undo := streams.NewActivityStreamsUndo()
+
+	me := streams.NewActivityStreamsActorProperty()
+	me.AppendIRI(paths.ActorIRIFor(f.scheme, f.host, paths.UserPathKey, paths.InstanceActor))
+	undo.SetActivityStreamsActor(me)
+
+	op := streams.NewActivityStreamsObjectProperty()
+	if err := op.AppendType(follow); err != nil {
+		return err
+	}
+	undo.SetActivityStreamsObject(op)
+
+	if err := f.sendAsInstance(ctx, undo, []*url.URL{inbox}); err != nil {
+		return err
+	}
+	return f.relays.Unsubscribe(c, inbox)
+}
+
+func (f *Framework) Relays(ctx context.Context) ([]app.Relay, error) {
+	rl, err := f.relays.GetAll(util.Context{ctx})
+	if err != nil {
+		return nil, err
+	}
+	as := make([]app.Relay, len(rl))
+	for i, v := range rl {
+		as[i] = app.Relay{
+			Inbox:   v.Inbox.String(),
+			State:   v.State,
+			Created: v.Created,
+		}
+		if v.Actor != nil {
+			as[i].Actor = v.Actor.String()
+		}
+	}
+	return as, nil
+}
+
+func (f *Framework) Block(ctx context.Context, userID paths.UUID, actor *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot Block: called when federation is not enabled")
+	}
+	myIRI := f.UserIRI(userID)
+	c := util.Context{ctx}
+	if blocked, err := f.blocks.IsBlocked(c, myIRI, actor); err != nil {
+		return err
+	} else if blocked {
+		return nil
+	}
+	var activityIRI *url.URL
+	if f.federateBlocks {
+		block := streams.NewActivityStreamsBlock()
+
+		me := streams.NewActivityStreamsActorProperty()
+		me.AppendIRI(myIRI)
+		block.SetActivityStreamsActor(me)
+
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(actor)
+		block.SetActivityStreamsObject(op)
+
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(actor)
+		block.SetActivityStreamsTo(to)
+
+		if err := f.Send(ctx, userID, block); err != nil {
+			return err
+		}
+		// Sending assigns the Block its id, which is kept so that
+		// unblocking can Undo it.
+		var err error
+		if activityIRI, err = pub.GetId(block); err != nil {
+			return err
+		}
+	}
+	return f.blocks.Block(c, myIRI, actor, activityIRI)
+}
+
+func (f *Framework) Unblock(ctx context.Context, userID paths.UUID, actor *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot Unblock: called when federation is not enabled")
+	}
+	activityIRI, err := f.blocks.Unblock(util.Context{ctx}, f.UserIRI(userID), actor)
+	if err != nil {
+		return err
+	} else if activityIRI == nil || !f.federateBlocks {
+		return nil
+	}
+	return f.Undo(ctx, userID, activityIRI)
+}
+
 func (f *Framework) SendAcceptFollow(ctx context.Context, userID paths.UUID, followIRI *url.URL) error {
 	myIRI := f.UserIRI(userID)
 
@@ -248,6 +729,333 @@ func (f *Framework) SendRejectFollow(ctx context.Context, userID paths.UUID, fol
 	return nil
 }
 
+func (f *Framework) RemoveFollower(ctx context.Context, userID paths.UUID, follower *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot RemoveFollower: called when federation is not enabled")
+	}
+	myIRI := f.UserIRI(userID)
+	c := util.Context{ctx}
+	if has, err := f.followers.ContainsForActor(c, myIRI, follower); err != nil {
+		return err
+	} else if !has {
+		return fmt.Errorf("cannot RemoveFollower: %s is not a follower", follower)
+	}
+	follow, err := f.followers.FollowReceivedFrom(c, myIRI, follower)
+	if err != nil {
+		return err
+	}
+
+	// Build the Reject of the original Follow. If it is no longer known,
+	// an equivalent Follow is embedded instead.
+	reject := streams.NewActivityStreamsReject()
+
+	me := streams.NewActivityStreamsActorProperty()
+	me.AppendIRI(myIRI)
+	reject.SetActivityStreamsActor(me)
+
+	op := streams.NewActivityStreamsObjectProperty()
+	if follow == nil {
+		follow = streams.NewActivityStreamsFollow()
+		fa := streams.NewActivityStreamsActorProperty()
+		fa.AppendIRI(follower)
+		follow.SetActivityStreamsActor(fa)
+		fo := streams.NewActivityStreamsObjectProperty()
+		fo.AppendIRI(myIRI)
+		follow.SetActivityStreamsObject(fo)
+	}
+	if id := follow.GetJSONLDId(); id != nil && id.Get() != nil {
+		op.AppendIRI(id.Get())
+	} else {
+		op.AppendActivityStreamsFollow(follow)
+	}
+	reject.SetActivityStreamsObject(op)
+
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(follower)
+	reject.SetActivityStreamsTo(to)
+
+	// Update the followers collection
+	followersIRI := paths.UserIRIFor(f.scheme, f.host, paths.FollowersPathKey, paths.Actor(userID))
+	if err := f.followers.DeleteItem(c, followersIRI, follower); err != nil {
+		return err
+	}
+	// Deliver the Reject
+	return f.Send(ctx, userID, reject)
+}
+
+func (f *Framework) DeleteContent(ctx context.Context, userID paths.UUID, id *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot DeleteContent: called when federation is not enabled")
+	} else if !f.data.Owns(id) {
+		return fmt.Errorf("cannot DeleteContent: %s is not local content", id)
+	}
+	myIRI := f.UserIRI(userID)
+	c := util.Context{ctx}
+	t, err := f.data.Get(c, id)
+	if err != nil {
+		return err
+	} else if t.GetTypeName() == "Tombstone" {
+		return fmt.Errorf("cannot DeleteContent: %s is already deleted", id)
+	} else if attributed, err := isAttributedTo(t, myIRI); err != nil {
+		return err
+	} else if !attributed {
+		return fmt.Errorf("cannot DeleteContent: %s is not attributed to %s", id, myIRI)
+	}
+
+	// Deliver the Delete, then delete the content. When the Social API is
+	// enabled, the content is already a Tombstone, which is kept as-is.
+	if err := f.sendDelete(ctx, userID, id); err != nil {
+		return err
+	}
+	return f.data.Delete(c, id)
+}
+
+// sendDelete delivers a Delete of the user's content to their followers.
+func (f *Framework) sendDelete(ctx context.Context, userID paths.UUID, id *url.URL) error {
+	del := streams.NewActivityStreamsDelete()
+
+	me := streams.NewActivityStreamsActorProperty()
+	me.AppendIRI(f.UserIRI(userID))
+	del.SetActivityStreamsActor(me)
+
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(id)
+	del.SetActivityStreamsObject(op)
+
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(paths.UserIRIFor(f.scheme, f.host, paths.FollowersPathKey, paths.Actor(userID)))
+	del.SetActivityStreamsTo(to)
+
+	return f.Send(ctx, userID, del)
+}
+
+func (f *Framework) Announce(ctx context.Context, userID paths.UUID, object *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot Announce: called when federation is not enabled")
+	}
+	myIRI := f.UserIRI(userID)
+	c := util.Context{ctx}
+
+	// Build the Announce
+	announce := streams.NewActivityStreamsAnnounce()
+
+	me := streams.NewActivityStreamsActorProperty()
+	me.AppendIRI(myIRI)
+	announce.SetActivityStreamsActor(me)
+
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(object)
+	announce.SetActivityStreamsObject(op)
+
+	public, err := url.Parse(pub.PublicActivityPubIRI)
+	if err != nil {
+		return err
+	}
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(public)
+	announce.SetActivityStreamsTo(to)
+
+	cc := streams.NewActivityStreamsCcProperty()
+	cc.AppendIRI(paths.UserIRIFor(f.scheme, f.host, paths.FollowersPathKey, paths.Actor(userID)))
+	authors, err := f.knownAttributedTo(c, object)
+	if err != nil {
+		return err
+	}
+	for _, author := range authors {
+		if author.String() != myIRI.String() {
+			cc.AppendIRI(author)
+		}
+	}
+	announce.SetActivityStreamsCc(cc)
+
+	// Deliver the Announce, which adds it to the shares collection of a
+	// local object.
+	return f.Send(ctx, userID, announce)
+}
+
+func (f *Framework) Undo(ctx context.Context, userID paths.UUID, activityIRI *url.URL) error {
+	if !f.federationEnabled {
+		return fmt.Errorf("cannot Undo: called when federation is not enabled")
+	} else if !f.data.Owns(activityIRI) {
+		return fmt.Errorf("cannot Undo: %s is not a local activity", activityIRI)
+	}
+	myIRI := f.UserIRI(userID)
+	c := util.Context{ctx}
+	t, err := f.data.Get(c, activityIRI)
+	if err != nil {
+		return err
+	}
+	switch t.GetTypeName() {
+	case "Follow", "Like", "Announce", "Block":
+	default:
+		return fmt.Errorf("cannot Undo: %s is a %s, not a Follow, Like, Announce, or Block", activityIRI, t.GetTypeName())
+	}
+	activity, ok := t.(undoable)
+	if !ok {
+		return fmt.Errorf("cannot Undo: %s is not an activity", activityIRI)
+	} else if sent, err := isSentBy(activity, myIRI); err != nil {
+		return err
+	} else if !sent {
+		return fmt.Errorf("cannot Undo: %s was not sent by %s", activityIRI, myIRI)
+	}
+
+	// Build the Undo, addressed to the recipients of the original activity
+	// as well as the actors that were followed or blocked.
+	undo := streams.NewActivityStreamsUndo()
+
+	me := streams.NewActivityStreamsActorProperty()
+	me.AppendIRI(myIRI)
+	undo.SetActivityStreamsActor(me)
+
+	// The undone activity is embedded, as peers such as Mastodon do not
+	// dereference it.
+	op := streams.NewActivityStreamsObjectProperty()
+	if err := op.AppendType(t); err != nil {
+		return err
+	}
+	undo.SetActivityStreamsObject(op)
+
+	to := streams.NewActivityStreamsToProperty()
+	seen := make(map[string]bool)
+	addTo := func(id *url.URL) {
+		if !seen[id.String()] {
+			seen[id.String()] = true
+			to.AppendIRI(id)
+		}
+	}
+	if p := activity.GetActivityStreamsTo(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			addTo(id)
+		}
+	}
+	if name := t.GetTypeName(); name == "Follow" || name == "Block" {
+		if p := activity.GetActivityStreamsObject(); p != nil {
+			for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+				id, err := pub.ToId(iter)
+				if err != nil {
+					return err
+				}
+				addTo(id)
+			}
+		}
+	}
+	undo.SetActivityStreamsTo(to)
+	if p := activity.GetActivityStreamsCc(); p != nil && p.Len() > 0 {
+		cc := streams.NewActivityStreamsCcProperty()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			if !seen[id.String()] {
+				cc.AppendIRI(id)
+			}
+		}
+		undo.SetActivityStreamsCc(cc)
+	}
+
+	// Deliver the Undo, which also applies its side effects to the
+	// following, liked, and shares collections.
+	if err := f.Send(ctx, userID, undo); err != nil {
+		return err
+	}
+	if t.GetTypeName() != "Block" {
+		return nil
+	}
+	// Undoing a Block also unblocks its objects.
+	if p := activity.GetActivityStreamsObject(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return err
+			}
+			if _, err := f.blocks.Unblock(c, myIRI, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// undoable is an activity that may be undone.
+type undoable interface {
+	vocab.Type
+	GetActivityStreamsActor() vocab.ActivityStreamsActorProperty
+	GetActivityStreamsObject() vocab.ActivityStreamsObjectProperty
+	GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+	GetActivityStreamsCc() vocab.ActivityStreamsCcProperty
+}
+
+// isSentBy determines whether the actor is one of the actors of the activity.
+func isSentBy(activity undoable, actor *url.URL) (bool, error) {
+	ap := activity.GetActivityStreamsActor()
+	if ap == nil {
+		return false, nil
+	}
+	for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return false, err
+		} else if id.String() == actor.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// knownAttributedTo returns the actors the object is attributed to, if the
+// object is known to this server.
+func (f *Framework) knownAttributedTo(c util.Context, object *url.URL) ([]*url.URL, error) {
+	if exists, err := f.data.Exists(c, object); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, nil
+	}
+	t, err := f.data.Get(c, object)
+	if err != nil {
+		return nil, err
+	}
+	return services.AttributedTo(t)
+}
+
+// isAttributedTo determines whether the value is attributed to the actor, or
+// for an activity without any attributedTo, whether it is one of its actors. A
+// value with neither is not attributed to anyone.
+func isAttributedTo(t vocab.Type, actor *url.URL) (bool, error) {
+	var authors []pub.IdProperty
+	if a, ok := t.(interface {
+		GetActivityStreamsAttributedTo() vocab.ActivityStreamsAttributedToProperty
+	}); ok {
+		if attr := a.GetActivityStreamsAttributedTo(); attr != nil {
+			for iter := attr.Begin(); iter != attr.End(); iter = iter.Next() {
+				authors = append(authors, iter)
+			}
+		}
+	}
+	if a, ok := t.(interface {
+		GetActivityStreamsActor() vocab.ActivityStreamsActorProperty
+	}); ok && len(authors) == 0 {
+		if ap := a.GetActivityStreamsActor(); ap != nil {
+			for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+				authors = append(authors, iter)
+			}
+		}
+	}
+	for _, p := range authors {
+		id, err := pub.ToId(p)
+		if err != nil {
+			return false, err
+		} else if id.String() == actor.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (f *Framework) getValidFollow(ctx context.Context, userIRI *url.URL, followIRI *url.URL) (vocab.ActivityStreamsFollow, error) {
 	// Fetch the Follow from our database
 	tFollow, err := f.GetByIRI(ctx, followIRI)
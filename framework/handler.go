@@ -19,9 +19,14 @@ package framework
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,9 +38,11 @@ import (
 	"github.com/go-fed/apcore/framework/oauth2"
 	"github.com/go-fed/apcore/framework/web"
 	"github.com/go-fed/apcore/framework/webfinger"
+	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -44,6 +51,13 @@ const (
 	LoginFormPasswordKey = "password"
 )
 
+const (
+	RegisterFormUsernameKey = "username"
+	RegisterFormEmailKey    = "email"
+	RegisterFormPasswordKey = "password"
+	RegisterFormInviteKey   = "invite"
+)
+
 func BuildHandler(r *Router,
 	internalErrorHandler http.Handler,
 	badRequestHandler http.Handler,
@@ -61,7 +75,16 @@ func BuildHandler(r *Router,
 	following *services.Following,
 	followers *services.Followers,
 	liked *services.Liked,
+	featuredTags *services.FeaturedTags,
+	featured *services.Featured,
+	replies *services.Replies,
+	media *services.Media,
+	emoji *services.Emoji,
+	invites *services.Invites,
+	reports *services.Reports,
 	sqldb *sql.DB,
+	health *Health,
+	ro *ReadOnly,
 	oauth *oauth2.Server,
 	sl *web.Sessions,
 	fw *Framework,
@@ -82,29 +105,42 @@ func BuildHandler(r *Router,
 	}
 
 	// Dynamic Routes
+	// Health checks
+	if p := c.ServerConfig.LivenessPath; len(p) > 0 {
+		r.HandleFunc(p, health.Live).Methods("GET", "HEAD")
+	}
+	if p := c.ServerConfig.ReadinessPath; len(p) > 0 {
+		r.HandleFunc(p, health.Ready).Methods("GET", "HEAD")
+	}
+
 	// Host-meta
 	r.WebOnlyHandleFunc("/.well-known/host-meta",
 		hostMetaHandler(scheme, c.ServerConfig.Host))
 
 	// Webfinger
 	r.WebOnlyHandleFunc("/.well-known/webfinger",
-		webfingerHandler(scheme, c.ServerConfig.Host, badRequestHandler, internalErrorHandler, users))
+		webfingerHandler(scheme, c.ServerConfig.Host, c.ActivityPubConfig.WebfingerMaxAgeSeconds, badRequestHandler, internalErrorHandler, users))
 
 	// Node-info
-	for _, ph := range nodeinfo.GetNodeInfoHandlers(c.NodeInfoConfig, scheme, c.ServerConfig.Host, ni, users, sw, apcore) {
+	for _, ph := range nodeinfo.GetNodeInfoHandlers(c.NodeInfoConfig, scheme, c.ServerConfig.Host, ni, users, clock, sw, apcore) {
 		r.WebOnlyHandleFunc(ph.Path, ph.Handler)
 	}
 
 	// Built-in routes for users, default supported:
 	// - PostInbox
+	// - PostSharedInbox
 	// - PostOutbox
 	// - GetInbox
 	// - GetOutbox
 	// - Followers
 	// - Following
 	// - Liked
+	// - FeaturedTags
+	// - Featured
+	// - Replies
 	if sa, isS2S := a.(app.S2SApplication); isS2S {
 		r.userActorPostInbox()
+		r.sharedInboxPost()
 		r.userActorGetInbox(sa.GetInboxWebHandlerFunc(fr))
 	}
 	r.userActorGetOutbox(a.GetOutboxWebHandlerFunc(fr))
@@ -112,13 +148,29 @@ func BuildHandler(r *Router,
 		r.userActorPostOutbox()
 	}
 
+	// Unless configured otherwise, collections requested without any
+	// paging parameters are served as their root, which links to their
+	// first and last pages, instead of as their first page.
+	shellOrNil := func(shell CollectionShellFn) CollectionShellFn {
+		if !c.ActivityPubConfig.ServeCollectionRoots {
+			return nil
+		}
+		return shell
+	}
 	defaultCollectionSize := c.DatabaseConfig.DefaultCollectionPageSize
 	maxCollectionPageSize := c.DatabaseConfig.MaxCollectionPageSize
+	// An application may return a nil web handler for a collection, in
+	// which case the collection is still served to ActivityStreams
+	// requests while web requests for it are not found. A nil
+	// AuthorizeFunc permits public access.
 	addCollectionPageWebFn := func(path string,
 		f func(app.Framework) (app.CollectionPageHandlerFunc, app.AuthorizeFunc),
+		sizes func() (int, int),
 		any services.AnyCPageFn,
-		last services.LastCPageFn) {
+		last services.LastCPageFn,
+		shell CollectionShellFn) {
 		web, authFn := f(fr)
+		defaultSize, maxSize := sizes()
 		fetch := func(ctx util.Context) (vocab.ActivityStreamsCollectionPage, error) {
 			iri, err := ctx.CompleteRequestURL()
 			if err != nil {
@@ -126,33 +178,79 @@ func BuildHandler(r *Router,
 			}
 			return services.DoCollectionPagination(ctx,
 				iri,
-				defaultCollectionSize,
-				maxCollectionPageSize,
+				defaultSize,
+				maxSize,
 				any,
 				last)
 		}
-		r.apWebCollectionPageFetchingHandleFunc(path, authFn, web, fetch)
+		r.apWebCollectionPageFetchingHandleFunc(path, authFn, web, fetch, shellOrNil(shell))
 	}
 	addCollectionPageWebFn(paths.Route(paths.FollowersPathKey),
 		a.GetFollowersWebHandlerFunc,
+		c.DatabaseConfig.FollowersPageSizes,
 		followers.GetPage,
-		followers.GetLastPage)
+		followers.GetLastPage,
+		followers.GetShell)
 	addCollectionPageWebFn(paths.Route(paths.FollowingPathKey),
 		a.GetFollowingWebHandlerFunc,
+		c.DatabaseConfig.FollowingPageSizes,
 		following.GetPage,
-		following.GetLastPage)
+		following.GetLastPage,
+		following.GetShell)
 	addCollectionPageWebFn(paths.Route(paths.LikedPathKey),
 		a.GetLikedWebHandlerFunc,
+		c.DatabaseConfig.LikedPageSizes,
 		liked.GetPage,
-		liked.GetLastPage)
+		liked.GetLastPage,
+		liked.GetShell)
+	// FeaturedTags are only served to ActivityPub requests, as the
+	// application has no web handler for them.
+	r.apWebCollectionPageFetchingHandleFunc(paths.Route(paths.FeaturedTagsPathKey),
+		nil,
+		nil,
+		func(ctx util.Context) (vocab.ActivityStreamsCollectionPage, error) {
+			iri, err := ctx.CompleteRequestURL()
+			if err != nil {
+				return nil, err
+			}
+			return services.DoCollectionPagination(ctx,
+				iri,
+				defaultCollectionSize,
+				maxCollectionPageSize,
+				featuredTags.GetPage,
+				featuredTags.GetLastPage)
+		},
+		shellOrNil(featuredTags.GetShell))
+	// The featured collection is likewise only served to ActivityPub
+	// requests.
+	r.apWebCollectionPageFetchingHandleFunc(paths.Route(paths.FeaturedPathKey),
+		nil,
+		nil,
+		func(ctx util.Context) (vocab.ActivityStreamsCollectionPage, error) {
+			iri, err := ctx.CompleteRequestURL()
+			if err != nil {
+				return nil, err
+			}
+			return services.DoCollectionPagination(ctx,
+				iri,
+				defaultCollectionSize,
+				maxCollectionPageSize,
+				featured.GetPage,
+				featured.GetLastPage)
+		},
+		shellOrNil(featured.GetShell))
+	// Replies of local objects are only served to ActivityPub requests, and
+	// exist once an object is first replied to.
+	r.getReplies(replies.Exists)
 	addVocabTypeWebFn := func(path string,
 		f func(app.Framework) (app.VocabHandlerFunc, app.AuthorizeFunc),
-		get func(util.Context) (vocab.Type, error)) {
+		get func(util.Context) (vocab.Type, error),
+		enhance VocabEnhanceFn) {
 		web, authFn := f(fr)
 		fetch := func(ctx util.Context) (vocab.Type, error) {
 			return get(ctx)
 		}
-		r.apWebVocabFetchingHandleFunc(path, authFn, web, fetch)
+		r.apWebVocabFetchingHandleFunc(path, authFn, web, fetch, enhance)
 	}
 	addVocabTypeWebFn(paths.Route(paths.UserPathKey), a.GetUserWebHandlerFunc, func(ctx util.Context) (vocab.Type, error) {
 		id, err := ctx.UserPathUUID()
@@ -164,7 +262,7 @@ func BuildHandler(r *Router,
 			return nil, err
 		}
 		return u.Actor, nil
-	})
+	}, actorEnhancer(a))
 
 	// Built-in routes for non-user actors
 	for _, k := range paths.AllActors {
@@ -175,9 +273,124 @@ func BuildHandler(r *Router,
 		r.knownActorGetOutbox(k, nil)
 	}
 
+	// Uploaded media
+	if media != nil {
+		r.NewRoute().
+			Path(paths.MediaRoute).
+			Methods("GET", "HEAD").
+			HandlerFunc(
+				mediaHandler(media, false, r.notFoundHandler, internalErrorHandler))
+		r.NewRoute().
+			Path(paths.MediaThumbnailRoute).
+			Methods("GET", "HEAD").
+			HandlerFunc(
+				mediaHandler(media, true, r.notFoundHandler, internalErrorHandler))
+	}
+
+	// Custom emoji
+	r.NewRoute().
+		Path(paths.EmojiRoute).
+		Methods("GET").
+		HandlerFunc(
+			emojiHandler(emoji, false, r.notFoundHandler, internalErrorHandler))
+	r.NewRoute().
+		Path(paths.EmojiItemRoute).
+		Methods("GET").
+		HandlerFunc(
+			emojiHandler(emoji, true, r.notFoundHandler, internalErrorHandler))
+
+	// Delivery status of activities sent by users
+	if _, isS2S := a.(app.S2SApplication); isS2S {
+		r.NewRoute().
+			Path(paths.ActivityDeliveriesRoute).
+			Methods("GET").
+			HandlerFunc(
+				deliveryStatusHandler(scheme, c.ServerConfig.Host, oauth, fr, r.notFoundHandler, internalErrorHandler))
+	}
+
+	// Activity of users over time, for administrators
+	r.NewRoute().
+		Path(paths.AdminActivityStatsRoute).
+		Methods("GET").
+		HandlerFunc(
+			activityStatsHandler(oauth, users, badRequestHandler, r.notFoundHandler, internalErrorHandler))
+
+	// Invite codes for registering, for administrators
+	r.NewRoute().
+		Path(paths.AdminInvitesRoute).
+		Methods("GET").
+		HandlerFunc(
+			getInvitesHandler(oauth, users, invites, r.notFoundHandler, internalErrorHandler))
+	r.NewRoute().
+		Path(paths.AdminInvitesRoute).
+		Methods("POST").
+		HandlerFunc(
+			postInvitesHandler(oauth, users, invites, badRequestHandler, r.notFoundHandler, internalErrorHandler))
+
+	// Third-party applications authorized by the user
+	r.NewRoute().
+		Path(paths.SettingsAppsRoute).
+		Methods("GET").
+		HandlerFunc(
+			getAppsHandler(oauth, internalErrorHandler))
+	r.NewRoute().
+		Path(paths.SettingsRevokeAppRoute).
+		Methods("POST").
+		HandlerFunc(
+			revokeAppHandler(oauth, r.notFoundHandler, internalErrorHandler))
+
+	// Reports of content awaiting moderation, for administrators
+	r.NewRoute().
+		Path(paths.AdminReportsRoute).
+		Methods("GET").
+		HandlerFunc(
+			getReportsHandler(oauth, users, reports, badRequestHandler, r.notFoundHandler, internalErrorHandler))
+	r.NewRoute().
+		Path(paths.AdminResolveReportRoute).
+		Methods("POST").
+		HandlerFunc(
+			resolveReportHandler(oauth, users, reports, r.notFoundHandler, internalErrorHandler))
+
+	// Subscriptions to relays, for administrators
+	r.NewRoute().
+		Path(paths.AdminRelaysRoute).
+		Methods("GET").
+		HandlerFunc(
+			getRelaysHandler(oauth, users, fw, r.notFoundHandler, internalErrorHandler))
+	r.NewRoute().
+		Path(paths.AdminRelaysRoute).
+		Methods("POST").
+		HandlerFunc(
+			subscribeRelayHandler(oauth, users, fw, badRequestHandler, r.notFoundHandler, internalErrorHandler))
+	r.NewRoute().
+		Path(paths.AdminUnsubscribeRelayRoute).
+		Methods("POST").
+		HandlerFunc(
+			unsubscribeRelayHandler(oauth, users, fw, badRequestHandler, r.notFoundHandler, internalErrorHandler))
+
+	// Delivery attempts with their payloads, for administrators debugging
+	// deliveries to peers
+	r.NewRoute().
+		Path(paths.AdminDeliveryAttemptRoute).
+		Methods("GET").
+		HandlerFunc(
+			deliveryAttemptHandler(oauth, users, fw.deliveryAttempts, r.notFoundHandler, internalErrorHandler))
+
 	// Obtain the application's paths.
 	pt := a.Paths()
 
+	// Read-only mode, which administrators can toggle at runtime.
+	r.NewRoute().
+		Path(paths.AdminReadOnlyRoute).
+		Methods("GET").
+		HandlerFunc(
+			getReadOnlyHandler(oauth, users, ro, r.notFoundHandler, internalErrorHandler))
+	r.NewRoute().
+		Path(paths.AdminReadOnlyRoute).
+		Methods("POST").
+		HandlerFunc(
+			postReadOnlyHandler(oauth, users, ro, badRequestHandler, r.notFoundHandler, internalErrorHandler))
+
 	// POST/GET login, logout, and OAuth2 routes
 	r.NewRoute().
 		Path(pt.GetLoginPath()).
@@ -189,6 +402,19 @@ func BuildHandler(r *Router,
 		Methods("POST").
 		HandlerFunc(
 			postLoginFn(oauth, sl, db, badRequestHandler, internalErrorHandler, cy, pt))
+	if rg, ok := a.(app.Registrar); ok {
+		getRegisterWebHandler := rg.GetRegisterWebHandlerFunc(fr)
+		r.NewRoute().
+			Path(pt.GetRegisterPath()).
+			Methods("GET").
+			HandlerFunc(
+				getRegisterFn(users, getRegisterWebHandler, internalErrorHandler))
+		r.NewRoute().
+			Path(pt.PostRegisterPath()).
+			Methods("POST").
+			HandlerFunc(
+				postRegisterFn(users, invites, fr, rg, getRegisterWebHandler, badRequestHandler, internalErrorHandler, pt))
+	}
 	r.NewRoute().
 		Path(pt.GetLogoutPath()).
 		Methods("GET").
@@ -205,8 +431,8 @@ func BuildHandler(r *Router,
 		HandlerFunc(
 			postAuthFn(oauth, sl, db, badRequestHandler, internalErrorHandler, cy))
 	r.NewRoute().
-		Path("/oauth2/token").
-		Methods("GET").
+		Path(paths.OAuth2TokenRoute).
+		Methods("POST").
 		HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
 				oauth.HandleAccessTokenRequest(w, r)
@@ -218,7 +444,20 @@ func BuildHandler(r *Router,
 		return
 	}
 
+	// Crawler rules and landing redirect, unless served by the application
+	if !r.isRouted(paths.RobotsRoute) {
+		r.WebOnlyHandleFunc(paths.RobotsRoute, robotsHandler(c.ServerConfig.Robots)).Methods("GET", "HEAD")
+	}
+	if to := c.ServerConfig.RootRedirect; len(to) > 0 && !r.isRouted("/") {
+		r.WebOnlyHandleFunc("/", rootRedirectHandler(to)).Methods("GET", "HEAD")
+	}
+
 	// Middleweare
+	r.Use(contentNegotiation(c.ServerConfig.AllowFormatJSON))
+	if jc, ok := a.(app.JSONLDContexter); ok {
+		r.Use(jsonLDContexts(jc.JSONLDContexts()))
+	}
+	r.Use(ro.Middleware)
 	r.Use(getFirstPartyCredRefreshFn(oauth, sl))
 
 	if debug {
@@ -256,7 +495,12 @@ func BuildHandler(r *Router,
 		}
 	}
 
-	rt = r.router
+	var trusted []*net.IPNet
+	trusted, err = parseTrustedProxies(c.ServerConfig.TrustedProxies)
+	if err != nil {
+		return
+	}
+	rt = trustedProxyHandler(trusted, r.router)
 	return
 }
 
@@ -309,6 +553,30 @@ func getFirstPartyCredRefreshFn(o *oauth2.Server, s *web.Sessions) func(http.Han
 	}
 }
 
+// actorEnhancer applies the application's ActorEnhancer, if any, to the actors
+// of users before they are served. Errors are logged and the stored actor is
+// served instead.
+func actorEnhancer(a app.Application) VocabEnhanceFn {
+	ae, ok := a.(app.ActorEnhancer)
+	if !ok {
+		return nil
+	}
+	return func(c util.Context, t vocab.Type) (vocab.Type, error) {
+		uuid, err := c.UserPathUUID()
+		if err != nil {
+			return nil, err
+		}
+		enhanced, err := ae.EnhanceActor(c.Context, uuid, t)
+		if err != nil {
+			util.ErrorLogger.Warningf("Error enhancing actor for user %s, serving it unmodified: %s", uuid, err)
+			return t, nil
+		} else if enhanced == nil {
+			return t, nil
+		}
+		return enhanced, nil
+	}
+}
+
 func hostMetaHandler(scheme, host string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/xrd+xml")
@@ -326,7 +594,7 @@ func hostMetaHandler(scheme, host string) func(w http.ResponseWriter, r *http.Re
 	}
 }
 
-func webfingerHandler(scheme, host string, badRequestHandler, internalErrorHandler http.Handler, users *services.Users) func(http.ResponseWriter, *http.Request) {
+func webfingerHandler(scheme, host string, maxAge int, badRequestHandler, internalErrorHandler http.Handler, users *services.Users) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vals := r.URL.Query()
 		userAccts := strings.Split(
@@ -358,16 +626,633 @@ func webfingerHandler(scheme, host string, badRequestHandler, internalErrorHandl
 			return
 		}
 		w.Header().Set("Content-Type", "application/jrd+json")
+		if err := web.WriteCacheable(w, r, b, maxAge); err != nil {
+			util.ErrorLogger.Errorf("error writing webfinger response: %s", err)
+		}
+	}
+}
+
+// deliveryStatusHandler serves the state of delivering an activity to each of
+// its recipients. Only the user that sent the activity may view it.
+func deliveryStatusHandler(scheme, host string, oauth *oauth2.Server, fr app.Framework, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, authenticated, err := oauth.Validate(w, r)
+		if err != nil {
+			util.ErrorLogger.Errorf("error validating in delivery status: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		} else if !authenticated {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		c := util.Context{r.Context()}
+		activityIRI := &url.URL{
+			Scheme: scheme,
+			Host:   host,
+			Path:   strings.TrimSuffix(r.URL.Path, "/deliveries"),
+		}
+		t, err := fr.GetByIRI(c, activityIRI)
+		if err != nil {
+			util.InfoLogger.Infof("delivery status requested for unknown activity %s: %s", activityIRI, err)
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		if owned, err := hasActor(t, fr.UserIRI(paths.UUID(userID))); err != nil {
+			util.ErrorLogger.Errorf("error determining owner of activity in delivery status: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		} else if !owned {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		dr, err := fr.DeliveryStatus(c, activityIRI)
+		if err != nil {
+			util.ErrorLogger.Errorf("error fetching delivery status: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		b, err := json.Marshal(dr)
+		if err != nil {
+			util.ErrorLogger.Errorf("error serving delivery status while marshalling: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		n, err := w.Write(b)
 		if err != nil {
-			util.ErrorLogger.Errorf("error writing webfinger response: %s", err)
+			util.ErrorLogger.Errorf("error writing delivery status response: %s", err)
 		} else if n != len(b) {
-			util.ErrorLogger.Errorf("error writing webfinger response: wrote %d of %d bytes", n, len(b))
+			util.ErrorLogger.Errorf("error writing delivery status response: wrote %d of %d bytes", n, len(b))
+		}
+	}
+}
+
+// authorizeAdmin determines whether the request is made by an administrator,
+// returning their user. Otherwise, the request is responded to as if the route
+// does not exist.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, oauth *oauth2.Server, users *services.Users, notFoundHandler, internalErrorHandler http.Handler) (paths.UUID, bool) {
+	userID, authenticated, err := oauth.Validate(w, r)
+	if err != nil {
+		util.ErrorLogger.Errorf("error validating admin request: %s", err)
+		internalErrorHandler.ServeHTTP(w, r)
+		return "", false
+	} else if !authenticated {
+		notFoundHandler.ServeHTTP(w, r)
+		return "", false
+	}
+	p, err := users.Privileges(util.Context{r.Context()}, userID, nil)
+	if err != nil {
+		util.ErrorLogger.Errorf("error fetching privileges of admin request: %s", err)
+		internalErrorHandler.ServeHTTP(w, r)
+		return "", false
+	} else if !p.Admin {
+		notFoundHandler.ServeHTTP(w, r)
+		return "", false
+	}
+	return paths.UUID(userID), true
+}
+
+// writeJSON responds with the value serialized as JSON.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}, name string, internalErrorHandler http.Handler) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		util.ErrorLogger.Errorf("error serving %s while marshalling: %s", name, err)
+		internalErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	n, err := w.Write(b)
+	if err != nil {
+		util.ErrorLogger.Errorf("error writing %s response: %s", name, err)
+	} else if n != len(b) {
+		util.ErrorLogger.Errorf("error writing %s response: wrote %d of %d bytes", name, n, len(b))
+	}
+}
+
+// getInvitesHandler serves every invite code as JSON. Only administrators may
+// view them.
+func getInvitesHandler(oauth *oauth2.Server, users *services.Users, invites *services.Invites, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		iv, err := invites.GetAll(util.Context{r.Context()})
+		if err != nil {
+			util.ErrorLogger.Errorf("error fetching invites: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, iv, "invites", internalErrorHandler)
+	}
+}
+
+// postInvitesHandler mints an invite code, responding with its code as JSON.
+// Only administrators may mint them.
+//
+// The "maxUses" form value is the number of times it may be used, defaulting
+// to one, and the "expires" form value is an optional RFC 3339 timestamp after
+// which it may no longer be used.
+func postInvitesHandler(oauth *oauth2.Server, users *services.Users, invites *services.Invites, badRequestHandler, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		}
+		maxUses := 1
+		if v := r.Form.Get("maxUses"); len(v) > 0 {
+			var err error
+			if maxUses, err = strconv.Atoi(v); err != nil {
+				badRequestHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		var expires time.Time
+		if v := r.Form.Get("expires"); len(v) > 0 {
+			var err error
+			if expires, err = time.Parse(time.RFC3339, v); err != nil {
+				badRequestHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		code, err := invites.Create(util.Context{r.Context()}, adminID, maxUses, expires)
+		if err == services.InvalidInviteMaxUses {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			util.ErrorLogger.Errorf("error creating invite: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusCreated, map[string]string{"code": code}, "invite", internalErrorHandler)
+	}
+}
+
+// getReportsHandler serves the reports of content as JSON, oldest first. Only
+// administrators may view them.
+//
+// The "status" query parameter is either "open" or "resolved", defaulting to
+// "open".
+func getReportsHandler(oauth *oauth2.Server, users *services.Users, reports *services.Reports, badRequestHandler, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		status := r.URL.Query().Get("status")
+		if len(status) == 0 {
+			status = services.ReportOpen
 		}
+		rp, err := reports.GetByStatus(util.Context{r.Context()}, status)
+		if err == services.InvalidReportStatus {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			util.ErrorLogger.Errorf("error fetching reports: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, rp, "reports", internalErrorHandler)
 	}
 }
 
+// resolveReportHandler marks an open report as resolved by the administrator.
+// Reports that do not exist or are already resolved are not found.
+func resolveReportHandler(oauth *oauth2.Server, users *services.Users, reports *services.Reports, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler)
+		if !ok {
+			return
+		}
+		id := mux.Vars(r)["id"]
+		if _, err := uuid.Parse(id); err != nil {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		err := reports.Resolve(util.Context{r.Context()}, id, adminID)
+		if err == services.ReportNotOpen {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			util.ErrorLogger.Errorf("error resolving report: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// getRelaysHandler serves the server's subscriptions to relays as JSON, oldest
+// first. Only administrators may view them.
+func getRelaysHandler(oauth *oauth2.Server, users *services.Users, fw *Framework, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		rl, err := fw.Relays(r.Context())
+		if err != nil {
+			util.ErrorLogger.Errorf("error fetching relays: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, rl, "relays", internalErrorHandler)
+	}
+}
+
+// relayInboxFormValue parses the "inbox" form value, which is the absolute IRI
+// of a relay's inbox.
+func relayInboxFormValue(r *http.Request) (*url.URL, bool) {
+	if err := r.ParseForm(); err != nil {
+		return nil, false
+	}
+	inbox, err := url.Parse(r.Form.Get("inbox"))
+	if err != nil || !inbox.IsAbs() || len(inbox.Host) == 0 {
+		return nil, false
+	}
+	return inbox, true
+}
+
+// subscribeRelayHandler subscribes the server to the relay with the inbox in
+// the "inbox" form value. Only administrators may subscribe.
+func subscribeRelayHandler(oauth *oauth2.Server, users *services.Users, fw *Framework, badRequestHandler, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		inbox, ok := relayInboxFormValue(r)
+		if !ok {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		}
+		if err := fw.SubscribeRelay(r.Context(), inbox); err != nil {
+			util.ErrorLogger.Errorf("error subscribing to relay %s: %s", inbox, err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// unsubscribeRelayHandler unsubscribes the server from the relay with the inbox
+// in the "inbox" form value. Relays the server is not subscribed to are not
+// found.
+func unsubscribeRelayHandler(oauth *oauth2.Server, users *services.Users, fw *Framework, badRequestHandler, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		inbox, ok := relayInboxFormValue(r)
+		if !ok {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		}
+		err := fw.UnsubscribeRelay(r.Context(), inbox)
+		if err == services.RelayNotFound {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			util.ErrorLogger.Errorf("error unsubscribing from relay %s: %s", inbox, err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deliveryAttemptHandler serves a single delivery attempt as JSON, including
+// the exact payload that was sent to the peer and the signed headers of the
+// latest request that sent it. Only administrators may view them.
+func deliveryAttemptHandler(oauth *oauth2.Server, users *services.Users, attempts *services.DeliveryAttempts, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		id := mux.Vars(r)["id"]
+		if _, err := uuid.Parse(id); err != nil {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		da, err := attempts.GetAttempt(util.Context{r.Context()}, id)
+		if err == services.DeliveryAttemptNotFound {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			util.ErrorLogger.Errorf("error fetching delivery attempt: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, da, "delivery attempt", internalErrorHandler)
+	}
+}
+
+// authorizeUser determines the user that authenticated the request,
+// responding with 401 Unauthorized when it is anonymous.
+func authorizeUser(w http.ResponseWriter, r *http.Request, oauth *oauth2.Server, internalErrorHandler http.Handler) (paths.UUID, bool) {
+	userID, authenticated, err := oauth.Validate(w, r)
+	if err != nil {
+		util.ErrorLogger.Errorf("error validating user request: %s", err)
+		internalErrorHandler.ServeHTTP(w, r)
+		return "", false
+	} else if !authenticated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+	return paths.UUID(userID), true
+}
+
+// getAppsHandler serves the third-party applications the user has authorized
+// as JSON.
+func getAppsHandler(oauth *oauth2.Server, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := authorizeUser(w, r, oauth, internalErrorHandler)
+		if !ok {
+			return
+		}
+		ca, err := oauth.Authorizations(util.Context{r.Context()}, string(userID))
+		if err != nil {
+			util.ErrorLogger.Errorf("error fetching authorized apps: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, toClientAuthorizations(ca), "authorized apps", internalErrorHandler)
+	}
+}
+
+// revokeAppHandler revokes the tokens the user has granted to a third-party
+// application. Applications without any are not found.
+func revokeAppHandler(oauth *oauth2.Server, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := authorizeUser(w, r, oauth, internalErrorHandler)
+		if !ok {
+			return
+		}
+		revoked, err := oauth.RevokeAuthorization(util.Context{r.Context()}, string(userID), mux.Vars(r)["client"])
+		if err != nil {
+			util.ErrorLogger.Errorf("error revoking authorized app: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		} else if !revoked {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// readOnlyStatus is the state of read-only mode served to administrators.
+type readOnlyStatus struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+// getReadOnlyHandler serves whether the server is in read-only mode as JSON.
+// Only administrators may view it.
+func getReadOnlyHandler(oauth *oauth2.Server, users *services.Users, ro *ReadOnly, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		writeJSON(w, r, http.StatusOK, readOnlyStatus{ro.Enabled()}, "read-only mode", internalErrorHandler)
+	}
+}
+
+// postReadOnlyHandler enables or disables read-only mode according to the
+// boolean "enabled" form value, responding with the new state as JSON. Only
+// administrators may toggle it.
+func postReadOnlyHandler(oauth *oauth2.Server, users *services.Users, ro *ReadOnly, badRequestHandler, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		}
+		enabled, err := strconv.ParseBool(r.Form.Get("enabled"))
+		if err != nil {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		}
+		ro.Set(enabled)
+		util.InfoLogger.Infof("Read-only mode set to %v by %s", enabled, adminID)
+		writeJSON(w, r, http.StatusOK, readOnlyStatus{ro.Enabled()}, "read-only mode", internalErrorHandler)
+	}
+}
+
+// defaultActivityStatsSpan is the range of time over which activity stats are
+// served when no start is requested.
+const defaultActivityStatsSpan = 30 * 24 * time.Hour
+
+// activityStatsHandler serves statistics about the activity of users over time
+// as JSON. Only administrators may view them.
+//
+// The "from" and "to" query parameters are RFC 3339 timestamps, defaulting to
+// the last 30 days, and the "bucket" query parameter is one of "hour", "day",
+// "week", or "month", defaulting to "day".
+func activityStatsHandler(oauth *oauth2.Server, users *services.Users, badRequestHandler, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorizeAdmin(w, r, oauth, users, notFoundHandler, internalErrorHandler); !ok {
+			return
+		}
+		c := util.Context{r.Context()}
+		vals := r.URL.Query()
+		var err error
+		to := time.Now()
+		if v := vals.Get("to"); len(v) > 0 {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				badRequestHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		from := to.Add(-defaultActivityStatsSpan)
+		if v := vals.Get("from"); len(v) > 0 {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				badRequestHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		bucket := vals.Get("bucket")
+		if len(bucket) == 0 {
+			bucket = "day"
+		}
+		stats, err := users.ActivityStatsRange(c, from, to, bucket)
+		if err == services.InvalidStatsBucket || err == services.InvalidStatsRange {
+			badRequestHandler.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			util.ErrorLogger.Errorf("error fetching activity stats: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, stats, "activity stats", internalErrorHandler)
+	}
+}
+
+// mediaHandler serves the contents of uploaded media, or of its thumbnail
+// whose largest dimension is given by the "size" query parameter.
+func mediaHandler(media *services.Media, thumbnail bool, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["media"]
+		if _, err := uuid.Parse(id); err != nil {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		var mf *services.MediaFile
+		var rc io.ReadCloser
+		var err error
+		if thumbnail {
+			var size int
+			if s := r.URL.Query().Get("size"); len(s) > 0 {
+				if size, err = strconv.Atoi(s); err != nil || size <= 0 {
+					http.Error(w, "size must be a positive integer", http.StatusBadRequest)
+					return
+				}
+			}
+			mf, rc, err = media.Thumbnail(util.Context{r.Context()}, id, size)
+			if err == services.MediaNotThumbnailable {
+				notFoundHandler.ServeHTTP(w, r)
+				return
+			}
+		} else {
+			mf, rc, err = media.Get(util.Context{r.Context()}, id)
+		}
+		if err != nil {
+			util.ErrorLogger.Errorf("error fetching media %s: %s", id, err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		} else if mf == nil {
+			notFoundHandler.ServeHTTP(w, r)
+			return
+		}
+		defer rc.Close()
+		w.Header().Set("Content-Type", mf.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(mf.Size, 10))
+		// Uploaded media is immutable, and must never be interpreted as
+		// anything other than its recorded content type.
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, rc); err != nil {
+			util.ErrorLogger.Errorf("error writing media %s response: %s", id, err)
+		}
+	}
+}
+
+// emojiHandler serves the collection of custom emoji, or a single custom emoji
+// named by its shortcode.
+func emojiHandler(emoji *services.Emoji, single bool, notFoundHandler, internalErrorHandler http.Handler) func(http.ResponseWriter, *http.Request) {
+	if notFoundHandler == nil {
+		notFoundHandler = http.NotFoundHandler()
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := util.Context{r.Context()}
+		var t vocab.Type
+		var err error
+		if single {
+			var e vocab.TootEmoji
+			if e, err = emoji.Get(c, mux.Vars(r)["shortcode"]); err == nil && e == nil {
+				notFoundHandler.ServeHTTP(w, r)
+				return
+			}
+			t = e
+		} else {
+			t, err = emoji.Collection(c)
+		}
+		if err != nil {
+			util.ErrorLogger.Errorf("error fetching custom emoji: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		b, err := models.Marshal(t)
+		if err != nil {
+			util.ErrorLogger.Errorf("error serving custom emoji while marshalling: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		w.WriteHeader(http.StatusOK)
+		n, err := w.Write(b)
+		if err != nil {
+			util.ErrorLogger.Errorf("error writing custom emoji response: %s", err)
+		} else if n != len(b) {
+			util.ErrorLogger.Errorf("error writing custom emoji response: wrote %d of %d bytes", n, len(b))
+		}
+	}
+}
+
+// hasActor determines whether the actor is one of the actors of the value.
+func hasActor(t vocab.Type, actor *url.URL) (bool, error) {
+	a, ok := t.(interface {
+		GetActivityStreamsActor() vocab.ActivityStreamsActorProperty
+	})
+	if !ok {
+		return false, nil
+	}
+	actors := a.GetActivityStreamsActor()
+	if actors == nil {
+		return false, nil
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return false, err
+		} else if id.String() == actor.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func getLoginFn(oauth *oauth2.Server, sl *web.Sessions, pt app.Paths, getLoginWebHandler http.Handler) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s, err := sl.Get(r)
@@ -460,6 +1345,98 @@ func postLoginFn(oauth *oauth2.Server, sl *web.Sessions, db pub.Database, badReq
 	}
 }
 
+// registrationsOpen determines whether the server's preferences permit
+// visitors to register their own accounts without an invite code.
+func registrationsOpen(c util.Context, users *services.Users) (bool, error) {
+	p, err := users.GetServerPreferences(c)
+	if err != nil {
+		return false, err
+	}
+	return p.OpenRegistrations, nil
+}
+
+func getRegisterFn(users *services.Users, getRegisterWebHandler http.Handler, internalErrorHandler http.Handler) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		open, err := registrationsOpen(util.Context{r.Context()}, users)
+		if err != nil {
+			util.ErrorLogger.Errorf("error determining whether registrations are open in GET register: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		getRegisterWebHandler.ServeHTTP(w, app.WithRegistrationInviteRequired(r, !open))
+	}
+}
+
+func postRegisterFn(users *services.Users, invites *services.Invites, fr app.Framework, rg app.Registrar, getRegisterWebHandler http.Handler, badRequestHandler, internalErrorHandler http.Handler, pt app.Paths) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := util.Context{r.Context()}
+		open, err := registrationsOpen(c, users)
+		if err != nil {
+			util.ErrorLogger.Errorf("error determining whether registrations are open in POST register: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		rejected := func(err error) {
+			getRegisterWebHandler.ServeHTTP(w, app.WithRegistrationError(app.WithRegistrationInviteRequired(r, !open), err))
+		}
+		if r.Form == nil {
+			if err := r.ParseForm(); err != nil {
+				badRequestHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		username := r.Form.Get(RegisterFormUsernameKey)
+		email := r.Form.Get(RegisterFormEmailKey)
+		password := r.Form.Get(RegisterFormPasswordKey)
+		invite := r.Form.Get(RegisterFormInviteKey)
+		if len(username) == 0 || len(email) == 0 || len(password) == 0 {
+			rejected(errors.New("a username, email, and password are required"))
+			return
+		} else if !open && len(invite) == 0 {
+			rejected(errors.New("an invite code is required"))
+			return
+		}
+		if err := rg.ValidateRegistration(c, r); err != nil {
+			util.InfoLogger.Infof("registration rejected by application: %s", err)
+			rejected(err)
+			return
+		}
+		if !open {
+			if err := invites.Consume(c, invite); err == services.InvalidInvite {
+				rejected(err)
+				return
+			} else if err != nil {
+				util.ErrorLogger.Errorf("error consuming invite in POST register: %s", err)
+				internalErrorHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+		_, err = fr.CreateUser(c, app.CreateUserParams{
+			Username: username,
+			Email:    email,
+			Password: password,
+		})
+		if err != nil && !open {
+			// The invite was not used after all.
+			if rErr := invites.Release(c, invite); rErr != nil {
+				util.ErrorLogger.Errorf("error releasing invite in POST register: %s", rErr)
+			}
+		}
+		if fr.IsNotUniqueUsername(err) {
+			rejected(errors.New("the username is already taken"))
+			return
+		} else if fr.IsNotUniqueEmail(err) {
+			rejected(errors.New("the email address is already registered"))
+			return
+		} else if err != nil {
+			util.ErrorLogger.Errorf("error creating user in POST register: %s", err)
+			internalErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		http.Redirect(w, r, pt.RedirectToLoginPath(r.URL.Path), http.StatusFound)
+	}
+}
+
 func getLogoutFn(oauth *oauth2.Server, sl *web.Sessions, pt app.Paths, internalErrorHandler http.Handler) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := util.Context{r.Context()}
@@ -0,0 +1,80 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-fed/apcore/util"
+)
+
+// readinessPingTimeout bounds how long a readiness check waits on the database.
+const readinessPingTimeout = 2 * time.Second
+
+// Health answers liveness and readiness probes, such as those of Kubernetes.
+//
+// The server is live whenever it is able to respond at all. It is only ready
+// once it has started, while the database responds, and until it begins to
+// shut down.
+type Health struct {
+	// Immutable
+	ping func(context.Context) error
+	// Mutable, atomically accessed
+	ready int32
+}
+
+// NewHealth creates a Health that checks the database with the ping function,
+// such as that of a *sql.DB.
+func NewHealth(ping func(context.Context) error) *Health {
+	return &Health{ping: ping}
+}
+
+func (h *Health) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&h.ready, v)
+}
+
+// Live responds that the process is alive, without depending on anything else.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// Ready responds whether the server is ready to serve requests, which is not
+// the case before it has started, once it is shutting down, or while the
+// database cannot be reached.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.ready) == 0 {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readinessPingTimeout)
+	defer cancel()
+	if err := h.ping(ctx); err != nil {
+		util.ErrorLogger.Errorf("Readiness check failed to ping the database: %s", err)
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
@@ -0,0 +1,82 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Pausable = &InboxProcessedPruner{}
+
+// inboxProcessedPrunePeriod is how often the processed activities of inboxes
+// are pruned.
+const inboxProcessedPrunePeriod = time.Hour
+
+// InboxProcessedPruner periodically forgets the activities processed by inboxes
+// longer ago than the configured retention, whose redelivery is no longer
+// expected.
+type InboxProcessedPruner struct {
+	clock       pub.Clock
+	idempotency *services.IdempotencyKeys
+	retention   time.Duration
+	pruneFn     *util.SafeStartStop
+}
+
+func NewInboxProcessedPruner(c *config.Config, clock pub.Clock, idempotency *services.IdempotencyKeys) *InboxProcessedPruner {
+	p := &InboxProcessedPruner{
+		clock:       clock,
+		idempotency: idempotency,
+		retention:   time.Duration(c.ActivityPubConfig.InboxProcessedRetentionHours) * time.Hour,
+	}
+	if p.retention > 0 {
+		p.pruneFn = util.NewSafeStartStop(p.prune, inboxProcessedPrunePeriod)
+	}
+	return p
+}
+
+func (p *InboxProcessedPruner) Start() {
+	if p.pruneFn != nil {
+		p.pruneFn.Start()
+	}
+}
+
+func (p *InboxProcessedPruner) Stop() {
+	if p.pruneFn != nil {
+		p.pruneFn.Stop()
+	}
+}
+
+func (p *InboxProcessedPruner) PauseWhile(paused func() bool) {
+	if p.pruneFn != nil {
+		p.pruneFn.PauseWhile(paused)
+	}
+}
+
+func (p *InboxProcessedPruner) prune(ctx context.Context) {
+	n, err := p.idempotency.PruneInboxProcessed(util.Context{ctx}, p.clock.Now().Add(-p.retention))
+	if err != nil {
+		util.ErrorLogger.Errorf("failed to prune processed inbox activities: %s", err)
+		return
+	}
+	util.InfoLogger.Infof("pruned %d processed inbox activities", n)
+}
@@ -0,0 +1,93 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/util"
+	"github.com/gorilla/mux"
+)
+
+// jsonLDContextsResponseWriter holds back ActivityStreams responses, so that
+// the application's JSON-LD contexts can be added to them before they are
+// written. Other responses are written as they are.
+type jsonLDContextsResponseWriter struct {
+	http.ResponseWriter
+	status int
+	hold   bool
+	body   bytes.Buffer
+}
+
+func (j *jsonLDContextsResponseWriter) WriteHeader(status int) {
+	if j.status != 0 {
+		return
+	}
+	j.status = status
+	if j.hold = isActivityStreamsContentType(j.Header().Get("Content-Type")); !j.hold {
+		j.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (j *jsonLDContextsResponseWriter) Write(b []byte) (int, error) {
+	if j.status == 0 {
+		j.WriteHeader(http.StatusOK)
+	}
+	if j.hold {
+		return j.body.Write(b)
+	}
+	return j.ResponseWriter.Write(b)
+}
+
+// jsonLDContexts returns middleware adding the application's JSON-LD contexts
+// to the ActivityStreams documents served, including those served by go-fed's
+// handlers. The Digest header is recomputed for the rewritten document.
+func jsonLDContexts(ctxs models.JSONLDContexts) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			jw := &jsonLDContextsResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(jw, req)
+			if !jw.hold {
+				return
+			}
+			b := jw.body.Bytes()
+			if len(b) > 0 {
+				if rb, err := ctxs.Apply(b); err != nil {
+					util.ErrorLogger.Errorf("Error adding JSON-LD contexts to %s: %s", req.URL, err)
+				} else {
+					b = rb
+				}
+				h := w.Header()
+				if len(h.Get("Digest")) > 0 {
+					sum := sha256.Sum256(b)
+					h.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+				}
+				if len(h.Get("Content-Length")) > 0 {
+					h.Set("Content-Length", strconv.Itoa(len(b)))
+				}
+			}
+			if err := writeBody(w, jw.status, b); err != nil {
+				util.ErrorLogger.Errorf("Error writing response to %s: %s", req.URL, err)
+			}
+		})
+	}
+}
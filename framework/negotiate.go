@@ -0,0 +1,128 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	activityJSONMediaType = "application/activity+json"
+	ldJSONMediaType       = "application/ld+json"
+	jsonMediaType         = "application/json"
+	activityStreamsLD     = ldJSONMediaType + "; profile=\"https://www.w3.org/ns/activitystreams\""
+	formatQuery           = "format"
+)
+
+// negotiatedContentType determines the ActivityStreams content type to respond
+// with for the request, preferring whichever of application/activity+json and
+// application/ld+json is accepted with the greater quality. It returns an
+// empty string when the request accepts neither.
+func negotiatedContentType(req *http.Request) string {
+	best, bestQ := "", 0.0
+	for _, v := range strings.Split(req.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		var ct string
+		switch mt {
+		case activityJSONMediaType:
+			ct = activityJSONMediaType
+		case ldJSONMediaType:
+			ct = activityStreamsLD
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = ct, q
+		}
+	}
+	return best
+}
+
+// isActivityStreamsContentType determines whether the Content-Type header
+// value is one of the ActivityStreams media types.
+func isActivityStreamsContentType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && (mt == activityJSONMediaType || mt == ldJSONMediaType)
+}
+
+// contentTypeResponseWriter replaces the ActivityStreams Content-Type of a
+// response with the negotiated one.
+type contentTypeResponseWriter struct {
+	http.ResponseWriter
+	contentType string
+	wroteHeader bool
+}
+
+func (c *contentTypeResponseWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		h := c.Header()
+		if isActivityStreamsContentType(h.Get("Content-Type")) {
+			h.Set("Content-Type", c.contentType)
+			h.Add("Vary", "Accept")
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *contentTypeResponseWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// contentNegotiation returns middleware responding to requests for
+// ActivityStreams content with the media type they accept, whether
+// application/activity+json or application/ld+json with the ActivityStreams
+// profile. When formatJSON is allowed, a GET request with the "format=json"
+// query parameter but no ActivityStreams Accept header is served the
+// ActivityStreams content as application/json, such as for viewing in a
+// browser.
+func contentNegotiation(formatJSON bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ct := negotiatedContentType(req)
+			if len(ct) == 0 && formatJSON &&
+				(req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+				req.URL.Query().Get(formatQuery) == "json" {
+				ct = jsonMediaType
+				req = req.Clone(req.Context())
+				req.Header.Set("Accept", activityStreamsLD)
+			}
+			if len(ct) == 0 {
+				next.ServeHTTP(w, req)
+				return
+			}
+			next.ServeHTTP(&contentTypeResponseWriter{ResponseWriter: w, contentType: ct}, req)
+		})
+	}
+}
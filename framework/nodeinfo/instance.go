@@ -0,0 +1,120 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package nodeinfo
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/framework/web"
+	srv "github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+// This file contains a Mastodon-style instance metadata endpoint, which many
+// clients and relays read instead of either NodeInfo, and which also serves
+// the sitewide announcement.
+
+type instance struct {
+	URI           string            `json:"uri"`
+	Title         string            `json:"title"`
+	Description   string            `json:"description"`
+	Email         string            `json:"email"`
+	Version       string            `json:"version"`
+	Software      software          `json:"software"`
+	Registrations bool              `json:"registrations"`
+	Stats         *instanceStats    `json:"stats,omitempty"`
+	Announcement  *app.Announcement `json:"announcement,omitempty"`
+}
+
+type instanceStats struct {
+	UserCount   int `json:"user_count"`
+	StatusCount int `json:"status_count"`
+}
+
+func toInstance(c config.NodeInfoConfig, host string, s app.Software, t *srv.NodeInfoStats, p srv.ServerPreferences, a *app.Announcement) instance {
+	i := instance{
+		URI:         host,
+		Title:       p.ServerName,
+		Description: c.InstanceDescription,
+		Email:       c.InstanceContactEmail,
+		Version:     s.Version(),
+		Software: software{
+			Name:       sanitizeSoftwareName(s.Name),
+			Version:    s.Version(),
+			Repository: s.Repository,
+		},
+		Registrations: p.OpenRegistrations,
+		Announcement:  a,
+	}
+	if len(i.Email) == 0 {
+		i.Email = p.OrgContact
+	}
+	if t != nil {
+		i.Stats = &instanceStats{
+			UserCount:   t.TotalUsers,
+			StatusCount: t.NLocalPosts,
+		}
+	}
+	return i
+}
+
+func instanceHandler(c config.NodeInfoConfig, host string, ni *srv.NodeInfo, u *srv.Users, clock pub.Clock, s app.Software) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ctx := util.Context{r.Context()}
+		var t *srv.NodeInfoStats
+		if c.EnableAnonymousStatsSharing {
+			st, err := ni.GetAnonymizedStats(ctx)
+			if err != nil {
+				http.Error(w, "error serving instance response", http.StatusInternalServerError)
+				util.ErrorLogger.Errorf("error in getting anonymized stats for instance response: %s", err)
+				return
+			}
+			t = &st
+		}
+
+		p, err := u.GetServerPreferences(ctx)
+		if err != nil {
+			http.Error(w, "error serving instance response", http.StatusInternalServerError)
+			util.ErrorLogger.Errorf("error in getting server profile for instance response: %s", err)
+			return
+		}
+
+		a, err := u.ActiveAnnouncement(ctx, clock.Now())
+		if err != nil {
+			http.Error(w, "error serving instance response", http.StatusInternalServerError)
+			util.ErrorLogger.Errorf("error in getting announcement for instance response: %s", err)
+			return
+		}
+
+		b, err := json.Marshal(toInstance(c, host, s, t, p, a))
+		if err != nil {
+			http.Error(w, "error serving instance response", http.StatusInternalServerError)
+			util.ErrorLogger.Errorf("error marshalling instance response to JSON: %s", err)
+			return
+		}
+
+		if err := web.WriteCacheable(w, r, b, c.MaxAgeSeconds); err != nil {
+			util.ErrorLogger.Errorf("error writing instance response: %s", err)
+		}
+	}
+}
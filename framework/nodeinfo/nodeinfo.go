@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/framework/web"
 	srv "github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
 )
@@ -123,7 +124,7 @@ func toNodeInfo(s, apcore app.Software, t *srv.NodeInfoStats, p srv.ServerPrefer
 	return n
 }
 
-func nodeInfoWellKnownHandler(scheme, host string) http.HandlerFunc {
+func nodeInfoWellKnownHandler(scheme, host string, maxAge int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/jrd+json")
 		var b bytes.Buffer
@@ -133,17 +134,13 @@ func nodeInfoWellKnownHandler(scheme, host string) http.HandlerFunc {
 		b.WriteString(host)
 		b.WriteString(nodeInfoPath)
 		b.WriteString(`"}]}`)
-		bt := b.Bytes()
-		n, err := w.Write(bt)
-		if err != nil {
+		if err := web.WriteCacheable(w, r, b.Bytes(), maxAge); err != nil {
 			util.ErrorLogger.Errorf("error writing well-known nodeinfo response: %s", err)
-		} else if n != len(bt) {
-			util.ErrorLogger.Errorf("error writing well-known nodeinfo response: wrote %d of %d bytes", n, len(bt))
 		}
 	}
 }
 
-func nodeInfoHandler(ni *srv.NodeInfo, u *srv.Users, s, apcore app.Software, useStats bool) http.HandlerFunc {
+func nodeInfoHandler(ni *srv.NodeInfo, u *srv.Users, s, apcore app.Software, useStats bool, maxAge int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", `application/json; profile="http://nodeinfo.diaspora.software/ns/schema/2.1#"`)
 
@@ -174,11 +171,8 @@ func nodeInfoHandler(ni *srv.NodeInfo, u *srv.Users, s, apcore app.Software, use
 			return
 		}
 
-		n, err := w.Write(b)
-		if err != nil {
+		if err := web.WriteCacheable(w, r, b, maxAge); err != nil {
 			util.ErrorLogger.Errorf("error writing nodeinfo response: %s", err)
-		} else if n != len(b) {
-			util.ErrorLogger.Errorf("error writing nodeinfo response: wrote %d of %d bytes", n, len(b))
 		}
 	}
 }
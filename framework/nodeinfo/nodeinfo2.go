@@ -22,6 +22,7 @@ import (
 	"net/http"
 
 	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/framework/web"
 	srv "github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
 )
@@ -124,7 +125,7 @@ func toNodeInfo2(s, apcore app.Software, t *srv.NodeInfoStats, p srv.ServerPrefe
 	return n
 }
 
-func nodeInfo2WellKnownHandler(ni *srv.NodeInfo, u *srv.Users, s, apcore app.Software, useStats bool) http.HandlerFunc {
+func nodeInfo2WellKnownHandler(ni *srv.NodeInfo, u *srv.Users, s, apcore app.Software, useStats bool, maxAge int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", `application/json`)
 
@@ -155,11 +156,8 @@ func nodeInfo2WellKnownHandler(ni *srv.NodeInfo, u *srv.Users, s, apcore app.Sof
 			return
 		}
 
-		n, err := w.Write(b)
-		if err != nil {
+		if err := web.WriteCacheable(w, r, b, maxAge); err != nil {
 			util.ErrorLogger.Errorf("error writing nodeinfo2 response: %s", err)
-		} else if n != len(b) {
-			util.ErrorLogger.Errorf("error writing nodeinfo2 response: wrote %d of %d bytes", n, len(b))
 		}
 	}
 }
@@ -38,8 +38,10 @@ package nodeinfo
 import (
 	"net/http"
 
+	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/paths"
 	srv "github.com/go-fed/apcore/services"
 )
 
@@ -48,22 +50,28 @@ type PathHandler struct {
 	Handler http.HandlerFunc
 }
 
-func GetNodeInfoHandlers(c config.NodeInfoConfig, scheme, host string, ni *srv.NodeInfo, u *srv.Users, s, apcore app.Software) []PathHandler {
+func GetNodeInfoHandlers(c config.NodeInfoConfig, scheme, host string, ni *srv.NodeInfo, u *srv.Users, clock pub.Clock, s, apcore app.Software) []PathHandler {
 	var ph []PathHandler
 	if c.EnableNodeInfo {
 		ph = append(ph, PathHandler{
 			Path:    nodeInfoWellKnownPath,
-			Handler: nodeInfoWellKnownHandler(scheme, host),
+			Handler: nodeInfoWellKnownHandler(scheme, host, c.MaxAgeSeconds),
 		})
 		ph = append(ph, PathHandler{
 			Path:    nodeInfoPath,
-			Handler: nodeInfoHandler(ni, u, s, apcore, c.EnableAnonymousStatsSharing),
+			Handler: nodeInfoHandler(ni, u, s, apcore, c.EnableAnonymousStatsSharing, c.MaxAgeSeconds),
 		})
 	}
 	if c.EnableNodeInfo2 {
 		ph = append(ph, PathHandler{
 			Path:    nodeInfo2WellKnownPath,
-			Handler: nodeInfo2WellKnownHandler(ni, u, s, apcore, c.EnableAnonymousStatsSharing),
+			Handler: nodeInfo2WellKnownHandler(ni, u, s, apcore, c.EnableAnonymousStatsSharing, c.MaxAgeSeconds),
+		})
+	}
+	if c.EnableInstanceAPI {
+		ph = append(ph, PathHandler{
+			Path:    paths.InstanceAPIRoute,
+			Handler: instanceHandler(c, host, ni, u, clock, s),
 		})
 	}
 	return ph
@@ -26,8 +26,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework/config"
 	"github.com/go-fed/apcore/framework/web"
+	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
 	"github.com/go-fed/oauth2"
@@ -48,6 +50,8 @@ type Server struct {
 	k *web.Sessions
 	m *manage.Manager
 	s *oaserver.Server
+	// scopes are the scopes clients may request.
+	scopes *ScopeRegistry
 	// First-party support:
 	clientIDBase                string
 	host                        string
@@ -60,7 +64,7 @@ type Server struct {
 	cleanupFn                   *util.SafeStartStop
 }
 
-func NewServer(c *config.Config, scheme string, internalErrorHandler http.Handler, d *services.OAuth2, y *services.Crypto, k *web.Sessions) (s *Server, err error) {
+func NewServer(c *config.Config, scheme string, internalErrorHandler http.Handler, d *services.OAuth2, y *services.Crypto, k *web.Sessions, scopes *ScopeRegistry) (s *Server, err error) {
 	m := manage.NewDefaultManager()
 	// Configure Access token and Refresh token refresh.
 	if c.OAuthConfig.AccessTokenExpiry <= 0 {
@@ -127,6 +131,14 @@ func NewServer(c *config.Config, scheme string, internalErrorHandler http.Handle
 		// User is already logged in
 		return
 	})
+	// Only registered scopes may be requested, and refreshing a token may
+	// not widen its scope.
+	srv.SetClientScopeHandler(func(clientID, scope string) (allowed bool, err error) {
+		return scopes.Permits(scope), nil
+	})
+	srv.SetRefreshingScopeHandler(func(newScope, oldScope string) (allowed bool, err error) {
+		return narrows(newScope, oldScope), nil
+	})
 	srv.SetInternalErrorHandler(func(err error) (re *oaerrors.Response) {
 		re = &oaerrors.Response{
 			Error:       oaerrors.ErrServerError,
@@ -152,6 +164,7 @@ func NewServer(c *config.Config, scheme string, internalErrorHandler http.Handle
 		k:                           k,
 		m:                           m,
 		s:                           srv,
+		scopes:                      scopes,
 		clientIDBase:                fmt.Sprintf("%s.%s", b64ClientPart, c.ServerConfig.Host),
 		host:                        c.ServerConfig.Host,
 		scheme:                      scheme,
@@ -165,7 +178,12 @@ func NewServer(c *config.Config, scheme string, internalErrorHandler http.Handle
 	return
 }
 
-// TODO: Scopes
+// RequestedScopes describes the scopes requested in the authorization request,
+// such as to show them to the user on the authorization page. An unregistered
+// scope is an error.
+func (o *Server) RequestedScopes(r *http.Request) ([]app.Scope, error) {
+	return o.scopes.Describe(r.FormValue("scope"))
+}
 
 func (o *Server) HandleAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
 	if err := o.s.HandleAuthorizeRequest(w, r); err != nil {
@@ -195,16 +213,37 @@ func (o *Server) RemoveByAccess(ctx util.Context, t oauth2.TokenInfo) error {
 	return o.m.RemoveAccessToken(ctx.Context, t.GetAccess())
 }
 
+// Authorizations summarizes the tokens the user has granted to each third-party
+// client, excluding the user's first-party credentials.
+func (o *Server) Authorizations(ctx util.Context, userID string) ([]models.ClientAuthorization, error) {
+	return o.d.Authorizations(ctx, userID)
+}
+
+// RevokeAuthorization deletes the tokens the user has granted to the
+// third-party client, so that they no longer validate. It reports whether
+// there were any.
+func (o *Server) RevokeAuthorization(ctx util.Context, userID, clientID string) (bool, error) {
+	return o.d.RevokeAuthorization(ctx, userID, clientID)
+}
+
 func (o *Server) Validate(w http.ResponseWriter, r *http.Request) (userID string, auth bool, err error) {
+	userID, _, auth, err = o.ValidateWithScope(w, r)
+	return
+}
+
+// ValidateWithScope is like Validate, additionally returning the scope granted
+// to the credential that authenticated the request.
+func (o *Server) ValidateWithScope(w http.ResponseWriter, r *http.Request) (userID, scope string, auth bool, err error) {
 	var sn *web.Session
 	sn, err = o.k.Get(r)
 	if err != nil {
 		return
 	}
-	var uid string
-	_, uid, auth, err = o.ValidateFirstPartyProxyAccessToken(util.Context{r.Context()}, sn)
+	var ti oauth2.TokenInfo
+	_, ti, auth, err = o.validateFirstPartyProxyAccessToken(util.Context{r.Context()}, sn)
 	if err == nil && auth {
-		userID = uid
+		userID = ti.GetUserID()
+		scope = ti.GetScope()
 		return
 	} else if err != nil {
 		sn.Clear()
@@ -213,10 +252,10 @@ func (o *Server) Validate(w http.ResponseWriter, r *http.Request) (userID string
 		}
 		return
 	}
-	var ti oauth2.TokenInfo
 	ti, auth, err = o.ValidateOAuth2AccessToken(w, r)
 	if err == nil && auth {
 		userID = ti.GetUserID()
+		scope = ti.GetScope()
 	} else {
 		sn.Clear()
 		if err2 := sn.Save(r, w); err2 != nil {
@@ -307,13 +346,21 @@ func (o *Server) RefreshProxyCredentialsIfNeeded(ctx util.Context, id, userID st
 }
 
 func (o *Server) ValidateFirstPartyProxyAccessToken(ctx util.Context, sn *web.Session) (id, userID string, authenticated bool, err error) {
+	var ti oauth2.TokenInfo
+	id, ti, authenticated, err = o.validateFirstPartyProxyAccessToken(ctx, sn)
+	if err == nil && authenticated {
+		userID = ti.GetUserID()
+	}
+	return
+}
+
+func (o *Server) validateFirstPartyProxyAccessToken(ctx util.Context, sn *web.Session) (id string, ti oauth2.TokenInfo, authenticated bool, err error) {
 	if sn.HasFirstPartyCredentialID() {
 		id, err = sn.FirstPartyCredentialID()
 		if err != nil {
 			return
 		}
 		now := time.Now()
-		var ti oauth2.TokenInfo
 		ti, err = o.d.ProxyGetCredential(ctx, id)
 		if err != nil {
 			return
@@ -330,7 +377,6 @@ func (o *Server) ValidateFirstPartyProxyAccessToken(ctx util.Context, sn *web.Se
 			return
 		}
 		authenticated = true
-		userID = ti.GetUserID()
 	}
 	return
 }
@@ -360,6 +406,12 @@ func (o *Server) Stop() {
 	o.cleanupFn.Stop()
 }
 
+// PauseWhile pauses deleting expired credentials while paused reports true,
+// such as in read-only mode. It must be called before Start.
+func (o *Server) PauseWhile(paused func() bool) {
+	o.cleanupFn.PauseWhile(paused)
+}
+
 func (o *Server) cleanup(ctx context.Context) {
 	err := o.d.DeleteExpiredFirstPartyCredentials(ctx)
 	if err != nil {
@@ -0,0 +1,97 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package oauth2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-fed/apcore/app"
+)
+
+// ScopeRegistry is the set of scopes that clients may request when being
+// authorized. An empty registry permits any scope, for applications that do
+// not register theirs.
+type ScopeRegistry struct {
+	scopes map[string]app.Scope
+}
+
+// NewScopeRegistry registers the scopes, which must have unique names without
+// whitespace.
+func NewScopeRegistry(scopes []app.Scope) (*ScopeRegistry, error) {
+	r := &ScopeRegistry{
+		scopes: make(map[string]app.Scope, len(scopes)),
+	}
+	for _, s := range scopes {
+		if len(s.Name) == 0 {
+			return nil, fmt.Errorf("scope has an empty name")
+		} else if len(strings.Fields(s.Name)) != 1 || strings.TrimSpace(s.Name) != s.Name {
+			return nil, fmt.Errorf("scope name contains whitespace: %q", s.Name)
+		} else if _, ok := r.scopes[s.Name]; ok {
+			return nil, fmt.Errorf("scope is registered more than once: %s", s.Name)
+		}
+		r.scopes[s.Name] = s
+	}
+	return r, nil
+}
+
+// Permits determines whether every scope in the space-separated list is
+// registered.
+func (r *ScopeRegistry) Permits(scope string) bool {
+	if len(r.scopes) == 0 {
+		return true
+	}
+	for _, s := range strings.Fields(scope) {
+		if _, ok := r.scopes[s]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe returns the registered scopes in the space-separated list, in the
+// order they are listed. An unregistered scope is an error, unless nothing is
+// registered, in which case it is returned without a description.
+func (r *ScopeRegistry) Describe(scope string) ([]app.Scope, error) {
+	var scopes []app.Scope
+	seen := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		if d, ok := r.scopes[s]; ok {
+			scopes = append(scopes, d)
+		} else if len(r.scopes) == 0 {
+			scopes = append(scopes, app.Scope{Name: s})
+		} else {
+			return nil, fmt.Errorf("unknown scope: %s", s)
+		}
+	}
+	return scopes, nil
+}
+
+// narrows determines whether every scope in the space-separated newScope is
+// included in the oldScope, so that refreshing a token cannot widen its scope.
+func narrows(newScope, oldScope string) bool {
+	for _, s := range strings.Fields(newScope) {
+		if !app.ScopeIncludes(oldScope, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/apcore/framework/web"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/services"
+)
+
+// cacheableResponseWriter holds back the response of an ActivityStreams
+// handler, so that caching headers computed from its body can be set before it
+// is written.
+type cacheableResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *cacheableResponseWriter) WriteHeader(status int) {
+	c.status = status
+}
+
+func (c *cacheableResponseWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return c.body.Write(b)
+}
+
+// cacheable adds caching headers to the objects served by the ActivityStreams
+// handler. Public objects have an ETag and, when stored locally, a
+// Last-Modified of when they were created, and may be cached for the
+// configured max age. Conditional requests for them are answered with 304 Not
+// Modified. All other objects are marked as private and not to be stored.
+//
+// Under authorized fetch a public object may still only be cached privately,
+// as each request must be authorized and a peer whose domain is blocked must
+// not be served it from a shared cache.
+func (r *Route) cacheable(apHandler pub.HandlerFunc) pub.HandlerFunc {
+	return func(c context.Context, w http.ResponseWriter, req *http.Request) (isASRequest bool, err error) {
+		cw := &cacheableResponseWriter{ResponseWriter: w}
+		isASRequest, err = apHandler(c, cw, req)
+		if err != nil || !isASRequest {
+			return
+		}
+		b := cw.body.Bytes()
+		var public bool
+		if cw.status == http.StatusOK {
+			public, err = isPublicObject(c, b)
+			if err != nil {
+				return
+			}
+		}
+		if !public {
+			w.Header().Set("Cache-Control", "private, no-store")
+			return isASRequest, writeBody(w, cw.status, b)
+		}
+		etag := web.ETag(b)
+		w.Header().Set("ETag", etag)
+		scope := "public"
+		if r.verifyFetch != nil {
+			scope = "private"
+		}
+		if r.objectMaxAge > 0 {
+			w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, r.objectMaxAge))
+		} else {
+			w.Header().Set("Cache-Control", scope)
+		}
+		id := &url.URL{Scheme: r.scheme, Host: req.Host, Path: req.URL.Path}
+		var created time.Time
+		created, err = r.db.Created(c, id)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return
+		}
+		err = nil
+		if !created.IsZero() {
+			w.Header().Set("Last-Modified", created.UTC().Format(http.TimeFormat))
+		}
+		if web.NotModified(req, etag, created) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		return isASRequest, writeBody(w, cw.status, b)
+	}
+}
+
+// isPublicObject determines whether the serialized ActivityStreams object is
+// addressed to the Public collection.
+func isPublicObject(c context.Context, b []byte) (bool, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return false, err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		// Types unknown to go-fed are never cached.
+		return false, nil
+	}
+	return services.IsPublic(t)
+}
+
+// writeBody writes the held back response, which is 200 OK if the handler did
+// not set a status.
+func writeBody(w http.ResponseWriter, status int, b []byte) error {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	n, err := w.Write(b)
+	if err != nil {
+		return err
+	} else if n != len(b) {
+		return fmt.Errorf("wrote %d of %d bytes", n, len(b))
+	}
+	return nil
+}
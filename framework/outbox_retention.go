@@ -0,0 +1,123 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/framework/config"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Pausable = &OutboxRetention{}
+
+// OutboxRetention periodically removes outbox items older than the configured
+// retention age, tombstoning their local data and delivering a Delete of each
+// expired object.
+type OutboxRetention struct {
+	// Immutable
+	clock    pub.Clock
+	outboxes *services.Outboxes
+	fw       *Framework
+	policy   services.RetentionPolicy
+	expireFn *util.SafeStartStop
+	// Mutable, atomically accessed
+	nExpired uint64
+}
+
+func NewOutboxRetention(c *config.Config, clock pub.Clock, outboxes *services.Outboxes, fw *Framework) *OutboxRetention {
+	o := &OutboxRetention{
+		clock:    clock,
+		outboxes: outboxes,
+		fw:       fw,
+		policy: services.RetentionPolicy{
+			MaxAge:    time.Duration(c.DatabaseConfig.OutboxRetentionDays) * 24 * time.Hour,
+			Tombstone: c.DatabaseConfig.OutboxRetentionTombstone,
+			DryRun:    c.DatabaseConfig.OutboxRetentionDryRun,
+			BatchSize: c.DatabaseConfig.OutboxRetentionBatchSize,
+		},
+	}
+	if c.DatabaseConfig.OutboxRetentionDays > 0 {
+		o.expireFn = util.NewSafeStartStop(o.expire, time.Duration(c.DatabaseConfig.OutboxRetentionPeriodSeconds)*time.Second)
+	}
+	return o
+}
+
+func (o *OutboxRetention) Start() {
+	if o.expireFn != nil {
+		o.expireFn.Start()
+	}
+}
+
+func (o *OutboxRetention) Stop() {
+	if o.expireFn != nil {
+		o.expireFn.Stop()
+	}
+}
+
+func (o *OutboxRetention) PauseWhile(paused func() bool) {
+	if o.expireFn != nil {
+		o.expireFn.PauseWhile(paused)
+	}
+}
+
+// Expired returns the total number of outbox items expired so far.
+func (o *OutboxRetention) Expired() uint64 {
+	return atomic.LoadUint64(&o.nExpired)
+}
+
+func (o *OutboxRetention) expire(ctx context.Context) {
+	expired, err := o.outboxes.Expire(util.Context{ctx}, o.clock.Now(), o.policy)
+	if err != nil {
+		util.ErrorLogger.Errorf("outbox retention failed to expire outbox items: %s", err)
+		return
+	}
+	if o.policy.DryRun {
+		for _, x := range expired {
+			util.InfoLogger.Infof("outbox retention would expire %s from %s, created %s", x.Item.URL, x.Outbox.URL, x.Created)
+		}
+		util.InfoLogger.Infof("outbox retention would expire %d outbox items", len(expired))
+		return
+	}
+	total := atomic.AddUint64(&o.nExpired, uint64(len(expired)))
+	util.InfoLogger.Infof("outbox retention expired %d outbox items (total expired: %d)", len(expired), total)
+	if !o.fw.federationEnabled {
+		return
+	}
+	// Peers keep their copies of the expired objects until told to delete
+	// them.
+	sent := make(map[string]bool, len(expired))
+	for _, x := range expired {
+		if x.Object == nil || sent[x.Object.String()] {
+			continue
+		}
+		sent[x.Object.String()] = true
+		userID, err := paths.UUIDFromUserPath(x.Actor.Path)
+		if err != nil {
+			util.ErrorLogger.Errorf("outbox retention failed to find the user of %s: %s", x.Actor.URL, err)
+			continue
+		}
+		if err := o.fw.sendDelete(ctx, userID, x.Object); err != nil {
+			util.ErrorLogger.Errorf("outbox retention failed to deliver a Delete of %s: %s", x.Object, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+// PostLimiter limits how often each user may post to their outbox, so that a
+// compromised local account cannot spam the fediverse.
+//
+// The activities each user posted are counted over a rolling minute and hour
+// from the database, so that only posts that succeeded count and the limits
+// are shared by every process serving the users. The server's limits apply
+// unless the user's privileges override them.
+type PostLimiter struct {
+	clock     pub.Clock
+	users     *services.Users
+	outboxes  *services.Outboxes
+	scheme    string
+	host      string
+	perMinute int
+	perHour   int
+}
+
+// NewPostLimiter creates a PostLimiter allowing the number of posts per minute
+// and per hour to each user, unless overridden in their privileges. A limit
+// of zero means no limit.
+func NewPostLimiter(clock pub.Clock, users *services.Users, outboxes *services.Outboxes, scheme, host string, perMinute, perHour int) *PostLimiter {
+	return &PostLimiter{
+		clock:     clock,
+		users:     users,
+		outboxes:  outboxes,
+		scheme:    scheme,
+		host:      host,
+		perMinute: perMinute,
+		perHour:   perHour,
+	}
+}
+
+// Allow determines whether the user may post now. Otherwise, it returns how
+// long until the user may post again.
+func (p *PostLimiter) Allow(c util.Context, userID paths.UUID) (ok bool, retryAfter time.Duration, err error) {
+	perMinute, perHour, err := p.limits(c, userID)
+	if err != nil {
+		return
+	}
+	actor := paths.UUIDIRIFor(p.scheme, p.host, paths.UserPathKey, userID)
+	retryAfter, err = p.outboxes.PostRetryAfter(c, actor, perMinute, perHour, p.clock.Now())
+	ok = err == nil && retryAfter <= 0
+	return
+}
+
+// limits returns the limits of the user, where zero means no limit.
+func (p *PostLimiter) limits(c util.Context, userID paths.UUID) (perMinute, perHour int, err error) {
+	perMinute, perHour, err = p.users.PostRateLimit(c, string(userID))
+	if err != nil {
+		return
+	}
+	if perMinute == 0 {
+		perMinute = p.perMinute
+	} else if perMinute < 0 {
+		perMinute = 0
+	}
+	if perHour == 0 {
+		perHour = p.perHour
+	} else if perHour < 0 {
+		perHour = 0
+	}
+	return
+}
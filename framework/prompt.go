@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/framework/config"
 	"github.com/go-fed/apcore/services"
 	"github.com/manifoldco/promptui"
 )
@@ -205,6 +206,23 @@ func PromptAdminUser() (username, email, password string, err error) {
 	return
 }
 
+// DefaultServerProfile is the server profile of an instance actor created
+// without prompting, such as when starting.
+func DefaultServerProfile(c *config.Config, scheme, host string) (sp services.ServerPreferences) {
+	sp.OnFollow = pub.OnFollowDoNothing
+	baseURL := &url.URL{
+		Scheme: scheme,
+		Host:   host,
+	}
+	sp.ServerBaseURL = baseURL.String()
+	sp.ServerName = c.ServerConfig.ServerName
+	if len(sp.ServerName) == 0 {
+		sp.ServerName = host
+	}
+	sp.OpenRegistrations = c.ServerConfig.OpenRegistrations
+	return
+}
+
 func PromptServerProfile(scheme, host string) (sp services.ServerPreferences, err error) {
 	sp.OnFollow = pub.OnFollowDoNothing
 	baseURL := &url.URL{
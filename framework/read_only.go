@@ -0,0 +1,106 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// readOnlyRetryAfter is how long clients are asked to wait before retrying a
+// write refused in read-only mode.
+const readOnlyRetryAfter = 5 * time.Minute
+
+// ReadOnly is the server's read-only mode, in which requests that would write
+// are refused while reads continue to be served, such as during a migration.
+// Periodic background work that writes is paused.
+type ReadOnly struct {
+	// Immutable
+	exempt map[string]bool
+	// Mutable, atomically accessed
+	enabled int32
+}
+
+// NewReadOnly creates a ReadOnly that is initially enabled or not. Writes to
+// the exempt paths, such as logging in, obtaining an OAuth2 token, or toggling
+// the mode itself, are never refused.
+func NewReadOnly(enabled bool, exempt ...string) *ReadOnly {
+	ro := &ReadOnly{exempt: make(map[string]bool, len(exempt))}
+	for _, p := range exempt {
+		ro.exempt[p] = true
+	}
+	ro.Set(enabled)
+	return ro
+}
+
+// Enabled determines whether the server is in read-only mode.
+func (ro *ReadOnly) Enabled() bool {
+	return atomic.LoadInt32(&ro.enabled) != 0
+}
+
+// Set enables or disables read-only mode.
+func (ro *ReadOnly) Set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&ro.enabled, v)
+}
+
+// Middleware refuses requests with methods that would write, such as POSTs to
+// inboxes and outboxes, with 503 Service Unavailable while in read-only mode.
+func (ro *ReadOnly) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ro.Enabled() && isWriteMethod(r.Method) && !ro.exempt[r.URL.Path] {
+			w.Header().Set("Retry-After", strconv.Itoa(int(readOnlyRetryAfter/time.Second)))
+			http.Error(w, "read-only mode", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Pausable is a StartStopper whose periodic work writes, and so is paused in
+// read-only mode.
+type Pausable interface {
+	StartStopper
+	// PauseWhile skips the periodic work while paused reports true. It is
+	// called before Start.
+	PauseWhile(paused func() bool)
+}
+
+// Pause pauses the periodic work of those StartStoppers that are Pausable
+// while in read-only mode.
+func (ro *ReadOnly) Pause(ss ...StartStopper) {
+	for _, s := range ss {
+		if p, ok := s.(Pausable); ok {
+			p.PauseWhile(ro.Enabled)
+		}
+	}
+}
+
+// isWriteMethod determines whether requests with the method may write.
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
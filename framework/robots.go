@@ -0,0 +1,77 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// robotsTxt builds a robots.txt asking all crawlers not to crawl the paths
+// with the disallowed prefixes. An empty list disallows nothing.
+func robotsTxt(disallow []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("User-agent: *\n")
+	n := 0
+	for _, p := range disallow {
+		if p = strings.TrimSpace(p); len(p) == 0 {
+			continue
+		}
+		b.WriteString("Disallow: " + p + "\n")
+		n++
+	}
+	if n == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	return b.Bytes()
+}
+
+func robotsHandler(disallow []string) http.HandlerFunc {
+	txt := robotsTxt(disallow)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(txt)
+	}
+}
+
+func rootRedirectHandler(to string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, to, http.StatusFound)
+	}
+}
+
+// isRouted determines whether a GET request for the path is already served
+// by a registered route, such as one registered by the application.
+func (r *Router) isRouted(path string) bool {
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL: &url.URL{
+			Scheme: r.scheme,
+			Host:   r.host,
+			Path:   path,
+		},
+		Host:   r.host,
+		Header: make(http.Header),
+	}
+	var m mux.RouteMatch
+	return r.router.Match(req, &m) && m.MatchErr == nil
+}
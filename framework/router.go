@@ -17,16 +17,28 @@
 package framework
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/app"
 	"github.com/go-fed/apcore/framework/oauth2"
 	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
+	"github.com/go-fed/httpsig"
 	"github.com/gorilla/mux"
 )
 
@@ -37,6 +49,8 @@ type RoutingDatabase interface {
 	pub.Database
 	GetPublicInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error)
 	GetPublicOutbox(c context.Context, outboxIRI *url.URL) (outbox vocab.ActivityStreamsOrderedCollectionPage, err error)
+	SharedInboxRecipients(c context.Context, activity vocab.Type) (uuids []paths.UUID, err error)
+	Created(c context.Context, id *url.URL) (created time.Time, err error)
 }
 
 type Router struct {
@@ -46,10 +60,20 @@ type Router struct {
 	actorMap          map[paths.Actor]pub.Actor
 	clock             pub.Clock
 	db                RoutingDatabase
+	idempotency       *services.IdempotencyKeys
+	domains           *services.Domains
+	signatures        *SignatureWindow
+	posts             *PostLimiter
+	requireScope      ScopeEnforcerFunc
 	host              string
 	scheme            string
 	errorHandler      http.Handler
 	badRequestHandler http.Handler
+	notFoundHandler   http.Handler
+	verifyFetch       SignatureVerifierFunc
+	verifyInbox       SignatureVerifierFunc
+	objectMaxAge      int
+	maxBodyBytes      int64
 }
 
 func NewRouter(router *mux.Router,
@@ -58,10 +82,19 @@ func NewRouter(router *mux.Router,
 	actorMap map[paths.Actor]pub.Actor,
 	clock pub.Clock,
 	db RoutingDatabase,
+	idempotency *services.IdempotencyKeys,
+	domains *services.Domains,
+	signatures *SignatureWindow,
+	posts *PostLimiter,
+	requireScope ScopeEnforcerFunc,
 	host string,
 	scheme string,
 	errorHandler http.Handler,
-	badRequestHandler http.Handler) *Router {
+	badRequestHandler http.Handler,
+	verifyFetch SignatureVerifierFunc,
+	verifyInbox SignatureVerifierFunc,
+	objectMaxAge int,
+	maxBodyBytes int64) *Router {
 	return &Router{
 		router:            router,
 		oauth:             oauth,
@@ -69,10 +102,20 @@ func NewRouter(router *mux.Router,
 		actorMap:          actorMap,
 		clock:             clock,
 		db:                db,
+		idempotency:       idempotency,
+		domains:           domains,
+		signatures:        signatures,
+		posts:             posts,
+		requireScope:      requireScope,
 		host:              host,
 		scheme:            scheme,
 		errorHandler:      errorHandler,
 		badRequestHandler: badRequestHandler,
+		notFoundHandler:   router.NotFoundHandler,
+		verifyFetch:       verifyFetch,
+		verifyInbox:       verifyInbox,
+		objectMaxAge:      objectMaxAge,
+		maxBodyBytes:      maxBodyBytes,
 	}
 }
 
@@ -84,11 +127,20 @@ func (r *Router) wrap(route *mux.Route) *Route {
 		actorMap:          r.actorMap,
 		clock:             r.clock,
 		db:                r.db,
+		idempotency:       r.idempotency,
+		domains:           r.domains,
+		signatures:        r.signatures,
+		posts:             r.posts,
+		requireScope:      r.requireScope,
 		host:              r.host,
 		scheme:            r.scheme,
 		errorHandler:      r.errorHandler,
 		badRequestHandler: r.badRequestHandler,
-		notFoundHandler:   r.router.NotFoundHandler,
+		notFoundHandler:   r.notFoundHandler,
+		verifyFetch:       r.verifyFetch,
+		verifyInbox:       r.verifyInbox,
+		objectMaxAge:      r.objectMaxAge,
+		maxBodyBytes:      r.maxBodyBytes,
 	}
 }
 
@@ -100,6 +152,10 @@ func (r *Router) userActorPostInbox() *Route {
 	return r.wrap(r.router.NewRoute()).userActorPostInbox()
 }
 
+func (r *Router) sharedInboxPost() *Route {
+	return r.wrap(r.router.NewRoute()).sharedInboxPost()
+}
+
 func (r *Router) knownActorPostInbox(c paths.Actor) *Route {
 	return r.wrap(r.router.NewRoute()).knownActorPostInbox(c)
 }
@@ -139,15 +195,21 @@ func (r *Router) ActivityPubAndWebHandleFunc(path string, authFn app.AuthorizeFu
 func (r *Router) apWebCollectionPageFetchingHandleFunc(path string,
 	authFn app.AuthorizeFunc,
 	f app.CollectionPageHandlerFunc,
-	fetch func(util.Context) (vocab.ActivityStreamsCollectionPage, error)) app.Route {
-	return r.wrap(r.router.NewRoute()).apWebCollectionPageFetchingHandleFunc(path, authFn, f, fetch)
+	fetch func(util.Context) (vocab.ActivityStreamsCollectionPage, error),
+	shell CollectionShellFn) app.Route {
+	return r.wrap(r.router.NewRoute()).apWebCollectionPageFetchingHandleFunc(path, authFn, f, fetch, shell)
+}
+
+func (r *Router) getReplies(exists func(util.Context, *url.URL) (bool, error)) *Route {
+	return r.wrap(r.router.NewRoute()).getReplies(exists)
 }
 
 func (r *Router) apWebVocabFetchingHandleFunc(path string,
 	authFn app.AuthorizeFunc,
 	f app.VocabHandlerFunc,
-	fetch func(util.Context) (vocab.Type, error)) app.Route {
-	return r.wrap(r.router.NewRoute()).apWebVocabFetchingHandleFunc(path, authFn, f, fetch)
+	fetch func(util.Context) (vocab.Type, error),
+	enhance VocabEnhanceFn) app.Route {
+	return r.wrap(r.router.NewRoute()).apWebVocabFetchingHandleFunc(path, authFn, f, fetch, enhance)
 }
 
 func (r *Router) HandleAuthorizationRequest(path string) app.Route {
@@ -231,11 +293,20 @@ type Route struct {
 	actorMap          map[paths.Actor]pub.Actor
 	clock             pub.Clock
 	db                RoutingDatabase
+	idempotency       *services.IdempotencyKeys
+	domains           *services.Domains
+	signatures        *SignatureWindow
+	posts             *PostLimiter
+	requireScope      ScopeEnforcerFunc
 	host              string
 	scheme            string
 	errorHandler      http.Handler
 	badRequestHandler http.Handler
 	notFoundHandler   http.Handler
+	verifyFetch       SignatureVerifierFunc
+	verifyInbox       SignatureVerifierFunc
+	objectMaxAge      int
+	maxBodyBytes      int64
 }
 
 func (r *Route) wrap(router *mux.Router) *Router {
@@ -246,11 +317,98 @@ func (r *Route) wrap(router *mux.Router) *Router {
 		actorMap:          r.actorMap,
 		clock:             r.clock,
 		db:                r.db,
+		idempotency:       r.idempotency,
+		domains:           r.domains,
+		signatures:        r.signatures,
+		posts:             r.posts,
+		requireScope:      r.requireScope,
 		host:              r.host,
 		scheme:            r.scheme,
 		errorHandler:      r.errorHandler,
 		badRequestHandler: r.badRequestHandler,
+		notFoundHandler:   r.notFoundHandler,
+		verifyFetch:       r.verifyFetch,
+		verifyInbox:       r.verifyInbox,
+		objectMaxAge:      r.objectMaxAge,
+		maxBodyBytes:      r.maxBodyBytes,
+	}
+}
+
+// notFound responds using the application's NotFoundHandler, if it provided
+// one.
+func (r *Route) notFound(w http.ResponseWriter, req *http.Request) {
+	if r.notFoundHandler != nil {
+		r.notFoundHandler.ServeHTTP(w, req)
+	} else {
+		http.NotFound(w, req)
+	}
+}
+
+// authorizeFetch enforces authorized fetch, when enabled, by requiring
+// ActivityPub GET requests to have a valid HTTP Signature or to be made by an
+// authenticated client. The instance actor is always served, so that peers can
+// obtain the key this server signs its own fetches with. Unauthorized requests
+// are responded to with 401 Unauthorized.
+func (r *Route) authorizeFetch(w http.ResponseWriter, req *http.Request) bool {
+	if r.verifyFetch == nil || !isActivityPubGet(req) || paths.IsInstanceActorPath(req.URL) {
+		return true
+	}
+	if err := r.signatures.Check(req); err != nil {
+		util.InfoLogger.Infof("Refusing HTTP Signature of fetch of %s: %s", req.URL, err)
+	} else if _, verified, err := r.verifyFetch(req.Context(), req); err != nil {
+		util.InfoLogger.Infof("Could not verify HTTP Signature of fetch of %s: %s", req.URL, err)
+	} else if verified {
+		if err := r.signatures.Remember(req); err == nil {
+			return true
+		}
+		util.InfoLogger.Infof("Refusing replayed HTTP Signature of fetch of %s", req.URL)
+	}
+	if _, authed, err := r.oauth.Validate(w, req); err == nil && authed {
+		return true
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	return false
+}
+
+// refuseInbox determines whether a delivery is signed by a key on a domain that
+// this server does not federate with, so that it is refused before the key is
+// fetched.
+func (r *Route) refuseInbox(c util.Context, req *http.Request) (bool, error) {
+	v, err := httpsig.NewVerifier(req)
+	if err != nil {
+		// Unsigned deliveries are rejected when authenticating.
+		return false, nil
 	}
+	keyId, err := url.Parse(v.KeyId())
+	if err != nil {
+		return false, nil
+	}
+	return r.domains.IsBlocked(c, keyId.Hostname())
+}
+
+// limitBody refuses a request whose body is larger than allowed with 413
+// Request Entity Too Large, and otherwise limits reading its body to the
+// allowed size. It returns false if the request was refused.
+func (r *Route) limitBody(w http.ResponseWriter, req *http.Request) bool {
+	if r.maxBodyBytes <= 0 {
+		return true
+	} else if req.ContentLength > r.maxBodyBytes {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, r.maxBodyBytes)
+	return true
+}
+
+// isActivityPubGet determines whether the request is a GET for ActivityStreams
+// content.
+func isActivityPubGet(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	accept := req.Header.Get("Accept")
+	return strings.Contains(accept, "application/activity+json") ||
+		strings.Contains(accept, "application/ld+json")
 }
 
 func (r *Route) knownActor(c paths.Actor) app.Route {
@@ -280,7 +438,70 @@ func (r *Route) actorPostInbox(actor pub.Actor, path string) *Route {
 				return
 			}
 			c := util.WithUserAPHTTPContext(r.scheme, r.host, req, uuid, userID)
-			isApRequest, err := actor.PostInboxScheme(c.Context, w, req, r.scheme)
+			if refused, err := r.refuseInbox(c, req); err != nil {
+				util.ErrorLogger.Errorf("Error checking domain for ActorPostInbox: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			} else if refused {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if !r.limitBody(w, req) {
+				return
+			}
+			if err := r.signatures.Check(req); err != nil {
+				util.InfoLogger.Infof("Refusing HTTP Signature for ActorPostInbox: %s", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if _, verified, err := r.verifyInbox(c.Context, req); err != nil {
+				util.ErrorLogger.Errorf("Error verifying HTTP Signature for ActorPostInbox: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			} else if !verified {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if err := r.signatures.Remember(req); err != nil {
+				util.InfoLogger.Infof("Refusing HTTP Signature for ActorPostInbox: %s", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			c.WithSignatureVerified(true)
+			if err := r.signatures.CheckBody(req); err != nil {
+				util.InfoLogger.Infof("Refusing HTTP Signature for ActorPostInbox: %s", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			inboxIRI := &url.URL{
+				Scheme: r.scheme,
+				Host:   r.host,
+				Path:   req.URL.Path,
+			}
+			activityID, err := peekActivityID(req)
+			if err != nil {
+				util.ErrorLogger.Errorf("Error reading body for ActorPostInbox: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			}
+			// The activity is reserved before it is processed, so that
+			// concurrent redeliveries of it are only processed once.
+			if activityID != nil {
+				reserved, err := r.idempotency.ReserveInboxProcessed(c, inboxIRI, activityID)
+				if err != nil {
+					util.ErrorLogger.Errorf("Error reserving processed activity in ActorPostInbox: %s", err)
+					r.errorHandler.ServeHTTP(w, req)
+					return
+				} else if !reserved {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+			}
+			sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			isApRequest, err := actor.PostInboxScheme(c.Context, sw, req, r.scheme)
+			if activityID != nil && (err != nil || !isApRequest || sw.status >= 300) {
+				r.releaseInboxProcessed(inboxIRI, activityID)
+			}
 			if err != nil {
 				util.ErrorLogger.Errorf("Error in ActorPostInbox: %s", err)
 				r.errorHandler.ServeHTTP(w, req)
@@ -294,6 +515,225 @@ func (r *Route) actorPostInbox(actor pub.Actor, path string) *Route {
 	return r
 }
 
+// peekActivity reads the JSON object in the body of a request to an outbox,
+// leaving the body to be read again. The object is nil if the body is not JSON.
+func peekActivity(req *http.Request) (map[string]interface{}, error) {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// peekActivityID reads the id of the activity in the body of a request to an
+// inbox, leaving the body to be read again. The id is nil if the body is not an
+// activity with an id. Reading the body is bounded by limitBody, which must be
+// applied first.
+func peekActivityID(req *http.Request) (*url.URL, error) {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	var activity struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(b, &activity); err != nil || len(activity.ID) == 0 {
+		return nil, nil
+	}
+	id, err := url.Parse(activity.ID)
+	if err != nil {
+		return nil, nil
+	}
+	return id, nil
+}
+
+// statusResponseWriter notes the status of the response it writes.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusResponseWriter) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// sharedInboxPost receives deliveries addressed to any number of this server's
+// users. The HTTP Signature is verified once, after which the delivery is
+// dispatched to the inbox of each local recipient.
+func (r *Route) sharedInboxPost() *Route {
+	r.route = r.route.Path(paths.SharedInboxRoute).Schemes(r.scheme).Methods("POST").HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			c := util.WithAPHTTPContext(r.scheme, r.host, req)
+			if refused, err := r.refuseInbox(c, req); err != nil {
+				util.ErrorLogger.Errorf("Error checking domain for SharedInboxPost: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			} else if refused {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if !r.limitBody(w, req) {
+				return
+			}
+			if err := r.signatures.Check(req); err != nil {
+				util.InfoLogger.Infof("Refusing HTTP Signature for SharedInboxPost: %s", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if _, verified, err := r.verifyInbox(c.Context, req); err != nil {
+				util.ErrorLogger.Errorf("Error verifying HTTP Signature for SharedInboxPost: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			} else if !verified {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if err := r.signatures.Remember(req); err != nil {
+				util.InfoLogger.Infof("Refusing HTTP Signature for SharedInboxPost: %s", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			// The body is only read once the signature is known to be
+			// genuine.
+			if err := r.signatures.CheckBody(req); err != nil {
+				util.InfoLogger.Infof("Refusing HTTP Signature for SharedInboxPost: %s", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			b, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				util.ErrorLogger.Errorf("Error reading body for SharedInboxPost: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			}
+			var m map[string]interface{}
+			if err = json.Unmarshal(b, &m); err != nil {
+				r.badRequestHandler.ServeHTTP(w, req)
+				return
+			}
+			t, err := streams.ToType(c.Context, m)
+			if err != nil {
+				r.badRequestHandler.ServeHTTP(w, req)
+				return
+			}
+			uuids, err := r.db.SharedInboxRecipients(c.Context, t)
+			if err != nil {
+				util.ErrorLogger.Errorf("Error determining recipients for SharedInboxPost: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			}
+			id, err := pub.GetId(t)
+			if err != nil {
+				r.badRequestHandler.ServeHTTP(w, req)
+				return
+			}
+			if err := r.dispatchSharedInboxes(req, b, id, uuids); err != nil {
+				util.ErrorLogger.Errorf("Error dispatching SharedInboxPost: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+	return r
+}
+
+// sharedInboxDispatchConcurrency is the number of local inboxes a delivery to
+// the shared inbox is dispatched to at once.
+const sharedInboxDispatchConcurrency = 8
+
+// dispatchSharedInboxes dispatches a delivery to the shared inbox to the inbox
+// of each local recipient, a few at a time, returning the first error.
+func (r *Route) dispatchSharedInboxes(req *http.Request, b []byte, activityID *url.URL, uuids []paths.UUID) error {
+	sem := make(chan struct{}, sharedInboxDispatchConcurrency)
+	errs := make(chan error, len(uuids))
+	var wg sync.WaitGroup
+	for _, uuid := range uuids {
+		uuid := uuid
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := r.dispatchSharedInbox(req, b, activityID, uuid); err != nil {
+				errs <- fmt.Errorf("to %s: %s", uuid, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// dispatchSharedInbox delivers the body of a request made to the shared inbox
+// to the inbox of a local user, as if it had been delivered there directly.
+// Activities the inbox already processed are skipped.
+func (r *Route) dispatchSharedInbox(req *http.Request, b []byte, activityID *url.URL, uuid paths.UUID) error {
+	u := *req.URL
+	u.Path = paths.UUIDPathFor(paths.InboxPathKey, uuid)
+	ureq := req.WithContext(req.Context())
+	ureq.URL = &u
+	ureq.Body = ioutil.NopCloser(bytes.NewReader(b))
+	c := util.WithUserAPHTTPContext(r.scheme, r.host, ureq, uuid, "")
+	c.WithSharedInboxDelivery(true)
+	c.WithSignatureVerified(true)
+	inboxIRI := &url.URL{
+		Scheme: r.scheme,
+		Host:   r.host,
+		Path:   u.Path,
+	}
+	if reserved, err := r.idempotency.ReserveInboxProcessed(c, inboxIRI, activityID); err != nil {
+		return err
+	} else if !reserved {
+		return nil
+	}
+	sr := &statusRecorder{header: make(http.Header), status: http.StatusOK}
+	isApRequest, err := r.userActor.PostInboxScheme(c.Context, sr, ureq, r.scheme)
+	if err == nil && !isApRequest {
+		err = fmt.Errorf("not an ActivityPub request")
+	} else if err == nil && sr.status >= 400 {
+		err = fmt.Errorf("inbox responded with status %d", sr.status)
+	}
+	if err != nil {
+		r.releaseInboxProcessed(inboxIRI, activityID)
+	}
+	return err
+}
+
+// releaseInboxProcessed forgets the reservation of an activity the inbox failed
+// to process, so that the peer redelivering it has it processed. It is released
+// even if the request was cancelled.
+func (r *Route) releaseInboxProcessed(inboxIRI, activityID *url.URL) {
+	if err := r.idempotency.ReleaseInboxProcessed(util.Context{context.Background()}, inboxIRI, activityID); err != nil {
+		util.ErrorLogger.Errorf("Error releasing processed activity %s of %s: %s", activityID, inboxIRI, err)
+	}
+}
+
+// statusRecorder is a http.ResponseWriter that discards the response except for
+// its status.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (s *statusRecorder) Header() http.Header {
+	return s.header
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+}
+
 func (r *Route) userActorPostOutbox() *Route {
 	return r.actorPostOutbox(r.userActor, paths.Route(paths.OutboxPathKey))
 }
@@ -302,8 +742,28 @@ func (r *Route) knownActorPostOutbox(c paths.Actor) *Route {
 	return r.actorPostOutbox(r.actorMap[c], paths.ActorPathFor(paths.OutboxPathKey, c))
 }
 
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	locationHeader       = "Location"
+	retryAfterHeader     = "Retry-After"
+)
+
+// idempotentResponseWriter notes the activity an outbox POST created, so that
+// it can be returned again when a client retries with the same idempotency key.
+type idempotentResponseWriter struct {
+	http.ResponseWriter
+	created *url.URL
+}
+
+func (i *idempotentResponseWriter) WriteHeader(statusCode int) {
+	if loc := i.Header().Get(locationHeader); statusCode == http.StatusCreated && len(loc) > 0 {
+		i.created, _ = url.Parse(loc)
+	}
+	i.ResponseWriter.WriteHeader(statusCode)
+}
+
 func (r *Route) actorPostOutbox(actor pub.Actor, path string) *Route {
-	r.route = r.route.Path(path).Schemes(r.scheme).Methods("POST").HandlerFunc(
+	r.route = r.route.Path(path).Schemes(r.scheme).Methods("POST").Handler(r.requireScope(app.CapabilityPostOutbox)(http.HandlerFunc(
 		func(w http.ResponseWriter, req *http.Request) {
 			userID, _, err := r.oauth.Validate(w, req)
 			if err != nil {
@@ -316,8 +776,39 @@ func (r *Route) actorPostOutbox(actor pub.Actor, path string) *Route {
 				r.errorHandler.ServeHTTP(w, req)
 				return
 			}
+			if !r.limitBody(w, req) {
+				return
+			}
 			c := util.WithUserAPHTTPContext(r.scheme, r.host, req, uuid, userID)
-			isApRequest, err := actor.PostOutboxScheme(c.Context, w, req, r.scheme)
+			outboxIRI := &url.URL{
+				Scheme: r.scheme,
+				Host:   r.host,
+				Path:   req.URL.Path,
+			}
+			iw := &idempotentResponseWriter{ResponseWriter: w}
+			if key := req.Header.Get(idempotencyKeyHeader); len(key) > 0 {
+				if !r.reserveIdempotencyKey(w, req, c, outboxIRI, key) {
+					return
+				}
+				defer r.finishIdempotencyKey(outboxIRI, key, iw)
+			}
+			if ok, retryAfter, err := r.posts.Allow(c, uuid); err != nil {
+				util.ErrorLogger.Errorf("Error checking post rate limit in ActorPostOutbox: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			} else if !ok {
+				w.Header().Set(retryAfterHeader, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			if raw, err := peekActivity(req); err != nil {
+				util.ErrorLogger.Errorf("Error reading body in ActorPostOutbox: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			} else if raw != nil {
+				c.WithRawActivity(raw)
+			}
+			isApRequest, err := actor.PostOutboxScheme(c.Context, iw, req, r.scheme)
 			if err != nil {
 				util.ErrorLogger.Errorf("Error in ActorPostOutbox: %s", err)
 				r.errorHandler.ServeHTTP(w, req)
@@ -327,10 +818,50 @@ func (r *Route) actorPostOutbox(actor pub.Actor, path string) *Route {
 				return
 			}
 			return
-		})
+		})))
 	return r
 }
 
+// reserveIdempotencyKey reserves the idempotency key of an outbox POST before
+// it is applied, so that concurrent retries are not applied twice. If the key
+// was already used, the response is written instead: the activity created by
+// the earlier request, or a conflict while that request is still in progress.
+func (r *Route) reserveIdempotencyKey(w http.ResponseWriter, req *http.Request, c util.Context, outboxIRI *url.URL, key string) bool {
+	if reserved, err := r.idempotency.Reserve(c, outboxIRI, key); err != nil {
+		util.ErrorLogger.Errorf("Error reserving idempotency key in ActorPostOutbox: %s", err)
+		r.errorHandler.ServeHTTP(w, req)
+		return false
+	} else if reserved {
+		return true
+	}
+	prev, err := r.idempotency.Get(c, outboxIRI, key)
+	if err != nil {
+		util.ErrorLogger.Errorf("Error fetching idempotency key in ActorPostOutbox: %s", err)
+		r.errorHandler.ServeHTTP(w, req)
+	} else if prev != nil {
+		w.Header().Set(locationHeader, prev.String())
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		http.Error(w, "a request with this idempotency key is in progress", http.StatusConflict)
+	}
+	return false
+}
+
+// finishIdempotencyKey records the activity created with the reserved
+// idempotency key, or releases the key if the request created none, so that it
+// may be retried. It uses a context detached from the request, as a
+// reservation left behind would refuse every retry.
+func (r *Route) finishIdempotencyKey(outboxIRI *url.URL, key string, iw *idempotentResponseWriter) {
+	c := util.Context{context.Background()}
+	if iw.created != nil {
+		if err := r.idempotency.Put(c, outboxIRI, key, iw.created); err != nil {
+			util.ErrorLogger.Errorf("Error storing idempotency key in ActorPostOutbox: %s", err)
+		}
+	} else if err := r.idempotency.Release(c, outboxIRI, key); err != nil {
+		util.ErrorLogger.Errorf("Error releasing idempotency key in ActorPostOutbox: %s", err)
+	}
+}
+
 func (r *Route) userActorGetInbox(web func(w http.ResponseWriter, r *http.Request, inbox vocab.ActivityStreamsOrderedCollectionPage)) *Route {
 	return r.actorGetInbox(r.userActor, paths.Route(paths.InboxPathKey), web)
 }
@@ -342,6 +873,9 @@ func (r *Route) knownActorGetInbox(c paths.Actor, web func(w http.ResponseWriter
 func (r *Route) actorGetInbox(actor pub.Actor, path string, web func(w http.ResponseWriter, r *http.Request, inbox vocab.ActivityStreamsOrderedCollectionPage)) *Route {
 	r.route = r.route.Path(path).Schemes(r.scheme).Methods("GET").HandlerFunc(
 		func(w http.ResponseWriter, req *http.Request) {
+			if !r.authorizeFetch(w, req) {
+				return
+			}
 			userID, _, err := r.oauth.Validate(w, req)
 			if err != nil {
 				userID = ""
@@ -393,6 +927,9 @@ func (r *Route) knownActorGetOutbox(c paths.Actor, web func(w http.ResponseWrite
 func (r *Route) actorGetOutbox(actor pub.Actor, path string, web func(w http.ResponseWriter, r *http.Request, outbox vocab.ActivityStreamsOrderedCollectionPage)) *Route {
 	r.route = r.route.Path(path).Schemes(r.scheme).Methods("GET").HandlerFunc(
 		func(w http.ResponseWriter, req *http.Request) {
+			if !r.authorizeFetch(w, req) {
+				return
+			}
 			userID, _, err := r.oauth.Validate(w, req)
 			if err != nil {
 				userID = ""
@@ -434,9 +971,12 @@ func (r *Route) actorGetOutbox(actor pub.Actor, path string, web func(w http.Res
 }
 
 func (r *Route) ActivityPubOnlyHandleFunc(path string, authFn app.AuthorizeFunc) app.Route {
-	apHandler := pub.NewActivityStreamsHandlerScheme(r.db, r.clock, r.scheme)
+	apHandler := r.cacheable(pub.NewActivityStreamsHandlerScheme(r.db, r.clock, r.scheme))
 	r.route = r.route.Path(path).Schemes(r.scheme).HandlerFunc(
 		func(w http.ResponseWriter, req *http.Request) {
+			if !r.authorizeFetch(w, req) {
+				return
+			}
 			c := util.WithAPHTTPContext(r.scheme, r.host, req)
 			permit := true
 			if authFn != nil {
@@ -449,7 +989,7 @@ func (r *Route) ActivityPubOnlyHandleFunc(path string, authFn app.AuthorizeFunc)
 				}
 			}
 			if !permit {
-				r.notFoundHandler.ServeHTTP(w, req)
+				r.notFound(w, req)
 				return
 			}
 			isASRequest, err := apHandler(c, w, req)
@@ -458,8 +998,8 @@ func (r *Route) ActivityPubOnlyHandleFunc(path string, authFn app.AuthorizeFunc)
 				r.errorHandler.ServeHTTP(w, req)
 				return
 			}
-			if !isASRequest && r.notFoundHandler != nil {
-				r.notFoundHandler.ServeHTTP(w, req)
+			if !isASRequest {
+				r.notFound(w, req)
 				return
 			}
 			return
@@ -468,9 +1008,12 @@ func (r *Route) ActivityPubOnlyHandleFunc(path string, authFn app.AuthorizeFunc)
 }
 
 func (r *Route) ActivityPubAndWebHandleFunc(path string, authFn app.AuthorizeFunc, f func(http.ResponseWriter, *http.Request)) app.Route {
-	apHandler := pub.NewActivityStreamsHandlerScheme(r.db, r.clock, r.scheme)
+	apHandler := r.cacheable(pub.NewActivityStreamsHandlerScheme(r.db, r.clock, r.scheme))
 	r.route = r.route.Path(path).Schemes(r.scheme).HandlerFunc(
 		func(w http.ResponseWriter, req *http.Request) {
+			if !r.authorizeFetch(w, req) {
+				return
+			}
 			c := util.WithAPHTTPContext(r.scheme, r.host, req)
 			permit := true
 			if authFn != nil {
@@ -483,7 +1026,7 @@ func (r *Route) ActivityPubAndWebHandleFunc(path string, authFn app.AuthorizeFun
 				}
 			}
 			if !permit {
-				r.notFoundHandler.ServeHTTP(w, req)
+				r.notFound(w, req)
 				return
 			}
 			isASRequest, err := apHandler(c, w, req)
@@ -501,13 +1044,38 @@ func (r *Route) ActivityPubAndWebHandleFunc(path string, authFn app.AuthorizeFun
 	return r
 }
 
+// CollectionShellFn fetches a collection without any of its items.
+type CollectionShellFn func(c util.Context, iri *url.URL) (vocab.ActivityStreamsCollection, error)
+
+// collectionShellDatabase serves the bare collection, without its items, when
+// the collection is fetched without any pagination parameters.
+type collectionShellDatabase struct {
+	RoutingDatabase
+	shell CollectionShellFn
+}
+
+func (d collectionShellDatabase) Get(c context.Context, id *url.URL) (vocab.Type, error) {
+	if paths.IsGetCollectionPage(id) {
+		return d.RoutingDatabase.Get(c, id)
+	}
+	return d.shell(util.Context{c}, id)
+}
+
 func (r *Route) apWebCollectionPageFetchingHandleFunc(path string,
 	authFn app.AuthorizeFunc,
 	f app.CollectionPageHandlerFunc,
-	fetch func(util.Context) (vocab.ActivityStreamsCollectionPage, error)) app.Route {
-	apHandler := pub.NewActivityStreamsHandlerScheme(r.db, r.clock, r.scheme)
+	fetch func(util.Context) (vocab.ActivityStreamsCollectionPage, error),
+	shell CollectionShellFn) app.Route {
+	var db pub.Database = r.db
+	if shell != nil {
+		db = collectionShellDatabase{r.db, shell}
+	}
+	apHandler := pub.NewActivityStreamsHandlerScheme(db, r.clock, r.scheme)
 	r.route = r.route.Path(path).Schemes(r.scheme).HandlerFunc(
 		func(w http.ResponseWriter, req *http.Request) {
+			if !r.authorizeFetch(w, req) {
+				return
+			}
 			userID, _, err := r.oauth.Validate(w, req)
 			if err != nil {
 				userID = ""
@@ -531,7 +1099,7 @@ func (r *Route) apWebCollectionPageFetchingHandleFunc(path string,
 				}
 			}
 			if !permit {
-				r.notFoundHandler.ServeHTTP(w, req)
+				r.notFound(w, req)
 				return
 			}
 			isASRequest, err := apHandler(c, w, req)
@@ -541,9 +1109,9 @@ func (r *Route) apWebCollectionPageFetchingHandleFunc(path string,
 				return
 			}
 			if !isASRequest {
-				if f == nil && r.notFoundHandler != nil {
-					r.notFoundHandler.ServeHTTP(w, req)
-				} else if f != nil {
+				if f == nil {
+					r.notFound(w, req)
+				} else {
 					ascp, err := fetch(c)
 					if err != nil {
 						util.ErrorLogger.Errorf("Error in apWebCollectionPageFetchingHandleFunc fetcher: %s", err)
@@ -558,13 +1126,106 @@ func (r *Route) apWebCollectionPageFetchingHandleFunc(path string,
 	return r
 }
 
+// getReplies serves the replies collections of local objects to ActivityPub
+// requests. The private replies are only served to the author of the object.
+func (r *Route) getReplies(exists func(util.Context, *url.URL) (bool, error)) *Route {
+	apHandler := pub.NewActivityStreamsHandlerScheme(r.db, r.clock, r.scheme)
+	r.route = r.route.Path(paths.RepliesRoute).Schemes(r.scheme).Methods("GET", "HEAD").HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if !r.authorizeFetch(w, req) {
+				return
+			}
+			c := util.WithAPHTTPContext(r.scheme, r.host, req)
+			iri, err := c.CompleteRequestURL()
+			if err != nil {
+				util.ErrorLogger.Errorf("Error building context for getReplies: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			}
+			if found, err := exists(c, iri); err != nil {
+				util.ErrorLogger.Errorf("Error in getReplies: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			} else if !found {
+				r.notFound(w, req)
+				return
+			}
+			userID, authed, err := r.oauth.Validate(w, req)
+			if err != nil {
+				util.ErrorLogger.Errorf("Error validating for getReplies: %s", err)
+			} else if authed {
+				private, err := r.isAuthorOf(c, paths.UUID(userID), paths.ObjectForReplies(iri))
+				if err != nil {
+					util.ErrorLogger.Errorf("Error in getReplies: %s", err)
+					r.errorHandler.ServeHTTP(w, req)
+					return
+				}
+				c.WithPrivateScope(private)
+			}
+			isASRequest, err := apHandler(c, w, req)
+			if err != nil {
+				util.ErrorLogger.Errorf("Error in getReplies apHandler: %s", err)
+				r.errorHandler.ServeHTTP(w, req)
+				return
+			}
+			if !isASRequest {
+				r.notFound(w, req)
+			}
+			return
+		})
+	return r
+}
+
+// isAuthorOf determines whether the object is attributed to the user.
+func (r *Route) isAuthorOf(c util.Context, userID paths.UUID, object *url.URL) (bool, error) {
+	t, err := r.db.Get(c, object)
+	if err != nil {
+		return false, err
+	}
+	return services.IsAuthor(t, paths.UUIDIRIFor(r.scheme, r.host, paths.UserPathKey, userID))
+}
+
+// VocabEnhanceFn modifies a fetched value before it is served.
+type VocabEnhanceFn func(c util.Context, t vocab.Type) (vocab.Type, error)
+
+// enhancedVocabDatabase applies a VocabEnhanceFn to the values it gets, so
+// that ActivityStreams responses match the web responses.
+type enhancedVocabDatabase struct {
+	RoutingDatabase
+	enhance VocabEnhanceFn
+}
+
+func (d enhancedVocabDatabase) Get(c context.Context, id *url.URL) (vocab.Type, error) {
+	t, err := d.RoutingDatabase.Get(c, id)
+	if err != nil {
+		return nil, err
+	}
+	return d.enhance(util.Context{c}, t)
+}
+
 func (r *Route) apWebVocabFetchingHandleFunc(path string,
 	authFn app.AuthorizeFunc,
 	f app.VocabHandlerFunc,
-	fetch func(util.Context) (vocab.Type, error)) app.Route {
-	apHandler := pub.NewActivityStreamsHandlerScheme(r.db, r.clock, r.scheme)
+	fetch func(util.Context) (vocab.Type, error),
+	enhance VocabEnhanceFn) app.Route {
+	var db pub.Database = r.db
+	if enhance != nil {
+		db = enhancedVocabDatabase{r.db, enhance}
+		get := fetch
+		fetch = func(c util.Context) (vocab.Type, error) {
+			t, err := get(c)
+			if err != nil {
+				return nil, err
+			}
+			return enhance(c, t)
+		}
+	}
+	apHandler := pub.NewActivityStreamsHandlerScheme(db, r.clock, r.scheme)
 	r.route = r.route.Path(path).Schemes(r.scheme).HandlerFunc(
 		func(w http.ResponseWriter, req *http.Request) {
+			if !r.authorizeFetch(w, req) {
+				return
+			}
 			userID, _, err := r.oauth.Validate(w, req)
 			if err != nil {
 				userID = ""
@@ -588,7 +1249,7 @@ func (r *Route) apWebVocabFetchingHandleFunc(path string,
 				}
 			}
 			if !permit {
-				r.notFoundHandler.ServeHTTP(w, req)
+				r.notFound(w, req)
 				return
 			}
 			isASRequest, err := apHandler(c, w, req)
@@ -598,9 +1259,9 @@ func (r *Route) apWebVocabFetchingHandleFunc(path string,
 				return
 			}
 			if !isASRequest {
-				if f == nil && r.notFoundHandler != nil {
-					r.notFoundHandler.ServeHTTP(w, req)
-				} else if f != nil {
+				if f == nil {
+					r.notFound(w, req)
+				} else {
 					vt, err := fetch(c)
 					if err != nil {
 						util.ErrorLogger.Errorf("Error in apWebVocabFetchingHandleFunc fetcher: %s", err)
@@ -0,0 +1,65 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"net/http"
+
+	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/framework/oauth2"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+	"github.com/gorilla/mux"
+)
+
+// ScopeEnforcerFunc returns middleware requiring requests to be authenticated
+// with a credential whose scope permits the capability.
+type ScopeEnforcerFunc func(c app.Capability) mux.MiddlewareFunc
+
+// requireScope returns middleware requiring requests to be authenticated with a
+// credential whose scope permits the capability, according to the scope
+// predicates of the application. Anonymous requests are responded to with 401
+// Unauthorized, and requests with an insufficient scope with 403 Forbidden.
+// Permitted requests are served with the authenticated user in their context.
+func requireScope(o *oauth2.Server, a app.Application, scheme, host string, c app.Capability) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, scope, authenticated, err := o.ValidateWithScope(w, r)
+			if err != nil {
+				util.InfoLogger.Infof("Could not validate credential for %s: %s", r.URL, err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			} else if !authenticated {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			permitted, err := app.ScopePermits(a, c, scope)
+			if err != nil {
+				util.ErrorLogger.Errorf("Error determining whether scope permits capability %d: %s", c, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			} else if !permitted {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			ctx := util.Context{r.Context()}
+			uuid := paths.UUID(userID)
+			ctx.WithAuthenticatedUser(uuid, paths.UUIDIRIFor(scheme, host, paths.UserPathKey, uuid), scope)
+			next.ServeHTTP(w, r.WithContext(ctx.Context))
+		})
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"crypto/tls"
 	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-fed/apcore/app"
@@ -41,14 +43,19 @@ type Server struct {
 	keyFile     string
 	a           app.Application
 	sqldb       *sql.DB
+	replicas    []*sql.DB
 	d           models.SqlDialect
 	models      []models.Model
 	httpServer  *http.Server
 	httpsServer *http.Server
 	ss          []StartStopper
+	health      *Health
+	grace       time.Duration
+	stopOnce    sync.Once
+	stopped     chan struct{}
 }
 
-func NewInsecureServer(c *config.Config, h http.Handler, a app.Application, sqldb *sql.DB, d models.SqlDialect, models []models.Model, ss []StartStopper) (s *Server, err error) {
+func NewInsecureServer(c *config.Config, h http.Handler, a app.Application, sqldb *sql.DB, replicas []*sql.DB, d models.SqlDialect, models []models.Model, ss []StartStopper, health *Health) (s *Server, err error) {
 	httpServer := &http.Server{
 		Addr:         ":http",
 		Handler:      h,
@@ -60,17 +67,19 @@ func NewInsecureServer(c *config.Config, h http.Handler, a app.Application, sqld
 	s = &Server{
 		a:          a,
 		sqldb:      sqldb,
+		replicas:   replicas,
 		d:          d,
+		models:     models,
 		httpServer: httpServer,
 		ss:         ss,
+		health:     health,
+		grace:      time.Duration(c.ServerConfig.ShutdownGraceSeconds) * time.Second,
+		stopped:    make(chan struct{}),
 	}
-
-	// Post-creation hooks
-	httpServer.RegisterOnShutdown(s.onStopHTTP)
 	return
 }
 
-func NewHTTPSServer(c *config.Config, h http.Handler, a app.Application, sqldb *sql.DB, d models.SqlDialect, models []models.Model, ss []StartStopper) (s *Server, err error) {
+func NewHTTPSServer(c *config.Config, h http.Handler, a app.Application, sqldb *sql.DB, replicas []*sql.DB, d models.SqlDialect, models []models.Model, ss []StartStopper, health *Health) (s *Server, err error) {
 	// Prepare HTTPS server. No option to run the server as HTTP in prod,
 	// because we're living in the future.
 	httpsServer := &http.Server{
@@ -90,14 +99,16 @@ func NewHTTPSServer(c *config.Config, h http.Handler, a app.Application, sqldb *
 		keyFile:     c.ServerConfig.KeyFile,
 		a:           a,
 		sqldb:       sqldb,
+		replicas:    replicas,
 		d:           d,
+		models:      models,
 		httpServer:  httpServer,
 		httpsServer: httpsServer,
 		ss:          ss,
+		health:      health,
+		grace:       time.Duration(c.ServerConfig.ShutdownGraceSeconds) * time.Second,
+		stopped:     make(chan struct{}),
 	}
-
-	// Post-creation hooks
-	httpsServer.RegisterOnShutdown(s.onStopHTTPS)
 	return
 }
 
@@ -132,16 +143,45 @@ func createRedirectServer(c *config.Config) *http.Server {
 }
 
 func (s *Server) Start() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if s.httpsServer != nil {
+		go s.serveRedirects()
+		util.InfoLogger.Infof("Launching https server")
+		return s.serve("HTTPS", func() error {
+			return s.httpsServer.ListenAndServeTLS(s.certFile, s.keyFile)
+		})
+	}
+	util.InfoLogger.Infof("Launching http server")
+	return s.serve("HTTP", s.httpServer.ListenAndServe)
+}
+
+// Serve is like Start, except that connections are accepted on the listener
+// instead of on the configured address, and no http redirection server is
+// run. It allows choosing the address, such as an unused port when running
+// several servers within one process.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if s.httpsServer != nil {
+		util.InfoLogger.Infof("Launching https server on %s", l.Addr())
+		return s.serve("HTTPS", func() error {
+			return s.httpsServer.ServeTLS(l, s.certFile, s.keyFile)
+		})
+	}
+	util.InfoLogger.Infof("Launching http server on %s", l.Addr())
+	return s.serve("HTTP", func() error {
+		return s.httpServer.Serve(l)
+	})
+}
+
+func (s *Server) start() error {
 	err := db.MustPing(s.sqldb)
 	if err != nil {
 		return err
 	}
-	util.InfoLogger.Infof("Preparing models")
-	for _, m := range s.models {
-		if err := m.Prepare(s.sqldb, s.d); err != nil {
-			return err
-		}
-	}
 	util.InfoLogger.Infof("Starting internal systems")
 	for _, st := range s.ss {
 		st.Start()
@@ -151,72 +191,63 @@ func (s *Server) Start() error {
 	if err != nil {
 		return err
 	}
-	if s.httpsServer != nil {
-		return s.startHTTPS()
-	} else {
-		return s.startHTTP()
-	}
+	s.health.setReady(true)
+	return nil
 }
 
-func (s *Server) startHTTPS() error {
-	go func() {
-		util.InfoLogger.Infof("Starting http redirection server")
-		err := s.httpServer.ListenAndServe()
-		if err != http.ErrServerClosed {
-			util.ErrorLogger.Errorf("Error shutting down http redirect server: %s", err)
-		} else {
-			util.InfoLogger.Infof("Http redirect server shutdown")
-		}
-	}()
-	util.InfoLogger.Infof("Launching https server")
-	err := s.httpsServer.ListenAndServeTLS(
-		s.certFile,
-		s.keyFile)
+// serveRedirects runs the http redirection server until it is stopped.
+func (s *Server) serveRedirects() {
+	util.InfoLogger.Infof("Starting http redirection server")
+	err := s.httpServer.ListenAndServe()
 	if err != http.ErrServerClosed {
-		util.ErrorLogger.Errorf("Error shutting down https server: %s", err)
+		util.ErrorLogger.Errorf("Error shutting down http redirect server: %s", err)
 	} else {
-		util.InfoLogger.Infof("HTTPS server shutdown")
+		util.InfoLogger.Infof("Http redirect server shutdown")
 	}
-	return nil
 }
 
-func (s *Server) startHTTP() error {
-	util.InfoLogger.Infof("Launching http server")
-	err := s.httpServer.ListenAndServe()
+// serve runs the named server with fn, returning once the server has been
+// stopped. If the server fails instead, it is stopped and the error returned.
+func (s *Server) serve(name string, fn func() error) error {
+	err := fn()
 	if err != http.ErrServerClosed {
-		util.ErrorLogger.Errorf("Error shutting down http server: %s", err)
-	} else {
-		util.InfoLogger.Infof("HTTP server shutdown")
+		util.ErrorLogger.Errorf("Error running %s server: %s", name, err)
+		s.Stop()
+		return err
 	}
+	util.InfoLogger.Infof("%s server no longer accepting connections", name)
+	<-s.stopped
 	return nil
 }
 
+// Stop stops accepting new connections and waits for in-flight requests to
+// finish within the shutdown grace period. Only once they have drained are
+// the internal systems stopped and the database closed.
+//
+// Stop may be called more than once, such as when the server fails while
+// being stopped, and returns once the server has stopped.
 func (s *Server) Stop() {
-	if s.httpsServer != nil {
-		s.stopHTTPS()
-	} else {
-		s.stopHTTP()
-	}
+	s.stopOnce.Do(s.stop)
 }
 
-func (s *Server) stopHTTPS() {
-	util.InfoLogger.Infof("Shutdown HTTPS server")
-	s.httpsServer.Shutdown(context.Background())
-}
-
-func (s *Server) stopHTTP() {
-	util.InfoLogger.Infof("Shutdown HTTP server")
-	s.httpServer.Shutdown(context.Background())
-}
-
-func (s *Server) onStopHTTPS() {
-	util.InfoLogger.Infof("Shutdown HTTP server")
-	s.httpServer.Shutdown(context.Background())
+func (s *Server) stop() {
+	s.health.setReady(false)
+	ctx, cancel := util.GraceContext(s.grace)
+	defer cancel()
+	if s.httpsServer != nil {
+		s.shutdown(ctx, "HTTPS", s.httpsServer)
+	}
+	s.shutdown(ctx, "HTTP", s.httpServer)
 	s.onStop()
+	close(s.stopped)
 }
 
-func (s *Server) onStopHTTP() {
-	s.onStop()
+func (s *Server) shutdown(ctx context.Context, name string, srv *http.Server) {
+	util.InfoLogger.Infof("Shutdown %s server", name)
+	if err := srv.Shutdown(ctx); err != nil {
+		util.ErrorLogger.Errorf("%s server did not drain in-flight requests within the grace period, closing: %s", name, err)
+		srv.Close()
+	}
 }
 
 func (s *Server) onStop() {
@@ -232,4 +263,13 @@ func (s *Server) onStop() {
 	for _, m := range s.models {
 		m.Close()
 	}
+	util.InfoLogger.Infof("Closing database")
+	if err := s.sqldb.Close(); err != nil {
+		util.ErrorLogger.Errorf("Error closing database: %s", err)
+	}
+	for _, r := range s.replicas {
+		if err := r.Close(); err != nil {
+			util.ErrorLogger.Errorf("Error closing read replica database: %s", err)
+		}
+	}
 }
@@ -0,0 +1,128 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	digestHeader        = "Digest"
+	contentDigestHeader = "Content-Digest"
+)
+
+var (
+	errDigestMissing     = errors.New("http signature does not sign a digest of the body")
+	errDigestMalformed   = errors.New("digest of the body is malformed")
+	errDigestUnsupported = errors.New("digest of the body uses no supported algorithm")
+	errDigestMismatch    = errors.New("digest does not match the body")
+)
+
+// digestHashes are the supported algorithms of a Digest or Content-Digest, by
+// their lowercased names.
+var digestHashes = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// CheckBody returns an error if the HTTP Signature of a POST request does not
+// sign each of the required headers, or if its Digest or Content-Digest does
+// not match the body. A signed Content-Digest satisfies a required Digest.
+// Unsigned requests are not checked, as they are rejected when authenticating.
+//
+// The body is left to be read again.
+func (s *SignatureWindow) CheckBody(req *http.Request) error {
+	params, ok := signatureParams(req.Header)
+	if !ok {
+		return nil
+	}
+	headers := signedHeaders(params)
+	for _, h := range s.postHeaders {
+		if strings.EqualFold(h, digestHeader) {
+			if !signsHeader(headers, digestHeader) && !signsHeader(headers, contentDigestHeader) {
+				return errDigestMissing
+			}
+		} else if !signsHeader(headers, h) {
+			return fmt.Errorf("http signature does not sign required header %s", h)
+		}
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if v := req.Header.Get(digestHeader); len(v) > 0 {
+		if err := verifyDigest(v, b, false); err != nil {
+			return err
+		}
+	}
+	if v := req.Header.Get(contentDigestHeader); len(v) > 0 {
+		if err := verifyDigest(v, b, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyDigest checks each digest in the comma-separated list of an RFC 3230
+// Digest, or of an RFC 9530 Content-Digest whose values are delimited by
+// colons, against the body. Digests of unsupported algorithms are ignored, but
+// at least one must be supported.
+func verifyDigest(v string, body []byte, contentDigest bool) error {
+	verified := false
+	for _, d := range strings.Split(v, ",") {
+		i := strings.Index(d, "=")
+		if i < 0 {
+			return errDigestMalformed
+		}
+		alg := strings.ToLower(strings.TrimSpace(d[:i]))
+		val := strings.TrimSpace(d[i+1:])
+		if contentDigest {
+			if len(val) < 2 || val[0] != ':' || val[len(val)-1] != ':' {
+				return errDigestMalformed
+			}
+			val = val[1 : len(val)-1]
+		}
+		newHash, ok := digestHashes[alg]
+		if !ok {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return errDigestMalformed
+		}
+		h := newHash()
+		h.Write(body)
+		if !bytes.Equal(h.Sum(nil), sum) {
+			return errDigestMismatch
+		}
+		verified = true
+	}
+	if !verified {
+		return errDigestUnsupported
+	}
+	return nil
+}
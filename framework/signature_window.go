@@ -0,0 +1,227 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+)
+
+const (
+	signatureHeader     = "Signature"
+	authorizationHeader = "Authorization"
+	dateHeader          = "Date"
+	createdHeader       = "(created)"
+)
+
+// defaultSignatureSkew is the clock skew allowed when none is configured.
+const defaultSignatureSkew = 5 * time.Minute
+
+var (
+	errSignatureNoTime  = errors.New("http signature does not sign its creation time")
+	errSignatureStale   = errors.New("http signature is outside of the allowed clock skew")
+	errSignatureExpired = errors.New("http signature has expired")
+	errSignatureReplay  = errors.New("http signature has already been seen")
+)
+
+// SignatureWindow rejects incoming HTTP Signatures that were made outside of
+// the allowed clock skew of this server's time and, optionally, those that have
+// already been seen, so that captured requests cannot be replayed.
+//
+// A signature is only ever accepted within the skew of its creation, so it is
+// remembered for only as long as it could otherwise be accepted.
+//
+// The signatures of POST requests must also sign the required headers, and the
+// digest of their body.
+type SignatureWindow struct {
+	// Immutable
+	clock         pub.Clock
+	skew          time.Duration
+	rejectReplays bool
+	postHeaders   []string
+	// Mutable, protected by mu
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewSignatureWindow creates a SignatureWindow allowing the clock skew, which
+// remembers seen signatures if rejecting replays and requires the signatures of
+// POST requests to sign the headers. A zero skew allows the default of five
+// minutes, and without any headers only a digest of the body must be signed.
+func NewSignatureWindow(clock pub.Clock, skew time.Duration, rejectReplays bool, postHeaders []string) *SignatureWindow {
+	if skew <= 0 {
+		skew = defaultSignatureSkew
+	}
+	if len(postHeaders) == 0 {
+		postHeaders = []string{digestHeader}
+	}
+	return &SignatureWindow{
+		clock:         clock,
+		skew:          skew,
+		rejectReplays: rejectReplays,
+		postHeaders:   postHeaders,
+		seen:          make(map[string]time.Time),
+	}
+}
+
+// Check returns an error if the request's HTTP Signature is stale, dated in the
+// future, expired, or already remembered. Unsigned requests are not checked, as
+// they are rejected when authenticating.
+//
+// The creation time of the signature is its created parameter if it signs
+// "(created)", and otherwise its signed Date header, so that an unsigned time
+// cannot be substituted.
+//
+// Check does not remember the signature, which is left to Remember once the
+// signature is verified, so that forged signatures cannot be used to refuse
+// genuine ones.
+func (s *SignatureWindow) Check(req *http.Request) error {
+	params, ok := signatureParams(req.Header)
+	if !ok {
+		return nil
+	}
+	now := s.clock.Now()
+	created, err := signatureCreated(params, req.Header)
+	if err != nil {
+		return err
+	}
+	if created.Before(now.Add(-s.skew)) || created.After(now.Add(s.skew)) {
+		return errSignatureStale
+	}
+	if v, ok := params["expires"]; ok {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		if time.Unix(sec, 0).Add(s.skew).Before(now) {
+			return errSignatureExpired
+		}
+	}
+	if !s.rejectReplays {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.seen[params["signature"]]; ok && !t.Before(now) {
+		return errSignatureReplay
+	}
+	return nil
+}
+
+// Remember notes the verified HTTP Signature of a request that passed Check,
+// if rejecting replays, returning an error if another request already used it.
+func (s *SignatureWindow) Remember(req *http.Request) error {
+	if !s.rejectReplays {
+		return nil
+	}
+	params, ok := signatureParams(req.Header)
+	if !ok {
+		return nil
+	}
+	created, err := signatureCreated(params, req.Header)
+	if err != nil {
+		return err
+	}
+	return s.remember(params["signature"], created.Add(s.skew), s.clock.Now())
+}
+
+// signatureCreated determines when the HTTP Signature was created, from the
+// "(created)" or Date header it signs.
+func signatureCreated(params map[string]string, h http.Header) (time.Time, error) {
+	headers := signedHeaders(params)
+	if signsHeader(headers, createdHeader) {
+		sec, err := strconv.ParseInt(params["created"], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0), nil
+	} else if signsHeader(headers, dateHeader) {
+		return http.ParseTime(h.Get(dateHeader))
+	}
+	return time.Time{}, errSignatureNoTime
+}
+
+// remember notes the signature until it is forgotten, returning an error if it
+// is already remembered.
+func (s *SignatureWindow) remember(sig string, forget, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastPrune) > s.skew {
+		for k, t := range s.seen {
+			if t.Before(now) {
+				delete(s.seen, k)
+			}
+		}
+		s.lastPrune = now
+	}
+	if t, ok := s.seen[sig]; ok && !t.Before(now) {
+		return errSignatureReplay
+	}
+	s.seen[sig] = forget
+	return nil
+}
+
+// signatureParams parses the parameters of the HTTP Signature in either the
+// Signature or Authorization header.
+func signatureParams(h http.Header) (params map[string]string, ok bool) {
+	v := h.Get(signatureHeader)
+	if len(v) == 0 {
+		const prefix = "Signature "
+		v = h.Get(authorizationHeader)
+		if !strings.HasPrefix(v, prefix) {
+			return nil, false
+		}
+		v = strings.TrimPrefix(v, prefix)
+	}
+	params = make(map[string]string)
+	for _, kv := range strings.Split(v, ",") {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			continue
+		}
+		k := strings.TrimSpace(kv[:i])
+		params[k] = strings.Trim(strings.TrimSpace(kv[i+1:]), `"`)
+	}
+	return params, len(params["signature"]) > 0
+}
+
+// signedHeaders is the space-separated list of headers the HTTP Signature
+// signs, which is only the Date when they are not listed.
+func signedHeaders(params map[string]string) string {
+	if headers, ok := params["headers"]; ok {
+		return headers
+	}
+	return strings.ToLower(dateHeader)
+}
+
+// signsHeader determines whether the space-separated list of signed headers
+// contains the header.
+func signsHeader(headers, header string) bool {
+	for _, h := range strings.Fields(headers) {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/services"
+	"github.com/go-fed/apcore/util"
+)
+
+const (
+	// maxThreadDepth bounds how many replies up or down from a note a
+	// thread is walked.
+	maxThreadDepth = 64
+	// maxThreadDescendants bounds the number of descendants in a thread.
+	maxThreadDescendants = 500
+	// threadRepliesPageSize is the number of replies fetched at a time
+	// when walking down a thread.
+	threadRepliesPageSize = 50
+)
+
+// Thread returns the conversation around a note as the viewer may see it: the
+// notes it replies to, root first, and the local replies to it and to each of
+// them, depth first. Notes the viewer may not see are left out along with their
+// replies, and an ancestor the viewer may not see ends the walk up the thread.
+// A nil viewer sees only public notes.
+//
+// Nothing is returned if the note is not known to this server or the viewer
+// may not see it.
+func (f *Framework) Thread(ctx context.Context, noteIRI, viewerIRI *url.URL) (ancestors, descendants []vocab.Type, err error) {
+	c := util.Context{ctx}
+	seen := map[string]bool{noteIRI.String(): true}
+
+	// The thread of a note the viewer may not see is not shown at all.
+	t, ok, err := f.visibleNote(c, noteIRI, viewerIRI)
+	if err != nil || !ok {
+		return nil, nil, err
+	}
+	parent, err := inReplyToOf(t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Walk up the inReplyTo of each ancestor, stopping at a cycle.
+	for depth := 0; parent != nil && depth < maxThreadDepth && !seen[parent.String()]; depth++ {
+		seen[parent.String()] = true
+		t, ok, err := f.visibleNote(c, parent, viewerIRI)
+		if err != nil {
+			return nil, nil, err
+		} else if !ok {
+			break
+		}
+		ancestors = append([]vocab.Type{t}, ancestors...)
+		if parent, err = inReplyToOf(t); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Walk down the replies of each descendant, depth first.
+	var walk func(id *url.URL, depth int) error
+	walk = func(id *url.URL, depth int) error {
+		if depth >= maxThreadDepth {
+			return nil
+		}
+		replies, err := f.repliesTo(c, id)
+		if err != nil {
+			return err
+		}
+		for _, r := range replies {
+			if len(descendants) >= maxThreadDescendants {
+				return nil
+			} else if seen[r.String()] {
+				continue
+			}
+			seen[r.String()] = true
+			t, ok, err := f.visibleNote(c, r, viewerIRI)
+			if err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			descendants = append(descendants, t)
+			if err := walk(r, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = walk(noteIRI, 0)
+	return
+}
+
+// knownNote fetches the note if it is known to this server.
+func (f *Framework) knownNote(c util.Context, id *url.URL) (t vocab.Type, ok bool, err error) {
+	if ok, err = f.data.Exists(c, id); err != nil || !ok {
+		return
+	}
+	t, err = f.data.Get(c, id)
+	return
+}
+
+// visibleNote fetches the note if it is known to this server and the viewer may
+// see it.
+func (f *Framework) visibleNote(c util.Context, id, viewer *url.URL) (t vocab.Type, ok bool, err error) {
+	if t, ok, err = f.knownNote(c, id); err != nil || !ok {
+		return
+	}
+	ok, err = f.isVisibleTo(c, t, viewer)
+	return
+}
+
+// repliesTo returns the replies to a local note, oldest first. Replies to notes
+// of peers are not known.
+func (f *Framework) repliesTo(c util.Context, id *url.URL) ([]*url.URL, error) {
+	if !f.data.Owns(id) {
+		return nil, nil
+	}
+	col := paths.RepliesIRIFor(id)
+	if exists, err := f.replies.Exists(c, col); err != nil || !exists {
+		return nil, err
+	}
+	var ids []*url.URL
+	for offset := 0; offset < maxThreadDescendants; offset += threadRepliesPageSize {
+		page, err := f.replies.GetPage(c, col, offset, threadRepliesPageSize)
+		if err != nil {
+			return nil, err
+		}
+		items := page.GetActivityStreamsItems()
+		if items == nil {
+			break
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			r, err := pub.ToId(iter)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, r)
+		}
+		if items.Len() < threadRepliesPageSize {
+			break
+		}
+	}
+	// Replies collections are newest first.
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids, nil
+}
+
+// isVisibleTo determines whether the viewer may see the value, which is when it
+// is public, attributed to the viewer, or addressed to the viewer directly or
+// through a local followers collection they are in.
+func (f *Framework) isVisibleTo(c util.Context, t vocab.Type, viewer *url.URL) (bool, error) {
+	if public, err := services.IsPublic(t); err != nil || public {
+		return public, err
+	} else if viewer == nil {
+		return false, nil
+	} else if author, err := services.IsAuthor(t, viewer); err != nil || author {
+		return author, err
+	}
+	addressees, err := services.AddressedTo(t)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range addressees {
+		if a.String() == viewer.String() {
+			return true, nil
+		}
+	}
+	for _, a := range addressees {
+		if !f.data.Owns(a) || !paths.IsFollowersPath(a) {
+			continue
+		}
+		if has, err := f.followers.Contains(c, a, viewer); err != nil {
+			return false, err
+		} else if has {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// inReplyToOf returns the first IRI the value is in reply to, or nil if it is
+// not a reply.
+func inReplyToOf(t vocab.Type) (*url.URL, error) {
+	r, ok := t.(interface {
+		GetActivityStreamsInReplyTo() vocab.ActivityStreamsInReplyToProperty
+	})
+	if !ok || r.GetActivityStreamsInReplyTo() == nil || r.GetActivityStreamsInReplyTo().Len() == 0 {
+		return nil, nil
+	}
+	return pub.ToId(r.GetActivityStreamsInReplyTo().At(0))
+}
@@ -0,0 +1,95 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package framework
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	forwardedProtoHeader = "X-Forwarded-Proto"
+	forwardedHostHeader  = "X-Forwarded-Host"
+)
+
+// parseTrustedProxies parses the configured CIDR ranges of trusted proxies.
+func parseTrustedProxies(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %s", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// trustedProxyHandler applies the scheme and host forwarded by a trusted
+// reverse proxy to the request, so that routing and HTTP Signature
+// verification see the request as the remote peer sent it.
+//
+// Forwarding headers on requests that do not come directly from a trusted
+// proxy are ignored, as anyone can set them.
+func trustedProxyHandler(trusted []*net.IPNet, next http.Handler) http.Handler {
+	if len(trusted) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isTrustedProxy(trusted, r.RemoteAddr) {
+			if proto := firstForwardedValue(r.Header.Get(forwardedProtoHeader)); proto == "http" || proto == "https" {
+				r.URL.Scheme = proto
+			}
+			if host := firstForwardedValue(r.Header.Get(forwardedHostHeader)); len(host) > 0 {
+				r.Host = host
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isTrustedProxy(trusted []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstForwardedValue obtains the value set by the proxy closest to the
+// original client, when a chain of proxies appended to the header.
+func firstForwardedValue(v string) string {
+	if i := strings.IndexByte(v, ','); i >= 0 {
+		v = v[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
@@ -0,0 +1,83 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag is the strong entity tag of a response body.
+func ETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WriteCacheable writes the response body with an ETag computed from it. When
+// the request's If-None-Match already has that ETag, 304 Not Modified is
+// written instead of the body. If maxAge is positive, the response may be
+// cached publicly for that many seconds.
+func WriteCacheable(w http.ResponseWriter, r *http.Request, b []byte, maxAge int) error {
+	etag := ETag(b)
+	w.Header().Set("ETag", etag)
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	}
+	if NotModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.WriteHeader(http.StatusOK)
+	n, err := w.Write(b)
+	if err != nil {
+		return err
+	} else if n != len(b) {
+		return fmt.Errorf("wrote %d of %d bytes", n, len(b))
+	}
+	return nil
+}
+
+// NotModified determines whether a conditional request already has the
+// response with the ETag, or one last modified at the modified time. A zero
+// modified time only compares the ETag. As RFC 7232 requires, If-Modified-Since
+// is ignored when the request has If-None-Match.
+func NotModified(r *http.Request, etag string, modified time.Time) bool {
+	if noneMatch := r.Header.Get("If-None-Match"); len(noneMatch) > 0 {
+		return etagsMatch(noneMatch, etag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// etagsMatch determines whether the value of an If-None-Match header has the
+// ETag, comparing weakly as RFC 7232 requires.
+func etagsMatch(noneMatch, etag string) bool {
+	for _, t := range strings.Split(noneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -32,22 +32,40 @@ type Sessions struct {
 }
 
 func NewSessions(c *config.Config, scheme string) (s *Sessions, err error) {
-	var authKey, encKey []byte
 	var keys [][]byte
-	authKey, err = ioutil.ReadFile(c.ServerConfig.CookieAuthKeyFile)
+	if len(c.ServerConfig.CookieEncryptionKeyFile) > 0 {
+		util.InfoLogger.Info("Cookie encryption key file detected")
+	} else {
+		util.InfoLogger.Info("No cookie encryption key file detected")
+	}
+	keys, err = readKeyPair(c.ServerConfig.CookieAuthKeyFile, c.ServerConfig.CookieEncryptionKeyFile)
 	if err != nil {
 		return
 	}
-	if len(c.ServerConfig.CookieEncryptionKeyFile) > 0 {
-		util.InfoLogger.Info("Cookie encryption key file detected")
-		encKey, err = ioutil.ReadFile(c.ServerConfig.CookieEncryptionKeyFile)
+	// Previous key pairs follow the current one, so that cookies are always
+	// encoded with the current pair but still decoded with the older ones.
+	sc := c.SessionConfig
+	for i, authFile := range sc.PreviousAuthKeyFiles {
+		var encFile string
+		if i < len(sc.PreviousEncryptionKeyFiles) {
+			encFile = sc.PreviousEncryptionKeyFiles[i]
+		}
+		var pair [][]byte
+		pair, err = readKeyPair(authFile, encFile)
 		if err != nil {
 			return
 		}
-		keys = [][]byte{authKey, encKey}
-	} else {
-		util.InfoLogger.Info("No cookie encryption key file detected")
-		keys = [][]byte{authKey}
+		// Pad the current pair: the store pairs keys positionally.
+		if len(keys) == 1 {
+			keys = append(keys, nil)
+		}
+		if len(pair) == 1 {
+			pair = append(pair, nil)
+		}
+		keys = append(keys, pair...)
+	}
+	if n := len(sc.PreviousAuthKeyFiles); n > 0 {
+		util.InfoLogger.Infof("Accepting sessions signed with %d previous cookie key(s)", n)
 	}
 	if len(c.ServerConfig.CookieSessionName) <= 0 {
 		err = fmt.Errorf("no cookie session name provided")
@@ -57,18 +75,53 @@ func NewSessions(c *config.Config, scheme string) (s *Sessions, err error) {
 		name:    c.ServerConfig.CookieSessionName,
 		cookies: gs.NewCookieStore(keys...),
 	}
+	domain := c.ServerConfig.Host
+	if len(sc.Domain) > 0 {
+		domain = sc.Domain
+	}
 	opt := &gs.Options{
 		Path:     "/",
-		Domain:   c.ServerConfig.Host,
+		Domain:   domain,
 		MaxAge:   c.ServerConfig.CookieMaxAge,
-		Secure:   scheme != "http",
+		Secure:   scheme != "http" && !sc.InsecureCookies,
 		HttpOnly: true,
+		SameSite: sameSiteMode(sc.SameSite),
 	}
 	s.cookies.Options = opt
 	s.cookies.MaxAge(opt.MaxAge)
 	return
 }
 
+// readKeyPair reads a cookie authentication key and, if a file is given, its
+// accompanying encryption key.
+func readKeyPair(authFile, encFile string) (keys [][]byte, err error) {
+	var authKey, encKey []byte
+	authKey, err = ioutil.ReadFile(authFile)
+	if err != nil {
+		return
+	}
+	keys = [][]byte{authKey}
+	if len(encFile) > 0 {
+		encKey, err = ioutil.ReadFile(encFile)
+		if err != nil {
+			return
+		}
+		keys = append(keys, encKey)
+	}
+	return
+}
+
+func sameSiteMode(v string) http.SameSite {
+	switch v {
+	case config.SameSiteStrict:
+		return http.SameSiteStrictMode
+	case config.SameSiteNone:
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
 func (s *Sessions) Get(r *http.Request) (ses *Session, err error) {
 	var gs *gs.Session
 	gs, err = s.cookies.Get(r, s.name)
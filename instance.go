@@ -0,0 +1,81 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package apcore
+
+import (
+	"net"
+
+	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/framework"
+	"github.com/go-fed/apcore/framework/config"
+)
+
+// Instance is a server built from a configuration in memory instead of a
+// configuration file, so that several can run within one process, such as
+// when testing how servers federate with each other.
+type Instance struct {
+	// Framework is the same one given to the application.
+	Framework app.Framework
+	s         *framework.Server
+}
+
+// NewInstance creates the tables of the configured database, if they do not
+// exist, and then builds the server. Unlike when loading a configuration file,
+// the host is kept as configured in debug mode, so that instances may differ
+// by port. Debug mode serves over http instead of https.
+func NewInstance(c *config.Config, a app.Application, debug bool) (i *Instance, err error) {
+	if err = c.Verify(); err != nil {
+		return
+	}
+	if err = a.SetConfiguration(a.NewConfiguration(), c, debug); err != nil {
+		return
+	}
+	scheme := "https"
+	if debug {
+		scheme = "http"
+	}
+	db, d, ms, err := newModelsFromConfig(c, a, scheme)
+	if err != nil {
+		return
+	}
+	err = createTables(db, d, ms, a, c, debug)
+	if cErr := db.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return
+	}
+	s, fw, err := newServerFromConfig(c, a, debug, scheme)
+	if err != nil {
+		return
+	}
+	i = &Instance{
+		Framework: fw,
+		s:         s,
+	}
+	return
+}
+
+// Serve accepts connections on the listener until Stop is called.
+func (i *Instance) Serve(l net.Listener) error {
+	return i.s.Serve(l)
+}
+
+// Stop gracefully shuts down the server.
+func (i *Instance) Stop() {
+	i.s.Stop()
+}
@@ -0,0 +1,114 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Blocks{}
+
+// Blocks is a Model that provides additional database methods for the actors
+// that local actors have blocked.
+type Blocks struct {
+	insert      *sql.Stmt
+	del         *sql.Stmt
+	contains    *sql.Stmt
+	getActivity *sql.Stmt
+}
+
+func (b *Blocks) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(b.insert), s.InsertBlock},
+			{&(b.del), s.DeleteBlock},
+			{&(b.contains), s.ContainsBlock},
+			{&(b.getActivity), s.GetBlockActivity},
+		})
+}
+
+func (b *Blocks) CreateTable(t *sql.Tx, s SqlDialect) error {
+	_, err := t.Exec(s.CreateBlocksTable())
+	return err
+}
+
+func (b *Blocks) Close() {
+	b.insert.Close()
+	b.del.Close()
+	b.contains.Close()
+	b.getActivity.Close()
+}
+
+// Add records that the actor blocked another actor, along with the Block
+// activity that was sent, if any. Blocking an actor again is not an error,
+// and keeps any previously recorded activity when none is provided.
+func (b *Blocks) Add(c util.Context, tx *sql.Tx, actor, blocked, activity *url.URL) error {
+	var activityID sql.NullString
+	if activity != nil {
+		activityID = sql.NullString{String: activity.String(), Valid: true}
+	}
+	_, err := tx.Stmt(b.insert).ExecContext(c,
+		actor.String(),
+		blocked.String(),
+		activityID)
+	return err
+}
+
+// Remove deletes the actor's block of another actor. It is not an error if
+// there is no such block.
+func (b *Blocks) Remove(c util.Context, tx *sql.Tx, actor, blocked *url.URL) error {
+	_, err := tx.Stmt(b.del).ExecContext(c, actor.String(), blocked.String())
+	return err
+}
+
+// Contains determines whether the actor blocked another actor.
+func (b *Blocks) Contains(c util.Context, tx *sql.Tx, actor, blocked *url.URL) (contains bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(b.contains).QueryContext(c, actor.String(), blocked.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = enforceOneRow(rows, "Blocks.Contains", func(r SingleRow) error {
+		return r.Scan(&contains)
+	})
+	return
+}
+
+// ActivityFor fetches the Block activity sent when the actor blocked another
+// actor. A nil IRI is returned if there is no such block, or if no activity
+// was sent.
+func (b *Blocks) ActivityFor(c util.Context, tx *sql.Tx, actor, blocked *url.URL) (activity *url.URL, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(b.getActivity).QueryContext(c, actor.String(), blocked.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var activityID sql.NullString
+	err = enforceOneRow(rows, "Blocks.ActivityFor", func(r SingleRow) error {
+		return r.Scan(&activityID)
+	})
+	if err != nil || !activityID.Valid {
+		return
+	}
+	activity, err = url.Parse(activityID.String)
+	return
+}
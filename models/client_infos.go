@@ -61,8 +61,8 @@ type ClientInfos struct {
 func (c *ClientInfos) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(c.create), s.CreateClientInfo()},
-			{&(c.getByID), s.GetClientInfoByID()},
+			{&(c.create), s.CreateClientInfo},
+			{&(c.getByID), s.GetClientInfoByID},
 		})
 }
 
@@ -93,7 +93,7 @@ func (c *ClientInfos) Create(ctx util.Context, tx *sql.Tx, info oauth2.ClientInf
 	})
 }
 
-// GetByID fetches ClientInfo based on its id.
+// GetByID fetches ClientInfo based on its id, or ErrNotFound if there is none.
 func (c *ClientInfos) GetByID(ctx util.Context, tx *sql.Tx, id string) (oauth2.ClientInfo, error) {
 	rows, err := tx.Stmt(c.getByID).QueryContext(ctx, id)
 	if err != nil {
@@ -101,7 +101,7 @@ func (c *ClientInfos) GetByID(ctx util.Context, tx *sql.Tx, id string) (oauth2.C
 	}
 	defer rows.Close()
 	ci := &ClientInfo{}
-	return ci, enforceOneRow(rows, "ClientInfos.GetByID", func(r SingleRow) error {
+	return ci, findOneRow(rows, "ClientInfos.GetByID", func(r SingleRow) error {
 		return r.Scan(&(ci.ID), &(ci.Secret), &(ci.Domain), &(ci.UserID))
 	})
 }
@@ -0,0 +1,206 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &CollectionDrift{}
+
+// DriftedCollection is a collection whose stored totalItems does not match the
+// number of items it actually contains.
+type DriftedCollection struct {
+	ID     URL
+	Stored int
+	Actual int
+}
+
+// DriftKind identifies which kind of collection to check for drift.
+type DriftKind string
+
+const (
+	InboxesDrift      DriftKind = "inboxes"
+	OutboxesDrift     DriftKind = "outboxes"
+	FollowersDrift    DriftKind = "followers"
+	FollowingDrift    DriftKind = "following"
+	LikedDrift        DriftKind = "liked"
+	FeaturedTagsDrift DriftKind = "featured_tags"
+	FeaturedDrift     DriftKind = "featured"
+	SharesDrift       DriftKind = "shares"
+	RepliesDrift      DriftKind = "replies"
+)
+
+// DriftKinds lists every kind of collection that may be checked for drift.
+var DriftKinds = []DriftKind{
+	InboxesDrift,
+	OutboxesDrift,
+	FollowersDrift,
+	FollowingDrift,
+	LikedDrift,
+	FeaturedTagsDrift,
+	FeaturedDrift,
+	SharesDrift,
+	RepliesDrift,
+}
+
+type driftStmts struct {
+	sample *sql.Stmt
+	repair *sql.Stmt
+	// missing is nil for the collections of objects, which actors do not
+	// own.
+	missing *sql.Stmt
+}
+
+// CollectionDrift is a Model that detects and repairs collections whose
+// totalItems has drifted from their actual number of items, such as after a
+// crash, as well as users whose collections are missing entirely.
+//
+// It does not own any tables.
+type CollectionDrift struct {
+	stmts map[DriftKind]*driftStmts
+}
+
+func (d *CollectionDrift) Prepare(db *sql.DB, s SqlDialect) error {
+	d.stmts = map[DriftKind]*driftStmts{
+		InboxesDrift:      &driftStmts{},
+		OutboxesDrift:     &driftStmts{},
+		FollowersDrift:    &driftStmts{},
+		FollowingDrift:    &driftStmts{},
+		LikedDrift:        &driftStmts{},
+		FeaturedTagsDrift: &driftStmts{},
+		FeaturedDrift:     &driftStmts{},
+		SharesDrift:       &driftStmts{},
+		RepliesDrift:      &driftStmts{},
+	}
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(d.stmts[InboxesDrift].sample), s.SampleInboxesDrift},
+			{&(d.stmts[InboxesDrift].repair), s.RepairInboxesTotalItems},
+			{&(d.stmts[InboxesDrift].missing), s.ActorsMissingInboxes},
+			{&(d.stmts[OutboxesDrift].sample), s.SampleOutboxesDrift},
+			{&(d.stmts[OutboxesDrift].repair), s.RepairOutboxesTotalItems},
+			{&(d.stmts[OutboxesDrift].missing), s.ActorsMissingOutboxes},
+			{&(d.stmts[FollowersDrift].sample), s.SampleFollowersDrift},
+			{&(d.stmts[FollowersDrift].repair), s.RepairFollowersTotalItems},
+			{&(d.stmts[FollowersDrift].missing), s.ActorsMissingFollowers},
+			{&(d.stmts[FollowingDrift].sample), s.SampleFollowingDrift},
+			{&(d.stmts[FollowingDrift].repair), s.RepairFollowingTotalItems},
+			{&(d.stmts[FollowingDrift].missing), s.ActorsMissingFollowing},
+			{&(d.stmts[LikedDrift].sample), s.SampleLikedDrift},
+			{&(d.stmts[LikedDrift].repair), s.RepairLikedTotalItems},
+			{&(d.stmts[LikedDrift].missing), s.ActorsMissingLiked},
+			{&(d.stmts[FeaturedTagsDrift].sample), s.SampleFeaturedTagsDrift},
+			{&(d.stmts[FeaturedTagsDrift].repair), s.RepairFeaturedTagsTotalItems},
+			{&(d.stmts[FeaturedTagsDrift].missing), s.ActorsMissingFeaturedTags},
+			{&(d.stmts[FeaturedDrift].sample), s.SampleFeaturedDrift},
+			{&(d.stmts[FeaturedDrift].repair), s.RepairFeaturedTotalItems},
+			{&(d.stmts[FeaturedDrift].missing), s.ActorsMissingFeatured},
+			{&(d.stmts[SharesDrift].sample), s.SampleSharesDrift},
+			{&(d.stmts[SharesDrift].repair), s.RepairSharesTotalItems},
+			{&(d.stmts[RepliesDrift].sample), s.SampleRepliesDrift},
+			{&(d.stmts[RepliesDrift].repair), s.RepairRepliesTotalItems},
+		})
+}
+
+func (d *CollectionDrift) CreateTable(t *sql.Tx, s SqlDialect) error {
+	return nil
+}
+
+func (d *CollectionDrift) Close() {
+	for _, st := range d.stmts {
+		st.sample.Close()
+		st.repair.Close()
+		if st.missing != nil {
+			st.missing.Close()
+		}
+	}
+}
+
+// Sample randomly checks up to n collections of the given kind, returning the
+// ones whose totalItems has drifted.
+func (d *CollectionDrift) Sample(c util.Context, tx *sql.Tx, kind DriftKind, n int) (dc []DriftedCollection, err error) {
+	return d.sample(c, tx, kind, n, "CollectionDrift.Sample")
+}
+
+// Repair sets the totalItems of the collection to its actual number of items.
+func (d *CollectionDrift) Repair(c util.Context, tx *sql.Tx, kind DriftKind, id *url.URL) error {
+	r, err := tx.Stmt(d.stmts[kind].repair).ExecContext(c, id.String())
+	return mustChangeOneRow(r, err, "CollectionDrift.Repair")
+}
+
+// Recount sets the totalItems of every collection of the given kind to its
+// actual number of items, returning the collections that had drifted.
+func (d *CollectionDrift) Recount(c util.Context, tx *sql.Tx, kind DriftKind) (dc []DriftedCollection, err error) {
+	dc, err = d.sample(c, tx, kind, nil, "CollectionDrift.Recount")
+	if err != nil {
+		return
+	}
+	for _, x := range dc {
+		if err = d.Repair(c, tx, kind, x.ID.URL); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// sample checks up to n collections of the given kind, or every one if n is
+// nil, returning the ones whose totalItems has drifted.
+func (d *CollectionDrift) sample(c util.Context, tx *sql.Tx, kind DriftKind, n interface{}, name string) (dc []DriftedCollection, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(d.stmts[kind].sample).QueryContext(c, n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return dc, doForRows(rows, name, func(r SingleRow) error {
+		var x DriftedCollection
+		if err := r.Scan(&x.ID, &x.Stored, &x.Actual); err != nil {
+			return err
+		}
+		dc = append(dc, x)
+		return nil
+	})
+}
+
+// ActorsOwn returns whether actors own the collections of the given kind, so
+// that every user has one.
+func (d *CollectionDrift) ActorsOwn(kind DriftKind) bool {
+	return d.stmts[kind].missing != nil
+}
+
+// ActorsMissing returns the actor IDs of users that have no collection of the
+// given kind, which actors must own.
+func (d *CollectionDrift) ActorsMissing(c util.Context, tx *sql.Tx, kind DriftKind) (ids []URL, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(d.stmts[kind].missing).QueryContext(c)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return ids, doForRows(rows, "CollectionDrift.ActorsMissing", func(r SingleRow) error {
+		var id URL
+		if err := r.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+}
@@ -38,12 +38,12 @@ type Credentials struct {
 func (c *Credentials) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(c.createCred), s.CreateFirstPartyCredential()},
-			{&(c.updateCred), s.UpdateFirstPartyCredential()},
-			{&(c.updateCredExpires), s.UpdateFirstPartyCredentialExpires()},
-			{&(c.removeCred), s.RemoveFirstPartyCredential()},
-			{&(c.removeExpiredCreds), s.RemoveExpiredFirstPartyCredentials()},
-			{&(c.getTokenInfoByCredID), s.GetTokenInfoForCredentialID()},
+			{&(c.createCred), s.CreateFirstPartyCredential},
+			{&(c.updateCred), s.UpdateFirstPartyCredential},
+			{&(c.updateCredExpires), s.UpdateFirstPartyCredentialExpires},
+			{&(c.removeCred), s.RemoveFirstPartyCredential},
+			{&(c.removeExpiredCreds), s.RemoveExpiredFirstPartyCredentials},
+			{&(c.getTokenInfoByCredID), s.GetTokenInfoForCredentialID},
 		})
 }
 
@@ -41,24 +41,45 @@ type DeliveryAttempts struct {
 	markDeliveryAttemptSuccessful *sql.Stmt
 	markDeliveryAttemptFailed     *sql.Stmt
 	markDeliveryAttemptAbandoned  *sql.Stmt
+	setSignedHeaders              *sql.Stmt
 	firstRetryablePage            *sql.Stmt
 	nextRetryablePage             *sql.Stmt
+	getForActivity                *sql.Stmt
+	getByID                       *sql.Stmt
 }
 
 func (d *DeliveryAttempts) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(d.insertDeliveryAttempt), s.InsertAttempt()},
-			{&(d.markDeliveryAttemptSuccessful), s.MarkSuccessfulAttempt()},
-			{&(d.markDeliveryAttemptFailed), s.MarkFailedAttempt()},
-			{&(d.markDeliveryAttemptAbandoned), s.MarkAbandonedAttempt()},
-			{&(d.firstRetryablePage), s.FirstPageRetryableFailures()},
-			{&(d.nextRetryablePage), s.NextPageRetryableFailures()},
+			{&(d.insertDeliveryAttempt), s.InsertAttempt},
+			{&(d.markDeliveryAttemptSuccessful), s.MarkSuccessfulAttempt},
+			{&(d.markDeliveryAttemptFailed), s.MarkFailedAttempt},
+			{&(d.markDeliveryAttemptAbandoned), s.MarkAbandonedAttempt},
+			{&(d.setSignedHeaders), s.SetAttemptSignedHeaders},
+			{&(d.firstRetryablePage), s.FirstPageRetryableFailures},
+			{&(d.nextRetryablePage), s.NextPageRetryableFailures},
+			{&(d.getForActivity), s.GetAttemptsForActivity},
+			{&(d.getByID), s.GetAttemptByID},
 		})
 }
 
 func (d *DeliveryAttempts) CreateTable(t *sql.Tx, s SqlDialect) error {
-	_, err := t.Exec(s.CreateDeliveryAttemptsTable())
+	if _, err := t.Exec(s.CreateDeliveryAttemptsTable()); err != nil {
+		return err
+	}
+	// Tables created before payloads could be compressed lack the column.
+	if _, err := t.Exec(s.AddDeliveryAttemptsPayloadCompressedColumn()); err != nil {
+		return err
+	}
+	// Tables created before activity ids were recorded lack the column.
+	if _, err := t.Exec(s.AddDeliveryAttemptsActivityIDColumn()); err != nil {
+		return err
+	}
+	// Tables created before signed headers were recorded lack the column.
+	if _, err := t.Exec(s.AddDeliveryAttemptsSignedHeadersColumn()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexActivityIDDeliveryAttemptsTable())
 	return err
 }
 
@@ -66,16 +87,24 @@ func (d *DeliveryAttempts) Close() {
 	d.insertDeliveryAttempt.Close()
 	d.markDeliveryAttemptSuccessful.Close()
 	d.markDeliveryAttemptFailed.Close()
+	d.markDeliveryAttemptAbandoned.Close()
+	d.setSignedHeaders.Close()
+	d.getForActivity.Close()
+	d.getByID.Close()
 }
 
-// Create a new delivery attempt.
-func (d *DeliveryAttempts) Create(c util.Context, tx *sql.Tx, from string, toActor *url.URL, payload []byte) (id string, err error) {
+// Create a new delivery attempt. The payload is stored as-is, with compressed
+// recording whether it has been compressed. The activityID of the payload may
+// be empty if it is unknown.
+func (d *DeliveryAttempts) Create(c util.Context, tx *sql.Tx, from string, toActor *url.URL, payload []byte, compressed bool, activityID string) (id string, err error) {
 	var rows *sql.Rows
 	rows, err = tx.Stmt(d.insertDeliveryAttempt).QueryContext(c,
 		from,
 		toActor.String(),
 		payload,
-		newDeliveryAttempt)
+		compressed,
+		newDeliveryAttempt,
+		activityID)
 	if err != nil {
 		return
 	}
@@ -109,26 +138,39 @@ func (d *DeliveryAttempts) MarkAbandoned(c util.Context, tx *sql.Tx, id string)
 	return mustChangeOneRow(r, err, "DeliveryAttempts.Abandoned")
 }
 
+// SetSignedHeaders records the headers, serialized as JSON, with which the
+// latest attempt was signed and sent, replacing those of earlier attempts.
+func (d *DeliveryAttempts) SetSignedHeaders(c util.Context, tx *sql.Tx, id string, headers []byte) error {
+	r, err := tx.Stmt(d.setSignedHeaders).ExecContext(c,
+		id,
+		headers)
+	return mustChangeOneRow(r, err, "DeliveryAttempts.SetSignedHeaders")
+}
+
 type RetryableFailure struct {
 	ID          string
 	UserID      string
 	DeliverTo   URL
 	Payload     []byte
+	Compressed  bool
 	NAttempts   int
 	LastAttempt time.Time
 }
 
 // FirstPageFailures obtains the first page of retryable failures.
-func (d *DeliveryAttempts) FirstPageFailures(c util.Context, tx *sql.Tx, fetchTime time.Time, n int) (rf []RetryableFailure, err error) {
+//
+// Attempts still new whose last attempt is before staleTime are included, as
+// their delivery was lost before its outcome was recorded.
+func (d *DeliveryAttempts) FirstPageFailures(c util.Context, tx *sql.Tx, fetchTime, staleTime time.Time, n int) (rf []RetryableFailure, err error) {
 	var rows *sql.Rows
-	rows, err = tx.Stmt(d.firstRetryablePage).QueryContext(c, failedDeliveryAttempt, fetchTime, n)
+	rows, err = tx.Stmt(d.firstRetryablePage).QueryContext(c, failedDeliveryAttempt, fetchTime, n, newDeliveryAttempt, staleTime)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	return rf, doForRows(rows, "DeliveryAttempts.FirstPageFailures", func(r SingleRow) error {
 		var rt RetryableFailure
-		if err := r.Scan(&(rt.ID), &(rt.UserID), &(rt.DeliverTo), &(rt.Payload), &(rt.NAttempts), &(rt.LastAttempt)); err != nil {
+		if err := r.Scan(&(rt.ID), &(rt.UserID), &(rt.DeliverTo), &(rt.Payload), &(rt.Compressed), &(rt.NAttempts), &(rt.LastAttempt)); err != nil {
 			return err
 		}
 		rf = append(rf, rt)
@@ -137,19 +179,78 @@ func (d *DeliveryAttempts) FirstPageFailures(c util.Context, tx *sql.Tx, fetchTi
 }
 
 // NextPageFailures obtains the next page of retryable failures.
-func (d *DeliveryAttempts) NextPageFailures(c util.Context, tx *sql.Tx, prevID string, fetchTime time.Time, n int) (rf []RetryableFailure, err error) {
+func (d *DeliveryAttempts) NextPageFailures(c util.Context, tx *sql.Tx, prevID string, fetchTime, staleTime time.Time, n int) (rf []RetryableFailure, err error) {
 	var rows *sql.Rows
-	rows, err = tx.Stmt(d.nextRetryablePage).QueryContext(c, failedDeliveryAttempt, fetchTime, n, prevID)
+	rows, err = tx.Stmt(d.nextRetryablePage).QueryContext(c, failedDeliveryAttempt, fetchTime, n, prevID, newDeliveryAttempt, staleTime)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	return rf, doForRows(rows, "DeliveryAttempts.NextPageFailures", func(r SingleRow) error {
 		var rt RetryableFailure
-		if err := r.Scan(&(rt.ID), &(rt.UserID), &(rt.DeliverTo), &(rt.Payload), &(rt.NAttempts), &(rt.LastAttempt)); err != nil {
+		if err := r.Scan(&(rt.ID), &(rt.UserID), &(rt.DeliverTo), &(rt.Payload), &(rt.Compressed), &(rt.NAttempts), &(rt.LastAttempt)); err != nil {
 			return err
 		}
 		rf = append(rf, rt)
 		return nil
 	})
 }
+
+// DeliveryStatus is the state of delivering an activity to one recipient.
+type DeliveryStatus struct {
+	UserID      string
+	DeliverTo   URL
+	State       string
+	NAttempts   int
+	LastAttempt time.Time
+}
+
+// ForActivity obtains the status of delivering the activity to each of its
+// recipients.
+func (d *DeliveryAttempts) ForActivity(c util.Context, tx *sql.Tx, activity *url.URL) (ds []DeliveryStatus, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(d.getForActivity).QueryContext(c, activity.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return ds, doForRows(rows, "DeliveryAttempts.ForActivity", func(r SingleRow) error {
+		var s DeliveryStatus
+		if err := r.Scan(&(s.UserID), &(s.DeliverTo), &(s.State), &(s.NAttempts), &(s.LastAttempt)); err != nil {
+			return err
+		}
+		ds = append(ds, s)
+		return nil
+	})
+}
+
+// DeliveryAttempt is a single attempt at delivering a payload to a recipient.
+type DeliveryAttempt struct {
+	ID          string
+	CreateTime  time.Time
+	UserID      string
+	DeliverTo   URL
+	Payload     []byte
+	Compressed  bool
+	ActivityID  sql.NullString
+	State       string
+	NAttempts   int
+	LastAttempt time.Time
+	// SignedHeaders are the headers, serialized as JSON, with which the
+	// latest attempt was signed and sent. It is nil if none was sent.
+	SignedHeaders []byte
+}
+
+// GetByID obtains the delivery attempt with its stored payload. ErrNotFound is
+// returned if there is no such attempt.
+func (d *DeliveryAttempts) GetByID(c util.Context, tx *sql.Tx, id string) (da DeliveryAttempt, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(d.getByID).QueryContext(c, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return da, findOneRow(rows, "DeliveryAttempts.GetByID", func(r SingleRow) error {
+		return r.Scan(&(da.ID), &(da.CreateTime), &(da.UserID), &(da.DeliverTo), &(da.Payload), &(da.Compressed), &(da.ActivityID), &(da.State), &(da.NAttempts), &(da.LastAttempt), &(da.SignedHeaders))
+	})
+}
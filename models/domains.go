@@ -0,0 +1,126 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Domains{}
+
+// DomainList is a list of domains that federation is restricted by.
+type DomainList string
+
+const (
+	// AllowedDomains are the only domains federated with in allowlist mode.
+	AllowedDomains DomainList = "allowed"
+	// BlockedDomains are the domains not federated with in blocklist mode.
+	BlockedDomains DomainList = "blocked"
+)
+
+// Domains is a Model that provides additional database methods for the lists
+// of domains that federation is restricted by.
+type Domains struct {
+	insertAllowed   *sql.Stmt
+	deleteAllowed   *sql.Stmt
+	containsAllowed *sql.Stmt
+	insertBlocked   *sql.Stmt
+	deleteBlocked   *sql.Stmt
+	containsBlocked *sql.Stmt
+}
+
+func (d *Domains) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(d.insertAllowed), s.InsertAllowedDomain},
+			{&(d.deleteAllowed), s.DeleteAllowedDomain},
+			{&(d.containsAllowed), s.ContainsAllowedDomain},
+			{&(d.insertBlocked), s.InsertBlockedDomain},
+			{&(d.deleteBlocked), s.DeleteBlockedDomain},
+			{&(d.containsBlocked), s.ContainsBlockedDomain},
+		})
+}
+
+func (d *Domains) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateAllowedDomainsTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateBlockedDomainsTable())
+	return err
+}
+
+func (d *Domains) Close() {
+	d.insertAllowed.Close()
+	d.deleteAllowed.Close()
+	d.containsAllowed.Close()
+	d.insertBlocked.Close()
+	d.deleteBlocked.Close()
+	d.containsBlocked.Close()
+}
+
+// Add puts the domain on the list. It is not an error if it already is.
+func (d *Domains) Add(c util.Context, tx *sql.Tx, list DomainList, domain string) error {
+	stmt, err := d.pick(list, d.insertAllowed, d.insertBlocked)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Stmt(stmt).ExecContext(c, domain)
+	return err
+}
+
+// Remove takes the domain off of the list. It is not an error if it is not on
+// the list.
+func (d *Domains) Remove(c util.Context, tx *sql.Tx, list DomainList, domain string) error {
+	stmt, err := d.pick(list, d.deleteAllowed, d.deleteBlocked)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Stmt(stmt).ExecContext(c, domain)
+	return err
+}
+
+// Contains determines whether the domain is on the list.
+func (d *Domains) Contains(c util.Context, tx *sql.Tx, list DomainList, domain string) (contains bool, err error) {
+	var stmt *sql.Stmt
+	if stmt, err = d.pick(list, d.containsAllowed, d.containsBlocked); err != nil {
+		return
+	}
+	var rows *sql.Rows
+	rows, err = tx.Stmt(stmt).QueryContext(c, domain)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = enforceOneRow(rows, "Domains.Contains", func(r SingleRow) error {
+		return r.Scan(&contains)
+	})
+	return
+}
+
+func (d *Domains) pick(list DomainList, allowed, blocked *sql.Stmt) (*sql.Stmt, error) {
+	switch list {
+	case AllowedDomains:
+		return allowed, nil
+	case BlockedDomains:
+		return blocked, nil
+	default:
+		return nil, fmt.Errorf("unknown domain list: %q", list)
+	}
+}
@@ -0,0 +1,117 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Emoji{}
+
+// Emoji is a Model that provides additional database methods for the custom
+// emoji defined on this server.
+type Emoji struct {
+	upsert *sql.Stmt
+	delete *sql.Stmt
+	get    *sql.Stmt
+	getAll *sql.Stmt
+}
+
+func (e *Emoji) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(e.upsert), s.UpsertEmoji},
+			{&(e.delete), s.DeleteEmoji},
+			{&(e.get), s.GetEmoji},
+			{&(e.getAll), s.GetAllEmoji},
+		})
+}
+
+func (e *Emoji) CreateTable(t *sql.Tx, s SqlDialect) error {
+	_, err := t.Exec(s.CreateEmojiTable())
+	return err
+}
+
+func (e *Emoji) Close() {
+	e.upsert.Close()
+	e.delete.Close()
+	e.get.Close()
+	e.getAll.Close()
+}
+
+// EmojiInfo is a custom emoji, which is displayed in place of its shortcode.
+type EmojiInfo struct {
+	Shortcode string
+	ImageIRI  URL
+	MediaType string
+	Updated   time.Time
+}
+
+// Upsert defines the custom emoji, replacing the image of an existing one with
+// the same shortcode.
+func (e *Emoji) Upsert(c util.Context, tx *sql.Tx, shortcode string, image *url.URL, mediaType string) error {
+	_, err := tx.Stmt(e.upsert).ExecContext(c,
+		shortcode,
+		image.String(),
+		mediaType)
+	return err
+}
+
+// Delete removes the custom emoji. It is not an error if it does not exist.
+func (e *Emoji) Delete(c util.Context, tx *sql.Tx, shortcode string) error {
+	_, err := tx.Stmt(e.delete).ExecContext(c, shortcode)
+	return err
+}
+
+// Get fetches the custom emoji, if it exists.
+func (e *Emoji) Get(c util.Context, tx *sql.Tx, shortcode string) (ei EmojiInfo, found bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(e.get).QueryContext(c, shortcode)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Emoji.Get", func(r SingleRow) error {
+		found = true
+		ei.Shortcode = shortcode
+		return r.Scan(&(ei.ImageIRI), &(ei.MediaType), &(ei.Updated))
+	})
+	return
+}
+
+// GetAll fetches every custom emoji, ordered by shortcode.
+func (e *Emoji) GetAll(c util.Context, tx *sql.Tx) (ei []EmojiInfo, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(e.getAll).QueryContext(c)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Emoji.GetAll", func(r SingleRow) error {
+		var e EmojiInfo
+		if err := r.Scan(&(e.Shortcode), &(e.ImageIRI), &(e.MediaType), &(e.Updated)); err != nil {
+			return err
+		}
+		ei = append(ei, e)
+		return nil
+	})
+	return
+}
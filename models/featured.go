@@ -0,0 +1,151 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Featured{}
+
+// Featured is a Model that provides additional database methods for the
+// collection of objects, such as posts, a user has pinned to their profile.
+type Featured struct {
+	insert      *sql.Stmt
+	contains    *sql.Stmt
+	get         *sql.Stmt
+	getLastPage *sql.Stmt
+	prependItem *sql.Stmt
+	deleteItem  *sql.Stmt
+	count       *sql.Stmt
+}
+
+func (i *Featured) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(i.insert), s.InsertFeatured},
+			{&(i.contains), s.FeaturedContains},
+			{&(i.get), s.GetFeatured},
+			{&(i.getLastPage), s.GetFeaturedLastPage},
+			{&(i.prependItem), s.PrependFeaturedItem},
+			{&(i.deleteItem), s.DeleteFeaturedItem},
+			{&(i.count), s.CountFeatured},
+		})
+}
+
+func (i *Featured) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateFeaturedTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexIDFeaturedTable())
+	return err
+}
+
+func (i *Featured) Close() {
+	i.insert.Close()
+	i.contains.Close()
+	i.get.Close()
+	i.getLastPage.Close()
+	i.prependItem.Close()
+	i.deleteItem.Close()
+	i.count.Close()
+}
+
+// Create a new featured entry for the given actor.
+func (i *Featured) Create(c util.Context, tx *sql.Tx, actor *url.URL, featured ActivityStreamsCollection) error {
+	r, err := tx.Stmt(i.insert).ExecContext(c,
+		actor.String(),
+		featured)
+	return mustChangeOneRow(r, err, "Featured.Create")
+}
+
+// Contains returns true if the item is in the featured collection.
+func (i *Featured) Contains(c util.Context, tx *sql.Tx, featured, item *url.URL) (b bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.contains).QueryContext(c, featured.String(), item.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, enforceOneRow(rows, "Featured.Contains", func(r SingleRow) error {
+		return r.Scan(&b)
+	})
+}
+
+// GetPage returns a CollectionPage of the Featured.
+//
+// The range of elements retrieved are [min, max).
+func (i *Featured) GetPage(c util.Context, tx *sql.Tx, featured *url.URL, min, max int) (page ActivityStreamsCollectionPage, isEnd bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.get).QueryContext(c, featured.String(), min, max-1)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, isEnd, enforceOneRow(rows, "Featured.GetPage", func(r SingleRow) error {
+		return r.Scan(&page, &isEnd)
+	})
+}
+
+// GetLastPage returns the last CollectionPage of the Featured collection.
+func (i *Featured) GetLastPage(c util.Context, tx *sql.Tx, featured *url.URL, n int) (page ActivityStreamsCollectionPage, startIdx int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getLastPage).QueryContext(c, featured.String(), n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, startIdx, enforceOneRow(rows, "Featured.GetLastPage", func(r SingleRow) error {
+		return r.Scan(&page, &startIdx)
+	})
+}
+
+// PrependItem prepends the item to the featured collection's items list, unless
+// the collection already contains the item or has max items. It returns
+// whether the item was prepended.
+func (i *Featured) PrependItem(c util.Context, tx *sql.Tx, featured, item *url.URL, max int) (prepended bool, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(i.prependItem).ExecContext(c, featured.String(), item.String(), max)
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = r.RowsAffected()
+	return n == 1, err
+}
+
+// DeleteItem removes the item from the featured collection's items list.
+func (i *Featured) DeleteItem(c util.Context, tx *sql.Tx, featured, item *url.URL) error {
+	r, err := tx.Stmt(i.deleteItem).ExecContext(c, featured.String(), item.String())
+	return mustChangeOneRow(r, err, "Featured.DeleteItem")
+}
+
+// Count returns the number of items in the featured collection.
+func (i *Featured) Count(c util.Context, tx *sql.Tx, featured *url.URL) (n int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.count).QueryContext(c, featured.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return n, enforceOneRow(rows, "Featured.Count", func(r SingleRow) error {
+		return r.Scan(&n)
+	})
+}
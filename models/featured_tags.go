@@ -0,0 +1,162 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &FeaturedTags{}
+
+// FeaturedTags is a Model that provides additional database methods for the
+// collection of tags a user has pinned to their profile.
+type FeaturedTags struct {
+	insert      *sql.Stmt
+	exists      *sql.Stmt
+	contains    *sql.Stmt
+	get         *sql.Stmt
+	getLastPage *sql.Stmt
+	prependItem *sql.Stmt
+	deleteItem  *sql.Stmt
+	count       *sql.Stmt
+}
+
+func (i *FeaturedTags) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(i.insert), s.InsertFeaturedTags},
+			{&(i.exists), s.FeaturedTagsExists},
+			{&(i.contains), s.FeaturedTagsContains},
+			{&(i.get), s.GetFeaturedTags},
+			{&(i.getLastPage), s.GetFeaturedTagsLastPage},
+			{&(i.prependItem), s.PrependFeaturedTagsItem},
+			{&(i.deleteItem), s.DeleteFeaturedTagsItem},
+			{&(i.count), s.CountFeaturedTags},
+		})
+}
+
+func (i *FeaturedTags) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateFeaturedTagsTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexIDFeaturedTagsTable())
+	return err
+}
+
+func (i *FeaturedTags) Close() {
+	i.insert.Close()
+	i.exists.Close()
+	i.contains.Close()
+	i.get.Close()
+	i.getLastPage.Close()
+	i.prependItem.Close()
+	i.deleteItem.Close()
+	i.count.Close()
+}
+
+// Create a new featured tags entry for the given actor.
+func (i *FeaturedTags) Create(c util.Context, tx *sql.Tx, actor *url.URL, featured ActivityStreamsCollection) error {
+	r, err := tx.Stmt(i.insert).ExecContext(c,
+		actor.String(),
+		featured)
+	return mustChangeOneRow(r, err, "FeaturedTags.Create")
+}
+
+// Exists returns true if the featured tags collection exists.
+func (i *FeaturedTags) Exists(c util.Context, tx *sql.Tx, featured *url.URL) (b bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.exists).QueryContext(c, featured.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, enforceOneRow(rows, "FeaturedTags.Exists", func(r SingleRow) error {
+		return r.Scan(&b)
+	})
+}
+
+// Contains returns true if a Hashtag with the href is in the featured tags
+// collection.
+func (i *FeaturedTags) Contains(c util.Context, tx *sql.Tx, featured, href *url.URL) (b bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.contains).QueryContext(c, featured.String(), href.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, enforceOneRow(rows, "FeaturedTags.Contains", func(r SingleRow) error {
+		return r.Scan(&b)
+	})
+}
+
+// GetPage returns a CollectionPage of the FeaturedTags.
+//
+// The range of elements retrieved are [min, max).
+func (i *FeaturedTags) GetPage(c util.Context, tx *sql.Tx, featured *url.URL, min, max int) (page ActivityStreamsCollectionPage, isEnd bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.get).QueryContext(c, featured.String(), min, max-1)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, isEnd, enforceOneRow(rows, "FeaturedTags.GetPage", func(r SingleRow) error {
+		return r.Scan(&page, &isEnd)
+	})
+}
+
+// GetLastPage returns the last CollectionPage of the FeaturedTags collection.
+func (i *FeaturedTags) GetLastPage(c util.Context, tx *sql.Tx, featured *url.URL, n int) (page ActivityStreamsCollectionPage, startIdx int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getLastPage).QueryContext(c, featured.String(), n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, startIdx, enforceOneRow(rows, "FeaturedTags.GetLastPage", func(r SingleRow) error {
+		return r.Scan(&page, &startIdx)
+	})
+}
+
+// PrependItem prepends a Hashtag with the href and name to the featured tags'
+// items list.
+func (i *FeaturedTags) PrependItem(c util.Context, tx *sql.Tx, featured, href *url.URL, name string) error {
+	r, err := tx.Stmt(i.prependItem).ExecContext(c, featured.String(), href.String(), name)
+	return mustChangeOneRow(r, err, "FeaturedTags.PrependItem")
+}
+
+// DeleteItem removes the Hashtag with the href from the featured tags' items
+// list.
+func (i *FeaturedTags) DeleteItem(c util.Context, tx *sql.Tx, featured, href *url.URL) error {
+	r, err := tx.Stmt(i.deleteItem).ExecContext(c, featured.String(), href.String())
+	return mustChangeOneRow(r, err, "FeaturedTags.DeleteItem")
+}
+
+// Count returns the number of items in the featured tags collection.
+func (i *FeaturedTags) Count(c util.Context, tx *sql.Tx, featured *url.URL) (n int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.count).QueryContext(c, featured.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return n, enforceOneRow(rows, "FeaturedTags.Count", func(r SingleRow) error {
+		return r.Scan(&n)
+	})
+}
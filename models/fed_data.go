@@ -19,6 +19,7 @@ package models
 import (
 	"database/sql"
 	"net/url"
+	"time"
 
 	"github.com/go-fed/apcore/util"
 )
@@ -33,16 +34,22 @@ type FedData struct {
 	fedCreate *sql.Stmt
 	fedUpdate *sql.Stmt
 	fedDelete *sql.Stmt
+	fedGC     *sql.Stmt
+	tombstone *sql.Stmt
+	timeline  *sql.Stmt
 }
 
 func (f *FedData) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(f.exists), s.FedExists()},
-			{&(f.get), s.FedGet()},
-			{&(f.fedCreate), s.FedCreate()},
-			{&(f.fedUpdate), s.FedUpdate()},
-			{&(f.fedDelete), s.FedDelete()},
+			{&(f.exists), s.FedExists},
+			{&(f.get), s.FedGet},
+			{&(f.fedCreate), s.FedCreate},
+			{&(f.fedUpdate), s.FedUpdate},
+			{&(f.fedDelete), s.FedDelete},
+			{&(f.fedGC), s.FedDeleteIfUnreferenced},
+			{&(f.tombstone), s.FedTombstone},
+			{&(f.timeline), s.FedPublicTimeline},
 		})
 }
 
@@ -50,7 +57,19 @@ func (f *FedData) CreateTable(t *sql.Tx, s SqlDialect) error {
 	if _, err := t.Exec(s.CreateFedDataTable()); err != nil {
 		return err
 	}
-	_, err := t.Exec(s.CreateIndexIDFedDataTable())
+	if _, err := t.Exec(s.CreateIndexIDFedDataTable()); err != nil {
+		return err
+	}
+	if _, err := t.Exec(s.CreateIndexInboxFedDataTable()); err != nil {
+		return err
+	}
+	if _, err := t.Exec(s.CreateIndexCreateTimeFedDataTable()); err != nil {
+		return err
+	}
+	if _, err := t.Exec(s.CreateIndexToFedDataTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexCcFedDataTable())
 	return err
 }
 
@@ -60,6 +79,9 @@ func (f *FedData) Close() {
 	f.fedCreate.Close()
 	f.fedUpdate.Close()
 	f.fedDelete.Close()
+	f.fedGC.Close()
+	f.tombstone.Close()
+	f.timeline.Close()
 }
 
 // Exists determines if the ID is stored in the federated table.
@@ -109,3 +131,62 @@ func (f *FedData) Delete(c util.Context, tx *sql.Tx, fedIDIRI *url.URL) error {
 	r, err := tx.Stmt(f.fedDelete).ExecContext(c, fedIDIRI.String())
 	return mustChangeOneRow(r, err, "FedData.Delete")
 }
+
+// DeleteIfUnreferenced removes the federated data with the specified IRI, but
+// only if no inbox, outbox, or other collection still contains it.
+func (f *FedData) DeleteIfUnreferenced(c util.Context, tx *sql.Tx, fedIDIRI *url.URL) (deleted bool, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(f.fedGC).ExecContext(c, fedIDIRI.String())
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = r.RowsAffected()
+	deleted = n > 0
+	return
+}
+
+// Tombstone replaces the federated data with the specified IRI with a
+// Tombstone, keeping its id, published, and updated properties and recording
+// its former type. It is not an error if the data is not stored.
+func (f *FedData) Tombstone(c util.Context, tx *sql.Tx, fedIDIRI *url.URL, deleted time.Time) (tombstoned bool, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(f.tombstone).ExecContext(c, fedIDIRI.String(), deleted.UTC().Format(time.RFC3339))
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = r.RowsAffected()
+	tombstoned = n > 0
+	return
+}
+
+// PublicTimeline fetches at most n of the public data, both federated and
+// local, newest first. Only data older than the data with the maxID is fetched,
+// unless maxID is nil, and only data of one of the types, unless no types are
+// given.
+func (f *FedData) PublicTimeline(c util.Context, tx *sql.Tx, types []string, maxID *url.URL, n int) (as []ActivityStreams, err error) {
+	var tb []byte
+	tb, err = marshalTypes(types)
+	if err != nil {
+		return
+	}
+	var max sql.NullString
+	if maxID != nil {
+		max = sql.NullString{String: maxID.String(), Valid: true}
+	}
+	var rows *sql.Rows
+	rows, err = tx.Stmt(f.timeline).QueryContext(c, tb, max, n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return as, doForRows(rows, "FedData.PublicTimeline", func(r SingleRow) error {
+		var a ActivityStreams
+		if err := r.Scan(&a); err != nil {
+			return err
+		}
+		as = append(as, a)
+		return nil
+	})
+}
@@ -35,21 +35,25 @@ type Followers struct {
 	prependItem           *sql.Stmt
 	deleteItem            *sql.Stmt
 	getAllForActor        *sql.Stmt
+	count                 *sql.Stmt
 	getOpenFollowRequests *sql.Stmt
+	getFollowFrom         *sql.Stmt
 }
 
 func (i *Followers) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(i.insert), s.InsertFollowers()},
-			{&(i.containsForActor), s.FollowersContainsForActor()},
-			{&(i.contains), s.FollowersContains()},
-			{&(i.get), s.GetFollowers()},
-			{&(i.getLastPage), s.GetFollowersLastPage()},
-			{&(i.prependItem), s.PrependFollowersItem()},
-			{&(i.deleteItem), s.DeleteFollowersItem()},
-			{&(i.getAllForActor), s.GetAllFollowersForActor()},
-			{&(i.getOpenFollowRequests), s.GetOpenFollowRequests()},
+			{&(i.insert), s.InsertFollowers},
+			{&(i.containsForActor), s.FollowersContainsForActor},
+			{&(i.contains), s.FollowersContains},
+			{&(i.get), s.GetFollowers},
+			{&(i.getLastPage), s.GetFollowersLastPage},
+			{&(i.prependItem), s.PrependFollowersItem},
+			{&(i.deleteItem), s.DeleteFollowersItem},
+			{&(i.getAllForActor), s.GetAllFollowersForActor},
+			{&(i.count), s.CountFollowers},
+			{&(i.getOpenFollowRequests), s.GetOpenFollowRequests},
+			{&(i.getFollowFrom), s.GetFollowReceivedFrom},
 		})
 }
 
@@ -70,6 +74,8 @@ func (i *Followers) Close() {
 	i.prependItem.Close()
 	i.deleteItem.Close()
 	i.getAllForActor.Close()
+	i.count.Close()
+	i.getFollowFrom.Close()
 }
 
 // Create a new followers for the given actor.
@@ -174,3 +180,32 @@ func (i *Followers) OpenFollowRequests(c util.Context, tx *sql.Tx, actorIRI *url
 		return err
 	})
 }
+
+// FollowReceivedFrom fetches the most recent Follow of the actor that was
+// received from the follower, if any.
+func (i *Followers) FollowReceivedFrom(c util.Context, tx *sql.Tx, actorIRI, follower *url.URL) (f ActivityStreamsFollow, found bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getFollowFrom).QueryContext(c, actorIRI.String(), follower.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Followers.FollowReceivedFrom", func(r SingleRow) error {
+		found = true
+		return r.Scan(&f)
+	})
+	return
+}
+
+// Count returns the number of items in the followers collection.
+func (i *Followers) Count(c util.Context, tx *sql.Tx, followers *url.URL) (n int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.count).QueryContext(c, followers.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return n, enforceOneRow(rows, "Followers.Count", func(r SingleRow) error {
+		return r.Scan(&n)
+	})
+}
@@ -35,19 +35,25 @@ type Following struct {
 	prependItem      *sql.Stmt
 	deleteItem       *sql.Stmt
 	getAllForActor   *sql.Stmt
+	count            *sql.Stmt
+	getPending       *sql.Stmt
+	getActors        *sql.Stmt
 }
 
 func (i *Following) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(i.insert), s.InsertFollowing()},
-			{&(i.containsForActor), s.FollowingContainsForActor()},
-			{&(i.contains), s.FollowingContains()},
-			{&(i.get), s.GetFollowing()},
-			{&(i.getLastPage), s.GetFollowingLastPage()},
-			{&(i.prependItem), s.PrependFollowingItem()},
-			{&(i.deleteItem), s.DeleteFollowingItem()},
-			{&(i.getAllForActor), s.GetAllFollowingForActor()},
+			{&(i.insert), s.InsertFollowing},
+			{&(i.containsForActor), s.FollowingContainsForActor},
+			{&(i.contains), s.FollowingContains},
+			{&(i.get), s.GetFollowing},
+			{&(i.getLastPage), s.GetFollowingLastPage},
+			{&(i.prependItem), s.PrependFollowingItem},
+			{&(i.deleteItem), s.DeleteFollowingItem},
+			{&(i.getAllForActor), s.GetAllFollowingForActor},
+			{&(i.count), s.CountFollowing},
+			{&(i.getPending), s.GetPendingFollows},
+			{&(i.getActors), s.GetActorsFollowing},
 		})
 }
 
@@ -68,6 +74,9 @@ func (i *Following) Close() {
 	i.prependItem.Close()
 	i.deleteItem.Close()
 	i.getAllForActor.Close()
+	i.count.Close()
+	i.getPending.Close()
+	i.getActors.Close()
 }
 
 // Create a new following entry for the given actor.
@@ -156,3 +165,58 @@ func (i *Following) GetAllForActor(c util.Context, tx *sql.Tx, following *url.UR
 		return r.Scan(&col)
 	})
 }
+
+// Count returns the number of items in the following collection.
+func (i *Following) Count(c util.Context, tx *sql.Tx, following *url.URL) (n int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.count).QueryContext(c, following.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return n, enforceOneRow(rows, "Following.Count", func(r SingleRow) error {
+		return r.Scan(&n)
+	})
+}
+
+// PendingFollows returns the Follows sent by the actor that have been neither
+// Accepted nor Rejected by the followed peer, nor Undone by the actor. An
+// Accept or Reject by any other actor leaves the Follow pending.
+func (i *Following) PendingFollows(c util.Context, tx *sql.Tx, actorIRI *url.URL) (f []ActivityStreamsFollow, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getPending).QueryContext(c, actorIRI.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return f, doForRows(rows, "Following.PendingFollows", func(r SingleRow) error {
+		var follow ActivityStreamsFollow
+		if err := r.Scan(&follow); err == nil {
+			f = append(f, follow)
+		}
+		return err
+	})
+}
+
+// ActorsFollowing returns the actors whose following collection contains the
+// item.
+func (i *Following) ActorsFollowing(c util.Context, tx *sql.Tx, item *url.URL) (actors []*url.URL, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getActors).QueryContext(c, item.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return actors, doForRows(rows, "Following.ActorsFollowing", func(r SingleRow) error {
+		var id string
+		if err := r.Scan(&id); err != nil {
+			return err
+		}
+		u, err := url.Parse(id)
+		if err != nil {
+			return err
+		}
+		actors = append(actors, u)
+		return nil
+	})
+}
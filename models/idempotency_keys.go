@@ -0,0 +1,118 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &IdempotencyKeys{}
+
+// IdempotencyKeys is a Model that remembers the activity created in an outbox
+// for a client-supplied idempotency key, so retried requests are not applied
+// twice.
+type IdempotencyKeys struct {
+	reserve     *sql.Stmt
+	setActivity *sql.Stmt
+	release     *sql.Stmt
+	get         *sql.Stmt
+}
+
+func (i *IdempotencyKeys) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(i.reserve), s.InsertIdempotencyKey},
+			{&(i.setActivity), s.SetIdempotencyKeyActivity},
+			{&(i.release), s.DeleteIdempotencyKey},
+			{&(i.get), s.GetIdempotencyKeyActivity},
+		})
+}
+
+func (i *IdempotencyKeys) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateIdempotencyKeysTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.DropIdempotencyKeysActivityIDNotNull())
+	return err
+}
+
+func (i *IdempotencyKeys) Close() {
+	i.reserve.Close()
+	i.setActivity.Close()
+	i.release.Close()
+	i.get.Close()
+}
+
+// Reserve records that the key is being used on the outbox, reporting false if
+// it was already recorded. Recording and checking are a single statement, so
+// that concurrent requests with the same key reserve it only once.
+func (i *IdempotencyKeys) Reserve(c util.Context, tx *sql.Tx, outbox *url.URL, key string) (reserved bool, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(i.reserve).ExecContext(c,
+		outbox.String(),
+		key)
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = r.RowsAffected()
+	reserved = n > 0
+	return
+}
+
+// SetActivity records the activity that resulted from the key reserved on the
+// outbox.
+func (i *IdempotencyKeys) SetActivity(c util.Context, tx *sql.Tx, outbox *url.URL, key string, activity *url.URL) error {
+	r, err := tx.Stmt(i.setActivity).ExecContext(c,
+		outbox.String(),
+		key,
+		activity.String())
+	return mustChangeOneRow(r, err, "IdempotencyKeys.SetActivity")
+}
+
+// Release forgets the reservation of a key that resulted in no activity, so
+// that it may be used again. It is not an error if it is not reserved.
+func (i *IdempotencyKeys) Release(c util.Context, tx *sql.Tx, outbox *url.URL, key string) error {
+	_, err := tx.Stmt(i.release).ExecContext(c,
+		outbox.String(),
+		key)
+	return err
+}
+
+// Get fetches the activity previously created for the key used on the outbox.
+// The key is found without an activity while it is reserved by a request that
+// has yet to create one.
+func (i *IdempotencyKeys) Get(c util.Context, tx *sql.Tx, outbox *url.URL, key string) (activity *url.URL, found bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.get).QueryContext(c, outbox.String(), key)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var id sql.NullString
+	err = doForRows(rows, "IdempotencyKeys.Get", func(r SingleRow) error {
+		found = true
+		return r.Scan(&id)
+	})
+	if err == nil && id.Valid {
+		activity, err = url.Parse(id.String)
+	}
+	return
+}
@@ -0,0 +1,95 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &InboxProcessed{}
+
+// InboxProcessed is a Model that remembers the activities already received by
+// an inbox, so that redelivered activities are not processed twice.
+type InboxProcessed struct {
+	reserve *sql.Stmt
+	release *sql.Stmt
+	prune   *sql.Stmt
+}
+
+func (i *InboxProcessed) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(i.reserve), s.InsertInboxProcessed},
+			{&(i.release), s.DeleteInboxProcessed},
+			{&(i.prune), s.PruneInboxProcessed},
+		})
+}
+
+func (i *InboxProcessed) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateInboxProcessedTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexCreateTimeInboxProcessedTable())
+	return err
+}
+
+func (i *InboxProcessed) Close() {
+	i.reserve.Close()
+	i.release.Close()
+	i.prune.Close()
+}
+
+// Reserve records that the inbox is processing the activity, reporting false
+// if it was already recorded. Recording and checking are a single statement, so
+// that concurrent deliveries of the same activity reserve it only once.
+func (i *InboxProcessed) Reserve(c util.Context, tx *sql.Tx, inbox, activity *url.URL) (reserved bool, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(i.reserve).ExecContext(c,
+		inbox.String(),
+		activity.String())
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = r.RowsAffected()
+	reserved = n > 0
+	return
+}
+
+// Release forgets that the inbox processed the activity, so that it is
+// processed again when redelivered. It is not an error if it is not recorded.
+func (i *InboxProcessed) Release(c util.Context, tx *sql.Tx, inbox, activity *url.URL) error {
+	_, err := tx.Stmt(i.release).ExecContext(c,
+		inbox.String(),
+		activity.String())
+	return err
+}
+
+// Prune forgets the activities processed before the given time, returning how
+// many were forgotten.
+func (i *InboxProcessed) Prune(c util.Context, tx *sql.Tx, before time.Time) (n int64, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(i.prune).ExecContext(c, before)
+	if err != nil {
+		return
+	}
+	return r.RowsAffected()
+}
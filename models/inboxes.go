@@ -41,15 +41,15 @@ type Inboxes struct {
 func (i *Inboxes) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(i.insertInbox), s.InsertInbox()},
-			{&(i.inboxContainsForActor), s.InboxContainsForActor()},
-			{&(i.inboxContains), s.InboxContains()},
-			{&(i.getInbox), s.GetInbox()},
-			{&(i.getPublicInbox), s.GetPublicInbox()},
-			{&(i.getLastPage), s.GetInboxLastPage()},
-			{&(i.getPublicLastPage), s.GetPublicInboxLastPage()},
-			{&(i.prependInboxItem), s.PrependInboxItem()},
-			{&(i.deleteInboxItem), s.DeleteInboxItem()},
+			{&(i.insertInbox), s.InsertInbox},
+			{&(i.inboxContainsForActor), s.InboxContainsForActor},
+			{&(i.inboxContains), s.InboxContains},
+			{&(i.getInbox), s.GetInbox},
+			{&(i.getPublicInbox), s.GetPublicInbox},
+			{&(i.getLastPage), s.GetInboxLastPage},
+			{&(i.getPublicLastPage), s.GetPublicInboxLastPage},
+			{&(i.prependInboxItem), s.PrependInboxItem},
+			{&(i.deleteInboxItem), s.DeleteInboxItem},
 		})
 }
 
@@ -0,0 +1,124 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Invites{}
+
+// Invites is a Model that provides additional database methods for the invite
+// codes that permit registering while registrations are closed.
+type Invites struct {
+	insert  *sql.Stmt
+	consume *sql.Stmt
+	release *sql.Stmt
+	getAll  *sql.Stmt
+}
+
+func (i *Invites) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(i.insert), s.InsertInvite},
+			{&(i.consume), s.ConsumeInvite},
+			{&(i.release), s.ReleaseInvite},
+			{&(i.getAll), s.GetAllInvites},
+		})
+}
+
+func (i *Invites) CreateTable(t *sql.Tx, s SqlDialect) error {
+	_, err := t.Exec(s.CreateInvitesTable())
+	return err
+}
+
+func (i *Invites) Close() {
+	i.insert.Close()
+	i.consume.Close()
+	i.release.Close()
+	i.getAll.Close()
+}
+
+// Invite is an invite code, which may be used to register up to a maximum
+// number of times until it expires.
+type Invite struct {
+	Code      string
+	CreatedBy string
+	Created   time.Time
+	MaxUses   int
+	Remaining int
+	// Expires is nil if the invite never expires.
+	Expires *time.Time
+}
+
+// Create adds an invite code made by the user. A nil expiry never expires.
+func (i *Invites) Create(c util.Context, tx *sql.Tx, code, createdBy string, maxUses int, expires *time.Time) error {
+	r, err := tx.Stmt(i.insert).ExecContext(c,
+		code,
+		createdBy,
+		maxUses,
+		expires)
+	return mustChangeOneRow(r, err, "Invites.Create")
+}
+
+// Consume uses up one of the remaining uses of the invite code, returning false
+// if it does not exist, has expired, or has no uses remaining.
+func (i *Invites) Consume(c util.Context, tx *sql.Tx, code string) (ok bool, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(i.consume).ExecContext(c, code)
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = r.RowsAffected()
+	ok = n == 1
+	return
+}
+
+// Release returns a use of the invite code that was consumed, such as when the
+// registration it was consumed for failed.
+func (i *Invites) Release(c util.Context, tx *sql.Tx, code string) error {
+	_, err := tx.Stmt(i.release).ExecContext(c, code)
+	return err
+}
+
+// GetAll fetches every invite code, most recently created first.
+func (i *Invites) GetAll(c util.Context, tx *sql.Tx) (iv []Invite, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getAll).QueryContext(c)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Invites.GetAll", func(r SingleRow) error {
+		var v Invite
+		if err := r.Scan(&(v.Code),
+			&(v.CreatedBy),
+			&(v.Created),
+			&(v.MaxUses),
+			&(v.Remaining),
+			&(v.Expires)); err != nil {
+			return err
+		}
+		iv = append(iv, v)
+		return nil
+	})
+	return
+}
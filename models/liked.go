@@ -35,19 +35,21 @@ type Liked struct {
 	prependItem      *sql.Stmt
 	deleteItem       *sql.Stmt
 	getAllForActor   *sql.Stmt
+	count            *sql.Stmt
 }
 
 func (i *Liked) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(i.insert), s.InsertLiked()},
-			{&(i.containsForActor), s.LikedContainsForActor()},
-			{&(i.contains), s.LikedContains()},
-			{&(i.get), s.GetLiked()},
-			{&(i.getLastPage), s.GetLikedLastPage()},
-			{&(i.prependItem), s.PrependLikedItem()},
-			{&(i.deleteItem), s.DeleteLikedItem()},
-			{&(i.getAllForActor), s.GetAllLikedForActor()},
+			{&(i.insert), s.InsertLiked},
+			{&(i.containsForActor), s.LikedContainsForActor},
+			{&(i.contains), s.LikedContains},
+			{&(i.get), s.GetLiked},
+			{&(i.getLastPage), s.GetLikedLastPage},
+			{&(i.prependItem), s.PrependLikedItem},
+			{&(i.deleteItem), s.DeleteLikedItem},
+			{&(i.getAllForActor), s.GetAllLikedForActor},
+			{&(i.count), s.CountLiked},
 		})
 }
 
@@ -68,6 +70,7 @@ func (i *Liked) Close() {
 	i.prependItem.Close()
 	i.deleteItem.Close()
 	i.getAllForActor.Close()
+	i.count.Close()
 }
 
 // Create a new liked entry for the given actor.
@@ -156,3 +159,16 @@ func (i *Liked) GetAllForActor(c util.Context, tx *sql.Tx, liked *url.URL) (col
 		return r.Scan(&col)
 	})
 }
+
+// Count returns the number of items in the liked collection.
+func (i *Liked) Count(c util.Context, tx *sql.Tx, liked *url.URL) (n int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.count).QueryContext(c, liked.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return n, enforceOneRow(rows, "Liked.Count", func(r SingleRow) error {
+		return r.Scan(&n)
+	})
+}
@@ -18,7 +18,9 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/url"
+	"time"
 
 	"github.com/go-fed/apcore/util"
 )
@@ -30,21 +32,31 @@ var _ Model = &LocalData{}
 type LocalData struct {
 	exists      *sql.Stmt
 	get         *sql.Stmt
+	createTime  *sql.Stmt
 	localCreate *sql.Stmt
 	localUpdate *sql.Stmt
 	localDelete *sql.Stmt
+	tombstone   *sql.Stmt
+	archive     *sql.Stmt
 	stats       *sql.Stmt
+	timeline    *sql.Stmt
+	actorTimes  *sql.Stmt
 }
 
 func (f *LocalData) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(f.exists), s.LocalExists()},
-			{&(f.get), s.LocalGet()},
-			{&(f.localCreate), s.LocalCreate()},
-			{&(f.localUpdate), s.LocalUpdate()},
-			{&(f.localDelete), s.LocalDelete()},
-			{&(f.stats), s.LocalStats()},
+			{&(f.exists), s.LocalExists},
+			{&(f.get), s.LocalGet},
+			{&(f.createTime), s.LocalCreateTime},
+			{&(f.localCreate), s.LocalCreate},
+			{&(f.localUpdate), s.LocalUpdate},
+			{&(f.localDelete), s.LocalDelete},
+			{&(f.tombstone), s.LocalTombstone},
+			{&(f.archive), s.LocalArchive},
+			{&(f.stats), s.LocalStats},
+			{&(f.timeline), s.LocalPublicTimeline},
+			{&(f.actorTimes), s.LocalActorActivityTimes},
 		})
 }
 
@@ -52,17 +64,34 @@ func (f *LocalData) CreateTable(t *sql.Tx, s SqlDialect) error {
 	if _, err := t.Exec(s.CreateLocalDataTable()); err != nil {
 		return err
 	}
-	_, err := t.Exec(s.CreateIndexIDLocalDataTable())
+	if _, err := t.Exec(s.CreateLocalDataArchiveTable()); err != nil {
+		return err
+	}
+	if _, err := t.Exec(s.CreateIndexIDLocalDataTable()); err != nil {
+		return err
+	}
+	if _, err := t.Exec(s.CreateIndexCreateTimeLocalDataTable()); err != nil {
+		return err
+	}
+	if _, err := t.Exec(s.CreateIndexToLocalDataTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexCcLocalDataTable())
 	return err
 }
 
 func (f *LocalData) Close() {
 	f.exists.Close()
 	f.get.Close()
+	f.createTime.Close()
 	f.localCreate.Close()
 	f.localUpdate.Close()
 	f.localDelete.Close()
+	f.tombstone.Close()
+	f.archive.Close()
 	f.stats.Close()
+	f.timeline.Close()
+	f.actorTimes.Close()
 }
 
 // Exists determines if the ID is stored in the local table.
@@ -93,6 +122,20 @@ func (f *LocalData) Get(c util.Context, tx *sql.Tx, id *url.URL) (v ActivityStre
 	return
 }
 
+// CreateTime retrieves when the ID was created in the local table.
+func (f *LocalData) CreateTime(c util.Context, tx *sql.Tx, id *url.URL) (created time.Time, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(f.createTime).QueryContext(c, id.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = findOneRow(rows, "LocalData.CreateTime", func(r SingleRow) error {
+		return r.Scan(&created)
+	})
+	return
+}
+
 // Create inserts the local data into the table.
 func (f *LocalData) Create(c util.Context, tx *sql.Tx, v ActivityStreams) error {
 	v.SanitizeContentSummaryHTML()
@@ -113,6 +156,23 @@ func (f *LocalData) Delete(c util.Context, tx *sql.Tx, localIDIRI *url.URL) erro
 	return mustChangeOneRow(r, err, "LocalData.Delete")
 }
 
+// Tombstone replaces the local data with the specified IRI with a Tombstone,
+// keeping its id, published, and updated properties and recording its former
+// type. Replacing an existing Tombstone keeps its formerType and deleted
+// properties.
+func (f *LocalData) Tombstone(c util.Context, tx *sql.Tx, localIDIRI *url.URL, deleted time.Time) error {
+	r, err := tx.Stmt(f.tombstone).ExecContext(c, localIDIRI.String(), deleted.UTC().Format(time.RFC3339))
+	return mustChangeOneRow(r, err, "LocalData.Tombstone")
+}
+
+// Archive copies the local data with the specified IRI to the archive, where it
+// is kept after the local data is tombstoned. Tombstones and data already in
+// the archive are not copied.
+func (f *LocalData) Archive(c util.Context, tx *sql.Tx, localIDIRI *url.URL) error {
+	_, err := tx.Stmt(f.archive).ExecContext(c, localIDIRI.String())
+	return err
+}
+
 type LocalDataActivity struct {
 	NLocalPosts    int
 	NLocalComments int
@@ -129,3 +189,60 @@ func (f *LocalData) Stats(c util.Context, tx *sql.Tx) (la LocalDataActivity, err
 		return r.Scan(&(la.NLocalPosts), &(la.NLocalComments))
 	})
 }
+
+// PublicTimeline fetches at most n of the public local data, newest first.
+// Only data older than the data with the maxID is fetched, unless maxID is
+// nil, and only data of one of the types, unless no types are given.
+func (f *LocalData) PublicTimeline(c util.Context, tx *sql.Tx, types []string, maxID *url.URL, n int) (as []ActivityStreams, err error) {
+	var tb []byte
+	tb, err = marshalTypes(types)
+	if err != nil {
+		return
+	}
+	var max sql.NullString
+	if maxID != nil {
+		max = sql.NullString{String: maxID.String(), Valid: true}
+	}
+	var rows *sql.Rows
+	rows, err = tx.Stmt(f.timeline).QueryContext(c, tb, max, n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return as, doForRows(rows, "LocalData.PublicTimeline", func(r SingleRow) error {
+		var a ActivityStreams
+		if err := r.Scan(&a); err != nil {
+			return err
+		}
+		as = append(as, a)
+		return nil
+	})
+}
+
+// ActorActivityTimes fetches the creation times of at most n of the local
+// activities of the actor created after the given time, newest first.
+func (f *LocalData) ActorActivityTimes(c util.Context, tx *sql.Tx, actor *url.URL, since time.Time, n int) (t []time.Time, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(f.actorTimes).QueryContext(c, actor.String(), since, n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return t, doForRows(rows, "LocalData.ActorActivityTimes", func(r SingleRow) error {
+		var created time.Time
+		if err := r.Scan(&created); err != nil {
+			return err
+		}
+		t = append(t, created)
+		return nil
+	})
+}
+
+// marshalTypes serializes the type names as a JSON array, which is empty
+// rather than null when there are none.
+func marshalTypes(types []string) ([]byte, error) {
+	if types == nil {
+		types = []string{}
+	}
+	return json.Marshal(types)
+}
@@ -0,0 +1,131 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Media{}
+
+// Media is a Model that provides additional database methods for the metadata
+// of uploaded media. The media's contents are kept in separate storage.
+type Media struct {
+	insert          *sql.Stmt
+	get             *sql.Stmt
+	insertThumbnail *sql.Stmt
+	getThumbnail    *sql.Stmt
+}
+
+func (m *Media) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(m.insert), s.InsertMedia},
+			{&(m.get), s.GetMedia},
+			{&(m.insertThumbnail), s.InsertMediaThumbnail},
+			{&(m.getThumbnail), s.GetMediaThumbnail},
+		})
+}
+
+func (m *Media) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateMediaTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateMediaThumbnailsTable())
+	return err
+}
+
+func (m *Media) Close() {
+	m.insert.Close()
+	m.get.Close()
+	m.insertThumbnail.Close()
+	m.getThumbnail.Close()
+}
+
+// MediaInfo is the metadata of an uploaded media file.
+type MediaInfo struct {
+	ID          string
+	UserID      string
+	ContentType string
+	Size        int64
+	Path        string
+}
+
+// Create records the metadata of newly stored media.
+func (m *Media) Create(c util.Context, tx *sql.Tx, userID, contentType string, size int64, path string) (id string, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(m.insert).QueryContext(c,
+		userID,
+		contentType,
+		size,
+		path)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return id, enforceOneRow(rows, "Media.Create", func(r SingleRow) error {
+		return r.Scan(&id)
+	})
+}
+
+// Get fetches the metadata of the media, if it exists.
+func (m *Media) Get(c util.Context, tx *sql.Tx, id string) (mi MediaInfo, found bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(m.get).QueryContext(c, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Media.Get", func(r SingleRow) error {
+		found = true
+		mi.ID = id
+		return r.Scan(&(mi.UserID), &(mi.ContentType), &(mi.Size), &(mi.Path))
+	})
+	return
+}
+
+// CreateThumbnail records the metadata of a newly stored thumbnail of the
+// media, whose width and height are at most maxDim. If a thumbnail of that
+// size was already recorded, the existing one is kept.
+func (m *Media) CreateThumbnail(c util.Context, tx *sql.Tx, mediaID string, maxDim int, contentType string, size int64, path string) error {
+	_, err := tx.Stmt(m.insertThumbnail).ExecContext(c,
+		mediaID,
+		maxDim,
+		contentType,
+		size,
+		path)
+	return err
+}
+
+// GetThumbnail fetches the metadata of the thumbnail of the media of the given
+// size, if it exists.
+func (m *Media) GetThumbnail(c util.Context, tx *sql.Tx, mediaID string, maxDim int) (mi MediaInfo, found bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(m.getThumbnail).QueryContext(c, mediaID, maxDim)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Media.GetThumbnail", func(r SingleRow) error {
+		found = true
+		mi.ID = mediaID
+		return r.Scan(&(mi.ContentType), &(mi.Size), &(mi.Path))
+	})
+	return
+}
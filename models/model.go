@@ -18,6 +18,10 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
 )
 
 // Model handles managing a single database type.
@@ -27,34 +31,95 @@ type Model interface {
 	Close()
 }
 
-// stmtPair make a pair of **sql.Stmt and its associated SQL string.
+// stmtPair make a pair of **sql.Stmt and the SqlDialect method producing its
+// associated SQL string.
 //
-// The goal is to populate *stmt based on the associated sqlStr.
+// The goal is to populate *stmt based on the associated SQL string.
 type stmtPair struct {
-	stmt   **sql.Stmt
-	sqlStr string
+	stmt  **sql.Stmt
+	sqlFn func() string
+}
+
+// name is the name of the SqlDialect method producing the SQL string.
+func (s stmtPair) name() string {
+	n := runtime.FuncForPC(reflect.ValueOf(s.sqlFn).Pointer()).Name()
+	n = strings.TrimSuffix(n, "-fm")
+	if i := strings.LastIndex(n, "."); i >= 0 {
+		n = n[i+1:]
+	}
+	return n
 }
 
 // prepareStmtPair is a mapper that populates the stmtPair.stmt.
 func prepareStmtPair(db *sql.DB, s stmtPair) (err error) {
-	*s.stmt, err = db.Prepare(s.sqlStr)
+	*s.stmt, err = db.Prepare(s.sqlFn())
+	if err != nil {
+		err = &PrepareError{Statement: s.name(), Err: err}
+	}
 	return err
 }
 
 // stmtPairs are a list of stmtPair.
 type stmtPairs []stmtPair
 
-// prepareStmtPairs turns stmtPairs into a single error, with a side effect of
-// populating all stmt.
-func prepareStmtPairs(db *sql.DB, s stmtPairs) (err error) {
-	doIfNoErr := func(p stmtPair, fn func(*sql.DB, stmtPair) error) error {
-		if err == nil {
-			return fn(db, p)
+// prepareStmtPairs prepares all stmtPairs, with a side effect of populating
+// each stmt. The errors preparing any of them are returned together as
+// PrepareErrors.
+func prepareStmtPairs(db *sql.DB, s stmtPairs) error {
+	var errs PrepareErrors
+	for _, p := range s {
+		if err := prepareStmtPair(db, p); err != nil {
+			errs = append(errs, err.(*PrepareError))
 		}
-		return err
 	}
-	for _, p := range s {
-		err = doIfNoErr(p, prepareStmtPair)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// PrepareError is an error preparing the SQL statement returned by a
+// SqlDialect method.
+type PrepareError struct {
+	// Statement is the name of the SqlDialect method.
+	Statement string
+	Err       error
+}
+
+func (p *PrepareError) Error() string {
+	return fmt.Sprintf("error preparing statement %s: %s", p.Statement, p.Err)
+}
+
+func (p *PrepareError) Unwrap() error {
+	return p.Err
+}
+
+// PrepareErrors are the errors preparing the statements of one or more Models.
+type PrepareErrors []*PrepareError
+
+func (p PrepareErrors) Error() string {
+	s := make([]string, len(p))
+	for i, e := range p {
+		s[i] = e.Error()
+	}
+	return fmt.Sprintf("%d statement(s) failed to prepare: %s", len(p), strings.Join(s, "; "))
+}
+
+// PrepareAll prepares the statements of all the Models, returning the errors
+// preparing any of their statements together as PrepareErrors.
+func PrepareAll(db *sql.DB, d SqlDialect, ml []Model) error {
+	var errs PrepareErrors
+	for _, m := range ml {
+		if err := m.Prepare(db, d); err != nil {
+			pe, ok := err.(PrepareErrors)
+			if !ok {
+				return err
+			}
+			errs = append(errs, pe...)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
 	}
-	return
+	return nil
 }
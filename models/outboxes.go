@@ -18,7 +18,9 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/url"
+	"time"
 
 	"github.com/go-fed/apcore/util"
 )
@@ -32,26 +34,30 @@ type Outboxes struct {
 	outboxContains         *sql.Stmt
 	getOutbox              *sql.Stmt
 	getPublicOutbox        *sql.Stmt
+	getOutboxByType        *sql.Stmt
 	getLastPage            *sql.Stmt
 	getPublicLastPage      *sql.Stmt
 	prependOutboxItem      *sql.Stmt
 	deleteOutboxItem       *sql.Stmt
 	outboxForInbox         *sql.Stmt
+	expiredItems           *sql.Stmt
 }
 
 func (i *Outboxes) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(i.insertOutbox), s.InsertOutbox()},
-			{&(i.outboxContainsForActor), s.OutboxContainsForActor()},
-			{&(i.outboxContains), s.OutboxContains()},
-			{&(i.getOutbox), s.GetOutbox()},
-			{&(i.getPublicOutbox), s.GetPublicOutbox()},
-			{&(i.getLastPage), s.GetOutboxLastPage()},
-			{&(i.getPublicLastPage), s.GetPublicOutboxLastPage()},
-			{&(i.prependOutboxItem), s.PrependOutboxItem()},
-			{&(i.deleteOutboxItem), s.DeleteOutboxItem()},
-			{&(i.outboxForInbox), s.OutboxForInbox()},
+			{&(i.insertOutbox), s.InsertOutbox},
+			{&(i.outboxContainsForActor), s.OutboxContainsForActor},
+			{&(i.outboxContains), s.OutboxContains},
+			{&(i.getOutbox), s.GetOutbox},
+			{&(i.getPublicOutbox), s.GetPublicOutbox},
+			{&(i.getOutboxByType), s.GetOutboxByType},
+			{&(i.getLastPage), s.GetOutboxLastPage},
+			{&(i.getPublicLastPage), s.GetPublicOutboxLastPage},
+			{&(i.prependOutboxItem), s.PrependOutboxItem},
+			{&(i.deleteOutboxItem), s.DeleteOutboxItem},
+			{&(i.outboxForInbox), s.OutboxForInbox},
+			{&(i.expiredItems), s.ExpiredOutboxItems},
 		})
 }
 
@@ -59,7 +65,10 @@ func (i *Outboxes) CreateTable(t *sql.Tx, s SqlDialect) error {
 	if _, err := t.Exec(s.CreateOutboxesTable()); err != nil {
 		return err
 	}
-	_, err := t.Exec(s.CreateIndexIDOutboxesTable())
+	if _, err := t.Exec(s.CreateIndexIDOutboxesTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexItemsOutboxesTable())
 	return err
 }
 
@@ -69,11 +78,13 @@ func (i *Outboxes) Close() {
 	i.outboxContains.Close()
 	i.getOutbox.Close()
 	i.getPublicOutbox.Close()
+	i.getOutboxByType.Close()
 	i.getLastPage.Close()
 	i.getPublicLastPage.Close()
 	i.prependOutboxItem.Close()
 	i.deleteOutboxItem.Close()
 	i.outboxForInbox.Close()
+	i.expiredItems.Close()
 }
 
 // Create a new outbox for the given actor.
@@ -141,6 +152,27 @@ func (i *Outboxes) GetPublicPage(c util.Context, tx *sql.Tx, outbox *url.URL, mi
 	})
 }
 
+// GetPageByType returns an OrderedCollectionPage of outbox items that are of
+// one of the given types only.
+//
+// The range of elements retrieved are [min, max).
+func (i *Outboxes) GetPageByType(c util.Context, tx *sql.Tx, outbox *url.URL, types []string, min, max int) (page ActivityStreamsOrderedCollectionPage, isEnd bool, err error) {
+	var tb []byte
+	tb, err = json.Marshal(types)
+	if err != nil {
+		return
+	}
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getOutboxByType).QueryContext(c, outbox.String(), min, max-1, tb)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, isEnd, enforceOneRow(rows, "Outboxes.GetPageByType", func(r SingleRow) error {
+		return r.Scan(&page, &isEnd)
+	})
+}
+
 // GetLastPage returns the last OrderedCollectionPage of the Outbox.
 func (i *Outboxes) GetLastPage(c util.Context, tx *sql.Tx, outbox *url.URL, n int) (page ActivityStreamsOrderedCollectionPage, startIdx int, err error) {
 	var rows *sql.Rows
@@ -180,7 +212,8 @@ func (i *Outboxes) DeleteOutboxItem(c util.Context, tx *sql.Tx, outbox, item *ur
 	return mustChangeOneRow(r, err, "Outboxes.DeleteOutboxItem")
 }
 
-// OutboxForInbox returns the outbox for the inbox.
+// OutboxForInbox returns the outbox for the inbox, or ErrNotFound if there is
+// none.
 func (i *Outboxes) OutboxForInbox(c util.Context, tx *sql.Tx, inbox *url.URL) (outbox URL, err error) {
 	var rows *sql.Rows
 	rows, err = tx.Stmt(i.outboxForInbox).QueryContext(c, inbox.String())
@@ -188,7 +221,45 @@ func (i *Outboxes) OutboxForInbox(c util.Context, tx *sql.Tx, inbox *url.URL) (o
 		return
 	}
 	defer rows.Close()
-	return outbox, enforceOneRow(rows, "Outboxes.OutboxForInbox", func(r SingleRow) error {
+	return outbox, findOneRow(rows, "Outboxes.OutboxForInbox", func(r SingleRow) error {
 		return r.Scan(&outbox)
 	})
 }
+
+// ExpiredOutboxItem is an item of an outbox whose local data was created before
+// a point in time. When the item is a Create, Object is the local object it
+// created, unless that object is already a Tombstone.
+type ExpiredOutboxItem struct {
+	Outbox  URL
+	Actor   URL
+	Item    URL
+	Object  *url.URL
+	Created time.Time
+}
+
+// ExpiredItems fetches at most n of the outbox items whose local data was
+// created before the given time, oldest first.
+func (i *Outboxes) ExpiredItems(c util.Context, tx *sql.Tx, before time.Time, n int) (items []ExpiredOutboxItem, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.expiredItems).QueryContext(c, before, n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return items, doForRows(rows, "Outboxes.ExpiredItems", func(r SingleRow) error {
+		var e ExpiredOutboxItem
+		var object sql.NullString
+		if err := r.Scan(&(e.Outbox), &(e.Actor), &(e.Item), &object, &(e.Created)); err != nil {
+			return err
+		}
+		if object.Valid {
+			u, err := url.Parse(object.String)
+			if err != nil {
+				return err
+			}
+			e.Object = u
+		}
+		items = append(items, e)
+		return nil
+	})
+}
@@ -31,7 +31,8 @@ import (
 )
 
 const (
-	FederatedBlockPurpose Purpose = "federated_block"
+	FederatedBlockPurpose   Purpose = "federated_block"
+	AutoAcceptFollowPurpose Purpose = "auto_accept_follow"
 )
 
 type Purpose string
@@ -206,12 +207,13 @@ func (b BinaryMatcher) Match(res gjson.Result, json []byte, r *Resolution) (lhs,
 }
 
 type Value struct {
-	JSONPath       string `json:"jsonPath,omitempty"`
-	EqualsString   string `json:"equalsString,omitempty"`
-	ContainsString string `json:"containsString,omitempty"`
-	LenEquals      *int   `json:"lenEquals,omitempty"`
-	LenGreater     *int   `json:"lenGreater,omitempty"`
-	LenLess        *int   `json:"lenLess,omitempty"`
+	JSONPath       string   `json:"jsonPath,omitempty"`
+	EqualsString   string   `json:"equalsString,omitempty"`
+	ContainsString string   `json:"containsString,omitempty"`
+	LenEquals      *int     `json:"lenEquals,omitempty"`
+	LenGreater     *int     `json:"lenGreater,omitempty"`
+	LenLess        *int     `json:"lenLess,omitempty"`
+	HostIn         []string `json:"hostIn,omitempty"`
 }
 
 func (u Value) Validate() error {
@@ -234,6 +236,9 @@ func (u Value) Validate() error {
 	if u.LenLess != nil {
 		n++
 	}
+	if len(u.HostIn) > 0 {
+		n++
+	}
 	if n > 1 {
 		return errors.New("value has >1 field set")
 	} else if n == 0 {
@@ -271,6 +276,10 @@ func (u Value) Match(res gjson.Result, json []byte, r *Resolution) (bool, error)
 		v := l < *u.LenLess
 		r.Logf("apply LESS(LEN(), %d)=>%v", *u.LenLess, v)
 		return v, nil
+	} else if len(u.HostIn) > 0 {
+		v := resultHostIn(res, u.HostIn)
+		r.Logf("apply HOSTIN(%s)=>%v", strings.Join(u.HostIn, ", "), v)
+		return v, nil
 	}
 	r.Log("error: Match called with invalid Value")
 	return false, errors.New("Match called with invalid Value")
@@ -280,6 +289,35 @@ func resultsEqual(lhs, rhs gjson.Result) bool {
 	return reflect.DeepEqual(lhs.Value(), rhs.Value())
 }
 
+// resultHostIn determines whether the result is an IRI, or an object with an
+// id, on one of the hosts. Every element of an array must be.
+func resultHostIn(r gjson.Result, hosts []string) bool {
+	if r.IsArray() {
+		elems := r.Array()
+		for _, e := range elems {
+			if !resultHostIn(e, hosts) {
+				return false
+			}
+		}
+		return len(elems) > 0
+	} else if r.IsObject() {
+		r = r.Get("id")
+	}
+	if r.Type != gjson.String {
+		return false
+	}
+	u, err := url.Parse(r.String())
+	if err != nil {
+		return false
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(u.Host, h) {
+			return true
+		}
+	}
+	return false
+}
+
 func resultsLen(r gjson.Result) int {
 	l := 0
 	if r.Exists() {
@@ -316,14 +354,16 @@ type Policies struct {
 	create                *sql.Stmt
 	getForActor           *sql.Stmt
 	getForActorAndPurpose *sql.Stmt
+	del                   *sql.Stmt
 }
 
 func (p *Policies) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(p.create), s.CreatePolicy()},
-			{&(p.getForActor), s.GetPoliciesForActor()},
-			{&(p.getForActorAndPurpose), s.GetPoliciesForActorAndPurpose()},
+			{&(p.create), s.CreatePolicy},
+			{&(p.getForActor), s.GetPoliciesForActor},
+			{&(p.getForActorAndPurpose), s.GetPoliciesForActorAndPurpose},
+			{&(p.del), s.DeletePolicy},
 		})
 }
 
@@ -336,6 +376,7 @@ func (p *Policies) Close() {
 	p.create.Close()
 	p.getForActor.Close()
 	p.getForActorAndPurpose.Close()
+	p.del.Close()
 }
 
 // Create a new Policy
@@ -389,3 +430,9 @@ func (p *Policies) GetForActorAndPurpose(c util.Context, tx *sql.Tx, actorID *ur
 		return nil
 	})
 }
+
+// Delete removes the actor's policy, along with its resolutions.
+func (p *Policies) Delete(c util.Context, tx *sql.Tx, actorID *url.URL, policyID string) error {
+	r, err := tx.Stmt(p.del).ExecContext(c, policyID, actorID.String())
+	return mustChangeOneRow(r, err, "Policies.Delete")
+}
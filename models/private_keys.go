@@ -35,14 +35,17 @@ type PrivateKeys struct {
 func (p *PrivateKeys) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(p.createPrivateKey), s.CreatePrivateKey()},
-			{&(p.getByUserID), s.GetPrivateKeyByUserID()},
-			{&(p.getInstanceActor), s.GetPrivateKeyForInstanceActor()},
+			{&(p.createPrivateKey), s.CreatePrivateKey},
+			{&(p.getByUserID), s.GetPrivateKeyByUserID},
+			{&(p.getInstanceActor), s.GetPrivateKeyForInstanceActor},
 		})
 }
 
 func (p *PrivateKeys) CreateTable(t *sql.Tx, s SqlDialect) error {
-	_, err := t.Exec(s.CreatePrivateKeysTable())
+	if _, err := t.Exec(s.CreatePrivateKeysTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.AddPrivateKeysKeyTypeColumn())
 	return err
 }
 
@@ -52,34 +55,53 @@ func (p *PrivateKeys) Close() {
 	p.getInstanceActor.Close()
 }
 
-// Create a new private key entry in the database.
-func (p *PrivateKeys) Create(c util.Context, tx *sql.Tx, userID, purpose string, privKey []byte) error {
-	r, err := tx.Stmt(p.createPrivateKey).ExecContext(c, userID, purpose, privKey)
+// Create a new private key entry in the database. The key type identifies the
+// kind of key the PKCS8-encoded privKey is.
+func (p *PrivateKeys) Create(c util.Context, tx *sql.Tx, userID, purpose string, privKey []byte, keyType string) error {
+	r, err := tx.Stmt(p.createPrivateKey).ExecContext(c, userID, purpose, privKey, keyType)
 	return mustChangeOneRow(r, err, "PrivateKeys.Create")
 }
 
-// GetByUserID fetches a private key by the userID and purpose of the key.
-func (p *PrivateKeys) GetByUserID(c util.Context, tx *sql.Tx, userID, purpose string) (b []byte, err error) {
+// PrivateKey is a PKCS8-encoded private key and the kind of key it is.
+type PrivateKey struct {
+	PrivKey []byte
+	KeyType string
+}
+
+// GetByUserID fetches the private keys of a user for the purpose, along with
+// their types.
+func (p *PrivateKeys) GetByUserID(c util.Context, tx *sql.Tx, userID, purpose string) (k []PrivateKey, err error) {
 	var rows *sql.Rows
 	rows, err = tx.Stmt(p.getByUserID).QueryContext(c, userID, purpose)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	return b, enforceOneRow(rows, "PrivateKeys.GetByUserID", func(r SingleRow) error {
-		return r.Scan(&(b))
+	return k, doForRows(rows, "PrivateKeys.GetByUserID", func(r SingleRow) error {
+		var pk PrivateKey
+		if err := r.Scan(&(pk.PrivKey), &(pk.KeyType)); err != nil {
+			return err
+		}
+		k = append(k, pk)
+		return nil
 	})
 }
 
-// GetInstanceActor fetches a private key for the single instance actor.
-func (p *PrivateKeys) GetInstanceActor(c util.Context, tx *sql.Tx, purpose string) (b []byte, err error) {
+// GetInstanceActor fetches the private keys of the single instance actor for
+// the purpose, along with their types.
+func (p *PrivateKeys) GetInstanceActor(c util.Context, tx *sql.Tx, purpose string) (k []PrivateKey, err error) {
 	var rows *sql.Rows
 	rows, err = tx.Stmt(p.getInstanceActor).QueryContext(c, purpose)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	return b, enforceOneRow(rows, "PrivateKeys.GetInstanceActor", func(r SingleRow) error {
-		return r.Scan(&(b))
+	return k, doForRows(rows, "PrivateKeys.GetInstanceActor", func(r SingleRow) error {
+		var pk PrivateKey
+		if err := r.Scan(&(pk.PrivKey), &(pk.KeyType)); err != nil {
+			return err
+		}
+		k = append(k, pk)
+		return nil
 	})
 }
@@ -0,0 +1,185 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Relays{}
+
+// States of a subscription to a relay.
+const (
+	RelayStatePending  = "pending"
+	RelayStateAccepted = "accepted"
+)
+
+// Relays is a Model that provides additional database methods for the relays
+// the server is subscribed to, which forward public activities of their other
+// subscribers.
+type Relays struct {
+	insert           *sql.Stmt
+	accept           *sql.Stmt
+	containsAccepted *sql.Stmt
+	get              *sql.Stmt
+	getByFollow      *sql.Stmt
+	getAll           *sql.Stmt
+	del              *sql.Stmt
+}
+
+func (r *Relays) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(r.insert), s.InsertRelay},
+			{&(r.accept), s.AcceptRelay},
+			{&(r.containsAccepted), s.ContainsAcceptedRelay},
+			{&(r.get), s.GetRelay},
+			{&(r.getByFollow), s.GetRelayByFollow},
+			{&(r.getAll), s.GetAllRelays},
+			{&(r.del), s.DeleteRelay},
+		})
+}
+
+func (r *Relays) CreateTable(t *sql.Tx, s SqlDialect) error {
+	_, err := t.Exec(s.CreateRelaysTable())
+	return err
+}
+
+func (r *Relays) Close() {
+	r.insert.Close()
+	r.accept.Close()
+	r.containsAccepted.Close()
+	r.get.Close()
+	r.getByFollow.Close()
+	r.getAll.Close()
+	r.del.Close()
+}
+
+// Relay is a subscription to a relay.
+type Relay struct {
+	ID      string
+	Created time.Time
+	Inbox   URL
+	// FollowID is the id of the Follow that subscribed to the relay.
+	FollowID URL
+	// Actor is the relay's actor, which is only known once it accepts the
+	// Follow.
+	Actor sql.NullString
+	State string
+}
+
+// Create records a pending subscription to the relay with the Follow. An
+// existing subscription to the relay is replaced.
+func (r *Relays) Create(c util.Context, tx *sql.Tx, inbox, followID *url.URL) error {
+	_, err := tx.Stmt(r.insert).ExecContext(c,
+		inbox.String(),
+		followID.String(),
+		RelayStatePending)
+	return err
+}
+
+// Accept marks the subscription made with the Follow as accepted by the relay's
+// actor, returning false if there is no such subscription.
+func (r *Relays) Accept(c util.Context, tx *sql.Tx, followID, actor *url.URL) (ok bool, err error) {
+	var res sql.Result
+	res, err = tx.Stmt(r.accept).ExecContext(c,
+		followID.String(),
+		actor.String(),
+		RelayStateAccepted)
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = res.RowsAffected()
+	ok = n == 1
+	return
+}
+
+// ContainsAccepted determines whether the actor is of a relay that has
+// accepted a subscription.
+func (r *Relays) ContainsAccepted(c util.Context, tx *sql.Tx, actor *url.URL) (contains bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(r.containsAccepted).QueryContext(c, actor.String(), RelayStateAccepted)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = enforceOneRow(rows, "Relays.ContainsAccepted", func(r SingleRow) error {
+		return r.Scan(&contains)
+	})
+	return
+}
+
+// Get fetches the subscription to the relay with the inbox. ErrNotFound is
+// returned if there is none.
+func (r *Relays) Get(c util.Context, tx *sql.Tx, inbox *url.URL) (rl Relay, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(r.get).QueryContext(c, inbox.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = findOneRow(rows, "Relays.Get", func(r SingleRow) error {
+		return r.Scan(&(rl.ID), &(rl.Created), &(rl.Inbox), &(rl.FollowID), &(rl.Actor), &(rl.State))
+	})
+	return
+}
+
+// GetByFollow fetches the subscription made with the Follow. ErrNotFound is
+// returned if there is none.
+func (r *Relays) GetByFollow(c util.Context, tx *sql.Tx, followID *url.URL) (rl Relay, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(r.getByFollow).QueryContext(c, followID.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = findOneRow(rows, "Relays.GetByFollow", func(r SingleRow) error {
+		return r.Scan(&(rl.ID), &(rl.Created), &(rl.Inbox), &(rl.FollowID), &(rl.Actor), &(rl.State))
+	})
+	return
+}
+
+// GetAll fetches every subscription to a relay, oldest first.
+func (r *Relays) GetAll(c util.Context, tx *sql.Tx) (rl []Relay, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(r.getAll).QueryContext(c)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Relays.GetAll", func(r SingleRow) error {
+		var v Relay
+		if err := r.Scan(&(v.ID), &(v.Created), &(v.Inbox), &(v.FollowID), &(v.Actor), &(v.State)); err != nil {
+			return err
+		}
+		rl = append(rl, v)
+		return nil
+	})
+	return
+}
+
+// Delete removes the subscription to the relay with the inbox. It is not an
+// error if there is none.
+func (r *Relays) Delete(c util.Context, tx *sql.Tx, inbox *url.URL) error {
+	_, err := tx.Stmt(r.del).ExecContext(c, inbox.String())
+	return err
+}
@@ -0,0 +1,170 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Replies{}
+
+// Replies is a Model that provides additional database methods for the
+// collections of the replies to local objects.
+type Replies struct {
+	insert            *sql.Stmt
+	exists            *sql.Stmt
+	contains          *sql.Stmt
+	get               *sql.Stmt
+	getPublic         *sql.Stmt
+	getLastPage       *sql.Stmt
+	getPublicLastPage *sql.Stmt
+	prependItem       *sql.Stmt
+}
+
+func (i *Replies) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(i.insert), s.InsertReplies},
+			{&(i.exists), s.RepliesExists},
+			{&(i.contains), s.RepliesContains},
+			{&(i.get), s.GetReplies},
+			{&(i.getPublic), s.GetPublicReplies},
+			{&(i.getLastPage), s.GetRepliesLastPage},
+			{&(i.getPublicLastPage), s.GetPublicRepliesLastPage},
+			{&(i.prependItem), s.PrependRepliesItem},
+		})
+}
+
+func (i *Replies) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateRepliesTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexIDRepliesTable())
+	return err
+}
+
+func (i *Replies) Close() {
+	i.insert.Close()
+	i.exists.Close()
+	i.contains.Close()
+	i.get.Close()
+	i.getPublic.Close()
+	i.getLastPage.Close()
+	i.getPublicLastPage.Close()
+	i.prependItem.Close()
+}
+
+// Create a new replies entry for the given object.
+func (i *Replies) Create(c util.Context, tx *sql.Tx, object *url.URL, replies ActivityStreamsCollection) error {
+	r, err := tx.Stmt(i.insert).ExecContext(c,
+		object.String(),
+		replies)
+	return mustChangeOneRow(r, err, "Replies.Create")
+}
+
+// Exists returns true if the replies collection has been created.
+func (i *Replies) Exists(c util.Context, tx *sql.Tx, replies *url.URL) (b bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.exists).QueryContext(c, replies.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, enforceOneRow(rows, "Replies.Exists", func(r SingleRow) error {
+		return r.Scan(&b)
+	})
+}
+
+// Contains returns true if the item is in the replies collection.
+func (i *Replies) Contains(c util.Context, tx *sql.Tx, replies, item *url.URL) (b bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.contains).QueryContext(c, replies.String(), item.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, enforceOneRow(rows, "Replies.Contains", func(r SingleRow) error {
+		return r.Scan(&b)
+	})
+}
+
+// GetPage returns a CollectionPage of the Replies.
+//
+// The range of elements retrieved are [min, max).
+func (i *Replies) GetPage(c util.Context, tx *sql.Tx, replies *url.URL, min, max int) (page ActivityStreamsCollectionPage, isEnd bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.get).QueryContext(c, replies.String(), min, max-1)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, isEnd, enforceOneRow(rows, "Replies.GetPage", func(r SingleRow) error {
+		return r.Scan(&page, &isEnd)
+	})
+}
+
+// GetLastPage returns the last CollectionPage of the Replies collection.
+func (i *Replies) GetLastPage(c util.Context, tx *sql.Tx, replies *url.URL, n int) (page ActivityStreamsCollectionPage, startIdx int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getLastPage).QueryContext(c, replies.String(), n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, startIdx, enforceOneRow(rows, "Replies.GetLastPage", func(r SingleRow) error {
+		return r.Scan(&page, &startIdx)
+	})
+}
+
+// GetPublicPage returns a CollectionPage of the Replies that are addressed to
+// the public.
+//
+// The range of elements retrieved are [min, max).
+func (i *Replies) GetPublicPage(c util.Context, tx *sql.Tx, replies *url.URL, min, max int) (page ActivityStreamsCollectionPage, isEnd bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getPublic).QueryContext(c, replies.String(), min, max-1)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, isEnd, enforceOneRow(rows, "Replies.GetPublicPage", func(r SingleRow) error {
+		return r.Scan(&page, &isEnd)
+	})
+}
+
+// GetPublicLastPage returns the last CollectionPage of the Replies that are
+// addressed to the public.
+func (i *Replies) GetPublicLastPage(c util.Context, tx *sql.Tx, replies *url.URL, n int) (page ActivityStreamsCollectionPage, startIdx int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getPublicLastPage).QueryContext(c, replies.String(), n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, startIdx, enforceOneRow(rows, "Replies.GetPublicLastPage", func(r SingleRow) error {
+		return r.Scan(&page, &startIdx)
+	})
+}
+
+// PrependItem prepends the item to the replies' items list.
+func (i *Replies) PrependItem(c util.Context, tx *sql.Tx, replies, item *url.URL) error {
+	r, err := tx.Stmt(i.prependItem).ExecContext(c, replies.String(), item.String())
+	return mustChangeOneRow(r, err, "Replies.PrependItem")
+}
@@ -0,0 +1,127 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Reports{}
+
+// Statuses of a report in the moderation queue.
+const (
+	ReportStatusOpen     = "open"
+	ReportStatusResolved = "resolved"
+)
+
+// Reports is a Model that provides additional database methods for the reports
+// of content made with Flag activities, awaiting moderation.
+type Reports struct {
+	insert      *sql.Stmt
+	getByStatus *sql.Stmt
+	resolve     *sql.Stmt
+}
+
+func (r *Reports) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(r.insert), s.InsertReport},
+			{&(r.getByStatus), s.GetReportsByStatus},
+			{&(r.resolve), s.ResolveReport},
+		})
+}
+
+func (r *Reports) CreateTable(t *sql.Tx, s SqlDialect) error {
+	_, err := t.Exec(s.CreateReportsTable())
+	return err
+}
+
+func (r *Reports) Close() {
+	r.insert.Close()
+	r.getByStatus.Close()
+	r.resolve.Close()
+}
+
+// Report is a report of content made by a Flag activity.
+type Report struct {
+	ID         string
+	Created    time.Time
+	ActivityID URL
+	Reporter   URL
+	Objects    URLs
+	Comment    string
+	Status     string
+	// ResolvedBy and Resolved are nil until the report is resolved.
+	ResolvedBy *string
+	Resolved   *time.Time
+}
+
+// Create adds an open report made by the Flag activity. A Flag that has
+// already been reported, such as one delivered to several inboxes, is ignored.
+func (r *Reports) Create(c util.Context, tx *sql.Tx, activityID, reporter *url.URL, objects []*url.URL, comment string) error {
+	_, err := tx.Stmt(r.insert).ExecContext(c,
+		activityID.String(),
+		reporter.String(),
+		URLs(objects),
+		comment)
+	return err
+}
+
+// GetByStatus fetches the reports with the status, oldest first.
+func (r *Reports) GetByStatus(c util.Context, tx *sql.Tx, status string) (rp []Report, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(r.getByStatus).QueryContext(c, status)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "Reports.GetByStatus", func(r SingleRow) error {
+		var v Report
+		if err := r.Scan(&(v.ID),
+			&(v.Created),
+			&(v.ActivityID),
+			&(v.Reporter),
+			&(v.Objects),
+			&(v.Comment),
+			&(v.Status),
+			&(v.ResolvedBy),
+			&(v.Resolved)); err != nil {
+			return err
+		}
+		rp = append(rp, v)
+		return nil
+	})
+	return
+}
+
+// Resolve marks the open report as resolved by the user, returning false if it
+// does not exist or is already resolved.
+func (r *Reports) Resolve(c util.Context, tx *sql.Tx, id, resolvedBy string) (ok bool, err error) {
+	var res sql.Result
+	res, err = tx.Stmt(r.resolve).ExecContext(c, id, resolvedBy)
+	if err != nil {
+		return
+	}
+	var n int64
+	n, err = res.RowsAffected()
+	ok = n == 1
+	return
+}
@@ -58,7 +58,7 @@ type Resolutions struct {
 func (r *Resolutions) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(r.create), s.CreateResolution()},
+			{&(r.create), s.CreateResolution},
 		})
 }
 
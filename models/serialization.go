@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"reflect"
 	"time"
 
 	"github.com/go-fed/activity/pub"
@@ -40,6 +41,7 @@ func Marshal(v vocab.Type) (b []byte, err error) {
 	if err != nil {
 		return
 	}
+	normalizeExtensions(m)
 	b, err = json.Marshal(m)
 	if err != nil {
 		return
@@ -47,6 +49,118 @@ func Marshal(v vocab.Type) (b []byte, err error) {
 	return
 }
 
+const (
+	activityStreamsNamespace = "https://www.w3.org/ns/activitystreams"
+	tootNamespace            = "http://joinmastodon.org/ns"
+)
+
+// tootContext defines the Mastodon extension terms the way Mastodon does, as
+// its namespace is not itself a JSON-LD context document.
+var tootContext = map[string]interface{}{
+	"toot":               tootNamespace + "#",
+	"Emoji":              "toot:Emoji",
+	"IdentityProof":      "toot:IdentityProof",
+	"blurhash":           "toot:blurhash",
+	"discoverable":       "toot:discoverable",
+	"featured":           map[string]interface{}{"@id": "toot:featured", "@type": "@id"},
+	"featuredTags":       map[string]interface{}{"@id": "toot:featuredTags", "@type": "@id"},
+	"signatureAlgorithm": "toot:signatureAlgorithm",
+	"signatureValue":     "toot:signatureValue",
+	"votersCount":        "toot:votersCount",
+}
+
+// tootProperties are the Mastodon extension properties set on values as
+// unknown properties, so the Mastodon namespace is not otherwise added to their
+// context.
+var tootProperties = []string{"featured", "featuredTags"}
+
+// normalizeExtensions rewrites the serialized value so that peers interpret the
+// Mastodon extensions it uses, such as custom emoji, the way they expect: the
+// Mastodon namespace is replaced with its term definitions, which are added if
+// the value has a Mastodon property, and tags are kept as an array even when
+// there is only one. The ActivityStreams context is put first.
+func normalizeExtensions(m map[string]interface{}) {
+	switch ctx := m["@context"].(type) {
+	case string:
+		if ctx == tootNamespace {
+			m["@context"] = tootContext
+		}
+	case []interface{}:
+		for i, c := range ctx {
+			if c == tootNamespace {
+				ctx[i] = tootContext
+			} else if c == activityStreamsNamespace && i > 0 {
+				// Keep the contexts in a stable order.
+				ctx[0], ctx[i] = ctx[i], ctx[0]
+			}
+		}
+	}
+	for _, p := range tootProperties {
+		if _, ok := m[p]; ok {
+			addJSONLDContexts(m, []interface{}{tootContext})
+			break
+		}
+	}
+	if t, ok := m["tag"]; ok {
+		if _, isArray := t.([]interface{}); !isArray {
+			m["tag"] = []interface{}{t}
+		}
+	}
+}
+
+// JSONLDContexts are the JSON-LD contexts of an application's own vocabulary
+// extensions, such as context document URLs or term definitions.
+type JSONLDContexts []interface{}
+
+// Apply rewrites the serialized value so that peers interpret its extensions:
+// the Mastodon extensions are normalized the way Marshal does, and the contexts
+// are added to its context without duplicating any it already has.
+func (j JSONLDContexts) Apply(b []byte) ([]byte, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	normalizeExtensions(m)
+	addJSONLDContexts(m, j)
+	return json.Marshal(m)
+}
+
+// addJSONLDContexts appends the contexts to the serialized value's context,
+// leaving out those it already has. The ActivityStreams context remains first.
+func addJSONLDContexts(m map[string]interface{}, ctxs []interface{}) {
+	if len(ctxs) == 0 {
+		return
+	}
+	var all []interface{}
+	switch ctx := m["@context"].(type) {
+	case nil:
+	case []interface{}:
+		all = ctx
+	default:
+		all = []interface{}{ctx}
+	}
+	for _, c := range ctxs {
+		if !hasJSONLDContext(all, c) {
+			all = append(all, c)
+		}
+	}
+	if len(all) == 1 {
+		m["@context"] = all[0]
+	} else {
+		m["@context"] = all
+	}
+}
+
+// hasJSONLDContext determines whether the context is among the contexts.
+func hasJSONLDContext(all []interface{}, c interface{}) bool {
+	for _, a := range all {
+		if reflect.DeepEqual(a, c) {
+			return true
+		}
+	}
+	return false
+}
+
 // unmarhsal attempts to deserialize JSON bytes into a value.
 func unmarshal(maybeByte, v interface{}) error {
 	b, ok := maybeByte.([]byte)
@@ -61,6 +175,15 @@ type SingleRow interface {
 	app.SingleRow
 }
 
+var (
+	// ErrNotFound is returned when a query expected to find one row found
+	// none.
+	ErrNotFound error = errors.New("no database row found")
+	// ErrMultipleRows is returned when a query expected to find one row
+	// found more than one.
+	ErrMultipleRows error = errors.New("multiple database rows retrieved when enforcing one row")
+)
+
 func MustQueryOneRow(r *sql.Rows, fn func(r SingleRow) error) error {
 	return enforceOneRow(r, "", fn)
 }
@@ -77,7 +200,7 @@ func enforceOneRow(r *sql.Rows, debugname string, fn func(r SingleRow) error) er
 	var n int
 	for r.Next() {
 		if n > 0 {
-			return fmt.Errorf("%s: multiple database rows retrieved when enforcing one row", debugname)
+			return fmt.Errorf("%s: %w", debugname, ErrMultipleRows)
 		}
 		err := fn(SingleRow(r))
 		if err != nil {
@@ -88,6 +211,20 @@ func enforceOneRow(r *sql.Rows, debugname string, fn func(r SingleRow) error) er
 	return r.Err()
 }
 
+// findOneRow is like enforceOneRow, but also returns ErrNotFound when there
+// are no rows.
+func findOneRow(r *sql.Rows, debugname string, fn func(r SingleRow) error) error {
+	var found bool
+	err := enforceOneRow(r, debugname, func(r SingleRow) error {
+		found = true
+		return fn(r)
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("%s: %w", debugname, ErrNotFound)
+	}
+	return err
+}
+
 func QueryRows(r *sql.Rows, fn func(r SingleRow) error) error {
 	return doForRows(r, "", fn)
 }
@@ -135,6 +272,17 @@ type Privileges struct {
 	InstanceActor bool
 	// Payload is additional privilege information that is app-specific.
 	Payload json.RawMessage
+	// PostRateLimit overrides the server's limits on how often the user may
+	// post to their outbox, if non-nil.
+	PostRateLimit *PostRateLimit
+}
+
+// PostRateLimit is the number of posts a user may make to their outbox per
+// minute and per hour. Zero uses the server's limit, and a negative value
+// means no limit.
+type PostRateLimit struct {
+	PerMinute int
+	PerHour   int
 }
 
 func (p Privileges) Value() (driver.Value, error) {
@@ -154,6 +302,13 @@ type Preferences struct {
 	// OnFollow indicates default behavior when a Follow request is received
 	// by a user.
 	OnFollow OnFollowBehavior
+	// AutoAcceptMutualFollows indicates that, when Follow requests are
+	// manually approved, a Follow from an actor the user already follows
+	// is accepted automatically.
+	AutoAcceptMutualFollows bool
+	// FollowMovedActors indicates that, when an actor the user follows
+	// moves to a new account, the user follows the new account.
+	FollowMovedActors bool
 	// Payload is additional preference information that is app-specific.
 	Payload json.RawMessage
 }
@@ -191,10 +346,32 @@ type InstanceActorPreferences struct {
 	// OrgAccount contains the account information representing the
 	// Organization this server belongs to.
 	OrgAccount string
+	// Announcement is the sitewide message shown to visitors, if any.
+	Announcement *Announcement
 	// Payload is additional preference information that is app-specific.
 	Payload json.RawMessage
 }
 
+// Announcement is a sitewide message, such as a maintenance notice, that is
+// shown between its start and end times.
+type Announcement struct {
+	Text string
+	// Start is when the announcement is first shown. If zero, it is shown
+	// immediately.
+	Start time.Time
+	// End is when the announcement is no longer shown. If zero, it is
+	// shown until it is removed.
+	End time.Time
+}
+
+// Active determines whether the announcement is shown at the time.
+func (a *Announcement) Active(now time.Time) bool {
+	return a != nil &&
+		len(a.Text) > 0 &&
+		!now.Before(a.Start) &&
+		(a.End.IsZero() || now.Before(a.End))
+}
+
 func (p InstanceActorPreferences) Value() (driver.Value, error) {
 	return json.Marshal(p)
 }
@@ -550,3 +727,33 @@ func (u *URL) Scan(src interface{}) error {
 	u.URL, err = url.Parse(s)
 	return err
 }
+
+var _ driver.Valuer = URLs{}
+var _ sql.Scanner = &URLs{}
+
+// URLs is a list of IRIs serializable and deserializable into a JSON array for
+// database storage.
+type URLs []*url.URL
+
+func (u URLs) Value() (driver.Value, error) {
+	s := make([]string, len(u))
+	for i, v := range u {
+		s[i] = v.String()
+	}
+	return json.Marshal(s)
+}
+
+func (u *URLs) Scan(src interface{}) error {
+	var s []string
+	if err := unmarshal(src, &s); err != nil {
+		return err
+	}
+	*u = make(URLs, len(s))
+	for i, v := range s {
+		var err error
+		if (*u)[i], err = url.Parse(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &SharedInboxes{}
+
+// SharedInboxes is a Model that remembers the shared inbox advertised by the
+// actor owning a peer's inbox, so that deliveries to many actors on the peer
+// are made once.
+type SharedInboxes struct {
+	upsert *sql.Stmt
+	get    *sql.Stmt
+}
+
+func (s *SharedInboxes) Prepare(db *sql.DB, d SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(s.upsert), d.UpsertSharedInbox},
+			{&(s.get), d.GetSharedInboxes},
+		})
+}
+
+func (s *SharedInboxes) CreateTable(t *sql.Tx, d SqlDialect) error {
+	_, err := t.Exec(d.CreateSharedInboxesTable())
+	return err
+}
+
+func (s *SharedInboxes) Close() {
+	s.upsert.Close()
+	s.get.Close()
+}
+
+// SharedInbox is the shared inbox advertised by the actor owning an inbox.
+type SharedInbox struct {
+	Inbox       URL
+	SharedInbox URL
+}
+
+// Upsert records the shared inbox of the inbox, replacing any recorded before.
+func (s *SharedInboxes) Upsert(c util.Context, tx *sql.Tx, inbox, sharedInbox *url.URL) error {
+	_, err := tx.Stmt(s.upsert).ExecContext(c,
+		inbox.String(),
+		sharedInbox.String())
+	return err
+}
+
+// Get fetches the shared inboxes of the inboxes, as recorded or as advertised
+// by the actors cached as federated data. Inboxes whose shared inbox is not
+// known are omitted.
+func (s *SharedInboxes) Get(c util.Context, tx *sql.Tx, inboxes []*url.URL) (si []SharedInbox, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(s.get).QueryContext(c, URLs(inboxes))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return si, doForRows(rows, "SharedInboxes.Get", func(r SingleRow) error {
+		var v SharedInbox
+		if err := r.Scan(&(v.Inbox), &(v.SharedInbox)); err != nil {
+			return err
+		}
+		si = append(si, v)
+		return nil
+	})
+}
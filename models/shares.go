@@ -0,0 +1,159 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package models
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/util"
+)
+
+var _ Model = &Shares{}
+
+// Shares is a Model that provides additional database methods for the
+// collections of Announce activities that shared local objects.
+type Shares struct {
+	insert      *sql.Stmt
+	exists      *sql.Stmt
+	contains    *sql.Stmt
+	get         *sql.Stmt
+	getLastPage *sql.Stmt
+	prependItem *sql.Stmt
+	deleteItem  *sql.Stmt
+	count       *sql.Stmt
+}
+
+func (i *Shares) Prepare(db *sql.DB, s SqlDialect) error {
+	return prepareStmtPairs(db,
+		stmtPairs{
+			{&(i.insert), s.InsertShares},
+			{&(i.exists), s.SharesExists},
+			{&(i.contains), s.SharesContains},
+			{&(i.get), s.GetShares},
+			{&(i.getLastPage), s.GetSharesLastPage},
+			{&(i.prependItem), s.PrependSharesItem},
+			{&(i.deleteItem), s.DeleteSharesItem},
+			{&(i.count), s.CountShares},
+		})
+}
+
+func (i *Shares) CreateTable(t *sql.Tx, s SqlDialect) error {
+	if _, err := t.Exec(s.CreateSharesTable()); err != nil {
+		return err
+	}
+	_, err := t.Exec(s.CreateIndexIDSharesTable())
+	return err
+}
+
+func (i *Shares) Close() {
+	i.insert.Close()
+	i.exists.Close()
+	i.contains.Close()
+	i.get.Close()
+	i.getLastPage.Close()
+	i.prependItem.Close()
+	i.deleteItem.Close()
+	i.count.Close()
+}
+
+// Create a new shares entry for the given object.
+func (i *Shares) Create(c util.Context, tx *sql.Tx, object *url.URL, shares ActivityStreamsCollection) error {
+	r, err := tx.Stmt(i.insert).ExecContext(c,
+		object.String(),
+		shares)
+	return mustChangeOneRow(r, err, "Shares.Create")
+}
+
+// Exists returns true if the shares collection has been created.
+func (i *Shares) Exists(c util.Context, tx *sql.Tx, shares *url.URL) (b bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.exists).QueryContext(c, shares.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, enforceOneRow(rows, "Shares.Exists", func(r SingleRow) error {
+		return r.Scan(&b)
+	})
+}
+
+// Contains returns true if the item is in the shares collection.
+func (i *Shares) Contains(c util.Context, tx *sql.Tx, shares, item *url.URL) (b bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.contains).QueryContext(c, shares.String(), item.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, enforceOneRow(rows, "Shares.Contains", func(r SingleRow) error {
+		return r.Scan(&b)
+	})
+}
+
+// GetPage returns a CollectionPage of the Shares.
+//
+// The range of elements retrieved are [min, max).
+func (i *Shares) GetPage(c util.Context, tx *sql.Tx, shares *url.URL, min, max int) (page ActivityStreamsCollectionPage, isEnd bool, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.get).QueryContext(c, shares.String(), min, max-1)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, isEnd, enforceOneRow(rows, "Shares.GetPage", func(r SingleRow) error {
+		return r.Scan(&page, &isEnd)
+	})
+}
+
+// GetLastPage returns the last CollectionPage of the Shares collection.
+func (i *Shares) GetLastPage(c util.Context, tx *sql.Tx, shares *url.URL, n int) (page ActivityStreamsCollectionPage, startIdx int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.getLastPage).QueryContext(c, shares.String(), n)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return page, startIdx, enforceOneRow(rows, "Shares.GetLastPage", func(r SingleRow) error {
+		return r.Scan(&page, &startIdx)
+	})
+}
+
+// PrependItem prepends the item to the shares' items list.
+func (i *Shares) PrependItem(c util.Context, tx *sql.Tx, shares, item *url.URL) error {
+	r, err := tx.Stmt(i.prependItem).ExecContext(c, shares.String(), item.String())
+	return mustChangeOneRow(r, err, "Shares.PrependItem")
+}
+
+// DeleteItem removes the item from the shares' items list.
+func (i *Shares) DeleteItem(c util.Context, tx *sql.Tx, shares, item *url.URL) error {
+	r, err := tx.Stmt(i.deleteItem).ExecContext(c, shares.String(), item.String())
+	return mustChangeOneRow(r, err, "Shares.DeleteItem")
+}
+
+// Count returns the number of items in the shares collection.
+func (i *Shares) Count(c util.Context, tx *sql.Tx, shares *url.URL) (n int, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(i.count).QueryContext(c, shares.String())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return n, enforceOneRow(rows, "Shares.Count", func(r SingleRow) error {
+		return r.Scan(&n)
+	})
+}
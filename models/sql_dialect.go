@@ -28,14 +28,28 @@ type SqlDialect interface {
 	CreateFedDataTable() string
 	// CreateLocalDataTable for the LocalData model.
 	CreateLocalDataTable() string
+	// CreateLocalDataArchiveTable for the LocalData model.
+	CreateLocalDataArchiveTable() string
 	// CreateInboxesTable for the Inboxes model.
 	CreateInboxesTable() string
 	// CreateOutboxesTable for the Outboxes model.
 	CreateOutboxesTable() string
 	// CreateDeliveryAttemptsTable for the DeliveryAttempts model.
 	CreateDeliveryAttemptsTable() string
+	// AddDeliveryAttemptsPayloadCompressedColumn for DeliveryAttempts
+	// tables created before payloads could be compressed.
+	AddDeliveryAttemptsPayloadCompressedColumn() string
+	// AddDeliveryAttemptsActivityIDColumn for DeliveryAttempts tables
+	// created before the delivered activity's id was recorded.
+	AddDeliveryAttemptsActivityIDColumn() string
+	// AddDeliveryAttemptsSignedHeadersColumn for DeliveryAttempts tables
+	// created before the signed headers of attempts were recorded.
+	AddDeliveryAttemptsSignedHeadersColumn() string
 	// CreatePrivateKeysTable for the PrivateKeys model.
 	CreatePrivateKeysTable() string
+	// AddPrivateKeysKeyTypeColumn for PrivateKeys tables created before
+	// keys other than RSA keys were supported.
+	AddPrivateKeysKeyTypeColumn() string
 	// CreateClientInfosTable for the ClientInfos model.
 	CreateClientInfosTable() string
 	// CreateTokenInfosTable for the TokenInfos model.
@@ -46,25 +60,86 @@ type SqlDialect interface {
 	CreateFollowingTable() string
 	// CreateLikedTable for the Liked model.
 	CreateLikedTable() string
+	// CreateFeaturedTagsTable for the FeaturedTags model.
+	CreateFeaturedTagsTable() string
+	// CreateFeaturedTable for the Featured model.
+	CreateFeaturedTable() string
+	// CreateSharesTable for the Shares model.
+	CreateSharesTable() string
+	// CreateRepliesTable for the Replies model.
+	CreateRepliesTable() string
 	// CreatePoliciesTable for the Policies model.
 	CreatePoliciesTable() string
 	// CreateResolutionsTable for the Resolutions model.
 	CreateResolutionsTable() string
 	// CreateFirstPartyCredentialsTable for first party credentials model.
 	CreateFirstPartyCredentialsTable() string
+	// CreateIdempotencyKeysTable for the IdempotencyKeys model.
+	CreateIdempotencyKeysTable() string
+	// CreateMediaTable for the Media model.
+	CreateMediaTable() string
+	// CreateMediaThumbnailsTable for the Media model.
+	CreateMediaThumbnailsTable() string
+	// CreateAllowedDomainsTable for the Domains model.
+	CreateAllowedDomainsTable() string
+	// CreateBlockedDomainsTable for the Domains model.
+	CreateBlockedDomainsTable() string
+	// CreateEmojiTable for the Emoji model.
+	CreateEmojiTable() string
+	// CreateInvitesTable for the Invites model.
+	CreateInvitesTable() string
+	// CreateReportsTable for the Reports model.
+	CreateReportsTable() string
+	// CreateRelaysTable for the Relays model.
+	CreateRelaysTable() string
+	// CreateInboxProcessedTable for the InboxProcessed model.
+	CreateInboxProcessedTable() string
+	// CreateIndexCreateTimeInboxProcessedTable for the InboxProcessed model.
+	CreateIndexCreateTimeInboxProcessedTable() string
+	// CreateBlocksTable for the Blocks model.
+	CreateBlocksTable() string
+	// CreateSharedInboxesTable for the SharedInboxes model.
+	CreateSharedInboxesTable() string
 
 	/* Indexes */
 
 	// CreateIndexIDFedDataTable creates an index on the `id` of a federated
 	// data payload.
 	CreateIndexIDFedDataTable() string
+	// CreateIndexInboxFedDataTable creates an index on the `inbox` of a
+	// federated actor.
+	CreateIndexInboxFedDataTable() string
+	// CreateIndexActivityIDDeliveryAttemptsTable creates an index on the
+	// id of the activity delivered by a delivery attempt.
+	CreateIndexActivityIDDeliveryAttemptsTable() string
+	// CreateIndexCreateTimeFedDataTable creates an index on the creation
+	// time of federated data.
+	CreateIndexCreateTimeFedDataTable() string
+	// CreateIndexToFedDataTable creates an index on the `to` of a federated
+	// data payload.
+	CreateIndexToFedDataTable() string
+	// CreateIndexCcFedDataTable creates an index on the `cc` of a federated
+	// data payload.
+	CreateIndexCcFedDataTable() string
 	// CreateIndexIDLocalDataTable creates an index on the `id` of a local
 	// data payload.
 	CreateIndexIDLocalDataTable() string
+	// CreateIndexCreateTimeLocalDataTable creates an index on the creation
+	// time of local data.
+	CreateIndexCreateTimeLocalDataTable() string
+	// CreateIndexToLocalDataTable creates an index on the `to` of a local
+	// data payload.
+	CreateIndexToLocalDataTable() string
+	// CreateIndexCcLocalDataTable creates an index on the `cc` of a local
+	// data payload.
+	CreateIndexCcLocalDataTable() string
 	// CreateIndexIDInboxesTable creates an index on the `id` of an inbox.
 	CreateIndexIDInboxesTable() string
 	// CreateIndexIDOutboxesTable creates an index on the `id` of an outbox.
 	CreateIndexIDOutboxesTable() string
+	// CreateIndexItemsOutboxesTable creates an index on the items of an
+	// outbox.
+	CreateIndexItemsOutboxesTable() string
 	// CreateIndexIDFollowersTable creates an index on the `id` of a
 	// followers collection.
 	CreateIndexIDFollowersTable() string
@@ -74,6 +149,40 @@ type SqlDialect interface {
 	// CreateIndexIDLikedTable creates an index on the `id` of a liked
 	// collection.
 	CreateIndexIDLikedTable() string
+	// CreateIndexIDFeaturedTagsTable creates an index on the `id` of a
+	// featured tags collection.
+	CreateIndexIDFeaturedTagsTable() string
+	// CreateIndexIDFeaturedTable creates an index on the `id` of a featured
+	// collection.
+	CreateIndexIDFeaturedTable() string
+	// CreateIndexIDSharesTable creates an index on the `id` of a shares
+	// collection.
+	CreateIndexIDSharesTable() string
+	// CreateIndexIDRepliesTable creates an index on the `id` of a replies
+	// collection.
+	CreateIndexIDRepliesTable() string
+
+	/* Transactions */
+
+	// Savepoint establishes a savepoint within the ongoing transaction.
+	// Savepoints share one name, so that rolling back to or releasing it
+	// applies to the most recent one.
+	Savepoint() string
+	// RollbackToSavepoint rolls back the changes made since the most recent
+	// savepoint, keeping the savepoint.
+	RollbackToSavepoint() string
+	// ReleaseSavepoint releases the most recent savepoint, keeping the
+	// changes made since it.
+	ReleaseSavepoint() string
+	// SetStatementTimeout sets the timeout of each statement of the session,
+	// or only of the ongoing transaction if local. A zero timeout disables
+	// it.
+	//  Params
+	//   Timeout     string
+	//   Local       bool
+	//  Returns
+	//   Timeout     string
+	SetStatementTimeout() string
 
 	/* Queries */
 
@@ -94,6 +203,13 @@ type SqlDialect interface {
 	//   Actor       []byte
 	//  Returns
 	UpdateUserActor() string
+	// UsersMissingActorProperty:
+	//  Params
+	//   Property    string
+	//  Returns (Multiple)
+	//   ID          string
+	//   Actor       []byte
+	UsersMissingActorProperty() string
 	// SensitiveUserByEmail:
 	//  Params
 	//   Email       string
@@ -155,6 +271,15 @@ type SqlDialect interface {
 	//   Privileges  []byte
 	//   Preferences []byte
 	InstanceUser() string
+	// AnyUser:
+	//  Params
+	//  Returns
+	//   ID          string
+	//   Email       string
+	//   Actor       []byte
+	//   Privileges  []byte
+	//   Preferences []byte
+	AnyUser() string
 	// GetInstanceActorProfile:
 	//  Params
 	//  Returns
@@ -165,6 +290,10 @@ type SqlDialect interface {
 	//   Prefs          []byte
 	//  Returns
 	SetInstanceActorPreferences() string
+	// LockInstanceActor:
+	//  Params
+	//  Returns
+	LockInstanceActor() string
 	// GetUserActivityStats:
 	//  Params
 	//  Returns
@@ -173,6 +302,17 @@ type SqlDialect interface {
 	//   ActiveMonth    int
 	//   ActiveWeek     int
 	GetUserActivityStats() string
+	// GetUserActivityStatsRange:
+	//  Params
+	//   From           time.Time
+	//   To             time.Time
+	//   Bucket         string
+	//  Returns (Multiple)
+	//   Start          time.Time
+	//   NewUsers       int
+	//   LastSeenUsers  int
+	//   NewPosts       int
+	GetUserActivityStatsRange() string
 
 	// FedExists:
 	//  Params
@@ -202,6 +342,25 @@ type SqlDialect interface {
 	//   ID          string
 	//  Returns
 	FedDelete() string
+	// FedDeleteIfUnreferenced:
+	//  Params
+	//   ID          string
+	//  Returns
+	FedDeleteIfUnreferenced() string
+	// FedTombstone:
+	//  Params
+	//   ID          string
+	//   Deleted     string
+	//  Returns
+	FedTombstone() string
+	// FedPublicTimeline:
+	//  Params
+	//   Types       []byte
+	//   MaxID       sql.NullString
+	//   N           int
+	//  Returns (Multiple)
+	//   Payload     []byte
+	FedPublicTimeline() string
 
 	// LocalExists:
 	//  Params
@@ -215,6 +374,12 @@ type SqlDialect interface {
 	//  Returns
 	//   Payload     []byte
 	LocalGet() string
+	// LocalCreateTime:
+	//  Params
+	//   ID          string
+	//  Returns
+	//   Created     time.Time
+	LocalCreateTime() string
 	// LocalCreate:
 	//  Params
 	//   Payload     []byte
@@ -231,12 +396,39 @@ type SqlDialect interface {
 	//   ID          string
 	//  Returns
 	LocalDelete() string
+	// LocalTombstone:
+	//  Params
+	//   ID          string
+	//   Deleted     string
+	//  Returns
+	LocalTombstone() string
+	// LocalArchive:
+	//  Params
+	//   ID          string
+	//  Returns
+	LocalArchive() string
 	// LocalStats:
 	//  Params
 	//  Returns
 	//   NLocalPosts    int
 	//   NLocalComments int
 	LocalStats() string
+	// LocalPublicTimeline:
+	//  Params
+	//   Types       []byte
+	//   MaxID       sql.NullString
+	//   N           int
+	//  Returns (Multiple)
+	//   Payload     []byte
+	LocalPublicTimeline() string
+	// LocalActorActivityTimes:
+	//  Params
+	//   ActorID     string
+	//   Since       time.Time
+	//   N           int
+	//  Returns (Multiple)
+	//   Created     time.Time
+	LocalActorActivityTimes() string
 
 	// InsertInbox:
 	//  Params
@@ -343,6 +535,16 @@ type SqlDialect interface {
 	//   Page        []byte
 	//   IsEnd       bool
 	GetPublicOutbox() string
+	// GetOutboxByType:
+	//  Params
+	//   Outbox      string
+	//   Min         int
+	//   Max         int
+	//   Types       []byte
+	//  Returns
+	//   Page        []byte
+	//   IsEnd       bool
+	GetOutboxByType() string
 	// GetOutboxLastPage:
 	//  Params
 	//   Outbox      string
@@ -377,13 +579,26 @@ type SqlDialect interface {
 	//  Returns
 	//   Outbox      string
 	OutboxForInbox() string
+	// ExpiredOutboxItems:
+	//  Params
+	//   Before      time.Time
+	//   N           int
+	//  Returns (Multiple)
+	//   Outbox      string
+	//   Actor       string
+	//   Item        string
+	//   Object      sql.NullString
+	//   Created     time.Time
+	ExpiredOutboxItems() string
 
 	// InsertAttempt:
 	//  Params
 	//   FromID      string
 	//   ToActor     string
 	//   Payload     []byte
+	//   Compressed  bool
 	//   State       string
+	//   ActivityID  string
 	//  Returns
 	//   ID          string
 	InsertAttempt() string
@@ -402,16 +617,25 @@ type SqlDialect interface {
 	//   ID          string
 	//  Returns
 	MarkAbandonedAttempt() string
+	// SetAttemptSignedHeaders:
+	//  Params
+	//   ID            string
+	//   SignedHeaders []byte
+	//  Returns
+	SetAttemptSignedHeaders() string
 	// FirstPageRetryableFailures:
 	//  Params
 	//   State       string
 	//   FetchTime   time.Time
 	//   Limit       int
+	//   NewState    string
+	//   StaleTime   time.Time
 	//  Returns
 	//   ID          string
 	//   FromID      string
 	//   DeliverTo   string
 	//   Payload     []byte
+	//   Compressed  bool
 	//   NAttempts   int
 	//   LastAttempt time.Time
 	FirstPageRetryableFailures() string
@@ -421,34 +645,66 @@ type SqlDialect interface {
 	//   FetchTime   time.Time
 	//   Limit       int
 	//   PrevID      string
+	//   NewState    string
+	//   StaleTime   time.Time
 	//  Returns
 	//   ID          string
 	//   FromID      string
 	//   DeliverTo   string
 	//   Payload     []byte
+	//   Compressed  bool
 	//   NAttempts   int
 	//   LastAttempt time.Time
 	NextPageRetryableFailures() string
+	// GetAttemptsForActivity:
+	//  Params
+	//   ActivityID  string
+	//  Returns (Multiple)
+	//   FromID      string
+	//   DeliverTo   string
+	//   State       string
+	//   NAttempts   int
+	//   LastAttempt time.Time
+	GetAttemptsForActivity() string
+	// GetAttemptByID:
+	//  Params
+	//   ID          string
+	//  Returns
+	//   ID          string
+	//   CreateTime  time.Time
+	//   FromID      string
+	//   DeliverTo   string
+	//   Payload     []byte
+	//   Compressed  bool
+	//   ActivityID  sql.NullString
+	//   State       string
+	//   NAttempts   int
+	//   LastAttempt time.Time
+	//   SignedHeaders []byte
+	GetAttemptByID() string
 
 	// CreatePrivateKey:
 	//  Params
 	//   UserID      string
 	//   Purpose     string
 	//   PrivKey     []byte
+	//   KeyType     string
 	//  Returns
 	CreatePrivateKey() string
 	// GetPrivateKeyByUserID:
 	//  Params
 	//   UserID      string
 	//   Purpose     string
-	//  Returns
+	//  Returns (Multiple)
 	//   PrivKey     []byte
+	//   KeyType     string
 	GetPrivateKeyByUserID() string
 	// GetPrivateKeyForInstanceActor:
 	//  Params
 	//   Purpose     string
-	//  Returns
+	//  Returns (Multiple)
 	//   PrivKey     []byte
+	//   KeyType     string
 	GetPrivateKeyForInstanceActor() string
 
 	// CreateClientInfo:
@@ -564,6 +820,22 @@ type SqlDialect interface {
 	//   RefrCreated time.Time
 	//   RefrExpires time.Duration
 	GetTokenInfoByRefresh() string
+	// GetAuthorizationsForUser:
+	//  Params
+	//   UserID      string
+	//  Returns
+	//   ClientID    string
+	//   Domain      string
+	//   Scope       string
+	//   Created     time.Time
+	//   Tokens      int
+	GetAuthorizationsForUser() string
+	// RemoveTokenInfosForUserClient:
+	//  Params
+	//   UserID      string
+	//   ClientID    string
+	//  Returns
+	RemoveTokenInfosForUserClient() string
 
 	// InsertFollowers:
 	//  Params
@@ -620,6 +892,12 @@ type SqlDialect interface {
 	//  Returns
 	//   Followers   []byte
 	GetAllFollowersForActor() string
+	// CountFollowers:
+	//  Params
+	//   Followers   string
+	//  Returns
+	//   TotalItems  int
+	CountFollowers() string
 
 	// InsertFollowing:
 	//  Params
@@ -676,6 +954,18 @@ type SqlDialect interface {
 	//  Returns
 	//   Following   []byte
 	GetAllFollowingForActor() string
+	// CountFollowing:
+	//  Params
+	//   Following   string
+	//  Returns
+	//   TotalItems  int
+	CountFollowing() string
+	// GetActorsFollowing:
+	//  Params
+	//   Item        string
+	//  Returns (Multiple)
+	//   ActorID     string
+	GetActorsFollowing() string
 
 	// InsertLiked:
 	//  Params
@@ -732,6 +1022,234 @@ type SqlDialect interface {
 	//  Returns
 	//   Liked       []byte
 	GetAllLikedForActor() string
+	// CountLiked:
+	//  Params
+	//   Liked       string
+	//  Returns
+	//   TotalItems  int
+	CountLiked() string
+
+	// InsertFeaturedTags:
+	//  Params
+	//   ActorID     string
+	//   Featured    []byte
+	//  Returns
+	InsertFeaturedTags() string
+	// FeaturedTagsExists:
+	//  Params
+	//   Featured    string
+	//  Returns
+	//   Exists      bool
+	FeaturedTagsExists() string
+	// FeaturedTagsContains:
+	//  Params
+	//   Featured    string
+	//   Href        string
+	//  Returns
+	//   Contains    bool
+	FeaturedTagsContains() string
+	// GetFeaturedTags:
+	//  Params
+	//   Featured    string
+	//   Min         int
+	//   Max         int
+	//  Returns
+	//   Page        []byte
+	//   IsEnd       bool
+	GetFeaturedTags() string
+	// GetFeaturedTagsLastPage:
+	//  Params
+	//   Featured    string
+	//   N           int
+	//  Returns
+	//   Page        []byte
+	//   StartIndex  int
+	GetFeaturedTagsLastPage() string
+	// PrependFeaturedTagsItem:
+	//  Params
+	//   Featured    string
+	//   Href        string
+	//   Name        string
+	//  Returns
+	PrependFeaturedTagsItem() string
+	// DeleteFeaturedTagsItem:
+	//  Params
+	//   Featured    string
+	//   Href        string
+	//  Returns
+	DeleteFeaturedTagsItem() string
+	// CountFeaturedTags:
+	//  Params
+	//   Featured    string
+	//  Returns
+	//   TotalItems  int
+	CountFeaturedTags() string
+
+	// InsertFeatured:
+	//  Params
+	//   ActorID     string
+	//   Featured    []byte
+	//  Returns
+	InsertFeatured() string
+	// FeaturedContains:
+	//  Params
+	//   Featured    string
+	//   Item        string
+	//  Returns
+	//   Contains    bool
+	FeaturedContains() string
+	// GetFeatured:
+	//  Params
+	//   Featured    string
+	//   Min         int
+	//   Max         int
+	//  Returns
+	//   Page        []byte
+	//   IsEnd       bool
+	GetFeatured() string
+	// GetFeaturedLastPage:
+	//  Params
+	//   Featured    string
+	//   N           int
+	//  Returns
+	//   Page        []byte
+	//   StartIndex  int
+	GetFeaturedLastPage() string
+	// PrependFeaturedItem prepends the item only if the featured collection
+	// does not already contain it and has fewer than Max items.
+	//  Params
+	//   Featured    string
+	//   Item        string
+	//   Max         int
+	//  Returns
+	PrependFeaturedItem() string
+	// DeleteFeaturedItem:
+	//  Params
+	//   Featured    string
+	//   Item        string
+	//  Returns
+	DeleteFeaturedItem() string
+	// CountFeatured:
+	//  Params
+	//   Featured    string
+	//  Returns
+	//   TotalItems  int
+	CountFeatured() string
+
+	// InsertShares:
+	//  Params
+	//   ObjectID    string
+	//   Shares      []byte
+	//  Returns
+	InsertShares() string
+	// SharesExists:
+	//  Params
+	//   Shares      string
+	//  Returns
+	//   Exists      bool
+	SharesExists() string
+	// SharesContains:
+	//  Params
+	//   Shares      string
+	//   Item        string
+	//  Returns
+	//   Contains    bool
+	SharesContains() string
+	// GetShares:
+	//  Params
+	//   Shares      string
+	//   Min         int
+	//   Max         int
+	//  Returns
+	//   Page        []byte
+	//   IsEnd       bool
+	GetShares() string
+	// GetSharesLastPage:
+	//  Params
+	//   Shares      string
+	//   N           int
+	//  Returns
+	//   Page        []byte
+	//   StartIndex  int
+	GetSharesLastPage() string
+	// PrependSharesItem:
+	//  Params
+	//   Shares      string
+	//   Item        string
+	//  Returns
+	PrependSharesItem() string
+	// DeleteSharesItem:
+	//  Params
+	//   Shares      string
+	//   Item        string
+	//  Returns
+	DeleteSharesItem() string
+	// CountShares:
+	//  Params
+	//   Shares      string
+	//  Returns
+	//   TotalItems  int
+	CountShares() string
+
+	// InsertReplies:
+	//  Params
+	//   ObjectID    string
+	//   Replies     []byte
+	//  Returns
+	InsertReplies() string
+	// RepliesExists:
+	//  Params
+	//   Replies     string
+	//  Returns
+	//   Exists      bool
+	RepliesExists() string
+	// RepliesContains:
+	//  Params
+	//   Replies     string
+	//   Item        string
+	//  Returns
+	//   Contains    bool
+	RepliesContains() string
+	// GetReplies:
+	//  Params
+	//   Replies     string
+	//   Min         int
+	//   Max         int
+	//  Returns
+	//   Page        []byte
+	//   IsEnd       bool
+	GetReplies() string
+	// GetPublicReplies:
+	//  Params
+	//   Replies     string
+	//   Min         int
+	//   Max         int
+	//  Returns
+	//   Page        []byte
+	//   IsEnd       bool
+	GetPublicReplies() string
+	// GetRepliesLastPage:
+	//  Params
+	//   Replies     string
+	//   N           int
+	//  Returns
+	//   Page        []byte
+	//   StartIndex  int
+	GetRepliesLastPage() string
+	// GetPublicRepliesLastPage:
+	//  Params
+	//   Replies     string
+	//   N           int
+	//  Returns
+	//   Page        []byte
+	//   StartIndex  int
+	GetPublicRepliesLastPage() string
+	// PrependRepliesItem:
+	//  Params
+	//   Replies     string
+	//   Item        string
+	//  Returns
+	PrependRepliesItem() string
 
 	// CreatePolicy:
 	//  Params
@@ -757,6 +1275,12 @@ type SqlDialect interface {
 	//   ID          string
 	//   Payload     []byte
 	GetPoliciesForActorAndPurpose() string
+	// DeletePolicy:
+	//  Params
+	//   ID          string
+	//   ActorID     string
+	//  Returns
+	DeletePolicy() string
 
 	// CreateResolution:
 	//  Params
@@ -836,4 +1360,478 @@ type SqlDialect interface {
 	//  Returns (Multiple)
 	//   Payload     []byte
 	GetOpenFollowRequests() string
+
+	// GetFollowReceivedFrom
+	//  Params
+	//   ID          string
+	//   Follower    string
+	//  Returns (Zero or One)
+	//   Payload     []byte
+	GetFollowReceivedFrom() string
+
+	// GetPendingFollows
+	//  Params
+	//   ID          string
+	//  Returns (Multiple)
+	//   Payload     []byte
+	GetPendingFollows() string
+
+	// DropIdempotencyKeysActivityIDNotNull allows keys to be reserved
+	// before their activity is known in tables created by older versions.
+	DropIdempotencyKeysActivityIDNotNull() string
+	// InsertIdempotencyKey inserts nothing if the key was already used.
+	//  Params
+	//   OutboxID    string
+	//   Key         string
+	//  Returns
+	InsertIdempotencyKey() string
+	// SetIdempotencyKeyActivity:
+	//  Params
+	//   OutboxID    string
+	//   Key         string
+	//   ActivityID  string
+	//  Returns
+	SetIdempotencyKeyActivity() string
+	// DeleteIdempotencyKey deletes the key only if it has no activity.
+	//  Params
+	//   OutboxID    string
+	//   Key         string
+	//  Returns
+	DeleteIdempotencyKey() string
+	// GetIdempotencyKeyActivity:
+	//  Params
+	//   OutboxID    string
+	//   Key         string
+	//  Returns
+	//   ActivityID  sql.NullString
+	GetIdempotencyKeyActivity() string
+
+	// SampleInboxesDrift:
+	//  Params
+	//   N           int, or NULL to check every collection
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleInboxesDrift() string
+	// RepairInboxesTotalItems:
+	//  Params
+	//   Inbox       string
+	//  Returns
+	RepairInboxesTotalItems() string
+	// SampleOutboxesDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleOutboxesDrift() string
+	// RepairOutboxesTotalItems:
+	//  Params
+	//   Outbox      string
+	//  Returns
+	RepairOutboxesTotalItems() string
+	// SampleFollowersDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleFollowersDrift() string
+	// RepairFollowersTotalItems:
+	//  Params
+	//   Followers   string
+	//  Returns
+	RepairFollowersTotalItems() string
+	// SampleFollowingDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleFollowingDrift() string
+	// RepairFollowingTotalItems:
+	//  Params
+	//   Following   string
+	//  Returns
+	RepairFollowingTotalItems() string
+	// SampleLikedDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleLikedDrift() string
+	// RepairLikedTotalItems:
+	//  Params
+	//   Liked       string
+	//  Returns
+	RepairLikedTotalItems() string
+	// SampleFeaturedTagsDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleFeaturedTagsDrift() string
+	// RepairFeaturedTagsTotalItems:
+	//  Params
+	//   Featured    string
+	//  Returns
+	RepairFeaturedTagsTotalItems() string
+	// SampleFeaturedDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleFeaturedDrift() string
+	// RepairFeaturedTotalItems:
+	//  Params
+	//   Featured    string
+	//  Returns
+	RepairFeaturedTotalItems() string
+
+	// SampleSharesDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleSharesDrift() string
+	// RepairSharesTotalItems:
+	//  Params
+	//   Shares      string
+	//  Returns
+	RepairSharesTotalItems() string
+	// SampleRepliesDrift:
+	//  Params
+	//   N           int
+	//  Returns (Multiple)
+	//   ID          string
+	//   Stored      int
+	//   Actual      int
+	SampleRepliesDrift() string
+	// RepairRepliesTotalItems:
+	//  Params
+	//   Replies     string
+	//  Returns
+	RepairRepliesTotalItems() string
+
+	// ActorsMissingInboxes:
+	//  Params
+	//  Returns (Multiple)
+	//   ActorID     string
+	ActorsMissingInboxes() string
+
+	// ActorsMissingOutboxes:
+	//  Params
+	//  Returns (Multiple)
+	//   ActorID     string
+	ActorsMissingOutboxes() string
+
+	// ActorsMissingFollowers:
+	//  Params
+	//  Returns (Multiple)
+	//   ActorID     string
+	ActorsMissingFollowers() string
+
+	// ActorsMissingFollowing:
+	//  Params
+	//  Returns (Multiple)
+	//   ActorID     string
+	ActorsMissingFollowing() string
+
+	// ActorsMissingLiked:
+	//  Params
+	//  Returns (Multiple)
+	//   ActorID     string
+	ActorsMissingLiked() string
+
+	// ActorsMissingFeaturedTags:
+	//  Params
+	//  Returns (Multiple)
+	//   ActorID     string
+	ActorsMissingFeaturedTags() string
+
+	// ActorsMissingFeatured:
+	//  Params
+	//  Returns (Multiple)
+	//   ActorID     string
+	ActorsMissingFeatured() string
+
+	// InsertMedia:
+	//  Params
+	//   UserID      string
+	//   ContentType string
+	//   Size        int64
+	//   Path        string
+	//  Returns
+	//   ID          string
+	InsertMedia() string
+	// GetMedia:
+	//  Params
+	//   ID          string
+	//  Returns
+	//   UserID      string
+	//   ContentType string
+	//   Size        int64
+	//   Path        string
+	GetMedia() string
+	// InsertMediaThumbnail:
+	//  Params
+	//   MediaID     string
+	//   MaxDim      int
+	//   ContentType string
+	//   Size        int64
+	//   Path        string
+	//  Returns
+	InsertMediaThumbnail() string
+	// GetMediaThumbnail:
+	//  Params
+	//   MediaID     string
+	//   MaxDim      int
+	//  Returns
+	//   ContentType string
+	//   Size        int64
+	//   Path        string
+	GetMediaThumbnail() string
+	// InsertAllowedDomain:
+	//  Params
+	//   Domain      string
+	//  Returns
+	InsertAllowedDomain() string
+	// DeleteAllowedDomain:
+	//  Params
+	//   Domain      string
+	//  Returns
+	DeleteAllowedDomain() string
+	// ContainsAllowedDomain:
+	//  Params
+	//   Domain      string
+	//  Returns
+	//   Contains    bool
+	ContainsAllowedDomain() string
+	// InsertBlockedDomain:
+	//  Params
+	//   Domain      string
+	//  Returns
+	InsertBlockedDomain() string
+	// DeleteBlockedDomain:
+	//  Params
+	//   Domain      string
+	//  Returns
+	DeleteBlockedDomain() string
+	// ContainsBlockedDomain:
+	//  Params
+	//   Domain      string
+	//  Returns
+	//   Contains    bool
+	ContainsBlockedDomain() string
+	// UpsertEmoji:
+	//  Params
+	//   Shortcode   string
+	//   ImageIRI    *url.URL
+	//   MediaType   string
+	//  Returns
+	UpsertEmoji() string
+	// DeleteEmoji:
+	//  Params
+	//   Shortcode   string
+	//  Returns
+	DeleteEmoji() string
+	// GetEmoji:
+	//  Params
+	//   Shortcode   string
+	//  Returns
+	//   ImageIRI    *url.URL
+	//   MediaType   string
+	//   Updated     time.Time
+	GetEmoji() string
+	// GetAllEmoji:
+	//  Params
+	//  Returns
+	//   Shortcode   string
+	//   ImageIRI    *url.URL
+	//   MediaType   string
+	//   Updated     time.Time
+	GetAllEmoji() string
+	// InsertInvite:
+	//  Params
+	//   Code        string
+	//   CreatedBy   string
+	//   MaxUses     int
+	//   Expires     *time.Time
+	//  Returns
+	InsertInvite() string
+	// ConsumeInvite:
+	//  Params
+	//   Code        string
+	//  Returns
+	ConsumeInvite() string
+	// ReleaseInvite:
+	//  Params
+	//   Code        string
+	//  Returns
+	ReleaseInvite() string
+	// GetAllInvites:
+	//  Params
+	//  Returns
+	//   Code        string
+	//   CreatedBy   string
+	//   Created     time.Time
+	//   MaxUses     int
+	//   Remaining   int
+	//   Expires     *time.Time
+	GetAllInvites() string
+	// InsertReport:
+	//  Params
+	//   ActivityID  *url.URL
+	//   Reporter    *url.URL
+	//   Objects     URLs
+	//   Comment     string
+	//  Returns
+	InsertReport() string
+	// GetReportsByStatus:
+	//  Params
+	//   Status      string
+	//  Returns
+	//   ID          string
+	//   Created     time.Time
+	//   ActivityID  *url.URL
+	//   Reporter    *url.URL
+	//   Objects     URLs
+	//   Comment     string
+	//   Status      string
+	//   ResolvedBy  *string
+	//   Resolved    *time.Time
+	GetReportsByStatus() string
+	// ResolveReport:
+	//  Params
+	//   ID          string
+	//   ResolvedBy  string
+	//  Returns
+	ResolveReport() string
+	// InsertRelay:
+	//  Params
+	//   Inbox       *url.URL
+	//   FollowID    *url.URL
+	//   State       string
+	//  Returns
+	InsertRelay() string
+	// AcceptRelay:
+	//  Params
+	//   FollowID    *url.URL
+	//   Actor       *url.URL
+	//   State       string
+	//  Returns
+	AcceptRelay() string
+	// ContainsAcceptedRelay:
+	//  Params
+	//   Actor       *url.URL
+	//   State       string
+	//  Returns
+	//   Contains    bool
+	ContainsAcceptedRelay() string
+	// GetRelay:
+	//  Params
+	//   Inbox       *url.URL
+	//  Returns
+	//   ID          string
+	//   Created     time.Time
+	//   Inbox       *url.URL
+	//   FollowID    *url.URL
+	//   Actor       sql.NullString
+	//   State       string
+	GetRelay() string
+	// GetRelayByFollow:
+	//  Params
+	//   FollowID    *url.URL
+	//  Returns
+	//   ID          string
+	//   Created     time.Time
+	//   Inbox       *url.URL
+	//   FollowID    *url.URL
+	//   Actor       sql.NullString
+	//   State       string
+	GetRelayByFollow() string
+	// GetAllRelays:
+	//  Params
+	//  Returns (Multiple)
+	//   ID          string
+	//   Created     time.Time
+	//   Inbox       *url.URL
+	//   FollowID    *url.URL
+	//   Actor       sql.NullString
+	//   State       string
+	GetAllRelays() string
+	// DeleteRelay:
+	//  Params
+	//   Inbox       *url.URL
+	//  Returns
+	DeleteRelay() string
+	// InsertInboxProcessed:
+	//  Params
+	//   InboxID     string
+	//   ActivityID  string
+	//  Returns
+	InsertInboxProcessed() string
+	// DeleteInboxProcessed:
+	//  Params
+	//   InboxID     string
+	//   ActivityID  string
+	//  Returns
+	DeleteInboxProcessed() string
+	// PruneInboxProcessed:
+	//  Params
+	//   Before      time.Time
+	//  Returns
+	PruneInboxProcessed() string
+	// InsertBlock:
+	//  Params
+	//   ActorID     string
+	//   BlockedID   string
+	//   ActivityID  sql.NullString
+	//  Returns
+	InsertBlock() string
+	// DeleteBlock:
+	//  Params
+	//   ActorID     string
+	//   BlockedID   string
+	//  Returns
+	DeleteBlock() string
+	// ContainsBlock:
+	//  Params
+	//   ActorID     string
+	//   BlockedID   string
+	//  Returns
+	//   Contains    bool
+	ContainsBlock() string
+	// GetBlockActivity:
+	//  Params
+	//   ActorID     string
+	//   BlockedID   string
+	//  Returns
+	//   ActivityID  sql.NullString
+	GetBlockActivity() string
+	// UpsertSharedInbox:
+	//  Params
+	//   Inbox       string
+	//   SharedInbox string
+	//  Returns
+	UpsertSharedInbox() string
+	// GetSharedInboxes:
+	//  Params
+	//   Inboxes     []byte
+	//  Returns (Multiple)
+	//   Inbox       string
+	//   SharedInbox string
+	GetSharedInboxes() string
 }
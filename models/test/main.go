@@ -18,21 +18,34 @@ package main
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/framework/config"
 	"github.com/go-fed/apcore/framework/db"
 	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/services"
 	"github.com/go-fed/apcore/util"
+	"github.com/go-fed/httpsig"
 	"github.com/go-fed/oauth2"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"golang.org/x/crypto/ed25519"
 )
 
 var dburl = flag.String("db", "", "database url to connect to")
@@ -51,8 +64,23 @@ var credentials = &models.Credentials{}
 var following = &models.Following{}
 var followers = &models.Followers{}
 var liked = &models.Liked{}
+var featuredTags = &models.FeaturedTags{}
+var featured = &models.Featured{}
+var shares = &models.Shares{}
+var replies = &models.Replies{}
 var policies = &models.Policies{}
 var resolutions = &models.Resolutions{}
+var idempotencyKeys = &models.IdempotencyKeys{}
+var collectionDrift = &models.CollectionDrift{}
+var media = &models.Media{}
+var domains = &models.Domains{}
+var emoji = &models.Emoji{}
+var invites = &models.Invites{}
+var reports = &models.Reports{}
+var inboxProcessed = &models.InboxProcessed{}
+var blocks = &models.Blocks{}
+var relays = &models.Relays{}
+var sharedInboxes = &models.SharedInboxes{}
 var testModels []models.Model
 
 func init() {
@@ -70,8 +98,23 @@ func init() {
 		following,
 		followers,
 		liked,
+		featuredTags,
+		featured,
+		shares,
+		replies,
 		policies,
 		resolutions,
+		idempotencyKeys,
+		collectionDrift,
+		media,
+		domains,
+		emoji,
+		invites,
+		reports,
+		inboxProcessed,
+		blocks,
+		relays,
+		sharedInboxes,
 	}
 }
 
@@ -94,6 +137,10 @@ func main() {
 	if err = createTables(ctx, db, d); err != nil {
 		panic(err)
 	}
+	fmt.Println("Preparing malformed statements...")
+	if err = prepareMalformedStatements(ctx, db, d); err != nil {
+		panic(err)
+	}
 	fmt.Println("Preparing statements...")
 	if err = prepareStatements(ctx, db, d); err != nil {
 		panic(err)
@@ -110,6 +157,10 @@ func main() {
 	if err = runLocalDataCalls(ctx, db); err != nil {
 		panic(err)
 	}
+	fmt.Println("Running public timeline calls...")
+	if err = runPublicTimelineCalls(ctx, db); err != nil {
+		panic(err)
+	}
 	fmt.Println("Running Inboxes calls...")
 	if err = runInboxesCalls(ctx, db); err != nil {
 		panic(err)
@@ -151,6 +202,22 @@ func main() {
 	if err = runLikedCalls(ctx, db); err != nil {
 		panic(err)
 	}
+	fmt.Println("Running FeaturedTags calls...")
+	if err = runFeaturedTagsCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Featured calls...")
+	if err = runFeaturedCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Shares calls...")
+	if err = runSharesCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Replies calls...")
+	if err = runRepliesCalls(ctx, db); err != nil {
+		panic(err)
+	}
 	fmt.Println("Running Policies calls...")
 	policyID, err := runPoliciesCalls(ctx, db)
 	if err != nil {
@@ -160,6 +227,74 @@ func main() {
 	if err = runResolutionsCalls(ctx, db, policyID); err != nil {
 		panic(err)
 	}
+	fmt.Println("Running IdempotencyKeys calls...")
+	if err = runIdempotencyKeysCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running CollectionDrift calls...")
+	if err = runCollectionDriftCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Media calls...")
+	if err = runMediaCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Domains calls...")
+	if err = runDomainsCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Emoji calls...")
+	if err = runEmojiCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Invites calls...")
+	if err = runInvitesCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Reports calls...")
+	if err = runReportsCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running InboxProcessed calls...")
+	if err = runInboxProcessedCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Blocks calls...")
+	if err = runBlocksCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running Relays calls...")
+	if err = runRelaysCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running host alias calls...")
+	if err = runHostAliasCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running SharedInboxes calls...")
+	if err = runSharedInboxesCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running outbox retention calls...")
+	if err = runOutboxRetentionCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running WithTx calls...")
+	if err = runWithTxCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running post rate limit calls...")
+	if err = runPostRetryAfterCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running EnsureInstanceActor calls...")
+	if err = runEnsureInstanceActorCalls(ctx, db); err != nil {
+		panic(err)
+	}
+	fmt.Println("Running statement timeout calls...")
+	if err = runStatementTimeoutCalls(ctx); err != nil {
+		panic(err)
+	}
 	fmt.Println("Close models...")
 	if err = closeModels(); err != nil {
 		panic(err)
@@ -167,91 +302,1889 @@ func main() {
 	fmt.Println("done")
 }
 
-/* Resolutions */
+/* EnsureInstanceActor */
 
-func runResolutionsCalls(ctx util.Context, db *sql.DB, policyID string) error {
-	if err := runResolutionsCreate(ctx, db, policyID); err != nil {
+func runEnsureInstanceActorCalls(ctx util.Context, db *sql.DB) error {
+	svc := &services.Users{
+		DB:           db,
+		Users:        users,
+		PrivateKeys:  privateKeys,
+		Inboxes:      inboxes,
+		Outboxes:     outboxes,
+		Followers:    followers,
+		Following:    following,
+		Liked:        liked,
+		FeaturedTags: featuredTags,
+		Featured:     featured,
+	}
+	// The instance actor created by the UserModel calls lost its server
+	// preferences, as if creating it had been interrupted.
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return users.SetInstanceActorPreferences(ctx, tx, models.InstanceActorPreferences{})
+	}); err != nil {
+		return err
+	}
+	p := services.ServerPreferences{
+		ServerBaseURL: "https://example.com",
+		ServerName:    testEnsuredServerName,
+	}
+	var wg sync.WaitGroup
+	var nCreated int32
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			created, err := svc.EnsureInstanceActor(ctx, "https", "example.com", 1024, p)
+			if err != nil {
+				errs <- err
+			} else if created {
+				atomic.AddInt32(&nCreated, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		return err
+	}
+	fmt.Printf("> Created: %d\n", nCreated)
+	if nCreated != 0 {
+		fmt.Println("FAIL: Expected the existing instance actor to be kept")
+	}
+	var iap models.InstanceActorPreferences
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		// There is still exactly one instance actor.
+		if _, err = users.InstanceActorUser(ctx, tx); err != nil {
+			return
+		}
+		iap, err = users.InstanceActorPreferences(ctx, tx)
+		return
+	}); err != nil {
 		return err
 	}
+	fmt.Printf("> InstanceActorPreferences: %v\n", iap)
+	if iap.ServerName != testEnsuredServerName {
+		fmt.Println("FAIL: Expected the missing server preferences to be repaired")
+	}
 	return nil
 }
 
-func runResolutionsCreate(ctx util.Context, db *sql.DB, policyID string) error {
-	cr := models.CreateResolution{
-		PolicyID: policyID,
-		IRI:      mustParse(testActivity1IRI),
-		R: models.Resolution{
-			Time:    time.Now(),
-			Matched: true,
-			MatchLog: []string{
-				"first entry",
-				"second",
-				"final line",
-			},
-		},
+/* Host aliases */
+
+func runHostAliasCalls(ctx util.Context, db *sql.DB) error {
+	data := &services.Data{
+		DB:           db,
+		Hostname:     "example.com",
+		FedData:      fedData,
+		LocalData:    localData,
+		HostAliases:  []string{"alias.example.com"},
+		HostAliasWWW: true,
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return localData.Create(ctx, tx, models.ActivityStreams{timelineNote(testAliasNoteIRI, pub.PublicActivityPubIRI)})
+	}); err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		iri  string
+		owns bool
+	}{
+		{testAliasNoteIRI, true},
+		{"https://alias.example.com/notes/alias", true},
+		{"https://WWW.Example.com/notes/alias", true},
+		{"https://www.alias.example.com/notes/alias", true},
+		{"https://other.example.com/notes/alias", false},
+	} {
+		iri := mustParse(c.iri)
+		owns := data.Owns(iri)
+		exists, err := data.Exists(ctx, iri)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> %s: owns=%v exists=%v\n", c.iri, owns, exists)
+		if owns != c.owns {
+			fmt.Printf("FAIL: Expected owns to be %v\n", c.owns)
+		}
+		if exists != c.owns {
+			fmt.Printf("FAIL: Expected exists to be %v\n", c.owns)
+		}
+		if !c.owns {
+			continue
+		}
+		v, err := data.Get(ctx, iri)
+		if err != nil {
+			return err
+		}
+		if id, err := pub.GetId(v); err != nil {
+			return err
+		} else if id.String() != testAliasNoteIRI {
+			fmt.Printf("FAIL: Expected to get %s, got %s\n", testAliasNoteIRI, id)
+		}
+	}
+	return nil
+}
+
+/* SharedInboxes */
+
+func runSharedInboxesCalls(ctx util.Context, db *sql.DB) error {
+	// One shared inbox is recorded, and changed, while the other is
+	// advertised by an actor cached as federated data.
+	for _, shared := range []string{testSharedInboxOtherIRI, testSharedInboxIRI} {
+		if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+			return sharedInboxes.Upsert(ctx, tx, mustParse(testSharedInboxActor1InboxIRI), mustParse(shared))
+		}); err != nil {
+			return err
+		}
+	}
+	actor := streams.NewActivityStreamsPerson()
+	idP := streams.NewJSONLDIdProperty()
+	idP.Set(mustParse(testSharedInboxActor2IRI))
+	actor.SetJSONLDId(idP)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(mustParse(testSharedInboxActor2InboxIRI))
+	actor.SetActivityStreamsInbox(inbox)
+	actor.GetUnknownProperties()["endpoints"] = map[string]interface{}{
+		"sharedInbox": testSharedInboxIRI,
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return fedData.Create(ctx, tx, models.ActivityStreams{actor})
+	}); err != nil {
+		return err
+	}
+	var si []models.SharedInbox
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		si, err = sharedInboxes.Get(ctx, tx, []*url.URL{
+			mustParse(testSharedInboxActor1InboxIRI),
+			mustParse(testSharedInboxActor2InboxIRI),
+			mustParse(testSharedInboxActor3InboxIRI),
+		})
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Get: %v\n", si)
+	got := make(map[string]string, len(si))
+	for _, v := range si {
+		got[v.Inbox.String()] = v.SharedInbox.String()
+	}
+	if len(got) != 2 {
+		fmt.Printf("FAIL: Expected 2 shared inboxes, got %d\n", len(got))
+	}
+	for _, inbox := range []string{testSharedInboxActor1InboxIRI, testSharedInboxActor2InboxIRI} {
+		if got[inbox] != testSharedInboxIRI {
+			fmt.Printf("FAIL: Expected the shared inbox of %s to be %s, got %q\n", inbox, testSharedInboxIRI, got[inbox])
+		}
+	}
+	return nil
+}
+
+/* Blocks */
+
+func runBlocksCalls(ctx util.Context, db *sql.DB) error {
+	actor := mustParse(testActor3IRI)
+	blocked := mustParse(testActor2IRI)
+	// Blocking twice is not an error, and keeps the Block activity.
+	for _, activity := range []*url.URL{mustParse(testActivity1IRI), nil} {
+		if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+			return blocks.Add(ctx, tx, actor, blocked, activity)
+		}); err != nil {
+			return err
+		}
+	}
+	b, err := runBlocksContains(ctx, db, actor, blocked)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Contains: %v\n", b)
+	if !b {
+		fmt.Println("FAIL: Expected the blocked actor")
+	}
+	// Activities are only dropped from the blocking actor's inbox.
+	if b, err = runBlocksContains(ctx, db, blocked, actor); err != nil {
+		return err
+	}
+	fmt.Printf("> Contains (reversed): %v\n", b)
+	if b {
+		fmt.Println("FAIL: Expected the block to only apply to the blocking actor")
+	}
+	// Blocking removes the blocked actor from the followers, as done by the
+	// Blocks service.
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		has, err := followers.ContainsForActor(ctx, tx, actor, blocked)
+		if err != nil || !has {
+			return err
+		}
+		return followers.DeleteItem(ctx, tx, mustParse(testActor3FollowersIRI), blocked)
+	}); err != nil {
+		return err
+	}
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = followers.ContainsForActor(ctx, tx, actor, blocked)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Followers ContainsForActor: %v\n", b)
+	if b {
+		fmt.Println("FAIL: Expected the blocked actor to no longer be a follower")
+	}
+	var activity *url.URL
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		activity, err = blocks.ActivityFor(ctx, tx, actor, blocked)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> ActivityFor: %v\n", activity)
+	if activity == nil || activity.String() != testActivity1IRI {
+		fmt.Println("FAIL: Expected the Block activity to be kept")
+	}
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return blocks.Remove(ctx, tx, actor, blocked)
+	}); err != nil {
+		return err
+	}
+	fmt.Println("> Remove")
+	if b, err = runBlocksContains(ctx, db, actor, blocked); err != nil {
+		return err
+	}
+	fmt.Printf("> Contains: %v\n", b)
+	if b {
+		fmt.Println("FAIL: Expected the unblocked actor to be absent")
+	}
+	return nil
+}
+
+func runBlocksContains(ctx util.Context, db *sql.DB, actor, blocked *url.URL) (b bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = blocks.Contains(ctx, tx, actor, blocked)
+		return err
+	})
+	return
+}
+
+/* InboxProcessed */
+
+func runInboxProcessedCalls(ctx util.Context, db *sql.DB) error {
+	// Only the first of concurrent deliveries reserves the activity.
+	for i, expect := range []bool{true, false} {
+		reserved, err := runInboxProcessedReserve(ctx, db, testActivity1IRI)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> Reserve[%d](%s): %v\n", i, testActivity1IRI, reserved)
+		if reserved != expect {
+			fmt.Printf("FAIL: Expected the reservation to be %v\n", expect)
+		}
+	}
+	// A released activity is processed again when redelivered.
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return inboxProcessed.Release(ctx, tx, mustParse(testActor1InboxIRI), mustParse(testActivity1IRI))
+	}); err != nil {
+		return err
+	}
+	reserved, err := runInboxProcessedReserve(ctx, db, testActivity1IRI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Reserve after Release(%s): %v\n", testActivity1IRI, reserved)
+	if !reserved {
+		fmt.Println("FAIL: Expected a released activity to be reserved again")
+	}
+	if reserved, err = runInboxProcessedReserve(ctx, db, testActivity2IRI); err != nil {
+		return err
+	}
+	var n int64
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		n, err = inboxProcessed.Prune(ctx, tx, time.Now().Add(time.Minute))
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Prune: %d\n", n)
+	if n != 2 {
+		fmt.Println("FAIL: Expected both processed activities to be pruned")
+	}
+	if reserved, err = runInboxProcessedReserve(ctx, db, testActivity1IRI); err != nil {
+		return err
+	} else if !reserved {
+		fmt.Println("FAIL: Expected a pruned activity to be reserved again")
+	}
+	return nil
+}
+
+func runInboxProcessedReserve(ctx util.Context, db *sql.DB, activity string) (reserved bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		reserved, err = inboxProcessed.Reserve(ctx, tx, mustParse(testActor1InboxIRI), mustParse(activity))
+		return err
+	})
+	return
+}
+
+/* Relays */
+
+func runRelaysCalls(ctx util.Context, db *sql.DB) error {
+	inbox := mustParse(testRelayInboxIRI)
+	actor := mustParse(testRelayActorIRI)
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return relays.Create(ctx, tx, inbox, mustParse(testRelayFollowIRI))
+	}); err != nil {
+		return err
+	}
+	if err := runRelaysExpect(ctx, db, models.RelayStatePending, false); err != nil {
+		return err
+	}
+	var ok bool
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		ok, err = relays.Accept(ctx, tx, mustParse(testRelayFollowIRI), actor)
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Accept: %v\n", ok)
+	if !ok {
+		fmt.Println("FAIL: Expected the relay to accept the Follow")
+	}
+	if err := runRelaysExpect(ctx, db, models.RelayStateAccepted, true); err != nil {
+		return err
 	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return relays.Delete(ctx, tx, inbox)
+	}); err != nil {
+		return err
+	}
+	return runRelaysExpect(ctx, db, "", false)
+}
+
+// runRelaysExpect checks the state of the test relay's subscription, where an
+// empty state expects there to be none, and whether its actor is accepted.
+func runRelaysExpect(ctx util.Context, db *sql.DB, state string, accepted bool) error {
 	return doWithTx(ctx, db, func(tx *sql.Tx) error {
-		return resolutions.Create(ctx, tx, cr)
+		rl, err := relays.Get(ctx, tx, mustParse(testRelayInboxIRI))
+		if errors.Is(err, models.ErrNotFound) {
+			rl.State = ""
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("> Get: %v\n", rl)
+		if rl.State != state {
+			fmt.Printf("FAIL: Expected the relay to be %q\n", state)
+		}
+		contains, err := relays.ContainsAccepted(ctx, tx, mustParse(testRelayActorIRI))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> ContainsAccepted: %v\n", contains)
+		if contains != accepted {
+			fmt.Printf("FAIL: Expected ContainsAccepted to be %v\n", accepted)
+		}
+		return nil
 	})
 }
 
-/* Policies */
+/* Outbox Retention */
 
-func runPoliciesCalls(ctx util.Context, db *sql.DB) (policyID string, err error) {
-	policyID, err = runPoliciesCreate(ctx, db)
+func runOutboxRetentionCalls(ctx util.Context, db *sql.DB) error {
+	svc := &services.Outboxes{
+		DB:        db,
+		Outboxes:  outboxes,
+		LocalData: localData,
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for _, id := range []string{testRetentionArchivedIRI, testRetentionTombstonedIRI, testRetentionNewIRI} {
+			create := retentionCreate(id)
+			if err := localData.Create(ctx, tx, models.ActivityStreams{create}); err != nil {
+				return err
+			}
+			if err := localData.Create(ctx, tx, models.ActivityStreams{create.GetActivityStreamsObject().At(0).GetActivityStreamsNote()}); err != nil {
+				return err
+			}
+		}
+		// The archived Create is in the outboxes of both actors.
+		if err := outboxes.Create(ctx, tx, mustParse(testRetentionActorIRI), retentionOutbox(testRetentionOutboxIRI, testRetentionNewIRI, testRetentionTombstonedIRI, testRetentionArchivedIRI)); err != nil {
+			return err
+		}
+		if err := outboxes.Create(ctx, tx, mustParse(testRetentionOtherActorIRI), retentionOutbox(testRetentionOtherOutboxIRI, testRetentionArchivedIRI)); err != nil {
+			return err
+		}
+		for id, age := range map[string]string{
+			testRetentionArchivedIRI:   "30 days",
+			testRetentionTombstonedIRI: "20 days",
+		} {
+			if _, err := tx.ExecContext(ctx, `UPDATE `+*schema+`.local_data
+SET create_time = current_timestamp - $2::interval
+WHERE payload->>'id' IN ($1, $1 || '/note')`, id, age); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	policy := services.RetentionPolicy{
+		MaxAge:    24 * time.Hour,
+		DryRun:    true,
+		BatchSize: 10,
+	}
+	expired, err := svc.Expire(ctx, time.Now(), policy)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Expire (dry run): %v\n", expired)
+	if len(expired) != 3 || expired[0].Item.String() != testRetentionArchivedIRI || expired[2].Item.String() != testRetentionTombstonedIRI {
+		fmt.Println("FAIL: Expected the archived Create in both outboxes, then the tombstoned Create")
+	} else if expired[0].Object == nil || expired[0].Object.String() != testRetentionArchivedIRI+"/note" {
+		fmt.Println("FAIL: Expected the note of the archived Create")
+	}
+	if err := runOutboxRetentionCheck(ctx, db, "dry run", map[string]int{testRetentionOutboxIRI: 3, testRetentionOtherOutboxIRI: 1}, nil, nil); err != nil {
+		return err
+	}
+	// The batch holds both outbox items of the archived Create, which is
+	// only archived and tombstoned once.
+	policy.DryRun = false
+	policy.BatchSize = 2
+	if expired, err = svc.Expire(ctx, time.Now(), policy); err != nil {
+		return err
+	}
+	fmt.Printf("> Expire (archive): %v\n", expired)
+	if len(expired) != 2 || expired[0].Item.String() != testRetentionArchivedIRI || expired[1].Item.String() != testRetentionArchivedIRI {
+		fmt.Println("FAIL: Expected the archived Create in both outboxes")
+	}
+	if err := runOutboxRetentionCheck(ctx, db, "archive",
+		map[string]int{testRetentionOutboxIRI: 2, testRetentionOtherOutboxIRI: 0},
+		[]string{testRetentionArchivedIRI, testRetentionArchivedIRI + "/note"},
+		[]string{testRetentionArchivedIRI, testRetentionArchivedIRI + "/note"}); err != nil {
+		return err
+	}
+	policy.Tombstone = true
+	policy.BatchSize = 10
+	if expired, err = svc.Expire(ctx, time.Now(), policy); err != nil {
+		return err
+	}
+	fmt.Printf("> Expire (tombstone): %v\n", expired)
+	if len(expired) != 1 || expired[0].Item.String() != testRetentionTombstonedIRI {
+		fmt.Println("FAIL: Expected the tombstoned Create")
+	}
+	if err := runOutboxRetentionCheck(ctx, db, "tombstone",
+		map[string]int{testRetentionOutboxIRI: 1, testRetentionOtherOutboxIRI: 0},
+		[]string{testRetentionArchivedIRI, testRetentionArchivedIRI + "/note", testRetentionTombstonedIRI, testRetentionTombstonedIRI + "/note"},
+		[]string{testRetentionArchivedIRI, testRetentionArchivedIRI + "/note"}); err != nil {
+		return err
+	}
+	if expired, err = svc.Expire(ctx, time.Now(), policy); err != nil {
+		return err
+	}
+	fmt.Printf("> Expire (again): %v\n", expired)
+	if len(expired) != 0 {
+		fmt.Println("FAIL: Expected no more expired items")
+	}
+	return nil
+}
+
+// runOutboxRetentionCheck checks the number of items in the outboxes, that only
+// the tombstoned IRIs are Tombstones, and the number of archived IRIs.
+func runOutboxRetentionCheck(ctx util.Context, db *sql.DB, name string, totalItems map[string]int, tombstoned, archived []string) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for id, n := range totalItems {
+			p, _, err := outboxes.GetPage(ctx, tx, mustParse(id), 0, 10)
+			if err != nil {
+				return err
+			}
+			if t := p.GetActivityStreamsTotalItems(); t == nil || t.Get() != n {
+				fmt.Printf("FAIL: Expected totalItems of %d in %s after %s\n", n, id, name)
+			}
+		}
+		isTombstoned := make(map[string]bool, len(tombstoned))
+		for _, iri := range tombstoned {
+			isTombstoned[iri] = true
+		}
+		for _, id := range []string{testRetentionArchivedIRI, testRetentionTombstonedIRI, testRetentionNewIRI} {
+			for _, iri := range []string{id, id + "/note"} {
+				v, err := localData.Get(ctx, tx, mustParse(iri))
+				if err != nil {
+					return err
+				}
+				if (v.GetTypeName() == "Tombstone") != isTombstoned[iri] {
+					fmt.Printf("FAIL: Expected %s to be a Tombstone after %s: %v\n", iri, name, isTombstoned[iri])
+				}
+			}
+		}
+		var nArchived int
+		if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM `+*schema+`.local_data_archive
+WHERE payload->>'id' LIKE 'https://example.com/activities/retention-%'`).Scan(&nArchived); err != nil {
+			return err
+		}
+		fmt.Printf("> Archived after %s: %d\n", name, nArchived)
+		if nArchived != len(archived) {
+			fmt.Printf("FAIL: Expected %d archived\n", len(archived))
+		}
+		return nil
+	})
+}
+
+/* WithTx */
+
+func runWithTxCalls(ctx util.Context, db *sql.DB) error {
+	errNested := errors.New("nested failure")
+	var leaked util.Context
+	committed := make(map[string]bool)
+	if err := services.WithTx(ctx, db, func(c util.Context, tx *sql.Tx) error {
+		leaked = c
+		if err := localData.Create(c, tx, models.ActivityStreams{timelineNote(testTxOuterIRI, pub.PublicActivityPubIRI)}); err != nil {
+			return err
+		}
+		services.AfterCommit(c, func() { committed["outer"] = true })
+		// A failed nested call only rolls back its own changes.
+		err := services.WithTx(c, db, func(c util.Context, tx *sql.Tx) error {
+			if err := localData.Create(c, tx, models.ActivityStreams{timelineNote(testTxFailedIRI, pub.PublicActivityPubIRI)}); err != nil {
+				return err
+			}
+			services.AfterCommit(c, func() { committed["failed"] = true })
+			return errNested
+		})
+		fmt.Printf("> WithTx (nested failure): %v\n", err)
+		if err != errNested {
+			fmt.Println("FAIL: Expected the nested error")
+		}
+		err = services.WithTx(c, db, func(c util.Context, tx *sql.Tx) error {
+			services.AfterCommit(c, func() { committed["nested"] = true })
+			return localData.Create(c, tx, models.ActivityStreams{timelineNote(testTxNestedIRI, pub.PublicActivityPubIRI)})
+		})
+		fmt.Printf("> AfterCommit (before commit): %v\n", committed)
+		if len(committed) > 0 {
+			fmt.Println("FAIL: Expected nothing to run before committing")
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> AfterCommit (committed): %v\n", committed)
+	if !committed["outer"] || !committed["nested"] || committed["failed"] {
+		fmt.Println("FAIL: Expected only the outer and succeeding nested calls to run")
+	}
+	// A context carrying the committed transaction begins a new one.
+	err := services.WithTx(leaked, db, func(c util.Context, tx *sql.Tx) error {
+		return localData.Create(c, tx, models.ActivityStreams{timelineNote(testTxLeakedIRI, pub.PublicActivityPubIRI)})
+	})
+	fmt.Printf("> WithTx (committed context): %v\n", err)
+	if err != nil {
+		fmt.Println("FAIL: Expected a new transaction")
+	}
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for iri, want := range map[string]bool{
+			testTxOuterIRI:  true,
+			testTxFailedIRI: false,
+			testTxNestedIRI: true,
+			testTxLeakedIRI: true,
+		} {
+			exists, err := localData.Exists(ctx, tx, mustParse(iri))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("> Exists %s: %v\n", iri, exists)
+			if exists != want {
+				fmt.Printf("FAIL: Expected %v\n", want)
+			}
+		}
+		return nil
+	})
+}
+
+/* Post rate limits */
+
+func runPostRetryAfterCalls(ctx util.Context, db *sql.DB) error {
+	svc := &services.Outboxes{
+		DB:        db,
+		Outboxes:  outboxes,
+		LocalData: localData,
+	}
+	actor := mustParse(testPostLimitActorIRI)
+	now := time.Now()
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for i, ago := range []time.Duration{10 * time.Second, 20 * time.Second, 50 * time.Minute} {
+			id := fmt.Sprintf("%s/activities/%d", testPostLimitActorIRI, i)
+			create := streams.NewActivityStreamsCreate()
+			idp := streams.NewJSONLDIdProperty()
+			idp.Set(mustParse(id))
+			create.SetJSONLDId(idp)
+			ap := streams.NewActivityStreamsActorProperty()
+			ap.AppendIRI(actor)
+			create.SetActivityStreamsActor(ap)
+			if err := localData.Create(ctx, tx, models.ActivityStreams{create}); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE `+*schema+`.local_data
+SET create_time = $2 WHERE payload->>'id' = $1`, id, now.Add(-ago)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// Two posts a minute and three an hour: the third post of the hour
+	// blocks until it is ten minutes older, well after the minute rolls.
+	for _, step := range []struct {
+		name      string
+		perMinute int
+		perHour   int
+		after     time.Duration
+		want      time.Duration
+	}{
+		{"at the limits", 2, 3, 0, 10 * time.Minute},
+		{"after the minute", 2, 3, 41 * time.Second, 10*time.Minute - 41*time.Second},
+		{"after the hour", 2, 3, 10*time.Minute + time.Second, 0},
+		{"per minute only", 2, 0, 0, 40 * time.Second},
+		{"per minute only, after the minute", 2, 0, 41 * time.Second, 0},
+		{"no limits", 0, 0, 0, 0},
+	} {
+		retryAfter, err := svc.PostRetryAfter(ctx, actor, step.perMinute, step.perHour, now.Add(step.after))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> PostRetryAfter %s: %s\n", step.name, retryAfter)
+		if d := retryAfter - step.want; d < -time.Millisecond || d > time.Millisecond {
+			fmt.Printf("FAIL: Expected to retry after %s\n", step.want)
+		}
+	}
+	return nil
+}
+
+/* Statement timeouts */
+
+func runStatementTimeoutCalls(ctx util.Context) error {
+	c := &config.Config{
+		DatabaseConfig: config.DatabaseConfig{
+			DatabaseKind:       "postgres",
+			MaxOpenConns:       1,
+			MaxIdleConns:       1,
+			StatementTimeoutMs: 100,
+			PostgresConfig: config.PostgresConfig{
+				Schema: *schema,
+			},
+		},
+	}
+	tdb, err := db.NewReadReplicaDB(c, *dburl)
+	if err != nil {
+		return err
+	}
+	defer tdb.Close()
+	var pid, after int
+	if err := tdb.QueryRowContext(ctx, `SELECT pg_backend_pid()`).Scan(&pid); err != nil {
+		return err
+	}
+	_, err = tdb.ExecContext(ctx, `SELECT pg_sleep(0.5)`)
+	fmt.Printf("> Exec past the timeout: %v\n", err)
+	if err == nil || !strings.Contains(err.Error(), "statement timeout") {
+		fmt.Println("FAIL: Expected the statement timeout error")
+	}
+	// The database cancels the statement, keeping the connection.
+	if err := tdb.QueryRowContext(ctx, `SELECT pg_backend_pid()`).Scan(&after); err != nil {
+		return err
+	}
+	fmt.Printf("> Same connection: %v\n", pid == after)
+	if pid != after {
+		fmt.Println("FAIL: Expected the connection to be kept")
+	}
+	// A transaction begun with an overriding context lifts the timeout.
+	lifted := ctx
+	lifted.WithStatementTimeout(0)
+	tx, err := tdb.BeginTx(lifted, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(lifted, `SELECT pg_sleep(0.2)`)
+	fmt.Printf("> Exec with the timeout lifted: %v\n", err)
+	if err != nil {
+		fmt.Println("FAIL: Expected no timeout")
+	}
+	return tx.Commit()
+}
+
+/* Reports */
+
+func runReportsCalls(ctx util.Context, db *sql.DB) error {
+	userID, err := getUserID(ctx, db)
+	if err != nil {
+		return err
+	}
+	// The same Flag delivered twice is only reported once.
+	for i := 0; i < 2; i++ {
+		if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+			return reports.Create(ctx, tx, mustParse(testReportFlagIRI), mustParse(testReportReporterIRI), []*url.URL{mustParse(testReportObjectIRI)}, testReportComment)
+		}); err != nil {
+			return err
+		}
+	}
+	open, err := runReportsGetByStatus(ctx, db, models.ReportStatusOpen)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> GetByStatus (open): %v\n", open)
+	if len(open) != 1 {
+		fmt.Println("FAIL: Expected one open report")
+		return nil
+	} else if v := open[0]; v.Reporter.String() != testReportReporterIRI ||
+		len(v.Objects) != 1 ||
+		v.Objects[0].String() != testReportObjectIRI ||
+		v.Comment != testReportComment ||
+		v.ResolvedBy != nil {
+		fmt.Println("FAIL: Expected the open report to match the Flag")
+	}
+	for i, expect := range []bool{true, false} {
+		var ok bool
+		if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+			ok, err = reports.Resolve(ctx, tx, open[0].ID, userID)
+			return
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("> Resolve (%d): %v\n", i, ok)
+		if ok != expect {
+			fmt.Printf("FAIL: Expected resolving the report %d to be %v\n", i, expect)
+		}
+	}
+	resolved, err := runReportsGetByStatus(ctx, db, models.ReportStatusResolved)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> GetByStatus (resolved): %v\n", resolved)
+	if len(resolved) != 1 {
+		fmt.Println("FAIL: Expected one resolved report")
+	} else if v := resolved[0]; v.ResolvedBy == nil || *v.ResolvedBy != userID || v.Resolved == nil {
+		fmt.Println("FAIL: Expected the report to be resolved by the user")
+	}
+	return nil
+}
+
+func runReportsGetByStatus(ctx util.Context, db *sql.DB, status string) (rp []models.Report, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		rp, err = reports.GetByStatus(ctx, tx, status)
+		return err
+	})
+	return
+}
+
+/* Invites */
+
+func runInvitesCalls(ctx util.Context, db *sql.DB) error {
+	userID, err := getUserID(ctx, db)
+	if err != nil {
+		return err
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		if err := invites.Create(ctx, tx, testInviteSingleUseCode, userID, 1, nil); err != nil {
+			return err
+		} else if err := invites.Create(ctx, tx, testInviteExpiredCode, userID, 1, &past); err != nil {
+			return err
+		}
+		return invites.Create(ctx, tx, testInviteConcurrentCode, userID, testInviteConcurrentMaxUses, nil)
+	}); err != nil {
+		return err
+	}
+	// Single use
+	for i, expect := range []bool{true, false} {
+		ok, err := runInvitesConsume(ctx, db, testInviteSingleUseCode)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> Consume (single use, %d): %v\n", i, ok)
+		if ok != expect {
+			fmt.Printf("FAIL: Expected consuming the single use invite %d to be %v\n", i, expect)
+		}
+	}
+	// Release restores a use
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return invites.Release(ctx, tx, testInviteSingleUseCode)
+	}); err != nil {
+		return err
+	}
+	ok, err := runInvitesConsume(ctx, db, testInviteSingleUseCode)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Consume (released): %v\n", ok)
+	if !ok {
+		fmt.Println("FAIL: Expected the released use to be consumable")
+	}
+	// Expired
+	ok, err = runInvitesConsume(ctx, db, testInviteExpiredCode)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Consume (expired): %v\n", ok)
+	if ok {
+		fmt.Println("FAIL: Expected the expired invite to not be consumable")
+	}
+	// Concurrent consumers never exceed the maximum uses
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var nOK int
+	var cErr error
+	for i := 0; i < testInviteConsumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := runInvitesConsume(ctx, db, testInviteConcurrentCode)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				cErr = err
+			} else if ok {
+				nOK++
+			}
+		}()
+	}
+	wg.Wait()
+	if cErr != nil {
+		return cErr
+	}
+	fmt.Printf("> Consume (concurrent): %d of %d\n", nOK, testInviteConsumers)
+	if nOK != testInviteConcurrentMaxUses {
+		fmt.Printf("FAIL: Expected %d concurrent consumptions to succeed\n", testInviteConcurrentMaxUses)
+	}
+	var all []models.Invite
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		all, err = invites.GetAll(ctx, tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> GetAll: %v\n", all)
+	if len(all) != 3 {
+		fmt.Println("FAIL: Expected three invites")
+	}
+	for _, v := range all {
+		if v.Code == testInviteExpiredCode {
+			if v.Remaining != 1 || v.Expires == nil {
+				fmt.Println("FAIL: Expected the expired invite to be unused and have an expiry")
+			}
+		} else if v.Remaining != 0 {
+			fmt.Printf("FAIL: Expected no remaining uses of %s\n", v.Code)
+		}
+	}
+	return nil
+}
+
+func runInvitesConsume(ctx util.Context, db *sql.DB, code string) (ok bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		ok, err = invites.Consume(ctx, tx, code)
+		return err
+	})
+	return
+}
+
+/* Emoji */
+
+func runEmojiCalls(ctx util.Context, db *sql.DB) error {
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return emoji.Upsert(ctx, tx, testEmojiShortcode, mustParse(testEmojiImageIRI), testEmojiMediaType)
+	}); err != nil {
+		return err
+	}
+	fmt.Println("> Upsert")
+	var ei models.EmojiInfo
+	var found bool
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		ei, found, err = emoji.Get(ctx, tx, testEmojiShortcode)
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Get: %v, %v\n", found, ei)
+	if !found || ei.ImageIRI.String() != testEmojiImageIRI || ei.MediaType != testEmojiMediaType {
+		fmt.Println("FAIL: Expected the upserted emoji")
+	}
+	var all []models.EmojiInfo
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		all, err = emoji.GetAll(ctx, tx)
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> GetAll: %v\n", all)
+	if len(all) != 1 {
+		fmt.Println("FAIL: Expected one emoji")
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return emoji.Delete(ctx, tx, testEmojiShortcode)
+	}); err != nil {
+		return err
+	}
+	fmt.Println("> Delete")
+	return runEmojiNoteRoundTrip(ctx, db)
+}
+
+// runEmojiNoteRoundTrip ensures a note with custom emoji tags is stored and
+// fetched without losing its tags or their JSON-LD context.
+func runEmojiNoteRoundTrip(ctx util.Context, db *sql.DB) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(testEmojiNote), &m); err != nil {
+		return err
+	}
+	note, err := streams.ToType(ctx, m)
+	if err != nil {
+		return err
+	}
+	before, err := models.Marshal(note)
+	if err != nil {
+		return err
+	}
+	var v models.ActivityStreams
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		if err = fedData.Create(ctx, tx, models.ActivityStreams{note}); err != nil {
+			return
+		}
+		v, err = fedData.Get(ctx, tx, mustParse(testEmojiNoteIRI))
+		return
+	}); err != nil {
+		return err
+	}
+	after, err := models.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Round trip:\n%s\n", after)
+	if string(before) != string(after) {
+		fmt.Printf("FAIL: Expected the note unchanged, was:\n%s\n", before)
+	}
+	if err := json.Unmarshal(after, &m); err != nil {
+		return err
+	}
+	if tags, ok := m["tag"].([]interface{}); !ok || len(tags) != 1 {
+		fmt.Println("FAIL: Expected the tag array to be kept")
+	}
+	if !strings.Contains(string(after), `"Emoji":"toot:Emoji"`) {
+		fmt.Println("FAIL: Expected the Emoji term to be defined in the context")
+	}
+	if err := runFeaturedContext(); err != nil {
+		return err
+	}
+	return runJSONLDContexts()
+}
+
+// runFeaturedContext ensures an actor linking its featured and featured tags
+// collections defines their terms in its context.
+func runFeaturedContext() error {
+	for prop, iri := range map[string]string{
+		"featured":     testActor1FeaturedIRI,
+		"featuredTags": testActor1FeaturedTagsIRI,
+	} {
+		p := streams.NewActivityStreamsPerson()
+		p.GetUnknownProperties()[prop] = iri
+		b, err := models.Marshal(p)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> Actor with %s: %s\n", prop, b)
+		if !strings.Contains(string(b), `"toot:`+prop+`"`) {
+			fmt.Printf("FAIL: Expected the %s term to be defined in the context\n", prop)
+		}
+	}
+	return nil
+}
+
+// runJSONLDContexts ensures the application's contexts are added once, after
+// the ActivityStreams context.
+func runJSONLDContexts() error {
+	terms := map[string]interface{}{"apcoretest": "https://example.com/ns#"}
+	ctxs := models.JSONLDContexts{"https://example.com/ns", terms}
+	b, err := models.Marshal(streams.NewActivityStreamsNote())
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if b, err = ctxs.Apply(b); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("> Apply: %s\n", b)
+	var m struct {
+		Context []interface{} `json:"@context"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	if len(m.Context) != 3 || m.Context[0] != "https://www.w3.org/ns/activitystreams" || m.Context[1] != "https://example.com/ns" {
+		fmt.Println("FAIL: Expected the ActivityStreams context, then each of the contexts once")
+	}
+	return nil
+}
+
+/* Domains */
+
+func runDomainsCalls(ctx util.Context, db *sql.DB) error {
+	for _, list := range []models.DomainList{models.AllowedDomains, models.BlockedDomains} {
+		if err := runDomainsAdd(ctx, db, list); err != nil {
+			return err
+		}
+		fmt.Printf("> Add (%s)\n", list)
+		// Adding twice is not an error.
+		if err := runDomainsAdd(ctx, db, list); err != nil {
+			return err
+		}
+		b, err := runDomainsContains(ctx, db, list)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> Contains (%s): %v\n", list, b)
+		if !b {
+			fmt.Println("FAIL: Expected the added domain")
+		}
+		if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+			return domains.Remove(ctx, tx, list, testDomain)
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("> Remove (%s)\n", list)
+		b, err = runDomainsContains(ctx, db, list)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> Contains (%s): %v\n", list, b)
+		if b {
+			fmt.Println("FAIL: Expected the removed domain to be absent")
+		}
+	}
+	return nil
+}
+
+func runDomainsAdd(ctx util.Context, db *sql.DB, list models.DomainList) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return domains.Add(ctx, tx, list, testDomain)
+	})
+}
+
+func runDomainsContains(ctx util.Context, db *sql.DB, list models.DomainList) (b bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = domains.Contains(ctx, tx, list, testDomain)
+		return err
+	})
+	return
+}
+
+/* Media */
+
+func runMediaCalls(ctx util.Context, db *sql.DB) error {
+	id, err := runMediaCreate(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Create: %s\n", id)
+	mi, found, err := runMediaGet(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Get: %v, %v\n", found, mi)
+	if !found || mi.ContentType != testMediaContentType || mi.Size != testMediaSize {
+		fmt.Println("FAIL: Expected the created media")
+	}
+	mi, found, err = runMediaGet(ctx, db, testMediaUnknownID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Get (Unknown): %v, %v\n", found, mi)
+	if found {
+		fmt.Println("FAIL: Expected no media")
+	}
+	mi, found, err = runMediaGetThumbnail(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> GetThumbnail (before create): %v, %v\n", found, mi)
+	if found {
+		fmt.Println("FAIL: Expected no thumbnail")
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return media.CreateThumbnail(ctx, tx, id, testMediaThumbnailDim, testMediaContentType, testMediaThumbnailSize, testMediaThumbnailPath)
+	}); err != nil {
+		return err
+	}
+	fmt.Println("> CreateThumbnail")
+	mi, found, err = runMediaGetThumbnail(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> GetThumbnail (after create): %v, %v\n", found, mi)
+	if !found || mi.Path != testMediaThumbnailPath || mi.Size != testMediaThumbnailSize {
+		fmt.Println("FAIL: Expected the created thumbnail")
+	}
+	return nil
+}
+
+func runMediaCreate(ctx util.Context, db *sql.DB) (id string, err error) {
+	var userID string
+	if userID, err = getUserID(ctx, db); err != nil {
+		return
+	}
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		id, err = media.Create(ctx, tx, userID, testMediaContentType, testMediaSize, testMediaPath)
+		return err
+	})
+	return
+}
+
+func runMediaGet(ctx util.Context, db *sql.DB, id string) (mi models.MediaInfo, found bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		mi, found, err = media.Get(ctx, tx, id)
+		return err
+	})
+	return
+}
+
+func runMediaGetThumbnail(ctx util.Context, db *sql.DB, id string) (mi models.MediaInfo, found bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		mi, found, err = media.GetThumbnail(ctx, tx, id, testMediaThumbnailDim)
+		return err
+	})
+	return
+}
+
+/* CollectionDrift */
+
+func runCollectionDriftCalls(ctx util.Context, db *sql.DB) error {
+	dc, err := runCollectionDriftSample(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Sample (before drift): %v\n", dc)
+	if len(dc) > 0 {
+		fmt.Println("FAIL: Expected none")
+	}
+	if err := driftTestActor1Followers(ctx, db); err != nil {
+		return err
+	}
+	dc, err = runCollectionDriftSample(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Sample (after drift): %v\n", dc)
+	if len(dc) != 1 || dc[0].ID.String() != testActor1FollowersIRI {
+		fmt.Println("FAIL: Expected only the drifted followers collection")
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return collectionDrift.Repair(ctx, tx, models.FollowersDrift, mustParse(testActor1FollowersIRI))
+	}); err != nil {
+		return err
+	}
+	dc, err = runCollectionDriftSample(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Sample (after repair): %v\n", dc)
+	if len(dc) > 0 {
+		fmt.Println("FAIL: Expected none")
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+*schema+`.liked WHERE actor_id = $1`, testActor1IRI)
+		return err
+	}); err != nil {
+		return err
+	}
+	ids, err := runCollectionDriftActorsMissing(ctx, db, models.LikedDrift)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> ActorsMissing(liked, after delete): %v\n", ids)
+	if !containsURL(ids, testActor1IRI) {
+		fmt.Println("FAIL: Expected the actor missing its liked collection")
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return liked.Create(ctx, tx, mustParse(testActor1IRI), testActor1Liked)
+	}); err != nil {
+		return err
+	}
+	ids, err = runCollectionDriftActorsMissing(ctx, db, models.LikedDrift)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> ActorsMissing(liked, after create): %v\n", ids)
+	if containsURL(ids, testActor1IRI) {
+		fmt.Println("FAIL: Expected the actor to have its liked collection")
+	}
+	return runCollectionDriftRecount(ctx, db)
+}
+
+// runCollectionDriftRecount corrupts the totalItems of an inbox, an outbox, a
+// followers, a shares, and a replies collection, then checks that recounting
+// corrects all of them.
+func runCollectionDriftRecount(ctx util.Context, db *sql.DB) error {
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for _, q := range []struct{ table, col, id string }{
+			{"inboxes", "inbox", testActor1InboxIRI},
+			{"outboxes", "outbox", testActor1OutboxIRI},
+			{"followers", "followers", testActor1FollowersIRI},
+			{"shares", "shares", testNote1SharesIRI},
+			{"replies", "replies", testNote1RepliesIRI},
+		} {
+			if _, err := tx.ExecContext(ctx, `UPDATE `+*schema+`.`+q.table+`
+SET `+q.col+` = `+q.col+` || '{"totalItems": 999}'::jsonb
+WHERE `+q.col+`->'id' ? $1`, q.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	var recounted []models.DriftedCollection
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for _, kind := range models.DriftKinds {
+			dc, err := collectionDrift.Recount(ctx, tx, kind)
+			if err != nil {
+				return err
+			}
+			recounted = append(recounted, dc...)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Recount: %v\n", recounted)
+	var ids []models.URL
+	for _, dc := range recounted {
+		ids = append(ids, dc.ID)
+		if dc.Stored != 999 || dc.Actual == 999 {
+			fmt.Printf("FAIL: Expected the corrupted totalItems to be corrected: %v\n", dc)
+		}
+	}
+	if len(recounted) != 5 || !containsURL(ids, testActor1InboxIRI) || !containsURL(ids, testActor1OutboxIRI) || !containsURL(ids, testActor1FollowersIRI) || !containsURL(ids, testNote1SharesIRI) || !containsURL(ids, testNote1RepliesIRI) {
+		fmt.Println("FAIL: Expected only the corrupted inbox, outbox, followers, shares, and replies collections")
+	}
+	dc, err := runCollectionDriftSample(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Sample (after recount): %v\n", dc)
+	if len(dc) > 0 {
+		fmt.Println("FAIL: Expected none")
+	}
+	return nil
+}
+
+func runCollectionDriftActorsMissing(ctx util.Context, db *sql.DB, kind models.DriftKind) (ids []models.URL, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		ids, err = collectionDrift.ActorsMissing(ctx, tx, kind)
+		return err
+	})
+	return
+}
+
+func containsURL(ids []models.URL, id string) bool {
+	for _, v := range ids {
+		if v.String() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// driftTestActor1Followers simulates a crash leaving a stale totalItems.
+func driftTestActor1Followers(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE `+*schema+`.followers
+SET followers = followers || '{"totalItems": 999}'::jsonb
+WHERE followers->'id' ? $1`, testActor1FollowersIRI)
+		return err
+	})
+}
+
+func runCollectionDriftSample(ctx util.Context, db *sql.DB) (dc []models.DriftedCollection, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for _, kind := range models.DriftKinds {
+			x, err := collectionDrift.Sample(ctx, tx, kind, 1000)
+			if err != nil {
+				return err
+			}
+			dc = append(dc, x...)
+		}
+		return nil
+	})
+	return
+}
+
+/* IdempotencyKeys */
+
+func runIdempotencyKeysCalls(ctx util.Context, db *sql.DB) error {
+	if err := runIdempotencyKeysReserve(ctx, db); err != nil {
+		return err
+	}
+	if err := runIdempotencyKeysGet(ctx, db, "key1"); err != nil {
+		return err
+	}
+	if err := runIdempotencyKeysGet(ctx, db, "unused"); err != nil {
+		return err
+	}
+	return runIdempotencyKeysRelease(ctx, db)
+}
+
+// runIdempotencyKeysReserve ensures a key is reserved only once, and that its
+// activity is found once set.
+func runIdempotencyKeysReserve(ctx util.Context, db *sql.DB) error {
+	outbox := mustParse(testActor1OutboxIRI)
+	var first, second bool
+	var pending *url.URL
+	var found bool
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		if first, err = idempotencyKeys.Reserve(ctx, tx, outbox, "key1"); err != nil {
+			return
+		}
+		if second, err = idempotencyKeys.Reserve(ctx, tx, outbox, "key1"); err != nil {
+			return
+		}
+		pending, found, err = idempotencyKeys.Get(ctx, tx, outbox, "key1")
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Reserve: first=%v second=%v pending=%v found=%v\n", first, second, pending, found)
+	if !first || second || pending != nil || !found {
+		fmt.Println("FAIL: Expected the key to be reserved once, without an activity")
+	}
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return idempotencyKeys.SetActivity(ctx, tx, outbox, "key1", mustParse(testActivity1IRI))
+	})
+}
+
+// runIdempotencyKeysRelease ensures a reserved key without an activity may be
+// reserved again once released, while a key with an activity is kept.
+func runIdempotencyKeysRelease(ctx util.Context, db *sql.DB) error {
+	outbox := mustParse(testActor1OutboxIRI)
+	var again, kept bool
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		if _, err = idempotencyKeys.Reserve(ctx, tx, outbox, "key2"); err != nil {
+			return
+		}
+		if err = idempotencyKeys.Release(ctx, tx, outbox, "key2"); err != nil {
+			return
+		}
+		if again, err = idempotencyKeys.Reserve(ctx, tx, outbox, "key2"); err != nil {
+			return
+		}
+		if err = idempotencyKeys.Release(ctx, tx, outbox, "key1"); err != nil {
+			return
+		}
+		var a *url.URL
+		a, _, err = idempotencyKeys.Get(ctx, tx, outbox, "key1")
+		kept = a != nil
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Release: reserved again=%v activity kept=%v\n", again, kept)
+	if !again || !kept {
+		fmt.Println("FAIL: Expected only the key without an activity to be released")
+	}
+	return nil
+}
+
+func runIdempotencyKeysGet(ctx util.Context, db *sql.DB, key string) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		a, found, err := idempotencyKeys.Get(ctx, tx, mustParse(testActor1OutboxIRI), key)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> Get(%s): found=%v %v\n", key, found, a)
+		return nil
+	})
+}
+
+/* Resolutions */
+
+func runResolutionsCalls(ctx util.Context, db *sql.DB, policyID string) error {
+	if err := runResolutionsCreate(ctx, db, policyID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func runResolutionsCreate(ctx util.Context, db *sql.DB, policyID string) error {
+	cr := models.CreateResolution{
+		PolicyID: policyID,
+		IRI:      mustParse(testActivity1IRI),
+		R: models.Resolution{
+			Time:    time.Now(),
+			Matched: true,
+			MatchLog: []string{
+				"first entry",
+				"second",
+				"final line",
+			},
+		},
+	}
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return resolutions.Create(ctx, tx, cr)
+	})
+}
+
+/* Policies */
+
+func runPoliciesCalls(ctx util.Context, db *sql.DB) (policyID string, err error) {
+	policyID, err = runPoliciesCreate(ctx, db)
+	if err != nil {
+		return
+	}
+	var po []models.PolicyAndPurpose
+	po, err = runPoliciesGetForActor(ctx, db)
+	if err != nil {
+		return
+	}
+	fmt.Printf("> GetForActor: %v\n", po)
+	var pd []models.PolicyAndID
+	pd, err = runPoliciesGetForActorAndPurpose(ctx, db)
+	if err != nil {
+		return
+	}
+	fmt.Printf("> GetForActorAndPurpose: %v\n", pd)
+	err = runPoliciesAutoAcceptFollow(ctx, db)
+	return
+}
+
+// runPoliciesAutoAcceptFollow checks that a Follow from an actor on an accepted
+// domain matches, while one from any other domain does not and is left for
+// manual approval.
+func runPoliciesAutoAcceptFollow(ctx util.Context, db *sql.DB) error {
+	actor := mustParse(testActor2IRI)
+	var id string
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		id, err = policies.Create(ctx, tx, models.CreatePolicy{
+			ActorID: actor,
+			Purpose: models.AutoAcceptFollowPurpose,
+			Policy: models.Policy{
+				Name: "Test Follow Policy",
+				Matchers: []*models.KVMatcher{
+					{
+						KeyPathQuery: "actor",
+						ValueMatcher: &models.UnaryMatcher{
+							Value: &models.Value{
+								HostIn: []string{mustParse(testActor1IRI).Host},
+							},
+						},
+					},
+				},
+			},
+		})
+		return
+	}); err != nil {
+		return err
+	}
+	var pd []models.PolicyAndID
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		pd, err = policies.GetForActorAndPurpose(ctx, tx, actor, models.AutoAcceptFollowPurpose)
+		return
+	}); err != nil {
+		return err
+	}
+	if len(pd) != 1 {
+		fmt.Println("FAIL: Expected one auto accept follow policy")
+		return nil
+	}
+	for _, follower := range []string{testActor1IRI, testReportReporterIRI} {
+		follow := fmt.Sprintf(`{"type":"Follow","actor":%q,"object":%q}`, follower, testActor2IRI)
+		var res models.Resolution
+		if err := pd[0].Policy.Resolve([]byte(follow), &res); err != nil {
+			return err
+		}
+		fmt.Printf("> Resolve (Follow from %s): %v\n", follower, res.Matched)
+		if res.Matched != (follower == testActor1IRI) {
+			fmt.Println("FAIL: Expected only the Follow from the accepted domain to match")
+		}
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return policies.Delete(ctx, tx, actor, id)
+	}); err != nil {
+		return err
+	}
+	fmt.Println("> Delete")
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		pd, err = policies.GetForActorAndPurpose(ctx, tx, actor, models.AutoAcceptFollowPurpose)
+		return
+	}); err != nil {
+		return err
+	}
+	if len(pd) != 0 {
+		fmt.Println("FAIL: Expected the deleted policy to be absent")
+	}
+	return nil
+}
+
+func runPoliciesCreate(ctx util.Context, db *sql.DB) (policyID string, err error) {
+	cp := models.CreatePolicy{
+		ActorID: mustParse(testActor1IRI),
+		Purpose: models.FederatedBlockPurpose,
+		Policy: models.Policy{
+			Name:        "Test Policy 1",
+			Description: "A test policy.",
+			Matchers: []*models.KVMatcher{
+				{
+					KeyPathQuery: "actor",
+					ValueMatcher: &models.UnaryMatcher{
+						Value: &models.Value{
+							EqualsString: testActor3IRI,
+						},
+					},
+				},
+			},
+		},
+	}
+	return policyID, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		policyID, err = policies.Create(ctx, tx, cp)
+		return err
+	})
+}
+
+func runPoliciesGetForActor(ctx util.Context, db *sql.DB) (p []models.PolicyAndPurpose, err error) {
+	return p, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		p, err = policies.GetForActor(ctx, tx, mustParse(testActor1IRI))
+		return err
+	})
+}
+
+func runPoliciesGetForActorAndPurpose(ctx util.Context, db *sql.DB) (p []models.PolicyAndID, err error) {
+	return p, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		p, err = policies.GetForActorAndPurpose(ctx, tx, mustParse(testActor1IRI), models.FederatedBlockPurpose)
+		return err
+	})
+}
+
+/* FeaturedTags */
+
+func runFeaturedTagsCalls(ctx util.Context, db *sql.DB) error {
+	if err := runFeaturedTagsCreate(ctx, db); err != nil {
+		return err
+	}
+	if err := runFeaturedTagsPrependItem(ctx, db); err != nil {
+		return err
+	}
+	has, err := runFeaturedTagsContains(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> ContainsTrue: %v\n", has)
+	if n, err := runFeaturedTagsCount(ctx, db); err != nil {
+		return err
+	} else if n != 1 {
+		return fmt.Errorf("featured tags count is %d, want 1", n)
+	}
+	p, isEnd, err := runFeaturedTagsGetPage(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> GetPage(%d, %d): %s %v\n", 0, 10, p, isEnd)
+	if pb, err := toJSON(p); err != nil {
+		return err
+	} else {
+		fmt.Printf("> JSON:\n%s\n", pb)
+	}
+	// The tags are served as Hashtags rather than bare IRIs.
+	m, err := streams.Serialize(p.ActivityStreamsCollectionPage)
+	if err != nil {
+		return err
+	}
+	items, _ := m["items"].([]interface{})
+	if len(items) != 1 {
+		return fmt.Errorf("featured tags page has %d items, want 1", len(items))
+	}
+	tag, _ := items[0].(map[string]interface{})
+	if tag["type"] != "Hashtag" || tag["href"] != testTag1IRI || tag["name"] != "#test1" {
+		return fmt.Errorf("featured tag is not a Hashtag: %v", items[0])
+	}
+	if err := runFeaturedTagsDeleteItem(ctx, db); err != nil {
+		return err
+	}
+	if has, err = runFeaturedTagsContains(ctx, db); err != nil {
+		return err
+	} else if has {
+		return fmt.Errorf("featured tags still contains the deleted tag")
+	}
+	if n, err := runFeaturedTagsCount(ctx, db); err != nil {
+		return err
+	} else if n != 0 {
+		return fmt.Errorf("featured tags count after delete is %d, want 0", n)
+	}
+	var exists, missing bool
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		var err error
+		if exists, err = featuredTags.Exists(ctx, tx, mustParse(testActor1FeaturedTagsIRI)); err != nil {
+			return err
+		}
+		missing, err = featuredTags.Exists(ctx, tx, mustParse(testActor1FeaturedTagsIRI+"/missing"))
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Exists: %v %v\n", exists, missing)
+	if !exists || missing {
+		return fmt.Errorf("featured tags existence is wrong: %v %v", exists, missing)
+	}
+	return nil
+}
+
+func runFeaturedTagsCreate(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return featuredTags.Create(ctx, tx, mustParse(testActor1IRI), testActor1FeaturedTags)
+	})
+}
+
+func runFeaturedTagsPrependItem(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return featuredTags.PrependItem(ctx, tx, mustParse(testActor1FeaturedTagsIRI), mustParse(testTag1IRI), "#test1")
+	})
+}
+
+func runFeaturedTagsContains(ctx util.Context, db *sql.DB) (b bool, err error) {
+	return b, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = featuredTags.Contains(ctx, tx, mustParse(testActor1FeaturedTagsIRI), mustParse(testTag1IRI))
+		return err
+	})
+}
+
+func runFeaturedTagsCount(ctx util.Context, db *sql.DB) (n int, err error) {
+	return n, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		n, err = featuredTags.Count(ctx, tx, mustParse(testActor1FeaturedTagsIRI))
+		return err
+	})
+}
+
+func runFeaturedTagsGetPage(ctx util.Context, db *sql.DB) (p models.ActivityStreamsCollectionPage, isEnd bool, err error) {
+	return p, isEnd, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		p, isEnd, err = featuredTags.GetPage(ctx, tx, mustParse(testActor1FeaturedTagsIRI), 0, 10)
+		return err
+	})
+}
+
+func runFeaturedTagsDeleteItem(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return featuredTags.DeleteItem(ctx, tx, mustParse(testActor1FeaturedTagsIRI), mustParse(testTag1IRI))
+	})
+}
+
+/* Featured */
+
+func runFeaturedCalls(ctx util.Context, db *sql.DB) error {
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return featured.Create(ctx, tx, mustParse(testActor1IRI), testActor1Featured)
+	}); err != nil {
+		return err
+	}
+	// Only the first prepend succeeds: the second would duplicate the Note,
+	// and the third would exceed the maximum of one item.
+	var first, dup, full bool
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		first, err = featured.PrependItem(ctx, tx, mustParse(testActor1FeaturedIRI), mustParse(testNote1IRI), 1)
+		if err != nil {
+			return
+		}
+		dup, err = featured.PrependItem(ctx, tx, mustParse(testActor1FeaturedIRI), mustParse(testNote1IRI), 5)
+		if err != nil {
+			return
+		}
+		full, err = featured.PrependItem(ctx, tx, mustParse(testActor1FeaturedIRI), mustParse(testActor2IRI), 1)
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> PrependItem: first=%v duplicate=%v full=%v\n", first, dup, full)
+	if !first || dup || full {
+		fmt.Println("FAIL: Expected only the first prepend to succeed")
+	}
+	var has bool
+	var n int
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		has, err = featured.Contains(ctx, tx, mustParse(testActor1FeaturedIRI), mustParse(testNote1IRI))
+		if err != nil {
+			return
+		}
+		n, err = featured.Count(ctx, tx, mustParse(testActor1FeaturedIRI))
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> ContainsTrue: %v\n", has)
+	fmt.Printf("> Count: %d\n", n)
+	if !has || n != 1 {
+		fmt.Println("FAIL: Expected the pinned Note to be featured")
+	}
+	var p models.ActivityStreamsCollectionPage
+	var isEnd bool
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		p, isEnd, err = featured.GetPage(ctx, tx, mustParse(testActor1FeaturedIRI), 0, 10)
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> GetPage(%d, %d): %s %v\n", 0, 10, p, isEnd)
+	if pb, err := toJSON(p); err != nil {
+		return err
+	} else {
+		fmt.Printf("> JSON:\n%s\n", pb)
+	}
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return featured.DeleteItem(ctx, tx, mustParse(testActor1FeaturedIRI), mustParse(testNote1IRI))
+	})
+}
+
+/* Shares */
+
+func runSharesCalls(ctx util.Context, db *sql.DB) error {
+	if err := runSharesCreate(ctx, db); err != nil {
+		return err
+	}
+	exists, err := runSharesExists(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Exists: %v\n", exists)
+	if !exists {
+		fmt.Println("FAIL: Expected the shares collection to exist")
+	}
+	// Announce
+	if err := runSharesPrependItem(ctx, db); err != nil {
+		return err
+	}
+	has, err := runSharesContains(ctx, db)
+	if err != nil {
+		return err
+	}
+	n, err := runSharesCount(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> After Announce: Contains=%v Count=%d\n", has, n)
+	if !has || n != 1 {
+		fmt.Println("FAIL: Expected the Announce in the shares collection")
+	}
+	// Undo the Announce
+	if err := runSharesDeleteItem(ctx, db); err != nil {
+		return err
+	}
+	has, err = runSharesContains(ctx, db)
+	if err != nil {
+		return err
+	}
+	n, err = runSharesCount(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> After Undo: Contains=%v Count=%d\n", has, n)
+	if has || n != 0 {
+		fmt.Println("FAIL: Expected the shares collection to be empty")
+	}
+	return nil
+}
+
+func runSharesCreate(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return shares.Create(ctx, tx, mustParse(testNote1IRI), testNote1Shares)
+	})
+}
+
+func runSharesExists(ctx util.Context, db *sql.DB) (b bool, err error) {
+	return b, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = shares.Exists(ctx, tx, mustParse(testNote1SharesIRI))
+		return err
+	})
+}
+
+func runSharesPrependItem(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return shares.PrependItem(ctx, tx, mustParse(testNote1SharesIRI), mustParse(testAnnounce1IRI))
+	})
+}
+
+func runSharesContains(ctx util.Context, db *sql.DB) (b bool, err error) {
+	return b, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = shares.Contains(ctx, tx, mustParse(testNote1SharesIRI), mustParse(testAnnounce1IRI))
+		return err
+	})
+}
+
+func runSharesCount(ctx util.Context, db *sql.DB) (n int, err error) {
+	return n, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		n, err = shares.Count(ctx, tx, mustParse(testNote1SharesIRI))
+		return err
+	})
+}
+
+func runSharesDeleteItem(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return shares.DeleteItem(ctx, tx, mustParse(testNote1SharesIRI), mustParse(testAnnounce1IRI))
+	})
+}
+
+/* Replies */
+
+func runRepliesCalls(ctx util.Context, db *sql.DB) error {
+	if err := runRepliesCreate(ctx, db); err != nil {
+		return err
+	}
+	if err := runRepliesPrependItem(ctx, db); err != nil {
+		return err
+	}
+	has, err := runRepliesContains(ctx, db)
 	if err != nil {
-		return
+		return err
 	}
-	var po []models.PolicyAndPurpose
-	po, err = runPoliciesGetForActor(ctx, db)
+	fmt.Printf("> ContainsTrue: %v\n", has)
+	if !has {
+		fmt.Println("FAIL: Expected the reply in the replies collection")
+	}
+	p, isEnd, err := runRepliesGetPage(ctx, db)
 	if err != nil {
-		return
+		return err
 	}
-	fmt.Printf("> GetForActor: %v\n", po)
-	var pd []models.PolicyAndID
-	pd, err = runPoliciesGetForActorAndPurpose(ctx, db)
+	fmt.Printf("> GetPage(%d, %d): %s %v\n", 0, 10, p, isEnd)
+	if pb, err := toJSON(p); err != nil {
+		return err
+	} else {
+		fmt.Printf("> JSON:\n%s\n", pb)
+	}
+	// The reply is not stored, so it is not known to be public.
+	p, isEnd, err = runRepliesGetPublicPage(ctx, db)
 	if err != nil {
-		return
+		return err
 	}
-	fmt.Printf("> GetForActorAndPurpose: %v\n", pd)
-	return
+	fmt.Printf("> GetPublicPage(%d, %d): %s %v\n", 0, 10, p, isEnd)
+	if pb, err := toJSON(p); err != nil {
+		return err
+	} else {
+		fmt.Printf("> JSON:\n%s\n", pb)
+	}
+	return nil
 }
 
-func runPoliciesCreate(ctx util.Context, db *sql.DB) (policyID string, err error) {
-	cp := models.CreatePolicy{
-		ActorID: mustParse(testActor1IRI),
-		Purpose: models.FederatedBlockPurpose,
-		Policy: models.Policy{
-			Name:        "Test Policy 1",
-			Description: "A test policy.",
-			Matchers: []*models.KVMatcher{
-				{
-					KeyPathQuery: "actor",
-					ValueMatcher: &models.UnaryMatcher{
-						Value: &models.Value{
-							EqualsString: testActor3IRI,
-						},
-					},
-				},
-			},
-		},
-	}
-	return policyID, doWithTx(ctx, db, func(tx *sql.Tx) error {
-		policyID, err = policies.Create(ctx, tx, cp)
+func runRepliesCreate(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return replies.Create(ctx, tx, mustParse(testNote1IRI), testNote1Replies)
+	})
+}
+
+func runRepliesPrependItem(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return replies.PrependItem(ctx, tx, mustParse(testNote1RepliesIRI), mustParse(testReply1IRI))
+	})
+}
+
+func runRepliesContains(ctx util.Context, db *sql.DB) (b bool, err error) {
+	return b, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = replies.Contains(ctx, tx, mustParse(testNote1RepliesIRI), mustParse(testReply1IRI))
 		return err
 	})
 }
 
-func runPoliciesGetForActor(ctx util.Context, db *sql.DB) (p []models.PolicyAndPurpose, err error) {
-	return p, doWithTx(ctx, db, func(tx *sql.Tx) error {
-		p, err = policies.GetForActor(ctx, tx, mustParse(testActor1IRI))
+func runRepliesGetPage(ctx util.Context, db *sql.DB) (p models.ActivityStreamsCollectionPage, isEnd bool, err error) {
+	return p, isEnd, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		p, isEnd, err = replies.GetPage(ctx, tx, mustParse(testNote1RepliesIRI), 0, 10)
 		return err
 	})
 }
 
-func runPoliciesGetForActorAndPurpose(ctx util.Context, db *sql.DB) (p []models.PolicyAndID, err error) {
-	return p, doWithTx(ctx, db, func(tx *sql.Tx) error {
-		p, err = policies.GetForActorAndPurpose(ctx, tx, mustParse(testActor1IRI), models.FederatedBlockPurpose)
+func runRepliesGetPublicPage(ctx util.Context, db *sql.DB) (p models.ActivityStreamsCollectionPage, isEnd bool, err error) {
+	return p, isEnd, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		p, isEnd, err = replies.GetPublicPage(ctx, tx, mustParse(testNote1RepliesIRI), 0, 10)
 		return err
 	})
 }
@@ -308,6 +2241,9 @@ func runLikedCalls(ctx util.Context, db *sql.DB) error {
 	if err := runLikedDeleteItem(ctx, db); err != nil {
 		return err
 	}
+	if err := runLikedLikeUndoRoundTrip(ctx, db); err != nil {
+		return err
+	}
 	c, err := runLikedGetAllForActor(ctx, db)
 	if err != nil {
 		return err
@@ -392,6 +2328,65 @@ func runLikedDeleteItem(ctx util.Context, db *sql.DB) error {
 	})
 }
 
+// runLikedLikeUndoRoundTrip likes and then unlikes an item through
+// services.Liked, as sent Like and Undo activities do, which must leave the
+// liked collection as it was.
+func runLikedLikeUndoRoundTrip(ctx util.Context, db *sql.DB) error {
+	svc := &services.Liked{
+		DB:    db,
+		Liked: liked,
+	}
+	likedIRI := mustParse(testActor3LikedIRI)
+	item := mustParse(testActivity9IRI)
+	// Each step is repeated, so that repeating a Like or an Undo does not
+	// skew totalItems.
+	for i, like := range []bool{true, true, false, false} {
+		var err error
+		if like {
+			err = svc.AddItem(ctx, likedIRI, item)
+		} else {
+			err = svc.RemoveItem(ctx, likedIRI, item)
+		}
+		if err != nil {
+			return err
+		}
+		if i == 1 {
+			col, err := svc.GetShell(ctx, likedIRI)
+			if err != nil {
+				return err
+			}
+			has, err := svc.Contains(ctx, likedIRI, item)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("> LikeUndoRoundTrip (Liked twice): contains=%v totalItems=%d\n", has, col.GetActivityStreamsTotalItems().Get())
+			if !has {
+				fmt.Println("FAIL: Expected the liked collection to contain the item")
+			}
+		}
+	}
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		has, err := liked.Contains(ctx, tx, likedIRI, item)
+		if err != nil {
+			return err
+		}
+		n, err := liked.Count(ctx, tx, likedIRI)
+		if err != nil {
+			return err
+		}
+		col, err := liked.GetAllForActor(ctx, tx, mustParse(testActor3IRI))
+		if err != nil {
+			return err
+		}
+		total := col.GetActivityStreamsTotalItems().Get()
+		fmt.Printf("> LikeUndoRoundTrip: contains=%v count=%d totalItems=%d\n", has, n, total)
+		if has || n != total {
+			return fmt.Errorf("liked collection inconsistent after Like and Undo: contains=%v count=%d totalItems=%d", has, n, total)
+		}
+		return nil
+	})
+}
+
 func runLikedGetAllForActor(ctx util.Context, db *sql.DB) (p models.ActivityStreamsCollection, err error) {
 	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
 		p, err = liked.GetAllForActor(ctx, tx, mustParse(testActor2IRI))
@@ -462,9 +2457,66 @@ func runFollowingCalls(ctx util.Context, db *sql.DB) error {
 	} else {
 		fmt.Printf("> JSON:\n%s\n", pb)
 	}
+	pf, err := runPendingFollows(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> PendingFollows: %s\n", pf)
+	if len(pf) != 1 {
+		fmt.Printf("FAIL: Expected 1, got %d\n", len(pf))
+	}
+	pf, err = runPendingFollowsResolvedBy(ctx, db, testForgedAcceptFollow)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> PendingFollows (Accepted by another actor): %s\n", pf)
+	if len(pf) != 1 {
+		fmt.Printf("FAIL: Expected 1, got %d\n", len(pf))
+	}
+	pf, err = runPendingFollowsResolvedBy(ctx, db, testAcceptPendingFollow)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> PendingFollows (Accepted): %s\n", pf)
+	if len(pf) > 0 {
+		fmt.Println("FAIL: Expected none, got:")
+	}
+	for i, v := range pf {
+		if pb, err := toJSON(v); err != nil {
+			return err
+		} else {
+			fmt.Printf("> JSON[%d]:\n%s\n", i, pb)
+		}
+	}
 	return nil
 }
 
+func runPendingFollows(ctx util.Context, db *sql.DB) (f []models.ActivityStreamsFollow, err error) {
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return localData.Create(ctx, tx, models.ActivityStreams{testPendingFollowActor1})
+	}); err != nil {
+		return
+	}
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		f, err = following.PendingFollows(ctx, tx, mustParse(testActor1IRI))
+		return err
+	})
+	return
+}
+
+func runPendingFollowsResolvedBy(ctx util.Context, db *sql.DB, resolution vocab.Type) (f []models.ActivityStreamsFollow, err error) {
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return fedData.Create(ctx, tx, models.ActivityStreams{resolution})
+	}); err != nil {
+		return
+	}
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		f, err = following.PendingFollows(ctx, tx, mustParse(testActor1IRI))
+		return err
+	})
+	return
+}
+
 func runFollowingCreate(ctx util.Context, db *sql.DB) error {
 	return doWithTx(ctx, db, func(tx *sql.Tx) error {
 		return following.Create(ctx, tx, mustParse(testActor1IRI), testActor1Following)
@@ -606,6 +2658,11 @@ func runFollowersCalls(ctx util.Context, db *sql.DB) error {
 	} else {
 		fmt.Printf("> JSON:\n%s\n", pb)
 	}
+	n, err := runFollowersCount(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Count: %d\n", n)
 	ofr, err := runOpenFollowRequestsNone(ctx, db)
 	if err != nil {
 		return err
@@ -648,6 +2705,18 @@ func runFollowersCalls(ctx util.Context, db *sql.DB) error {
 			fmt.Printf("> JSON[%d]:\n%s\n", i, pb)
 		}
 	}
+	frf, found, err := runFollowReceivedFrom(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> FollowReceivedFrom: %v\n", found)
+	if !found {
+		fmt.Println("FAIL: Expected a Follow, got none")
+	} else if pb, err := toJSON(frf); err != nil {
+		return err
+	} else {
+		fmt.Printf("> JSON:\n%s\n", pb)
+	}
 	return nil
 }
 
@@ -730,6 +2799,14 @@ func runFollowersGetAllForActor(ctx util.Context, db *sql.DB) (p models.Activity
 	return
 }
 
+func runFollowersCount(ctx util.Context, db *sql.DB) (n int, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		n, err = followers.Count(ctx, tx, mustParse(testActor1FollowersIRI))
+		return err
+	})
+	return
+}
+
 func runOpenFollowRequestsNone(ctx util.Context, db *sql.DB) (f []models.ActivityStreamsFollow, err error) {
 	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
 		f, err = followers.OpenFollowRequests(ctx, tx, mustParse(testActor1IRI))
@@ -786,6 +2863,14 @@ func runOpenFollowRequests(ctx util.Context, db *sql.DB) (f []models.ActivityStr
 	return
 }
 
+func runFollowReceivedFrom(ctx util.Context, db *sql.DB) (f models.ActivityStreamsFollow, found bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		f, found, err = followers.FollowReceivedFrom(ctx, tx, mustParse(testActor2IRI), mustParse(testPeerActor1IRI))
+		return err
+	})
+	return
+}
+
 /* Credentials */
 
 func runCredentialsCalls(ctx util.Context, db *sql.DB, clientID string) error {
@@ -1018,9 +3103,51 @@ func runTokenInfosCalls(ctx util.Context, db *sql.DB, clientID string) error {
 		return err
 	}
 	fmt.Printf("> GetByRefresh: %v\n", ti)
+	ca, err := runTokenInfosGetAuthorizationsForUser(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> GetAuthorizationsForUser: %v\n", ca)
+	if err := runTokenInfosRemoveForUserClient(ctx, db, clientID); err != nil {
+		return err
+	}
 	return nil
 }
 
+func runTokenInfosGetAuthorizationsForUser(ctx util.Context, db *sql.DB) (ca []models.ClientAuthorization, err error) {
+	uid, err := getUserID(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return ca, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		ca, err = tokenInfos.GetAuthorizationsForUser(ctx, tx, uid)
+		return err
+	})
+}
+
+func runTokenInfosRemoveForUserClient(ctx util.Context, db *sql.DB, clientID string) error {
+	uid, err := getUserID(ctx, db)
+	if err != nil {
+		return err
+	}
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		if n, err := tokenInfos.RemoveForUserClient(ctx, tx, uid, clientID); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("RemoveForUserClient removed no tokens")
+		}
+		if _, err := tokenInfos.GetByAccess(ctx, tx, "access1"); !errors.Is(err, models.ErrNotFound) {
+			return fmt.Errorf("expected revoked access token to be not found, got: %v", err)
+		}
+		if ca, err := tokenInfos.GetAuthorizationsForUser(ctx, tx, uid); err != nil {
+			return err
+		} else if len(ca) != 0 {
+			return fmt.Errorf("expected no authorizations after revoking, got: %v", ca)
+		}
+		return nil
+	})
+}
+
 func runTokenInfosCreate(ctx util.Context, db *sql.DB, clientID string) (id string, err error) {
 	uid, err := getUserID(ctx, db)
 	if err != nil {
@@ -1249,53 +3376,139 @@ func runPrivateKeysCalls(ctx util.Context, db *sql.DB) error {
 	if err := runPrivateKeysCreate(ctx, db); err != nil {
 		return err
 	}
-	b, err := runPrivateKeysGetByUserID(ctx, db)
+	k, err := runPrivateKeysGetByUserID(ctx, db)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("> GetByUserID: %v\n", b)
-	b, err = runPrivateKeysGetForInstanceActor(ctx, db)
+	fmt.Printf("> GetByUserID: %d keys\n", len(k))
+	if len(k) != 2 {
+		fmt.Println("FAIL: Expected the user's RSA and Ed25519 keys")
+	}
+	if err = checkPrivateKeys(k); err != nil {
+		return err
+	}
+	k, err = runPrivateKeysGetForInstanceActor(ctx, db)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("> GetForInstanceActor: %v\n", b)
+	fmt.Printf("> GetForInstanceActor: %d keys\n", len(k))
+	if len(k) != 1 {
+		fmt.Println("FAIL: Expected the instance actor's Ed25519 key")
+	}
+	return checkPrivateKeys(k)
+}
+
+// checkPrivateKeys checks that the stored keys parse from PKCS8 into keys of
+// their stored type, which sign HTTP Signatures that verify.
+func checkPrivateKeys(k []models.PrivateKey) error {
+	for _, pk := range k {
+		key, err := x509.ParsePKCS8PrivateKey(pk.PrivKey)
+		if err != nil {
+			fmt.Printf("FAIL: Expected the %s key to parse: %s\n", pk.KeyType, err)
+			continue
+		}
+		var keyType string
+		var pub crypto.PublicKey
+		var alg httpsig.Algorithm
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			keyType, pub, alg = "rsa", &key.PublicKey, httpsig.RSA_SHA256
+		case ed25519.PrivateKey:
+			keyType, pub, alg = "ed25519", key.Public(), httpsig.ED25519
+		}
+		fmt.Printf("> Parsed %s key: %T\n", pk.KeyType, key)
+		if keyType != pk.KeyType {
+			fmt.Printf("FAIL: Expected the %s key to parse as a key of its type\n", pk.KeyType)
+			continue
+		}
+		signer, _, err := httpsig.NewSigner([]httpsig.Algorithm{alg}, httpsig.DigestSha256, []string{httpsig.RequestTarget, "Date"}, httpsig.Signature, 60)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/users/test", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		if err = signer.SignRequest(key, "https://example.com/users/test#key", req, nil); err != nil {
+			fmt.Printf("FAIL: Expected the %s key to sign: %s\n", pk.KeyType, err)
+			continue
+		}
+		v, err := httpsig.NewVerifier(req)
+		if err != nil {
+			return err
+		}
+		err = v.Verify(pub, alg)
+		fmt.Printf("> Verify %s signature: %v\n", pk.KeyType, err)
+		if err != nil {
+			fmt.Printf("FAIL: Expected the %s key's signature to verify\n", pk.KeyType)
+		}
+	}
 	return nil
 }
 
+// pkcs8Keys creates a new RSA and a new Ed25519 private key in PKCS8 form.
+func pkcs8Keys() (rsaKey, ed25519Key []byte, err error) {
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return
+	}
+	if rsaKey, err = x509.MarshalPKCS8PrivateKey(rk); err != nil {
+		return
+	}
+	_, ek, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	ed25519Key, err = x509.MarshalPKCS8PrivateKey(ek)
+	return
+}
+
 func runPrivateKeysCreate(ctx util.Context, db *sql.DB) error {
 	id, err := getUserID(ctx, db)
 	if err != nil {
 		return err
 	}
+	rsaKey, ed25519Key, err := pkcs8Keys()
+	if err != nil {
+		return err
+	}
 	return doWithTx(ctx, db, func(tx *sql.Tx) error {
-		return privateKeys.Create(ctx, tx, id, "test", []byte{9, 8, 7, 6, 5, 4, 3, 2, 1, 0})
+		if err := privateKeys.Create(ctx, tx, id, "test", rsaKey, "rsa"); err != nil {
+			return err
+		}
+		return privateKeys.Create(ctx, tx, id, "test", ed25519Key, "ed25519")
 	})
 }
 
-func runPrivateKeysGetByUserID(ctx util.Context, db *sql.DB) (b []byte, err error) {
+func runPrivateKeysGetByUserID(ctx util.Context, db *sql.DB) (k []models.PrivateKey, err error) {
 	id, err := getUserID(ctx, db)
 	if err != nil {
 		return nil, err
 	}
-	return b, doWithTx(ctx, db, func(tx *sql.Tx) error {
-		b, err = privateKeys.GetByUserID(ctx, tx, id, "test")
+	return k, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		k, err = privateKeys.GetByUserID(ctx, tx, id, "test")
 		return err
 	})
 }
 
-func runPrivateKeysGetForInstanceActor(ctx util.Context, db *sql.DB) (b []byte, err error) {
+func runPrivateKeysGetForInstanceActor(ctx util.Context, db *sql.DB) (k []models.PrivateKey, err error) {
 	id, err := getInstanceActorUserID(ctx, db)
 	if err != nil {
 		return nil, err
 	}
+	_, ed25519Key, err := pkcs8Keys()
+	if err != nil {
+		return nil, err
+	}
 	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
-		return privateKeys.Create(ctx, tx, id, "test", []byte{1, 1, 0, 0, 2, 2, 4, 4, 3, 3})
+		return privateKeys.Create(ctx, tx, id, "test", ed25519Key, "ed25519")
 	})
 	if err != nil {
 		return
 	}
-	return b, doWithTx(ctx, db, func(tx *sql.Tx) error {
-		b, err = privateKeys.GetInstanceActor(ctx, tx, "test")
+	return k, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		k, err = privateKeys.GetInstanceActor(ctx, tx, "test")
 		return err
 	})
 }
@@ -1331,12 +3544,104 @@ func runDeliveryAttemptsCalls(ctx util.Context, db *sql.DB) error {
 		if err != nil {
 			return err
 		}
-		fmt.Printf("> NextPage[%d, %s]: len=%d\n", k, last.ID, len(rf))
-		for i, r := range rf {
-			fmt.Printf("> [%d]=%v\n", i, r)
+		fmt.Printf("> NextPage[%d, %s]: len=%d\n", k, last.ID, len(rf))
+		for i, r := range rf {
+			fmt.Printf("> [%d]=%v\n", i, r)
+		}
+	}
+	staleID, rf, err := runDeliveryAttemptsStaleNew(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> FirstPage(stale): len=%d\n", len(rf))
+	if len(rf) == 0 || rf[0].ID != staleID {
+		fmt.Println("FAIL: Expected a stale new attempt to be retryable")
+	}
+	da, err := runDeliveryAttemptsGetByID(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> GetByID: %v\n", da)
+	if string(da.Payload) != testDebuggedPayload || !da.ActivityID.Valid || da.ActivityID.String != testDebuggedActivityIRI || da.DeliverTo.String() != testPeerActor2InboxIRI {
+		fmt.Println("FAIL: Expected the stored payload and metadata")
+	}
+	var signed map[string][]string
+	if err := json.Unmarshal(da.SignedHeaders, &signed); err != nil {
+		return err
+	} else if len(signed["Signature"]) != 1 {
+		fmt.Println("FAIL: Expected the stored signed headers")
+	}
+	ds, err := runDeliveryAttemptsForActivity(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> ForActivity: len=%d\n", len(ds))
+	if len(ds) != 4 {
+		fmt.Println("FAIL: Expected 4 recipients")
+	}
+	for i, d := range ds {
+		fmt.Printf("> [%d]=%v\n", i, d)
+	}
+	return nil
+}
+
+func runDeliveryAttemptsGetByID(ctx util.Context, db *sql.DB) (da models.DeliveryAttempt, err error) {
+	id, err := getUserID(ctx, db)
+	if err != nil {
+		return
+	}
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		daID, err := deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor2InboxIRI), []byte(testDebuggedPayload), false, testDebuggedActivityIRI)
+		if err != nil {
+			return err
+		}
+		if err = deliveryAttempts.SetSignedHeaders(ctx, tx, daID, []byte(testDebuggedSignedHeaders)); err != nil {
+			return err
 		}
+		da, err = deliveryAttempts.GetByID(ctx, tx, daID)
+		return err
+	})
+	return
+}
+
+func runDeliveryAttemptsForActivity(ctx util.Context, db *sql.DB) (ds []models.DeliveryStatus, err error) {
+	id, err := getUserID(ctx, db)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		payload := []byte(`{"id":"` + testDeliveredActivityIRI + `"}`)
+		mark := []func(util.Context, *sql.Tx, string) error{
+			nil,
+			deliveryAttempts.MarkSuccessful,
+			deliveryAttempts.MarkFailed,
+			deliveryAttempts.MarkAbandoned,
+		}
+		to := []string{
+			testPeerActor1InboxIRI,
+			testPeerActor2InboxIRI,
+			testActor2InboxIRI,
+			testActor3InboxIRI,
+		}
+		for i, m := range mark {
+			daID, err := deliveryAttempts.Create(ctx, tx, id, mustParse(to[i]), payload, false, testDeliveredActivityIRI)
+			if err != nil {
+				return err
+			} else if m == nil {
+				continue
+			} else if err := m(ctx, tx, daID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		ds, err = deliveryAttempts.ForActivity(ctx, tx, mustParse(testDeliveredActivityIRI))
+		return err
+	})
+	return
 }
 
 func runDeliveryAttemptsCreate(ctx util.Context, db *sql.DB) (id string, err error) {
@@ -1345,7 +3650,7 @@ func runDeliveryAttemptsCreate(ctx util.Context, db *sql.DB) (id string, err err
 		return "", err
 	}
 	return id, doWithTx(ctx, db, func(tx *sql.Tx) error {
-		id, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello1"))
+		id, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello1"), false, "")
 		return err
 	})
 }
@@ -1357,7 +3662,7 @@ func runDeliveryAttemptsMarkSuccessful(ctx util.Context, db *sql.DB) error {
 	}
 	var daID string
 	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
-		daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello2"))
+		daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello2"), false, "")
 		return err
 	}); err != nil {
 		return err
@@ -1374,7 +3679,7 @@ func runDeliveryAttemptsMarkFailed(ctx util.Context, db *sql.DB) error {
 	}
 	var daID string
 	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
-		daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello3"))
+		daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello3"), false, "")
 		return err
 	}); err != nil {
 		return err
@@ -1391,7 +3696,7 @@ func runDeliveryAttemptsMarkAbandoned(ctx util.Context, db *sql.DB) error {
 	}
 	var daID string
 	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
-		daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello4"))
+		daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello4"), false, "")
 		return err
 	}); err != nil {
 		return err
@@ -1411,7 +3716,7 @@ func runDeliveryAttemptsFirstPage(ctx util.Context, db *sql.DB) (rf []models.Ret
 		// Make 24 additional failed, in addition to the existing one.
 		for i := 0; i < 24; i++ {
 			var daID string
-			daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello_fetch_me"))
+			daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello_fetch_me"), false, "")
 			if err != nil {
 				return err
 			}
@@ -1430,7 +3735,7 @@ func runDeliveryAttemptsFirstPage(ctx util.Context, db *sql.DB) (rf []models.Ret
 		// Make 10 more failed, which should be skipped
 		for i := 0; i < 10; i++ {
 			var daID string
-			daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor2InboxIRI), []byte("hello_no_fetch"))
+			daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor2InboxIRI), []byte("hello_no_fetch"), false, "")
 			if err != nil {
 				return err
 			}
@@ -1444,7 +3749,28 @@ func runDeliveryAttemptsFirstPage(ctx util.Context, db *sql.DB) (rf []models.Ret
 		return
 	}
 	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
-		rf, err = deliveryAttempts.FirstPageFailures(ctx, tx, ft, 10)
+		rf, err = deliveryAttempts.FirstPageFailures(ctx, tx, ft, ft.Add(-time.Hour), 10)
+		return err
+	})
+	return
+}
+
+func runDeliveryAttemptsStaleNew(ctx util.Context, db *sql.DB) (daID string, rf []models.RetryableFailure, err error) {
+	var id string
+	id, err = getUserID(ctx, db)
+	if err != nil {
+		return
+	}
+	if err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		// Never marked, as if lost from the delivery queue.
+		daID, err = deliveryAttempts.Create(ctx, tx, id, mustParse(testPeerActor1InboxIRI), []byte("hello_lost"), false, "")
+		return err
+	}); err != nil {
+		return
+	}
+	later := time.Now().Add(time.Minute)
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		rf, err = deliveryAttempts.FirstPageFailures(ctx, tx, later, later, 1)
 		return err
 	})
 	return
@@ -1452,7 +3778,7 @@ func runDeliveryAttemptsFirstPage(ctx util.Context, db *sql.DB) (rf []models.Ret
 
 func runDeliveryAttemptsNextPage(ctx util.Context, db *sql.DB, prev string, ft time.Time) (rf []models.RetryableFailure, err error) {
 	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
-		rf, err = deliveryAttempts.NextPageFailures(ctx, tx, prev, ft, 10)
+		rf, err = deliveryAttempts.NextPageFailures(ctx, tx, prev, ft, ft.Add(-time.Hour), 10)
 		return err
 	})
 	return
@@ -1524,6 +3850,9 @@ func runOutboxesCalls(ctx util.Context, db *sql.DB) error {
 	} else {
 		fmt.Printf("> JSON:\n%s\n", pb)
 	}
+	if err := runOutboxesGetOutboxByType(ctx, db); err != nil {
+		return err
+	}
 	if err := runOutboxesPrependOutboxItem(ctx, db); err != nil {
 		return err
 	}
@@ -1605,6 +3934,57 @@ func runOutboxesGetLastPage(ctx util.Context, db *sql.DB, n int) (p models.Activ
 	})
 }
 
+func runOutboxesGetOutboxByType(ctx util.Context, db *sql.DB) error {
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for _, a := range testTypedActivities {
+			if err := localData.Create(ctx, tx, models.ActivityStreams{a}); err != nil {
+				return err
+			}
+		}
+		return outboxes.Create(ctx, tx, mustParse(testTypedActorIRI), testTypedOutbox)
+	}); err != nil {
+		return err
+	}
+	// Only the Create and Announce activities are paged through, in their
+	// outbox order, and only the last of their pages is the end. Every page
+	// counts all three of them.
+	types := []string{"Create", "Announce"}
+	want := []struct {
+		min, max int
+		ids      []string
+		isEnd    bool
+	}{
+		{0, 2, []string{"https://example.com/activities/typed0", "https://example.com/activities/typed2"}, false},
+		{2, 4, []string{"https://example.com/activities/typed3"}, true},
+		{4, 6, nil, true},
+	}
+	for _, w := range want {
+		var p models.ActivityStreamsOrderedCollectionPage
+		var isEnd bool
+		err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+			p, isEnd, err = outboxes.GetPageByType(ctx, tx, mustParse(testTypedOutboxIRI), types, w.min, w.max)
+			return
+		})
+		if err != nil {
+			return err
+		}
+		var ids []string
+		if oi := p.GetActivityStreamsOrderedItems(); oi != nil {
+			for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+				ids = append(ids, iter.GetIRI().String())
+			}
+		}
+		fmt.Printf("> GetOutboxByType(%v, %d, %d): %v %v\n", types, w.min, w.max, ids, isEnd)
+		if strings.Join(ids, ",") != strings.Join(w.ids, ",") || isEnd != w.isEnd {
+			return fmt.Errorf("GetOutboxByType(%v, %d, %d): got %v %v, want %v %v", types, w.min, w.max, ids, isEnd, w.ids, w.isEnd)
+		}
+		if ti := p.GetActivityStreamsTotalItems(); ti == nil || ti.Get() != 3 {
+			return fmt.Errorf("GetOutboxByType(%v, %d, %d): totalItems is not 3: %v", types, w.min, w.max, ti)
+		}
+	}
+	return nil
+}
+
 func runOutboxesGetPublicLastPage(ctx util.Context, db *sql.DB, n int) (p models.ActivityStreamsOrderedCollectionPage, idx int, err error) {
 	return p, idx, doWithTx(ctx, db, func(tx *sql.Tx) error {
 		p, idx, err = outboxes.GetPublicLastPage(ctx, tx, mustParse(testActor3OutboxIRI), n)
@@ -1703,9 +4083,37 @@ func runInboxesCalls(ctx util.Context, db *sql.DB) error {
 	if err := runInboxesDeleteInboxItem(ctx, db); err != nil {
 		return err
 	}
+	deleted, err := runFedDataDeleteIfUnreferenced(ctx, db, testActivity1IRI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> FedData.DeleteIfUnreferenced(%s): %v\n", testActivity1IRI, deleted)
+	if deleted {
+		fmt.Println("FAIL: Expected referenced fed data to be retained")
+	}
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return fedData.Create(ctx, tx, models.ActivityStreams{testActivity9})
+	}); err != nil {
+		return err
+	}
+	deleted, err = runFedDataDeleteIfUnreferenced(ctx, db, testActivity9IRI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> FedData.DeleteIfUnreferenced(%s): %v\n", testActivity9IRI, deleted)
+	if !deleted {
+		fmt.Println("FAIL: Expected unreferenced fed data to be deleted")
+	}
 	return nil
 }
 
+func runFedDataDeleteIfUnreferenced(ctx util.Context, db *sql.DB, id string) (deleted bool, err error) {
+	return deleted, doWithTx(ctx, db, func(tx *sql.Tx) error {
+		deleted, err = fedData.DeleteIfUnreferenced(ctx, tx, mustParse(id))
+		return err
+	})
+}
+
 func runInboxesCreateInbox(ctx util.Context, db *sql.DB) error {
 	return doWithTx(ctx, db, func(tx *sql.Tx) error {
 		return inboxes.Create(ctx, tx, mustParse(testActor1IRI), testActor1Inbox)
@@ -1834,6 +4242,19 @@ func runLocalDataCalls(ctx util.Context, db *sql.DB) error {
 		return err
 	}
 	fmt.Printf("> Exists(%s): %v\n", testActivity5IRI, ex)
+	created, err := runLocalDataCreateTime(ctx, db, testActivity4IRI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> CreateTime(%s): %v\n", testActivity4IRI, created)
+	if created.IsZero() {
+		fmt.Println("FAIL: Expected a create time")
+	}
+	_, err = runLocalDataCreateTime(ctx, db, testActivity5IRI)
+	fmt.Printf("> CreateTime(%s): %v\n", testActivity5IRI, err)
+	if !errors.Is(err, models.ErrNotFound) {
+		fmt.Println("FAIL: Expected the deleted data to not be found")
+	}
 	st, err := runLocalDataStats(ctx, db)
 	if err != nil {
 		return err
@@ -1844,6 +4265,153 @@ func runLocalDataCalls(ctx util.Context, db *sql.DB) error {
 	} else {
 		fmt.Printf("> JSON:\n%s\n", pb)
 	}
+	return runLocalDataTombstoneCalls(ctx, db)
+}
+
+// runPublicTimelineCalls stores public and private notes, locally and from a
+// peer, and ensures each timeline has only the public notes in its scope,
+// whichever form of the Public IRI they are addressed to.
+func runPublicTimelineCalls(ctx util.Context, db *sql.DB) error {
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		if err := localData.Create(ctx, tx, models.ActivityStreams{timelineNote(testTimelineLocalNoteIRI, pub.PublicActivityPubIRI)}); err != nil {
+			return err
+		}
+		if err := localData.Create(ctx, tx, models.ActivityStreams{timelineNote(testTimelinePrivateNoteIRI, testActor1FollowersIRI)}); err != nil {
+			return err
+		}
+		if err := localData.Create(ctx, tx, models.ActivityStreams{timelineNote(testTimelineShortNoteIRI, "Public")}); err != nil {
+			return err
+		}
+		if err := fedData.Create(ctx, tx, models.ActivityStreams{timelineNote(testTimelineCompactNoteIRI, "as:Public")}); err != nil {
+			return err
+		}
+		return fedData.Create(ctx, tx, models.ActivityStreams{timelineNote(testTimelineFedNoteIRI, pub.PublicActivityPubIRI)})
+	}); err != nil {
+		return err
+	}
+	all := []string{testTimelineLocalNoteIRI, testTimelinePrivateNoteIRI, testTimelineShortNoteIRI, testTimelineCompactNoteIRI, testTimelineFedNoteIRI}
+	for _, w := range []struct {
+		federated bool
+		types     []string
+		want      []string
+	}{
+		{false, []string{"Note"}, []string{testTimelineLocalNoteIRI, testTimelineShortNoteIRI}},
+		{true, []string{"Note"}, []string{testTimelineLocalNoteIRI, testTimelineShortNoteIRI, testTimelineCompactNoteIRI, testTimelineFedNoteIRI}},
+		{true, nil, []string{testTimelineLocalNoteIRI, testTimelineShortNoteIRI, testTimelineCompactNoteIRI, testTimelineFedNoteIRI}},
+		{true, []string{"Create"}, nil},
+	} {
+		var as []models.ActivityStreams
+		if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+			if w.federated {
+				as, err = fedData.PublicTimeline(ctx, tx, w.types, nil, 100)
+			} else {
+				as, err = localData.PublicTimeline(ctx, tx, w.types, nil, 100)
+			}
+			return
+		}); err != nil {
+			return err
+		}
+		got := make(map[string]bool)
+		for _, a := range as {
+			if id, err := pub.GetId(a.Type); err == nil {
+				got[id.String()] = true
+			}
+		}
+		want := make(map[string]bool)
+		for _, id := range w.want {
+			want[id] = true
+		}
+		fmt.Printf("> PublicTimeline(federated=%v, %v): %d items\n", w.federated, w.types, len(as))
+		for _, id := range all {
+			if got[id] != want[id] {
+				fmt.Printf("FAIL: PublicTimeline(federated=%v, %v) has %s: got %v, want %v\n", w.federated, w.types, id, got[id], want[id])
+			}
+		}
+	}
+	// Paging through the federated timeline one at a time, each page older
+	// than the last item of the one before, visits each item once.
+	var paged []string
+	var maxID *url.URL
+	for i := 0; i < 100; i++ {
+		var as []models.ActivityStreams
+		if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+			as, err = fedData.PublicTimeline(ctx, tx, []string{"Note"}, maxID, 1)
+			return
+		}); err != nil {
+			return err
+		} else if len(as) == 0 {
+			break
+		}
+		id, err := pub.GetId(as[0].Type)
+		if err != nil {
+			return err
+		}
+		paged = append(paged, id.String())
+		maxID = id
+	}
+	seen := make(map[string]bool)
+	for _, id := range paged {
+		if seen[id] {
+			fmt.Printf("FAIL: PublicTimeline paging visited %s more than once\n", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != 4 {
+		fmt.Printf("FAIL: PublicTimeline paging visited %v, want the 4 public notes\n", paged)
+	}
+	return nil
+}
+
+// timelineNote is a note addressed to the recipient.
+func timelineNote(id, to string) vocab.ActivityStreamsNote {
+	note := streams.NewActivityStreamsNote()
+	idp := streams.NewJSONLDIdProperty()
+	idp.Set(mustParse(id))
+	note.SetJSONLDId(idp)
+	top := streams.NewActivityStreamsToProperty()
+	top.AppendIRI(mustParse(to))
+	note.SetActivityStreamsTo(top)
+	content := streams.NewActivityStreamsContentProperty()
+	content.AppendXMLSchemaString("timeline")
+	note.SetActivityStreamsContent(content)
+	return note
+}
+
+func runLocalDataTombstoneCalls(ctx util.Context, db *sql.DB) error {
+	// The update of testActivity5 left testActivity6 in the table.
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		return localData.Tombstone(ctx, tx, mustParse(testActivity6IRI), time.Now())
+	}); err != nil {
+		return err
+	}
+	var v models.ActivityStreams
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		v, err = localData.Get(ctx, tx, mustParse(testActivity6IRI))
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Get (tombstoned): %v\n", v)
+	if pb, err := toJSON(v); err != nil {
+		return err
+	} else {
+		fmt.Printf("> JSON:\n%s\n", pb)
+	}
+	if tomb, ok := v.Type.(vocab.ActivityStreamsTombstone); !ok {
+		fmt.Println("FAIL: Expected a Tombstone")
+	} else if ft := tomb.GetActivityStreamsFormerType(); ft == nil || ft.Len() != 1 || ft.At(0).GetXMLSchemaString() != "Accept" {
+		fmt.Println("FAIL: Expected formerType Accept")
+	} else if tomb.GetActivityStreamsDeleted() == nil {
+		fmt.Println("FAIL: Expected deleted to be set")
+	}
+	ex, err := runLocalDataExists(ctx, db, testActivity6IRI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Exists(%s) (tombstoned): %v\n", testActivity6IRI, ex)
+	if !ex {
+		fmt.Println("FAIL: Expected the Tombstone to exist")
+	}
 	return nil
 }
 
@@ -1891,6 +4459,14 @@ func runLocalDataExists(ctx util.Context, db *sql.DB, id string) (v bool, err er
 	return
 }
 
+func runLocalDataCreateTime(ctx util.Context, db *sql.DB, id string) (created time.Time, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		created, err = localData.CreateTime(ctx, tx, mustParse(id))
+		return err
+	})
+	return
+}
+
 func runLocalDataStats(ctx util.Context, db *sql.DB) (st models.LocalDataActivity, err error) {
 	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
 		st, err = localData.Stats(ctx, tx)
@@ -1931,9 +4507,51 @@ func runFedDataCalls(ctx util.Context, db *sql.DB) error {
 		return err
 	}
 	fmt.Printf("> Exists(%s): %v\n", testActivity2IRI, ex)
+	return runFedDataTombstoneCalls(ctx, db)
+}
+
+func runFedDataTombstoneCalls(ctx util.Context, db *sql.DB) error {
+	// The update of testActivity2 left testActivity3 in the table.
+	ts, err := runFedDataTombstone(ctx, db, testActivity3IRI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Tombstone(%s): %v\n", testActivity3IRI, ts)
+	if !ts {
+		fmt.Println("FAIL: Expected the cached data to be tombstoned")
+	}
+	var v models.ActivityStreams
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		v, err = fedData.Get(ctx, tx, mustParse(testActivity3IRI))
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> Get (tombstoned): %v\n", v)
+	if tomb, ok := v.Type.(vocab.ActivityStreamsTombstone); !ok {
+		fmt.Println("FAIL: Expected a Tombstone")
+	} else if ft := tomb.GetActivityStreamsFormerType(); ft == nil || ft.Len() != 1 || ft.At(0).GetXMLSchemaString() != "Listen" {
+		fmt.Println("FAIL: Expected formerType Listen")
+	}
+	ts, err = runFedDataTombstone(ctx, db, testActivity2IRI)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> Tombstone(%s) (not cached): %v\n", testActivity2IRI, ts)
+	if ts {
+		fmt.Println("FAIL: Expected nothing to be tombstoned")
+	}
 	return nil
 }
 
+func runFedDataTombstone(ctx util.Context, db *sql.DB, id string) (ts bool, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		ts, err = fedData.Tombstone(ctx, tx, mustParse(id), time.Now())
+		return err
+	})
+	return
+}
+
 func runFedDataCreate(ctx util.Context, db *sql.DB) error {
 	return doWithTx(ctx, db, func(tx *sql.Tx) error {
 		return fedData.Create(ctx, tx, models.ActivityStreams{testActivity1})
@@ -1989,6 +4607,9 @@ func runUserModelCalls(ctx util.Context, db *sql.DB) error {
 	if err := runUserModelUpdateActor(ctx, db, userID); err != nil {
 		return err
 	}
+	if err := runUserModelMissingActorProperty(ctx, db, userID); err != nil {
+		return err
+	}
 	s, err := runUserModelSensitiveUserByEmail(ctx, db)
 	if err != nil {
 		return err
@@ -2026,6 +4647,9 @@ func runUserModelCalls(ctx util.Context, db *sql.DB) error {
 		return err
 	}
 	fmt.Printf("> ActorIDForInbox: %s\n", id.URL)
+	if err := runUserModelNotFound(ctx, db); err != nil {
+		return err
+	}
 	if err := runUserModelUpdatePreferences(ctx, db, userID); err != nil {
 		return err
 	}
@@ -2055,6 +4679,26 @@ func runUserModelCalls(ctx util.Context, db *sql.DB) error {
 	} else {
 		fmt.Printf("> JSON:\n%s\n", pb)
 	}
+	for _, tc := range []struct {
+		name   string
+		a      *models.Announcement
+		active bool
+	}{
+		{"active", &models.Announcement{Text: testAnnouncement, Start: time.Now().Add(-time.Hour)}, true},
+		{"expired", &models.Announcement{Text: testAnnouncement, End: time.Now().Add(-time.Minute)}, false},
+		{"scheduled", &models.Announcement{Text: testAnnouncement, Start: time.Now().Add(time.Hour)}, false},
+	} {
+		iap, err := runUserModelAnnouncement(ctx, db, tc.a)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("> Announcement (%s): %v\n", tc.name, iap.Announcement)
+		if iap.Announcement == nil || iap.Announcement.Text != testAnnouncement {
+			fmt.Println("FAIL: Expected the announcement to be stored")
+		} else if iap.Announcement.Active(time.Now()) != tc.active {
+			fmt.Printf("FAIL: Expected the announcement to be active=%v\n", tc.active)
+		}
+	}
 	st, err := runUserModelUserActivityStats(ctx, db)
 	if err != nil {
 		return err
@@ -2065,6 +4709,62 @@ func runUserModelCalls(ctx util.Context, db *sql.DB) error {
 	} else {
 		fmt.Printf("> JSON:\n%s\n", pb)
 	}
+	now := time.Now()
+	sr, err := runUserModelUserActivityStatsRange(ctx, db, now.Add(-48*time.Hour), now, "day")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> UserActivityStatsRange: %v\n", sr)
+	if len(sr) != 3 {
+		return fmt.Errorf("expected 3 daily buckets, got %d", len(sr))
+	}
+	var nNew int
+	for i, b := range sr {
+		if i > 0 && !b.Start.After(sr[i-1].Start) {
+			return fmt.Errorf("buckets are not in ascending order: %v", sr)
+		}
+		nNew += b.NewUsers
+	}
+	if nNew != st.TotalUsers {
+		return fmt.Errorf("expected %d new users across buckets, got %d", st.TotalUsers, nNew)
+	}
+	// A Create, its Note, a reply and a Like add exactly one post to the
+	// current bucket.
+	before := sr[len(sr)-1].NewPosts
+	create := retentionCreate(testStatsCreateIRI)
+	reply := timelineNote(testStatsReplyIRI, pub.PublicActivityPubIRI)
+	irt := streams.NewActivityStreamsInReplyToProperty()
+	irt.AppendIRI(mustParse(testStatsCreateIRI + "/note"))
+	reply.SetActivityStreamsInReplyTo(irt)
+	like := streams.NewActivityStreamsLike()
+	idP := streams.NewJSONLDIdProperty()
+	idP.Set(mustParse(testStatsLikeIRI))
+	like.SetJSONLDId(idP)
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		for _, v := range []vocab.Type{
+			create,
+			create.GetActivityStreamsObject().At(0).GetActivityStreamsNote(),
+			reply,
+			like,
+		} {
+			if err := localData.Create(ctx, tx, models.ActivityStreams{v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	sr, err = runUserModelUserActivityStatsRange(ctx, db, now.Add(-48*time.Hour), time.Now().Add(time.Minute), "day")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("> UserActivityStatsRange (posts): %v\n", sr)
+	if len(sr) == 0 {
+		return fmt.Errorf("expected daily buckets, got none")
+	} else if after := sr[len(sr)-1].NewPosts; after != before+1 {
+		return fmt.Errorf("expected 1 new post in the current bucket, got %d", after-before)
+	}
 	return nil
 }
 
@@ -2089,6 +4789,35 @@ func runUserModelUpdateActor(ctx util.Context, db *sql.DB, userID string) error
 	})
 }
 
+// runUserModelMissingActorProperty ensures users are found by a property their
+// actor lacks, and not by one it has.
+func runUserModelMissingActorProperty(ctx util.Context, db *sql.DB, userID string) error {
+	has := func(us []models.User) bool {
+		for _, u := range us {
+			if u.ID == userID {
+				return true
+			}
+		}
+		return false
+	}
+	var missing, present []models.User
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) (err error) {
+		missing, err = users.MissingActorProperty(ctx, tx, "featured")
+		if err != nil {
+			return
+		}
+		present, err = users.MissingActorProperty(ctx, tx, "id")
+		return
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> MissingActorProperty: featured=%v id=%v\n", has(missing), has(present))
+	if !has(missing) || has(present) {
+		fmt.Println("FAIL: Expected only the user missing the featured property")
+	}
+	return nil
+}
+
 func runUserModelSensitiveUserByEmail(ctx util.Context, db *sql.DB) (s *models.SensitiveUser, err error) {
 	var tx *sql.Tx
 	tx, err = db.BeginTx(ctx, nil)
@@ -2102,6 +4831,21 @@ func runUserModelSensitiveUserByEmail(ctx util.Context, db *sql.DB) (s *models.S
 	return s, tx.Commit()
 }
 
+// runUserModelNotFound ensures the lookups expecting a single row report when
+// there is none.
+func runUserModelNotFound(ctx util.Context, db *sql.DB) error {
+	return doWithTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := users.SensitiveUserByEmail(ctx, tx, "unknown@example.com"); !errors.Is(err, models.ErrNotFound) {
+			return fmt.Errorf("SensitiveUserByEmail of unknown email: expected ErrNotFound, got %v", err)
+		}
+		if _, err := users.ActorIDForInbox(ctx, tx, mustParse(testActivity1IRI)); !errors.Is(err, models.ErrNotFound) {
+			return fmt.Errorf("ActorIDForInbox of unknown inbox: expected ErrNotFound, got %v", err)
+		}
+		fmt.Println("> NotFound: ErrNotFound returned")
+		return nil
+	})
+}
+
 func runUserModelUserByPreferredUsername(ctx util.Context, db *sql.DB) (s *models.User, err error) {
 	var tx *sql.Tx
 	tx, err = db.BeginTx(ctx, nil)
@@ -2157,12 +4901,31 @@ func runUserModelActorIDForInbox(ctx util.Context, db *sql.DB) (id models.URL, e
 
 func runUserModelUpdatePreferences(ctx util.Context, db *sql.DB, id string) error {
 	pref := models.Preferences{
-		OnFollow: models.OnFollowBehavior(pub.OnFollowAutomaticallyAccept),
-		Payload:  []byte(`{"test":"pref"}`),
+		OnFollow:                models.OnFollowBehavior(pub.OnFollowAutomaticallyAccept),
+		AutoAcceptMutualFollows: true,
+		FollowMovedActors:       true,
+		Payload:                 []byte(`{"test":"pref"}`),
 	}
-	return doWithTx(ctx, db, func(tx *sql.Tx) error {
-		return users.UpdatePreferences(ctx, tx, id, pref)
-	})
+	var u *models.User
+	if err := doWithTx(ctx, db, func(tx *sql.Tx) error {
+		if err := users.UpdatePreferences(ctx, tx, id, pref); err != nil {
+			return err
+		}
+		var err error
+		u, err = users.UserByID(ctx, tx, id)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("> UpdatePreferences: AutoAcceptMutualFollows=%v\n", u.Preferences.AutoAcceptMutualFollows)
+	if !u.Preferences.AutoAcceptMutualFollows {
+		fmt.Println("FAIL: Expected accepting mutual follows to be stored")
+	}
+	fmt.Printf("> UpdatePreferences: FollowMovedActors=%v\n", u.Preferences.FollowMovedActors)
+	if !u.Preferences.FollowMovedActors {
+		fmt.Println("FAIL: Expected following moved actors to be stored")
+	}
+	return nil
 }
 
 func runUserModelUpdatePrivileges(ctx util.Context, db *sql.DB, id string) error {
@@ -2219,6 +4982,21 @@ func runUserModelInstanceActorPreferences(ctx util.Context, db *sql.DB) (iap mod
 	return
 }
 
+func runUserModelAnnouncement(ctx util.Context, db *sql.DB, a *models.Announcement) (iap models.InstanceActorPreferences, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		if iap, err = users.InstanceActorPreferences(ctx, tx); err != nil {
+			return err
+		}
+		iap.Announcement = a
+		if err = users.SetInstanceActorPreferences(ctx, tx, iap); err != nil {
+			return err
+		}
+		iap, err = users.InstanceActorPreferences(ctx, tx)
+		return err
+	})
+	return
+}
+
 func runUserModelUserActivityStats(ctx util.Context, db *sql.DB) (st models.UserActivityStats, err error) {
 	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
 		st, err = users.ActivityStats(ctx, tx)
@@ -2227,6 +5005,14 @@ func runUserModelUserActivityStats(ctx util.Context, db *sql.DB) (st models.User
 	return
 }
 
+func runUserModelUserActivityStatsRange(ctx util.Context, db *sql.DB, from, to time.Time, bucket string) (b []models.UserActivityBucket, err error) {
+	err = doWithTx(ctx, db, func(tx *sql.Tx) error {
+		b, err = users.ActivityStatsRange(ctx, tx, from, to, bucket)
+		return err
+	})
+	return
+}
+
 /* Models */
 
 func createTables(ctx util.Context, db *sql.DB, d models.SqlDialect) error {
@@ -2244,10 +5030,27 @@ func createTables(ctx util.Context, db *sql.DB, d models.SqlDialect) error {
 }
 
 func prepareStatements(ctx util.Context, db *sql.DB, d models.SqlDialect) error {
-	for _, m := range testModels {
-		if err := m.Prepare(db, d); err != nil {
-			return err
-		}
+	services.RegisterSqlDialect(db, d)
+	return models.PrepareAll(db, d, testModels)
+}
+
+// malformedDialect is a SqlDialect whose InsertUser statement is malformed.
+type malformedDialect struct {
+	models.SqlDialect
+}
+
+func (malformedDialect) InsertUser() string {
+	return "INSERT INTO WHERE"
+}
+
+func prepareMalformedStatements(ctx util.Context, db *sql.DB, d models.SqlDialect) error {
+	u := &models.Users{}
+	err := u.Prepare(db, malformedDialect{d})
+	pe, ok := err.(models.PrepareErrors)
+	if !ok {
+		return fmt.Errorf("expected PrepareErrors preparing malformed statement, got: %v", err)
+	} else if len(pe) != 1 || pe[0].Statement != "InsertUser" {
+		return fmt.Errorf("expected only InsertUser to fail to prepare, got: %s", pe)
 	}
 	return nil
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/models"
@@ -33,6 +34,8 @@ var (
 	testActor1Outbox            models.ActivityStreamsOrderedCollection
 	testActor2Outbox            models.ActivityStreamsOrderedCollection
 	testActor3Outbox            models.ActivityStreamsOrderedCollection
+	testTypedOutbox             models.ActivityStreamsOrderedCollection
+	testTypedActivities         []vocab.Type                  // Local, mixed types
 	testActivity1               vocab.ActivityStreamsMove     // Federated
 	testActivity2               vocab.ActivityStreamsCreate   // Federated
 	testActivity3               vocab.ActivityStreamsListen   // Federated
@@ -41,6 +44,7 @@ var (
 	testActivity6               vocab.ActivityStreamsAccept   // Local
 	testActivity7               vocab.ActivityStreamsListen   // Federated, Public
 	testActivity8               vocab.ActivityStreamsAccept   // Local, Public
+	testActivity9               vocab.ActivityStreamsLike     // Federated, Unreferenced
 	testActor1Followers         models.ActivityStreamsCollection
 	testActor2Followers         models.ActivityStreamsCollection
 	testActor3Followers         models.ActivityStreamsCollection
@@ -48,6 +52,10 @@ var (
 	testActor2Following         models.ActivityStreamsCollection
 	testActor3Following         models.ActivityStreamsCollection
 	testActor1Liked             models.ActivityStreamsCollection
+	testActor1FeaturedTags      models.ActivityStreamsCollection
+	testActor1Featured          models.ActivityStreamsCollection
+	testNote1Shares             models.ActivityStreamsCollection
+	testNote1Replies            models.ActivityStreamsCollection
 	testActor2Liked             models.ActivityStreamsCollection
 	testActor3Liked             models.ActivityStreamsCollection
 	testFollow1Actor2           vocab.ActivityStreamsFollow // Federated
@@ -60,53 +68,151 @@ var (
 	testRejectFollowActor2      vocab.ActivityStreamsReject // Local
 	testAcceptLocalFollowActor2 vocab.ActivityStreamsAccept // Local
 	testRejectLocalFollowActor2 vocab.ActivityStreamsReject // Local
+	testPendingFollowActor1     vocab.ActivityStreamsFollow // Local
+	testAcceptPendingFollow     vocab.ActivityStreamsAccept // Federated
+	testForgedAcceptFollow      vocab.ActivityStreamsAccept // Federated
 )
 
 const (
-	testActor1PreferredUsername = "testPreferredUsername"
-	testEmail1                  = "test@example.com"
-	testActor1IRI               = "https://example.com/actors/test1"
-	testActor2IRI               = "https://example.com/actors/test2"
-	testActor3IRI               = "https://example.com/actors/test3"
-	testPeerActor1IRI           = "https://fed.example.com/actors/test1"
-	testPeerActor2IRI           = "https://fed.example.com/actors/test2"
-	testPeerActor1InboxIRI      = "https://fed.example.com/actors/test1/inbox"
-	testPeerActor2InboxIRI      = "https://fed.example.com/actors/test2/inbox"
-	testActor1InboxIRI          = "https://example.com/actors/test1/inbox"
-	testActor2InboxIRI          = "https://example.com/actors/test2/inbox"
-	testActor3InboxIRI          = "https://example.com/actors/test3/inbox"
-	testActor1OutboxIRI         = "https://example.com/actors/test1/outbox"
-	testActor2OutboxIRI         = "https://example.com/actors/test2/outbox"
-	testActor3OutboxIRI         = "https://example.com/actors/test3/outbox"
-	testActivity1IRI            = "https://fed.example.com/activities/test1"
-	testActivity2IRI            = "https://fed.example.com/activities/test2"
-	testActivity3IRI            = "https://fed.example.com/activities/test3"
-	testActivity4IRI            = "https://example.com/activities/test4"
-	testActivity5IRI            = "https://example.com/activities/test5"
-	testActivity6IRI            = "https://example.com/activities/test6"
-	testActivity7IRI            = "https://fed.example.com/activities/test7"
-	testActivity8IRI            = "https://example.com/activities/test8"
-	testActor1FollowersIRI      = "https://example.com/actors/test1/followers"
-	testActor2FollowersIRI      = "https://example.com/actors/test2/followers"
-	testActor3FollowersIRI      = "https://example.com/actors/test3/followers"
-	testActor1FollowingIRI      = "https://example.com/actors/test1/following"
-	testActor2FollowingIRI      = "https://example.com/actors/test2/following"
-	testActor3FollowingIRI      = "https://example.com/actors/test3/following"
-	testActor1LikedIRI          = "https://example.com/actors/test1/liked"
-	testActor2LikedIRI          = "https://example.com/actors/test2/liked"
-	testActor3LikedIRI          = "https://example.com/actors/test3/liked"
-	testFollow1IRI              = "https://fed.example.com/follows/test1"
-	testFollow2IRI              = "https://fed.example.com/follows/test2"
-	testFollow3IRI              = "https://example.com/follows/test3"
-	testFollow4IRI              = "https://example.com/follows/test4"
-	testFollow5IRI              = "https://fed.example.com/follows/test5"
-	testFollow6IRI              = "https://example.com/follows/test6"
-	testAccept1IRI              = "https://example.com/accepts/test1"
-	testAccept2IRI              = "https://example.com/accepts/test2"
-	testReject1IRI              = "https://example.com/rejects/test1"
-	testReject2IRI              = "https://example.com/rejects/test2"
+	testActor1PreferredUsername   = "testPreferredUsername"
+	testEmail1                    = "test@example.com"
+	testActor1IRI                 = "https://example.com/actors/test1"
+	testActor2IRI                 = "https://example.com/actors/test2"
+	testActor3IRI                 = "https://example.com/actors/test3"
+	testPeerActor1IRI             = "https://fed.example.com/actors/test1"
+	testPeerActor2IRI             = "https://fed.example.com/actors/test2"
+	testPeerActor1InboxIRI        = "https://fed.example.com/actors/test1/inbox"
+	testPeerActor2InboxIRI        = "https://fed.example.com/actors/test2/inbox"
+	testActor1InboxIRI            = "https://example.com/actors/test1/inbox"
+	testActor2InboxIRI            = "https://example.com/actors/test2/inbox"
+	testActor3InboxIRI            = "https://example.com/actors/test3/inbox"
+	testDeliveredActivityIRI      = "https://example.com/activities/delivered1"
+	testAnnouncement              = "Scheduled maintenance tonight"
+	testDebuggedActivityIRI       = "https://example.com/activities/debugged1"
+	testDebuggedPayload           = `{"id":"https://example.com/activities/debugged1","type":"Create"}`
+	testDebuggedSignedHeaders     = `{"Date":["Mon, 02 Jan 2006 15:04:05 GMT"],"Signature":["keyId=\"https://example.com/actors/test1#main-key\""]}`
+	testMediaContentType          = "image/png"
+	testMediaPath                 = "test1/media1"
+	testMediaSize                 = 1024
+	testMediaUnknownID            = "00000000-0000-0000-0000-000000000000"
+	testMediaThumbnailDim         = 400
+	testMediaThumbnailSize        = 256
+	testMediaThumbnailPath        = "test1/media1.thumb400"
+	testDomain                    = "fed.example.com"
+	testEmojiShortcode            = "blobcat"
+	testEmojiImageIRI             = "https://example.com/media/blobcat.png"
+	testEmojiMediaType            = "image/png"
+	testEmojiNoteIRI              = "https://fed.example.com/notes/emoji1"
+	testInviteSingleUseCode       = "invite-single-use"
+	testInviteExpiredCode         = "invite-expired"
+	testInviteConcurrentCode      = "invite-concurrent"
+	testInviteConcurrentMaxUses   = 3
+	testInviteConsumers           = 10
+	testReportFlagIRI             = "https://fed.example.com/flags/1"
+	testReportReporterIRI         = "https://fed.example.com/actor"
+	testReportObjectIRI           = "https://example.com/notes/1"
+	testReportComment             = "spam"
+	testRelayInboxIRI             = "https://relay.example.net/inbox"
+	testRelayActorIRI             = "https://relay.example.net/actor"
+	testRelayFollowIRI            = "https://example.com/follows/relay"
+	testActor1OutboxIRI           = "https://example.com/actors/test1/outbox"
+	testActor2OutboxIRI           = "https://example.com/actors/test2/outbox"
+	testActor3OutboxIRI           = "https://example.com/actors/test3/outbox"
+	testTypedActorIRI             = "https://example.com/actors/typed"
+	testTypedOutboxIRI            = "https://example.com/actors/typed/outbox"
+	testRetentionActorIRI         = "https://example.com/actors/retention"
+	testRetentionOutboxIRI        = "https://example.com/actors/retention/outbox"
+	testRetentionOtherActorIRI    = "https://example.com/actors/retention-other"
+	testRetentionOtherOutboxIRI   = "https://example.com/actors/retention-other/outbox"
+	testRetentionArchivedIRI      = "https://example.com/activities/retention-archived"
+	testRetentionTombstonedIRI    = "https://example.com/activities/retention-tombstoned"
+	testRetentionNewIRI           = "https://example.com/activities/retention-new"
+	testTxOuterIRI                = "https://example.com/notes/tx-outer"
+	testPostLimitActorIRI         = "https://example.com/actors/post-limit"
+	testTxFailedIRI               = "https://example.com/notes/tx-failed"
+	testTxNestedIRI               = "https://example.com/notes/tx-nested"
+	testTxLeakedIRI               = "https://example.com/notes/tx-leaked"
+	testStatsCreateIRI            = "https://example.com/activities/stats-create"
+	testStatsReplyIRI             = "https://example.com/notes/stats-reply"
+	testStatsLikeIRI              = "https://example.com/activities/stats-like"
+	testAliasNoteIRI              = "https://example.com/notes/alias"
+	testEnsuredServerName         = "ensured server name"
+	testSharedInboxIRI            = "https://shared.example.com/inbox"
+	testSharedInboxOtherIRI       = "https://shared.example.com/other-inbox"
+	testSharedInboxActor1InboxIRI = "https://shared.example.com/actors/1/inbox"
+	testSharedInboxActor2IRI      = "https://shared.example.com/actors/2"
+	testSharedInboxActor2InboxIRI = "https://shared.example.com/actors/2/inbox"
+	testSharedInboxActor3InboxIRI = "https://shared.example.com/actors/3/inbox"
+	testActivity1IRI              = "https://fed.example.com/activities/test1"
+	testActivity2IRI              = "https://fed.example.com/activities/test2"
+	testActivity3IRI              = "https://fed.example.com/activities/test3"
+	testActivity4IRI              = "https://example.com/activities/test4"
+	testActivity5IRI              = "https://example.com/activities/test5"
+	testActivity6IRI              = "https://example.com/activities/test6"
+	testActivity7IRI              = "https://fed.example.com/activities/test7"
+	testActivity8IRI              = "https://example.com/activities/test8"
+	testActivity9IRI              = "https://fed.example.com/activities/test9"
+	testTimelineLocalNoteIRI      = "https://example.com/notes/timeline-public"
+	testTimelinePrivateNoteIRI    = "https://example.com/notes/timeline-private"
+	testTimelineFedNoteIRI        = "https://fed.example.com/notes/timeline-public"
+	testTimelineCompactNoteIRI    = "https://fed.example.com/notes/timeline-compact"
+	testTimelineShortNoteIRI      = "https://example.com/notes/timeline-short"
+	testActor1FollowersIRI        = "https://example.com/actors/test1/followers"
+	testActor2FollowersIRI        = "https://example.com/actors/test2/followers"
+	testActor3FollowersIRI        = "https://example.com/actors/test3/followers"
+	testActor1FollowingIRI        = "https://example.com/actors/test1/following"
+	testActor2FollowingIRI        = "https://example.com/actors/test2/following"
+	testActor3FollowingIRI        = "https://example.com/actors/test3/following"
+	testActor1LikedIRI            = "https://example.com/actors/test1/liked"
+	testActor1FeaturedTagsIRI     = "https://example.com/actors/test1/featuredTags"
+	testTag1IRI                   = "https://example.com/tags/test1"
+	testActor1FeaturedIRI         = "https://example.com/actors/test1/featured"
+	testNote1IRI                  = "https://example.com/notes/shared1"
+	testNote1SharesIRI            = "https://example.com/notes/shared1/shares"
+	testAnnounce1IRI              = "https://fed.example.com/announces/test1"
+	testNote1RepliesIRI           = "https://example.com/notes/shared1/replies"
+	testReply1IRI                 = "https://fed.example.com/notes/reply1"
+	testActor2LikedIRI            = "https://example.com/actors/test2/liked"
+	testActor3LikedIRI            = "https://example.com/actors/test3/liked"
+	testFollow1IRI                = "https://fed.example.com/follows/test1"
+	testFollow2IRI                = "https://fed.example.com/follows/test2"
+	testFollow3IRI                = "https://example.com/follows/test3"
+	testFollow4IRI                = "https://example.com/follows/test4"
+	testFollow5IRI                = "https://fed.example.com/follows/test5"
+	testFollow6IRI                = "https://example.com/follows/test6"
+	testAccept1IRI                = "https://example.com/accepts/test1"
+	testAccept2IRI                = "https://example.com/accepts/test2"
+	testReject1IRI                = "https://example.com/rejects/test1"
+	testReject2IRI                = "https://example.com/rejects/test2"
+	testFollow7IRI                = "https://example.com/follows/test7"
+	testAccept3IRI                = "https://fed.example.com/accepts/test3"
+	testAccept4IRI                = "https://fed.example.com/accepts/test4"
 )
 
+// testEmojiNote is a note with a custom emoji, the way Mastodon sends it.
+const testEmojiNote = `{
+  "@context": [
+    "https://www.w3.org/ns/activitystreams",
+    {"toot": "http://joinmastodon.org/ns#", "Emoji": "toot:Emoji"}
+  ],
+  "id": "https://fed.example.com/notes/emoji1",
+  "type": "Note",
+  "content": "<p>hello :blobcat:</p>",
+  "tag": [
+    {
+      "id": "https://fed.example.com/emojis/1",
+      "type": "Emoji",
+      "name": ":blobcat:",
+      "updated": "2020-01-01T00:00:00Z",
+      "icon": {
+        "type": "Image",
+        "mediaType": "image/png",
+        "url": "https://fed.example.com/system/blobcat.png"
+      }
+    }
+  ]
+}`
+
 func init() {
 	initTestActor1()
 	initTestActor1Inbox()
@@ -115,6 +221,7 @@ func init() {
 	initTestActor1Outbox()
 	initTestActor2Outbox()
 	initTestActor3Outbox()
+	initTestTypedOutbox()
 	initTestActivity1()
 	initTestActivity2()
 	initTestActivity3()
@@ -123,6 +230,7 @@ func init() {
 	initTestActivity6()
 	initTestActivity7()
 	initTestActivity8()
+	initTestActivity9()
 	initTestActor1Followers()
 	initTestActor2Followers()
 	initTestActor3Followers()
@@ -132,6 +240,10 @@ func init() {
 	initTestActor1Liked()
 	initTestActor2Liked()
 	initTestActor3Liked()
+	initTestActor1FeaturedTags()
+	initTestActor1Featured()
+	initTestNote1Shares()
+	initTestNote1Replies()
 	initTestFollow1Actor2()
 	initTestFollow2Actor2()
 	initTestFollow3Actor2()
@@ -142,6 +254,9 @@ func init() {
 	initTestRejectFollowActor2()
 	initTestAcceptLocalFollowActor2()
 	initTestRejectLocalFollowActor2()
+	initTestPendingFollowActor1()
+	initTestAcceptPendingFollow()
+	initTestForgedAcceptFollow()
 }
 
 func initTestActor1() {
@@ -408,6 +523,19 @@ func initTestActivity8() {
 	testActivity8.SetActivityStreamsTo(to)
 }
 
+func initTestActivity9() {
+	testActivity9 = streams.NewActivityStreamsLike()
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testActivity9IRI))
+	testActivity9.SetJSONLDId(idP)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testPeerActor1IRI))
+	testActivity9.SetActivityStreamsActor(actor)
+	obj := streams.NewActivityStreamsObjectProperty()
+	obj.AppendIRI(mustParse(testActivity4IRI))
+	testActivity9.SetActivityStreamsObject(obj)
+}
+
 func initTestActor1Inbox() {
 	testActor1Inbox = models.ActivityStreamsOrderedCollection{
 		streams.NewActivityStreamsOrderedCollection(),
@@ -510,6 +638,66 @@ func initTestActor3Outbox() {
 	testActor3Outbox.SetActivityStreamsOrderedItems(orderedItems)
 }
 
+func initTestTypedOutbox() {
+	testTypedActivities = []vocab.Type{
+		streams.NewActivityStreamsCreate(),
+		streams.NewActivityStreamsFollow(),
+		streams.NewActivityStreamsAnnounce(),
+		streams.NewActivityStreamsCreate(),
+		streams.NewActivityStreamsFollow(),
+	}
+	testTypedOutbox = models.ActivityStreamsOrderedCollection{
+		streams.NewActivityStreamsOrderedCollection(),
+	}
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testTypedOutboxIRI))
+	testTypedOutbox.SetJSONLDId(idP)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(len(testTypedActivities))
+	testTypedOutbox.SetActivityStreamsTotalItems(totalItems)
+	orderedItems := streams.NewActivityStreamsOrderedItemsProperty()
+	for i, a := range testTypedActivities {
+		id := mustParse(fmt.Sprintf("https://example.com/activities/typed%d", i))
+		idP := streams.NewJSONLDIdProperty()
+		idP.SetIRI(id)
+		a.SetJSONLDId(idP)
+		orderedItems.AppendIRI(id)
+	}
+	testTypedOutbox.SetActivityStreamsOrderedItems(orderedItems)
+}
+
+// retentionOutbox builds an outbox with the items, newest first.
+func retentionOutbox(id string, items ...string) models.ActivityStreamsOrderedCollection {
+	outbox := models.ActivityStreamsOrderedCollection{
+		streams.NewActivityStreamsOrderedCollection(),
+	}
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(id))
+	outbox.SetJSONLDId(idP)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(len(items))
+	outbox.SetActivityStreamsTotalItems(totalItems)
+	orderedItems := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, item := range items {
+		orderedItems.AppendIRI(mustParse(item))
+	}
+	outbox.SetActivityStreamsOrderedItems(orderedItems)
+	return outbox
+}
+
+// retentionCreate builds a Create of a public note, whose IRI is the Create's
+// with a "/note" suffix.
+func retentionCreate(id string) vocab.ActivityStreamsCreate {
+	create := streams.NewActivityStreamsCreate()
+	idP := streams.NewJSONLDIdProperty()
+	idP.Set(mustParse(id))
+	create.SetJSONLDId(idP)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendActivityStreamsNote(timelineNote(id+"/note", pub.PublicActivityPubIRI))
+	create.SetActivityStreamsObject(op)
+	return create
+}
+
 func initTestActor1Followers() {
 	testActor1Followers = models.ActivityStreamsCollection{
 		streams.NewActivityStreamsCollection(),
@@ -616,6 +804,62 @@ func initTestActor1Liked() {
 	testActor1Liked.SetActivityStreamsItems(items)
 }
 
+func initTestActor1FeaturedTags() {
+	testActor1FeaturedTags = models.ActivityStreamsCollection{
+		streams.NewActivityStreamsCollection(),
+	}
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testActor1FeaturedTagsIRI))
+	testActor1FeaturedTags.SetJSONLDId(idP)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(0)
+	testActor1FeaturedTags.SetActivityStreamsTotalItems(totalItems)
+	items := streams.NewActivityStreamsItemsProperty()
+	testActor1FeaturedTags.SetActivityStreamsItems(items)
+}
+
+func initTestActor1Featured() {
+	testActor1Featured = models.ActivityStreamsCollection{
+		streams.NewActivityStreamsCollection(),
+	}
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testActor1FeaturedIRI))
+	testActor1Featured.SetJSONLDId(idP)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(0)
+	testActor1Featured.SetActivityStreamsTotalItems(totalItems)
+	items := streams.NewActivityStreamsItemsProperty()
+	testActor1Featured.SetActivityStreamsItems(items)
+}
+
+func initTestNote1Shares() {
+	testNote1Shares = models.ActivityStreamsCollection{
+		streams.NewActivityStreamsCollection(),
+	}
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testNote1SharesIRI))
+	testNote1Shares.SetJSONLDId(idP)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(0)
+	testNote1Shares.SetActivityStreamsTotalItems(totalItems)
+	items := streams.NewActivityStreamsItemsProperty()
+	testNote1Shares.SetActivityStreamsItems(items)
+}
+
+func initTestNote1Replies() {
+	testNote1Replies = models.ActivityStreamsCollection{
+		streams.NewActivityStreamsCollection(),
+	}
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testNote1RepliesIRI))
+	testNote1Replies.SetJSONLDId(idP)
+	totalItems := streams.NewActivityStreamsTotalItemsProperty()
+	totalItems.Set(0)
+	testNote1Replies.SetActivityStreamsTotalItems(totalItems)
+	items := streams.NewActivityStreamsItemsProperty()
+	testNote1Replies.SetActivityStreamsItems(items)
+}
+
 func initTestActor2Liked() {
 	testActor2Liked = models.ActivityStreamsCollection{
 		streams.NewActivityStreamsCollection(),
@@ -774,3 +1018,44 @@ func initTestRejectLocalFollowActor2() {
 	obj.AppendIRI(mustParse(testFollow4IRI))
 	testRejectLocalFollowActor2.SetActivityStreamsObject(obj)
 }
+
+func initTestPendingFollowActor1() {
+	testPendingFollowActor1 = streams.NewActivityStreamsFollow()
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testFollow7IRI))
+	testPendingFollowActor1.SetJSONLDId(idP)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testActor1IRI))
+	testPendingFollowActor1.SetActivityStreamsActor(actor)
+	obj := streams.NewActivityStreamsObjectProperty()
+	obj.AppendIRI(mustParse(testPeerActor2IRI))
+	testPendingFollowActor1.SetActivityStreamsObject(obj)
+}
+
+func initTestAcceptPendingFollow() {
+	testAcceptPendingFollow = streams.NewActivityStreamsAccept()
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testAccept3IRI))
+	testAcceptPendingFollow.SetJSONLDId(idP)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testPeerActor2IRI))
+	testAcceptPendingFollow.SetActivityStreamsActor(actor)
+	obj := streams.NewActivityStreamsObjectProperty()
+	obj.AppendIRI(mustParse(testFollow7IRI))
+	testAcceptPendingFollow.SetActivityStreamsObject(obj)
+}
+
+// initTestForgedAcceptFollow is an Accept of the pending Follow by an actor
+// other than the one followed.
+func initTestForgedAcceptFollow() {
+	testForgedAcceptFollow = streams.NewActivityStreamsAccept()
+	idP := streams.NewJSONLDIdProperty()
+	idP.SetIRI(mustParse(testAccept4IRI))
+	testForgedAcceptFollow.SetJSONLDId(idP)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testPeerActor1IRI))
+	testForgedAcceptFollow.SetActivityStreamsActor(actor)
+	obj := streams.NewActivityStreamsObjectProperty()
+	obj.AppendIRI(mustParse(testFollow7IRI))
+	testForgedAcceptFollow.SetActivityStreamsObject(obj)
+}
@@ -230,6 +230,17 @@ func (t *TokenInfo) scanFromSingleRow(r SingleRow) error {
 		&(t.RefreshExpires))
 }
 
+// ClientAuthorization summarizes the tokens a user has granted to a
+// third-party client.
+type ClientAuthorization struct {
+	ClientID string
+	Domain   string
+	// Scope is the distinct scopes of the tokens, separated by spaces.
+	Scope   string
+	Created sql.NullTime
+	Tokens  int
+}
+
 // TokenInfos is a Model that provides additional database methods for OAuth2
 // token information.
 type TokenInfos struct {
@@ -240,18 +251,22 @@ type TokenInfos struct {
 	getByCode       *sql.Stmt
 	getByAccess     *sql.Stmt
 	getByRefresh    *sql.Stmt
+	getAuthzs       *sql.Stmt
+	removeAuthz     *sql.Stmt
 }
 
 func (t *TokenInfos) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(t.createTokenInfo), s.CreateTokenInfo()},
-			{&(t.removeByCode), s.RemoveTokenInfoByCode()},
-			{&(t.removeByAccess), s.RemoveTokenInfoByAccess()},
-			{&(t.removeByRefresh), s.RemoveTokenInfoByRefresh()},
-			{&(t.getByCode), s.GetTokenInfoByCode()},
-			{&(t.getByAccess), s.GetTokenInfoByAccess()},
-			{&(t.getByRefresh), s.GetTokenInfoByRefresh()},
+			{&(t.createTokenInfo), s.CreateTokenInfo},
+			{&(t.removeByCode), s.RemoveTokenInfoByCode},
+			{&(t.removeByAccess), s.RemoveTokenInfoByAccess},
+			{&(t.removeByRefresh), s.RemoveTokenInfoByRefresh},
+			{&(t.getByCode), s.GetTokenInfoByCode},
+			{&(t.getByAccess), s.GetTokenInfoByAccess},
+			{&(t.getByRefresh), s.GetTokenInfoByRefresh},
+			{&(t.getAuthzs), s.GetAuthorizationsForUser},
+			{&(t.removeAuthz), s.RemoveTokenInfosForUserClient},
 		})
 }
 
@@ -268,6 +283,8 @@ func (t *TokenInfos) Close() {
 	t.getByCode.Close()
 	t.getByAccess.Close()
 	t.getByRefresh.Close()
+	t.getAuthzs.Close()
+	t.removeAuthz.Close()
 }
 
 // Create saves the new token information.
@@ -355,3 +372,35 @@ func (t *TokenInfos) GetByRefresh(c util.Context, tx *sql.Tx, refresh string) (o
 		return ti.scanFromSingleRow(r)
 	})
 }
+
+// GetAuthorizationsForUser fetches a summary of the tokens the user has granted
+// to each third-party client, excluding the user's first-party credentials.
+func (t *TokenInfos) GetAuthorizationsForUser(c util.Context, tx *sql.Tx, userID string) (ca []ClientAuthorization, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(t.getAuthzs).QueryContext(c, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	err = doForRows(rows, "TokenInfos.GetAuthorizationsForUser", func(r SingleRow) error {
+		var a ClientAuthorization
+		if err := r.Scan(&(a.ClientID), &(a.Domain), &(a.Scope), &(a.Created), &(a.Tokens)); err != nil {
+			return err
+		}
+		ca = append(ca, a)
+		return nil
+	})
+	return
+}
+
+// RemoveForUserClient deletes the tokens the user has granted to the
+// third-party client, reporting how many were deleted.
+func (t *TokenInfos) RemoveForUserClient(c util.Context, tx *sql.Tx, userID, clientID string) (n int64, err error) {
+	var r sql.Result
+	r, err = tx.Stmt(t.removeAuthz).ExecContext(c, userID, clientID)
+	if err != nil {
+		return
+	}
+	n, err = r.RowsAffected()
+	return
+}
@@ -20,6 +20,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"net/url"
+	"time"
 
 	"github.com/go-fed/apcore/util"
 )
@@ -54,6 +55,7 @@ var _ Model = &Users{}
 type Users struct {
 	insertUser                  *sql.Stmt
 	updateActor                 *sql.Stmt
+	missingActorProperty        *sql.Stmt
 	sensitiveUserByEmail        *sql.Stmt
 	userByID                    *sql.Stmt
 	userByPreferredUsername     *sql.Stmt
@@ -62,27 +64,34 @@ type Users struct {
 	updatePreferences           *sql.Stmt
 	updatePrivileges            *sql.Stmt
 	instanceUser                *sql.Stmt
+	anyUser                     *sql.Stmt
 	instanceActorPreferences    *sql.Stmt
 	setInstanceActorPreferences *sql.Stmt
+	lockInstanceActor           *sql.Stmt
 	activityStats               *sql.Stmt
+	activityStatsRange          *sql.Stmt
 }
 
 func (u *Users) Prepare(db *sql.DB, s SqlDialect) error {
 	return prepareStmtPairs(db,
 		stmtPairs{
-			{&(u.insertUser), s.InsertUser()},
-			{&(u.updateActor), s.UpdateUserActor()},
-			{&(u.sensitiveUserByEmail), s.SensitiveUserByEmail()},
-			{&(u.userByID), s.UserByID()},
-			{&(u.userByPreferredUsername), s.UserByPreferredUsername()},
-			{&(u.actorIDForOutbox), s.ActorIDForOutbox()},
-			{&(u.actorIDForInbox), s.ActorIDForInbox()},
-			{&(u.updatePreferences), s.UpdateUserPreferences()},
-			{&(u.updatePrivileges), s.UpdateUserPrivileges()},
-			{&(u.instanceUser), s.InstanceUser()},
-			{&(u.instanceActorPreferences), s.GetInstanceActorPreferences()},
-			{&(u.setInstanceActorPreferences), s.SetInstanceActorPreferences()},
-			{&(u.activityStats), s.GetUserActivityStats()},
+			{&(u.insertUser), s.InsertUser},
+			{&(u.updateActor), s.UpdateUserActor},
+			{&(u.missingActorProperty), s.UsersMissingActorProperty},
+			{&(u.sensitiveUserByEmail), s.SensitiveUserByEmail},
+			{&(u.userByID), s.UserByID},
+			{&(u.userByPreferredUsername), s.UserByPreferredUsername},
+			{&(u.actorIDForOutbox), s.ActorIDForOutbox},
+			{&(u.actorIDForInbox), s.ActorIDForInbox},
+			{&(u.updatePreferences), s.UpdateUserPreferences},
+			{&(u.updatePrivileges), s.UpdateUserPrivileges},
+			{&(u.instanceUser), s.InstanceUser},
+			{&(u.anyUser), s.AnyUser},
+			{&(u.instanceActorPreferences), s.GetInstanceActorPreferences},
+			{&(u.setInstanceActorPreferences), s.SetInstanceActorPreferences},
+			{&(u.lockInstanceActor), s.LockInstanceActor},
+			{&(u.activityStats), s.GetUserActivityStats},
+			{&(u.activityStatsRange), s.GetUserActivityStatsRange},
 		})
 }
 
@@ -94,6 +103,7 @@ func (u *Users) CreateTable(t *sql.Tx, s SqlDialect) error {
 func (u *Users) Close() {
 	u.insertUser.Close()
 	u.updateActor.Close()
+	u.missingActorProperty.Close()
 	u.sensitiveUserByEmail.Close()
 	u.userByID.Close()
 	u.userByPreferredUsername.Close()
@@ -102,9 +112,12 @@ func (u *Users) Close() {
 	u.updatePreferences.Close()
 	u.updatePrivileges.Close()
 	u.instanceUser.Close()
+	u.anyUser.Close()
 	u.instanceActorPreferences.Close()
 	u.setInstanceActorPreferences.Close()
+	u.lockInstanceActor.Close()
 	u.activityStats.Close()
+	u.activityStatsRange.Close()
 }
 
 // Create a User in the database.
@@ -132,7 +145,27 @@ func (u *Users) UpdateActor(c util.Context, tx *sql.Tx, id string, actor Activit
 	return mustChangeOneRow(r, err, "Users.UpdateActor")
 }
 
-// SensitiveUserByEmail returns the credentials for a given user's email.
+// MissingActorProperty returns the ID and actor of the users whose actor does
+// not have the property.
+func (u *Users) MissingActorProperty(c util.Context, tx *sql.Tx, property string) (us []User, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(u.missingActorProperty).QueryContext(c, property)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return us, doForRows(rows, "Users.MissingActorProperty", func(r SingleRow) error {
+		var x User
+		if err := r.Scan(&x.ID, &x.Actor); err != nil {
+			return err
+		}
+		us = append(us, x)
+		return nil
+	})
+}
+
+// SensitiveUserByEmail returns the credentials for a given user's email, or
+// ErrNotFound if no user has the email.
 func (u *Users) SensitiveUserByEmail(c util.Context, tx *sql.Tx, email string) (s *SensitiveUser, err error) {
 	var rows *sql.Rows
 	rows, err = tx.Stmt(u.sensitiveUserByEmail).QueryContext(c, email)
@@ -140,7 +173,7 @@ func (u *Users) SensitiveUserByEmail(c util.Context, tx *sql.Tx, email string) (
 		return
 	}
 	defer rows.Close()
-	return s, enforceOneRow(rows, "SensitiveUserByEmail", func(r SingleRow) error {
+	return s, findOneRow(rows, "SensitiveUserByEmail", func(r SingleRow) error {
 		s = &SensitiveUser{}
 		return r.Scan(&(s.ID), &(s.Hashpass), &(s.Salt))
 	})
@@ -189,7 +222,23 @@ func (u *Users) InstanceActorUser(c util.Context, tx *sql.Tx) (s *User, err erro
 	})
 }
 
-// ActorIDForOutbox returns the actor associated with the outbox.
+// AnyUser returns a user other than the instance actor, or nil if there is
+// none.
+func (u *Users) AnyUser(c util.Context, tx *sql.Tx) (s *User, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(u.anyUser).QueryContext(c)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return s, enforceOneRow(rows, "Users.AnyUser", func(r SingleRow) error {
+		s = &User{}
+		return r.Scan(&(s.ID), &(s.Email), &(s.Actor), &(s.Privileges), &(s.Preferences))
+	})
+}
+
+// ActorIDForOutbox returns the actor associated with the outbox, or ErrNotFound
+// if there is none.
 func (u *Users) ActorIDForOutbox(c util.Context, tx *sql.Tx, outbox *url.URL) (actor URL, err error) {
 	var rows *sql.Rows
 	rows, err = tx.Stmt(u.actorIDForOutbox).QueryContext(c, outbox.String())
@@ -197,12 +246,13 @@ func (u *Users) ActorIDForOutbox(c util.Context, tx *sql.Tx, outbox *url.URL) (a
 		return
 	}
 	defer rows.Close()
-	return actor, enforceOneRow(rows, "Users.ActorIDForOutbox", func(r SingleRow) error {
+	return actor, findOneRow(rows, "Users.ActorIDForOutbox", func(r SingleRow) error {
 		return r.Scan(&actor)
 	})
 }
 
-// ActorIDForOutbox returns the actor associated with the inbox.
+// ActorIDForInbox returns the actor associated with the inbox, or ErrNotFound
+// if there is none.
 func (u *Users) ActorIDForInbox(c util.Context, tx *sql.Tx, inbox *url.URL) (actor URL, err error) {
 	var rows *sql.Rows
 	rows, err = tx.Stmt(u.actorIDForInbox).QueryContext(c, inbox.String())
@@ -210,7 +260,7 @@ func (u *Users) ActorIDForInbox(c util.Context, tx *sql.Tx, inbox *url.URL) (act
 		return
 	}
 	defer rows.Close()
-	return actor, enforceOneRow(rows, "Users.ActorIDForInbox", func(r SingleRow) error {
+	return actor, findOneRow(rows, "Users.ActorIDForInbox", func(r SingleRow) error {
 		return r.Scan(&actor)
 	})
 }
@@ -252,6 +302,13 @@ func (u *Users) SetInstanceActorPreferences(c util.Context, tx *sql.Tx, iap Inst
 	return mustChangeOneRow(r, err, "Users.SetInstanceActorPreferences")
 }
 
+// LockInstanceActor waits for any other transaction creating the instance
+// actor, and keeps them waiting until the transaction ends.
+func (u *Users) LockInstanceActor(c util.Context, tx *sql.Tx) error {
+	_, err := tx.Stmt(u.lockInstanceActor).ExecContext(c)
+	return err
+}
+
 type UserActivityStats struct {
 	TotalUsers     int
 	ActiveHalfYear int
@@ -274,3 +331,40 @@ func (u *Users) ActivityStats(c util.Context, tx *sql.Tx) (uas UserActivityStats
 			&(uas.ActiveWeek))
 	})
 }
+
+// UserActivityBucket contains statistics about the activity of users within a
+// span of time.
+type UserActivityBucket struct {
+	// Start is the beginning of the span of time.
+	Start time.Time
+	// NewUsers is the number of users created within the span.
+	NewUsers int
+	// LastSeenUsers is the number of users last seen within the span.
+	LastSeenUsers int
+	// NewPosts is the number of posts, excluding replies, created within
+	// the span. Activities such as a Create, Follow or Like are not posts.
+	NewPosts int
+}
+
+// ActivityStatsRange obtains statistics about the activity of users between
+// from, inclusive, and to, exclusive, in spans of time given by the bucket,
+// which is a precision accepted by date_trunc such as "hour" or "day".
+func (u *Users) ActivityStatsRange(c util.Context, tx *sql.Tx, from, to time.Time, bucket string) (b []UserActivityBucket, err error) {
+	var rows *sql.Rows
+	rows, err = tx.Stmt(u.activityStatsRange).QueryContext(c, from, to, bucket)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return b, doForRows(rows, "Users.ActivityStatsRange", func(r SingleRow) error {
+		var uab UserActivityBucket
+		if err := r.Scan(&(uab.Start),
+			&(uab.NewUsers),
+			&(uab.LastSeenUsers),
+			&(uab.NewPosts)); err != nil {
+			return err
+		}
+		b = append(b, uab)
+		return nil
+	})
+}
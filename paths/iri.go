@@ -48,43 +48,57 @@ var AllActors []Actor = []Actor{InstanceActor}
 type PathKey string
 
 const (
-	UserPathKey           PathKey = "users"
-	InboxPathKey                  = "inbox"
-	InboxFirstPathKey             = "inboxFirst"
-	InboxLastPathKey              = "inboxLast"
-	OutboxPathKey                 = "outbox"
-	OutboxFirstPathKey            = "outboxFirst"
-	OutboxLastPathKey             = "outboxLast"
-	FollowersPathKey              = "followers"
-	FollowersFirstPathKey         = "followersFirst"
-	FollowersLastPathKey          = "followersLast"
-	FollowingPathKey              = "following"
-	FollowingFirstPathKey         = "followingFirst"
-	FollowingLastPathKey          = "followingLast"
-	LikedPathKey                  = "liked"
-	LikedFirstPathKey             = "likedFirst"
-	LikedLastPathKey              = "likedLast"
-	HttpSigPubKeyKey              = "httpsigPubKey"
+	UserPathKey              PathKey = "users"
+	InboxPathKey                     = "inbox"
+	InboxFirstPathKey                = "inboxFirst"
+	InboxLastPathKey                 = "inboxLast"
+	OutboxPathKey                    = "outbox"
+	OutboxFirstPathKey               = "outboxFirst"
+	OutboxLastPathKey                = "outboxLast"
+	FollowersPathKey                 = "followers"
+	FollowersFirstPathKey            = "followersFirst"
+	FollowersLastPathKey             = "followersLast"
+	FollowingPathKey                 = "following"
+	FollowingFirstPathKey            = "followingFirst"
+	FollowingLastPathKey             = "followingLast"
+	LikedPathKey                     = "liked"
+	LikedFirstPathKey                = "likedFirst"
+	LikedLastPathKey                 = "likedLast"
+	FeaturedTagsPathKey              = "featuredTags"
+	FeaturedTagsFirstPathKey         = "featuredTagsFirst"
+	FeaturedTagsLastPathKey          = "featuredTagsLast"
+	FeaturedPathKey                  = "featured"
+	FeaturedFirstPathKey             = "featuredFirst"
+	FeaturedLastPathKey              = "featuredLast"
+	HttpSigPubKeyKey                 = "httpsigPubKey"
+	HttpSigEd25519PubKeyKey          = "httpsigEd25519PubKey"
 )
 
 var knownPaths map[PathKey]string = map[PathKey]string{
-	UserPathKey:           "{user}",
-	InboxPathKey:          "{user}/inbox",
-	InboxFirstPathKey:     "{user}/inbox",
-	InboxLastPathKey:      "{user}/inbox",
-	OutboxPathKey:         "{user}/outbox",
-	OutboxFirstPathKey:    "{user}/outbox",
-	OutboxLastPathKey:     "{user}/outbox",
-	FollowersPathKey:      "{user}/followers",
-	FollowersFirstPathKey: "{user}/followers",
-	FollowersLastPathKey:  "{user}/followers",
-	FollowingPathKey:      "{user}/following",
-	FollowingFirstPathKey: "{user}/following",
-	FollowingLastPathKey:  "{user}/following",
-	LikedPathKey:          "{user}/liked",
-	LikedFirstPathKey:     "{user}/liked",
-	LikedLastPathKey:      "{user}/liked",
-	HttpSigPubKeyKey:      "{user}",
+	UserPathKey:              "{user}",
+	InboxPathKey:             "{user}/inbox",
+	InboxFirstPathKey:        "{user}/inbox",
+	InboxLastPathKey:         "{user}/inbox",
+	OutboxPathKey:            "{user}/outbox",
+	OutboxFirstPathKey:       "{user}/outbox",
+	OutboxLastPathKey:        "{user}/outbox",
+	FollowersPathKey:         "{user}/followers",
+	FollowersFirstPathKey:    "{user}/followers",
+	FollowersLastPathKey:     "{user}/followers",
+	FollowingPathKey:         "{user}/following",
+	FollowingFirstPathKey:    "{user}/following",
+	FollowingLastPathKey:     "{user}/following",
+	LikedPathKey:             "{user}/liked",
+	LikedFirstPathKey:        "{user}/liked",
+	LikedLastPathKey:         "{user}/liked",
+	FeaturedTagsPathKey:      "{user}/featuredTags",
+	FeaturedTagsFirstPathKey: "{user}/featuredTags",
+	FeaturedTagsLastPathKey:  "{user}/featuredTags",
+	FeaturedPathKey:          "{user}/featured",
+	FeaturedFirstPathKey:     "{user}/featured",
+	FeaturedLastPathKey:      "{user}/featured",
+	HttpSigPubKeyKey:         "{user}",
+	HttpSigEd25519PubKeyKey:  "{user}",
 }
 
 func knownPath(prefix string, k PathKey) string {
@@ -97,6 +111,9 @@ func knownPath(prefix string, k PathKey) string {
 }
 
 func knownUserPaths(k PathKey) string {
+	if t, ok := userPathTemplates[k]; ok {
+		return t
+	}
 	return knownPath("users", k)
 }
 
@@ -135,25 +152,35 @@ func UserIRIFor(scheme, host string, k PathKey, c Actor) *url.URL {
 }
 
 var knownUserPathQuery map[PathKey]string = map[PathKey]string{
-	InboxFirstPathKey:     fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
-	InboxLastPathKey:      fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
-	OutboxFirstPathKey:    fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
-	OutboxLastPathKey:     fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
-	FollowersFirstPathKey: fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
-	FollowersLastPathKey:  fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
-	FollowingFirstPathKey: fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
-	FollowingLastPathKey:  fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
-	LikedFirstPathKey:     fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
-	LikedLastPathKey:      fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
+	InboxFirstPathKey:        fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
+	InboxLastPathKey:         fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
+	OutboxFirstPathKey:       fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
+	OutboxLastPathKey:        fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
+	FollowersFirstPathKey:    fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
+	FollowersLastPathKey:     fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
+	FollowingFirstPathKey:    fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
+	FollowingLastPathKey:     fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
+	LikedFirstPathKey:        fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
+	LikedLastPathKey:         fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
+	FeaturedTagsFirstPathKey: fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
+	FeaturedTagsLastPathKey:  fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
+	FeaturedFirstPathKey:     fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue),
+	FeaturedLastPathKey:      fmt.Sprintf("%s=%s&%s=%s", queryCollectionPage, queryTrue, queryCollectionEnd, queryTrue),
 }
 
 var knownUserPathFragment map[PathKey]string = map[PathKey]string{
-	HttpSigPubKeyKey: "public-httpsig",
+	HttpSigPubKeyKey:        "public-httpsig",
+	HttpSigEd25519PubKeyKey: "public-httpsig-ed25519",
 }
 
 type UUID string
 
 func UUIDFromUserPath(path string) (UUID, error) {
+	for _, t := range userPathTemplates {
+		if uuid, ok := matchTemplate(t, path); ok {
+			return uuid, nil
+		}
+	}
 	s := strings.Split(path, "/")
 	if len(s) < 3 {
 		return UUID(""), fmt.Errorf("known user path does not contain uuid: %s", path)
@@ -241,9 +268,189 @@ func IsLikedPath(id *url.URL) bool {
 	return isSubPath(id, "liked")
 }
 
+func IsFeaturedTagsPath(id *url.URL) bool {
+	return isSubPath(id, "featuredTags")
+}
+
+func IsFeaturedPath(id *url.URL) bool {
+	return isSubPath(id, "featured")
+}
+
+// sharesPathSuffix is appended to the path of a local object to form the path
+// of its shares collection.
+const sharesPathSuffix = "/shares"
+
+// SharesIRIFor returns the IRI of the shares collection of a local object.
+func SharesIRIFor(object *url.URL) *url.URL {
+	u := Normalize(object)
+	u.Path = strings.TrimSuffix(u.Path, "/") + sharesPathSuffix
+	return u
+}
+
+// IsSharesPath determines whether the IRI is of the shares collection of a
+// local object.
+func IsSharesPath(id *url.URL) bool {
+	return isObjectCollectionPath(id, sharesPathSuffix)
+}
+
+// repliesPathSuffix is appended to the path of a local object to form the path
+// of its replies collection.
+const repliesPathSuffix = "/replies"
+
+// RepliesRoute is the route at which the replies collections of local objects
+// are served.
+const RepliesRoute = "/{object:.+}" + repliesPathSuffix
+
+// RepliesIRIFor returns the IRI of the replies collection of a local object.
+func RepliesIRIFor(object *url.URL) *url.URL {
+	u := Normalize(object)
+	u.Path = strings.TrimSuffix(u.Path, "/") + repliesPathSuffix
+	return u
+}
+
+// IsRepliesPath determines whether the IRI is of the replies collection of a
+// local object.
+func IsRepliesPath(id *url.URL) bool {
+	return isObjectCollectionPath(id, repliesPathSuffix)
+}
+
+// ObjectForReplies returns the IRI of the local object of a replies
+// collection.
+func ObjectForReplies(replies *url.URL) *url.URL {
+	u := Normalize(replies)
+	u.Path = strings.TrimSuffix(u.Path, repliesPathSuffix)
+	return u
+}
+
+// isObjectCollectionPath determines whether the path of the IRI is that of an
+// object followed by the suffix of one of its collections. The object must not
+// be an actor, one of an actor's collections, or another object's collection.
+func isObjectCollectionPath(id *url.URL, suffix string) bool {
+	object := strings.TrimSuffix(id.Path, suffix)
+	if object == id.Path || len(strings.Trim(object, "/")) == 0 {
+		return false
+	} else if strings.HasSuffix(object, sharesPathSuffix) || strings.HasSuffix(object, repliesPathSuffix) {
+		return false
+	}
+	for k := range knownPaths {
+		if templatesOverlap(knownUserPaths(k), object) || templatesOverlap(knownActorsPaths(k), object) {
+			return false
+		}
+	}
+	return true
+}
+
 func isSubPath(id *url.URL, sub string) bool {
 	s := strings.Split(id.Path, "/")
 	return len(s) > 3 &&
 		(strings.Contains(id.Path, "users") || strings.Contains(id.Path, "actors")) &&
-		strings.Contains(s[3], sub)
+		s[3] == sub
 }
+
+// MediaRoute is the route at which uploaded media is served.
+const MediaRoute = "/media/{media}"
+
+// MediaThumbnailRoute is the route at which thumbnails of uploaded images are
+// served.
+const MediaThumbnailRoute = MediaRoute + "/thumb"
+
+// MediaIRIFor returns the IRI at which the uploaded media is served.
+func MediaIRIFor(scheme, host, id string) *url.URL {
+	return &url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   strings.ReplaceAll(MediaRoute, "{media}", id),
+	}
+}
+
+// EmojiRoute is the route at which the custom emoji of this server are listed.
+const EmojiRoute = "/emoji"
+
+// EmojiItemRoute is the route at which a custom emoji is served.
+const EmojiItemRoute = EmojiRoute + "/{shortcode}"
+
+// EmojiIRI returns the IRI at which the custom emoji are listed.
+func EmojiIRI(scheme, host string) *url.URL {
+	return &url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   EmojiRoute,
+	}
+}
+
+// EmojiIRIFor returns the IRI at which the custom emoji is served.
+func EmojiIRIFor(scheme, host, shortcode string) *url.URL {
+	return &url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   strings.ReplaceAll(EmojiItemRoute, "{shortcode}", shortcode),
+	}
+}
+
+// SharedInboxRoute is the route at which deliveries addressed to any number of
+// this server's users are received.
+const SharedInboxRoute = "/inbox"
+
+// SharedInboxIRI returns the IRI of the shared inbox.
+func SharedInboxIRI(scheme, host string) *url.URL {
+	return &url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   SharedInboxRoute,
+	}
+}
+
+// SettingsAppsRoute is the route at which users list the third-party
+// applications they have authorized.
+const SettingsAppsRoute = "/settings/apps"
+
+// SettingsRevokeAppRoute is the route at which users revoke the tokens they
+// have granted to a third-party application.
+const SettingsRevokeAppRoute = SettingsAppsRoute + "/{client}/revoke"
+
+// InstanceAPIRoute is the route at which the public information about the
+// server, such as its name and any sitewide announcement, is served as JSON in
+// the style of Mastodon.
+const InstanceAPIRoute = "/api/v1/instance"
+
+// AdminActivityStatsRoute is the route at which administrators obtain
+// statistics about the activity of users over time.
+const AdminActivityStatsRoute = "/admin/stats/activity"
+
+// AdminInvitesRoute is the route at which administrators mint and list the
+// invite codes for registering.
+const AdminInvitesRoute = "/admin/invites"
+
+// AdminReadOnlyRoute is the route at which administrators view and toggle the
+// server's read-only mode.
+const AdminReadOnlyRoute = "/admin/read-only"
+
+// OAuth2TokenRoute is the route at which OAuth2 clients obtain access tokens.
+const OAuth2TokenRoute = "/oauth2/token"
+
+// AdminReportsRoute is the route at which administrators list the reports of
+// content awaiting moderation.
+const AdminReportsRoute = "/admin/reports"
+
+// AdminDeliveryAttemptRoute is the route at which administrators inspect a
+// single delivery attempt, including the payload that was sent.
+const AdminDeliveryAttemptRoute = "/admin/deliveries/{id}"
+
+// AdminRelaysRoute is the route at which administrators list and subscribe to
+// relays.
+const AdminRelaysRoute = "/admin/relays"
+
+// AdminUnsubscribeRelayRoute is the route at which administrators unsubscribe
+// from a relay.
+const AdminUnsubscribeRelayRoute = "/admin/relays/unsubscribe"
+
+// AdminResolveReportRoute is the route at which administrators mark a report
+// as resolved.
+const AdminResolveReportRoute = "/admin/reports/{id}/resolve"
+
+// ActivityDeliveriesRoute is the route at which a user inspects the delivery
+// of an activity they sent.
+const ActivityDeliveriesRoute = "/activities/{id}/deliveries"
+
+// RobotsRoute is the route at which the robots.txt is served.
+const RobotsRoute = "/robots.txt"
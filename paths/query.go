@@ -28,6 +28,12 @@ const (
 	queryCollectionEnd  = "end"
 	queryOffset         = "offset"
 	queryNum            = "n"
+	// Mastodon-style cursors and page size, accepted for interoperability
+	// with clients that page collections that way.
+	queryMaxID   = "max_id"
+	queryMinID   = "min_id"
+	querySinceID = "since_id"
+	queryLimit   = "limit"
 )
 
 // AddPageParams overwrites the query string of a base URL and returns a copy
@@ -44,10 +50,35 @@ func AddPageParams(base *url.URL, offset, n int) *url.URL {
 	return &c
 }
 
+// FirstPageIRI returns a copy of a collection's IRI that requests its first
+// page.
+func FirstPageIRI(base *url.URL) *url.URL {
+	c := *Normalize(base)
+	c.RawQuery = fmt.Sprintf("%s=%s", queryCollectionPage, queryTrue)
+	return &c
+}
+
+// LastPageIRI returns a copy of a collection's IRI that requests its last
+// page.
+func LastPageIRI(base *url.URL) *url.URL {
+	c := *Normalize(base)
+	c.RawQuery = fmt.Sprintf("%s=%s&%s=%s",
+		queryCollectionPage,
+		queryTrue,
+		queryCollectionEnd,
+		queryTrue)
+	return &c
+}
+
 // IsGetCollectionPage returns true when the IRI requests pagination for an
-// OrderedCollection-style of IRI.
+// OrderedCollection-style of IRI, either explicitly or with a Mastodon-style
+// max_id, min_id, or since_id cursor.
 func IsGetCollectionPage(u *url.URL) bool {
-	return u.Query().Get(queryCollectionPage) == queryTrue
+	q := u.Query()
+	return q.Get(queryCollectionPage) == queryTrue ||
+		len(q.Get(queryMaxID)) > 0 ||
+		len(q.Get(queryMinID)) > 0 ||
+		len(q.Get(querySinceID)) > 0
 }
 
 // IsGetCollectionEnd returns true when the IRI requests the last page for an
@@ -63,16 +94,97 @@ func GetOffsetOrDefault(u *url.URL, def int) int {
 }
 
 // GetNumOrDefault returns the number requested in the IRI, or default if no
-// value or an invalid value is specified. If the requested amount is greater
-// than the max, the maximum is returned instead.
+// value or an invalid value is specified. The Mastodon-style "limit" is used
+// when "n" is not given. If the requested amount is greater than the max, the
+// maximum is returned instead.
 func GetNumOrDefault(u *url.URL, def, max int) int {
-	n := queryKeyAsIntOrDefault(u, queryNum, def)
+	n := queryKeyAsIntOrDefault(u, queryNum, queryKeyAsIntOrDefault(u, queryLimit, def))
 	if n > max {
 		return max
 	}
 	return n
 }
 
+// GetPageWindow returns the offset and number of the items requested in the
+// IRI, or zero and the default if no page is requested. A Mastodon-style
+// cursor does not move the offset; it is instead obtained with GetPageCursor.
+func GetPageWindow(u *url.URL, def, max int) (offset, n int) {
+	offset, n = 0, def
+	if !IsGetCollectionPage(u) {
+		return
+	}
+	n = GetNumOrDefault(u, def, max)
+	if offset = queryKeyAsIntOrDefault(u, queryOffset, 0); offset < 0 {
+		offset = 0
+	}
+	return
+}
+
+// PageCursor is a Mastodon-style cursor, naming an item of a collection
+// relative to which a page is requested.
+//
+// Cursors are the ids of items rather than offsets, so that items prepended to
+// a collection while it is being paged do not shift the pages, which would
+// repeat or skip items.
+type PageCursor struct {
+	// ID is the IRI of the item named by the cursor.
+	ID  *url.URL
+	key string
+}
+
+// GetPageCursor returns the Mastodon-style cursor requested in the IRI, and
+// whether there is one. An explicit offset takes precedence over the cursors,
+// and max_id over min_id, which takes precedence over since_id. Cursors that
+// are not absolute IRIs are ignored, as are other Mastodon query parameters,
+// such as only_other_accounts.
+func GetPageCursor(u *url.URL) (PageCursor, bool) {
+	q := u.Query()
+	if len(q.Get(queryOffset)) > 0 {
+		return PageCursor{}, false
+	}
+	for _, key := range []string{queryMaxID, queryMinID, querySinceID} {
+		v := q.Get(key)
+		if len(v) == 0 {
+			continue
+		}
+		id, err := url.Parse(v)
+		if err != nil || !id.IsAbs() {
+			return PageCursor{}, false
+		}
+		return PageCursor{ID: id, key: key}, true
+	}
+	return PageCursor{}, false
+}
+
+// Window returns the offset and number of the items requested relative to
+// the cursor, given the cursor item's index into the collection, newest first,
+// and the requested number of items:
+//
+//   - max_id requests the items older than the cursor item.
+//   - since_id requests the newest items newer than the cursor item.
+//   - min_id requests the items just newer than the cursor item, the page
+//     preceding it.
+//
+// An index of the collection's length, for an item that is not in it, pages
+// from the end of the collection.
+func (p PageCursor) Window(index, n int) (offset, num int) {
+	switch p.key {
+	case queryMaxID:
+		return index + 1, n
+	case queryMinID:
+		if offset = index - n; offset < 0 {
+			offset = 0
+		}
+		return offset, index - offset
+	case querySinceID:
+		if index < n {
+			n = index
+		}
+		return 0, n
+	}
+	return 0, n
+}
+
 func queryKeyAsIntOrDefault(u *url.URL, key string, def int) int {
 	v := u.Query().Get(key)
 	n, err := strconv.Atoi(v)
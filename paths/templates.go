@@ -0,0 +1,213 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package paths
+
+import (
+	"fmt"
+	"strings"
+)
+
+// userPlaceholder is the segment of a path template replaced by the UUID of a
+// user.
+const userPlaceholder = "{user}"
+
+// userPathTemplates are the configured templates of users' paths, overriding
+// the defaults beneath "/users/".
+var userPathTemplates = make(map[PathKey]string)
+
+// boxPathKeys are the keys of the paths sharing the template of an inbox or
+// outbox, which differ only by their query.
+var boxPathKeys = map[PathKey][]PathKey{
+	InboxPathKey:  {InboxPathKey, InboxFirstPathKey, InboxLastPathKey},
+	OutboxPathKey: {OutboxPathKey, OutboxFirstPathKey, OutboxLastPathKey},
+}
+
+// reservedPrefixes are the prefixes of the paths served by apcore, or set
+// aside for standards and APIs, beneath which the configured templates must
+// not be.
+var reservedPrefixes = []string{
+	"/.well-known/",
+	"/nodeinfo/",
+	"/oauth2/",
+	"/api/",
+	"/admin/",
+	"/settings/",
+	"/static/",
+}
+
+// fixedRoutes are the routes whose paths cannot be configured, which the
+// configured templates must not collide with.
+func fixedRoutes() []string {
+	r := []string{
+		SharedInboxRoute,
+		RobotsRoute,
+		ActivityDeliveriesRoute,
+		OAuth2TokenRoute,
+		MediaRoute,
+		MediaThumbnailRoute,
+		EmojiRoute,
+		EmojiItemRoute,
+		SettingsAppsRoute,
+		SettingsRevokeAppRoute,
+		InstanceAPIRoute,
+		AdminActivityStatsRoute,
+		AdminInvitesRoute,
+		AdminReadOnlyRoute,
+		AdminReportsRoute,
+		AdminResolveReportRoute,
+		AdminDeliveryAttemptRoute,
+		AdminRelaysRoute,
+		AdminUnsubscribeRelayRoute,
+	}
+	isBox := make(map[PathKey]bool)
+	for _, ks := range boxPathKeys {
+		for _, k := range ks {
+			isBox[k] = true
+		}
+	}
+	for k := range knownPaths {
+		if !isBox[k] {
+			r = append(r, knownPath("users", k))
+		}
+		r = append(r, knownActorsPaths(k))
+	}
+	return r
+}
+
+// ValidateBoxPathTemplates determines whether the templates of the paths of
+// users' inboxes and outboxes are usable. An empty template is the default.
+// The routes are those of the server whose paths are configured elsewhere,
+// such as the login and health check paths; empty ones are ignored.
+//
+// A template must be an absolute path having the "{user}" placeholder as
+// exactly one of its segments, such as "/u/{user}/inbox", and must not collide
+// with the other template or any other route of the server.
+func ValidateBoxPathTemplates(inbox, outbox string, routes ...string) error {
+	if len(inbox) == 0 {
+		inbox = knownPath("users", InboxPathKey)
+	}
+	if len(outbox) == 0 {
+		outbox = knownPath("users", OutboxPathKey)
+	}
+	for _, t := range []string{inbox, outbox} {
+		if err := validateTemplate(t); err != nil {
+			return err
+		}
+		for _, p := range reservedPrefixes {
+			if strings.HasPrefix(t, p) {
+				return fmt.Errorf("path template %q is beneath the reserved %q", t, p)
+			}
+		}
+		for _, r := range append(fixedRoutes(), routes...) {
+			if len(r) > 0 && templatesOverlap(t, r) {
+				return fmt.Errorf("path template %q collides with route %q", t, r)
+			}
+		}
+	}
+	if templatesOverlap(inbox, outbox) {
+		return fmt.Errorf("inbox path template %q collides with outbox path template %q", inbox, outbox)
+	}
+	return nil
+}
+
+// SetBoxPathTemplates sets the templates of the paths of users' inboxes and
+// outboxes, which are used both to route requests and to build IRIs. An empty
+// template restores the default. The templates must not collide with the
+// routes, as for ValidateBoxPathTemplates.
+//
+// It is not safe to call concurrently with building paths, so it must be
+// called before serving. The IRIs built are stored by users and peers, so the
+// templates must not change once users exist.
+func SetBoxPathTemplates(inbox, outbox string, routes ...string) error {
+	if err := ValidateBoxPathTemplates(inbox, outbox, routes...); err != nil {
+		return err
+	}
+	set := func(k PathKey, t string) {
+		for _, bk := range boxPathKeys[k] {
+			if len(t) == 0 {
+				delete(userPathTemplates, bk)
+			} else {
+				userPathTemplates[bk] = t
+			}
+		}
+	}
+	set(InboxPathKey, inbox)
+	set(OutboxPathKey, outbox)
+	return nil
+}
+
+func validateTemplate(t string) error {
+	if !strings.HasPrefix(t, "/") {
+		return fmt.Errorf("path template is not absolute: %q", t)
+	}
+	n := 0
+	for _, seg := range strings.Split(t, "/")[1:] {
+		if len(seg) == 0 {
+			return fmt.Errorf("path template has an empty segment: %q", t)
+		} else if seg == userPlaceholder {
+			n++
+		} else if strings.ContainsAny(seg, "{}") {
+			return fmt.Errorf("path template has a segment other than %q with a placeholder: %q", userPlaceholder, t)
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("path template must have %q as exactly one segment: %q", userPlaceholder, t)
+	}
+	return nil
+}
+
+// isPlaceholder determines whether a segment of a route matches any value.
+func isPlaceholder(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
+
+// templatesOverlap determines whether some path matches both routes.
+func templatesOverlap(a, b string) bool {
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if as[i] != bs[i] && !isPlaceholder(as[i]) && !isPlaceholder(bs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTemplate obtains the UUID of the user from a path matching the
+// template.
+func matchTemplate(t, path string) (UUID, bool) {
+	ts := strings.Split(t, "/")
+	ps := strings.Split(path, "/")
+	if len(ts) != len(ps) {
+		return UUID(""), false
+	}
+	var uuid UUID
+	for i := range ts {
+		if ts[i] == userPlaceholder {
+			if len(ps[i]) == 0 {
+				return UUID(""), false
+			}
+			uuid = UUID(ps[i])
+		} else if ts[i] != ps[i] {
+			return UUID(""), false
+		}
+	}
+	return uuid, true
+}
@@ -18,6 +18,7 @@ package services
 
 import (
 	"net/url"
+	"sort"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams"
@@ -25,6 +26,19 @@ import (
 	"github.com/go-fed/apcore/paths"
 )
 
+// featuredTagsProperty is the Mastodon extension property on an actor that
+// refers to the collection of hashtags the actor has pinned to their profile.
+const featuredTagsProperty = "featuredTags"
+
+// featuredProperty is the Mastodon extension property on an actor that refers
+// to the collection of objects, such as posts, the actor has pinned to their
+// profile.
+const featuredProperty = "featured"
+
+// endpointsProperty is the actor property listing endpoints shared by the
+// actors of this server, such as the shared inbox.
+const endpointsProperty = "endpoints"
+
 // addNextPrev adds the 'next' and 'prev' properties onto a page, if required.
 func addNextPrev(page vocab.ActivityStreamsOrderedCollectionPage, start, n int, isEnd bool) error {
 	iri, err := pub.GetId(page)
@@ -75,10 +89,88 @@ func addNextPrevCol(page vocab.ActivityStreamsCollectionPage, start, n int, isEn
 	return nil
 }
 
-func toPersonActor(uuid paths.UUID,
+// userActor is the ActivityStreams actor of a user, of any of the actor types.
+type userActor interface {
+	vocab.Type
+	GetUnknownProperties() map[string]interface{}
+	SetActivityStreamsInbox(vocab.ActivityStreamsInboxProperty)
+	SetActivityStreamsOutbox(vocab.ActivityStreamsOutboxProperty)
+	SetActivityStreamsFollowers(vocab.ActivityStreamsFollowersProperty)
+	SetActivityStreamsFollowing(vocab.ActivityStreamsFollowingProperty)
+	SetActivityStreamsLiked(vocab.ActivityStreamsLikedProperty)
+	SetActivityStreamsName(vocab.ActivityStreamsNameProperty)
+	SetActivityStreamsPreferredUsername(vocab.ActivityStreamsPreferredUsernameProperty)
+	SetActivityStreamsUrl(vocab.ActivityStreamsUrlProperty)
+	SetActivityStreamsSummary(vocab.ActivityStreamsSummaryProperty)
+	SetW3IDSecurityV1PublicKey(vocab.W3IDSecurityV1PublicKeyProperty)
+}
+
+// userActorTypes create an empty actor of each of the ActivityStreams actor
+// types. It is the only list of the actor types.
+var userActorTypes = map[string]func() userActor{
+	"Application":  func() userActor { return streams.NewActivityStreamsApplication() },
+	"Group":        func() userActor { return streams.NewActivityStreamsGroup() },
+	"Organization": func() userActor { return streams.NewActivityStreamsOrganization() },
+	"Person":       func() userActor { return streams.NewActivityStreamsPerson() },
+	"Service":      func() userActor { return streams.NewActivityStreamsService() },
+}
+
+// IsActorType determines whether the name is of an ActivityStreams actor type,
+// which users may be created as.
+func IsActorType(name string) bool {
+	_, ok := userActorTypes[name]
+	return ok
+}
+
+// ActorTypes returns the names of the ActivityStreams actor types, sorted.
+func ActorTypes() []string {
+	names := make([]string, 0, len(userActorTypes))
+	for name := range userActorTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// publicKey is the PEM form of a public key of a new actor and the path key
+// of its IRI.
+type publicKey struct {
+	pathKey paths.PathKey
+	pem     string
+}
+
+// publicKeyProperty is the publicKey property listing the public keys of the
+// actor, whose IRIs are determined by iri.
+func publicKeyProperty(owner *url.URL, pubKeys []publicKey, iri func(paths.PathKey) *url.URL) vocab.W3IDSecurityV1PublicKeyProperty {
+	publicKeyProp := streams.NewW3IDSecurityV1PublicKeyProperty()
+	for _, pk := range pubKeys {
+		// publicKey type
+		publicKeyType := streams.NewW3IDSecurityV1PublicKey()
+
+		// publicKey id
+		pubKeyIdProp := streams.NewJSONLDIdProperty()
+		pubKeyIdProp.SetIRI(iri(pk.pathKey))
+		publicKeyType.SetJSONLDId(pubKeyIdProp)
+
+		// publicKey owner
+		ownerProp := streams.NewW3IDSecurityV1OwnerProperty()
+		ownerProp.SetIRI(owner)
+		publicKeyType.SetW3IDSecurityV1Owner(ownerProp)
+
+		// publicKey publicKeyPem
+		publicKeyPemProp := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+		publicKeyPemProp.Set(pk.pem)
+		publicKeyType.SetW3IDSecurityV1PublicKeyPem(publicKeyPemProp)
+
+		publicKeyProp.AppendW3IDSecurityV1PublicKey(publicKeyType)
+	}
+	return publicKeyProp
+}
+
+func toUserActor(p userActor,
+	uuid paths.UUID,
 	scheme, host, username, preferredUsername, summary string,
-	pubKey string) (vocab.ActivityStreamsPerson, *url.URL) {
-	p := streams.NewActivityStreamsPerson()
+	pubKeys []publicKey) (userActor, *url.URL) {
 	// id
 	idProp := streams.NewJSONLDIdProperty()
 	idIRI := paths.UUIDIRIFor(scheme, host, paths.UserPathKey, uuid)
@@ -115,6 +207,19 @@ func toPersonActor(uuid paths.UUID,
 	likedProp.SetIRI(likedIRI)
 	p.SetActivityStreamsLiked(likedProp)
 
+	// featuredTags
+	featuredTagsIRI := paths.UUIDIRIFor(scheme, host, paths.FeaturedTagsPathKey, uuid)
+	p.GetUnknownProperties()[featuredTagsProperty] = featuredTagsIRI.String()
+
+	// featured
+	featuredIRI := paths.UUIDIRIFor(scheme, host, paths.FeaturedPathKey, uuid)
+	p.GetUnknownProperties()[featuredProperty] = featuredIRI.String()
+
+	// endpoints
+	p.GetUnknownProperties()[endpointsProperty] = map[string]interface{}{
+		"sharedInbox": paths.SharedInboxIRI(scheme, host).String(),
+	}
+
 	// name
 	nameProp := streams.NewActivityStreamsNameProperty()
 	nameProp.AppendXMLSchemaString(username)
@@ -135,30 +240,10 @@ func toPersonActor(uuid paths.UUID,
 	summaryProp.AppendXMLSchemaString(summary)
 	p.SetActivityStreamsSummary(summaryProp)
 
-	// publicKey property
-	publicKeyProp := streams.NewW3IDSecurityV1PublicKeyProperty()
-
-	// publicKey type
-	publicKeyType := streams.NewW3IDSecurityV1PublicKey()
-
-	// publicKey id
-	pubKeyIdProp := streams.NewJSONLDIdProperty()
-	pubKeyIRI := paths.UUIDIRIFor(scheme, host, paths.HttpSigPubKeyKey, uuid)
-	pubKeyIdProp.SetIRI(pubKeyIRI)
-	publicKeyType.SetJSONLDId(pubKeyIdProp)
-
-	// publicKey owner
-	ownerProp := streams.NewW3IDSecurityV1OwnerProperty()
-	ownerProp.SetIRI(idIRI)
-	publicKeyType.SetW3IDSecurityV1Owner(ownerProp)
-
-	// publicKey publicKeyPem
-	publicKeyPemProp := streams.NewW3IDSecurityV1PublicKeyPemProperty()
-	publicKeyPemProp.Set(pubKey)
-	publicKeyType.SetW3IDSecurityV1PublicKeyPem(publicKeyPemProp)
-
-	publicKeyProp.AppendW3IDSecurityV1PublicKey(publicKeyType)
-	p.SetW3IDSecurityV1PublicKey(publicKeyProp)
+	// publicKey
+	p.SetW3IDSecurityV1PublicKey(publicKeyProperty(idIRI, pubKeys, func(k paths.PathKey) *url.URL {
+		return paths.UUIDIRIFor(scheme, host, k, uuid)
+	}))
 	return p, idIRI
 }
 
@@ -271,6 +356,64 @@ func emptyLiked(actorID *url.URL) (vocab.ActivityStreamsCollection, error) {
 	return emptyCollection(id, first, last), nil
 }
 
+func emptyFeaturedTags(actorID *url.URL) (vocab.ActivityStreamsCollection, error) {
+	id, err := paths.IRIForActorID(paths.FeaturedTagsPathKey, actorID)
+	if err != nil {
+		return nil, err
+	}
+	first, err := paths.IRIForActorID(paths.FeaturedTagsFirstPathKey, actorID)
+	if err != nil {
+		return nil, err
+	}
+	last, err := paths.IRIForActorID(paths.FeaturedTagsLastPathKey, actorID)
+	if err != nil {
+		return nil, err
+	}
+	return emptyCollection(id, first, last), nil
+}
+
+func emptyFeatured(actorID *url.URL) (vocab.ActivityStreamsCollection, error) {
+	id, err := paths.IRIForActorID(paths.FeaturedPathKey, actorID)
+	if err != nil {
+		return nil, err
+	}
+	first, err := paths.IRIForActorID(paths.FeaturedFirstPathKey, actorID)
+	if err != nil {
+		return nil, err
+	}
+	last, err := paths.IRIForActorID(paths.FeaturedLastPathKey, actorID)
+	if err != nil {
+		return nil, err
+	}
+	return emptyCollection(id, first, last), nil
+}
+
+// collectionShell builds a Collection that describes its size and where its
+// pages are, without any of its items.
+func collectionShell(id *url.URL, totalItems int) vocab.ActivityStreamsCollection {
+	oc := streams.NewActivityStreamsCollection()
+	// id
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(paths.Normalize(id))
+	oc.SetJSONLDId(idProp)
+
+	// totalItems
+	tiProp := streams.NewActivityStreamsTotalItemsProperty()
+	tiProp.Set(totalItems)
+	oc.SetActivityStreamsTotalItems(tiProp)
+
+	// first
+	firstProp := streams.NewActivityStreamsFirstProperty()
+	firstProp.SetIRI(paths.FirstPageIRI(id))
+	oc.SetActivityStreamsFirst(firstProp)
+
+	// last
+	lastProp := streams.NewActivityStreamsLastProperty()
+	lastProp.SetIRI(paths.LastPageIRI(id))
+	oc.SetActivityStreamsLast(lastProp)
+	return oc
+}
+
 func emptyCollection(id, first, last *url.URL) vocab.ActivityStreamsCollection {
 	oc := streams.NewActivityStreamsCollection()
 	// id
@@ -302,7 +445,7 @@ func emptyCollection(id, first, last *url.URL) vocab.ActivityStreamsCollection {
 
 func toApplicationActor(c paths.Actor, scheme, host string,
 	username, preferredUsername string,
-	pubKey string) (vocab.ActivityStreamsApplication, *url.URL) {
+	pubKeys []publicKey) (vocab.ActivityStreamsApplication, *url.URL) {
 	p := streams.NewActivityStreamsApplication()
 	// id
 	idProp := streams.NewJSONLDIdProperty()
@@ -340,6 +483,19 @@ func toApplicationActor(c paths.Actor, scheme, host string,
 	likedProp.SetIRI(likedIRI)
 	p.SetActivityStreamsLiked(likedProp)
 
+	// featuredTags
+	featuredTagsIRI := paths.ActorIRIFor(scheme, host, paths.FeaturedTagsPathKey, c)
+	p.GetUnknownProperties()[featuredTagsProperty] = featuredTagsIRI.String()
+
+	// featured
+	featuredIRI := paths.ActorIRIFor(scheme, host, paths.FeaturedPathKey, c)
+	p.GetUnknownProperties()[featuredProperty] = featuredIRI.String()
+
+	// endpoints
+	p.GetUnknownProperties()[endpointsProperty] = map[string]interface{}{
+		"sharedInbox": paths.SharedInboxIRI(scheme, host).String(),
+	}
+
 	// name
 	nameProp := streams.NewActivityStreamsNameProperty()
 	nameProp.AppendXMLSchemaString(username)
@@ -355,29 +511,9 @@ func toApplicationActor(c paths.Actor, scheme, host string,
 	urlProp.AppendIRI(idIRI)
 	p.SetActivityStreamsUrl(urlProp)
 
-	// publicKey property
-	publicKeyProp := streams.NewW3IDSecurityV1PublicKeyProperty()
-
-	// publicKey type
-	publicKeyType := streams.NewW3IDSecurityV1PublicKey()
-
-	// publicKey id
-	pubKeyIdProp := streams.NewJSONLDIdProperty()
-	pubKeyIRI := paths.ActorIRIFor(scheme, host, paths.HttpSigPubKeyKey, c)
-	pubKeyIdProp.SetIRI(pubKeyIRI)
-	publicKeyType.SetJSONLDId(pubKeyIdProp)
-
-	// publicKey owner
-	ownerProp := streams.NewW3IDSecurityV1OwnerProperty()
-	ownerProp.SetIRI(idIRI)
-	publicKeyType.SetW3IDSecurityV1Owner(ownerProp)
-
-	// publicKey publicKeyPem
-	publicKeyPemProp := streams.NewW3IDSecurityV1PublicKeyPemProperty()
-	publicKeyPemProp.Set(pubKey)
-	publicKeyType.SetW3IDSecurityV1PublicKeyPem(publicKeyPemProp)
-
-	publicKeyProp.AppendW3IDSecurityV1PublicKey(publicKeyType)
-	p.SetW3IDSecurityV1PublicKey(publicKeyProp)
+	// publicKey
+	p.SetW3IDSecurityV1PublicKey(publicKeyProperty(idIRI, pubKeys, func(k paths.PathKey) *url.URL {
+		return paths.ActorIRIFor(scheme, host, k, c)
+	}))
 	return p, idIRI
 }
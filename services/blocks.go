@@ -0,0 +1,78 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// Blocks manages the individual actors that local actors have blocked.
+type Blocks struct {
+	DB        *sql.DB
+	Blocks    *models.Blocks
+	Followers *models.Followers
+}
+
+// Block records that the actor blocked another actor, along with the Block
+// activity that was sent, which may be nil. The blocked actor is also removed
+// from the actor's followers.
+func (b *Blocks) Block(c util.Context, actor, blocked, activity *url.URL) error {
+	followersIRI, err := paths.IRIForActorID(paths.FollowersPathKey, actor)
+	if err != nil {
+		return err
+	}
+	return doInTx(c, b.DB, func(tx *sql.Tx) error {
+		if err := b.Blocks.Add(c, tx, actor, blocked, activity); err != nil {
+			return err
+		}
+		// Deleting an item not in the collection would still change
+		// its total, so first ensure it is present.
+		if has, err := b.Followers.ContainsForActor(c, tx, actor, blocked); err != nil {
+			return err
+		} else if !has {
+			return nil
+		}
+		return b.Followers.DeleteItem(c, tx, followersIRI, blocked)
+	})
+}
+
+// Unblock removes the actor's block of another actor, returning the Block
+// activity that was sent when blocking, if any.
+func (b *Blocks) Unblock(c util.Context, actor, blocked *url.URL) (activity *url.URL, err error) {
+	err = doInTx(c, b.DB, func(tx *sql.Tx) error {
+		activity, err = b.Blocks.ActivityFor(c, tx, actor, blocked)
+		if err != nil {
+			return err
+		}
+		return b.Blocks.Remove(c, tx, actor, blocked)
+	})
+	return
+}
+
+// IsBlocked determines whether the actor blocked another actor.
+func (b *Blocks) IsBlocked(c util.Context, actor, blocked *url.URL) (is bool, err error) {
+	err = doInTx(c, b.DB, func(tx *sql.Tx) error {
+		is, err = b.Blocks.Contains(c, tx, actor, blocked)
+		return err
+	})
+	return
+}
@@ -0,0 +1,224 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+type CollectionDrift struct {
+	DB              *sql.DB
+	CollectionDrift *models.CollectionDrift
+	Inboxes         *models.Inboxes
+	Outboxes        *models.Outboxes
+	Followers       *models.Followers
+	Following       *models.Following
+	Liked           *models.Liked
+	FeaturedTags    *models.FeaturedTags
+	Featured        *models.Featured
+	Users           *models.Users
+}
+
+// Check samples up to n collections of each kind, returning the ones whose
+// totalItems has drifted from their actual number of items. If repair is
+// true, the drifted collections are also corrected.
+func (d *CollectionDrift) Check(c util.Context, n int, repair bool) (drifted []models.DriftedCollection, err error) {
+	// Counting the items of each sampled collection is known to take long.
+	c.WithStatementTimeout(0)
+	return drifted, doInTx(c, d.DB, func(tx *sql.Tx) error {
+		for _, kind := range models.DriftKinds {
+			dc, err := d.CollectionDrift.Sample(c, tx, kind, n)
+			if err != nil {
+				return err
+			}
+			if repair {
+				for _, x := range dc {
+					if err := d.CollectionDrift.Repair(c, tx, kind, x.ID.URL); err != nil {
+						return err
+					}
+				}
+			}
+			drifted = append(drifted, dc...)
+		}
+		return nil
+	})
+}
+
+// Recount sets the totalItems of every collection of each kind to its actual
+// number of items, such as after manual changes to the database, returning the
+// collections that were corrected.
+func (d *CollectionDrift) Recount(c util.Context) (recounted []models.DriftedCollection, err error) {
+	// Counting the items of every collection is known to take long.
+	c.WithStatementTimeout(0)
+	return recounted, doInTx(c, d.DB, func(tx *sql.Tx) error {
+		for _, kind := range models.DriftKinds {
+			dc, err := d.CollectionDrift.Recount(c, tx, kind)
+			if err != nil {
+				return err
+			}
+			recounted = append(recounted, dc...)
+		}
+		return nil
+	})
+}
+
+// EnsureCollections creates an empty collection for every user that is
+// missing one of its inbox, outbox, followers, following, liked, featured
+// tags, or featured collections, such as after a partial migration, and links
+// the featured tags and featured collections, and the shared inbox, from
+// actors created before they existed. It returns the number of collections
+// created, and is safe to run repeatedly.
+func (d *CollectionDrift) EnsureCollections(c util.Context) (created int, err error) {
+	// Finding the users missing collections scans every user.
+	c.WithStatementTimeout(0)
+	create := map[models.DriftKind]func(tx *sql.Tx, actorID *url.URL) error{
+		models.InboxesDrift: func(tx *sql.Tx, actorID *url.URL) error {
+			oc, err := emptyInbox(actorID)
+			if err != nil {
+				return err
+			}
+			return d.Inboxes.Create(c, tx, actorID, models.ActivityStreamsOrderedCollection{oc})
+		},
+		models.OutboxesDrift: func(tx *sql.Tx, actorID *url.URL) error {
+			oc, err := emptyOutbox(actorID)
+			if err != nil {
+				return err
+			}
+			return d.Outboxes.Create(c, tx, actorID, models.ActivityStreamsOrderedCollection{oc})
+		},
+		models.FollowersDrift: func(tx *sql.Tx, actorID *url.URL) error {
+			col, err := emptyFollowers(actorID)
+			if err != nil {
+				return err
+			}
+			return d.Followers.Create(c, tx, actorID, models.ActivityStreamsCollection{col})
+		},
+		models.FollowingDrift: func(tx *sql.Tx, actorID *url.URL) error {
+			col, err := emptyFollowing(actorID)
+			if err != nil {
+				return err
+			}
+			return d.Following.Create(c, tx, actorID, models.ActivityStreamsCollection{col})
+		},
+		models.LikedDrift: func(tx *sql.Tx, actorID *url.URL) error {
+			col, err := emptyLiked(actorID)
+			if err != nil {
+				return err
+			}
+			return d.Liked.Create(c, tx, actorID, models.ActivityStreamsCollection{col})
+		},
+		models.FeaturedTagsDrift: func(tx *sql.Tx, actorID *url.URL) error {
+			col, err := emptyFeaturedTags(actorID)
+			if err != nil {
+				return err
+			}
+			return d.FeaturedTags.Create(c, tx, actorID, models.ActivityStreamsCollection{col})
+		},
+		models.FeaturedDrift: func(tx *sql.Tx, actorID *url.URL) error {
+			col, err := emptyFeatured(actorID)
+			if err != nil {
+				return err
+			}
+			return d.Featured.Create(c, tx, actorID, models.ActivityStreamsCollection{col})
+		},
+	}
+	return created, doInTx(c, d.DB, func(tx *sql.Tx) error {
+		for _, kind := range models.DriftKinds {
+			if !d.CollectionDrift.ActorsOwn(kind) {
+				continue
+			}
+			ids, err := d.CollectionDrift.ActorsMissing(c, tx, kind)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := create[kind](tx, id.URL); err != nil {
+					return err
+				}
+				util.InfoLogger.Infof("Created missing %s collection for actor %s", kind, id)
+				created++
+			}
+		}
+		return d.ensureActorProperties(c, tx)
+	})
+}
+
+// actorProperties are the extension properties of an actor, which actors
+// created by older versions lack, and how to obtain their value from the id of
+// the actor.
+var actorProperties = map[string]func(actorID *url.URL) (interface{}, error){
+	featuredTagsProperty: actorCollectionIRI(paths.FeaturedTagsPathKey),
+	featuredProperty:     actorCollectionIRI(paths.FeaturedPathKey),
+	endpointsProperty:    actorEndpoints,
+}
+
+// actorCollectionIRI obtains the IRI of the actor's collection.
+func actorCollectionIRI(key paths.PathKey) func(actorID *url.URL) (interface{}, error) {
+	return func(actorID *url.URL) (interface{}, error) {
+		iri, err := paths.IRIForActorID(key, actorID)
+		if err != nil {
+			return nil, err
+		}
+		return iri.String(), nil
+	}
+}
+
+// actorEndpoints obtains the endpoints shared by the actors of the actor's
+// server.
+func actorEndpoints(actorID *url.URL) (interface{}, error) {
+	return map[string]interface{}{
+		"sharedInbox": paths.SharedInboxIRI(actorID.Scheme, actorID.Host).String(),
+	}, nil
+}
+
+// ensureActorProperties adds the extension properties missing from the actor
+// of each user.
+func (d *CollectionDrift) ensureActorProperties(c util.Context, tx *sql.Tx) error {
+	for prop, valueFn := range actorProperties {
+		us, err := d.Users.MissingActorProperty(c, tx, prop)
+		if err != nil {
+			return err
+		}
+		for _, u := range us {
+			actor, ok := u.Actor.Type.(userActor)
+			if !ok {
+				return fmt.Errorf("cannot add %s to actor of user %s: unsupported type %T", prop, u.ID, u.Actor.Type)
+			}
+			actorID, err := pub.GetId(actor)
+			if err != nil {
+				return err
+			}
+			v, err := valueFn(actorID)
+			if err != nil {
+				return err
+			}
+			actor.GetUnknownProperties()[prop] = v
+			if err := d.Users.UpdateActor(c, tx, u.ID, u.Actor); err != nil {
+				return err
+			}
+			util.InfoLogger.Infof("Added missing %s property to actor %s", prop, actorID)
+		}
+	}
+	return nil
+}
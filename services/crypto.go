@@ -19,6 +19,8 @@ package services
 import (
 	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 
 	"github.com/go-fed/apcore/models"
@@ -41,10 +43,11 @@ func (c *Crypto) Valid(ctx util.Context, email, pass string) (uuid string, valid
 		su, err = c.Users.SensitiveUserByEmail(ctx, tx, email)
 		return err
 	})
-	if su == nil && err == nil {
+	if errors.Is(err, models.ErrNotFound) {
 		// No email found -- do not return an error. Instead, simply
 		// ensure we're returning an invalid result.
 		valid = false
+		err = nil
 		return
 	}
 	if err != nil {
@@ -84,6 +87,15 @@ func hashPasswordWithSalt(pass string, salt []byte, strength int) (b []byte, err
 	return
 }
 
+// randomPassword creates an unguessable password that is never revealed.
+func randomPassword() (string, error) {
+	b, err := newSalt(32)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // Creates a new salt of the given byte size.
 //
 // The smallest supported salt length is 16 bytes, any shorter request will be
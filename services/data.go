@@ -20,6 +20,8 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
@@ -37,19 +39,67 @@ type Data struct {
 	Following             *Following
 	Followers             *Followers
 	Liked                 *Liked
+	FeaturedTags          *FeaturedTags
+	Featured              *Featured
+	Shares                *Shares
+	Replies               *Replies
 	DefaultCollectionSize int
 	MaxCollectionPageSize int
+	FollowersPageSizes    PageSizes
+	FollowingPageSizes    PageSizes
+	LikedPageSizes        PageSizes
+	// TombstoneLocal replaces deleted local data with a Tombstone instead
+	// of removing it.
+	TombstoneLocal bool
+	// HostAliases are other hosts whose data is owned by this server.
+	HostAliases []string
+	// HostAliasWWW also treats the "www." subdomains of the hostname and
+	// its aliases as owned by this server.
+	HostAliasWWW bool
 }
 
-// Owns determines if this IRI is a local or federated piece of data.
+// Owns determines if this IRI is a local or federated piece of data. IRIs on
+// the aliases of the hostname are local, and refer to the same data as on the
+// hostname.
 func (d *Data) Owns(id *url.URL) bool {
-	return id.Host == d.Hostname
+	host := d.normalizeHost(id.Host)
+	if host == d.normalizeHost(d.Hostname) {
+		return true
+	}
+	for _, alias := range d.HostAliases {
+		if host == d.normalizeHost(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonical is the IRI of owned data as it is stored, on the hostname, for an
+// IRI on any of its aliases. Other IRIs are returned as they are.
+func (d *Data) canonical(id *url.URL) *url.URL {
+	if id.Host == d.Hostname || !d.Owns(id) {
+		return id
+	}
+	c := *id
+	c.Host = d.Hostname
+	return &c
+}
+
+// normalizeHost prepares a host for comparison, ignoring its case and, if
+// aliasing them, any "www." subdomain.
+func (d *Data) normalizeHost(host string) string {
+	host = strings.ToLower(host)
+	if d.HostAliasWWW {
+		host = strings.TrimPrefix(host, "www.")
+	}
+	return host
 }
 
 // Exists determines if this ActivityStreams ID already exists locally or
 // federated.
 func (d *Data) Exists(c util.Context, id *url.URL) (exists bool, err error) {
 	if d.Owns(id) {
+		id = d.canonical(id)
 		err = doInTx(c, d.DB, func(tx *sql.Tx) error {
 			exists, err = d.LocalData.Exists(c, tx, id)
 			return err
@@ -66,14 +116,15 @@ func (d *Data) Exists(c util.Context, id *url.URL) (exists bool, err error) {
 // Get obtains the federated or local ActivityStreams data.
 func (d *Data) Get(c util.Context, id *url.URL) (v vocab.Type, err error) {
 	if d.Owns(id) {
+		id = d.canonical(id)
 		// Determine whether this is a user, any of a user's sub-path data, or local data
 		if paths.IsFollowersPath(id) {
 			any := d.Followers.GetPage
 			last := d.Followers.GetLastPage
 			v, err = DoCollectionPagination(c,
 				id,
-				d.DefaultCollectionSize,
-				d.MaxCollectionPageSize,
+				d.FollowersPageSizes.Default,
+				d.FollowersPageSizes.Max,
 				any,
 				last)
 		} else if paths.IsFollowingPath(id) {
@@ -81,13 +132,55 @@ func (d *Data) Get(c util.Context, id *url.URL) (v vocab.Type, err error) {
 			last := d.Following.GetLastPage
 			v, err = DoCollectionPagination(c,
 				id,
-				d.DefaultCollectionSize,
-				d.MaxCollectionPageSize,
+				d.FollowingPageSizes.Default,
+				d.FollowingPageSizes.Max,
 				any,
 				last)
 		} else if paths.IsLikedPath(id) {
 			any := d.Liked.GetPage
 			last := d.Liked.GetLastPage
+			v, err = DoCollectionPagination(c,
+				id,
+				d.LikedPageSizes.Default,
+				d.LikedPageSizes.Max,
+				any,
+				last)
+		} else if paths.IsFeaturedTagsPath(id) {
+			any := d.FeaturedTags.GetPage
+			last := d.FeaturedTags.GetLastPage
+			v, err = DoCollectionPagination(c,
+				id,
+				d.DefaultCollectionSize,
+				d.MaxCollectionPageSize,
+				any,
+				last)
+		} else if paths.IsFeaturedPath(id) {
+			any := d.Featured.GetPage
+			last := d.Featured.GetLastPage
+			v, err = DoCollectionPagination(c,
+				id,
+				d.DefaultCollectionSize,
+				d.MaxCollectionPageSize,
+				any,
+				last)
+		} else if paths.IsSharesPath(id) {
+			any := d.Shares.GetPage
+			last := d.Shares.GetLastPage
+			v, err = DoCollectionPagination(c,
+				id,
+				d.DefaultCollectionSize,
+				d.MaxCollectionPageSize,
+				any,
+				last)
+		} else if paths.IsRepliesPath(id) {
+			// Only the public replies are served without the
+			// private scope.
+			any := d.Replies.GetPublicPage
+			last := d.Replies.GetPublicLastPage
+			if c.HasPrivateScope() {
+				any = d.Replies.GetPage
+				last = d.Replies.GetLastPage
+			}
 			v, err = DoCollectionPagination(c,
 				id,
 				d.DefaultCollectionSize,
@@ -144,6 +237,20 @@ func (d *Data) Get(c util.Context, id *url.URL) (v vocab.Type, err error) {
 	return
 }
 
+// Created obtains when the local ActivityStreams data was created. Federated
+// data is not found.
+func (d *Data) Created(c util.Context, id *url.URL) (created time.Time, err error) {
+	if !d.Owns(id) {
+		err = fmt.Errorf("%s is not local: %w", id, models.ErrNotFound)
+		return
+	}
+	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+		created, err = d.LocalData.CreateTime(c, tx, id)
+		return err
+	})
+	return
+}
+
 // Create stores the ActivityStreams payload locally or federated.
 func (d *Data) Create(c util.Context, v vocab.Type) (err error) {
 	var iri *url.URL
@@ -169,6 +276,31 @@ func (d *Data) Create(c util.Context, v vocab.Type) (err error) {
 	return
 }
 
+// CacheFederated stores federated data unless data with the same id is already
+// stored, reporting whether it was stored.
+func (d *Data) CacheFederated(c util.Context, v vocab.Type) (cached bool, err error) {
+	var iri *url.URL
+	iri, err = pub.GetId(v)
+	if err != nil {
+		return
+	} else if d.Owns(iri) {
+		err = fmt.Errorf("cannot cache local data as federated data: %s", iri)
+		return
+	}
+	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+		exists, err := d.FedData.Exists(c, tx, iri)
+		if err != nil || exists {
+			return err
+		}
+		if err = d.FedData.Create(c, tx, models.ActivityStreams{v}); err != nil {
+			return err
+		}
+		cached = true
+		return nil
+	})
+	return
+}
+
 // Update updates the ActivityStreams payload locally or federated.
 func (d *Data) Update(c util.Context, v vocab.Type) (err error) {
 	var iri *url.URL
@@ -178,6 +310,7 @@ func (d *Data) Update(c util.Context, v vocab.Type) (err error) {
 	}
 	col, isCol := v.(vocab.ActivityStreamsCollection) // from go-fed/activity/pub
 	if d.Owns(iri) {
+		iri = d.canonical(iri)
 		// The "Update" calls to our well-known collections should only
 		// ever prepend additional items to the first page of a
 		// collection.
@@ -189,8 +322,8 @@ func (d *Data) Update(c util.Context, v vocab.Type) (err error) {
 				return UpdateCollectionToPrependCalls(
 					c,
 					col,
-					d.DefaultCollectionSize,
-					d.MaxCollectionPageSize,
+					d.FollowersPageSizes.Default,
+					d.FollowersPageSizes.Max,
 					d.Followers.GetPage,
 					d.Followers.PrependItem)
 			})
@@ -202,8 +335,8 @@ func (d *Data) Update(c util.Context, v vocab.Type) (err error) {
 				return UpdateCollectionToPrependCalls(
 					c,
 					col,
-					d.DefaultCollectionSize,
-					d.MaxCollectionPageSize,
+					d.FollowingPageSizes.Default,
+					d.FollowingPageSizes.Max,
 					d.Following.GetPage,
 					d.Following.PrependItem)
 			})
@@ -215,8 +348,8 @@ func (d *Data) Update(c util.Context, v vocab.Type) (err error) {
 				return UpdateCollectionToPrependCalls(
 					c,
 					col,
-					d.DefaultCollectionSize,
-					d.MaxCollectionPageSize,
+					d.LikedPageSizes.Default,
+					d.LikedPageSizes.Max,
 					d.Liked.GetPage,
 					d.Liked.PrependItem)
 			})
@@ -233,9 +366,15 @@ func (d *Data) Update(c util.Context, v vocab.Type) (err error) {
 	return
 }
 
-// Delete removes the ActivityStreams payload locally or federated.
+// Delete removes the ActivityStreams payload locally or federated. If
+// TombstoneLocal is set, local payloads are replaced with a Tombstone instead.
 func (d *Data) Delete(c util.Context, iri *url.URL) (err error) {
-	if d.Owns(iri) {
+	iri = d.canonical(iri)
+	if d.Owns(iri) && d.TombstoneLocal {
+		err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+			return d.LocalData.Tombstone(c, tx, iri, time.Now())
+		})
+	} else if d.Owns(iri) {
 		err = doInTx(c, d.DB, func(tx *sql.Tx) error {
 			return d.LocalData.Delete(c, tx, iri)
 		})
@@ -246,3 +385,43 @@ func (d *Data) Delete(c util.Context, iri *url.URL) (err error) {
 	}
 	return
 }
+
+// TombstoneFederated replaces the cached copy of federated data with a
+// Tombstone, if it is cached.
+func (d *Data) TombstoneFederated(c util.Context, iri *url.URL) (tombstoned bool, err error) {
+	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+		tombstoned, err = d.FedData.Tombstone(c, tx, iri, time.Now())
+		return err
+	})
+	return
+}
+
+// PublicTimeline fetches at most n of the data addressed to the public, newest
+// first, older than the data with the maxID unless it is nil. The data is only
+// local unless federated, in which case data received from peers is included
+// as well. Only data of one of the types is fetched, unless no types are
+// given. It reports whether there is more such data after the fetched items.
+func (d *Data) PublicTimeline(c util.Context, federated bool, types []string, maxID *url.URL, n int) (items []vocab.Type, more bool, err error) {
+	var as []models.ActivityStreams
+	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+		// Fetch one more than requested to learn whether there are more.
+		if federated {
+			as, err = d.FedData.PublicTimeline(c, tx, types, maxID, n+1)
+		} else {
+			as, err = d.LocalData.PublicTimeline(c, tx, types, maxID, n+1)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+	if len(as) > n {
+		more = true
+		as = as[:n]
+	}
+	items = make([]vocab.Type, 0, len(as))
+	for _, a := range as {
+		items = append(items, a.Type)
+	}
+	return
+}
@@ -17,7 +17,13 @@
 package services
 
 import (
+	"bytes"
+	"compress/gzip"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"time"
 
@@ -29,12 +35,33 @@ import (
 type DeliveryAttempts struct {
 	DB               *sql.DB
 	DeliveryAttempts *models.DeliveryAttempts
+	// Compress stores new payloads gzip-compressed. Payloads are always
+	// decompressed when read, regardless of this setting.
+	Compress bool
 }
 
 func (d *DeliveryAttempts) InsertAttempt(c util.Context, from paths.UUID, toActor *url.URL, payload []byte) (id string, err error) {
+	activityID := payloadID(payload)
+	if d.Compress {
+		if payload, err = gzipPayload(payload); err != nil {
+			return
+		}
+	}
 	return id, doInTx(c, d.DB, func(tx *sql.Tx) error {
-		id, err = d.DeliveryAttempts.Create(c, tx, string(from), toActor, payload)
+		id, err = d.DeliveryAttempts.Create(c, tx, string(from), toActor, payload, d.Compress, activityID)
+		return err
+	})
+}
+
+// SetSignedHeaders records the headers with which the latest attempt was
+// signed and sent, so that operators can inspect the exact request.
+func (d *DeliveryAttempts) SetSignedHeaders(c util.Context, id string, headers http.Header) error {
+	b, err := json.Marshal(headers)
+	if err != nil {
 		return err
+	}
+	return doInTx(c, d.DB, func(tx *sql.Tx) error {
+		return d.DeliveryAttempts.SetSignedHeaders(c, tx, id, b)
 	})
 }
 
@@ -60,26 +87,37 @@ type RetryableFailure struct {
 	ID          string
 	UserID      string
 	FetchTime   time.Time
+	StaleTime   time.Time
 	DeliverTo   *url.URL
 	Payload     []byte
 	NAttempts   int
 	LastAttempt time.Time
 }
 
-func (d *DeliveryAttempts) FirstPageRetryableFailures(c util.Context, n int) (rf []RetryableFailure, err error) {
+// FirstPageRetryableFailures obtains the first page of failed deliveries, along
+// with deliveries never attempted that were last touched before staleBefore.
+// The latter were lost from the delivery queue, such as by a restart.
+func (d *DeliveryAttempts) FirstPageRetryableFailures(c util.Context, staleBefore time.Time, n int) (rf []RetryableFailure, err error) {
 	now := time.Now()
 	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
-		f, err := d.DeliveryAttempts.FirstPageFailures(c, tx, now, n)
+		f, err := d.DeliveryAttempts.FirstPageFailures(c, tx, now, staleBefore, n)
 		if err != nil {
 			return err
 		}
 		for _, a := range f {
+			payload := a.Payload
+			if a.Compressed {
+				if payload, err = gunzipPayload(payload); err != nil {
+					return err
+				}
+			}
 			r := RetryableFailure{
 				ID:          a.ID,
 				UserID:      a.UserID,
 				FetchTime:   now,
+				StaleTime:   staleBefore,
 				DeliverTo:   a.DeliverTo.URL,
-				Payload:     a.Payload,
+				Payload:     payload,
 				NAttempts:   a.NAttempts,
 				LastAttempt: a.LastAttempt,
 			}
@@ -90,19 +128,26 @@ func (d *DeliveryAttempts) FirstPageRetryableFailures(c util.Context, n int) (rf
 	return
 }
 
-func (d *DeliveryAttempts) NextPageRetryableFailures(c util.Context, prevID string, fetch time.Time, n int) (rf []RetryableFailure, err error) {
+func (d *DeliveryAttempts) NextPageRetryableFailures(c util.Context, prevID string, fetch, staleBefore time.Time, n int) (rf []RetryableFailure, err error) {
 	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
-		f, err := d.DeliveryAttempts.NextPageFailures(c, tx, prevID, fetch, n)
+		f, err := d.DeliveryAttempts.NextPageFailures(c, tx, prevID, fetch, staleBefore, n)
 		if err != nil {
 			return err
 		}
 		for _, a := range f {
+			payload := a.Payload
+			if a.Compressed {
+				if payload, err = gunzipPayload(payload); err != nil {
+					return err
+				}
+			}
 			r := RetryableFailure{
 				ID:          a.ID,
 				UserID:      a.UserID,
 				FetchTime:   fetch,
+				StaleTime:   staleBefore,
 				DeliverTo:   a.DeliverTo.URL,
-				Payload:     a.Payload,
+				Payload:     payload,
 				NAttempts:   a.NAttempts,
 				LastAttempt: a.LastAttempt,
 			}
@@ -112,3 +157,142 @@ func (d *DeliveryAttempts) NextPageRetryableFailures(c util.Context, prevID stri
 	})
 	return
 }
+
+// DeliveryRecord is the state of delivering an activity to one of its
+// recipients.
+type DeliveryRecord struct {
+	UserID      paths.UUID
+	Recipient   *url.URL
+	State       string
+	NAttempts   int
+	LastAttempt time.Time
+}
+
+// DeliveryStatus returns the state of delivering the activity to each of its
+// recipients. Only deliveries attempted since activity ids began being recorded
+// are known.
+func (d *DeliveryAttempts) DeliveryStatus(c util.Context, activity *url.URL) (dr []DeliveryRecord, err error) {
+	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+		ds, err := d.DeliveryAttempts.ForActivity(c, tx, activity)
+		if err != nil {
+			return err
+		}
+		for _, s := range ds {
+			dr = append(dr, DeliveryRecord{
+				UserID:      paths.UUID(s.UserID),
+				Recipient:   s.DeliverTo.URL,
+				State:       s.State,
+				NAttempts:   s.NAttempts,
+				LastAttempt: s.LastAttempt,
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// DeliveryAttemptNotFound is returned when fetching a delivery attempt that
+// does not exist.
+var DeliveryAttemptNotFound error = errors.New("delivery attempt does not exist")
+
+// DeliveryAttempt is a single attempt at delivering a payload to a recipient,
+// including the exact payload that was signed and sent, and the headers,
+// including the signature, of the latest request that sent it.
+type DeliveryAttempt struct {
+	ID            string          `json:"id"`
+	Created       time.Time       `json:"created"`
+	UserID        paths.UUID      `json:"userId"`
+	Recipient     *url.URL        `json:"-"`
+	ActivityID    string          `json:"activityId,omitempty"`
+	State         string          `json:"state"`
+	NAttempts     int             `json:"attempts"`
+	LastAttempt   time.Time       `json:"lastAttempt"`
+	Payload       json.RawMessage `json:"payload"`
+	SignedHeaders http.Header     `json:"signedHeaders,omitempty"`
+}
+
+// MarshalJSON serializes the recipient as a string alongside the other
+// fields.
+func (d DeliveryAttempt) MarshalJSON() ([]byte, error) {
+	type attempt DeliveryAttempt
+	return json.Marshal(struct {
+		attempt
+		Recipient string `json:"recipient"`
+	}{
+		attempt:   attempt(d),
+		Recipient: d.Recipient.String(),
+	})
+}
+
+// GetAttempt returns the delivery attempt with its decompressed payload, for
+// operators debugging failed deliveries. DeliveryAttemptNotFound is returned
+// if there is no such attempt.
+func (d *DeliveryAttempts) GetAttempt(c util.Context, id string) (da DeliveryAttempt, err error) {
+	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+		a, err := d.DeliveryAttempts.GetByID(c, tx, id)
+		if errors.Is(err, models.ErrNotFound) {
+			return DeliveryAttemptNotFound
+		} else if err != nil {
+			return err
+		}
+		payload := a.Payload
+		if a.Compressed {
+			if payload, err = gunzipPayload(payload); err != nil {
+				return err
+			}
+		}
+		var signed http.Header
+		if len(a.SignedHeaders) > 0 {
+			if err := json.Unmarshal(a.SignedHeaders, &signed); err != nil {
+				return err
+			}
+		}
+		da = DeliveryAttempt{
+			ID:            a.ID,
+			Created:       a.CreateTime,
+			UserID:        paths.UUID(a.UserID),
+			Recipient:     a.DeliverTo.URL,
+			ActivityID:    a.ActivityID.String,
+			State:         a.State,
+			NAttempts:     a.NAttempts,
+			LastAttempt:   a.LastAttempt,
+			Payload:       payload,
+			SignedHeaders: signed,
+		}
+		return nil
+	})
+	return
+}
+
+// payloadID returns the id of the serialized activity, or an empty string if
+// it has none.
+func payloadID(b []byte) string {
+	var v struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return ""
+	}
+	return v.ID
+}
+
+func gzipPayload(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipPayload(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,90 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"net"
+	"strings"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/util"
+)
+
+// Domains restricts which domains are federated with. When neither Allowlist
+// nor Blocklist is set, every domain is federated with.
+type Domains struct {
+	DB        *sql.DB
+	Domains   *models.Domains
+	Allowlist bool
+	Blocklist bool
+}
+
+// IsBlocked determines whether federating with the host is refused. Any port
+// of the host is ignored.
+func (d *Domains) IsBlocked(c util.Context, host string) (blocked bool, err error) {
+	if !d.Allowlist && !d.Blocklist {
+		return false, nil
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	err = doInTx(c, d.DB, func(tx *sql.Tx) error {
+		if d.Allowlist {
+			var allowed bool
+			allowed, err = d.Domains.Contains(c, tx, models.AllowedDomains, host)
+			blocked = !allowed
+			return err
+		}
+		blocked, err = d.Domains.Contains(c, tx, models.BlockedDomains, host)
+		return err
+	})
+	return
+}
+
+// Allow adds the host to the domains federated with in allowlist mode.
+func (d *Domains) Allow(c util.Context, host string) error {
+	return d.add(c, models.AllowedDomains, host)
+}
+
+// Disallow removes the host from the domains federated with in allowlist mode.
+func (d *Domains) Disallow(c util.Context, host string) error {
+	return d.remove(c, models.AllowedDomains, host)
+}
+
+// Block adds the host to the domains refused in blocklist mode.
+func (d *Domains) Block(c util.Context, host string) error {
+	return d.add(c, models.BlockedDomains, host)
+}
+
+// Unblock removes the host from the domains refused in blocklist mode.
+func (d *Domains) Unblock(c util.Context, host string) error {
+	return d.remove(c, models.BlockedDomains, host)
+}
+
+func (d *Domains) add(c util.Context, list models.DomainList, host string) error {
+	return doInTx(c, d.DB, func(tx *sql.Tx) error {
+		return d.Domains.Add(c, tx, list, strings.ToLower(host))
+	})
+}
+
+func (d *Domains) remove(c util.Context, list models.DomainList, host string) error {
+	return doInTx(c, d.DB, func(tx *sql.Tx) error {
+		return d.Domains.Remove(c, tx, list, strings.ToLower(host))
+	})
+}
@@ -0,0 +1,139 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// InvalidEmojiShortcode is returned when defining a custom emoji whose
+// shortcode is not made of letters, digits, and underscores.
+var InvalidEmojiShortcode error = errors.New("emoji shortcodes may only contain letters, digits, and underscores")
+
+var emojiShortcode = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// Emoji manages the custom emoji defined on this server, which notes refer to
+// in their content by ":shortcode:" and in their tags as toot:Emoji.
+type Emoji struct {
+	Scheme string
+	Host   string
+	DB     *sql.DB
+	Emoji  *models.Emoji
+}
+
+// Put defines the custom emoji, displayed using the image at the IRI. An
+// existing emoji with the same shortcode is replaced.
+func (e *Emoji) Put(c util.Context, shortcode string, image *url.URL, mediaType string) error {
+	if !emojiShortcode.MatchString(shortcode) {
+		return InvalidEmojiShortcode
+	}
+	return doInTx(c, e.DB, func(tx *sql.Tx) error {
+		return e.Emoji.Upsert(c, tx, shortcode, image, mediaType)
+	})
+}
+
+// Delete removes the custom emoji.
+func (e *Emoji) Delete(c util.Context, shortcode string) error {
+	return doInTx(c, e.DB, func(tx *sql.Tx) error {
+		return e.Emoji.Delete(c, tx, shortcode)
+	})
+}
+
+// Get fetches the custom emoji, suitable for a note's tags. It is nil if there
+// is no such emoji.
+func (e *Emoji) Get(c util.Context, shortcode string) (emoji vocab.TootEmoji, err error) {
+	err = doInTx(c, e.DB, func(tx *sql.Tx) error {
+		ei, found, err := e.Emoji.Get(c, tx, shortcode)
+		if err != nil || !found {
+			return err
+		}
+		emoji = e.toEmoji(ei)
+		return nil
+	})
+	return
+}
+
+// GetAll fetches every custom emoji.
+func (e *Emoji) GetAll(c util.Context) (emoji []vocab.TootEmoji, err error) {
+	err = doInTx(c, e.DB, func(tx *sql.Tx) error {
+		ei, err := e.Emoji.GetAll(c, tx)
+		if err != nil {
+			return err
+		}
+		for _, v := range ei {
+			emoji = append(emoji, e.toEmoji(v))
+		}
+		return nil
+	})
+	return
+}
+
+// Collection fetches every custom emoji as a collection, for peers and clients
+// to discover them.
+func (e *Emoji) Collection(c util.Context) (col vocab.ActivityStreamsCollection, err error) {
+	var emoji []vocab.TootEmoji
+	if emoji, err = e.GetAll(c); err != nil {
+		return
+	}
+	col = streams.NewActivityStreamsCollection()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(paths.EmojiIRI(e.Scheme, e.Host))
+	col.SetJSONLDId(idProp)
+	tiProp := streams.NewActivityStreamsTotalItemsProperty()
+	tiProp.Set(len(emoji))
+	col.SetActivityStreamsTotalItems(tiProp)
+	items := streams.NewActivityStreamsItemsProperty()
+	for _, v := range emoji {
+		items.AppendTootEmoji(v)
+	}
+	col.SetActivityStreamsItems(items)
+	return
+}
+
+func (e *Emoji) toEmoji(ei models.EmojiInfo) vocab.TootEmoji {
+	emoji := streams.NewTootEmoji()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(paths.EmojiIRIFor(e.Scheme, e.Host, ei.Shortcode))
+	emoji.SetJSONLDId(idProp)
+	name := streams.NewActivityStreamsNameProperty()
+	name.AppendXMLSchemaString(":" + ei.Shortcode + ":")
+	emoji.SetActivityStreamsName(name)
+	updated := streams.NewActivityStreamsUpdatedProperty()
+	updated.Set(ei.Updated)
+	emoji.SetActivityStreamsUpdated(updated)
+
+	image := streams.NewActivityStreamsImage()
+	mediaType := streams.NewActivityStreamsMediaTypeProperty()
+	mediaType.Set(ei.MediaType)
+	image.SetActivityStreamsMediaType(mediaType)
+	u := streams.NewActivityStreamsUrlProperty()
+	u.AppendIRI(ei.ImageIRI.URL)
+	image.SetActivityStreamsUrl(u)
+	icon := streams.NewActivityStreamsIconProperty()
+	icon.AppendActivityStreamsImage(image)
+	emoji.SetActivityStreamsIcon(icon)
+	return emoji
+}
@@ -0,0 +1,135 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// TooManyPins is returned when pinning an object would exceed the maximum
+// number of objects an actor may feature.
+var TooManyPins error = errors.New("the maximum number of pinned objects has been reached")
+
+// defaultMaxPins is the maximum number of pinned objects when unconfigured.
+const defaultMaxPins = 5
+
+// Featured maintains the collection of objects, such as posts, each actor has
+// pinned to their profile.
+type Featured struct {
+	DB       *sql.DB
+	Featured *models.Featured
+	// MaxPins is the maximum number of objects an actor may feature, where
+	// zero uses the default.
+	MaxPins int
+}
+
+func (f *Featured) GetPage(c util.Context, featured *url.URL, min, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var isEnd bool
+		var mp models.ActivityStreamsCollectionPage
+		mp, isEnd, err = f.Featured.GetPage(c, tx, featured, min, min+n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, min, n, isEnd)
+	})
+	return
+}
+
+func (f *Featured) GetLastPage(c util.Context, featured *url.URL, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var startIdx int
+		var mp models.ActivityStreamsCollectionPage
+		mp, startIdx, err = f.Featured.GetLastPage(c, tx, featured, n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, startIdx, n, true)
+	})
+	return
+}
+
+// GetShell returns the featured collection without any of its items.
+func (f *Featured) GetShell(c util.Context, featured *url.URL) (col vocab.ActivityStreamsCollection, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var n int
+		n, err = f.Featured.Count(c, tx, paths.Normalize(featured))
+		if err != nil {
+			return err
+		}
+		col = collectionShell(featured, n)
+		return nil
+	})
+	return
+}
+
+// Pin adds the object to the front of the actor's featured collection, if it
+// is not already present. TooManyPins is returned if the actor already
+// features the maximum number of objects.
+//
+// The limit is checked by the same statement that adds the object, so that
+// concurrent pins cannot exceed it.
+func (f *Featured) Pin(c util.Context, actor, object *url.URL) error {
+	featured, err := paths.IRIForActorID(paths.FeaturedPathKey, actor)
+	if err != nil {
+		return err
+	}
+	max := f.MaxPins
+	if max == 0 {
+		max = defaultMaxPins
+	}
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		prepended, err := f.Featured.PrependItem(c, tx, featured, object, max)
+		if err != nil || prepended {
+			return err
+		}
+		has, err := f.Featured.Contains(c, tx, featured, object)
+		if err != nil {
+			return err
+		} else if has {
+			return nil
+		}
+		return TooManyPins
+	})
+}
+
+// Unpin removes the object from the actor's featured collection, if it is
+// present.
+func (f *Featured) Unpin(c util.Context, actor, object *url.URL) error {
+	featured, err := paths.IRIForActorID(paths.FeaturedPathKey, actor)
+	if err != nil {
+		return err
+	}
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		has, err := f.Featured.Contains(c, tx, featured, object)
+		if err != nil {
+			return err
+		} else if !has {
+			return nil
+		}
+		return f.Featured.DeleteItem(c, tx, featured, object)
+	})
+}
@@ -0,0 +1,159 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+type FeaturedTags struct {
+	DB           *sql.DB
+	FeaturedTags *models.FeaturedTags
+	Users        *models.Users
+}
+
+func (f *FeaturedTags) GetPage(c util.Context, featured *url.URL, min, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var isEnd bool
+		var mp models.ActivityStreamsCollectionPage
+		mp, isEnd, err = f.FeaturedTags.GetPage(c, tx, featured, min, min+n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, min, n, isEnd)
+	})
+	return
+}
+
+func (f *FeaturedTags) GetLastPage(c util.Context, featured *url.URL, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var startIdx int
+		var mp models.ActivityStreamsCollectionPage
+		mp, startIdx, err = f.FeaturedTags.GetLastPage(c, tx, featured, n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, startIdx, n, true)
+	})
+	return
+}
+
+// GetShell returns the featured tags collection without any of its items.
+func (f *FeaturedTags) GetShell(c util.Context, featured *url.URL) (col vocab.ActivityStreamsCollection, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var n int
+		n, err = f.FeaturedTags.Count(c, tx, paths.Normalize(featured))
+		if err != nil {
+			return err
+		}
+		col = collectionShell(featured, n)
+		return nil
+	})
+	return
+}
+
+// Pin adds the tag to the actor's featured tags as a Hashtag, if it is not
+// already present. The hashtag is named after the last segment of the tag's
+// path, as peers display it.
+//
+// Actors created before featured tags existed, whose collections were not
+// ensured on start, have the collection created and linked on their first pin.
+func (f *FeaturedTags) Pin(c util.Context, actor, tag *url.URL) error {
+	featured, err := paths.IRIForActorID(paths.FeaturedTagsPathKey, actor)
+	if err != nil {
+		return err
+	}
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		if err := f.ensureCollection(c, tx, actor, featured); err != nil {
+			return err
+		}
+		has, err := f.FeaturedTags.Contains(c, tx, featured, tag)
+		if err != nil {
+			return err
+		} else if has {
+			return nil
+		}
+		return f.FeaturedTags.PrependItem(c, tx, featured, tag, hashtagName(tag))
+	})
+}
+
+// hashtagName is the name of the Hashtag for the tag IRI.
+func hashtagName(tag *url.URL) string {
+	return "#" + path.Base(tag.Path)
+}
+
+// ensureCollection creates the actor's featured tags collection, and links it
+// from the actor, if it does not exist.
+func (f *FeaturedTags) ensureCollection(c util.Context, tx *sql.Tx, actor, featured *url.URL) error {
+	exists, err := f.FeaturedTags.Exists(c, tx, featured)
+	if err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+	col, err := emptyFeaturedTags(actor)
+	if err != nil {
+		return err
+	}
+	if err := f.FeaturedTags.Create(c, tx, actor, models.ActivityStreamsCollection{col}); err != nil {
+		return err
+	}
+	uuid, err := paths.UUIDFromUserPath(actor.Path)
+	if err != nil {
+		return err
+	}
+	u, err := f.Users.UserByID(c, tx, string(uuid))
+	if err != nil {
+		return err
+	}
+	ua, ok := u.Actor.Type.(userActor)
+	if !ok {
+		return fmt.Errorf("cannot add %s to actor of user %s: unsupported type %T", featuredTagsProperty, u.ID, u.Actor.Type)
+	}
+	if _, has := ua.GetUnknownProperties()[featuredTagsProperty]; has {
+		return nil
+	}
+	ua.GetUnknownProperties()[featuredTagsProperty] = featured.String()
+	return f.Users.UpdateActor(c, tx, u.ID, u.Actor)
+}
+
+// Unpin removes the tag from the actor's featured tags, if it is present.
+func (f *FeaturedTags) Unpin(c util.Context, actor, tag *url.URL) error {
+	featured, err := paths.IRIForActorID(paths.FeaturedTagsPathKey, actor)
+	if err != nil {
+		return err
+	}
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		has, err := f.FeaturedTags.Contains(c, tx, featured, tag)
+		if err != nil {
+			return err
+		} else if !has {
+			return nil
+		}
+		return f.FeaturedTags.DeleteItem(c, tx, featured, tag)
+	})
+}
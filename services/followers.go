@@ -22,6 +22,7 @@ import (
 
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/util"
 )
 
@@ -72,6 +73,20 @@ func (f *Followers) GetLastPage(c util.Context, followers *url.URL, n int) (page
 	return
 }
 
+// GetShell returns the followers collection without any of its items.
+func (f *Followers) GetShell(c util.Context, followers *url.URL) (col vocab.ActivityStreamsCollection, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var n int
+		n, err = f.Followers.Count(c, tx, paths.Normalize(followers))
+		if err != nil {
+			return err
+		}
+		col = collectionShell(followers, n)
+		return nil
+	})
+	return
+}
+
 func (f *Followers) PrependItem(c util.Context, followers, item *url.URL) error {
 	return doInTx(c, f.DB, func(tx *sql.Tx) error {
 		return f.Followers.PrependItem(c, tx, followers, item)
@@ -97,6 +112,21 @@ func (f *Followers) GetAllForActor(c util.Context, actor *url.URL) (col vocab.Ac
 	return
 }
 
+// FollowReceivedFrom returns the most recent Follow of the actor received from
+// the follower, or nil if there is none.
+func (f *Followers) FollowReceivedFrom(c util.Context, actorIRI, follower *url.URL) (r vocab.ActivityStreamsFollow, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		follow, found, err := f.Followers.FollowReceivedFrom(c, tx, actorIRI, follower)
+		if err != nil {
+			return err
+		} else if found {
+			r = follow.ActivityStreamsFollow
+		}
+		return nil
+	})
+	return
+}
+
 func (f *Followers) OpenFollowRequests(c util.Context, actorIRI *url.URL) (r []vocab.ActivityStreamsFollow, err error) {
 	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
 		var fs []models.ActivityStreamsFollow
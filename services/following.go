@@ -22,6 +22,7 @@ import (
 
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/util"
 )
 
@@ -72,6 +73,20 @@ func (f *Following) GetLastPage(c util.Context, following *url.URL, n int) (page
 	return
 }
 
+// GetShell returns the following collection without any of its items.
+func (f *Following) GetShell(c util.Context, following *url.URL) (col vocab.ActivityStreamsCollection, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var n int
+		n, err = f.Following.Count(c, tx, paths.Normalize(following))
+		if err != nil {
+			return err
+		}
+		col = collectionShell(following, n)
+		return nil
+	})
+	return
+}
+
 func (f *Following) PrependItem(c util.Context, following, item *url.URL) error {
 	return doInTx(c, f.DB, func(tx *sql.Tx) error {
 		return f.Following.PrependItem(c, tx, following, item)
@@ -96,3 +111,31 @@ func (f *Following) GetAllForActor(c util.Context, actor *url.URL) (col vocab.Ac
 	})
 	return
 }
+
+// PendingFollows returns the Follows sent by the actor that are awaiting an
+// Accept or Reject. The followed actors are only added to the following
+// collection once their Accept is received.
+func (f *Following) PendingFollows(c util.Context, actorIRI *url.URL) (r []vocab.ActivityStreamsFollow, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var fs []models.ActivityStreamsFollow
+		fs, err = f.Following.PendingFollows(c, tx, actorIRI)
+		if err != nil {
+			return err
+		}
+		for _, v := range fs {
+			r = append(r, v.ActivityStreamsFollow)
+		}
+		return err
+	})
+	return
+}
+
+// ActorsFollowing returns the actors whose following collection contains the
+// item.
+func (f *Following) ActorsFollowing(c util.Context, item *url.URL) (actors []*url.URL, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		actors, err = f.Following.ActorsFollowing(c, tx, item)
+		return err
+	})
+	return
+}
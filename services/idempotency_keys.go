@@ -0,0 +1,92 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/util"
+)
+
+type IdempotencyKeys struct {
+	DB              *sql.DB
+	IdempotencyKeys *models.IdempotencyKeys
+	InboxProcessed  *models.InboxProcessed
+}
+
+// Get returns the activity previously created in the outbox using the key. The
+// activity is nil if the key has not yet been used, or is reserved by a request
+// that has yet to create one.
+func (i *IdempotencyKeys) Get(c util.Context, outbox *url.URL, key string) (activity *url.URL, err error) {
+	return activity, doInTx(c, i.DB, func(tx *sql.Tx) error {
+		activity, _, err = i.IdempotencyKeys.Get(c, tx, outbox, key)
+		return err
+	})
+}
+
+// Reserve records that a request is using the key on the outbox, reporting
+// false if another request already used or is using it.
+func (i *IdempotencyKeys) Reserve(c util.Context, outbox *url.URL, key string) (reserved bool, err error) {
+	return reserved, doInTx(c, i.DB, func(tx *sql.Tx) error {
+		reserved, err = i.IdempotencyKeys.Reserve(c, tx, outbox, key)
+		return err
+	})
+}
+
+// Put records the activity created in the outbox using the reserved key.
+func (i *IdempotencyKeys) Put(c util.Context, outbox *url.URL, key string, activity *url.URL) error {
+	return doInTx(c, i.DB, func(tx *sql.Tx) error {
+		return i.IdempotencyKeys.SetActivity(c, tx, outbox, key, activity)
+	})
+}
+
+// Release forgets the reservation of a key whose request created no activity,
+// so that a retry of the request is applied.
+func (i *IdempotencyKeys) Release(c util.Context, outbox *url.URL, key string) error {
+	return doInTx(c, i.DB, func(tx *sql.Tx) error {
+		return i.IdempotencyKeys.Release(c, tx, outbox, key)
+	})
+}
+
+// ReserveInboxProcessed records that the inbox is processing the activity,
+// reporting false if it already processed or is processing it.
+func (i *IdempotencyKeys) ReserveInboxProcessed(c util.Context, inbox, activity *url.URL) (reserved bool, err error) {
+	return reserved, doInTx(c, i.DB, func(tx *sql.Tx) error {
+		reserved, err = i.InboxProcessed.Reserve(c, tx, inbox, activity)
+		return err
+	})
+}
+
+// ReleaseInboxProcessed forgets the reservation of an activity the inbox failed
+// to process, so that a redelivery of it is processed.
+func (i *IdempotencyKeys) ReleaseInboxProcessed(c util.Context, inbox, activity *url.URL) error {
+	return doInTx(c, i.DB, func(tx *sql.Tx) error {
+		return i.InboxProcessed.Release(c, tx, inbox, activity)
+	})
+}
+
+// PruneInboxProcessed forgets the activities processed before the given time,
+// whose redelivery is no longer expected.
+func (i *IdempotencyKeys) PruneInboxProcessed(c util.Context, before time.Time) (n int64, err error) {
+	return n, doInTx(c, i.DB, func(tx *sql.Tx) error {
+		n, err = i.InboxProcessed.Prune(c, tx, before)
+		return err
+	})
+}
@@ -28,6 +28,9 @@ import (
 type Inboxes struct {
 	DB      *sql.DB
 	Inboxes *models.Inboxes
+	// FedData, if set, is used to immediately delete federated data
+	// removed from an inbox once no collection refers to it anymore.
+	FedData *models.FedData
 }
 
 func (i *Inboxes) GetPage(c util.Context, inbox *url.URL, min, n int) (page vocab.ActivityStreamsOrderedCollectionPage, err error) {
@@ -108,6 +111,12 @@ func (i *Inboxes) PrependItem(c util.Context, inbox, item *url.URL) error {
 
 func (i *Inboxes) DeleteItem(c util.Context, inbox, item *url.URL) error {
 	return doInTx(c, i.DB, func(tx *sql.Tx) error {
-		return i.Inboxes.DeleteInboxItem(c, tx, inbox, item)
+		if err := i.Inboxes.DeleteInboxItem(c, tx, inbox, item); err != nil {
+			return err
+		} else if i.FedData == nil {
+			return nil
+		}
+		_, err := i.FedData.DeleteIfUnreferenced(c, tx, item)
+		return err
 	})
 }
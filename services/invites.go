@@ -0,0 +1,129 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+var (
+	// InvalidInvite is returned when consuming an invite code that does
+	// not exist, has expired, or has no uses remaining.
+	InvalidInvite error = errors.New("invite code is invalid, expired, or used up")
+	// InvalidInviteMaxUses is returned when creating an invite code that
+	// cannot be used.
+	InvalidInviteMaxUses error = errors.New("invite code must be usable at least once")
+)
+
+// inviteCodeBytes is the number of random bytes in an invite code.
+const inviteCodeBytes = 16
+
+// Invite is an invite code, which may be used to register up to a maximum
+// number of times until it expires.
+type Invite struct {
+	Code      string     `json:"code"`
+	CreatedBy paths.UUID `json:"createdBy"`
+	Created   time.Time  `json:"created"`
+	MaxUses   int        `json:"maxUses"`
+	Remaining int        `json:"remaining"`
+	// Expires is nil if the invite never expires.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Invites manages the invite codes that permit registering while the server
+// does not have open registrations.
+type Invites struct {
+	DB      *sql.DB
+	Invites *models.Invites
+}
+
+// Create mints a new invite code on behalf of the admin, usable maxUses times
+// until it expires. A zero expiry never expires.
+func (i *Invites) Create(c util.Context, adminID paths.UUID, maxUses int, expires time.Time) (code string, err error) {
+	if maxUses < 1 {
+		err = InvalidInviteMaxUses
+		return
+	}
+	b := make([]byte, inviteCodeBytes)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	code = base64.RawURLEncoding.EncodeToString(b)
+	var exp *time.Time
+	if !expires.IsZero() {
+		exp = &expires
+	}
+	err = doInTx(c, i.DB, func(tx *sql.Tx) error {
+		return i.Invites.Create(c, tx, code, string(adminID), maxUses, exp)
+	})
+	return
+}
+
+// Consume uses up one of the remaining uses of the invite code. InvalidInvite
+// is returned if it cannot be used. Concurrent consumers never use it more
+// than its maximum number of times.
+func (i *Invites) Consume(c util.Context, code string) error {
+	return doInTx(c, i.DB, func(tx *sql.Tx) error {
+		ok, err := i.Invites.Consume(c, tx, code)
+		if err != nil {
+			return err
+		} else if !ok {
+			return InvalidInvite
+		}
+		return nil
+	})
+}
+
+// Release returns a use of the invite code that was consumed for a
+// registration that then failed.
+func (i *Invites) Release(c util.Context, code string) error {
+	return doInTx(c, i.DB, func(tx *sql.Tx) error {
+		return i.Invites.Release(c, tx, code)
+	})
+}
+
+// GetAll fetches every invite code, most recently created first.
+func (i *Invites) GetAll(c util.Context) (iv []Invite, err error) {
+	var mi []models.Invite
+	err = doInTx(c, i.DB, func(tx *sql.Tx) error {
+		mi, err = i.Invites.GetAll(c, tx)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	iv = make([]Invite, len(mi))
+	for j, v := range mi {
+		iv[j] = Invite{
+			Code:      v.Code,
+			CreatedBy: paths.UUID(v.CreatedBy),
+			Created:   v.Created,
+			MaxUses:   v.MaxUses,
+			Remaining: v.Remaining,
+			Expires:   v.Expires,
+		}
+	}
+	return
+}
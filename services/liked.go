@@ -22,6 +22,7 @@ import (
 
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/util"
 )
 
@@ -72,6 +73,20 @@ func (f *Liked) GetLastPage(c util.Context, liked *url.URL, n int) (page vocab.A
 	return
 }
 
+// GetShell returns the liked collection without any of its items.
+func (f *Liked) GetShell(c util.Context, liked *url.URL) (col vocab.ActivityStreamsCollection, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var n int
+		n, err = f.Liked.Count(c, tx, paths.Normalize(liked))
+		if err != nil {
+			return err
+		}
+		col = collectionShell(liked, n)
+		return nil
+	})
+	return
+}
+
 func (f *Liked) PrependItem(c util.Context, liked, item *url.URL) error {
 	return doInTx(c, f.DB, func(tx *sql.Tx) error {
 		return f.Liked.PrependItem(c, tx, liked, item)
@@ -84,6 +99,32 @@ func (f *Liked) DeleteItem(c util.Context, liked, item *url.URL) error {
 	})
 }
 
+// AddItem prepends the item to the liked collection, unless it already
+// contains the item, so that its totalItems remains consistent.
+func (f *Liked) AddItem(c util.Context, liked, item *url.URL) error {
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		if has, err := f.Liked.Contains(c, tx, liked, item); err != nil {
+			return err
+		} else if has {
+			return nil
+		}
+		return f.Liked.PrependItem(c, tx, liked, item)
+	})
+}
+
+// RemoveItem deletes the item from the liked collection, if it contains the
+// item, so that its totalItems remains consistent.
+func (f *Liked) RemoveItem(c util.Context, liked, item *url.URL) error {
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		if has, err := f.Liked.Contains(c, tx, liked, item); err != nil {
+			return err
+		} else if !has {
+			return nil
+		}
+		return f.Liked.DeleteItem(c, tx, liked, item)
+	})
+}
+
 func (f *Liked) GetAllForActor(c util.Context, actor *url.URL) (col vocab.ActivityStreamsCollection, err error) {
 	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
 		var mc models.ActivityStreamsCollection
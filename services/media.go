@@ -0,0 +1,256 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+	"github.com/google/uuid"
+)
+
+var (
+	MediaTooLarge      error = errors.New("media exceeds the maximum size")
+	MediaTypeForbidden error = errors.New("media content type is not allowed")
+	MediaTypeMismatch  error = errors.New("media content type does not match its contents")
+)
+
+// Storage keeps the contents of uploaded media, while the Media service keeps
+// its metadata in the database.
+type Storage interface {
+	// Put stores the contents at the path, replacing any existing contents.
+	Put(c context.Context, path string, b []byte, contentType string) error
+	// Get opens the contents stored at the path.
+	Get(c context.Context, path string) (io.ReadCloser, error)
+	// Delete removes the contents stored at the path.
+	Delete(c context.Context, path string) error
+}
+
+type Media struct {
+	Scheme  string
+	Host    string
+	DB      *sql.DB
+	Media   *models.Media
+	Storage Storage
+	// MaxSize is the largest number of bytes an upload may have. A
+	// non-positive value does not limit the size.
+	MaxSize int64
+	// AllowedContentTypes are the prefixes of the content types that may be
+	// uploaded, such as "image/". If empty, all content types are allowed.
+	AllowedContentTypes []string
+	// DefaultThumbnailDim is the largest width and height of thumbnails
+	// when no size is requested.
+	DefaultThumbnailDim int
+	// MaxThumbnailDim is the largest width and height that a thumbnail may
+	// be requested with.
+	MaxThumbnailDim int
+}
+
+// MediaFile is the metadata of uploaded media.
+type MediaFile struct {
+	ID          string
+	UserID      paths.UUID
+	ContentType string
+	Size        int64
+}
+
+// Put stores the media uploaded by the user and returns the IRI it is served
+// at. The content type is determined from the contents themselves where they
+// are recognized, and the upload is rejected if the provided contentType
+// disagrees with them or they are HTML or an executable.
+func (m *Media) Put(c util.Context, userID paths.UUID, r io.Reader, contentType string) (iri *url.URL, err error) {
+	if m.MaxSize > 0 {
+		r = io.LimitReader(r, m.MaxSize+1)
+	}
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	} else if m.MaxSize > 0 && int64(len(b)) > m.MaxSize {
+		err = MediaTooLarge
+		return
+	}
+	if contentType, err = sniffContentType(b, contentType); err != nil {
+		return
+	} else if !m.isAllowed(contentType) {
+		err = MediaTypeForbidden
+		return
+	}
+	path := string(userID) + "/" + uuid.New().String()
+	if err = m.Storage.Put(c, path, b, contentType); err != nil {
+		return
+	}
+	var id string
+	err = doInTx(c, m.DB, func(tx *sql.Tx) error {
+		id, err = m.Media.Create(c, tx, string(userID), contentType, int64(len(b)), path)
+		return err
+	})
+	if err != nil {
+		if derr := m.Storage.Delete(c, path); derr != nil {
+			util.ErrorLogger.Errorf("Error deleting media %s after failing to record it: %s", path, derr)
+		}
+		return
+	}
+	iri = paths.MediaIRIFor(m.Scheme, m.Host, id)
+	return
+}
+
+// Get opens the media with the given id. If there is no such media, a nil
+// MediaFile is returned.
+func (m *Media) Get(c util.Context, id string) (mf *MediaFile, rc io.ReadCloser, err error) {
+	var mi models.MediaInfo
+	var found bool
+	err = doInTx(c, m.DB, func(tx *sql.Tx) error {
+		mi, found, err = m.Media.Get(c, tx, id)
+		return err
+	})
+	if err != nil || !found {
+		return
+	}
+	if rc, err = m.Storage.Get(c, mi.Path); err != nil {
+		return
+	}
+	mf = &MediaFile{
+		ID:          mi.ID,
+		UserID:      paths.UUID(mi.UserID),
+		ContentType: mi.ContentType,
+		Size:        mi.Size,
+	}
+	return
+}
+
+func (m *Media) isAllowed(contentType string) bool {
+	if len(m.AllowedContentTypes) == 0 {
+		return true
+	}
+	contentType = strings.ToLower(contentType)
+	for _, a := range m.AllowedContentTypes {
+		if strings.HasPrefix(contentType, strings.ToLower(strings.TrimSpace(a))) {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffContentType determines the content type of the contents, never trusting
+// the declared content type where it matters: HTML, XML such as SVG,
+// scripts, and executables are refused as MediaTypeForbidden, whether sniffed
+// or declared, so that they cannot be served as media.
+//
+// Otherwise the declared content type is used when the contents are not
+// recognized, such as for HEIC images or FLAC audio, or when it is a more
+// specific name of the sniffed type, such as "audio/ogg" for
+// "application/ogg". A declared content type of a different family than the
+// sniffed one, such as an image declared for audio, results in
+// MediaTypeMismatch.
+func sniffContentType(b []byte, declared string) (string, error) {
+	sniffed := http.DetectContentType(b)
+	st, _, err := mime.ParseMediaType(sniffed)
+	if err != nil {
+		return "", MediaTypeMismatch
+	}
+	if forbiddenContentTypes[st] || isExecutable(b) {
+		return "", MediaTypeForbidden
+	} else if len(declared) == 0 {
+		return sniffed, nil
+	}
+	dt, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return "", MediaTypeMismatch
+	} else if forbiddenContentTypes[dt] {
+		return "", MediaTypeForbidden
+	}
+	if alias, ok := contentTypeAliases[dt]; ok {
+		dt = alias
+	}
+	switch {
+	case dt == st:
+		return sniffed, nil
+	case st == "application/octet-stream":
+		// Not recognized, so the declared type is all there is to go on.
+		if mediaFamily(dt) == "text" {
+			return "", MediaTypeMismatch
+		}
+		return dt, nil
+	case st == "application/ogg" && (mediaFamily(dt) == "audio" || mediaFamily(dt) == "video"):
+		return dt, nil
+	case mediaFamily(dt) == mediaFamily(st):
+		return sniffed, nil
+	default:
+		return "", MediaTypeMismatch
+	}
+}
+
+// forbiddenContentTypes are the content types a browser may run scripts of,
+// which are never stored whether sniffed or declared.
+var forbiddenContentTypes = map[string]bool{
+	"text/html":              true,
+	"text/xml":               true,
+	"text/javascript":        true,
+	"application/xml":        true,
+	"application/xhtml+xml":  true,
+	"application/javascript": true,
+	"image/svg+xml":          true,
+}
+
+// contentTypeAliases map commonly declared names of content types to the
+// names sniffing them results in.
+var contentTypeAliases = map[string]string{
+	"image/jpg":   "image/jpeg",
+	"image/pjpeg": "image/jpeg",
+	"audio/wav":   "audio/wave",
+	"audio/x-wav": "audio/wave",
+	"audio/mp3":   "audio/mpeg",
+}
+
+// mediaFamily is the top-level type of the content type, such as "image".
+func mediaFamily(contentType string) string {
+	return strings.SplitN(contentType, "/", 2)[0]
+}
+
+// executableSignatures are the leading bytes of Windows, Linux, and macOS
+// executables, which are not sniffed as such by http.DetectContentType.
+var executableSignatures = [][]byte{
+	[]byte("MZ"),
+	[]byte("\x7fELF"),
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+	[]byte("#!"),
+}
+
+// isExecutable determines whether the contents are an executable or script.
+func isExecutable(b []byte) bool {
+	for _, sig := range executableSignatures {
+		if bytes.HasPrefix(b, sig) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ Storage = &FilesystemStorage{}
+
+// FilesystemStorage keeps media contents as files beneath a root directory.
+type FilesystemStorage struct {
+	Root string
+}
+
+func (f *FilesystemStorage) Put(c context.Context, path string, b []byte, contentType string) error {
+	p, err := f.path(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that a partially written file is
+	// never served.
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (f *FilesystemStorage) Get(c context.Context, path string) (io.ReadCloser, error) {
+	p, err := f.path(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (f *FilesystemStorage) Delete(c context.Context, path string) error {
+	p, err := f.path(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path resolves the storage path to a file beneath the root directory.
+func (f *FilesystemStorage) path(path string) (string, error) {
+	p := filepath.Join(f.Root, filepath.FromSlash(path))
+	rel, err := filepath.Rel(f.Root, p)
+	if err != nil {
+		return "", err
+	} else if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("media path escapes the storage root: %s", path)
+	}
+	return p, nil
+}
+
+var _ Storage = &S3Storage{}
+
+// S3Storage keeps media contents as objects in a bucket of an S3-compatible
+// object store, addressing the bucket by path and signing requests with AWS
+// Signature Version 4.
+type S3Storage struct {
+	Client          *http.Client
+	Endpoint        *url.URL
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+func (s *S3Storage) Put(c context.Context, path string, b []byte, contentType string) error {
+	resp, err := s.do(c, http.MethodPut, path, b, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Get(c context.Context, path string) (io.ReadCloser, error) {
+	resp, err := s.do(c, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Delete(c context.Context, path string) error {
+	resp, err := s.do(c, http.MethodDelete, path, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for the object at the path, returning an error if
+// the object store does not respond successfully.
+func (s *S3Storage) do(c context.Context, method, path string, b []byte, contentType string) (*http.Response, error) {
+	u := *s.Endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + path
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, b, time.Now().UTC())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("object store responded to %s %s with %s", method, path, resp.Status)
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to the request.
+func (s *S3Storage) sign(req *http.Request, b []byte, now time.Time) {
+	const algorithm = "AWS4-HMAC-SHA256"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(b)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
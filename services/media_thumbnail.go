@@ -0,0 +1,180 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// thumbnailSourceScale bounds the images that thumbnails are generated
+	// from to the pixels of a square this many times the largest thumbnail
+	// dimension on each side, since decoding allocates memory for every
+	// pixel. The default largest dimension admits 12 megapixel photos.
+	thumbnailSourceScale = 3
+	// maxThumbnailConfigBytes bounds how much of an image is read to
+	// determine its dimensions before it is decoded.
+	maxThumbnailConfigBytes = 1 << 20
+)
+
+var MediaNotThumbnailable error = errors.New("media cannot be thumbnailed")
+
+// Thumbnail opens a version of the image media whose width and height are at
+// most maxDim, generating and storing it the first time that size is
+// requested. A non-positive maxDim uses DefaultThumbnailDim, and maxDim is
+// capped at MaxThumbnailDim. Images already small enough are served as-is. If
+// there is no such media, a nil MediaFile is returned.
+//
+// JPEG images are thumbnailed as JPEG, while PNG, GIF, and WebP images are
+// thumbnailed as PNG, as WebP cannot be encoded. Other media, and images too
+// large to decode, result in MediaNotThumbnailable.
+func (m *Media) Thumbnail(c util.Context, id string, maxDim int) (mf *MediaFile, rc io.ReadCloser, err error) {
+	if maxDim <= 0 {
+		maxDim = m.DefaultThumbnailDim
+	}
+	if maxDim > m.MaxThumbnailDim {
+		maxDim = m.MaxThumbnailDim
+	}
+	if maxDim <= 0 {
+		return nil, nil, MediaNotThumbnailable
+	}
+	var orig, thumb models.MediaInfo
+	var found, cached bool
+	err = doInTx(c, m.DB, func(tx *sql.Tx) error {
+		orig, found, err = m.Media.Get(c, tx, id)
+		if err != nil || !found {
+			return err
+		}
+		thumb, cached, err = m.Media.GetThumbnail(c, tx, id, maxDim)
+		return err
+	})
+	if err != nil || !found {
+		return
+	}
+	mf = &MediaFile{
+		ID:          orig.ID,
+		UserID:      paths.UUID(orig.UserID),
+		ContentType: orig.ContentType,
+		Size:        orig.Size,
+	}
+	if cached {
+		mf.ContentType = thumb.ContentType
+		mf.Size = thumb.Size
+		rc, err = m.Storage.Get(c, thumb.Path)
+		return
+	}
+	var format string
+	switch orig.ContentType {
+	case "image/jpeg":
+		format = "jpeg"
+	case "image/png", "image/gif", "image/webp":
+		format = "png"
+	default:
+		mf, err = nil, MediaNotThumbnailable
+		return
+	}
+	// Read only as much of the original as determines its dimensions,
+	// refusing to decode images that are too large.
+	var src io.ReadCloser
+	if src, err = m.Storage.Get(c, orig.Path); err != nil {
+		return
+	}
+	var head bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(io.LimitReader(src, maxThumbnailConfigBytes), &head))
+	maxPixels := thumbnailSourceScale * m.MaxThumbnailDim * thumbnailSourceScale * m.MaxThumbnailDim
+	if err != nil || cfg.Width*cfg.Height > maxPixels {
+		src.Close()
+		mf, err = nil, MediaNotThumbnailable
+		return
+	}
+	whole := io.MultiReader(&head, src)
+	if cfg.Width <= maxDim && cfg.Height <= maxDim {
+		rc = struct {
+			io.Reader
+			io.Closer
+		}{whole, src}
+		return
+	}
+	img, _, err := image.Decode(whole)
+	src.Close()
+	if err != nil {
+		mf, err = nil, MediaNotThumbnailable
+		return
+	}
+	// Generate, store, and record the thumbnail.
+	var buf bytes.Buffer
+	resized := downscale(img, maxDim)
+	if format == "jpeg" {
+		mf.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+	} else {
+		mf.ContentType = "image/png"
+		err = png.Encode(&buf, resized)
+	}
+	if err != nil {
+		return
+	}
+	mf.Size = int64(buf.Len())
+	path := orig.Path + ".thumb" + strconv.Itoa(maxDim)
+	if err = m.Storage.Put(c, path, buf.Bytes(), mf.ContentType); err != nil {
+		return
+	}
+	if err = doInTx(c, m.DB, func(tx *sql.Tx) error {
+		return m.Media.CreateThumbnail(c, tx, id, maxDim, mf.ContentType, mf.Size, path)
+	}); err != nil {
+		return
+	}
+	rc = ioutil.NopCloser(&buf)
+	return
+}
+
+// downscale resizes the image so that neither its width nor height exceed
+// maxDim, preserving its aspect ratio.
+func downscale(src image.Image, maxDim int) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	dw, dh := maxDim, maxDim
+	if sw > sh {
+		dh = sh * maxDim / sw
+	} else {
+		dw = sw * maxDim / sh
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	draw.BiLinear.Scale(dst, dst.Bounds(), src, sb, draw.Src, nil)
+	return dst
+}
@@ -19,6 +19,7 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/util"
@@ -40,6 +41,12 @@ func (o *OAuth2) GetByID(ctx context.Context, id string) (ci oauth2.ClientInfo,
 	c := util.Context{ctx}
 	return ci, doInTx(c, o.DB, func(tx *sql.Tx) error {
 		ci, err = o.Client.GetByID(c, tx, id)
+		if errors.Is(err, models.ErrNotFound) {
+			// An unknown client is reported by the oauth2 manager
+			// as an invalid client.
+			ci = nil
+			return nil
+		}
 		return err
 	})
 }
@@ -150,3 +157,22 @@ func (o *OAuth2) DeleteExpiredFirstPartyCredentials(ctx context.Context) error {
 		return o.Creds.DeleteExpired(c, tx)
 	})
 }
+
+// Authorizations fetches a summary of the tokens the user has granted to each
+// third-party client.
+func (o *OAuth2) Authorizations(c util.Context, userID string) (ca []models.ClientAuthorization, err error) {
+	return ca, doInTx(c, o.DB, func(tx *sql.Tx) error {
+		ca, err = o.Token.GetAuthorizationsForUser(c, tx, userID)
+		return err
+	})
+}
+
+// RevokeAuthorization deletes the tokens the user has granted to the
+// third-party client, reporting whether there were any.
+func (o *OAuth2) RevokeAuthorization(c util.Context, userID, clientID string) (revoked bool, err error) {
+	return revoked, doInTx(c, o.DB, func(tx *sql.Tx) error {
+		n, err := o.Token.RemoveForUserClient(c, tx, userID, clientID)
+		revoked = n > 0
+		return err
+	})
+}
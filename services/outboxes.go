@@ -19,6 +19,7 @@ package services
 import (
 	"database/sql"
 	"net/url"
+	"time"
 
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/go-fed/apcore/models"
@@ -26,8 +27,10 @@ import (
 )
 
 type Outboxes struct {
-	DB       *sql.DB
-	Outboxes *models.Outboxes
+	DB        *sql.DB
+	Outboxes  *models.Outboxes
+	LocalData *models.LocalData
+	PageSizes PageSizes
 }
 
 func (i *Outboxes) GetPage(c util.Context, outbox *url.URL, min, n int) (page vocab.ActivityStreamsOrderedCollectionPage, err error) {
@@ -56,6 +59,21 @@ func (i *Outboxes) GetPublicPage(c util.Context, outbox *url.URL, min, n int) (p
 	})
 }
 
+// GetPageByType fetches a page of the outbox items that are of one of the given
+// types, such as only the Create activities.
+func (i *Outboxes) GetPageByType(c util.Context, outbox *url.URL, types []string, min, n int) (page vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	return page, doInTx(c, i.DB, func(tx *sql.Tx) error {
+		var isEnd bool
+		var mp models.ActivityStreamsOrderedCollectionPage
+		mp, isEnd, err = i.Outboxes.GetPageByType(c, tx, outbox, types, min, min+n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsOrderedCollectionPage
+		return addNextPrev(page, min, n, isEnd)
+	})
+}
+
 func (i *Outboxes) GetLastPage(c util.Context, outbox *url.URL, n int) (page vocab.ActivityStreamsOrderedCollectionPage, err error) {
 	return page, doInTx(c, i.DB, func(tx *sql.Tx) error {
 		var startIdx int
@@ -105,3 +123,105 @@ func (i *Outboxes) DeleteItem(c util.Context, outbox, item *url.URL) error {
 		return i.Outboxes.DeleteOutboxItem(c, tx, outbox, item)
 	})
 }
+
+// PostRetryAfter determines how long until the actor may post again, given
+// the limits of activities posted per rolling minute and hour, where zero means
+// no limit. Only the activities that were stored count, so posts that failed
+// do not use up the limits. It returns zero if the actor may post now.
+func (i *Outboxes) PostRetryAfter(c util.Context, actor *url.URL, perMinute, perHour int, now time.Time) (retryAfter time.Duration, err error) {
+	if perMinute == 0 && perHour == 0 {
+		return
+	}
+	window, n := time.Hour, perHour
+	if perHour == 0 {
+		window = time.Minute
+	}
+	if perMinute > n {
+		n = perMinute
+	}
+	var t []time.Time
+	if err = doInTx(c, i.DB, func(tx *sql.Tx) error {
+		t, err = i.LocalData.ActorActivityTimes(c, tx, actor, now.Add(-window), n)
+		return err
+	}); err != nil {
+		return
+	}
+	return postRetryAfter(t, perMinute, perHour, now), nil
+}
+
+// postRetryAfter determines how long until another post is within the limits,
+// given the times of the recent posts, newest first.
+func postRetryAfter(t []time.Time, perMinute, perHour int, now time.Time) (retryAfter time.Duration) {
+	for _, l := range []struct {
+		n      int
+		window time.Duration
+	}{
+		{perMinute, time.Minute},
+		{perHour, time.Hour},
+	} {
+		if l.n == 0 || len(t) < l.n {
+			continue
+		}
+		// The oldest post counting toward the limit leaves the window.
+		if d := t[l.n-1].Add(l.window).Sub(now); d > retryAfter {
+			retryAfter = d
+		}
+	}
+	return
+}
+
+// RetentionPolicy determines which outbox items are expired and what happens
+// to them.
+type RetentionPolicy struct {
+	// MaxAge is the age past which an outbox item is expired.
+	MaxAge time.Duration
+	// Tombstone only replaces expired items with a Tombstone, instead of
+	// also keeping a copy of them in the archive.
+	Tombstone bool
+	// DryRun only finds the expired items without changing them.
+	DryRun bool
+	// BatchSize is the maximum number of items to expire at once.
+	BatchSize int
+}
+
+// Expire removes the outbox items older than the policy's maximum age from
+// their outboxes, then replaces their local data with a Tombstone, archiving
+// it first unless the policy only tombstones. The local object of an expired
+// Create is expired with it. It returns the items that were expired, or would
+// have been in a dry run.
+func (i *Outboxes) Expire(c util.Context, now time.Time, p RetentionPolicy) (expired []models.ExpiredOutboxItem, err error) {
+	return expired, doInTx(c, i.DB, func(tx *sql.Tx) error {
+		expired, err = i.Outboxes.ExpiredItems(c, tx, now.Add(-p.MaxAge), p.BatchSize)
+		if err != nil || p.DryRun {
+			return err
+		}
+		// An item in several outboxes is only expired once.
+		done := make(map[string]bool, len(expired))
+		expire := func(iri *url.URL) error {
+			if done[iri.String()] {
+				return nil
+			}
+			done[iri.String()] = true
+			if !p.Tombstone {
+				if err := i.LocalData.Archive(c, tx, iri); err != nil {
+					return err
+				}
+			}
+			return i.LocalData.Tombstone(c, tx, iri, now)
+		}
+		for _, x := range expired {
+			if err := i.Outboxes.DeleteOutboxItem(c, tx, x.Outbox.URL, x.Item.URL); err != nil {
+				return err
+			}
+			if err := expire(x.Item.URL); err != nil {
+				return err
+			}
+			if x.Object != nil {
+				if err := expire(x.Object); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -25,13 +25,15 @@ import (
 	"github.com/go-fed/apcore/util"
 )
 
+// PageSizes are the default and maximum number of items in a page of a kind of
+// collection.
+type PageSizes struct {
+	Default int
+	Max     int
+}
+
 func getOffsetN(iri *url.URL, defaultSize, maxSize int) (offset, n int) {
-	offset, n = 0, defaultSize
-	if paths.IsGetCollectionPage(iri) {
-		offset = paths.GetOffsetOrDefault(iri, 0)
-		n = paths.GetNumOrDefault(iri, defaultSize, maxSize)
-	}
-	return
+	return paths.GetPageWindow(iri, defaultSize, maxSize)
 }
 
 // AnyOCPageFn fetches any arbitrary OrderedCollectionPage
@@ -53,6 +55,26 @@ func DoOrderedCollectionPagination(c util.Context, iri *url.URL, defaultSize, ma
 	} else {
 		// The first page, or an arbitrary page, was requested
 		offset, n := getOffsetN(iri, defaultSize, maxSize)
+		if cursor, ok := paths.GetPageCursor(iri); ok {
+			var index int
+			index, err = findCursor(cursor, maxSize, func(offset, n int) (ids []*url.URL, err error) {
+				var page vocab.ActivityStreamsOrderedCollectionPage
+				if page, err = any(c, paths.Normalize(iri), offset, n); err != nil {
+					return
+				}
+				if items := page.GetActivityStreamsOrderedItems(); items != nil {
+					for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+						id, _ := pub.ToId(iter)
+						ids = append(ids, id)
+					}
+				}
+				return
+			})
+			if err != nil {
+				return
+			}
+			offset, n = cursor.Window(index, n)
+		}
 		p, err = any(c, paths.Normalize(iri), offset, n)
 		return
 	}
@@ -77,11 +99,55 @@ func DoCollectionPagination(c util.Context, iri *url.URL, defaultSize, maxSize i
 	} else {
 		// The first page, or an arbitrary page, was requested
 		offset, n := getOffsetN(iri, defaultSize, maxSize)
+		if cursor, ok := paths.GetPageCursor(iri); ok {
+			var index int
+			index, err = findCursor(cursor, maxSize, func(offset, n int) (ids []*url.URL, err error) {
+				var page vocab.ActivityStreamsCollectionPage
+				if page, err = any(c, paths.Normalize(iri), offset, n); err != nil {
+					return
+				}
+				if items := page.GetActivityStreamsItems(); items != nil {
+					for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+						id, _ := pub.ToId(iter)
+						ids = append(ids, id)
+					}
+				}
+				return
+			})
+			if err != nil {
+				return
+			}
+			offset, n = cursor.Window(index, n)
+		}
 		p, err = any(c, paths.Normalize(iri), offset, n)
 		return
 	}
 }
 
+// findCursor returns the index of a cursor's item in a collection, newest
+// first, by reading the ids of the items in pages of the given size until it
+// is found. An item that is not in the collection has the index of the
+// collection's length.
+func findCursor(cursor paths.PageCursor, size int, page func(offset, n int) ([]*url.URL, error)) (int, error) {
+	if size <= 0 {
+		size = 1
+	}
+	for offset := 0; ; offset += size {
+		ids, err := page(offset, size)
+		if err != nil {
+			return 0, err
+		}
+		for i, id := range ids {
+			if id != nil && id.String() == cursor.ID.String() {
+				return offset + i, nil
+			}
+		}
+		if len(ids) < size {
+			return offset + len(ids), nil
+		}
+	}
+}
+
 // PrependFn are functions that prepend items to a collection.
 type PrependFn func(c util.Context, collectionID, item *url.URL) error
 
@@ -33,6 +33,18 @@ type Policies struct {
 }
 
 func (p *Policies) IsBlocked(c util.Context, actorID *url.URL, a pub.Activity) (blocked bool, err error) {
+	return p.matches(c, actorID, a, models.FederatedBlockPurpose)
+}
+
+// IsAutoAcceptedFollow determines whether the actor's policies permit the Follow
+// to be accepted without manual approval.
+func (p *Policies) IsAutoAcceptedFollow(c util.Context, actorID *url.URL, a pub.Activity) (accept bool, err error) {
+	return p.matches(c, actorID, a, models.AutoAcceptFollowPurpose)
+}
+
+// matches resolves the actor's policies for the purpose against the activity,
+// recording each resolution, and reports whether any policy matched.
+func (p *Policies) matches(c util.Context, actorID *url.URL, a pub.Activity, purpose models.Purpose) (matched bool, err error) {
 	var iri *url.URL
 	iri, err = pub.GetId(a)
 	if err != nil {
@@ -44,7 +56,7 @@ func (p *Policies) IsBlocked(c util.Context, actorID *url.URL, a pub.Activity) (
 		return
 	}
 	err = doInTx(c, p.DB, func(tx *sql.Tx) error {
-		pd, err := p.Policies.GetForActorAndPurpose(c, tx, actorID, models.FederatedBlockPurpose)
+		pd, err := p.Policies.GetForActorAndPurpose(c, tx, actorID, purpose)
 		if err != nil {
 			return err
 		}
@@ -63,9 +75,42 @@ func (p *Policies) IsBlocked(c util.Context, actorID *url.URL, a pub.Activity) (
 			if err != nil {
 				return err
 			}
-			blocked = blocked || res.Matched
+			matched = matched || res.Matched
 		}
 		return nil
 	})
 	return
 }
+
+// Create validates and adds a policy for the actor, returning its id.
+func (p *Policies) Create(c util.Context, actorID *url.URL, purpose models.Purpose, policy models.Policy) (policyID string, err error) {
+	if err = policy.Validate(); err != nil {
+		return
+	}
+	err = doInTx(c, p.DB, func(tx *sql.Tx) error {
+		policyID, err = p.Policies.Create(c, tx, models.CreatePolicy{
+			ActorID: actorID,
+			Purpose: purpose,
+			Policy:  policy,
+		})
+		return err
+	})
+	return
+}
+
+// GetForActorAndPurpose obtains the actor's policies for the purpose.
+func (p *Policies) GetForActorAndPurpose(c util.Context, actorID *url.URL, purpose models.Purpose) (po []models.PolicyAndID, err error) {
+	err = doInTx(c, p.DB, func(tx *sql.Tx) error {
+		po, err = p.Policies.GetForActorAndPurpose(c, tx, actorID, purpose)
+		return err
+	})
+	return
+}
+
+// Delete removes the actor's policy. It is an error if the actor has no such
+// policy.
+func (p *Policies) Delete(c util.Context, actorID *url.URL, policyID string) error {
+	return doInTx(c, p.DB, func(tx *sql.Tx) error {
+		return p.Policies.Delete(c, tx, actorID, policyID)
+	})
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/paths"
 	"github.com/go-fed/apcore/util"
+	"golang.org/x/crypto/ed25519"
 )
 
 const (
@@ -42,6 +43,12 @@ const (
 	pKeyHttpSigPurpose = "http-signature"
 )
 
+// Types of private keys that can be created for users.
+const (
+	KeyTypeRSA     = "rsa"
+	KeyTypeEd25519 = "ed25519"
+)
+
 type PrivateKeys struct {
 	Scheme      string
 	Host        string
@@ -49,45 +56,77 @@ type PrivateKeys struct {
 	PrivateKeys *models.PrivateKeys
 }
 
-func (p *PrivateKeys) GetUserHTTPSignatureKey(c util.Context, userID paths.UUID) (k *rsa.PrivateKey, iri *url.URL, err error) {
-	var kb []byte
+// HTTPSignatureKey is a private key for signing HTTP Signatures, which is
+// either an *rsa.PrivateKey or an ed25519.PrivateKey, and the IRI of its
+// public key.
+type HTTPSignatureKey struct {
+	Key crypto.PrivateKey
+	IRI *url.URL
+}
+
+// httpSigPubKeyKeys are the path keys of the IRIs of the public keys of each
+// type of private key.
+var httpSigPubKeyKeys = map[string]paths.PathKey{
+	KeyTypeRSA:     paths.HttpSigPubKeyKey,
+	KeyTypeEd25519: paths.HttpSigEd25519PubKeyKey,
+}
+
+// GetUserHTTPSignatureKeys returns the user's private keys. The RSA key, which
+// every peer can verify, is first, followed by an Ed25519 key if the user has
+// one.
+func (p *PrivateKeys) GetUserHTTPSignatureKeys(c util.Context, userID paths.UUID) (k []HTTPSignatureKey, err error) {
+	var pk []models.PrivateKey
 	err = doInTx(c, p.DB, func(tx *sql.Tx) error {
-		kb, err = p.PrivateKeys.GetByUserID(c, tx, string(userID), pKeyHttpSigPurpose)
+		pk, err = p.PrivateKeys.GetByUserID(c, tx, string(userID), pKeyHttpSigPurpose)
 		return err
 	})
 	if err != nil {
 		return
 	}
-	var pk crypto.PrivateKey
-	pk, err = deserializeRSAPrivateKey(kb)
-	var ok bool
-	k, ok = pk.(*rsa.PrivateKey)
-	if !ok {
-		err = errors.New("private key is not of type *rsa.PrivateKey")
-		return
-	}
-	iri = paths.UUIDIRIFor(p.Scheme, p.Host, paths.HttpSigPubKeyKey, userID)
-	return
+	return deserializeHTTPSignatureKeys(pk, func(pathKey paths.PathKey) *url.URL {
+		return paths.UUIDIRIFor(p.Scheme, p.Host, pathKey, userID)
+	})
 }
 
-func (p *PrivateKeys) GetUserHTTPSignatureKeyForInstanceActor(c util.Context) (k *rsa.PrivateKey, iri *url.URL, err error) {
-	var kb []byte
+// GetUserHTTPSignatureKeysForInstanceActor returns the instance actor's
+// private keys. The RSA key, which every peer can verify, is first, followed by
+// an Ed25519 key if the instance actor has one.
+func (p *PrivateKeys) GetUserHTTPSignatureKeysForInstanceActor(c util.Context) (k []HTTPSignatureKey, err error) {
+	var pk []models.PrivateKey
 	err = doInTx(c, p.DB, func(tx *sql.Tx) error {
-		kb, err = p.PrivateKeys.GetInstanceActor(c, tx, pKeyHttpSigPurpose)
+		pk, err = p.PrivateKeys.GetInstanceActor(c, tx, pKeyHttpSigPurpose)
 		return err
 	})
 	if err != nil {
 		return
 	}
-	var pk crypto.PrivateKey
-	pk, err = deserializeRSAPrivateKey(kb)
-	var ok bool
-	k, ok = pk.(*rsa.PrivateKey)
-	if !ok {
-		err = errors.New("private key is not of type *rsa.PrivateKey")
-		return
+	return deserializeHTTPSignatureKeys(pk, func(pathKey paths.PathKey) *url.URL {
+		return paths.ActorIRIFor(p.Scheme, p.Host, pathKey, paths.InstanceActor)
+	})
+}
+
+// deserializeHTTPSignatureKeys decodes stored private keys, ordering the RSA
+// key first.
+func deserializeHTTPSignatureKeys(pk []models.PrivateKey, iri func(paths.PathKey) *url.URL) (k []HTTPSignatureKey, err error) {
+	for _, keyType := range []string{KeyTypeRSA, KeyTypeEd25519} {
+		for _, b := range pk {
+			if b.KeyType != keyType {
+				continue
+			}
+			var key crypto.PrivateKey
+			key, err = deserializePrivateKey(b.PrivKey, b.KeyType)
+			if err != nil {
+				return
+			}
+			k = append(k, HTTPSignatureKey{
+				Key: key,
+				IRI: iri(httpSigPubKeyKeys[keyType]),
+			})
+		}
+	}
+	if len(k) == 0 {
+		err = errors.New("no private key for http signatures")
 	}
-	iri = paths.ActorIRIFor(p.Scheme, p.Host, paths.HttpSigPubKeyKey, paths.InstanceActor)
 	return
 }
 
@@ -107,6 +146,21 @@ func CreateKeyFile(file string) (err error) {
 	return
 }
 
+// createAndSerializeKeys creates a new private key of the given type and
+// returns its PKCS8 encoded form and the public key's PEM form. The size is
+// only used for RSA keys.
+func createAndSerializeKeys(keyType string, rsaKeySize int) (priv []byte, pub string, err error) {
+	switch keyType {
+	case KeyTypeRSA:
+		return createAndSerializeRSAKeys(rsaKeySize)
+	case KeyTypeEd25519:
+		return createAndSerializeEd25519Keys()
+	default:
+		err = fmt.Errorf("unsupported private key type: %q", keyType)
+		return
+	}
+}
+
 // createandSerializeRSAKeys creates a new RSA Private key of a given size
 // and returns its PKCS8 encoded form and the public key's PEM form.
 func createAndSerializeRSAKeys(n int) (priv []byte, pub string, err error) {
@@ -123,6 +177,23 @@ func createAndSerializeRSAKeys(n int) (priv []byte, pub string, err error) {
 	return
 }
 
+// createAndSerializeEd25519Keys creates a new Ed25519 private key and returns
+// its PKCS8 encoded form and the public key's PEM form.
+func createAndSerializeEd25519Keys() (priv []byte, pub string, err error) {
+	var pk ed25519.PublicKey
+	var k ed25519.PrivateKey
+	pk, k, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	priv, err = x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		return
+	}
+	pub, err = marshalPublicKey(pk)
+	return
+}
+
 // createRSAPrivateKey creates a new RSA Private key of a given size.
 //
 // Returns an error if the size is less than minKeySize.
@@ -153,7 +224,25 @@ func serializeRSAPrivateKey(k *rsa.PrivateKey) ([]byte, error) {
 	return x509.MarshalPKCS8PrivateKey(k)
 }
 
-// deserializeRSAPrivateKey decodes a private key from PKCS8 format.
-func deserializeRSAPrivateKey(b []byte) (crypto.PrivateKey, error) {
-	return x509.ParsePKCS8PrivateKey(b)
+// deserializePrivateKey decodes a private key from PKCS8 format, ensuring it
+// is of the stored key type.
+func deserializePrivateKey(b []byte, keyType string) (crypto.PrivateKey, error) {
+	pk, err := x509.ParsePKCS8PrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	switch k := pk.(type) {
+	case *rsa.PrivateKey:
+		if keyType != KeyTypeRSA {
+			return nil, fmt.Errorf("private key of type %q is an RSA key", keyType)
+		}
+		return k, nil
+	case ed25519.PrivateKey:
+		if keyType != KeyTypeEd25519 {
+			return nil, fmt.Errorf("private key of type %q is an Ed25519 key", keyType)
+		}
+		return k, nil
+	default:
+		return nil, errors.New("private key is neither an RSA nor an Ed25519 key")
+	}
 }
@@ -0,0 +1,123 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/app"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+var (
+	// TooManyProfileFields is returned when setting more profile fields
+	// than a user may have.
+	TooManyProfileFields error = errors.New("too many profile fields")
+	// ProfileFieldTooLong is returned when setting a profile field whose
+	// name or value is too long.
+	ProfileFieldTooLong error = errors.New("profile field name or value is too long")
+)
+
+// Defaults for the limits of profile fields when not configured.
+const (
+	defaultMaxProfileFields      = 4
+	defaultMaxProfileFieldLength = 255
+)
+
+// propertyValueType is the schema.org type of the actor attachments that are
+// profile fields, as understood by Mastodon.
+const propertyValueType = "PropertyValue"
+
+// SetProfileFields replaces the PropertyValue attachments of the user's actor
+// with the profile fields, keeping its other attachments.
+func (u *Users) SetProfileFields(c util.Context, id paths.UUID, fields []app.ProfileField) error {
+	max, maxLen := u.MaxProfileFields, u.MaxProfileFieldLength
+	if max <= 0 {
+		max = defaultMaxProfileFields
+	}
+	if maxLen <= 0 {
+		maxLen = defaultMaxProfileFieldLength
+	}
+	if len(fields) > max {
+		return TooManyProfileFields
+	}
+	for _, f := range fields {
+		if utf8.RuneCountInString(f.Name) > maxLen || utf8.RuneCountInString(f.Value) > maxLen {
+			return ProfileFieldTooLong
+		}
+	}
+	return doInTx(c, u.DB, func(tx *sql.Tx) error {
+		user, err := u.Users.UserByID(c, tx, string(id))
+		if err != nil {
+			return err
+		} else if user == nil {
+			return fmt.Errorf("no user with id: %s", id)
+		}
+		actor, err := withProfileFields(c, user.Actor.Type, fields)
+		if err != nil {
+			return err
+		}
+		return u.Users.UpdateActor(c, tx, string(id), models.ActivityStreams{actor})
+	})
+}
+
+// withProfileFields replaces the PropertyValue attachments of the actor with
+// the profile fields, keeping its other attachments.
+//
+// PropertyValue is not a type known to go-fed, so the attachments are edited
+// in the actor's serialized form.
+func withProfileFields(c context.Context, actor vocab.Type, fields []app.ProfileField) (vocab.Type, error) {
+	m, err := streams.Serialize(actor)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []interface{}
+	switch a := m["attachment"].(type) {
+	case nil:
+	case []interface{}:
+		attachments = a
+	default:
+		attachments = []interface{}{a}
+	}
+	kept := make([]interface{}, 0, len(attachments)+len(fields))
+	for _, a := range attachments {
+		if am, ok := a.(map[string]interface{}); !ok || am["type"] != propertyValueType {
+			kept = append(kept, a)
+		}
+	}
+	for _, f := range fields {
+		kept = append(kept, map[string]interface{}{
+			"type":  propertyValueType,
+			"name":  f.Name,
+			"value": f.Value,
+		})
+	}
+	if len(kept) == 0 {
+		delete(m, "attachment")
+	} else {
+		m["attachment"] = kept
+	}
+	return streams.ToType(c, m)
+}
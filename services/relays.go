@@ -0,0 +1,142 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/util"
+)
+
+// RelayNotFound is returned when the server is not subscribed to a relay.
+var RelayNotFound error = errors.New("not subscribed to the relay")
+
+// States of a subscription to a relay.
+const (
+	RelayPending  = models.RelayStatePending
+	RelayAccepted = models.RelayStateAccepted
+)
+
+// Relay is a subscription to a relay, made by the instance actor following it.
+type Relay struct {
+	Created  time.Time
+	Inbox    *url.URL
+	FollowID *url.URL
+	// Actor is nil until the relay accepts the subscription.
+	Actor *url.URL
+	State string
+}
+
+// Relays manages the server's subscriptions to relays.
+type Relays struct {
+	DB     *sql.DB
+	Relays *models.Relays
+}
+
+// Subscribe records a pending subscription to the relay with the inbox, made
+// with the Follow with the given id.
+func (r *Relays) Subscribe(c util.Context, inbox, followID *url.URL) error {
+	return doInTx(c, r.DB, func(tx *sql.Tx) error {
+		return r.Relays.Create(c, tx, inbox, followID)
+	})
+}
+
+// Accept marks the subscription made with the Follow as accepted by the actor,
+// reporting whether there was such a subscription. The actor must be on the
+// same host as the relay's inbox.
+func (r *Relays) Accept(c util.Context, followID, actor *url.URL) (ok bool, err error) {
+	err = doInTx(c, r.DB, func(tx *sql.Tx) error {
+		rl, err := r.Relays.GetByFollow(c, tx, followID)
+		if errors.Is(err, models.ErrNotFound) || (err == nil && rl.Inbox.Host != actor.Host) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		ok, err = r.Relays.Accept(c, tx, followID, actor)
+		return err
+	})
+	return
+}
+
+// IsSubscribed determines whether the actor is a relay that has accepted a
+// subscription.
+func (r *Relays) IsSubscribed(c util.Context, actor *url.URL) (subscribed bool, err error) {
+	err = doInTx(c, r.DB, func(tx *sql.Tx) error {
+		subscribed, err = r.Relays.ContainsAccepted(c, tx, actor)
+		return err
+	})
+	return
+}
+
+// Get fetches the subscription to the relay with the inbox. RelayNotFound is
+// returned if there is none.
+func (r *Relays) Get(c util.Context, inbox *url.URL) (rl Relay, err error) {
+	var mr models.Relay
+	err = doInTx(c, r.DB, func(tx *sql.Tx) error {
+		mr, err = r.Relays.Get(c, tx, inbox)
+		return err
+	})
+	if errors.Is(err, models.ErrNotFound) {
+		err = RelayNotFound
+		return
+	} else if err != nil {
+		return
+	}
+	rl = toRelay(mr)
+	return
+}
+
+// GetAll fetches every subscription to a relay, oldest first.
+func (r *Relays) GetAll(c util.Context) (rl []Relay, err error) {
+	var mr []models.Relay
+	err = doInTx(c, r.DB, func(tx *sql.Tx) error {
+		mr, err = r.Relays.GetAll(c, tx)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	rl = make([]Relay, len(mr))
+	for i, v := range mr {
+		rl[i] = toRelay(v)
+	}
+	return
+}
+
+// Unsubscribe removes the subscription to the relay with the inbox.
+func (r *Relays) Unsubscribe(c util.Context, inbox *url.URL) error {
+	return doInTx(c, r.DB, func(tx *sql.Tx) error {
+		return r.Relays.Delete(c, tx, inbox)
+	})
+}
+
+func toRelay(v models.Relay) Relay {
+	rl := Relay{
+		Created:  v.Created,
+		Inbox:    v.Inbox.URL,
+		FollowID: v.FollowID.URL,
+		State:    v.State,
+	}
+	if v.Actor.Valid {
+		rl.Actor, _ = url.Parse(v.Actor.String)
+	}
+	return rl
+}
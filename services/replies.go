@@ -0,0 +1,122 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// Replies maintains the replies collections of local objects, which contain
+// the objects in reply to them. A replies collection is created when its object
+// is first replied to.
+type Replies struct {
+	DB      *sql.DB
+	Replies *models.Replies
+}
+
+func (f *Replies) GetPage(c util.Context, replies *url.URL, min, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var isEnd bool
+		var mp models.ActivityStreamsCollectionPage
+		mp, isEnd, err = f.Replies.GetPage(c, tx, replies, min, min+n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, min, n, isEnd)
+	})
+	return
+}
+
+func (f *Replies) GetPublicPage(c util.Context, replies *url.URL, min, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var isEnd bool
+		var mp models.ActivityStreamsCollectionPage
+		mp, isEnd, err = f.Replies.GetPublicPage(c, tx, replies, min, min+n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, min, n, isEnd)
+	})
+	return
+}
+
+func (f *Replies) GetLastPage(c util.Context, replies *url.URL, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var startIdx int
+		var mp models.ActivityStreamsCollectionPage
+		mp, startIdx, err = f.Replies.GetLastPage(c, tx, replies, n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, startIdx, n, true)
+	})
+	return
+}
+
+func (f *Replies) GetPublicLastPage(c util.Context, replies *url.URL, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var startIdx int
+		var mp models.ActivityStreamsCollectionPage
+		mp, startIdx, err = f.Replies.GetPublicLastPage(c, tx, replies, n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, startIdx, n, true)
+	})
+	return
+}
+
+// Exists determines whether the replies collection has been created.
+func (f *Replies) Exists(c util.Context, replies *url.URL) (exists bool, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		exists, err = f.Replies.Exists(c, tx, paths.Normalize(replies))
+		return err
+	})
+	return
+}
+
+// AddItem prepends the reply to the replies collection of the object, creating
+// the collection if it does not yet exist, unless it already contains the
+// reply.
+func (f *Replies) AddItem(c util.Context, object, reply *url.URL) error {
+	replies := paths.RepliesIRIFor(object)
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		if exists, err := f.Replies.Exists(c, tx, replies); err != nil {
+			return err
+		} else if !exists {
+			col := emptyCollection(replies, paths.FirstPageIRI(replies), paths.LastPageIRI(replies))
+			if err := f.Replies.Create(c, tx, paths.Normalize(object), models.ActivityStreamsCollection{col}); err != nil {
+				return err
+			}
+		} else if has, err := f.Replies.Contains(c, tx, replies, reply); err != nil {
+			return err
+		} else if has {
+			return nil
+		}
+		return f.Replies.PrependItem(c, tx, replies, reply)
+	})
+}
@@ -0,0 +1,124 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+var (
+	// InvalidReportStatus is returned when listing reports with a status
+	// other than ReportOpen or ReportResolved.
+	InvalidReportStatus error = errors.New("report status must be open or resolved")
+	// ReportNotOpen is returned when resolving a report that does not
+	// exist or is already resolved.
+	ReportNotOpen error = errors.New("report does not exist or is already resolved")
+)
+
+// Statuses of a report in the moderation queue.
+const (
+	ReportOpen     = models.ReportStatusOpen
+	ReportResolved = models.ReportStatusResolved
+)
+
+// Report is a report of content, made by a local user or a peer with a Flag
+// activity.
+type Report struct {
+	ID         string    `json:"id"`
+	Created    time.Time `json:"created"`
+	ActivityID string    `json:"activityId"`
+	Reporter   string    `json:"reporter"`
+	Objects    []string  `json:"objects"`
+	Comment    string    `json:"comment,omitempty"`
+	Status     string    `json:"status"`
+	// ResolvedBy and Resolved are only set once the report is resolved.
+	ResolvedBy *paths.UUID `json:"resolvedBy,omitempty"`
+	Resolved   *time.Time  `json:"resolved,omitempty"`
+}
+
+// Reports manages the moderation queue of reported content.
+type Reports struct {
+	DB      *sql.DB
+	Reports *models.Reports
+}
+
+// Create queues a report made by the Flag activity with the given id. A Flag
+// that is already queued is ignored.
+func (r *Reports) Create(c util.Context, activityID, reporter *url.URL, objects []*url.URL, comment string) error {
+	return doInTx(c, r.DB, func(tx *sql.Tx) error {
+		return r.Reports.Create(c, tx, activityID, reporter, objects, comment)
+	})
+}
+
+// GetByStatus fetches the reports that are open or resolved, oldest first.
+func (r *Reports) GetByStatus(c util.Context, status string) (rp []Report, err error) {
+	if status != ReportOpen && status != ReportResolved {
+		err = InvalidReportStatus
+		return
+	}
+	var mr []models.Report
+	err = doInTx(c, r.DB, func(tx *sql.Tx) error {
+		mr, err = r.Reports.GetByStatus(c, tx, status)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	rp = make([]Report, len(mr))
+	for i, v := range mr {
+		objects := make([]string, len(v.Objects))
+		for j, o := range v.Objects {
+			objects[j] = o.String()
+		}
+		rp[i] = Report{
+			ID:         v.ID,
+			Created:    v.Created,
+			ActivityID: v.ActivityID.String(),
+			Reporter:   v.Reporter.String(),
+			Objects:    objects,
+			Comment:    v.Comment,
+			Status:     v.Status,
+			Resolved:   v.Resolved,
+		}
+		if v.ResolvedBy != nil {
+			by := paths.UUID(*v.ResolvedBy)
+			rp[i].ResolvedBy = &by
+		}
+	}
+	return
+}
+
+// Resolve marks the open report as resolved by the admin. ReportNotOpen is
+// returned if it does not exist or is already resolved.
+func (r *Reports) Resolve(c util.Context, id string, adminID paths.UUID) error {
+	return doInTx(c, r.DB, func(tx *sql.Tx) error {
+		ok, err := r.Reports.Resolve(c, tx, id, string(adminID))
+		if err != nil {
+			return err
+		} else if !ok {
+			return ReportNotOpen
+		}
+		return nil
+	})
+}
@@ -0,0 +1,66 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/util"
+)
+
+// SharedInboxes remembers the shared inboxes advertised by peer actors.
+type SharedInboxes struct {
+	DB            *sql.DB
+	SharedInboxes *models.SharedInboxes
+}
+
+// Learn records the shared inbox advertised by the actor owning the inbox.
+// Only a shared inbox on the same host as the inbox is recorded.
+func (s *SharedInboxes) Learn(c util.Context, inbox, sharedInbox *url.URL) error {
+	if sharedInbox.Host != inbox.Host {
+		return nil
+	}
+	return doInTx(c, s.DB, func(tx *sql.Tx) error {
+		return s.SharedInboxes.Upsert(c, tx, inbox, sharedInbox)
+	})
+}
+
+// Get maps the inboxes to the shared inboxes advertised by the actors owning
+// them. Inboxes whose shared inbox is not known, or is on another host, are
+// omitted.
+func (s *SharedInboxes) Get(c util.Context, inboxes []*url.URL) (m map[string]*url.URL, err error) {
+	m = make(map[string]*url.URL, len(inboxes))
+	if len(inboxes) == 0 {
+		return
+	}
+	var si []models.SharedInbox
+	err = doInTx(c, s.DB, func(tx *sql.Tx) error {
+		si, err = s.SharedInboxes.Get(c, tx, inboxes)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	for _, v := range si {
+		if v.SharedInbox.Host == v.Inbox.Host {
+			m[v.Inbox.String()] = v.SharedInbox.URL
+		}
+	}
+	return
+}
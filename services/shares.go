@@ -0,0 +1,113 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"database/sql"
+	"net/url"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/apcore/models"
+	"github.com/go-fed/apcore/paths"
+	"github.com/go-fed/apcore/util"
+)
+
+// Shares maintains the shares collections of local objects, which contain the
+// Announce activities that shared them. A shares collection is created when its
+// object is first shared.
+type Shares struct {
+	DB     *sql.DB
+	Shares *models.Shares
+}
+
+func (f *Shares) GetPage(c util.Context, shares *url.URL, min, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var isEnd bool
+		var mp models.ActivityStreamsCollectionPage
+		mp, isEnd, err = f.Shares.GetPage(c, tx, shares, min, min+n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, min, n, isEnd)
+	})
+	return
+}
+
+func (f *Shares) GetLastPage(c util.Context, shares *url.URL, n int) (page vocab.ActivityStreamsCollectionPage, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var startIdx int
+		var mp models.ActivityStreamsCollectionPage
+		mp, startIdx, err = f.Shares.GetLastPage(c, tx, shares, n)
+		if err != nil {
+			return err
+		}
+		page = mp.ActivityStreamsCollectionPage
+		return addNextPrevCol(page, startIdx, n, true)
+	})
+	return
+}
+
+// GetShell returns the shares collection without any of its items.
+func (f *Shares) GetShell(c util.Context, shares *url.URL) (col vocab.ActivityStreamsCollection, err error) {
+	err = doInTx(c, f.DB, func(tx *sql.Tx) error {
+		var n int
+		n, err = f.Shares.Count(c, tx, paths.Normalize(shares))
+		if err != nil {
+			return err
+		}
+		col = collectionShell(shares, n)
+		return nil
+	})
+	return
+}
+
+// AddItem prepends the Announce to the shares collection of the object,
+// creating the collection if it does not yet exist, unless it already contains
+// the Announce.
+func (f *Shares) AddItem(c util.Context, object, announce *url.URL) error {
+	shares := paths.SharesIRIFor(object)
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		if exists, err := f.Shares.Exists(c, tx, shares); err != nil {
+			return err
+		} else if !exists {
+			col := emptyCollection(shares, paths.FirstPageIRI(shares), paths.LastPageIRI(shares))
+			if err := f.Shares.Create(c, tx, paths.Normalize(object), models.ActivityStreamsCollection{col}); err != nil {
+				return err
+			}
+		} else if has, err := f.Shares.Contains(c, tx, shares, announce); err != nil {
+			return err
+		} else if has {
+			return nil
+		}
+		return f.Shares.PrependItem(c, tx, shares, announce)
+	})
+}
+
+// RemoveItem deletes the Announce from the shares collection of the object, if
+// it contains the Announce.
+func (f *Shares) RemoveItem(c util.Context, object, announce *url.URL) error {
+	shares := paths.SharesIRIFor(object)
+	return doInTx(c, f.DB, func(tx *sql.Tx) error {
+		if has, err := f.Shares.Contains(c, tx, shares, announce); err != nil {
+			return err
+		} else if !has {
+			return nil
+		}
+		return f.Shares.DeleteItem(c, tx, shares, announce)
+	})
+}
@@ -17,22 +17,125 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
 
+	"github.com/go-fed/apcore/models"
 	"github.com/go-fed/apcore/util"
 )
 
-// doInTx wraps the operations in fn with a single database transaction.
-func doInTx(c util.Context, db *sql.DB, fn func(*sql.Tx) error) error {
+// txContextKey is the key of the transaction a context is running within.
+type txContextKey struct{}
+
+// txState is a transaction shared by nested calls to WithTx.
+type txState struct {
+	db *sql.DB
+	tx *sql.Tx
+	// done is set, atomically, once the transaction is about to be
+	// committed or rolled back, after which it is no longer joined.
+	done int32
+	// afterCommit are run once the transaction is committed.
+	afterCommit []func()
+}
+
+// sqlDialects are the SQL dialects of the databases, with which WithTx makes
+// savepoints.
+var sqlDialects = struct {
+	sync.RWMutex
+	m map[*sql.DB]models.SqlDialect
+}{m: make(map[*sql.DB]models.SqlDialect)}
+
+// RegisterSqlDialect sets the SQL dialect of the database, with which nested
+// calls to WithTx make savepoints. It is called once the database is opened.
+func RegisterSqlDialect(db *sql.DB, d models.SqlDialect) {
+	sqlDialects.Lock()
+	defer sqlDialects.Unlock()
+	sqlDialects.m[db] = d
+}
+
+// WithTx runs fn within a database transaction, committing it if fn returns
+// nil and rolling it back otherwise. The context passed to fn carries the
+// transaction, so that services called with it join the transaction instead
+// of beginning their own, making operations across several models atomic.
+//
+// When already running within a transaction of the same database, fn is
+// instead run within a savepoint of it. If fn returns an error, only its
+// changes are rolled back to the savepoint, and the outer transaction may
+// continue. Like the transaction itself, the context passed to fn must not be
+// used concurrently; once the transaction has ended, a context that still
+// carries it begins a new transaction instead.
+func WithTx(c util.Context, db *sql.DB, fn func(c util.Context, tx *sql.Tx) error) error {
+	if st, ok := c.Value(txContextKey{}).(*txState); ok && st.db == db && atomic.LoadInt32(&st.done) == 0 {
+		return withSavepoint(c, st, fn)
+	}
 	tx, err := db.BeginTx(c, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	err = fn(tx)
+	st := &txState{db: db, tx: tx}
+	defer atomic.StoreInt32(&st.done, 1)
+	err = fn(util.Context{context.WithValue(c.Context, txContextKey{}, st)}, tx)
 	if err != nil {
 		return err
 	}
-	return tx.Commit()
+	atomic.StoreInt32(&st.done, 1)
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for _, fn := range st.afterCommit {
+		fn()
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the transaction the context is running within is
+// committed, or immediately if it is not running within one. If the
+// transaction, or the savepoint it was called within, is rolled back, fn is
+// not run.
+func AfterCommit(c util.Context, fn func()) {
+	if st, ok := c.Value(txContextKey{}).(*txState); ok && atomic.LoadInt32(&st.done) == 0 {
+		st.afterCommit = append(st.afterCommit, fn)
+		return
+	}
+	fn()
+}
+
+// withSavepoint runs fn within a savepoint of the ongoing transaction.
+func withSavepoint(c util.Context, st *txState, fn func(c util.Context, tx *sql.Tx) error) error {
+	sqlDialects.RLock()
+	d, ok := sqlDialects.m[st.db]
+	sqlDialects.RUnlock()
+	if !ok {
+		return fmt.Errorf("cannot nest transactions: no SQL dialect is registered for the database")
+	}
+	if _, err := st.tx.ExecContext(c, d.Savepoint()); err != nil {
+		return err
+	}
+	n := len(st.afterCommit)
+	if err := fn(c, st.tx); err != nil {
+		st.afterCommit = st.afterCommit[:n]
+		// Rolling back keeps the savepoint, which is released so that the
+		// enclosing savepoint is the most recent one again.
+		if _, rerr := st.tx.ExecContext(c, d.RollbackToSavepoint()); rerr != nil {
+			return fmt.Errorf("%w (rolling back to savepoint: %s)", err, rerr)
+		} else if _, rerr := st.tx.ExecContext(c, d.ReleaseSavepoint()); rerr != nil {
+			return fmt.Errorf("%w (releasing savepoint: %s)", err, rerr)
+		}
+		return err
+	}
+	_, err := st.tx.ExecContext(c, d.ReleaseSavepoint())
+	return err
+}
+
+// doInTx wraps the operations in fn with a single database transaction, or a
+// savepoint of the transaction that the context is already running within.
+func doInTx(c util.Context, db *sql.DB, fn func(*sql.Tx) error) error {
+	return WithTx(c, db, func(c util.Context, tx *sql.Tx) error {
+		return fn(tx)
+	})
 }
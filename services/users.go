@@ -17,11 +17,15 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams"
@@ -33,8 +37,11 @@ import (
 )
 
 var (
-	NotUniqueEmail    error = errors.New("user does not have a unique email address")
-	NotUniqueUsername error = errors.New("user does not have a unique preferredUsername")
+	NotUniqueEmail     error = errors.New("user does not have a unique email address")
+	NotUniqueUsername  error = errors.New("user does not have a unique preferredUsername")
+	InvalidStatsBucket error = errors.New("activity stats bucket is not one of: hour, day, week, month")
+	InvalidStatsRange  error = errors.New("activity stats range is empty or has too many buckets")
+	InvalidActorType   error = fmt.Errorf("actor type is not one of: %s", strings.Join(ActorTypes(), ", "))
 )
 
 // CreateUserParameters contains all parameters needed to create a user & Actor.
@@ -55,6 +62,9 @@ type CreateUserParameters struct {
 	// RSAKeySize is the size of the RSA private key to create for this
 	// user, in bits.
 	RSAKeySize int
+	// Summary is the initial summary of the ActivityPub actor representing
+	// the user.
+	Summary string
 }
 
 type User struct {
@@ -64,20 +74,32 @@ type User struct {
 }
 
 type Users struct {
-	App         app.Application
-	DB          *sql.DB
-	Users       *models.Users
-	PrivateKeys *models.PrivateKeys
-	Inboxes     *models.Inboxes
-	Outboxes    *models.Outboxes
-	Followers   *models.Followers
-	Following   *models.Following
-	Liked       *models.Liked
+	App          app.Application
+	DB           *sql.DB
+	Users        *models.Users
+	PrivateKeys  *models.PrivateKeys
+	Inboxes      *models.Inboxes
+	Outboxes     *models.Outboxes
+	Followers    *models.Followers
+	Following    *models.Following
+	Liked        *models.Liked
+	FeaturedTags *models.FeaturedTags
+	Featured     *models.Featured
+	// KeyType is the type of private key created for new users. Every user
+	// has an RSA key, which every peer can verify, and KeyTypeEd25519 also
+	// creates an Ed25519 key. Defaults to KeyTypeRSA when empty.
+	KeyType string
+	// MaxProfileFields and MaxProfileFieldLength limit the profile
+	// metadata fields of a user. Zero values use the defaults.
+	MaxProfileFields      int
+	MaxProfileFieldLength int
 	// muCheck is required to ensure certain database constraints are
 	// enforced and then maintained between different transactions, since
 	// databases are not guaranteed to be able to enforce unique constraints
 	// that we require.
 	muCheck sync.Mutex
+	// onboarding tracks the users being onboarded.
+	onboarding sync.WaitGroup
 }
 
 func (u *Users) CreateUser(c util.Context, params CreateUserParameters, password string) (userID string, err error) {
@@ -91,7 +113,7 @@ func (u *Users) CreateUser(c util.Context, params CreateUserParameters, password
 	if err != nil {
 		return
 	}
-	return u.createPersonUser(c,
+	return u.createActorUser(c,
 		params,
 		password,
 		roles,
@@ -111,7 +133,7 @@ func (u *Users) CreateAdminUser(c util.Context, params CreateUserParameters, pas
 	if err != nil {
 		return
 	}
-	return u.createPersonUser(c,
+	return u.createActorUser(c,
 		params,
 		password,
 		roles,
@@ -125,6 +147,40 @@ func (u *Users) CreateInstanceActorSingleton(c util.Context, scheme, host string
 	})
 }
 
+// EnsureInstanceActor creates the instance actor with the server preferences,
+// unless it already exists. It reports whether the instance actor was created.
+// An instance actor whose server preferences were never set, such as when
+// creating it was interrupted, is given them.
+//
+// The instance actor and its preferences are created in one transaction, and
+// concurrent calls, such as from servers starting at the same time, wait for
+// each other so that only one instance actor is created.
+func (u *Users) EnsureInstanceActor(c util.Context, scheme, host string, rsaKeySize int, p ServerPreferences) (created bool, err error) {
+	err = WithTx(c, u.DB, func(c util.Context, tx *sql.Tx) error {
+		if err := u.Users.LockInstanceActor(c, tx); err != nil {
+			return err
+		}
+		user, err := u.Users.InstanceActorUser(c, tx)
+		if err != nil {
+			return err
+		} else if user == nil {
+			if _, err = u.CreateInstanceActorSingleton(c, scheme, host, rsaKeySize); err != nil {
+				return err
+			}
+			created = true
+		} else if iap, err := u.Users.InstanceActorPreferences(c, tx); err != nil {
+			return err
+		} else if len(iap.ServerBaseURL) > 0 {
+			return nil
+		}
+		return u.SetServerPreferences(c, p)
+	})
+	if err != nil {
+		created = false
+	}
+	return
+}
+
 func (u *Users) createApplicationActor(c util.Context, actor paths.Actor, scheme, host string, rsaKeySize int, priv models.Privileges) (userID string, err error) {
 	prefUsername := host
 	return u.createUser(c,
@@ -136,18 +192,40 @@ func (u *Users) createApplicationActor(c util.Context, actor paths.Actor, scheme
 		models.Preferences{
 			OnFollow: models.OnFollowBehavior(pub.OnFollowDoNothing),
 		},
-		func(userID, pubKey string) (models.ActivityStreams, *url.URL) {
+		func(userID string, pubKeys []publicKey) (models.ActivityStreams, *url.URL) {
 			actorAS, actorID := toApplicationActor(actor,
 				scheme,
 				host,
 				host, // username
 				prefUsername,
-				pubKey)
+				pubKeys)
 			return models.ActivityStreams{actorAS}, actorID
 		})
 }
 
-func (u *Users) createPersonUser(c util.Context, params CreateUserParameters, password string, roles models.Privileges, prefs models.Preferences) (userID string, err error) {
+// actorType is the ActivityStreams type of the actors of new users, which the
+// application may choose.
+func (u *Users) actorType() string {
+	if at, ok := u.App.(app.ActorTyper); ok {
+		return at.ActorType()
+	}
+	return "Person"
+}
+
+func (u *Users) createActorUser(c util.Context, params CreateUserParameters, password string, roles models.Privileges, prefs models.Preferences) (userID string, err error) {
+	newActor, ok := userActorTypes[u.actorType()]
+	if !ok {
+		err = InvalidActorType
+		return
+	}
+	// Users without a password, such as those authenticated elsewhere,
+	// must not be able to log in with an empty one.
+	if len(password) == 0 {
+		password, err = randomPassword()
+		if err != nil {
+			return
+		}
+	}
 	// Prepare Salt & Hashed Password
 	var salt, hashpass []byte
 	salt, hashpass, err = hashPass(params.HashParams, password)
@@ -155,23 +233,54 @@ func (u *Users) createPersonUser(c util.Context, params CreateUserParameters, pa
 		return
 	}
 	prefUsername := params.Username
-	return u.createUser(c,
+	userID, err = u.createUser(c,
 		params.Email,
 		salt, hashpass,
 		params.RSAKeySize,
 		prefUsername,
 		roles,
 		prefs,
-		func(userID, pubKey string) (models.ActivityStreams, *url.URL) {
-			actor, actorID := toPersonActor(paths.UUID(userID),
+		func(userID string, pubKeys []publicKey) (models.ActivityStreams, *url.URL) {
+			actor, actorID := toUserActor(newActor(),
+				paths.UUID(userID),
 				params.Scheme,
 				params.Host,
 				params.Username,
 				prefUsername,
-				"", // summary
-				pubKey)
+				params.Summary,
+				pubKeys)
 			return models.ActivityStreams{actor}, actorID
 		})
+	if err == nil {
+		AfterCommit(c, func() {
+			u.onUserCreated(userID)
+		})
+	}
+	return
+}
+
+// onUserCreated lets the application onboard a newly created user, once it is
+// committed. Onboarding runs in the background on its own context, so that it
+// neither delays nor is cancelled with the request creating the user. The user
+// is already created, so a failure to onboard them is only logged.
+func (u *Users) onUserCreated(userID string) {
+	o, ok := u.App.(app.Onboarder)
+	if !ok {
+		return
+	}
+	u.onboarding.Add(1)
+	go func() {
+		defer u.onboarding.Done()
+		if err := o.OnUserCreated(context.Background(), paths.UUID(userID)); err != nil {
+			util.ErrorLogger.Errorf("Error onboarding created user %s: %s", userID, err)
+		}
+	}()
+}
+
+// WaitForOnboarding waits for the users being onboarded, such as before
+// closing the database.
+func (u *Users) WaitForOnboarding() {
+	u.onboarding.Wait()
 }
 
 func (u *Users) createUser(c util.Context,
@@ -181,13 +290,21 @@ func (u *Users) createUser(c util.Context,
 	prefUsername string,
 	roles models.Privileges,
 	prefs models.Preferences,
-	actor func(userID, pubKey string) (models.ActivityStreams, *url.URL)) (userID string, err error) {
-	// Prepare PrivateKey
-	var privKey []byte
-	var pubKey string
-	privKey, pubKey, err = createAndSerializeRSAKeys(rsaKeySize)
-	if err != nil {
-		return
+	actor func(userID string, pubKeys []publicKey) (models.ActivityStreams, *url.URL)) (userID string, err error) {
+	// Prepare PrivateKeys
+	keyTypes := []string{KeyTypeRSA}
+	if u.KeyType == KeyTypeEd25519 {
+		keyTypes = append(keyTypes, KeyTypeEd25519)
+	}
+	privKeys := make([][]byte, len(keyTypes))
+	pubKeys := make([]publicKey, len(keyTypes))
+	for i, keyType := range keyTypes {
+		var pem string
+		privKeys[i], pem, err = createAndSerializeKeys(keyType, rsaKeySize)
+		if err != nil {
+			return
+		}
+		pubKeys[i] = publicKey{pathKey: httpSigPubKeyKeys[keyType], pem: pem}
 	}
 
 	u.muCheck.Lock()
@@ -211,7 +328,7 @@ func (u *Users) createUser(c util.Context,
 			return err
 		}
 		// Create the ActivityStreams collections based on the userID.
-		actor, actorID := actor(userID, pubKey)
+		actor, actorID := actor(userID, pubKeys)
 		var inbox, outbox vocab.ActivityStreamsOrderedCollection
 		inbox, err = emptyInbox(actorID)
 		if err != nil {
@@ -234,17 +351,30 @@ func (u *Users) createUser(c util.Context,
 		if err != nil {
 			return err
 		}
+		var featured vocab.ActivityStreamsCollection
+		featured, err = emptyFeaturedTags(actorID)
+		if err != nil {
+			return err
+		}
+		var pinned vocab.ActivityStreamsCollection
+		pinned, err = emptyFeatured(actorID)
+		if err != nil {
+			return err
+		}
 		// Update the created user with the filled-in actor
 		err = u.Users.UpdateActor(c, tx, userID, actor)
 		if err != nil {
 			return err
 		}
 		// Insert into private_keys table
-		err = u.PrivateKeys.Create(c, tx, userID, pKeyHttpSigPurpose, privKey)
-		if err != nil {
-			return err
+		for i, keyType := range keyTypes {
+			err = u.PrivateKeys.Create(c, tx, userID, pKeyHttpSigPurpose, privKeys[i], keyType)
+			if err != nil {
+				return err
+			}
 		}
-		// Insert empty inbox, outbox, followers, following, liked
+		// Insert empty inbox, outbox, followers, following, liked, featured
+		// tags, featured
 		err = u.Inboxes.Create(c, tx, actorID, models.ActivityStreamsOrderedCollection{inbox})
 		if err != nil {
 			return err
@@ -261,7 +391,15 @@ func (u *Users) createUser(c util.Context,
 		if err != nil {
 			return err
 		}
-		return u.Liked.Create(c, tx, actorID, models.ActivityStreamsCollection{liked})
+		err = u.Liked.Create(c, tx, actorID, models.ActivityStreamsCollection{liked})
+		if err != nil {
+			return err
+		}
+		err = u.FeaturedTags.Create(c, tx, actorID, models.ActivityStreamsCollection{featured})
+		if err != nil {
+			return err
+		}
+		return u.Featured.Create(c, tx, actorID, models.ActivityStreamsCollection{pinned})
 	})
 }
 
@@ -287,13 +425,13 @@ func (u *Users) checkUserConstraints(c util.Context, tx *sql.Tx, email, prefUser
 // WARNING: Requires muCheck to be maintained throughout the life of the
 // transaction.
 func (u *Users) checkEmailAddressUnique(c util.Context, tx *sql.Tx, email string) error {
-	user, err := u.Users.SensitiveUserByEmail(c, tx, email)
-	if err != nil {
+	_, err := u.Users.SensitiveUserByEmail(c, tx, email)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil
+	} else if err != nil {
 		return err
-	} else if user != nil {
-		return NotUniqueEmail
 	}
-	return nil
+	return NotUniqueEmail
 }
 
 // checkPreferredUsernameUnique ensures the preferredUsername is unique for
@@ -355,6 +493,44 @@ func (u *Users) ActorIDForInbox(c util.Context, inboxIRI *url.URL) (actorIRI *ur
 	})
 }
 
+// CheckBoxPathTemplates determines whether the users' inboxes and outboxes
+// are at the paths the configured templates build. Their IRIs are stored and
+// known to peers, so the templates must not change once users exist. It is
+// not an error if there are no users besides the instance actor.
+func (u *Users) CheckBoxPathTemplates(c util.Context, scheme, host string) error {
+	return doInTx(c, u.DB, func(tx *sql.Tx) error {
+		user, err := u.Users.AnyUser(c, tx)
+		if err != nil || user == nil {
+			return err
+		}
+		a, ok := user.Actor.Type.(interface {
+			GetActivityStreamsInbox() vocab.ActivityStreamsInboxProperty
+			GetActivityStreamsOutbox() vocab.ActivityStreamsOutboxProperty
+		})
+		if !ok {
+			return fmt.Errorf("actor of user %s has no inbox or outbox", user.ID)
+		}
+		check := func(name string, k paths.PathKey, p pub.IdProperty) error {
+			if p == nil {
+				return fmt.Errorf("actor of user %s has no %s", user.ID, name)
+			}
+			stored, err := pub.ToId(p)
+			if err != nil {
+				return err
+			}
+			built := paths.UUIDIRIFor(scheme, host, k, paths.UUID(user.ID))
+			if stored.Path != built.Path {
+				return fmt.Errorf("the %s of user %s is at %q but ap_%s_path_template builds %q: the path templates cannot change once users exist", name, user.ID, stored.Path, name, built.Path)
+			}
+			return nil
+		}
+		if err := check("inbox", paths.InboxPathKey, a.GetActivityStreamsInbox()); err != nil {
+			return err
+		}
+		return check("outbox", paths.OutboxPathKey, a.GetActivityStreamsOutbox())
+	})
+}
+
 func (u *Users) UserByUsername(c util.Context, name string) (s *User, err error) {
 	return s, doInTx(c, u.DB, func(tx *sql.Tx) error {
 		var a *models.User
@@ -392,13 +568,17 @@ func (u *Users) UserByID(c util.Context, id paths.UUID) (s *User, err error) {
 }
 
 type Preferences struct {
-	OnFollow       pub.OnFollowBehavior
-	AppPreferences interface{}
+	OnFollow                pub.OnFollowBehavior
+	AutoAcceptMutualFollows bool
+	FollowMovedActors       bool
+	AppPreferences          interface{}
 }
 
 func (p Preferences) toModel() (pref models.Preferences, err error) {
 	pref = models.Preferences{
-		OnFollow: models.OnFollowBehavior(p.OnFollow),
+		OnFollow:                models.OnFollowBehavior(p.OnFollow),
+		AutoAcceptMutualFollows: p.AutoAcceptMutualFollows,
+		FollowMovedActors:       p.FollowMovedActors,
 	}
 	pref.Payload, err = json.Marshal(p.AppPreferences)
 	if err != nil {
@@ -429,8 +609,10 @@ func (u *Users) Preferences(c util.Context, uuid paths.UUID, appPref interface{}
 		}
 	}
 	p = &Preferences{
-		OnFollow:       pub.OnFollowBehavior(a.Preferences.OnFollow),
-		AppPreferences: appPref,
+		OnFollow:                pub.OnFollowBehavior(a.Preferences.OnFollow),
+		AutoAcceptMutualFollows: a.Preferences.AutoAcceptMutualFollows,
+		FollowMovedActors:       a.Preferences.FollowMovedActors,
+		AppPreferences:          appPref,
 	}
 	return
 }
@@ -501,11 +683,61 @@ func (u *Users) UpdatePrivileges(c util.Context, uuid string, p *Privileges) (er
 		if err := u.checkNotDuplicateInstanceUser(c, tx, priv); err != nil {
 			return err
 		}
+		// Keep any override of the posting rate limit, which is set
+		// separately.
+		a, err := u.Users.UserByID(c, tx, uuid)
+		if err != nil {
+			return err
+		} else if a != nil {
+			priv.PostRateLimit = a.Privileges.PostRateLimit
+		}
 		return u.Users.UpdatePrivileges(c, tx, uuid, priv)
 	})
 	return
 }
 
+// PostRateLimit returns the user's override of the number of posts they may
+// make to their outbox per minute and per hour. Zero uses the server's limit,
+// and a negative value means no limit.
+func (u *Users) PostRateLimit(c util.Context, uuid string) (perMinute, perHour int, err error) {
+	err = doInTx(c, u.DB, func(tx *sql.Tx) error {
+		a, err := u.Users.UserByID(c, tx, uuid)
+		if err != nil {
+			return err
+		} else if a != nil && a.Privileges.PostRateLimit != nil {
+			perMinute = a.Privileges.PostRateLimit.PerMinute
+			perHour = a.Privileges.PostRateLimit.PerHour
+		}
+		return nil
+	})
+	return
+}
+
+// SetPostRateLimit overrides the number of posts the user may make to their
+// outbox per minute and per hour. Zero uses the server's limit, and a negative
+// value means no limit.
+func (u *Users) SetPostRateLimit(c util.Context, uuid string, perMinute, perHour int) error {
+	u.muCheck.Lock()
+	defer u.muCheck.Unlock()
+	return doInTx(c, u.DB, func(tx *sql.Tx) error {
+		a, err := u.Users.UserByID(c, tx, uuid)
+		if err != nil {
+			return err
+		} else if a == nil {
+			return fmt.Errorf("no user with id %s", uuid)
+		}
+		priv := a.Privileges
+		priv.PostRateLimit = nil
+		if perMinute != 0 || perHour != 0 {
+			priv.PostRateLimit = &models.PostRateLimit{
+				PerMinute: perMinute,
+				PerHour:   perHour,
+			}
+		}
+		return u.Users.UpdatePrivileges(c, tx, uuid, priv)
+	})
+}
+
 func (u *Users) GetServerPreferences(c util.Context) (p ServerPreferences, err error) {
 	var iap models.InstanceActorPreferences
 	if err = doInTx(c, u.DB, func(tx *sql.Tx) error {
@@ -542,7 +774,115 @@ func (u *Users) SetServerPreferences(c util.Context, p ServerPreferences) (err e
 		Payload:           p.Payload,
 	}
 	err = doInTx(c, u.DB, func(tx *sql.Tx) error {
+		// Keep the announcement, which is set separately.
+		prev, err := u.Users.InstanceActorPreferences(c, tx)
+		if err != nil {
+			return err
+		}
+		iap.Announcement = prev.Announcement
+		return u.Users.SetInstanceActorPreferences(c, tx, iap)
+	})
+	return
+}
+
+// ActiveAnnouncement returns the sitewide announcement if it is shown at the
+// time, or nil otherwise.
+func (u *Users) ActiveAnnouncement(c util.Context, now time.Time) (a *app.Announcement, err error) {
+	err = doInTx(c, u.DB, func(tx *sql.Tx) error {
+		iap, err := u.Users.InstanceActorPreferences(c, tx)
+		if err != nil {
+			return err
+		} else if !iap.Announcement.Active(now) {
+			return nil
+		}
+		a = &app.Announcement{
+			Text:  iap.Announcement.Text,
+			Start: iap.Announcement.Start,
+			End:   iap.Announcement.End,
+		}
+		return nil
+	})
+	return
+}
+
+// SetAnnouncement replaces the sitewide announcement. A nil announcement
+// removes it.
+func (u *Users) SetAnnouncement(c util.Context, a *app.Announcement) error {
+	return doInTx(c, u.DB, func(tx *sql.Tx) error {
+		iap, err := u.Users.InstanceActorPreferences(c, tx)
+		if err != nil {
+			return err
+		}
+		iap.Announcement = nil
+		if a != nil {
+			iap.Announcement = &models.Announcement{
+				Text:  a.Text,
+				Start: a.Start,
+				End:   a.End,
+			}
+		}
 		return u.Users.SetInstanceActorPreferences(c, tx, iap)
 	})
+}
+
+// MaxActivityStatsBuckets is the largest number of buckets that a single
+// request for activity stats over time may span.
+const MaxActivityStatsBuckets = 1000
+
+// activityStatsBuckets are the supported spans of time for activity stats,
+// mapped to their shortest duration.
+var activityStatsBuckets = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 28 * 24 * time.Hour,
+}
+
+// ActivityStatsBucket contains statistics about the activity of users within a
+// span of time.
+type ActivityStatsBucket struct {
+	// Start is the beginning of the span of time.
+	Start time.Time `json:"start"`
+	// NewUsers is the number of users created within the span.
+	NewUsers int `json:"newUsers"`
+	// LastSeenUsers is the number of users last seen within the span.
+	LastSeenUsers int `json:"lastSeenUsers"`
+	// NewPosts is the number of local posts, excluding replies, created
+	// within the span.
+	NewPosts int `json:"newPosts"`
+}
+
+// ActivityStatsRange obtains statistics about the activity of users over time,
+// between from, inclusive, and to, exclusive. Each bucket is an "hour", "day",
+// "week", or "month" starting on its calendar boundary, so the first bucket
+// only counts activity from the start of the range.
+func (u *Users) ActivityStatsRange(c util.Context, from, to time.Time, bucket string) (b []ActivityStatsBucket, err error) {
+	d, ok := activityStatsBuckets[bucket]
+	if !ok {
+		err = InvalidStatsBucket
+		return
+	} else if !from.Before(to) || to.Sub(from)/d >= MaxActivityStatsBuckets {
+		err = InvalidStatsRange
+		return
+	}
+	// Aggregating the activity of every user is known to take long.
+	c.WithStatementTimeout(0)
+	var mb []models.UserActivityBucket
+	err = doInTx(c, u.DB, func(tx *sql.Tx) error {
+		mb, err = u.Users.ActivityStatsRange(c, tx, from, to, bucket)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	b = make([]ActivityStatsBucket, len(mb))
+	for i, v := range mb {
+		b[i] = ActivityStatsBucket{
+			Start:         v.Start,
+			NewUsers:      v.NewUsers,
+			LastSeenUsers: v.LastSeenUsers,
+			NewPosts:      v.NewPosts,
+		}
+	}
 	return
 }
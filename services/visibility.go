@@ -0,0 +1,148 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// IsPublic determines whether the value's to or cc has the Public collection,
+// in any of the forms of its IRI. It is the check of whether anyone may see a
+// value, which the SQL of the public timelines mirrors.
+func IsPublic(t vocab.Type) (bool, error) {
+	a, ok := t.(interface {
+		GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+		GetActivityStreamsCc() vocab.ActivityStreamsCcProperty
+	})
+	if !ok {
+		return false, nil
+	}
+	var ids []*url.URL
+	if p := a.GetActivityStreamsTo(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return false, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	if p := a.GetActivityStreamsCc(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			id, err := pub.ToId(iter)
+			if err != nil {
+				return false, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		if pub.IsPublic(id.String()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsAuthor determines whether the value is attributed to the actor.
+func IsAuthor(t vocab.Type, actor *url.URL) (bool, error) {
+	authors, err := AttributedTo(t)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range authors {
+		if a.String() == actor.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AttributedTo returns the actors the value is attributed to.
+func AttributedTo(t vocab.Type) ([]*url.URL, error) {
+	a, ok := t.(interface {
+		GetActivityStreamsAttributedTo() vocab.ActivityStreamsAttributedToProperty
+	})
+	if !ok || a.GetActivityStreamsAttributedTo() == nil {
+		return nil, nil
+	}
+	var authors []*url.URL
+	ap := a.GetActivityStreamsAttributedTo()
+	for iter := ap.Begin(); iter != ap.End(); iter = iter.Next() {
+		id, err := pub.ToId(iter)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, id)
+	}
+	return authors, nil
+}
+
+// AddressedTo returns the actors and collections in the to, bto, cc, bcc, and
+// audience of the value.
+func AddressedTo(t vocab.Type) ([]*url.URL, error) {
+	a, ok := t.(interface {
+		GetActivityStreamsTo() vocab.ActivityStreamsToProperty
+		GetActivityStreamsBto() vocab.ActivityStreamsBtoProperty
+		GetActivityStreamsCc() vocab.ActivityStreamsCcProperty
+		GetActivityStreamsBcc() vocab.ActivityStreamsBccProperty
+		GetActivityStreamsAudience() vocab.ActivityStreamsAudienceProperty
+	})
+	if !ok {
+		return nil, nil
+	}
+	var ids []*url.URL
+	var err error
+	add := func(p pub.IdProperty) {
+		if err != nil {
+			return
+		}
+		var id *url.URL
+		if id, err = pub.ToId(p); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if p := a.GetActivityStreamsTo(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if p := a.GetActivityStreamsBto(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if p := a.GetActivityStreamsCc(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if p := a.GetActivityStreamsBcc(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if p := a.GetActivityStreamsAudience(); p != nil {
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	return ids, err
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
@@ -31,10 +32,19 @@ import (
 const (
 	activityContextKey           = "activity"
 	activityStreamContextKey     = "activityStream"
+	rawActivityContextKey        = "rawActivity"
 	userPathUUIDContextKey       = "userPathUUID"
 	actorIRIContextKey           = "actorIRI"
 	completeRequestURLContextKey = "completeRequestURL"
 	privateScopeContextKey       = "privateScope"
+	sharedInboxContextKey        = "sharedInbox"
+	signatureVerifiedContextKey  = "signatureVerified"
+	authUserUUIDContextKey       = "authUserUUID"
+	authUserIRIContextKey        = "authUserIRI"
+	authScopeContextKey          = "authScope"
+	dereferenceBudgetContextKey  = "dereferenceBudget"
+	statementTimeoutContextKey   = "statementTimeout"
+	replicaReadContextKey        = "replicaRead"
 )
 
 type Context struct {
@@ -42,23 +52,29 @@ type Context struct {
 }
 
 // WithUserAPHTTPContext sets the UserPathUUID, ActorIRI, CompleteRequestURL,
-// and PrivateScope.
+// PrivateScope, and ReplicaRead.
 func WithUserAPHTTPContext(scheme, host string, r *http.Request, uuid paths.UUID, authdUserID string) Context {
 	c := &Context{r.Context()}
 	c.WithUserPathUUID(uuid)
 	c.WithActorIRI(paths.UUIDIRIFor(scheme, host, paths.UserPathKey, uuid))
 	c.WithCompleteRequestURL(r, scheme, host)
 	c.WithPrivateScope(len(authdUserID) > 0 && authdUserID == string(uuid))
+	c.WithReplicaRead(isReadOnlyMethod(r.Method))
 	return *c
 }
 
-// WithAPHTTPContext sets the CompleteRequestURL.
+// WithAPHTTPContext sets the CompleteRequestURL and ReplicaRead.
 func WithAPHTTPContext(scheme, host string, r *http.Request) Context {
 	c := &Context{r.Context()}
 	c.WithCompleteRequestURL(r, scheme, host)
+	c.WithReplicaRead(isReadOnlyMethod(r.Method))
 	return *c
 }
 
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
 // WithActivity is used for federating contexts.
 func (c *Context) WithActivity(t pub.Activity) {
 	c.Context = context.WithValue(c.Context, activityContextKey, t)
@@ -69,6 +85,12 @@ func (c *Context) WithActivityStream(t vocab.Type) {
 	c.Context = context.WithValue(c.Context, activityStreamContextKey, t)
 }
 
+// WithRawActivity is used for social contexts, keeping the JSON of the posted
+// activity so that values deserialization drops, such as nulls, are known.
+func (c *Context) WithRawActivity(m map[string]interface{}) {
+	c.Context = context.WithValue(c.Context, rawActivityContextKey, m)
+}
+
 // WithUserID is used for ActivityPub Inbox/Outbox contexts.
 func (c *Context) WithUserPathUUID(uuid paths.UUID) {
 	c.Context = context.WithValue(c.Context, userPathUUIDContextKey, uuid)
@@ -92,6 +114,46 @@ func (c *Context) WithPrivateScope(b bool) {
 	c.Context = context.WithValue(c.Context, privateScopeContextKey, b)
 }
 
+// WithSharedInboxDelivery is set on deliveries to the shared inbox, whose HTTP
+// Signature is verified once before being dispatched to each local recipient.
+func (c *Context) WithSharedInboxDelivery(b bool) {
+	c.Context = context.WithValue(c.Context, sharedInboxContextKey, b)
+}
+
+// WithSignatureVerified is set on deliveries to an inbox whose HTTP Signature
+// was verified before the delivery was handled.
+func (c *Context) WithSignatureVerified(b bool) {
+	c.Context = context.WithValue(c.Context, signatureVerifiedContextKey, b)
+}
+
+// WithAuthenticatedUser sets the user that authenticated the request, the IRI
+// of their actor, and the scope granted to their credential.
+func (c *Context) WithAuthenticatedUser(uuid paths.UUID, iri *url.URL, scope string) {
+	c.Context = context.WithValue(c.Context, authUserUUIDContextKey, uuid)
+	c.Context = context.WithValue(c.Context, authUserIRIContextKey, iri)
+	c.Context = context.WithValue(c.Context, authScopeContextKey, scope)
+}
+
+// WithDereferenceBudget limits the remote fetches made while processing an
+// activity.
+func (c *Context) WithDereferenceBudget(b *DereferenceBudget) {
+	c.Context = context.WithValue(c.Context, dereferenceBudgetContextKey, b)
+}
+
+// WithReplicaRead permits reads to be served by a read replica, which may lag
+// behind the primary database. Only requests that merely serve data permit it,
+// so that the side effects of activities never act on stale data.
+func (c *Context) WithReplicaRead(b bool) {
+	c.Context = context.WithValue(c.Context, replicaReadContextKey, b)
+}
+
+// WithStatementTimeout overrides the configured timeout of each database
+// statement within the transactions begun with the context, such as for
+// operations known to take long. A zero or negative duration lifts the timeout.
+func (c *Context) WithStatementTimeout(d time.Duration) {
+	c.Context = context.WithValue(c.Context, statementTimeoutContextKey, d)
+}
+
 // Activity is available in federating contexts.
 func (c Context) Activity() (t pub.Activity, err error) {
 	v := c.Value(activityContextKey)
@@ -116,6 +178,18 @@ func (c Context) ActivityStream() (t vocab.Type, err error) {
 	return
 }
 
+// RawActivity is available in social contexts.
+func (c Context) RawActivity() (m map[string]interface{}, err error) {
+	v := c.Value(rawActivityContextKey)
+	var ok bool
+	if v == nil {
+		err = errors.New("no raw activity in context")
+	} else if m, ok = v.(map[string]interface{}); !ok {
+		err = errors.New("raw activity in context is not a JSON object")
+	}
+	return
+}
+
 // UserPathUUID is used for ActivityPub HTTP contexts.
 func (c Context) UserPathUUID() (s paths.UUID, err error) {
 	return c.toUUIDValue("user path UUID", userPathUUIDContextKey)
@@ -144,6 +218,73 @@ func (c *Context) HasPrivateScope() bool {
 	}
 }
 
+// IsSharedInboxDelivery is available when dispatching deliveries made to the
+// shared inbox.
+func (c *Context) IsSharedInboxDelivery() bool {
+	b, ok := c.Value(sharedInboxContextKey).(bool)
+	return ok && b
+}
+
+// IsSignatureVerified is available when handling deliveries whose HTTP
+// Signature was already verified.
+func (c *Context) IsSignatureVerified() bool {
+	b, ok := c.Value(signatureVerifiedContextKey).(bool)
+	return ok && b
+}
+
+// IsReplicaRead is available in http requests, determining whether their reads
+// may be served by a read replica.
+func (c *Context) IsReplicaRead() bool {
+	b, ok := c.Value(replicaReadContextKey).(bool)
+	return ok && b
+}
+
+// IsAuthenticated determines whether the request was authenticated, which is
+// available in contexts from the Framework's AuthContext.
+func (c Context) IsAuthenticated() bool {
+	_, ok := c.Value(authUserUUIDContextKey).(paths.UUID)
+	return ok
+}
+
+// AuthenticatedUserUUID is available in authenticated contexts from the
+// Framework's AuthContext.
+func (c Context) AuthenticatedUserUUID() (s paths.UUID, err error) {
+	return c.toUUIDValue("authenticated user UUID", authUserUUIDContextKey)
+}
+
+// AuthenticatedUserIRI is available in authenticated contexts from the
+// Framework's AuthContext.
+func (c Context) AuthenticatedUserIRI() (u *url.URL, err error) {
+	return c.toURLValue("authenticated user IRI", authUserIRIContextKey)
+}
+
+// AuthenticatedScope is available in authenticated contexts from the
+// Framework's AuthContext.
+func (c Context) AuthenticatedScope() (s string, err error) {
+	v := c.Value(authScopeContextKey)
+	var ok bool
+	if v == nil {
+		err = errors.New("no authenticated scope in context")
+	} else if s, ok = v.(string); !ok {
+		err = errors.New("authenticated scope in context is not a string")
+	}
+	return
+}
+
+// DereferenceBudget is available when processing an activity received in an
+// inbox.
+func (c Context) DereferenceBudget() (b *DereferenceBudget, ok bool) {
+	b, ok = c.Value(dereferenceBudgetContextKey).(*DereferenceBudget)
+	return
+}
+
+// StatementTimeout is available when the timeout of database statements is
+// overridden.
+func (c Context) StatementTimeout() (d time.Duration, ok bool) {
+	d, ok = c.Value(statementTimeoutContextKey).(time.Duration)
+	return
+}
+
 func (c Context) toUUIDValue(name, key string) (s paths.UUID, err error) {
 	v := c.Value(key)
 	var ok bool
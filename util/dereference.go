@@ -0,0 +1,78 @@
+// apcore is a server framework for implementing an ActivityPub application.
+// Copyright (C) 2020 Cory Slep
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+)
+
+// ErrDereferenceLimit is returned when dereferencing an IRI would exceed the
+// number of remote fetches permitted by a DereferenceBudget.
+var ErrDereferenceLimit = errors.New("remote dereference limit exceeded")
+
+// DereferenceBudget limits the number of remote fetches made while processing
+// a single activity, such as when following a chain of replies, so that a
+// maliciously deep chain cannot cause a storm of fetches. IRIs already fetched
+// are remembered, so that a cycle does not fetch any of them twice, and a
+// fetch of an IRI already being fetched waits for its result.
+type DereferenceBudget struct {
+	max     int
+	fetched map[string]*dereferenced
+	mu      sync.Mutex
+}
+
+type dereferenced struct {
+	b    []byte
+	err  error
+	done chan struct{}
+}
+
+// NewDereferenceBudget creates a DereferenceBudget permitting max remote
+// fetches. A max of zero permits any number of fetches, which still are not
+// repeated for the same IRI.
+func NewDereferenceBudget(max int) *DereferenceBudget {
+	return &DereferenceBudget{
+		max:     max,
+		fetched: make(map[string]*dereferenced),
+	}
+}
+
+// Fetch obtains the result of dereferencing the IRI, either as remembered from
+// fetching it before or by fetching it if the budget permits.
+func (d *DereferenceBudget) Fetch(iri *url.URL, fetch func() ([]byte, error)) ([]byte, error) {
+	key := iri.String()
+	d.mu.Lock()
+	if r, ok := d.fetched[key]; ok {
+		d.mu.Unlock()
+		<-r.done
+		return r.b, r.err
+	} else if d.max > 0 && len(d.fetched) >= d.max {
+		d.mu.Unlock()
+		return nil, ErrDereferenceLimit
+	}
+	// Reserve the fetch, so that concurrent fetches count against the
+	// budget and wait for its result.
+	r := &dereferenced{done: make(chan struct{})}
+	d.fetched[key] = r
+	d.mu.Unlock()
+
+	defer close(r.done)
+	r.b, r.err = fetch()
+	return r.b, r.err
+}
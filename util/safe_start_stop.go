@@ -31,6 +31,7 @@ type SafeStartStop struct {
 	// Immutable
 	goFunc func(context.Context)
 	period time.Duration
+	paused func() bool
 	wg     sync.WaitGroup // To coordinate when goFunc is done stopping
 	mu     sync.Mutex     // Must be locked to modify any of the below
 	// Mutable
@@ -46,6 +47,12 @@ func NewSafeStartStop(fn func(context.Context), period time.Duration) *SafeStart
 	}
 }
 
+// PauseWhile skips the periodic runs made while paused reports true. It must
+// be called before Start.
+func (s *SafeStartStop) PauseWhile(paused func() bool) {
+	s.paused = paused
+}
+
 func (s *SafeStartStop) Start() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -60,7 +67,9 @@ func (s *SafeStartStop) Start() {
 		for {
 			select {
 			case <-s.fnTimer.C:
-				s.goFunc(s.fnCtx)
+				if s.paused == nil || !s.paused() {
+					s.goFunc(s.fnCtx)
+				}
 				// Timers are tricky to get correct, especially
 				// when calling Reset. From the documentation:
 				//
@@ -93,3 +102,16 @@ func (s *SafeStartStop) Stop() {
 	s.fnCtx = nil
 	s.fnCancel = nil
 }
+
+// DefaultGrace is the grace period used when none is configured.
+const DefaultGrace = 30 * time.Second
+
+// GraceContext returns a context that expires after the grace period, or after
+// DefaultGrace if the grace period is zero, so that shutting down cannot wait
+// indefinitely.
+func GraceContext(grace time.Duration) (context.Context, context.CancelFunc) {
+	if grace <= 0 {
+		grace = DefaultGrace
+	}
+	return context.WithTimeout(context.Background(), grace)
+}